@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime/debug"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -36,9 +37,13 @@ import (
 	"golang.org/x/time/rate"
 	"sigs.k8s.io/dranet/pkg/cloudprovider"
 	"sigs.k8s.io/dranet/pkg/cloudprovider/discovery"
+	"sigs.k8s.io/dranet/pkg/cloudprovider/file"
 	"sigs.k8s.io/dranet/pkg/cloudprovider/webhook"
 	"sigs.k8s.io/dranet/pkg/driver"
+	"sigs.k8s.io/dranet/pkg/filter"
 	"sigs.k8s.io/dranet/pkg/inventory"
+	"sigs.k8s.io/dranet/pkg/ipam"
+	"sigs.k8s.io/dranet/pkg/names"
 	"sigs.k8s.io/dranet/pkg/pcidb"
 
 	resourcev1 "k8s.io/api/resource/v1"
@@ -58,16 +63,38 @@ var (
 	kubeconfig        string
 	bindAddress       string
 	celExpression     string
+	filterErrorAction string
 	dbPath            string
 	minPollInterval   time.Duration
 	maxPollInterval   time.Duration
 	pollBurst         int
 	moveIBInterfaces  bool
+	exposeUplink      bool
+	excludeBondSlaves bool
+	publishVFIO       bool
+	normalizedPrefix  string
+	ipamPools         string
+	deniedFeatures    string
+	fixedPolicy       string
+	customAttributes  string
+	nriPluginName     string
+	nriPluginIndex    string
+	maxPrepare        int
+	keepV6LinkLocal   bool
+	carrierTimeout    time.Duration
+	driftInterval     time.Duration
+	restartAttempts   int
+	linkUpOnly        bool
+	linkDownGrace     time.Duration
+	reservedDevices   string
 	cloudProviderHint string
 	profileProvider   string
+	profileDir        string
 	webhookURL        string
+	debugHandlers     bool
 
-	ready atomic.Bool
+	ready         atomic.Bool
+	networkDriver atomic.Pointer[driver.NetworkDriver]
 )
 
 func init() {
@@ -75,14 +102,35 @@ func init() {
 	flag.StringVar(&bindAddress, "bind-address", ":9177", "The IP address and port for the metrics and healthz server to serve on")
 	flag.StringVar(&hostnameOverride, "hostname-override", "", "If non-empty, will be used as the name of the Node that kube-network-policies is running on. If unset, the node name is assumed to be the same as the node's hostname.")
 	flag.StringVar(&celExpression, "filter", `!("dra.net/type" in attributes) || attributes["dra.net/type"].StringValue  != "veth"`, "CEL expression to filter network interface attributes (v1.DeviceAttribute).")
+	flag.StringVar(&filterErrorAction, "filter-error-action", string(filter.ErrorActionKeep), "Action for devices whose attributes fail the filter evaluation, e.g. an attribute accessed by the filter is missing (keep, drop). 'keep' publishes the device, 'drop' hides it.")
 	flag.StringVar(&dbPath, "db-path", filepath.Join("/var/run/dranet", "dranet.db"), "Path to the persistent bbolt database file. Set to an empty string to disable persistence and use in-memory state.")
 	flag.DurationVar(&minPollInterval, "inventory-min-poll-interval", 2*time.Second, "The minimum interval between two consecutive polls of the inventory.")
 	flag.DurationVar(&maxPollInterval, "inventory-max-poll-interval", 1*time.Minute, "The maximum interval between two consecutive polls of the inventory.")
 	flag.IntVar(&pollBurst, "inventory-poll-burst", 5, "The number of polls that can be run in a burst.")
 	flag.BoolVar(&moveIBInterfaces, "move-ib-interfaces", true, "If true, InfiniBand (IPoIB) network interfaces associated with PCI devices are moved into pod network namespace. If false, moving IB network interfaces are skipped and the underlying device is exposed as an IB-only RDMA device.")
+	flag.BoolVar(&exposeUplink, "expose-uplink", false, "If true, the interfaces carrying the default route and their children are published as devices instead of being excluded. Moving them into a pod can break the node connectivity, only intended for development, e.g. on single-NIC nodes.")
+	flag.BoolVar(&excludeBondSlaves, "exclude-bond-slaves", true, "If true, the interfaces enslaved to a bond are not published as devices, claiming them would disrupt the bond. The bond slaves have the dra.net/bondMaster attribute.")
+	flag.BoolVar(&publishVFIO, "publish-vfio-devices", false, "If true, the PCI network devices bound to vfio-pci, e.g. for DPDK, are published as devices of kind pci. Only enable it if no other component, like KubeVirt or the SR-IOV device plugin, allocates them. The devices sharing their IOMMU group with other devices are not published.")
+	flag.BoolVar(&linkUpOnly, "publish-link-up-only", false, "If true, the interfaces whose operational state is not up, e.g. not cabled yet, are not published as devices. The interfaces that do not report their operational state are published.")
+	flag.DurationVar(&linkDownGrace, "link-down-grace-period", 30*time.Second, "With --publish-link-up-only, how long an interface that went down is still published, so briefly flapping links are not dropped.")
+	flag.StringVar(&reservedDevices, "reserved-devices-file", "", "Path to a file listing the devices reserved for the host, which are never published, one interface name or PCI address (e.g. 0000:8e:00.0) per line. The file is read on every scan of the inventory. The interfaces whose alias starts with 'dranet-reserved' are also reserved.")
+	flag.StringVar(&customAttributes, "custom-sysfs-attributes", "", "Comma separated list of attrName=sysfsRelativePath pairs of site-specific attributes of the interfaces, e.g. 'label=device/label'. The file at the path relative to /sys/class/net/<ifname> is published as the custom.dra.net/<attrName> attribute of the interface.")
+	flag.StringVar(&normalizedPrefix, "normalized-interface-prefix", names.NormalizedInterfacePrefix, "Prefix of the device names of the interfaces whose name is not a valid DNS-1123 label, followed by '-' and the base32 encoding of the interface name. It must be a DNS-1123 label. Changing it renames the published devices of these interfaces, the claims selecting them by name must be updated.")
+	flag.StringVar(&ipamPools, "ipam-pools", "", "Comma separated list of name=CIDR address pools of this node, e.g. 'storage=10.10.0.0/24,rdma=fd00:10::/64'. Claims allocate the interface address from a pool with the interface ipamPool field.")
+	flag.StringVar(&deniedFeatures, "ethtool-denied-features", "", "Comma separated list of ethtool features that claims are not allowed to change, e.g. 'rx,tx'. Claims requesting any of them, or one of their aliases, fail to prepare.")
+	flag.StringVar(&fixedPolicy, "ethtool-fixed-feature-policy", string(driver.EthtoolFixedFeaturePolicyError), "Policy for claims requesting ethtool features the device does not allow to change, shown as [fixed] by 'ethtool -k' (error, skip). 'error' fails the claim, 'skip' does not apply them and records a Warning event on the claim.")
+	flag.StringVar(&nriPluginName, "nri-plugin-name", "", "Name of the NRI plugin, defaults to the driver name. Set it with --nri-plugin-index to run several DRA network drivers on the same node.")
+	flag.StringVar(&nriPluginIndex, "nri-plugin-index", "00", "Two digits index of the NRI plugin, it must be unique on the node and defines the order the runtime invokes the plugins.")
+	flag.IntVar(&maxPrepare, "max-prepare-concurrency", 4, "The maximum number of resource claims prepared concurrently, each one may wait for network round trips like DHCP.")
+	flag.IntVar(&restartAttempts, "max-restart-attempts", 5, "The number of times the NRI plugin and the inventory are run, with exponential backoff between the restarts, before the driver exits. Zero restarts them forever.")
+	flag.BoolVar(&keepV6LinkLocal, "preserve-ipv6-link-local-route", true, "If true, the on-link IPv6 link-local route (fe80::/64) of an interface is moved to the pod with its other routes. The IPv4 link-local routes are always moved.")
+	flag.DurationVar(&driftInterval, "drift-check-interval", time.Minute, "Interval at which the interfaces of the running Pods are checked to still be in the Pod network namespace with their addresses and routes. The missing addresses and routes are restored and reported in the NetworkDrift condition of the ResourceClaim. Zero disables the checks.")
+	flag.DurationVar(&carrierTimeout, "link-carrier-timeout", 0, "If not zero, the maximum time to wait for the interfaces moved to a Pod to have carrier before reporting the NetworkReady condition. The Pod is not failed on timeout, the condition is reported false with reason LinkCarrierTimeout instead.")
 	flag.StringVar(&cloudProviderHint, "cloud-provider-hint", "", "Hint for the cloud provider that will be used to select the appropriate provider plugin. Supported values: (AWS, GCE, AZURE, OKE, webhook, NONE). If left unset, the cloud provider is auto-detected.")
-	flag.StringVar(&profileProvider, "profile-provider", "cloud", "Provides user intent (cloud, webhook, none). 'cloud' falls back to the cloud-provider's native implementation.")
+	flag.StringVar(&profileProvider, "profile-provider", "cloud", "Provides user intent (cloud, webhook, file, none). 'cloud' falls back to the cloud-provider's native implementation. 'file' resolves the profiles from the NetworkConfig files in --profile-dir.")
+	flag.StringVar(&profileDir, "profile-dir", "/etc/dranet/profiles", "Directory of the profiles of the file profile provider, one NetworkConfig file in JSON or YAML per profile named after it, e.g. a mounted ConfigMap.")
 	flag.StringVar(&webhookURL, "webhook-url", "", "URL for the webhook provider (required if using webhook for either provider)")
+	flag.BoolVar(&debugHandlers, "enable-debug-handlers", false, "If true, the server of --bind-address serves the configuration the driver applied to a Pod and the live state of its interfaces at /debug/pods/<pod-uid>. It is only served to the loopback clients, e.g. through kubectl port-forward.")
 
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr, "Usage: dranet [options]\n\n")
@@ -104,12 +152,29 @@ func main() {
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		if !ready.Load() {
 			w.WriteHeader(http.StatusServiceUnavailable)
-		} else {
-			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Fail early if the runtime is gone instead of waiting for the NRI
+		// plugin to exhaust its restarts.
+		if err := networkDriver.Load().CheckNRIHealth(); err != nil {
+			klog.Infof("healthz check failed: %v", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
 		}
+		w.WriteHeader(http.StatusOK)
 	})
 	// Add metrics handler
 	mux.Handle("/metrics", promhttp.Handler())
+	if debugHandlers {
+		mux.HandleFunc("GET /debug/pods/{uid}", func(w http.ResponseWriter, r *http.Request) {
+			np := networkDriver.Load()
+			if np == nil {
+				http.Error(w, "the driver is not running", http.StatusServiceUnavailable)
+				return
+			}
+			np.ServePodConfig(w, r)
+		})
+	}
 	go func() {
 		_ = http.ListenAndServe(bindAddress, mux)
 	}()
@@ -158,6 +223,12 @@ func main() {
 		opts = append(opts, driver.WithDBPath(dbPath))
 	}
 
+	// The action is validated even without a filter, so a typo is not
+	// silently ignored until a filter is set.
+	filterAction, err := filter.ParseErrorAction(filterErrorAction)
+	if err != nil {
+		klog.Fatalf("invalid --filter-error-action: %v", err)
+	}
 	if celExpression != "" {
 		env, err := cel.NewEnv(
 			ext.NativeTypes(
@@ -177,21 +248,81 @@ func main() {
 			klog.Fatalf("program construction error: %s", err)
 		}
 		opts = append(opts, driver.WithFilter(prg))
+		opts = append(opts, driver.WithFilterErrorAction(filterAction))
+	}
+	if ipamPools != "" {
+		pools, err := ipam.ParsePools(ipamPools)
+		if err != nil {
+			klog.Fatalf("invalid --ipam-pools: %v", err)
+		}
+		allocator := ipam.NewAllocator(pools)
+		klog.Infof("IPAM pools configured: %v", allocator.Pools())
+		opts = append(opts, driver.WithIPAM(allocator))
+	}
+
+	if deniedFeatures != "" {
+		var features []string
+		for _, feature := range strings.Split(deniedFeatures, ",") {
+			if feature = strings.TrimSpace(feature); feature != "" {
+				features = append(features, feature)
+			}
+		}
+		klog.Infof("ethtool features denied to claims: %v", features)
+		opts = append(opts, driver.WithDeniedEthtoolFeatures(features))
+	}
+	policy, err := driver.ParseEthtoolFixedFeaturePolicy(fixedPolicy)
+	if err != nil {
+		klog.Fatalf("invalid --ethtool-fixed-feature-policy: %v", err)
+	}
+	opts = append(opts, driver.WithEthtoolFixedFeaturePolicy(policy))
+
+	if maxPrepare < 1 {
+		klog.Fatalf("invalid --max-prepare-concurrency %d, must be at least 1", maxPrepare)
+	}
+	opts = append(opts, driver.WithMaxPrepareConcurrency(maxPrepare))
+	opts = append(opts, driver.WithPreserveIPv6LinkLocalRoute(keepV6LinkLocal))
+	opts = append(opts, driver.WithLinkCarrierTimeout(carrierTimeout))
+	opts = append(opts, driver.WithDriftCheckInterval(driftInterval))
+	opts = append(opts, driver.WithMaxRestartAttempts(restartAttempts))
+	if nriPluginName != "" {
+		opts = append(opts, driver.WithNRIPluginName(nriPluginName))
 	}
-	cloudInst, profProv, err := setupProviders(ctx, cloudProviderHint, profileProvider, webhookURL)
+	opts = append(opts, driver.WithNRIPluginIndex(nriPluginIndex))
+
+	cloudInst, loadCloudInst, profProv, err := setupProviders(ctx, cloudProviderHint, profileProvider, profileDir, webhookURL)
 	if err != nil {
 		klog.Fatalf("failed to setup providers: %v", err)
 	}
 
+	if err := names.ValidateNormalizedInterfacePrefix(normalizedPrefix); err != nil {
+		klog.Fatalf("invalid --normalized-interface-prefix: %v", err)
+	}
+
+	sysfsAttributes, err := inventory.ParseCustomSysfsAttributes(customAttributes)
+	if err != nil {
+		klog.Fatalf("invalid --custom-sysfs-attributes: %v", err)
+	}
+
 	optsDb := []inventory.Option{
 		inventory.WithRateLimiter(rate.NewLimiter(rate.Every(minPollInterval), pollBurst)),
 		inventory.WithMaxPollInterval(maxPollInterval),
 		inventory.WithMoveIBInterfaces(moveIBInterfaces),
+		inventory.WithExposeUplink(exposeUplink),
+		inventory.WithExcludeBondSlaves(excludeBondSlaves),
+		inventory.WithPublishVFIODevices(publishVFIO),
+		inventory.WithPublishLinkUpOnly(linkUpOnly, linkDownGrace),
+		inventory.WithReservedDevicesFile(reservedDevices),
+		inventory.WithNormalizedInterfacePrefix(normalizedPrefix),
+		inventory.WithCustomSysfsAttributes(sysfsAttributes),
+		inventory.WithCloudProfileProvider(profileProvider == "cloud"),
 	}
 
 	if cloudInst != nil {
 		optsDb = append(optsDb, inventory.WithCloudInstance(cloudInst))
 	}
+	if loadCloudInst != nil {
+		optsDb = append(optsDb, inventory.WithCloudInstanceLoader(loadCloudInst))
+	}
 	if profProv != nil {
 		optsDb = append(optsDb, inventory.WithProfileProvider(profProv))
 	}
@@ -204,6 +335,7 @@ func main() {
 	}
 	defer dranet.Stop(cancel)
 
+	networkDriver.Store(dranet)
 	ready.Store(true)
 	klog.Info("driver started")
 
@@ -232,8 +364,13 @@ func printVersion() {
 	klog.Infof("dranet go %s build: %s time: %s", info.GoVersion, vcsRevision, vcsTime)
 }
 
-func setupProviders(ctx context.Context, cloudProviderHint string, profileProvider string, webhookURL string) (cloudprovider.CloudInstance, cloudprovider.ProfileProvider, error) {
+// setupProviders returns the cloud instance and the profile provider. The
+// properties of the instances whose metadata server is polled are gathered
+// in the background by the returned loader instead; with the cloud profile
+// provider, the inventory resolves the profiles with the loaded instance.
+func setupProviders(ctx context.Context, cloudProviderHint string, profileProvider string, profileDir string, webhookURL string) (cloudprovider.CloudInstance, func(context.Context) (cloudprovider.CloudInstance, error), cloudprovider.ProfileProvider, error) {
 	var cloudInst cloudprovider.CloudInstance
+	var loadCloudInst func(context.Context) (cloudprovider.CloudInstance, error)
 	var profProv cloudprovider.ProfileProvider
 	var err error
 
@@ -246,10 +383,16 @@ func setupProviders(ctx context.Context, cloudProviderHint string, profileProvid
 	}
 
 	// Setup the Underlay (Hardware Discovery / Cloud Instance Info)
-	cloudInst, err = discovery.GetInstanceProperties(ctx, hint, webhookURL)
-	if err != nil {
-		klog.Infof("failed to initialize cloud provider %q: %v", hint, err)
-		cloudInst = nil
+	if discovery.PollsMetadataServer(hint) {
+		loadCloudInst = func(ctx context.Context) (cloudprovider.CloudInstance, error) {
+			return discovery.GetInstanceProperties(ctx, hint, webhookURL)
+		}
+	} else {
+		cloudInst, err = discovery.GetInstanceProperties(ctx, hint, webhookURL)
+		if err != nil {
+			klog.Infof("failed to initialize cloud provider %q: %v", hint, err)
+			cloudInst = nil
+		}
 	}
 
 	// Setup the Overlay (Profile Provider / User Intent)
@@ -262,7 +405,7 @@ func setupProviders(ctx context.Context, cloudProviderHint string, profileProvid
 		}
 	case "webhook":
 		if webhookURL == "" {
-			return nil, nil, fmt.Errorf("--webhook-url is required when using the webhook profile provider")
+			return nil, nil, nil, fmt.Errorf("--webhook-url is required when using the webhook profile provider")
 		}
 		var wh *webhook.WebhookProvider
 		if existing, ok := cloudInst.(*webhook.WebhookProvider); ok {
@@ -270,19 +413,25 @@ func setupProviders(ctx context.Context, cloudProviderHint string, profileProvid
 		} else {
 			wh, err = webhook.NewWebhookProvider(ctx, webhookURL)
 			if err != nil {
-				return nil, nil, fmt.Errorf("failed to initialize webhook profile provider: %v", err)
+				return nil, nil, nil, fmt.Errorf("failed to initialize webhook profile provider: %v", err)
 			}
 		}
 
 		if !wh.HasProfileProvider() {
-			return nil, nil, fmt.Errorf("webhook at %q does not support ProfileProvider capability", webhookURL)
+			return nil, nil, nil, fmt.Errorf("webhook at %q does not support ProfileProvider capability", webhookURL)
 		}
 		profProv = wh
+	case "file":
+		fp, err := file.NewFileProvider(profileDir)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to initialize file profile provider: %v", err)
+		}
+		profProv = fp
 	case "none":
 		profProv = nil
 	default:
-		return nil, nil, fmt.Errorf("unsupported profile provider: %s", profileProvider)
+		return nil, nil, nil, fmt.Errorf("unsupported profile provider: %s", profileProvider)
 	}
 
-	return cloudInst, profProv, nil
+	return cloudInst, loadCloudInst, profProv, nil
 }
@@ -39,6 +39,7 @@ func TestSetupProviders(t *testing.T) {
 		name              string
 		cloudProviderHint string
 		profileProvider   string
+		profileDir        string
 		webhookURL        string // explicit URL to bypass mock server creation
 		webhookCaps       *webhook.Capabilities
 		expectCloudInst   bool
@@ -134,6 +135,26 @@ func TestSetupProviders(t *testing.T) {
 			expectProfProv:    false,
 			expectErr:         true, // profProv fails
 		},
+		{
+			name:              "Profile provider file reads the profiles directory",
+			cloudProviderHint: "NONE",
+			profileProvider:   "file",
+			profileDir:        t.TempDir(),
+			webhookURL:        "empty",
+			expectCloudInst:   false,
+			expectProfProv:    true,
+			expectErr:         false,
+		},
+		{
+			name:              "Profile provider file missing directory hard fails",
+			cloudProviderHint: "NONE",
+			profileProvider:   "file",
+			profileDir:        "/nonexistent/profiles",
+			webhookURL:        "empty",
+			expectCloudInst:   false,
+			expectProfProv:    false,
+			expectErr:         true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -153,7 +174,7 @@ func TestSetupProviders(t *testing.T) {
 				endpoint = srv.URL
 			}
 
-			cloudInst, profProv, err := setupProviders(ctx, tt.cloudProviderHint, tt.profileProvider, endpoint)
+			cloudInst, _, profProv, err := setupProviders(ctx, tt.cloudProviderHint, tt.profileProvider, tt.profileDir, endpoint)
 
 			if (err != nil) != tt.expectErr {
 				t.Errorf("expected error: %v, got: %v", tt.expectErr, err)
@@ -169,3 +190,25 @@ func TestSetupProviders(t *testing.T) {
 		})
 	}
 }
+
+// TestSetupProvidersLoadsCloudInstanceInBackground only checks that the
+// metadata server of the cloud providers is not polled at startup, the loader
+// returned is not run.
+func TestSetupProvidersLoadsCloudInstanceInBackground(t *testing.T) {
+	for _, hint := range []string{"GCE", "AWS", "AZURE", "OKE"} {
+		for _, profileProvider := range []string{"none", "cloud"} {
+			t.Run(hint+"/"+profileProvider, func(t *testing.T) {
+				cloudInst, loadCloudInst, profProv, err := setupProviders(context.Background(), hint, profileProvider, "", "")
+				if err != nil {
+					t.Fatalf("setupProviders() failed: %v", err)
+				}
+				if cloudInst != nil || profProv != nil {
+					t.Errorf("expected no cloudInst and no profProv at startup, got: %v, %v", cloudInst, profProv)
+				}
+				if loadCloudInst == nil {
+					t.Errorf("expected a loader for the cloud instance properties")
+				}
+			})
+		}
+	}
+}
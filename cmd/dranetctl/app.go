@@ -27,7 +27,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/dranet/pkg/dranetctl/genclaim"
 	"sigs.k8s.io/dranet/pkg/dranetctl/gke"
+	"sigs.k8s.io/dranet/pkg/dranetctl/watch"
 )
 
 var rootCmd = &cobra.Command{
@@ -66,4 +68,7 @@ func init() {
 	// TODO(aojea) add other cloud providers
 	// GKE subcommand
 	rootCmd.AddCommand(gke.GkeCmd)
+	// Local commands, they do not need a cluster
+	rootCmd.AddCommand(watch.WatchCmd)
+	rootCmd.AddCommand(genclaim.GenClaimCmd)
 }
@@ -9,10 +9,10 @@
 // in a netlink response, meaning something changed during the dump so results
 // may be incomplete or inconsistent.
 //
-// At present, the possibly incomplete/inconsistent results are not returned
-// by netlink functions along with the EINTR. So, it's not possible to do
-// anything but retry. After maxAttempts the EINTR will be returned to the
-// caller.
+// The wrapped functions retry up to maxAttempts times. If the dump is still
+// interrupted after that, the error is discarded and the possibly
+// incomplete/inconsistent results of the last attempt are returned, so all the
+// wrappers, package functions and Handle methods alike, behave the same way.
 
 // SPDX-License-Identifier: Apache-2.0
 // Copyright Docker, Inc.
@@ -148,6 +148,28 @@ func LinkList() ([]netlink.Link, error) {
 	return links, discardErrDumpInterrupted(err)
 }
 
+// NeighList calls netlink.NeighList, retrying if necessary.
+func NeighList(linkIndex, family int) ([]netlink.Neigh, error) {
+	var neighs []netlink.Neigh
+	var err error
+	retryOnIntr(func() error {
+		neighs, err = netlink.NeighList(linkIndex, family) //nolint:forbidigo
+		return err
+	})
+	return neighs, discardErrDumpInterrupted(err)
+}
+
+// NeighList calls h.Handle.NeighList, retrying if necessary.
+func (h Handle) NeighList(linkIndex, family int) ([]netlink.Neigh, error) {
+	var neighs []netlink.Neigh
+	var err error
+	retryOnIntr(func() error {
+		neighs, err = h.Handle.NeighList(linkIndex, family) //nolint:forbidigo
+		return err
+	})
+	return neighs, discardErrDumpInterrupted(err)
+}
+
 // RouteList calls h.Handle.RouteList, retrying if necessary.
 func (h Handle) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
 	var routes []netlink.Route
@@ -156,7 +178,7 @@ func (h Handle) RouteList(link netlink.Link, family int) ([]netlink.Route, error
 		routes, err = h.Handle.RouteList(link, family) //nolint:forbidigo
 		return err
 	})
-	return routes, err
+	return routes, discardErrDumpInterrupted(err)
 }
 
 // RouteList calls netlink.RouteList, retrying if necessary.
@@ -189,7 +211,7 @@ func (h Handle) RouteListFiltered(family int, filter *netlink.Route, filterMask
 		routes, err = h.Handle.RouteListFiltered(family, filter, filterMask) //nolint:forbidigo
 		return err
 	})
-	return routes, err
+	return routes, discardErrDumpInterrupted(err)
 }
 
 // RouteListFiltered calls netlink.RouteListFiltered, retrying if necessary.
@@ -222,7 +244,7 @@ func (h *Handle) QdiscList(link netlink.Link) ([]netlink.Qdisc, error) {
 		qdisc, err = h.Handle.QdiscList(link) //nolint:forbidigo
 		return err
 	})
-	return qdisc, err
+	return qdisc, discardErrDumpInterrupted(err)
 }
 
 // LinkGetProtinfo calls netlink.LinkGetProtinfo, retrying if necessary.
@@ -244,7 +266,7 @@ func (h *Handle) LinkGetProtinfo(link netlink.Link) (netlink.Protinfo, error) {
 		protinfo, err = h.Handle.LinkGetProtinfo(link) //nolint:forbidigo
 		return err
 	})
-	return protinfo, err
+	return protinfo, discardErrDumpInterrupted(err)
 }
 
 // RuleListFiltered calls netlink.RuleListFiltered, retrying if necessary.
@@ -266,7 +288,7 @@ func (h *Handle) RuleListFiltered(family int, filter *netlink.Rule, filterMask u
 		rules, err = h.Handle.RuleListFiltered(family, filter, filterMask) //nolint:forbidigo
 		return err
 	})
-	return rules, err
+	return rules, discardErrDumpInterrupted(err)
 }
 
 // FilterList calls netlink.FilterList, retrying if necessary.
@@ -288,7 +310,7 @@ func (h *Handle) FilterList(link netlink.Link, parent uint32) ([]netlink.Filter,
 		filters, err = h.Handle.FilterList(link, parent) //nolint:forbidigo
 		return err
 	})
-	return filters, err
+	return filters, discardErrDumpInterrupted(err)
 }
 
 // RuleList calls netlink.RuleList, retrying if necessary.
@@ -310,7 +332,7 @@ func (h *Handle) RuleList(family int) ([]netlink.Rule, error) {
 		rules, err = h.Handle.RuleList(family) //nolint:forbidigo
 		return err
 	})
-	return rules, err
+	return rules, discardErrDumpInterrupted(err)
 }
 
 // ConntrackDeleteFilters calls netlink.ConntrackDeleteFilters, retrying if necessary.
@@ -332,7 +354,7 @@ func (h *Handle) ConntrackDeleteFilters(table netlink.ConntrackTableType, family
 		deleted, err = h.Handle.ConntrackDeleteFilters(table, family, filters...) //nolint:forbidigo
 		return err
 	})
-	return deleted, err
+	return deleted, discardErrDumpInterrupted(err)
 }
 
 // RdmaLinkByName calls netlink.RdmaLinkByName, retrying if necessary.
@@ -0,0 +1,90 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nlwrap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestRetryOnIntr(t *testing.T) {
+	otherErr := errors.New("other error")
+	tests := []struct {
+		name         string
+		interrupts   int
+		finalErr     error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "no interruption",
+			wantAttempts: 1,
+		},
+		{
+			name:         "interrupted once",
+			interrupts:   1,
+			wantAttempts: 2,
+		},
+		{
+			name:         "interrupted until the last attempt",
+			interrupts:   maxAttempts - 1,
+			wantAttempts: maxAttempts,
+		},
+		{
+			name:         "always interrupted",
+			interrupts:   maxAttempts + 1,
+			wantAttempts: maxAttempts,
+		},
+		{
+			name:         "other error is not retried",
+			finalErr:     otherErr,
+			wantAttempts: 1,
+			wantErr:      otherErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			var result []int
+			var err error
+			retryOnIntr(func() error {
+				attempts++
+				// the partial results are returned along with the error
+				result = []int{attempts}
+				err = tt.finalErr
+				if attempts <= tt.interrupts {
+					err = fmt.Errorf("dump: %w", netlink.ErrDumpInterrupted)
+				}
+				return err
+			})
+			err = discardErrDumpInterrupted(err)
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if len(result) != 1 || result[0] != tt.wantAttempts {
+				t.Errorf("result = %v, want the result of the last attempt", result)
+			}
+		})
+	}
+}
@@ -22,16 +22,24 @@ const (
 	// domain that is totally unrelated to this project and it can be a source
 	// of confusion and problems.
 	AttrPrefix = "dra.net"
+	// AttrCustomPrefix is the domain of the attributes configured by the
+	// operators, read from the sysfs directory of the interfaces.
+	AttrCustomPrefix = "custom." + AttrPrefix
 
 	// TODO: Document meaning of these attributes and re-evaluate if all are needed.
 	AttrInterfaceName   = AttrPrefix + "/" + "ifName"
 	AttrPCIAddress      = AttrPrefix + "/" + "pciAddress"
 	AttrMac             = AttrPrefix + "/" + "mac"
+	AttrOUI             = AttrPrefix + "/" + "oui"
 	AttrPCIVendor       = AttrPrefix + "/" + "pciVendor"
 	AttrPCIDevice       = AttrPrefix + "/" + "pciDevice"
 	AttrPCISubsystem    = AttrPrefix + "/" + "pciSubsystem"
+	AttrPCIDeviceShared = AttrPrefix + "/" + "pciDeviceShared"
+	AttrPort            = AttrPrefix + "/" + "port"
+	AttrBusType         = AttrPrefix + "/" + "busType"
 	AttrNUMANode        = AttrPrefix + "/" + "numaNode"
 	AttrMTU             = AttrPrefix + "/" + "mtu"
+	AttrMaxMTU          = AttrPrefix + "/" + "maxMtu"
 	AttrEncapsulation   = AttrPrefix + "/" + "encapsulation"
 	AttrAlias           = AttrPrefix + "/" + "alias"
 	AttrState           = AttrPrefix + "/" + "state"
@@ -42,10 +50,35 @@ const (
 	AttrTCXProgramNames = AttrPrefix + "/" + "tcxProgramNames"
 	AttrEBPF            = AttrPrefix + "/" + "ebpf"
 	// PFs supporting SR-IOV are labeled with the attribute "sriov: true".
-	AttrSRIOV           = AttrPrefix + "/" + "sriov"
-	AttrSRIOVVfs        = AttrPrefix + "/" + "sriovVfs"
-	AttrIsSriovVf       = AttrPrefix + "/" + "isSriovVf"
-	AttrVirtual         = AttrPrefix + "/" + "virtual"
-	AttrRDMA            = AttrPrefix + "/" + "rdma"
-	AttrRDMADevice      = AttrPrefix + "/" + "rdmaDevice"
+	AttrSRIOV          = AttrPrefix + "/" + "sriov"
+	AttrSRIOVVfs       = AttrPrefix + "/" + "sriovVfs"
+	AttrSRIOVFreeVfs   = AttrPrefix + "/" + "sriovFreeVfs"
+	AttrIsSriovVf      = AttrPrefix + "/" + "isSriovVf"
+	AttrVirtual        = AttrPrefix + "/" + "virtual"
+	AttrBondMaster     = AttrPrefix + "/" + "bondMaster"
+	AttrCarrierChanges = AttrPrefix + "/" + "carrierChanges"
+	AttrNumRxQueues    = AttrPrefix + "/" + "numRxQueues"
+	AttrNumTxQueues    = AttrPrefix + "/" + "numTxQueues"
+	// The form factor, e.g. SFP or QSFP28, and the vendor of the transceiver
+	// module plugged in the NIC, absent if there is none.
+	AttrModuleType   = AttrPrefix + "/" + "moduleType"
+	AttrModuleVendor = AttrPrefix + "/" + "moduleVendor"
+	// Interfaces configured by the network manager of the host, e.g.
+	// systemd-networkd or NetworkManager, which would reconfigure them.
+	AttrHostManaged   = AttrPrefix + "/" + "hostManaged"
+	AttrRDMA          = AttrPrefix + "/" + "rdma"
+	AttrRDMADevice    = AttrPrefix + "/" + "rdmaDevice"
+	AttrRDMALinkLayer = AttrPrefix + "/" + "rdmaLinkLayer"
+	// The IB-only devices are published with the name of the netdev of the
+	// same hardware, and the netdevs with the rdmaDevice of their RDMA device,
+	// so claims can request the pair.
+	AttrNetDevName = AttrPrefix + "/" + "netDevName"
+	// The PCI network devices bound to vfio-pci for userspace drivers, e.g.
+	// DPDK, have no netdev; they are published with the kind "pci" and the
+	// IOMMU group of their VFIO group device /dev/vfio/<group>.
+	AttrKind       = AttrPrefix + "/" + "kind"
+	AttrIOMMUGroup = AttrPrefix + "/" + "iommuGroup"
+	// The position of the NIC among the network interfaces of the cloud
+	// instance, published by the cloud providers.
+	AttrCloudNetworkIndex = AttrPrefix + "/" + "cloudNetworkIndex"
 )
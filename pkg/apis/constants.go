@@ -16,6 +16,8 @@ limitations under the License.
 
 package apis
 
+import "math"
+
 const (
 	// rdmaNetnsModeShared and rdmaNetnsModeExclusive define the RDMA subsystem
 	// network namespace mode. An RDMA device can only be assigned to a network
@@ -33,4 +35,44 @@ const (
 	// VRFTableOffset is the offset used for VRF routing tables to avoid ID collisions
 	// with reserved tables (0, 253, 254, 255) and to identify DRANET managed tables.
 	VRFTableOffset = 1000
+
+	// DHCPTableOffset is the offset of the routing tables of the interfaces
+	// configured with DHCP, after the VRF routing tables.
+	DHCPTableOffset = 2000
+
+	// Supported root qdisc types.
+	QdiscTypeFQ        = "fq"
+	QdiscTypeMQ        = "mq"
+	QdiscTypePfifoFast = "pfifo_fast"
+
+	// MaxRateLimitRX is the maximum rate in bits per second of the received
+	// traffic, policed by the kernel in bytes per second on 32 bits.
+	MaxRateLimitRX = math.MaxUint32 * 8
+
+	// Types of the eBPF programs that can be detached from the interface.
+	EBPFProgramTypeTC  = "tc"
+	EBPFProgramTypeTCX = "tcx"
+	EBPFProgramTypeXDP = "xdp"
+
+	// Ethtool settings that can be applied before the interface is moved to
+	// the Pod network namespace.
+	EthtoolSettingPrivateFlags = "privateFlags"
+	EthtoolSettingPause        = "pause"
+
+	// Forward error correction modes of the ethtool configuration.
+	EthtoolFECNone  = "none"
+	EthtoolFECBaseR = "baser"
+	EthtoolFECRS    = "rs"
+	EthtoolFECAuto  = "auto"
+
+	// MaxCoalesceQueues is the number of queues of the per queue coalescing
+	// of the kernel, MAX_NUM_QUEUE, the queue indexes are lower.
+	MaxCoalesceQueues = 4096
+
+	// Placeholders of the interface name templates, replaced by the fields of
+	// the PCI address (domain:bus:device.function) of the device.
+	IfNamePCIDomain   = "{pci_domain}"
+	IfNamePCIBus      = "{pci_bus}"
+	IfNamePCIDevice   = "{pci_device}"
+	IfNamePCIFunction = "{pci_function}"
 )
@@ -0,0 +1,87 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apis
+
+import "path"
+
+// off_flag_def
+// https://git.kernel.org/pub/scm/network/ethtool/ethtool.git/tree/common.c#n51
+// OffloadFlagDefinition is the Go equivalent of the C struct off_flag_def.
+// We keep this struct as the source of truth for building the map.
+type OffloadFlagDefinition struct {
+	ShortName     string
+	LongName      string
+	KernelPattern string
+}
+
+// offloadFlagDefs is the translated slice of legacy feature definitions.
+var offloadFlagDefs = []OffloadFlagDefinition{
+	{"rx", "rx-checksumming", "rx-checksum"},
+	{"tx", "tx-checksumming", "tx-checksum-*"},
+	{"sg", "scatter-gather", "tx-scatter-gather*"},
+	{"tso", "tcp-segmentation-offload", "tx-tcp*-segmentation"},
+	{"ufo", "udp-fragmentation-offload", "tx-udp-fragmentation"},
+	{"gso", "generic-segmentation-offload", "tx-generic-segmentation"},
+	{"gro", "generic-receive-offload", "rx-gro"},
+	{"lro", "large-receive-offload", "rx-lro"},
+	{"rxvlan", "rx-vlan-offload", "rx-vlan-hw-parse"},
+	{"txvlan", "tx-vlan-offload", "tx-vlan-hw-insert"},
+	{"ntuple", "ntuple-filters", "rx-ntuple-filter"},
+	{"rxhash", "receive-hashing", "rx-hashing"},
+}
+
+// It maps both short and long aliases to their corresponding match pattern.
+var legacyFeaturePatterns map[string]string
+
+// build the map
+func init() {
+	legacyFeaturePatterns = make(map[string]string)
+	for _, def := range offloadFlagDefs {
+		// Note: The pattern is a shell-style "glob", not a true regex.
+		legacyFeaturePatterns[def.ShortName] = def.KernelPattern
+		legacyFeaturePatterns[def.LongName] = def.KernelPattern
+	}
+}
+
+// EthtoolFeaturePattern returns the shell-style pattern of the kernel features
+// set by a legacy ethtool feature name, e.g. "tso" or
+// "tcp-segmentation-offload", and false if the name is not a legacy one.
+func EthtoolFeaturePattern(name string) (string, bool) {
+	pattern, ok := legacyFeaturePatterns[name]
+	return pattern, ok
+}
+
+// ethtoolFeaturesOverlap returns true if both feature names set the same
+// kernel features once the legacy names are resolved, e.g. "gro" and "rx-gro".
+func ethtoolFeaturesOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+	patternA, legacyA := legacyFeaturePatterns[a]
+	patternB, legacyB := legacyFeaturePatterns[b]
+	switch {
+	case legacyA && legacyB:
+		return patternA == patternB
+	case legacyA:
+		matched, _ := path.Match(patternA, b)
+		return matched
+	case legacyB:
+		matched, _ := path.Match(patternB, a)
+		return matched
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// pciAddressRegex matches a PCI address with an optional domain,
+// e.g. "0000:8e:02.1" or "8e:02.1".
+var pciAddressRegex = regexp.MustCompile(`^(?:([0-9a-fA-F]{4}):)?([0-9a-fA-F]{2}):([0-9a-fA-F]{2})\.([0-9a-fA-F])$`)
+
+// reservedInterfaceNames can not be given to an interface in the Pod: the
+// loopback interface always exists and the kernel rejects "all" and "default",
+// the names of the sysctl directories shared by all the interfaces.
+var reservedInterfaceNames = []string{"lo", "all", "default"}
+
+// commonPodInterfaceNames are the names the CNI plugins usually give to the Pod
+// interfaces, a device renamed to one of them is likely to collide.
+var commonPodInterfaceNames = []string{"eth0"}
+
+// IsCommonPodInterfaceName returns true if the name is commonly used by the
+// interfaces the CNI plugins create in the Pod, so the interface can not be
+// moved to the Pod network namespace with that name.
+func IsCommonPodInterfaceName(name string) bool {
+	return slices.Contains(commonPodInterfaceNames, name)
+}
+
+// IsInterfaceNameTemplate returns true if the interface name contains
+// placeholders to be replaced when the device is prepared.
+func IsInterfaceNameTemplate(name string) bool {
+	return strings.ContainsAny(name, "{}")
+}
+
+// ExpandInterfaceNameTemplate replaces the placeholders of the interface name
+// template with the fields of the PCI address of the device, e.g. the template
+// "net-{pci_bus}{pci_device}" is "net-8e02" for the device 0000:8e:02.1. The
+// resulting name must be a valid Linux interface name.
+func ExpandInterfaceNameTemplate(template string, pciAddress string) (string, error) {
+	matches := pciAddressRegex.FindStringSubmatch(pciAddress)
+	if matches == nil {
+		return "", fmt.Errorf("invalid PCI address %q", pciAddress)
+	}
+	domain := matches[1]
+	if domain == "" {
+		domain = "0000"
+	}
+	name := strings.NewReplacer(
+		IfNamePCIDomain, strings.ToLower(domain),
+		IfNamePCIBus, strings.ToLower(matches[2]),
+		IfNamePCIDevice, strings.ToLower(matches[3]),
+		IfNamePCIFunction, strings.ToLower(matches[4]),
+	).Replace(template)
+	if strings.ContainsAny(name, "{}") {
+		return "", fmt.Errorf("unknown placeholder in %q, supported placeholders are %s, %s, %s and %s",
+			template, IfNamePCIDomain, IfNamePCIBus, IfNamePCIDevice, IfNamePCIFunction)
+	}
+	if errs := isValidLinuxInterfaceName(name, "name"); len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return name, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apis
+
+import "testing"
+
+func TestExpandInterfaceNameTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		pciAddress string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "bus and device",
+			template:   "net-{pci_bus}{pci_device}",
+			pciAddress: "0000:8e:02.1",
+			want:       "net-8e02",
+		},
+		{
+			name:       "all the fields",
+			template:   "p{pci_domain}{pci_bus}{pci_device}{pci_function}",
+			pciAddress: "0001:8E:1F.7",
+			want:       "p00018e1f7",
+		},
+		{
+			name:       "address without domain",
+			template:   "n{pci_domain}-{pci_function}",
+			pciAddress: "8e:02.3",
+			want:       "n0000-3",
+		},
+		{
+			name:       "no placeholders",
+			template:   "eth1",
+			pciAddress: "0000:8e:02.1",
+			want:       "eth1",
+		},
+		{
+			name:       "unknown placeholder",
+			template:   "net-{pci_slot}",
+			pciAddress: "0000:8e:02.1",
+			wantErr:    true,
+		},
+		{
+			name:       "unbalanced brace",
+			template:   "net-{pci_bus",
+			pciAddress: "0000:8e:02.1",
+			wantErr:    true,
+		},
+		{
+			name:       "expanded name too long",
+			template:   "network-{pci_domain}{pci_bus}{pci_device}",
+			pciAddress: "0000:8e:02.1",
+			wantErr:    true,
+		},
+		{
+			name:       "invalid PCI address",
+			template:   "net-{pci_bus}",
+			pciAddress: "eth0",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandInterfaceNameTemplate(tt.template, tt.pciAddress)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandInterfaceNameTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandInterfaceNameTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCommonPodInterfaceName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"eth0":    true,
+		"eth1":    false,
+		"dranet0": false,
+		"":        false,
+	} {
+		if got := IsCommonPodInterfaceName(name); got != want {
+			t.Errorf("IsCommonPodInterfaceName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
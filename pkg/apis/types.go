@@ -39,6 +39,23 @@ type NetworkConfig struct {
 
 	// Ethtool defines hardware offload features and other settings managed by `ethtool`.
 	Ethtool *EthtoolConfig `json:"ethtool,omitempty"`
+
+	// Qdisc defines the root queueing discipline of the interface.
+	Qdisc *QdiscConfig `json:"qdisc,omitempty"`
+
+	// RateLimit limits the bandwidth of the interface in the Pod.
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+
+	// RDMAExtraDevices is a list of additional RDMA character devices
+	// (e.g., "/dev/infiniband/umad0", "/dev/infiniband/issm0") to be made
+	// available to the Pod, on top of the ones discovered for the RDMA device.
+	// The paths must be under /dev/infiniband.
+	RDMAExtraDevices []string `json:"rdmaExtraDevices,omitempty"`
+
+	// RDMADeviceMode overrides the file mode of the RDMA character devices in
+	// the containers, as an octal string (e.g., "0666"). By default the mode
+	// of the devices in the host is used.
+	RDMADeviceMode *string `json:"rdmaDeviceMode,omitempty"`
 }
 
 // InterfaceConfig represents the configuration for a single network interface.
@@ -46,22 +63,89 @@ type NetworkConfig struct {
 type InterfaceConfig struct {
 	// Name is the desired logical name of the interface inside the Pod (e.g., "net0", "eth_app").
 	// If not specified, DraNet may use or derive a name from the original interface.
+	// It can be a template with the placeholders {pci_domain}, {pci_bus}, {pci_device}
+	// and {pci_function}, replaced by the PCI address of the device (e.g., "net-{pci_bus}{pci_device}").
 	Name string `json:"name,omitempty"`
 
 	// Addresses is a list of IP addresses in CIDR format (e.g., "192.168.1.10/24")
 	// to be assigned to the interface.
 	Addresses []string `json:"addresses,omitempty"`
 
+	// Broadcasts maps IPv4 addresses of the 'addresses' field to the broadcast
+	// address set on them (e.g., "192.168.1.10/24": "192.168.1.127"), for the
+	// applications requiring an explicit one. It must be within the subnet of
+	// the address. The addresses not listed get the broadcast address of their
+	// subnet, as set by `ip addr add <addr> brd +`.
+	Broadcasts map[string]string `json:"broadcasts,omitempty"`
+
 	// DHCP, if true, indicates that the interface should be configured via DHCP.
-	// This is mutually exclusive with the 'addresses' field.
+	// This is mutually exclusive with the 'addresses' field. The lease is
+	// renewed while the Pod runs, the address is updated if the server grants
+	// another one.
 	DHCP *bool `json:"dhcp,omitempty"`
 
+	// DHCPHostname is the hostname advertised to the DHCP server so it can
+	// register the Pod in DNS (Dynamic DNS). It is sent as option 12 and, if
+	// the name is fully qualified (e.g., "pod1.example.com"), also as the
+	// client FQDN option 81 asking the server to perform the DNS updates.
+	// Only valid when DHCP is enabled.
+	DHCPHostname *string `json:"dhcpHostname,omitempty"`
+
+	// DHCPBroadcast sets the broadcast flag of the DHCPDISCOVER and
+	// DHCPREQUEST packets asking the server or relay to broadcast its replies.
+	// Set it to false for the relays that misbehave with broadcast and expect
+	// to send unicast replies to the offered address. Only valid when DHCP is
+	// enabled. Defaults to true.
+	DHCPBroadcast *bool `json:"dhcpBroadcast,omitempty"`
+
+	// DHCPRequestOptions are option codes added to the parameter request list
+	// (option 55) of the DHCPDISCOVER and DHCPREQUEST packets, in addition to
+	// the subnet mask, router, domain name and DNS servers requested by
+	// default, e.g. 42 (NTP servers) or 121 (classless static routes).
+	// Only valid when DHCP is enabled.
+	DHCPRequestOptions []int `json:"dhcpRequestOptions,omitempty"`
+
+	// DHCPRequestedIP is an IPv4 address reserved for the interface that the
+	// DHCP server is asked to confirm. The client starts in the INIT-REBOOT
+	// state, sending a DHCPREQUEST with the address (option 50) without a
+	// DHCPDISCOVER, and falls back to the full exchange if the server does
+	// not acknowledge it. Only valid when DHCP is enabled.
+	DHCPRequestedIP *string `json:"dhcpRequestedIP,omitempty"`
+
+	// DHCPRouteTable is the routing table of the default route learned from
+	// DHCP. By default it is a table of the interface, derived from its name
+	// in the Pod, with a rule looking it up for the packets sent from the
+	// leased address, so a secondary interface does not replace the default
+	// route of the Pod. Set it to 254 to install the default route in the
+	// main table. Only valid when DHCP is enabled and without VRF.
+	DHCPRouteTable *int `json:"dhcpRouteTable,omitempty"`
+
+	// IPAMPool is the name of an address pool configured on the node (see the
+	// --ipam-pools flag) to allocate the interface address from. The address is
+	// released when the claim is unprepared.
+	// This is mutually exclusive with the 'addresses' and 'dhcp' fields.
+	IPAMPool *string `json:"ipamPool,omitempty"`
+
+	// PreserveAllAddresses, if true, moves all the non-loopback addresses of
+	// the interface, including link-local and secondary addresses, to the Pod
+	// keeping their scope and flags. By default only the global scope
+	// addresses are moved.
+	// This is mutually exclusive with the 'addresses', 'dhcp' and 'ipamPool' fields.
+	PreserveAllAddresses *bool `json:"preserveAllAddresses,omitempty"`
+
 	// MTU is the Maximum Transmission Unit for the interface.
 	MTU *int32 `json:"mtu,omitempty"`
 
 	// HardwareAddr is the MAC address of the interface.
 	HardwareAddr *string `json:"hardwareAddr,omitempty"`
 
+	// GenerateHardwareAddr, if true, sets the MAC address of the interface to
+	// a locally administered unicast address derived from the Pod UID and the
+	// device name, so it is stable for the Pod and does not conflict with the
+	// addresses of the host NICs.
+	// This is mutually exclusive with the 'hardwareAddr' field.
+	GenerateHardwareAddr *bool `json:"generateHardwareAddr,omitempty"`
+
 	// GSOMaxSize sets the maximum Generic Segmentation Offload size for IPv6.
 	// Managed by `ip link set <dev> gso_max_size <val>`. For enabling Big TCP.
 	GSOMaxSize *int32 `json:"gsoMaxSize,omitempty"`
@@ -78,10 +162,27 @@ type InterfaceConfig struct {
 	// Managed by `ip link set <dev> gro_ipv4_max_size <val>`. For enabling Big TCP.
 	GROIPv4MaxSize *int32 `json:"groIPv4MaxSize,omitempty"`
 
+	// GSOMaxSegments sets the maximum number of segments of a Generic
+	// Segmentation Offload packet.
+	// Managed by `ip link set <dev> gso_max_segs <val>`. For enabling Big TCP.
+	GSOMaxSegments *int32 `json:"gsoMaxSegments,omitempty"`
+
 	// DisableEBPFPrograms, if true, attempts to detach all eBPF programs
 	// (both TC and TCX) from the network interface assigned to the Pod.
 	DisableEBPFPrograms *bool `json:"disableEbpfPrograms,omitempty"`
 
+	// DisableEBPF lists the types of eBPF programs to detach from the network
+	// interface assigned to the Pod, any of "tc" (classic TC filters), "tcx"
+	// (TCX and netkit programs) or "xdp", keeping the programs of the other
+	// types. DisableEBPFPrograms set to true detaches all the types.
+	DisableEBPF []string `json:"disableEbpf,omitempty"`
+
+	// NUMAIRQAffinity, if true, pins the IRQs of the MSI/MSI-X vectors of the
+	// device to the CPUs of its NUMA node. The IRQ affinity is global to the
+	// host and it is kept when the device is released. Only valid for PCI
+	// devices attached to a NUMA node.
+	NUMAIRQAffinity *bool `json:"numaIRQAffinity,omitempty"`
+
 	// Forwarding, if true, enables IP forwarding on this specific interface.
 	// This sets /proc/sys/net/ipv4/conf/<iface>/forwarding and the ipv6 counterpart.
 	Forwarding *bool `json:"forwarding,omitempty"`
@@ -110,7 +211,8 @@ type RouteConfig struct {
 	Destination string `json:"destination,omitempty"`
 	// Gateway is the IP address of the gateway for this route.
 	Gateway string `json:"gateway,omitempty"`
-	// Source is an optional source IP address for policy routing.
+	// Source is the preferred source IP address of the packets sent through
+	// the route. It must be assigned to the interface.
 	Source string `json:"source,omitempty"`
 	// Scope is the scope of the route (e.g., link, host, global).
 	// Refers to Linux route scopes (e.g., 0 for RT_SCOPE_UNIVERSE, 253 for RT_SCOPE_LINK).
@@ -128,6 +230,24 @@ type RouteConfig struct {
 	// - 253: default
 	// - 0: unspec
 	Table int `json:"table,omitempty"`
+	// AdvMSS is the maximum segment size advertised to the TCP peers of the
+	// route, the equivalent of `ip route ... advmss N`.
+	AdvMSS *int `json:"advMSS,omitempty"`
+	// InitCwnd is the initial TCP congestion window, in segments, of the
+	// connections using the route, the equivalent of `ip route ... initcwnd N`.
+	InitCwnd *int `json:"initCwnd,omitempty"`
+	// InitRwnd is the initial TCP receive window, in segments, advertised by the
+	// connections using the route, the equivalent of `ip route ... initrwnd N`.
+	InitRwnd *int `json:"initRwnd,omitempty"`
+	// Metric is the priority of the route, the equivalent of
+	// `ip route ... metric N`. A default route without a metric is only added
+	// if the table has no default route yet, setting it allows several
+	// interfaces to install their default route.
+	Metric *int `json:"metric,omitempty"`
+	// Protocol is the routing protocol identifier of the route, the equivalent
+	// of `ip route ... proto N`. Defaults to the dranet protocol (200) so the
+	// routes installed by dranet can be told apart from the other routes.
+	Protocol *int `json:"protocol,omitempty"`
 }
 
 // RuleConfig represents a network rule configuration.
@@ -140,6 +260,12 @@ type RuleConfig struct {
 	Destination string `json:"destination,omitempty"`
 	// Table is the routing table ID to look up if the rule matches.
 	Table int `json:"table,omitempty"`
+	// FWMark is the firewall mark of the packets matched by the rule, e.g.
+	// set by the application with the SO_MARK socket option.
+	FWMark *uint32 `json:"fwMark,omitempty"`
+	// FWMask is the mask applied to the firewall mark of the packets before
+	// comparing it with FWMark. Defaults to 0xffffffff.
+	FWMask *uint32 `json:"fwMask,omitempty"`
 }
 
 // NeighborConfig represents a neighbor (ARP/NDP) entry.
@@ -157,7 +283,118 @@ type EthtoolConfig struct {
 	// Example: {"tcp-segmentation-offload": true, "rx-checksum": true}
 	Features map[string]bool `json:"features,omitempty"`
 
+	// OrderedFeatures is a list of ethtool features applied one at a time, in the given
+	// order, after Features. Use it when a feature can only be changed once another one
+	// has been set, e.g. disabling "large-receive-offload" before toggling
+	// "generic-receive-offload". A feature can not be present in both Features and OrderedFeatures.
+	// Example: [{"name": "large-receive-offload", "enabled": false}, {"name": "generic-receive-offload", "enabled": true}]
+	OrderedFeatures []EthtoolFeature `json:"orderedFeatures,omitempty"`
+
 	// PrivateFlags is a map of device-specific private flag names to their desired state.
 	// Example: {"my-custom-flag": true}
 	PrivateFlags map[string]bool `json:"privateFlags,omitempty"`
+
+	// Pause configures the link flow control (pause frames), the equivalent
+	// of `ethtool -A <dev> autoneg|rx|tx on|off`. Often required by RoCE.
+	Pause *PauseConfig `json:"pause,omitempty"`
+
+	// FEC sets the forward error correction mode of the link, the equivalent
+	// of `ethtool --set-fec <dev> encoding none|baser|rs|auto`. High speed
+	// links may need it to match the mode of the link partner.
+	FEC *string `json:"fec,omitempty"`
+
+	// Coalesce configures the interrupt coalescing of the interface, the
+	// equivalent of `ethtool -C <dev>`, and of its queues with PerQueue, the
+	// equivalent of `ethtool --per-queue <dev> queue_mask <mask> --coalesce`.
+	// Interfaces whose driver does not support it are left unchanged.
+	Coalesce *CoalesceConfig `json:"coalesce,omitempty"`
+
+	// ApplyBeforeMove lists the settings applied while the interface is still
+	// in the host namespace, when the claim is prepared, instead of after it is
+	// moved to the Pod. Only the device level settings "privateFlags" and
+	// "pause" can be applied before the move.
+	// Example: ["privateFlags"]
+	ApplyBeforeMove []string `json:"applyBeforeMove,omitempty"`
+
+	// AllowLinkDown, if true, applies the features the kernel refused while the
+	// link is up again with the interface down, then brings it back up. Some
+	// drivers can only change certain features while the link is down. This
+	// causes a brief link flap.
+	AllowLinkDown *bool `json:"allowLinkDown,omitempty"`
+}
+
+// PauseConfig defines the flow control parameters of an interface. Unset
+// fields keep their current value.
+type PauseConfig struct {
+	// Autoneg enables the autonegotiation of the pause frames with the link partner.
+	Autoneg *bool `json:"autoneg,omitempty"`
+	// RxPause enables the reception of pause frames.
+	RxPause *bool `json:"rxPause,omitempty"`
+	// TxPause enables the transmission of pause frames.
+	TxPause *bool `json:"txPause,omitempty"`
+}
+
+// CoalesceParams defines the interrupt coalescing parameters of an interface
+// or a queue. Unset fields keep their current value.
+type CoalesceParams struct {
+	// RxUsecs is the delay in microseconds of the receive interrupt after a packet arrives.
+	RxUsecs *uint32 `json:"rxUsecs,omitempty"`
+	// RxMaxFrames is the number of received packets that raise the interrupt before the delay.
+	RxMaxFrames *uint32 `json:"rxMaxFrames,omitempty"`
+	// TxUsecs is the delay in microseconds of the transmit completion interrupt.
+	TxUsecs *uint32 `json:"txUsecs,omitempty"`
+	// TxMaxFrames is the number of sent packets that raise the interrupt before the delay.
+	TxMaxFrames *uint32 `json:"txMaxFrames,omitempty"`
+	// AdaptiveRx lets the driver adapt the receive coalescing to the traffic.
+	AdaptiveRx *bool `json:"adaptiveRx,omitempty"`
+	// AdaptiveTx lets the driver adapt the transmit coalescing to the traffic.
+	AdaptiveTx *bool `json:"adaptiveTx,omitempty"`
+}
+
+// CoalesceConfig defines the interrupt coalescing of the interface, the
+// parameters of the interface are applied before the ones of its queues.
+type CoalesceConfig struct {
+	CoalesceParams `json:",inline"`
+
+	// PerQueue sets the parameters of individual queues, e.g. a lower latency
+	// on the queues of a latency sensitive application. The queues must exist,
+	// their index is lower than the channel count of the interface.
+	// Example: [{"queue": 0, "rxUsecs": 0}, {"queue": 1, "rxUsecs": 50}]
+	PerQueue []QueueCoalesce `json:"perQueue,omitempty"`
+}
+
+// QueueCoalesce defines the interrupt coalescing parameters of a queue.
+type QueueCoalesce struct {
+	// Queue is the index of the queue.
+	Queue uint32 `json:"queue"`
+
+	CoalesceParams `json:",inline"`
+}
+
+// EthtoolFeature is the desired state of a single ethtool feature.
+type EthtoolFeature struct {
+	// Name is the ethtool feature name (e.g., "generic-receive-offload").
+	Name string `json:"name"`
+	// Enabled is the desired state of the feature.
+	Enabled bool `json:"enabled"`
+}
+
+// QdiscConfig defines the root queueing discipline (qdisc) of a network interface.
+// These settings correspond to `tc qdisc replace dev <dev> root <type>`.
+type QdiscConfig struct {
+	// Type is the name of the qdisc, one of "fq", "mq" or "pfifo_fast".
+	// "fq" provides per flow pacing, "mq" requires a multiqueue device.
+	Type string `json:"type"`
+}
+
+// RateLimitConfig limits the bandwidth of a network interface. The transmitted
+// traffic is shaped by a token bucket filter root qdisc, the equivalent of
+// `tc qdisc replace dev <dev> root tbf rate <tx>`, and the received traffic
+// above the rate is dropped by a police action on the ingress of the
+// interface.
+type RateLimitConfig struct {
+	// RX is the maximum rate of the received traffic in bits per second.
+	RX *uint64 `json:"rx,omitempty"`
+	// TX is the maximum rate of the transmitted traffic in bits per second.
+	TX *uint64 `json:"tx,omitempty"`
 }
@@ -18,8 +18,14 @@ package apis
 
 import (
 	"fmt"
+	"maps"
 	"net"
 	"net/netip"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -31,10 +37,20 @@ import (
 const (
 	// MinMTU is the minimum practical MTU (e.g., for IPv4).
 	MinMTU = 68
+	// MaxMTU is the largest MTU supported by Linux network devices (IP_MAX_MTU
+	// is 65535 but the loopback device uses 65536).
+	MaxMTU = 65536
 	// MaxInterfaceNameLen is typically IFNAMSIZ-1 (usually 15 on Linux).
 	MaxInterfaceNameLen = 15
+	// MaxHostnameLen is the maximum length of a DNS name in text form.
+	MaxHostnameLen = 253
+	// RDMADevicesDir is the directory of the RDMA character devices.
+	RDMADevicesDir = "/dev/infiniband"
 )
 
+// dnsLabelRegex matches a single RFC 1123 DNS label.
+var dnsLabelRegex = regexp.MustCompile(`^[a-zA-Z0-9]([-a-zA-Z0-9]{0,61}[a-zA-Z0-9])?$`)
+
 // ValidateConfig unmarshals and validates the NetworkConfig from a runtime.RawExtension.
 // It performs strict unmarshalling and then calls specific validation functions for each part of the config.
 // Returns the parsed NetworkConfig and a slice of errors if any validation fails.
@@ -89,6 +105,29 @@ func ValidateConfig(raw *runtime.RawExtension) (*NetworkConfig, []error) {
 		allErrors = append(allErrors, validateNeighborConfig(config.Neighbors, "neighbors")...)
 	}
 
+	// Validate QdiscConfig if present
+	if config.Qdisc != nil {
+		allErrors = append(allErrors, validateQdiscConfig(config.Qdisc, "qdisc")...)
+	}
+
+	// Validate RateLimitConfig if present
+	if config.RateLimit != nil {
+		allErrors = append(allErrors, validateRateLimitConfig(config.RateLimit, "rateLimit")...)
+		if config.RateLimit.TX != nil && config.Qdisc != nil {
+			allErrors = append(allErrors, fmt.Errorf("rateLimit.tx: can not be used with qdisc, both replace the root qdisc of the interface"))
+		}
+	}
+
+	// Validate RDMAExtraDevices
+	if len(config.RDMAExtraDevices) > 0 {
+		allErrors = append(allErrors, validateRDMAExtraDevices(config.RDMAExtraDevices, "rdmaExtraDevices")...)
+	}
+	if config.RDMADeviceMode != nil {
+		if _, err := ParseRDMADeviceMode(*config.RDMADeviceMode); err != nil {
+			allErrors = append(allErrors, fmt.Errorf("rdmaDeviceMode: %w", err))
+		}
+	}
+
 	if len(allErrors) > 0 {
 		return &config, allErrors // Return partially parsed config with errors
 	}
@@ -115,6 +154,9 @@ func isValidLinuxInterfaceName(name string, fieldPath string) (allErrors []error
 	if name == "." || name == ".." {
 		allErrors = append(allErrors, fmt.Errorf("%s: name '%s' cannot be '.' or '..'", fieldPath, name))
 	}
+	if slices.Contains(reservedInterfaceNames, name) {
+		allErrors = append(allErrors, fmt.Errorf("%s: name '%s' is reserved, reserved names are %s", fieldPath, name, strings.Join(reservedInterfaceNames, ", ")))
+	}
 	for _, r := range name {
 		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
 			// If '/' or whitespace, it's already covered by more specific checks above.
@@ -131,13 +173,64 @@ func isValidLinuxInterfaceName(name string, fieldPath string) (allErrors []error
 	return allErrors
 }
 
+// validateBroadcast checks that the broadcast address is set for an IPv4
+// address of addresses and is within its subnet.
+func validateBroadcast(address string, broadcast string, addresses []string) error {
+	if !slices.Contains(addresses, address) {
+		return fmt.Errorf("address is not in addresses")
+	}
+	prefix, err := netip.ParsePrefix(address)
+	if err != nil {
+		return fmt.Errorf("invalid IP CIDR format '%s': %w", address, err)
+	}
+	if !prefix.Addr().Is4() {
+		return fmt.Errorf("broadcast addresses are only supported for IPv4 addresses")
+	}
+	brd, err := netip.ParseAddr(broadcast)
+	if err != nil {
+		return fmt.Errorf("invalid broadcast address '%s': %w", broadcast, err)
+	}
+	if !brd.Is4() || !prefix.Masked().Contains(brd) {
+		return fmt.Errorf("broadcast address %s is not within the subnet %s", broadcast, prefix.Masked())
+	}
+	return nil
+}
+
+// validateHostname checks that name is a valid DNS hostname: one or more
+// dot-separated labels of letters, digits and '-' (RFC 1123), each at most
+// 63 characters long and not starting or ending with '-'. A single trailing
+// dot (absolute name) is accepted.
+func validateHostname(name string, fieldPath string) (allErrors []error) {
+	trimmed := strings.TrimSuffix(name, ".")
+	if trimmed == "" {
+		return []error{fmt.Errorf("%s: cannot be empty", fieldPath)}
+	}
+	if len(trimmed) > MaxHostnameLen {
+		allErrors = append(allErrors, fmt.Errorf("%s: hostname '%s' exceeds maximum length of %d characters", fieldPath, name, MaxHostnameLen))
+	}
+	for _, label := range strings.Split(trimmed, ".") {
+		if !dnsLabelRegex.MatchString(label) {
+			allErrors = append(allErrors, fmt.Errorf("%s: hostname '%s' contains invalid DNS label '%s'", fieldPath, name, label))
+		}
+	}
+	return allErrors
+}
+
 // validateInterfaceConfig validates the InterfaceConfig part of the NetworkConfig.
 func validateInterfaceConfig(cfg *InterfaceConfig, fieldPath string) (allErrors []error) {
 	if cfg == nil {
 		return
 	}
 
-	allErrors = append(allErrors, isValidLinuxInterfaceName(cfg.Name, fieldPath+".name")...)
+	if IsInterfaceNameTemplate(cfg.Name) {
+		// All the PCI address fields have a fixed length, validate the
+		// name a device would get.
+		if _, err := ExpandInterfaceNameTemplate(cfg.Name, "0000:00:00.0"); err != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s.name: invalid template: %w", fieldPath, err))
+		}
+	} else {
+		allErrors = append(allErrors, isValidLinuxInterfaceName(cfg.Name, fieldPath+".name")...)
+	}
 
 	for i, addr := range cfg.Addresses {
 		if _, err := netip.ParsePrefix(addr); err != nil {
@@ -145,20 +238,104 @@ func validateInterfaceConfig(cfg *InterfaceConfig, fieldPath string) (allErrors
 		}
 	}
 
+	for _, addr := range slices.Sorted(maps.Keys(cfg.Broadcasts)) {
+		if err := validateBroadcast(addr, cfg.Broadcasts[addr], cfg.Addresses); err != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s.broadcasts[%s]: %w", fieldPath, addr, err))
+		}
+	}
+
 	if cfg.DHCP != nil && *cfg.DHCP && len(cfg.Addresses) > 0 {
 		allErrors = append(allErrors, fmt.Errorf("%s: dhcp and addresses are mutually exclusive", fieldPath))
 	}
 
+	if cfg.IPAMPool != nil {
+		if *cfg.IPAMPool == "" {
+			allErrors = append(allErrors, fmt.Errorf("%s.ipamPool: must not be empty", fieldPath))
+		}
+		if len(cfg.Addresses) > 0 {
+			allErrors = append(allErrors, fmt.Errorf("%s: ipamPool and addresses are mutually exclusive", fieldPath))
+		}
+		if cfg.DHCP != nil && *cfg.DHCP {
+			allErrors = append(allErrors, fmt.Errorf("%s: ipamPool and dhcp are mutually exclusive", fieldPath))
+		}
+	}
+
+	if cfg.DHCPHostname != nil {
+		if cfg.DHCP == nil || !*cfg.DHCP {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpHostname: requires dhcp to be enabled", fieldPath))
+		}
+		allErrors = append(allErrors, validateHostname(*cfg.DHCPHostname, fieldPath+".dhcpHostname")...)
+	}
+
+	if cfg.PreserveAllAddresses != nil && *cfg.PreserveAllAddresses {
+		if len(cfg.Addresses) > 0 {
+			allErrors = append(allErrors, fmt.Errorf("%s: preserveAllAddresses and addresses are mutually exclusive", fieldPath))
+		}
+		if cfg.DHCP != nil && *cfg.DHCP {
+			allErrors = append(allErrors, fmt.Errorf("%s: preserveAllAddresses and dhcp are mutually exclusive", fieldPath))
+		}
+		if cfg.IPAMPool != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s: preserveAllAddresses and ipamPool are mutually exclusive", fieldPath))
+		}
+	}
+
+	if cfg.DHCPBroadcast != nil && (cfg.DHCP == nil || !*cfg.DHCP) {
+		allErrors = append(allErrors, fmt.Errorf("%s.dhcpBroadcast: requires dhcp to be enabled", fieldPath))
+	}
+
+	if len(cfg.DHCPRequestOptions) > 0 {
+		if cfg.DHCP == nil || !*cfg.DHCP {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpRequestOptions: requires dhcp to be enabled", fieldPath))
+		}
+		seen := map[int]bool{}
+		for i, code := range cfg.DHCPRequestOptions {
+			// 0 (pad) and 255 (end) are not options.
+			if code < 1 || code > 254 {
+				allErrors = append(allErrors, fmt.Errorf("%s.dhcpRequestOptions[%d]: option code %d must be between 1 and 254", fieldPath, i, code))
+			} else if seen[code] {
+				allErrors = append(allErrors, fmt.Errorf("%s.dhcpRequestOptions[%d]: duplicate option code %d", fieldPath, i, code))
+			}
+			seen[code] = true
+		}
+	}
+
+	if cfg.DHCPRequestedIP != nil {
+		if cfg.DHCP == nil || !*cfg.DHCP {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpRequestedIP: requires dhcp to be enabled", fieldPath))
+		}
+		if ip, err := netip.ParseAddr(*cfg.DHCPRequestedIP); err != nil || !ip.Is4() || ip.IsUnspecified() {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpRequestedIP: invalid IPv4 address '%s'", fieldPath, *cfg.DHCPRequestedIP))
+		}
+	}
+
+	if cfg.DHCPRouteTable != nil {
+		if cfg.DHCP == nil || !*cfg.DHCP {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpRouteTable: requires dhcp to be enabled", fieldPath))
+		}
+		if cfg.VRF != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpRouteTable: can not be used with vrf, the routes are installed in the VRF table", fieldPath))
+		}
+		if *cfg.DHCPRouteTable <= 0 || *cfg.DHCPRouteTable == unix.RT_TABLE_LOCAL {
+			allErrors = append(allErrors, fmt.Errorf("%s.dhcpRouteTable: invalid table %d, must be positive and not the local table %d", fieldPath, *cfg.DHCPRouteTable, unix.RT_TABLE_LOCAL))
+		}
+	}
+
 	if cfg.MTU != nil {
 		if *cfg.MTU < MinMTU {
 			allErrors = append(allErrors, fmt.Errorf("%s.mtu: must be at least %d, got %d", fieldPath, MinMTU, *cfg.MTU))
 		}
+		if *cfg.MTU > MaxMTU {
+			allErrors = append(allErrors, fmt.Errorf("%s.mtu: must be at most %d, got %d", fieldPath, MaxMTU, *cfg.MTU))
+		}
 	}
 
 	if cfg.HardwareAddr != nil {
 		if _, err := net.ParseMAC(*cfg.HardwareAddr); err != nil {
 			allErrors = append(allErrors, fmt.Errorf("%s.hardwareAddress: invalid Hardware Address format '%s': %w", fieldPath, *cfg.HardwareAddr, err))
 		}
+		if cfg.GenerateHardwareAddr != nil && *cfg.GenerateHardwareAddr {
+			allErrors = append(allErrors, fmt.Errorf("%s.generateHardwareAddr: cannot be used with hardwareAddr", fieldPath))
+		}
 	}
 
 	if cfg.GSOMaxSize != nil && *cfg.GSOMaxSize <= 0 {
@@ -177,6 +354,24 @@ func validateInterfaceConfig(cfg *InterfaceConfig, fieldPath string) (allErrors
 		allErrors = append(allErrors, fmt.Errorf("%s.grov4MaxSize: must be positive, got %d", fieldPath, *cfg.GROIPv4MaxSize))
 	}
 
+	if cfg.GSOMaxSegments != nil && *cfg.GSOMaxSegments <= 0 {
+		allErrors = append(allErrors, fmt.Errorf("%s.gsoMaxSegments: must be positive, got %d", fieldPath, *cfg.GSOMaxSegments))
+	}
+
+	seenEBPFTypes := map[string]bool{}
+	for i, programType := range cfg.DisableEBPF {
+		switch programType {
+		case EBPFProgramTypeTC, EBPFProgramTypeTCX, EBPFProgramTypeXDP:
+		default:
+			allErrors = append(allErrors, fmt.Errorf("%s.disableEbpf[%d]: unsupported eBPF program type %q, must be one of %q, %q or %q", fieldPath, i, programType, EBPFProgramTypeTC, EBPFProgramTypeTCX, EBPFProgramTypeXDP))
+			continue
+		}
+		if seenEBPFTypes[programType] {
+			allErrors = append(allErrors, fmt.Errorf("%s.disableEbpf[%d]: duplicate eBPF program type %q", fieldPath, i, programType))
+		}
+		seenEBPFTypes[programType] = true
+	}
+
 	if cfg.VRF != nil {
 		allErrors = append(allErrors, validateVRFConfig(cfg.VRF, fieldPath+".vrf")...)
 	}
@@ -226,26 +421,60 @@ func validateRoutes(routes []RouteConfig, fieldPath string) (allErrors []error)
 		}
 
 		if route.Gateway != "" {
-			if net.ParseIP(route.Gateway) == nil {
+			if gw := net.ParseIP(route.Gateway); gw == nil {
 				allErrors = append(allErrors, fmt.Errorf("%s.gateway: invalid IP address format '%s'", currentFieldPath, route.Gateway))
+			} else if dst := routeDestinationIP(route.Destination); dst != nil && (gw.To4() == nil) != (dst.To4() == nil) {
+				allErrors = append(allErrors, fmt.Errorf("%s.gateway: IP family of '%s' does not match the destination '%s'", currentFieldPath, route.Gateway, route.Destination))
 			}
 		} else if !scopeIsLink { // Gateway is required if scope is Universe
 			allErrors = append(allErrors, fmt.Errorf("%s.gateway: must be specified for Universe scope routes", currentFieldPath))
 		}
 
 		if route.Source != "" {
-			if net.ParseIP(route.Source) == nil {
+			if src := net.ParseIP(route.Source); src == nil {
 				allErrors = append(allErrors, fmt.Errorf("%s.source: invalid IP address format '%s'", currentFieldPath, route.Source))
+			} else if dst := routeDestinationIP(route.Destination); dst != nil && (src.To4() == nil) != (dst.To4() == nil) {
+				allErrors = append(allErrors, fmt.Errorf("%s.source: IP family of '%s' does not match the destination '%s'", currentFieldPath, route.Source, route.Destination))
 			}
 		}
 
 		if route.Table < 0 {
 			allErrors = append(allErrors, fmt.Errorf("%s.table: must be a non-negative integer, got %d", currentFieldPath, route.Table))
 		}
+
+		if route.Metric != nil && *route.Metric < 0 {
+			allErrors = append(allErrors, fmt.Errorf("%s.metric: must be a non-negative integer, got %d", currentFieldPath, *route.Metric))
+		}
+
+		if route.Protocol != nil && (*route.Protocol < 1 || *route.Protocol > 255) {
+			allErrors = append(allErrors, fmt.Errorf("%s.protocol: must be between 1 and 255, got %d", currentFieldPath, *route.Protocol))
+		}
+
+		for _, metric := range []struct {
+			name  string
+			value *int
+		}{
+			{"advMSS", route.AdvMSS},
+			{"initCwnd", route.InitCwnd},
+			{"initRwnd", route.InitRwnd},
+		} {
+			if metric.value != nil && *metric.value <= 0 {
+				allErrors = append(allErrors, fmt.Errorf("%s.%s: must be a positive integer, got %d", currentFieldPath, metric.name, *metric.value))
+			}
+		}
 	}
 	return allErrors
 }
 
+// routeDestinationIP returns the IP of a route destination given as an IP or
+// a CIDR, or nil if it cannot be parsed.
+func routeDestinationIP(destination string) net.IP {
+	if ip, _, err := net.ParseCIDR(destination); err == nil {
+		return ip
+	}
+	return net.ParseIP(destination)
+}
+
 // validateRules validates a slice of RuleConfig.
 func validateRules(rules []RuleConfig, fieldPath string) (allErrors []error) {
 	for i, rule := range rules {
@@ -270,15 +499,209 @@ func validateRules(rules []RuleConfig, fieldPath string) (allErrors []error) {
 				allErrors = append(allErrors, fmt.Errorf("%s.destination: invalid CIDR format '%s'", currentFieldPath, rule.Destination))
 			}
 		}
+
+		if rule.FWMark != nil && *rule.FWMark == 0 && rule.FWMask == nil {
+			allErrors = append(allErrors, fmt.Errorf("%s.fwMark: 0 requires fwMask to be set", currentFieldPath))
+		}
+		if rule.FWMask != nil {
+			switch {
+			case rule.FWMark == nil:
+				allErrors = append(allErrors, fmt.Errorf("%s.fwMask: requires fwMark to be set", currentFieldPath))
+			case *rule.FWMask == 0:
+				allErrors = append(allErrors, fmt.Errorf("%s.fwMask: must not be 0", currentFieldPath))
+			case *rule.FWMark&^*rule.FWMask != 0:
+				allErrors = append(allErrors, fmt.Errorf("%s.fwMark: 0x%x has bits outside of fwMask 0x%x", currentFieldPath, *rule.FWMark, *rule.FWMask))
+			}
+		}
 	}
 	return allErrors
 }
 
 // validateEthtoolConfig validates the EthtoolConfig part of the NetworkConfig.
 func validateEthtoolConfig(cfg *EthtoolConfig, fieldPath string) (allErrors []error) {
+	for i, feature := range cfg.OrderedFeatures {
+		currentFieldPath := fmt.Sprintf("%s.orderedFeatures[%d]", fieldPath, i)
+		if feature.Name == "" {
+			allErrors = append(allErrors, fmt.Errorf("%s.name: must be specified", currentFieldPath))
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(cfg.Features)) {
+			if ethtoolFeaturesOverlap(feature.Name, name) {
+				allErrors = append(allErrors, fmt.Errorf("%s.name: feature %q is also set in %s.features as %q", currentFieldPath, feature.Name, fieldPath, name))
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Features)) {
+		if err := validateEthtoolStringName(name); err != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s.features[%q]: %w", fieldPath, name, err))
+		}
+	}
+	orderedFeatures := make(map[string]bool, len(cfg.OrderedFeatures))
+	for _, feature := range cfg.OrderedFeatures {
+		orderedFeatures[feature.Name] = true
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.PrivateFlags)) {
+		currentFieldPath := fmt.Sprintf("%s.privateFlags[%q]", fieldPath, name)
+		if err := validateEthtoolStringName(name); err != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s: %w", currentFieldPath, err))
+			continue
+		}
+		// Private flags are device specific and can't be validated further,
+		// but the same key as a feature and a private flag is always a mistake.
+		if _, ok := cfg.Features[name]; ok || orderedFeatures[name] {
+			allErrors = append(allErrors, fmt.Errorf("%s: %q is also set as a feature", currentFieldPath, name))
+		}
+	}
+	if cfg.Pause != nil && cfg.Pause.Autoneg == nil && cfg.Pause.RxPause == nil && cfg.Pause.TxPause == nil {
+		allErrors = append(allErrors, fmt.Errorf("%s.pause: at least one of autoneg, rxPause or txPause must be specified", fieldPath))
+	}
+	if cfg.FEC != nil {
+		switch *cfg.FEC {
+		case EthtoolFECNone, EthtoolFECBaseR, EthtoolFECRS, EthtoolFECAuto:
+		default:
+			allErrors = append(allErrors, fmt.Errorf("%s.fec: unsupported mode %q, must be one of %q, %q, %q or %q", fieldPath, *cfg.FEC, EthtoolFECNone, EthtoolFECBaseR, EthtoolFECRS, EthtoolFECAuto))
+		}
+	}
+	if cfg.Coalesce != nil {
+		allErrors = append(allErrors, validateCoalesceConfig(cfg.Coalesce, fieldPath+".coalesce")...)
+	}
+	seen := make(map[string]bool, len(cfg.ApplyBeforeMove))
+	for i, setting := range cfg.ApplyBeforeMove {
+		currentFieldPath := fmt.Sprintf("%s.applyBeforeMove[%d]", fieldPath, i)
+		if seen[setting] {
+			allErrors = append(allErrors, fmt.Errorf("%s: duplicate setting %q", currentFieldPath, setting))
+			continue
+		}
+		seen[setting] = true
+		switch setting {
+		case EthtoolSettingPrivateFlags:
+			if len(cfg.PrivateFlags) == 0 {
+				allErrors = append(allErrors, fmt.Errorf("%s: %s.privateFlags must be specified", currentFieldPath, fieldPath))
+			}
+		case EthtoolSettingPause:
+			if cfg.Pause == nil {
+				allErrors = append(allErrors, fmt.Errorf("%s: %s.pause must be specified", currentFieldPath, fieldPath))
+			}
+		default:
+			allErrors = append(allErrors, fmt.Errorf("%s: unsupported setting %q, must be one of %q or %q", currentFieldPath, setting, EthtoolSettingPrivateFlags, EthtoolSettingPause))
+		}
+	}
+	if cfg.AllowLinkDown != nil && *cfg.AllowLinkDown && len(cfg.Features) == 0 && len(cfg.OrderedFeatures) == 0 {
+		allErrors = append(allErrors, fmt.Errorf("%s.allowLinkDown: only applies to features, %s.features or %s.orderedFeatures must be specified", fieldPath, fieldPath, fieldPath))
+	}
+	return allErrors
+}
+
+// ethtoolStringMaxLen is the maximum length of an ethtool feature or private
+// flag name, ETH_GSTRING_LEN including the terminating NUL.
+const ethtoolStringMaxLen = 32
+
+// validateCoalesceConfig validates the interrupt coalescing of the ethtool
+// configuration. The queues are checked against the channel count of the
+// interface when the claim is prepared.
+func validateCoalesceConfig(cfg *CoalesceConfig, fieldPath string) (allErrors []error) {
+	if cfg.CoalesceParams.IsEmpty() && len(cfg.PerQueue) == 0 {
+		allErrors = append(allErrors, fmt.Errorf("%s: at least one parameter or perQueue must be specified", fieldPath))
+	}
+	queues := make(map[uint32]bool, len(cfg.PerQueue))
+	for i, queue := range cfg.PerQueue {
+		currentFieldPath := fmt.Sprintf("%s.perQueue[%d]", fieldPath, i)
+		if queue.Queue >= MaxCoalesceQueues {
+			allErrors = append(allErrors, fmt.Errorf("%s.queue: %d must be lower than %d", currentFieldPath, queue.Queue, MaxCoalesceQueues))
+		}
+		if queues[queue.Queue] {
+			allErrors = append(allErrors, fmt.Errorf("%s.queue: duplicate queue %d", currentFieldPath, queue.Queue))
+		}
+		queues[queue.Queue] = true
+		if queue.CoalesceParams.IsEmpty() {
+			allErrors = append(allErrors, fmt.Errorf("%s: at least one parameter must be specified", currentFieldPath))
+		}
+	}
+	return allErrors
+}
+
+// IsEmpty returns true if none of the coalescing parameters is set.
+func (p CoalesceParams) IsEmpty() bool {
+	return p.RxUsecs == nil && p.RxMaxFrames == nil && p.TxUsecs == nil && p.TxMaxFrames == nil && p.AdaptiveRx == nil && p.AdaptiveTx == nil
+}
+
+// validateEthtoolStringName rejects feature and private flag names that can
+// never be reported by the kernel.
+func validateEthtoolStringName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(name) >= ethtoolStringMaxLen {
+		return fmt.Errorf("name must be less than %d characters", ethtoolStringMaxLen)
+	}
+	if strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("name must not contain whitespace")
+	}
+	return nil
+}
+
+// validateQdiscConfig validates the QdiscConfig part of the NetworkConfig.
+func validateQdiscConfig(cfg *QdiscConfig, fieldPath string) (allErrors []error) {
+	switch cfg.Type {
+	case QdiscTypeFQ, QdiscTypeMQ, QdiscTypePfifoFast:
+	default:
+		allErrors = append(allErrors, fmt.Errorf("%s.type: unsupported qdisc %q, must be one of %q, %q or %q", fieldPath, cfg.Type, QdiscTypeFQ, QdiscTypeMQ, QdiscTypePfifoFast))
+	}
+	return allErrors
+}
+
+// validateRateLimitConfig validates the RateLimitConfig part of the
+// NetworkConfig. The received traffic is policed in bytes per second on 32
+// bits, so RX can not exceed MaxRateLimitRX.
+func validateRateLimitConfig(cfg *RateLimitConfig, fieldPath string) (allErrors []error) {
+	if cfg.RX == nil && cfg.TX == nil {
+		allErrors = append(allErrors, fmt.Errorf("%s: at least one of rx or tx must be set", fieldPath))
+	}
+	if cfg.RX != nil {
+		if *cfg.RX == 0 {
+			allErrors = append(allErrors, fmt.Errorf("%s.rx: must be a positive number of bits per second", fieldPath))
+		} else if *cfg.RX > MaxRateLimitRX {
+			allErrors = append(allErrors, fmt.Errorf("%s.rx: %d must not exceed %d bits per second", fieldPath, *cfg.RX, uint64(MaxRateLimitRX)))
+		}
+	}
+	if cfg.TX != nil && *cfg.TX == 0 {
+		allErrors = append(allErrors, fmt.Errorf("%s.tx: must be a positive number of bits per second", fieldPath))
+	}
+	return allErrors
+}
+
+// validateRDMAExtraDevices validates the RDMAExtraDevices part of the
+// NetworkConfig. Only the RDMA character devices can be requested, so the
+// paths must be clean absolute paths under /dev/infiniband.
+func validateRDMAExtraDevices(paths []string, fieldPath string) (allErrors []error) {
+	for i, path := range paths {
+		currentFieldPath := fmt.Sprintf("%s[%d]", fieldPath, i)
+		if path != filepath.Clean(path) || !filepath.IsAbs(path) {
+			allErrors = append(allErrors, fmt.Errorf("%s: path %q must be a clean absolute path", currentFieldPath, path))
+			continue
+		}
+		if !strings.HasPrefix(path, RDMADevicesDir+"/") {
+			allErrors = append(allErrors, fmt.Errorf("%s: path %q must be under %s", currentFieldPath, path, RDMADevicesDir))
+		}
+	}
 	return allErrors
 }
 
+// ParseRDMADeviceMode returns the file mode of the RDMA character devices
+// from its octal representation, e.g. "0660". Only the permission bits can be
+// set, and a mode without any permission is rejected since the containers
+// could not use the devices.
+func ParseRDMADeviceMode(mode string) (uint32, error) {
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("mode %q must be an octal number", mode)
+	}
+	if value == 0 || value > 0o777 {
+		return 0, fmt.Errorf("mode %q must be between 0001 and 0777", mode)
+	}
+	return uint32(value), nil
+}
+
 // ValidateRDMAOnlyConfig checks that a NetworkConfig does not contain
 // network-specific fields that are meaningless (and unsupported) for an
 // RDMA-only device (i.e. a device with no network interface). Callers should
@@ -296,11 +719,17 @@ func ValidateRDMAOnlyConfig(raw *runtime.RawExtension) []error {
 	for _, e := range strictErrs {
 		allErrors = append(allErrors, fmt.Errorf("failed to unmarshal strict JSON data: %w", e))
 	}
-	if config.Interface.Name != "" || len(config.Interface.Addresses) > 0 ||
-		config.Interface.MTU != nil || config.Interface.HardwareAddr != nil ||
-		config.Interface.DHCP != nil || config.Interface.GSOMaxSize != nil ||
+	if config.Interface.Name != "" || len(config.Interface.Addresses) > 0 || len(config.Interface.Broadcasts) > 0 ||
+		config.Interface.MTU != nil || config.Interface.HardwareAddr != nil || config.Interface.GenerateHardwareAddr != nil ||
+		config.Interface.DHCP != nil || config.Interface.DHCPHostname != nil ||
+		config.Interface.DHCPBroadcast != nil || len(config.Interface.DHCPRequestOptions) > 0 ||
+		config.Interface.DHCPRequestedIP != nil || config.Interface.DHCPRouteTable != nil ||
+		config.Interface.IPAMPool != nil || config.Interface.PreserveAllAddresses != nil ||
+		config.Interface.GSOMaxSize != nil ||
 		config.Interface.GROMaxSize != nil || config.Interface.GSOIPv4MaxSize != nil ||
-		config.Interface.GROIPv4MaxSize != nil || config.Interface.DisableEBPFPrograms != nil {
+		config.Interface.GROIPv4MaxSize != nil || config.Interface.GSOMaxSegments != nil ||
+		config.Interface.DisableEBPFPrograms != nil ||
+		len(config.Interface.DisableEBPF) > 0 || config.Interface.NUMAIRQAffinity != nil {
 		allErrors = append(allErrors, fmt.Errorf("interface configuration is not supported for RDMA-only devices (no network interface present)"))
 	}
 	if len(config.Routes) > 0 {
@@ -312,12 +741,40 @@ func ValidateRDMAOnlyConfig(raw *runtime.RawExtension) []error {
 	if config.Ethtool != nil {
 		allErrors = append(allErrors, fmt.Errorf("ethtool configuration is not supported for RDMA-only devices (no network interface present)"))
 	}
+	if config.Qdisc != nil {
+		allErrors = append(allErrors, fmt.Errorf("qdisc configuration is not supported for RDMA-only devices (no network interface present)"))
+	}
+	if config.RateLimit != nil {
+		allErrors = append(allErrors, fmt.Errorf("rate limits are not supported for RDMA-only devices (no network interface present)"))
+	}
 	if len(config.Neighbors) > 0 {
 		allErrors = append(allErrors, fmt.Errorf("neighbors are not supported for RDMA-only devices (no network interface present)"))
 	}
 	return allErrors
 }
 
+// ValidateVFIOConfig validates the configuration of a PCI device bound to
+// vfio-pci. The device has no network interface, no network configuration
+// can be applied to it.
+func ValidateVFIOConfig(raw *runtime.RawExtension) []error {
+	if raw == nil || raw.Raw == nil || len(raw.Raw) == 0 {
+		return nil
+	}
+	var config NetworkConfig
+	var allErrors []error
+	strictErrs, err := json.UnmarshalStrict(raw.Raw, &config)
+	if err != nil {
+		return []error{fmt.Errorf("failed to unmarshal JSON data: %w", err)}
+	}
+	for _, e := range strictErrs {
+		allErrors = append(allErrors, fmt.Errorf("failed to unmarshal strict JSON data: %w", e))
+	}
+	if !reflect.DeepEqual(config, NetworkConfig{}) {
+		allErrors = append(allErrors, fmt.Errorf("network configuration is not supported for PCI devices bound to vfio-pci (no network interface present)"))
+	}
+	return allErrors
+}
+
 // validateNeighborConfig validates a slice of NeighborConfig.
 func validateNeighborConfig(neighbors []NeighborConfig, fieldPath string) (allErrors []error) {
 	for i, neighbor := range neighbors {
@@ -186,6 +186,10 @@ func TestIsValidLinuxInterfaceName(t *testing.T) {
 		{"is dot", ".", "iface.name", true},
 		{"is dotdot", "..", "iface.name", true},
 		{"contains invalid char", "eth!", "iface.name", true},
+		{"reserved loopback", "lo", "iface.name", true},
+		{"reserved sysctl all", "all", "iface.name", true},
+		{"reserved sysctl default", "default", "iface.name", true},
+		{"prefix of reserved", "lo1", "iface.name", false},
 	}
 
 	for _, tt := range tests {
@@ -240,6 +244,31 @@ func TestValidateInterfaceConfig(t *testing.T) {
 			expectErr: true,
 			errCount:  1,
 		},
+		{
+			name:      "invalid MTU (too large)",
+			cfg:       &InterfaceConfig{Name: "eth0", MTU: ptr.To[int32](90000)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid MTU (maximum)",
+			cfg:       &InterfaceConfig{Name: "eth0", MTU: ptr.To[int32](MaxMTU)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "valid MTU (jumbo frames)",
+			cfg:       &InterfaceConfig{Name: "eth0", MTU: ptr.To[int32](9000)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "valid MTU (GCE RDMA)",
+			cfg:       &InterfaceConfig{Name: "eth0", MTU: ptr.To[int32](8896)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
 		{
 			name:      "invalid GSO MaxSize",
 			cfg:       &InterfaceConfig{Name: "eth0", GSOMaxSize: ptr.To[int32](0)},
@@ -268,6 +297,33 @@ func TestValidateInterfaceConfig(t *testing.T) {
 			expectErr: true,
 			errCount:  1,
 		},
+		{
+			name:      "invalid GSO MaxSegments",
+			cfg:       &InterfaceConfig{Name: "eth0", GSOMaxSegments: ptr.To[int32](0)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid disable eBPF program types",
+			cfg:       &InterfaceConfig{Name: "eth0", DisableEBPF: []string{"tc", "tcx", "xdp"}},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "invalid disable eBPF program type",
+			cfg:       &InterfaceConfig{Name: "eth0", DisableEBPF: []string{"tc", "kprobe"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "duplicate disable eBPF program type",
+			cfg:       &InterfaceConfig{Name: "eth0", DisableEBPF: []string{"xdp", "xdp"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
 		{
 			name:      "valid hardware address",
 			cfg:       &InterfaceConfig{Name: "eth0", HardwareAddr: ptr.To("00:1A:2B:3C:4D:5E")},
@@ -281,6 +337,53 @@ func TestValidateInterfaceConfig(t *testing.T) {
 			expectErr: true,
 			errCount:  1,
 		},
+		{
+			name:      "valid generated hardware address",
+			cfg:       &InterfaceConfig{Name: "eth0", GenerateHardwareAddr: ptr.To(true)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "generated and explicit hardware address",
+			cfg:       &InterfaceConfig{Name: "eth0", HardwareAddr: ptr.To("00:1A:2B:3C:4D:5E"), GenerateHardwareAddr: ptr.To(true)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid broadcast address",
+			cfg:       &InterfaceConfig{Name: "eth0", Addresses: []string{"192.168.1.10/24"}, Broadcasts: map[string]string{"192.168.1.10/24": "192.168.1.127"}},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "broadcast address outside the subnet",
+			cfg:       &InterfaceConfig{Name: "eth0", Addresses: []string{"192.168.1.10/24"}, Broadcasts: map[string]string{"192.168.1.10/24": "192.168.2.255"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "broadcast address for an address not configured",
+			cfg:       &InterfaceConfig{Name: "eth0", Addresses: []string{"192.168.1.10/24"}, Broadcasts: map[string]string{"192.168.1.11/24": "192.168.1.255"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "broadcast address for an IPv6 address",
+			cfg:       &InterfaceConfig{Name: "eth0", Addresses: []string{"2001:db8::1/64"}, Broadcasts: map[string]string{"2001:db8::1/64": "2001:db8::ffff"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "invalid broadcast address",
+			cfg:       &InterfaceConfig{Name: "eth0", Addresses: []string{"192.168.1.10/24"}, Broadcasts: map[string]string{"192.168.1.10/24": "192.168.1"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
 		{
 			name:      "valid with dhcp",
 			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true)},
@@ -300,6 +403,187 @@ func TestValidateInterfaceConfig(t *testing.T) {
 			fieldPath: "iface",
 			expectErr: false,
 		},
+		{
+			name:      "valid dhcp hostname",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPHostname: ptr.To("pod-1.example.com.")},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "dhcp hostname without dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCPHostname: ptr.To("pod-1")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "invalid dhcp hostname label",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPHostname: ptr.To("-pod.my_domain")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  2,
+		},
+		{
+			name:      "empty dhcp hostname",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPHostname: ptr.To("")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid dhcp unicast",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPBroadcast: ptr.To(false)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "dhcp broadcast without dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(false), DHCPBroadcast: ptr.To(false)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid dhcp requested ip",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRequestedIP: ptr.To("192.168.10.20")},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "dhcp requested ip without dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCPRequestedIP: ptr.To("192.168.10.20")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "dhcp requested ip not an IPv4 address",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRequestedIP: ptr.To("fd00::20")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "invalid dhcp requested ip",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRequestedIP: ptr.To("192.168.10.20/24")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "dhcp route table in main",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRouteTable: ptr.To(254)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "dhcp route table without dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCPRouteTable: ptr.To(100)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "dhcp route table is the local table",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRouteTable: ptr.To(255)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "dhcp route table with vrf",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRouteTable: ptr.To(100), VRF: &VRFConfig{Name: "vrf0", Table: ptr.To(1001)}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid dhcp request options",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRequestOptions: []int{42, 121}},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "dhcp request options without dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCPRequestOptions: []int{42}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "dhcp request options out of range",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRequestOptions: []int{0, 255, 300}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  3,
+		},
+		{
+			name:      "duplicate dhcp request options",
+			cfg:       &InterfaceConfig{Name: "eth0", DHCP: ptr.To(true), DHCPRequestOptions: []int{42, 42}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid interface name template",
+			cfg:       &InterfaceConfig{Name: "net-{pci_bus}{pci_device}"},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "interface name template too long once expanded",
+			cfg:       &InterfaceConfig{Name: "network-{pci_domain}{pci_bus}{pci_device}"},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "interface name template with unknown placeholder",
+			cfg:       &InterfaceConfig{Name: "net-{ifname}"},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid preserve all addresses",
+			cfg:       &InterfaceConfig{Name: "eth0", PreserveAllAddresses: ptr.To(true)},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "preserve all addresses with addresses and dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", PreserveAllAddresses: ptr.To(true), DHCP: ptr.To(true), Addresses: []string{"10.0.0.1/24"}},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  3, // dhcp+addresses, preserve+addresses, preserve+dhcp
+		},
+		{
+			name:      "preserve all addresses with ipam pool",
+			cfg:       &InterfaceConfig{Name: "eth0", PreserveAllAddresses: ptr.To(true), IPAMPool: ptr.To("storage")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid ipam pool",
+			cfg:       &InterfaceConfig{Name: "eth0", IPAMPool: ptr.To("storage")},
+			fieldPath: "iface",
+			expectErr: false,
+		},
+		{
+			name:      "empty ipam pool",
+			cfg:       &InterfaceConfig{Name: "eth0", IPAMPool: ptr.To("")},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "ipam pool with addresses and dhcp",
+			cfg:       &InterfaceConfig{Name: "eth0", IPAMPool: ptr.To("storage"), Addresses: []string{"10.0.0.1/24"}, DHCP: ptr.To(true)},
+			fieldPath: "iface",
+			expectErr: true,
+			errCount:  3,
+		},
 		{
 			name:      "multiple errors",
 			cfg:       &InterfaceConfig{Name: "eth/0", Addresses: []string{"badip"}, MTU: ptr.To[int32](0)},
@@ -413,6 +697,104 @@ func TestValidateRoutes(t *testing.T) {
 			expectErr: true,
 			errCount:  1,
 		},
+		{
+			name:      "valid IPv6 source",
+			routes:    []RouteConfig{{Destination: "2001:db8::/64", Gateway: "fd00::1", Source: "fd00::10"}},
+			fieldPath: "routes",
+			expectErr: false,
+		},
+		{
+			name:      "source family does not match destination",
+			routes:    []RouteConfig{{Destination: "0.0.0.0/0", Gateway: "192.168.1.1", Source: "fd00::10"}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid IPv6 default route",
+			routes:    []RouteConfig{{Destination: "::/0", Gateway: "fe80::1"}},
+			fieldPath: "routes",
+			expectErr: false,
+		},
+		{
+			name:      "IPv4 gateway for an IPv6 destination",
+			routes:    []RouteConfig{{Destination: "2001:db8::/64", Gateway: "192.168.1.1"}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "IPv6 gateway for an IPv4 destination",
+			routes:    []RouteConfig{{Destination: "10.0.0.0/8", Gateway: "fd00::1"}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "IPv6 gateway for an IPv4 destination IP",
+			routes:    []RouteConfig{{Destination: "10.0.0.1", Gateway: "fd00::1"}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "dual-stack routes",
+			routes: []RouteConfig{
+				{Destination: "0.0.0.0/0", Gateway: "192.168.1.1"},
+				{Destination: "::/0", Gateway: "fd00::1"},
+			},
+			fieldPath: "routes",
+			expectErr: false,
+		},
+		{
+			name:      "gateway and source family do not match the destination",
+			routes:    []RouteConfig{{Destination: "2001:db8::/64", Gateway: "192.168.1.1", Source: "192.168.1.10"}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  2,
+		},
+		{
+			name:      "valid tcp metrics",
+			routes:    []RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1", AdvMSS: ptr.To(1400), InitCwnd: ptr.To(20), InitRwnd: ptr.To(20)}},
+			fieldPath: "routes",
+			expectErr: false,
+		},
+		{
+			name:      "non positive tcp metrics",
+			routes:    []RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1", AdvMSS: ptr.To(0), InitCwnd: ptr.To(-1), InitRwnd: ptr.To(0)}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  3,
+		},
+		{
+			name:      "default route with metric",
+			routes:    []RouteConfig{{Destination: "0.0.0.0/0", Gateway: "192.168.1.1", Metric: ptr.To(100)}},
+			fieldPath: "routes",
+			expectErr: false,
+		},
+		{
+			name:      "negative metric",
+			routes:    []RouteConfig{{Destination: "0.0.0.0/0", Gateway: "192.168.1.1", Metric: ptr.To(-1)}},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid protocol",
+			routes:    []RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1", Protocol: ptr.To(unix.RTPROT_STATIC)}},
+			fieldPath: "routes",
+			expectErr: false,
+		},
+		{
+			name: "protocol out of range",
+			routes: []RouteConfig{
+				{Destination: "10.0.0.0/8", Gateway: "192.168.1.1", Protocol: ptr.To(0)},
+				{Destination: "10.1.0.0/16", Gateway: "192.168.1.1", Protocol: ptr.To(256)},
+			},
+			fieldPath: "routes",
+			expectErr: true,
+			errCount:  2,
+		},
 	}
 
 	for _, tt := range tests {
@@ -489,6 +871,52 @@ func TestValidateRules(t *testing.T) {
 			expectErr: true,
 			errCount:  1,
 		},
+		{
+			name:      "valid rule - fwmark",
+			rules:     []RuleConfig{{FWMark: ptr.To[uint32](0x1), Table: 100}},
+			fieldPath: "rules",
+			expectErr: false,
+		},
+		{
+			name:      "valid rule - fwmark with mask",
+			rules:     []RuleConfig{{FWMark: ptr.To[uint32](0x100), FWMask: ptr.To[uint32](0xff00), Table: 100}},
+			fieldPath: "rules",
+			expectErr: false,
+		},
+		{
+			name:      "invalid fwmask without fwmark",
+			rules:     []RuleConfig{{FWMask: ptr.To[uint32](0xff), Table: 100}},
+			fieldPath: "rules",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid rule - zero fwmark with mask",
+			rules:     []RuleConfig{{FWMark: ptr.To[uint32](0), FWMask: ptr.To[uint32](0xff), Table: 100}},
+			fieldPath: "rules",
+			expectErr: false,
+		},
+		{
+			name:      "invalid zero fwmark without fwmask",
+			rules:     []RuleConfig{{FWMark: ptr.To[uint32](0), Table: 100}},
+			fieldPath: "rules",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "invalid fwmask zero",
+			rules:     []RuleConfig{{FWMark: ptr.To[uint32](0), FWMask: ptr.To[uint32](0), Table: 100}},
+			fieldPath: "rules",
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "invalid fwmark outside of fwmask",
+			rules:     []RuleConfig{{FWMark: ptr.To[uint32](0x1ff), FWMask: ptr.To[uint32](0xff00), Table: 100}},
+			fieldPath: "rules",
+			expectErr: true,
+			errCount:  1,
+		},
 		{
 			name:      "multiple errors",
 			rules:     []RuleConfig{{Priority: -1, Table: -1, Source: "invalid", Destination: "invalid"}},
@@ -567,3 +995,378 @@ func TestValidateNeighborConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEthtoolConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *EthtoolConfig
+		expectErr bool
+		errCount  int
+	}{
+		{
+			name:      "features only",
+			cfg:       &EthtoolConfig{Features: map[string]bool{"tso": true}},
+			expectErr: false,
+		},
+		{
+			name: "valid ordered features",
+			cfg: &EthtoolConfig{
+				Features: map[string]bool{"tso": true},
+				OrderedFeatures: []EthtoolFeature{
+					{Name: "large-receive-offload", Enabled: false},
+					{Name: "generic-receive-offload", Enabled: true},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name:      "allow link down with features",
+			cfg:       &EthtoolConfig{OrderedFeatures: []EthtoolFeature{{Name: "rx-fcs", Enabled: true}}, AllowLinkDown: ptr.To(true)},
+			expectErr: false,
+		},
+		{
+			name:      "allow link down without features",
+			cfg:       &EthtoolConfig{PrivateFlags: map[string]bool{"rx_cqe_compress": true}, AllowLinkDown: ptr.To(true)},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "ordered feature without name",
+			cfg:       &EthtoolConfig{OrderedFeatures: []EthtoolFeature{{Enabled: true}}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "feature in both forms",
+			cfg: &EthtoolConfig{
+				Features:        map[string]bool{"generic-receive-offload": false},
+				OrderedFeatures: []EthtoolFeature{{Name: "generic-receive-offload", Enabled: true}},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "feature in both forms with an alias",
+			cfg: &EthtoolConfig{
+				Features:        map[string]bool{"gro": false},
+				OrderedFeatures: []EthtoolFeature{{Name: "rx-gro", Enabled: true}},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "feature in both forms with a short and a long alias",
+			cfg: &EthtoolConfig{
+				Features:        map[string]bool{"tx-checksum-ipv4": false, "tso": true},
+				OrderedFeatures: []EthtoolFeature{{Name: "tx-checksumming", Enabled: true}, {Name: "tcp-segmentation-offload", Enabled: false}},
+			},
+			expectErr: true,
+			errCount:  2,
+		},
+		{
+			name: "distinct features in both forms",
+			cfg: &EthtoolConfig{
+				Features:        map[string]bool{"lro": false},
+				OrderedFeatures: []EthtoolFeature{{Name: "rx-gro", Enabled: true}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "valid private flags",
+			cfg: &EthtoolConfig{
+				Features:     map[string]bool{"tso": true},
+				PrivateFlags: map[string]bool{"rx_cqe_compress": true, "disable-fw-lldp": false},
+			},
+			expectErr: false,
+		},
+		{
+			name: "private flag also in features",
+			cfg: &EthtoolConfig{
+				Features:     map[string]bool{"rx-gro-hw": true},
+				PrivateFlags: map[string]bool{"rx-gro-hw": true},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "private flag also in ordered features",
+			cfg: &EthtoolConfig{
+				OrderedFeatures: []EthtoolFeature{{Name: "rx-gro-hw", Enabled: true}},
+				PrivateFlags:    map[string]bool{"rx-gro-hw": true},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "empty private flag",
+			cfg:       &EthtoolConfig{PrivateFlags: map[string]bool{"": true}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "private flag with whitespace",
+			cfg:       &EthtoolConfig{PrivateFlags: map[string]bool{"rx cqe compress": true}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "private flag too long",
+			cfg:       &EthtoolConfig{PrivateFlags: map[string]bool{"this-private-flag-name-is-too-long": true}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "empty feature",
+			cfg:       &EthtoolConfig{Features: map[string]bool{"": true}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid pause",
+			cfg:       &EthtoolConfig{Pause: &PauseConfig{Autoneg: ptr.To(false), RxPause: ptr.To(true), TxPause: ptr.To(true)}},
+			expectErr: false,
+		},
+		{
+			name:      "empty pause",
+			cfg:       &EthtoolConfig{Pause: &PauseConfig{}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name:      "valid fec",
+			cfg:       &EthtoolConfig{FEC: ptr.To(EthtoolFECRS)},
+			expectErr: false,
+		},
+		{
+			name:      "unsupported fec",
+			cfg:       &EthtoolConfig{FEC: ptr.To("llrs")},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "valid coalesce",
+			cfg: &EthtoolConfig{Coalesce: &CoalesceConfig{
+				CoalesceParams: CoalesceParams{AdaptiveRx: ptr.To(false)},
+				PerQueue: []QueueCoalesce{
+					{Queue: 0, CoalesceParams: CoalesceParams{RxUsecs: ptr.To[uint32](0)}},
+					{Queue: 3, CoalesceParams: CoalesceParams{RxUsecs: ptr.To[uint32](50), TxMaxFrames: ptr.To[uint32](32)}},
+				},
+			}},
+			expectErr: false,
+		},
+		{
+			name:      "empty coalesce",
+			cfg:       &EthtoolConfig{Coalesce: &CoalesceConfig{}},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "invalid coalesce queues",
+			cfg: &EthtoolConfig{Coalesce: &CoalesceConfig{PerQueue: []QueueCoalesce{
+				{Queue: 1, CoalesceParams: CoalesceParams{RxUsecs: ptr.To[uint32](8)}},
+				{Queue: 1, CoalesceParams: CoalesceParams{TxUsecs: ptr.To[uint32](8)}},
+				{Queue: MaxCoalesceQueues, CoalesceParams: CoalesceParams{RxUsecs: ptr.To[uint32](8)}},
+				{Queue: 2},
+			}}},
+			expectErr: true,
+			errCount:  3,
+		},
+		{
+			name: "private flags and pause before the move",
+			cfg: &EthtoolConfig{
+				Features:        map[string]bool{"tso": true},
+				PrivateFlags:    map[string]bool{"rx_cqe_compress": true},
+				Pause:           &PauseConfig{RxPause: ptr.To(true)},
+				ApplyBeforeMove: []string{EthtoolSettingPrivateFlags, EthtoolSettingPause},
+			},
+			expectErr: false,
+		},
+		{
+			name: "features can not be applied before the move",
+			cfg: &EthtoolConfig{
+				Features:        map[string]bool{"tso": true},
+				ApplyBeforeMove: []string{"features"},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "setting before the move is not configured",
+			cfg: &EthtoolConfig{
+				PrivateFlags:    map[string]bool{"rx_cqe_compress": true},
+				ApplyBeforeMove: []string{EthtoolSettingPrivateFlags, EthtoolSettingPause},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+		{
+			name: "duplicate setting before the move",
+			cfg: &EthtoolConfig{
+				Pause:           &PauseConfig{TxPause: ptr.To(true)},
+				ApplyBeforeMove: []string{EthtoolSettingPause, EthtoolSettingPause},
+			},
+			expectErr: true,
+			errCount:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateEthtoolConfig(tt.cfg, "ethtool")
+			if (len(errs) > 0) != tt.expectErr {
+				t.Errorf("validateEthtoolConfig() got errors: %v, want %v", errs, tt.expectErr)
+			}
+			if tt.expectErr && len(errs) != tt.errCount {
+				t.Errorf("validateEthtoolConfig() got %d errors (%v), want %d", len(errs), errs, tt.errCount)
+			}
+		})
+	}
+}
+
+func TestValidateQdiscConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *QdiscConfig
+		expectErr bool
+	}{
+		{name: "fq", cfg: &QdiscConfig{Type: QdiscTypeFQ}},
+		{name: "mq", cfg: &QdiscConfig{Type: QdiscTypeMQ}},
+		{name: "pfifo_fast", cfg: &QdiscConfig{Type: QdiscTypePfifoFast}},
+		{name: "empty", cfg: &QdiscConfig{}, expectErr: true},
+		{name: "unsupported", cfg: &QdiscConfig{Type: "htb"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateQdiscConfig(tt.cfg, "qdisc")
+			if (len(errs) > 0) != tt.expectErr {
+				t.Errorf("validateQdiscConfig() got errors: %v, want %v", errs, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateRateLimitConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *RateLimitConfig
+		expectErr bool
+	}{
+		{name: "rx and tx", cfg: &RateLimitConfig{RX: ptr.To[uint64](1_000_000_000), TX: ptr.To[uint64](2_000_000_000)}},
+		{name: "tx only", cfg: &RateLimitConfig{TX: ptr.To[uint64](100_000_000_000)}},
+		{name: "max rx", cfg: &RateLimitConfig{RX: ptr.To[uint64](MaxRateLimitRX)}},
+		{name: "empty", cfg: &RateLimitConfig{}, expectErr: true},
+		{name: "zero rx", cfg: &RateLimitConfig{RX: ptr.To[uint64](0)}, expectErr: true},
+		{name: "zero tx", cfg: &RateLimitConfig{TX: ptr.To[uint64](0)}, expectErr: true},
+		{name: "rx above the police limit", cfg: &RateLimitConfig{RX: ptr.To[uint64](MaxRateLimitRX + 1)}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateRateLimitConfig(tt.cfg, "rateLimit")
+			if (len(errs) > 0) != tt.expectErr {
+				t.Errorf("validateRateLimitConfig() got errors: %v, want %v", errs, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfigRateLimitWithQdisc(t *testing.T) {
+	raw := []byte(`{"qdisc": {"type": "fq"}, "rateLimit": {"tx": 1000000}}`)
+	if _, errs := ValidateConfig(&runtime.RawExtension{Raw: raw}); len(errs) == 0 {
+		t.Errorf("ValidateConfig() with qdisc and rateLimit.tx succeeded, want error")
+	}
+	raw = []byte(`{"qdisc": {"type": "fq"}, "rateLimit": {"rx": 1000000}}`)
+	if _, errs := ValidateConfig(&runtime.RawExtension{Raw: raw}); len(errs) != 0 {
+		t.Errorf("ValidateConfig() with qdisc and rateLimit.rx failed: %v", errs)
+	}
+}
+
+func TestValidateRDMAExtraDevices(t *testing.T) {
+	tests := []struct {
+		name      string
+		paths     []string
+		expectErr bool
+	}{
+		{name: "umad and issm", paths: []string{"/dev/infiniband/umad0", "/dev/infiniband/issm0"}},
+		{name: "outside /dev/infiniband", paths: []string{"/dev/null"}, expectErr: true},
+		{name: "the directory itself", paths: []string{"/dev/infiniband"}, expectErr: true},
+		{name: "similar prefix", paths: []string{"/dev/infinibandx/umad0"}, expectErr: true},
+		{name: "relative path", paths: []string{"dev/infiniband/umad0"}, expectErr: true},
+		{name: "escapes the directory", paths: []string{"/dev/infiniband/../sda"}, expectErr: true},
+		{name: "one invalid path", paths: []string{"/dev/infiniband/umad0", "/dev/sda"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateRDMAExtraDevices(tt.paths, "rdmaExtraDevices")
+			if (len(errs) > 0) != tt.expectErr {
+				t.Errorf("validateRDMAExtraDevices() got errors: %v, want %v", errs, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestParseRDMADeviceMode(t *testing.T) {
+	tests := []struct {
+		mode      string
+		want      uint32
+		expectErr bool
+	}{
+		{mode: "0666", want: 0o666},
+		{mode: "660", want: 0o660},
+		{mode: "0600", want: 0o600},
+		{mode: "0001", want: 0o001},
+		{mode: "0", expectErr: true},
+		{mode: "0000", expectErr: true},
+		{mode: "01777", expectErr: true},
+		{mode: "4755", expectErr: true},
+		{mode: "0688", expectErr: true},
+		{mode: "0o666", expectErr: true},
+		{mode: "rw-rw-rw-", expectErr: true},
+		{mode: "", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseRDMADeviceMode(tt.mode)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseRDMADeviceMode(%q) error = %v, expectErr %v", tt.mode, err, tt.expectErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRDMADeviceMode(%q) = %#o, want %#o", tt.mode, got, tt.want)
+			}
+		})
+	}
+
+	if _, errs := ValidateConfig(&runtime.RawExtension{Raw: []byte(`{"rdmaDeviceMode": "0660"}`)}); len(errs) > 0 {
+		t.Errorf("ValidateConfig() with a valid rdmaDeviceMode failed: %v", errs)
+	}
+	if _, errs := ValidateConfig(&runtime.RawExtension{Raw: []byte(`{"rdmaDeviceMode": "0999"}`)}); len(errs) == 0 {
+		t.Errorf("ValidateConfig() with an invalid rdmaDeviceMode succeeded")
+	}
+	if errs := ValidateRDMAOnlyConfig(&runtime.RawExtension{Raw: []byte(`{"rdmaDeviceMode": "0660"}`)}); len(errs) > 0 {
+		t.Errorf("ValidateRDMAOnlyConfig() with rdmaDeviceMode failed: %v", errs)
+	}
+}
+
+func TestValidateVFIOConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     *runtime.RawExtension
+		wantErr bool
+	}{
+		{name: "no configuration", raw: nil},
+		{name: "empty configuration", raw: &runtime.RawExtension{Raw: []byte(`{}`)}},
+		{name: "interface configuration", raw: newRawExtension(t, NetworkConfig{Interface: InterfaceConfig{Name: "dpdk0"}}), wantErr: true},
+		{name: "rate limit", raw: newRawExtension(t, NetworkConfig{RateLimit: &RateLimitConfig{TX: ptr.To[uint64](1_000_000)}}), wantErr: true},
+		{name: "unknown field", raw: &runtime.RawExtension{Raw: []byte(`{"vfio": true}`)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := ValidateVFIOConfig(tt.raw); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("ValidateVFIOConfig() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
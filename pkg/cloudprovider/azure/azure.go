@@ -24,7 +24,6 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
-	"strings"
 	"time"
 
 	"github.com/vishvananda/netlink"
@@ -146,12 +145,12 @@ func (a *AzureInstance) GetDeviceConfig(id cloudprovider.DeviceIdentifiers) *api
 		return nil
 	}
 
-	normalizedMAC := normalizeMAC(id.MAC)
-
 	var iface *networkInterface
 	var nicIndex int
+	// Azure IMDS returns MACs like "0011AAFFBB22" while Linux uses
+	// "00:11:aa:ff:bb:22".
 	for i := range a.Interfaces {
-		if normalizeMAC(a.Interfaces[i].MacAddress) == normalizedMAC {
+		if cloudprovider.MACEqual(a.Interfaces[i].MacAddress, id.MAC) {
 			iface = &a.Interfaces[i]
 			nicIndex = i
 			break
@@ -208,13 +207,6 @@ func (a *AzureInstance) GetDeviceConfig(id cloudprovider.DeviceIdentifiers) *api
 	return config
 }
 
-// normalizeMAC converts a MAC address to a consistent lowercase, colon-free format
-// for comparison. Azure IMDS returns MACs like "0011AAFFBB22" while Linux uses
-// "00:11:aa:ff:bb:22".
-func normalizeMAC(mac string) string {
-	return strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(mac, ":", ""), "-", ""))
-}
-
 // getIPv6DefaultGateway returns the IPv6 default gateway for the given
 // interface name by inspecting IPv6 default routes in the main routing table,
 // or an empty string if none is found.
@@ -348,25 +348,6 @@ func testGetDeviceConfig_Namespaced(t *testing.T) {
 	}
 }
 
-func TestNormalizeMAC(t *testing.T) {
-	tests := []struct {
-		input string
-		want  string
-	}{
-		{"00:11:22:33:44:55", "001122334455"},
-		{"001122334455", "001122334455"},
-		{"00-11-22-33-44-55", "001122334455"},
-		{"AA:BB:CC:DD:EE:FF", "aabbccddeeff"},
-		{"AABBCCDDEEFF", "aabbccddeeff"},
-	}
-	for _, tt := range tests {
-		got := normalizeMAC(tt.input)
-		if got != tt.want {
-			t.Errorf("normalizeMAC(%q) = %q, want %q", tt.input, got, tt.want)
-		}
-	}
-}
-
 func TestSubnetFirstAddress(t *testing.T) {
 	tests := []struct {
 		addr    string
@@ -17,6 +17,10 @@ limitations under the License.
 package cloudprovider
 
 import (
+	"net"
+	"strconv"
+	"strings"
+
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/dranet/pkg/apis"
@@ -41,6 +45,14 @@ type CloudInstance interface {
 	GetDeviceConfig(id DeviceIdentifiers) *apis.NetworkConfig
 }
 
+// NetworkMTUProvider is an optional interface implemented by cloud providers
+// whose metadata exposes the MTU of the network a device is attached to.
+type NetworkMTUProvider interface {
+	// GetNetworkMTU returns the MTU of the network of the device, or false if
+	// the provider has no metadata for it.
+	GetNetworkMTU(id DeviceIdentifiers) (int, bool)
+}
+
 // ProfileProvider is an optional interface implemented by cloud or webhook providers
 // that support on-demand, stateful network configurations based on user profiles.
 type ProfileProvider interface {
@@ -53,3 +65,50 @@ type ProfileProvider interface {
 	// previously allocated for the given claim and profile.
 	ReleaseProfileConfig(id DeviceIdentifiers, claimUID types.UID, config *apis.NetworkConfig) error
 }
+
+// CanonicalMAC returns the MAC address in the lowercase colon separated format
+// of net.HardwareAddr (e.g. "00:11:aa:ff:bb:22"), or "" if it is not valid.
+// Besides the formats accepted by net.ParseMAC, it accepts the formats used by
+// the cloud metadata services: no separators (e.g. "0011AAFFBB22") and octets
+// without their leading zero (e.g. "0:11:aa:ff:bb:22").
+func CanonicalMAC(mac string) string {
+	mac = strings.TrimSpace(mac)
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return hw.String()
+	}
+	var octets []string
+	if strings.ContainsAny(mac, ":-") {
+		octets = strings.Split(strings.ReplaceAll(mac, "-", ":"), ":")
+	} else {
+		if len(mac)%2 != 0 {
+			return ""
+		}
+		for i := 0; i < len(mac); i += 2 {
+			octets = append(octets, mac[i:i+2])
+		}
+	}
+	// Same lengths as net.ParseMAC: IEEE 802 MAC-48, EUI-48, EUI-64 and
+	// 20-octet IP over InfiniBand link-layer addresses.
+	if len(octets) != 6 && len(octets) != 8 && len(octets) != 20 {
+		return ""
+	}
+	hw := make(net.HardwareAddr, 0, len(octets))
+	for _, octet := range octets {
+		if len(octet) == 0 || len(octet) > 2 {
+			return ""
+		}
+		b, err := strconv.ParseUint(octet, 16, 8)
+		if err != nil {
+			return ""
+		}
+		hw = append(hw, byte(b))
+	}
+	return hw.String()
+}
+
+// MACEqual reports whether a and b are the same valid MAC address, regardless
+// of their case and format.
+func MACEqual(a, b string) bool {
+	canonical := CanonicalMAC(a)
+	return canonical != "" && canonical == CanonicalMAC(b)
+}
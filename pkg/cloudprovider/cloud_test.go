@@ -0,0 +1,68 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import "testing"
+
+func TestCanonicalMAC(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"00:11:22:33:44:55", "00:11:22:33:44:55"},
+		{"001122334455", "00:11:22:33:44:55"},
+		{"00-11-22-33-44-55", "00:11:22:33:44:55"},
+		{"0011.2233.4455", "00:11:22:33:44:55"},
+		{"AA:BB:CC:DD:EE:FF", "aa:bb:cc:dd:ee:ff"},
+		{"AABBCCDDEEFF", "aa:bb:cc:dd:ee:ff"},
+		{"aA-bB-cC-dD-eE-fF", "aa:bb:cc:dd:ee:ff"},
+		{"0:11:2:33:4:55", "00:11:02:33:04:55"},
+		{" 42:01:0a:80:00:46\n", "42:01:0a:80:00:46"},
+		{"00:11:22:33:44:55:66:77", "00:11:22:33:44:55:66:77"},
+		{"", ""},
+		{"00:11:22:33:44", ""},
+		{"00112233445", ""},
+		{"00:11:22:33:44:5g", ""},
+		{"00::22:33:44:55", ""},
+		{"000:11:22:33:44:55", ""},
+	}
+	for _, tt := range tests {
+		if got := CanonicalMAC(tt.input); got != tt.want {
+			t.Errorf("CanonicalMAC(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMACEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"42:01:0a:80:00:46", "42:01:0a:80:00:46", true},
+		{"42:01:0A:80:00:46", "42:01:0a:80:00:46", true},
+		{"000D3AF806EC", "00:0d:3a:f8:06:ec", true},
+		{"00-0D-3A-F8-06-EC", "0:d:3a:f8:6:ec", true},
+		{"42:01:0a:80:00:46", "42:01:0a:80:00:47", false},
+		{"", "", false},
+		{"invalid", "invalid", false},
+	}
+	for _, tt := range tests {
+		if got := MACEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("MACEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
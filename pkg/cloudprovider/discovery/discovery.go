@@ -60,6 +60,17 @@ func DiscoverCloudProvider(ctx context.Context, webhookURL string) CloudProvider
 	return CloudProviderHintNone
 }
 
+// PollsMetadataServer returns true for the cloud providers whose instance
+// properties are read from a metadata server, which is polled until it answers.
+func PollsMetadataServer(hint CloudProviderHint) bool {
+	switch hint {
+	case CloudProviderHintGCE, CloudProviderHintAWS, CloudProviderHintAzure, CloudProviderHintOKE:
+		return true
+	default:
+		return false
+	}
+}
+
 // GetInstanceProperties initializes and returns the specified cloud provider instance.
 func GetInstanceProperties(ctx context.Context, hint CloudProviderHint, webhookURL string) (cloudprovider.CloudInstance, error) {
 	switch hint {
@@ -0,0 +1,100 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/dranet/pkg/apis"
+	"sigs.k8s.io/dranet/pkg/cloudprovider"
+	"sigs.k8s.io/yaml"
+)
+
+// profileNameRegex matches the names allowed as ConfigMap keys, so the
+// profiles can be mounted from a ConfigMap, one file per profile.
+var profileNameRegex = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// FileProvider implements ProfileProvider with NetworkConfig templates stored
+// in a directory, one file per profile named after it, in JSON or YAML. The
+// files are read on each claim, so the updates of a mounted ConfigMap apply
+// to the next claims without restarting the driver.
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider returns a FileProvider reading the profiles from dir.
+func NewFileProvider(dir string) (*FileProvider, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access the profiles directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("profiles path %s is not a directory", dir)
+	}
+	return &FileProvider{dir: dir}, nil
+}
+
+// GetProfileConfig returns the NetworkConfig of the profile referenced by the
+// config. The profile is stateless, the same config is returned for every
+// device and claim.
+func (p *FileProvider) GetProfileConfig(_ cloudprovider.DeviceIdentifiers, _ types.UID, config *apis.NetworkConfig) (*apis.NetworkConfig, error) {
+	if config == nil || config.Profile == "" {
+		return nil, fmt.Errorf("no profile requested")
+	}
+	return p.loadProfile(config.Profile)
+}
+
+// ReleaseProfileConfig is a no-op, the profiles do not allocate resources.
+func (p *FileProvider) ReleaseProfileConfig(_ cloudprovider.DeviceIdentifiers, _ types.UID, _ *apis.NetworkConfig) error {
+	return nil
+}
+
+// loadProfile reads and validates the NetworkConfig of the profile.
+func (p *FileProvider) loadProfile(name string) (*apis.NetworkConfig, error) {
+	// "." and ".." match the regex but are not valid profile files, and
+	// the ConfigMap volumes have hidden entries like "..data".
+	if !profileNameRegex.MatchString(name) || name[0] == '.' {
+		return nil, fmt.Errorf("invalid profile name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile %q: %w", name, err)
+	}
+	raw, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile %q: %w", name, err)
+	}
+	config, errs := apis.ValidateConfig(&runtime.RawExtension{Raw: raw})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid profile %q: %w", name, errors.Join(errs...))
+	}
+	if config.Profile != "" {
+		return nil, fmt.Errorf("invalid profile %q: profiles can not reference another profile", name)
+	}
+	return config, nil
+}
+
+var _ cloudprovider.ProfileProvider = &FileProvider{}
@@ -0,0 +1,168 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/pkg/apis"
+	"sigs.k8s.io/dranet/pkg/cloudprovider"
+)
+
+const bigTCPProfile = `
+interface:
+  mtu: 9000
+  gsoMaxSize: 196608
+  groMaxSize: 196608
+routes:
+- destination: 10.0.0.0/8
+  gateway: 192.168.1.1
+ethtool:
+  features:
+    tcp-segmentation-offload: true
+`
+
+func newTestProvider(t *testing.T, profiles map[string]string) *FileProvider {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range profiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := NewFileProvider(dir)
+	if err != nil {
+		t.Fatalf("NewFileProvider() error = %v", err)
+	}
+	return p
+}
+
+func TestNewFileProvider(t *testing.T) {
+	if _, err := NewFileProvider(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("NewFileProvider() of a missing directory succeeded, want error")
+	}
+	path := filepath.Join(t.TempDir(), "profile")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileProvider(path); err == nil {
+		t.Errorf("NewFileProvider() of a file succeeded, want error")
+	}
+}
+
+func TestGetProfileConfig(t *testing.T) {
+	p := newTestProvider(t, map[string]string{
+		"big-tcp":      bigTCPProfile,
+		"json":         `{"interface":{"mtu":1500}}`,
+		"invalid":      `{"interface":{"mtu":10}}`,
+		"unknownField": `{"interface":{"foo":1}}`,
+		"nested":       `{"profile":"big-tcp"}`,
+		"malformed":    "interface: [",
+	})
+
+	tests := []struct {
+		name    string
+		profile string
+		want    *apis.NetworkConfig
+		wantErr bool
+	}{
+		{
+			name:    "yaml profile",
+			profile: "big-tcp",
+			want: &apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{
+					MTU:        ptr.To[int32](9000),
+					GSOMaxSize: ptr.To[int32](196608),
+					GROMaxSize: ptr.To[int32](196608),
+				},
+				Routes: []apis.RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1"}},
+				Ethtool: &apis.EthtoolConfig{
+					Features: map[string]bool{"tcp-segmentation-offload": true},
+				},
+			},
+		},
+		{
+			name:    "json profile",
+			profile: "json",
+			want:    &apis.NetworkConfig{Interface: apis.InterfaceConfig{MTU: ptr.To[int32](1500)}},
+		},
+		{name: "not found", profile: "missing", wantErr: true},
+		{name: "no profile", profile: "", wantErr: true},
+		{name: "path traversal", profile: "../big-tcp", wantErr: true},
+		{name: "hidden file", profile: "..data", wantErr: true},
+		{name: "invalid config", profile: "invalid", wantErr: true},
+		{name: "unknown field", profile: "unknownField", wantErr: true},
+		{name: "references another profile", profile: "nested", wantErr: true},
+		{name: "malformed", profile: "malformed", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.GetProfileConfig(cloudprovider.DeviceIdentifiers{Name: "eth1"}, "uid", &apis.NetworkConfig{Profile: tt.profile})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetProfileConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("GetProfileConfig() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestProfileMerge checks that the claim configuration overrides the profile,
+// merged the same way the driver does.
+func TestProfileMerge(t *testing.T) {
+	p := newTestProvider(t, map[string]string{"big-tcp": bigTCPProfile})
+	claimConf := &apis.NetworkConfig{
+		Profile: "big-tcp",
+		Interface: apis.InterfaceConfig{
+			Name: "net1",
+			MTU:  ptr.To[int32](4000),
+		},
+		Routes: []apis.RouteConfig{
+			{Destination: "10.0.0.0/8", Gateway: "192.168.1.254"},
+			{Destination: "172.16.0.0/12", Gateway: "192.168.1.1"},
+		},
+	}
+	profileConf, err := p.GetProfileConfig(cloudprovider.DeviceIdentifiers{Name: "eth1"}, "uid", claimConf)
+	if err != nil {
+		t.Fatalf("GetProfileConfig() error = %v", err)
+	}
+	got := apis.MergeNetworkConfig(claimConf, profileConf)
+	want := &apis.NetworkConfig{
+		Profile: "big-tcp",
+		Interface: apis.InterfaceConfig{
+			Name:       "net1",
+			MTU:        ptr.To[int32](4000),
+			GSOMaxSize: ptr.To[int32](196608),
+			GROMaxSize: ptr.To[int32](196608),
+		},
+		Routes: []apis.RouteConfig{
+			{Destination: "10.0.0.0/8", Gateway: "192.168.1.254"},
+			{Destination: "172.16.0.0/12", Gateway: "192.168.1.1"},
+		},
+		Ethtool: &apis.EthtoolConfig{
+			Features: map[string]bool{"tcp-segmentation-offload": true},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MergeNetworkConfig() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -53,6 +53,7 @@ const (
 	AttrGCENetworkProjectNumber = GCEAttrPrefix + "/" + "networkProjectNumber"
 	AttrGCEIPAliases            = GCEAttrPrefix + "/" + "ipAliases"
 	AttrGCEMachineType          = GCEAttrPrefix + "/" + "machineType"
+	AttrGCEAcceleratorProtocol  = GCEAttrPrefix + "/" + "acceleratorProtocol"
 )
 
 var (
@@ -72,8 +73,20 @@ var (
 	// GPUDirect-TCPX: one VPCs for GPU NICs, one subnet per VPC 8244MTU
 	// GPUDirect-TCPXO: one VPCs for GPU NICs, one subnet per VPC 8244MTU
 	// GPUDirect-RDMA: one HPC VPC, one subnet per NIC, 8896MTU
+	GPUDirectNetworkMap = map[GPUDirectSupport]GPUDirectNetwork{
+		GPUDirectTCPX:  {NICs: 4, MTU: 8244},
+		GPUDirectTCPXO: {NICs: 8, MTU: 8244},
+		GPUDirectRDMA:  {NICs: 8, MTU: 8896},
+	}
 )
 
+// GPUDirectNetwork describes the accelerator networks required by a GPUDirect
+// protocol: the number of accelerator NICs per machine and their MTU.
+type GPUDirectNetwork struct {
+	NICs int
+	MTU  int
+}
+
 // gceNetworkInterface matches the structure expected from GCE metadata.
 type gceNetworkInterface struct {
 	IPv4      string   `json:"ip,omitempty"`
@@ -85,6 +98,7 @@ type gceNetworkInterface struct {
 }
 
 var _ cloudprovider.CloudInstance = (*GCEInstance)(nil)
+var _ cloudprovider.NetworkMTUProvider = (*GCEInstance)(nil)
 
 // GCEInstance holds the GCE specific instance data.
 type GCEInstance struct {
@@ -120,10 +134,12 @@ func (g *GCEInstance) GetDeviceAttributes(id cloudprovider.DeviceIdentifiers) ma
 
 	interfaceForMacFound := false
 	var interfaceForMac gceNetworkInterface
-	for _, cloudInterface := range g.Interfaces {
-		if cloudInterface.Mac == id.MAC {
+	var interfaceIndex int64
+	for i, cloudInterface := range g.Interfaces {
+		if cloudprovider.MACEqual(cloudInterface.Mac, id.MAC) {
 			interfaceForMacFound = true
 			interfaceForMac = cloudInterface
+			interfaceIndex = int64(i)
 			break
 		}
 	}
@@ -144,6 +160,13 @@ func (g *GCEInstance) GetDeviceAttributes(id cloudprovider.DeviceIdentifiers) ma
 		}
 		attributes[AttrGCENetworkName] = resourceapi.DeviceAttribute{StringValue: &name}
 		attributes[AttrGCENetworkProjectNumber] = resourceapi.DeviceAttribute{IntValue: &projectNumber}
+		// The order of the interfaces in the metadata is fixed when the
+		// instance is created, the index is stable and unique per NIC, even
+		// for the NICs sharing a network, e.g. the GPUDirect-RDMA ones.
+		attributes[apis.AttrCloudNetworkIndex] = resourceapi.DeviceAttribute{IntValue: &interfaceIndex}
+		if g.isAcceleratorNetwork(interfaceForMac) {
+			attributes[AttrGCEAcceleratorProtocol] = resourceapi.DeviceAttribute{StringValue: &g.AcceleratorProtocol}
+		}
 	} else {
 		klog.V(4).Infof("No cloud metadata found for device with mac %q; it is possible this device has no associated cloud provider metadata", id.MAC)
 	}
@@ -151,12 +174,35 @@ func (g *GCEInstance) GetDeviceAttributes(id cloudprovider.DeviceIdentifiers) ma
 	return attributes
 }
 
+// isAcceleratorNetwork returns true if the interface is attached to one of the
+// accelerator networks of the GPUDirect protocol of the machine type. The
+// metadata does not tell the accelerator networks apart, they are identified
+// by the MTU the protocol requires, which the primary network does not use.
+func (g *GCEInstance) isAcceleratorNetwork(cloudInterface gceNetworkInterface) bool {
+	network, ok := GPUDirectNetworkMap[GPUDirectSupport(g.AcceleratorProtocol)]
+	return ok && cloudInterface.MTU == network.MTU
+}
+
 // GetDeviceConfig fetches any infrastructure-specific network configuration
 // required by the device. Returning nil means no specific config is needed.
 func (g *GCEInstance) GetDeviceConfig(id cloudprovider.DeviceIdentifiers) *apis.NetworkConfig {
 	return nil
 }
 
+// GetNetworkMTU returns the MTU of the VPC network the device, identified by
+// its MAC, is attached to.
+func (g *GCEInstance) GetNetworkMTU(id cloudprovider.DeviceIdentifiers) (int, bool) {
+	if id.MAC == "" {
+		return 0, false
+	}
+	for _, cloudInterface := range g.Interfaces {
+		if cloudprovider.MACEqual(cloudInterface.Mac, id.MAC) && cloudInterface.MTU > 0 {
+			return cloudInterface.MTU, true
+		}
+	}
+	return 0, false
+}
+
 // GetInstance retrieves GCE instance properties by querying the metadata server.
 func GetInstance(ctx context.Context) (cloudprovider.CloudInstance, error) {
 	var instance *GCEInstance
@@ -17,8 +17,10 @@ limitations under the License.
 package gce
 
 import (
+	"encoding/json"
 	"testing"
 
+	"sigs.k8s.io/dranet/pkg/apis"
 	"sigs.k8s.io/dranet/pkg/cloudprovider"
 
 	"github.com/google/go-cmp/cmp"
@@ -89,12 +91,30 @@ func TestGetDeviceAttributes(t *testing.T) {
 			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
 				AttrGCENetworkName:          {StringValue: ptr.To("test-network")},
 				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(0))},
 				AttrGCEBlock:                {StringValue: ptr.To("block")},
 				AttrGCESubBlock:             {StringValue: ptr.To("subblock")},
 				AttrGCEHost:                 {StringValue: ptr.To("host")},
 				AttrGCEMachineType:          {StringValue: ptr.To("machine-type-a")},
 			},
 		},
+		{
+			name: "GCE provider, MAC found with a different case",
+			mac:  "aa:bb:cc:dd:ee:ff",
+			instance: &GCEInstance{
+				Type: "machine-type-a",
+				Interfaces: []gceNetworkInterface{
+					{Mac: "00:11:22:33:44:55", Network: "projects/12345/networks/test-network"},
+					{Mac: "AA:BB:CC:DD:EE:FF", Network: "projects/67890/networks/other-network"},
+				},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttrGCENetworkName:          {StringValue: ptr.To("other-network")},
+				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(67890))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(1))},
+				AttrGCEMachineType:          {StringValue: ptr.To("machine-type-a")},
+			},
+		},
 		{
 			name: "GCE provider, MAC found, invalid network string for GCE parsing",
 			mac:  "00:11:22:33:44:55",
@@ -120,6 +140,7 @@ func TestGetDeviceAttributes(t *testing.T) {
 			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
 				AttrGCENetworkName:          {StringValue: ptr.To("test-network")},
 				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(0))},
 				AttrGCEMachineType:          {StringValue: ptr.To("machine-type-a")},
 			},
 		},
@@ -139,10 +160,102 @@ func TestGetDeviceAttributes(t *testing.T) {
 			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
 				AttrGCENetworkName:          {StringValue: ptr.To("test-network")},
 				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(0))},
 				AttrGCEIPAliases:            {StringValue: ptr.To("10.0.0.1/24,10.0.0.2/24")},
 				AttrGCEMachineType:          {StringValue: ptr.To("machine-type-a")},
 			},
 		},
+		{
+			name: "GCE provider, MAC found, accelerator network",
+			mac:  "00:11:22:33:44:66",
+			instance: &GCEInstance{
+				Type:                "a3-megagpu-8g",
+				AcceleratorProtocol: string(GPUDirectTCPXO),
+				Interfaces: []gceNetworkInterface{
+					{Mac: "00:11:22:33:44:55", Network: "projects/12345/networks/default", MTU: 1460},
+					{Mac: "00:11:22:33:44:66", Network: "projects/12345/networks/gpu-net-1", MTU: 8244},
+				},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttrGCENetworkName:          {StringValue: ptr.To("gpu-net-1")},
+				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(1))},
+				AttrGCEAcceleratorProtocol:  {StringValue: ptr.To("GPUDirect-TCPXO")},
+				AttrGCEMachineType:          {StringValue: ptr.To("a3-megagpu-8g")},
+			},
+		},
+		{
+			name: "GCE provider, MAC found, primary network of an accelerator machine",
+			mac:  "00:11:22:33:44:55",
+			instance: &GCEInstance{
+				Type:                "a3-megagpu-8g",
+				AcceleratorProtocol: string(GPUDirectTCPXO),
+				Interfaces: []gceNetworkInterface{
+					{Mac: "00:11:22:33:44:55", Network: "projects/12345/networks/default", MTU: 1460},
+					{Mac: "00:11:22:33:44:66", Network: "projects/12345/networks/gpu-net-1", MTU: 8244},
+				},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttrGCENetworkName:          {StringValue: ptr.To("default")},
+				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(0))},
+				AttrGCEMachineType:          {StringValue: ptr.To("a3-megagpu-8g")},
+			},
+		},
+		{
+			name: "GCE provider, MAC found, no accelerator protocol",
+			mac:  "00:11:22:33:44:66",
+			instance: &GCEInstance{
+				Type: "n2-standard-8",
+				Interfaces: []gceNetworkInterface{
+					{Mac: "00:11:22:33:44:66", Network: "projects/12345/networks/jumbo-net", MTU: 8896},
+				},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttrGCENetworkName:          {StringValue: ptr.To("jumbo-net")},
+				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(0))},
+				AttrGCEMachineType:          {StringValue: ptr.To("n2-standard-8")},
+			},
+		},
+		{
+			name: "GCE provider, multi-NIC instance, network index follows the metadata order",
+			mac:  "00:11:22:33:44:88",
+			instance: &GCEInstance{
+				Type: "n2-standard-16",
+				Interfaces: []gceNetworkInterface{
+					{Mac: "00:11:22:33:44:55", Network: "projects/12345/networks/default"},
+					{Mac: "00:11:22:33:44:66", Network: "projects/12345/networks/net-a"},
+					{Mac: "00:11:22:33:44:77", Network: "projects/12345/networks/net-a"},
+					{Mac: "00:11:22:33:44:88", Network: "projects/12345/networks/net-b"},
+				},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttrGCENetworkName:          {StringValue: ptr.To("net-b")},
+				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(3))},
+				AttrGCEMachineType:          {StringValue: ptr.To("n2-standard-16")},
+			},
+		},
+		{
+			name: "GCE provider, multi-NIC instance, interfaces on the same network have distinct indexes",
+			mac:  "00:11:22:33:44:77",
+			instance: &GCEInstance{
+				Type: "n2-standard-16",
+				Interfaces: []gceNetworkInterface{
+					{Mac: "00:11:22:33:44:55", Network: "projects/12345/networks/default"},
+					{Mac: "00:11:22:33:44:66", Network: "projects/12345/networks/net-a"},
+					{Mac: "00:11:22:33:44:77", Network: "projects/12345/networks/net-a"},
+					{Mac: "00:11:22:33:44:88", Network: "projects/12345/networks/net-b"},
+				},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttrGCENetworkName:          {StringValue: ptr.To("net-a")},
+				AttrGCENetworkProjectNumber: {IntValue: ptr.To(int64(12345))},
+				apis.AttrCloudNetworkIndex:  {IntValue: ptr.To(int64(2))},
+				AttrGCEMachineType:          {StringValue: ptr.To("n2-standard-16")},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -154,3 +267,36 @@ func TestGetDeviceAttributes(t *testing.T) {
 		})
 	}
 }
+
+func TestGetNetworkMTU(t *testing.T) {
+	// Trimmed output of the instance/network-interfaces metadata endpoint.
+	const metadata = `[{"gateway":"10.128.0.1","ip":"10.128.0.70","mac":"42:01:0a:80:00:46","mtu":1460,"network":"projects/628944397724/networks/default"},` +
+		`{"gateway":"192.168.1.1","ip":"192.168.1.2","mac":"42:01:c0:a8:01:02","mtu":8244,"network":"projects/628944397724/networks/dra-net-1"},` +
+		`{"gateway":"192.168.2.1","ip":"192.168.2.2","mac":"42:01:c0:a8:02:02","network":"projects/628944397724/networks/dra-net-2"}]`
+	instance := &GCEInstance{}
+	if err := json.Unmarshal([]byte(metadata), &instance.Interfaces); err != nil {
+		t.Fatalf("failed to parse metadata: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mac     string
+		wantMTU int
+		wantOK  bool
+	}{
+		{name: "default network", mac: "42:01:0a:80:00:46", wantMTU: 1460, wantOK: true},
+		{name: "jumbo frames network", mac: "42:01:c0:a8:01:02", wantMTU: 8244, wantOK: true},
+		{name: "MAC with a different format", mac: "42-01-C0-A8-01-02", wantMTU: 8244, wantOK: true},
+		{name: "network without MTU", mac: "42:01:c0:a8:02:02"},
+		{name: "unknown MAC", mac: "00:11:22:33:44:55"},
+		{name: "no MAC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mtu, ok := instance.GetNetworkMTU(cloudprovider.DeviceIdentifiers{MAC: tt.mac})
+			if mtu != tt.wantMTU || ok != tt.wantOK {
+				t.Errorf("GetNetworkMTU() = %d, %v; want %d, %v", mtu, ok, tt.wantMTU, tt.wantOK)
+			}
+		})
+	}
+}
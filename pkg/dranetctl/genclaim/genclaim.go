@@ -0,0 +1,222 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package genclaim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+const (
+	driverName  = "dra.net"
+	requestName = "nic"
+)
+
+// claimOptions are the parameters of the generated manifests.
+type claimOptions struct {
+	device          string
+	claimName       string
+	namespace       string
+	deviceClassName string
+	interfaceName   string
+	addresses       []string
+	mtu             int32
+	dhcp            bool
+}
+
+var options claimOptions
+
+var GenClaimCmd = &cobra.Command{
+	Use:   "gen-claim",
+	Short: "Generate a ResourceClaim for a network device",
+	Long: `Prints a DeviceClass and a ResourceClaim selecting the network device by its
+interface name in the host, the dra.net/ifName attribute, with the network
+configuration of the flags. The configuration is validated as the driver does,
+so the claim is ready to apply, e.g.
+  dranetctl gen-claim --device eth1 --mtu 9000 --address 192.168.10.2/24 | kubectl apply -f -
+No cluster access is needed, the device is not checked to exist.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeClaim(cmd.OutOrStdout(), options)
+	},
+}
+
+func init() {
+	GenClaimCmd.Flags().StringVar(&options.device, "device", "", "The name of the interface in the host, as published in the dra.net/ifName attribute")
+	GenClaimCmd.Flags().StringVar(&options.claimName, "name", "", "The name of the ResourceClaim, defaults to the device name")
+	GenClaimCmd.Flags().StringVar(&options.namespace, "namespace", "", "The namespace of the ResourceClaim, omitted if empty")
+	GenClaimCmd.Flags().StringVar(&options.deviceClassName, "device-class", driverName, "The name of the DeviceClass selecting the dranet devices")
+	GenClaimCmd.Flags().StringVar(&options.interfaceName, "interface-name", "", "The name of the interface in the Pod, defaults to the name in the host")
+	GenClaimCmd.Flags().StringSliceVar(&options.addresses, "address", nil, "An IP address in CIDR format assigned to the interface, can be repeated")
+	GenClaimCmd.Flags().Int32Var(&options.mtu, "mtu", 0, "The MTU of the interface, unchanged if zero")
+	GenClaimCmd.Flags().BoolVar(&options.dhcp, "dhcp", false, "Configure the interface with DHCP, mutually exclusive with --address")
+	_ = GenClaimCmd.MarkFlagRequired("device")
+}
+
+// writeClaim writes the DeviceClass and the ResourceClaim of the options to
+// out as a multi-document YAML.
+func writeClaim(out io.Writer, opts claimOptions) error {
+	objects, err := generateClaim(opts)
+	if err != nil {
+		return err
+	}
+	for i, obj := range objects {
+		data, err := marshalManifest(obj)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(out, "---")
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateClaim returns the DeviceClass and the ResourceClaim of the options.
+// The network configuration is validated with the validation of the driver.
+func generateClaim(opts claimOptions) ([]runtime.Object, error) {
+	if err := validateDeviceName(opts.device); err != nil {
+		return nil, err
+	}
+	claimName := opts.claimName
+	if claimName == "" {
+		claimName = opts.device
+	}
+	if errs := validation.IsDNS1123Subdomain(claimName); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid ResourceClaim name %q, set a valid one with --name: %s", claimName, strings.Join(errs, ", "))
+	}
+	if opts.namespace != "" {
+		if errs := validation.IsDNS1123Label(opts.namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", opts.namespace, strings.Join(errs, ", "))
+		}
+	}
+	if errs := validation.IsDNS1123Subdomain(opts.deviceClassName); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid DeviceClass name %q: %s", opts.deviceClassName, strings.Join(errs, ", "))
+	}
+
+	config := apis.NetworkConfig{
+		Interface: apis.InterfaceConfig{
+			Name:      opts.interfaceName,
+			Addresses: opts.addresses,
+		},
+	}
+	if opts.mtu != 0 {
+		config.Interface.MTU = ptr.To(opts.mtu)
+	}
+	if opts.dhcp {
+		config.Interface.DHCP = ptr.To(true)
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, errs := apis.ValidateConfig(&runtime.RawExtension{Raw: raw}); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid network configuration: %w", errors.Join(errs...))
+	}
+
+	deviceClass := &resourceapi.DeviceClass{
+		TypeMeta:   metav1.TypeMeta{APIVersion: resourceapi.SchemeGroupVersion.String(), Kind: "DeviceClass"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.deviceClassName},
+		Spec: resourceapi.DeviceClassSpec{
+			Selectors: []resourceapi.DeviceSelector{{
+				CEL: &resourceapi.CELDeviceSelector{Expression: fmt.Sprintf("device.driver == %q", driverName)},
+			}},
+		},
+	}
+	claim := &resourceapi.ResourceClaim{
+		TypeMeta:   metav1.TypeMeta{APIVersion: resourceapi.SchemeGroupVersion.String(), Kind: "ResourceClaim"},
+		ObjectMeta: metav1.ObjectMeta{Name: claimName, Namespace: opts.namespace},
+		Spec: resourceapi.ResourceClaimSpec{
+			Devices: resourceapi.DeviceClaim{
+				Requests: []resourceapi.DeviceRequest{{
+					Name: requestName,
+					Exactly: &resourceapi.ExactDeviceRequest{
+						DeviceClassName: opts.deviceClassName,
+						Selectors: []resourceapi.DeviceSelector{{
+							CEL: &resourceapi.CELDeviceSelector{Expression: deviceSelector(opts.device)},
+						}},
+					},
+				}},
+			},
+		},
+	}
+	// A configuration without any field uses the defaults of the driver.
+	if string(raw) != `{"interface":{}}` {
+		claim.Spec.Devices.Config = []resourceapi.DeviceClaimConfiguration{{
+			Requests: []string{requestName},
+			DeviceConfiguration: resourceapi.DeviceConfiguration{
+				Opaque: &resourceapi.OpaqueDeviceConfiguration{
+					Driver:     driverName,
+					Parameters: runtime.RawExtension{Raw: raw},
+				},
+			},
+		}}
+	}
+	return []runtime.Object{deviceClass, claim}, nil
+}
+
+// validateDeviceName returns an error if the name can not be the name of a
+// Linux interface, the same rules as the kernel dev_valid_name().
+func validateDeviceName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("the device name is required")
+	case len(name) > apis.MaxInterfaceNameLen:
+		return fmt.Errorf("invalid device name %q: longer than %d characters", name, apis.MaxInterfaceNameLen)
+	case name == "." || name == "..":
+		return fmt.Errorf("invalid device name %q", name)
+	case strings.ContainsAny(name, "/: \t\n\v\f\r"):
+		return fmt.Errorf("invalid device name %q: contains '/', ':' or whitespace", name)
+	}
+	return nil
+}
+
+// deviceSelector returns the CEL expression matching the device by its
+// interface name in the host.
+func deviceSelector(device string) string {
+	attr := fmt.Sprintf("device.attributes[%q].%s", driverName, strings.TrimPrefix(apis.AttrInterfaceName, apis.AttrPrefix+"/"))
+	return fmt.Sprintf("has(%s) && %s == %s", attr, attr, strconv.Quote(device))
+}
+
+// marshalManifest returns the YAML of the object without the fields set by the
+// API server, the creation timestamp and the status.
+func marshalManifest(obj runtime.Object) ([]byte, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(content, "status")
+	return yaml.Marshal(content)
+}
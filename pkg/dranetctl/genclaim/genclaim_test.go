@@ -0,0 +1,156 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package genclaim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestGenerateClaim(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       claimOptions
+		wantName   string
+		wantConfig *apis.NetworkConfig
+		wantErr    string
+	}{
+		{
+			name:     "static address and mtu",
+			opts:     claimOptions{device: "eth1", deviceClassName: "dra.net", interfaceName: "net1", addresses: []string{"192.168.10.2/24"}, mtu: 9000},
+			wantName: "eth1",
+			wantConfig: &apis.NetworkConfig{Interface: apis.InterfaceConfig{
+				Name:      "net1",
+				Addresses: []string{"192.168.10.2/24"},
+				MTU:       ptr.To[int32](9000),
+			}},
+		},
+		{
+			name:       "dhcp",
+			opts:       claimOptions{device: "ens5", claimName: "storage-nic", deviceClassName: "dra.net", dhcp: true},
+			wantName:   "storage-nic",
+			wantConfig: &apis.NetworkConfig{Interface: apis.InterfaceConfig{DHCP: ptr.To(true)}},
+		},
+		{
+			name:     "no configuration",
+			opts:     claimOptions{device: "eth2", deviceClassName: "dra.net"},
+			wantName: "eth2",
+		},
+		{
+			name:    "dhcp and addresses",
+			opts:    claimOptions{device: "eth1", deviceClassName: "dra.net", dhcp: true, addresses: []string{"192.168.10.2/24"}},
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "invalid address",
+			opts:    claimOptions{device: "eth1", deviceClassName: "dra.net", addresses: []string{"192.168.10.2"}},
+			wantErr: "invalid IP CIDR",
+		},
+		{
+			name:    "invalid mtu",
+			opts:    claimOptions{device: "eth1", deviceClassName: "dra.net", mtu: -1},
+			wantErr: "mtu",
+		},
+		{
+			name:    "missing device",
+			opts:    claimOptions{deviceClassName: "dra.net"},
+			wantErr: "device name is required",
+		},
+		{
+			name:    "invalid device",
+			opts:    claimOptions{device: "eth1/2", deviceClassName: "dra.net"},
+			wantErr: "invalid device name",
+		},
+		{
+			name:    "device name not a valid claim name",
+			opts:    claimOptions{device: "eth_1", deviceClassName: "dra.net"},
+			wantErr: "--name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeClaim(&out, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("writeClaim() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeClaim() failed: %v", err)
+			}
+
+			documents := strings.Split(out.String(), "\n---\n")
+			if len(documents) != 2 {
+				t.Fatalf("writeClaim() wrote %d documents, want 2:\n%s", len(documents), out.String())
+			}
+			var deviceClass resourceapi.DeviceClass
+			if err := yaml.UnmarshalStrict([]byte(documents[0]), &deviceClass); err != nil {
+				t.Fatalf("failed to decode the DeviceClass: %v", err)
+			}
+			if deviceClass.Kind != "DeviceClass" || deviceClass.Name != tt.opts.deviceClassName {
+				t.Errorf("DeviceClass = %s %s, want DeviceClass %s", deviceClass.Kind, deviceClass.Name, tt.opts.deviceClassName)
+			}
+			var claim resourceapi.ResourceClaim
+			if err := yaml.UnmarshalStrict([]byte(documents[1]), &claim); err != nil {
+				t.Fatalf("failed to decode the ResourceClaim: %v", err)
+			}
+			if claim.Kind != "ResourceClaim" || claim.Name != tt.wantName {
+				t.Errorf("ResourceClaim = %s %s, want ResourceClaim %s", claim.Kind, claim.Name, tt.wantName)
+			}
+			requests := claim.Spec.Devices.Requests
+			if len(requests) != 1 || requests[0].Exactly == nil || len(requests[0].Exactly.Selectors) != 1 {
+				t.Fatalf("unexpected requests: %+v", requests)
+			}
+			wantSelector := `has(device.attributes["dra.net"].ifName) && device.attributes["dra.net"].ifName == "` + tt.opts.device + `"`
+			if got := requests[0].Exactly.Selectors[0].CEL.Expression; got != wantSelector {
+				t.Errorf("selector = %s, want %s", got, wantSelector)
+			}
+
+			if tt.wantConfig == nil {
+				if len(claim.Spec.Devices.Config) != 0 {
+					t.Errorf("unexpected configuration: %+v", claim.Spec.Devices.Config)
+				}
+				return
+			}
+			if len(claim.Spec.Devices.Config) != 1 || claim.Spec.Devices.Config[0].Opaque == nil {
+				t.Fatalf("unexpected configuration: %+v", claim.Spec.Devices.Config)
+			}
+			opaque := claim.Spec.Devices.Config[0].Opaque
+			if opaque.Driver != "dra.net" {
+				t.Errorf("opaque driver = %s, want dra.net", opaque.Driver)
+			}
+			config, errs := apis.ValidateConfig(&opaque.Parameters)
+			if len(errs) > 0 {
+				t.Fatalf("generated configuration is invalid: %v", errs)
+			}
+			tt.wantConfig.Default()
+			if diff := cmp.Diff(tt.wantConfig, config); diff != "" {
+				t.Errorf("configuration mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
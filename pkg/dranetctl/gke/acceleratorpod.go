@@ -42,6 +42,7 @@ func init() {
 	acceleratorpodCmd.AddCommand(acceleratorpodGetCmd)
 	acceleratorpodCmd.AddCommand(acceleratorpodDeleteCmd)
 	acceleratorpodCmd.AddCommand(acceleratorpodListCmd)
+	acceleratorpodCmd.AddCommand(acceleratorpodPreflightCmd)
 }
 
 var (
@@ -133,12 +134,10 @@ network-aware placement. This group of machines is referred to as an accelerator
 		var additionalNetworkConfigs []*containerpb.AdditionalNodeNetworkConfig
 		var err error
 		switch protocol {
-		case gce.GPUDirectTCPX:
-			additionalNetworkConfigs, err = createAcceleratorNetworks(ctx, acceleratorpodName, 4)
-		case gce.GPUDirectTCPXO:
-			additionalNetworkConfigs, err = createAcceleratorNetworks(ctx, acceleratorpodName, 8)
+		case gce.GPUDirectTCPX, gce.GPUDirectTCPXO:
+			additionalNetworkConfigs, err = createAcceleratorNetworks(ctx, acceleratorpodName, gce.GPUDirectNetworkMap[protocol].NICs)
 		case gce.GPUDirectRDMA:
-			additionalNetworkConfigs, err = createHPCAcceleratorNetwork(ctx, acceleratorpodName, 8) //
+			additionalNetworkConfigs, err = createHPCAcceleratorNetwork(ctx, acceleratorpodName, gce.GPUDirectNetworkMap[protocol].NICs)
 		default:
 			additionalNetworkConfigs, err = createAcceleratorNetworks(ctx, acceleratorpodName, additionalNetworkInterfaces)
 		}
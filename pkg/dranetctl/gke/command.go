@@ -32,6 +32,7 @@ var (
 	NetworksClient    *compute.NetworksClient         // handle GCE Networks
 	SubnetworksClient *compute.SubnetworksClient      // handle GCE Subnets
 	FirewallsClient   *compute.FirewallsClient        // handle GCE Firewalls
+	InstancesClient   *compute.InstancesClient        // handle GCE Instances
 
 	projectID   string
 	location    string
@@ -42,6 +43,7 @@ var (
 func init() {
 	GkeCmd.AddCommand(acceleratorpodCmd)
 	GkeCmd.AddCommand(networksCmd)
+	GkeCmd.AddCommand(machineTypesCmd)
 
 	GkeCmd.PersistentFlags().String("auth-file", "", "Path to the Google Cloud service account JSON file")
 	GkeCmd.PersistentFlags().StringVar(&projectID, "project", "", "Google Cloud Project ID")
@@ -98,6 +100,12 @@ var GkeCmd = &cobra.Command{
 		}
 		FirewallsClient = firewallsClient
 
+		instancesClient, err := compute.NewInstancesRESTClient(ctx, opts...)
+		if err != nil {
+			return fmt.Errorf("NewInstancesClient: %w", err)
+		}
+		InstancesClient = instancesClient
+
 		return nil
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
@@ -113,5 +121,8 @@ var GkeCmd = &cobra.Command{
 		if FirewallsClient != nil {
 			FirewallsClient.Close()
 		}
+		if InstancesClient != nil {
+			InstancesClient.Close()
+		}
 	},
 }
@@ -164,12 +164,18 @@ spec:
           httpGet:
             path: /healthz
             port: 9177
-          failureThreshold: 12
+          failureThreshold: 60
           periodSeconds: 5
         readinessProbe:
           httpGet:
             path: /healthz
             port: 9177
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 9177
+          failureThreshold: 3
+          periodSeconds: 10
         volumeMounts:
         - name: device-plugin
           mountPath: /var/lib/kubelet/plugins
@@ -0,0 +1,73 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/dranet/pkg/cloudprovider/gce"
+)
+
+var filterMachineType string
+
+var machineTypesCmd = &cobra.Command{
+	Use:   "machine-types",
+	Short: "List the GPUDirect network protocol of the accelerator machine types",
+	Long: `Lists the machine types with GPUDirect support, the network protocol they use
+and the number and MTU of the accelerator NICs they require.
+The information is static and does not require Google Cloud credentials.`,
+	// Overrides the gke PersistentPreRunE, no clients are needed.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printMachineTypes(cmd.OutOrStdout(), filterMachineType)
+	},
+}
+
+func init() {
+	machineTypesCmd.Flags().StringVar(&filterMachineType, "machine-type", "", "Only show the specified machine type")
+}
+
+// printMachineTypes writes a table with the GPUDirect support of the machine
+// types, or only of machineType if not empty.
+func printMachineTypes(out io.Writer, machineType string) error {
+	machineTypes := make([]string, 0, len(gce.NetworkProtocolMap))
+	for name := range gce.NetworkProtocolMap {
+		if machineType != "" && name != machineType {
+			continue
+		}
+		machineTypes = append(machineTypes, name)
+	}
+	if len(machineTypes) == 0 {
+		return fmt.Errorf("machine type %q has no GPUDirect support", machineType)
+	}
+	sort.Strings(machineTypes)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "MACHINE TYPE\tPROTOCOL\tNICS\tMTU")
+	for _, name := range machineTypes {
+		protocol := gce.NetworkProtocolMap[name]
+		network := gce.GPUDirectNetworkMap[protocol]
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", name, protocol, network.NICs, network.MTU)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,70 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_printMachineTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		machineType string
+		wantLines   int
+		wantContain []string
+		wantErr     bool
+	}{
+		{
+			name:        "all",
+			wantLines:   9,
+			wantContain: []string{"a3-highgpu-8g", "GPUDirect-TCPX", "a4-highgpu-8g", "8896"},
+		},
+		{
+			name:        "filter",
+			machineType: "a3-megagpu-8g",
+			wantLines:   2,
+			wantContain: []string{"a3-megagpu-8g   GPUDirect-TCPXO   8      8244"},
+		},
+		{
+			name:        "unknown",
+			machineType: "n2-standard-8",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := printMachineTypes(&out, tt.machineType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("printMachineTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if lines := strings.Count(out.String(), "\n"); lines != tt.wantLines {
+				t.Errorf("printMachineTypes() printed %d lines, want %d:\n%s", lines, tt.wantLines, out.String())
+			}
+			for _, s := range tt.wantContain {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("printMachineTypes() output does not contain %q:\n%s", s, out.String())
+				}
+			}
+		})
+	}
+}
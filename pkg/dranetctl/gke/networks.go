@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -43,6 +44,10 @@ var (
 	// extract region and subnet name from URL
 	reSubnets              = regexp.MustCompile(`/regions/([^/]+)/subnetworks/([^/]+)$`)
 	acceleratorPodNameFlag string
+
+	// errNetworkInUse is returned when a network is not deleted because
+	// instances are still attached to it.
+	errNetworkInUse = errors.New("network in use")
 )
 
 // getRegion get the region part from a location
@@ -133,34 +138,9 @@ func createHPCAcceleratorNetwork(ctx context.Context, acceleratorpodName string,
 
 	additionalNetworkConfigs := make([]*containerpb.AdditionalNodeNetworkConfig, 0, networkInterfaces)
 
-	client, err := compute.NewNetworkProfilesRESTClient(ctx)
+	networkProfile, err := findRDMANetworkProfile(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("can not create NewNetworkProfilesRESTClient client: %v", err)
-	}
-	defer client.Close()
-
-	req := &computepb.ListNetworkProfilesRequest{
-		Filter:  ptr.To(fmt.Sprintf("location.name=%s", location)),
-		Project: projectID,
-	}
-	var networkProfile string
-	it := client.List(ctx, req)
-	for {
-		resp, err := it.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("can not iterate Network Profiles: %v", err)
-		}
-		for _, ifType := range resp.GetFeatures().InterfaceTypes {
-			if ifType == "MRDMA" {
-				networkProfile = resp.GetSelfLink()
-			}
-		}
-	}
-	if networkProfile == "" {
-		return nil, fmt.Errorf("could not find Network Profile")
+		return nil, err
 	}
 	klog.V(2).Infof("Successfully obtained RDMA network profile %s", networkProfile)
 	// Create Network
@@ -218,6 +198,41 @@ func createHPCAcceleratorNetwork(ctx context.Context, acceleratorpodName string,
 	return additionalNetworkConfigs, nil
 }
 
+// findRDMANetworkProfile returns the self link of the network profile of the
+// location that supports the MRDMA interfaces.
+func findRDMANetworkProfile(ctx context.Context) (string, error) {
+	client, err := compute.NewNetworkProfilesRESTClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("can not create NewNetworkProfilesRESTClient client: %v", err)
+	}
+	defer client.Close()
+
+	req := &computepb.ListNetworkProfilesRequest{
+		Filter:  ptr.To(fmt.Sprintf("location.name=%s", location)),
+		Project: projectID,
+	}
+	var networkProfile string
+	it := client.List(ctx, req)
+	for {
+		resp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("can not iterate Network Profiles: %v", err)
+		}
+		for _, ifType := range resp.GetFeatures().InterfaceTypes {
+			if ifType == "MRDMA" {
+				networkProfile = resp.GetSelfLink()
+			}
+		}
+	}
+	if networkProfile == "" {
+		return "", fmt.Errorf("could not find Network Profile")
+	}
+	return networkProfile, nil
+}
+
 func deleteNetwork(ctx context.Context, networkName string) error {
 	reqNet := &computepb.GetNetworkRequest{
 		Project: projectID,
@@ -230,6 +245,16 @@ func deleteNetwork(ctx context.Context, networkName string) error {
 		return fmt.Errorf("getting network '%s': %w", networkName, err)
 	}
 
+	// Deleting a network with attached instances, e.g. the nodes of a live
+	// accelerator pod, breaks their networking.
+	instances, err := instancesUsingNetwork(ctx, network)
+	if err != nil {
+		return fmt.Errorf("getting instances attached to network %s: %w", networkName, err)
+	}
+	if len(instances) > 0 {
+		return fmt.Errorf("%w: network %s has instances attached: %s", errNetworkInUse, networkName, strings.Join(instances, ", "))
+	}
+
 	klog.V(2).InfoS("get firewalls associated", "network", network)
 	reqFw := &computepb.GetEffectiveFirewallsNetworkRequest{
 		Project: projectID,
@@ -311,6 +336,49 @@ func deleteNetwork(ctx context.Context, networkName string) error {
 	return nil
 }
 
+// instancesUsingNetwork returns the instances with a network interface in the
+// network or one of its subnets.
+func instancesUsingNetwork(ctx context.Context, network *computepb.Network) ([]string, error) {
+	attached := map[string]bool{}
+	for _, resourceURL := range append([]string{network.GetSelfLink()}, network.GetSubnetworks()...) {
+		if resourceURL != "" {
+			attached[resourcePath(resourceURL)] = true
+		}
+	}
+
+	var instances []string
+	it := InstancesClient.AggregatedList(ctx, &computepb.AggregatedListInstancesRequest{
+		Project: projectID,
+	})
+	for {
+		pair, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range pair.Value.GetInstances() {
+			for _, nic := range instance.GetNetworkInterfaces() {
+				if attached[resourcePath(nic.GetNetwork())] || attached[resourcePath(nic.GetSubnetwork())] {
+					instances = append(instances, instance.GetName())
+					break
+				}
+			}
+		}
+	}
+	return instances, nil
+}
+
+// resourcePath returns the path of a resource URL starting with "projects/",
+// so the URLs of the different API versions and the partial URLs match.
+func resourcePath(resourceURL string) string {
+	if i := strings.Index(resourceURL, "projects/"); i >= 0 {
+		return resourceURL[i:]
+	}
+	return resourceURL
+}
+
 // listNetworks list all dranet networks
 func listNetworks(ctx context.Context, acceleratorPodName string) []string {
 	output := []string{}
@@ -375,7 +443,9 @@ Use with caution, as this action is irreversible.`,
 		for _, network := range networks {
 			klog.Infof("deleting network %s\n", network)
 			err := deleteNetwork(ctx, network)
-			if err != nil {
+			if errors.Is(err, errNetworkInUse) {
+				klog.Infof("Skipping network %s still in use: %v", network, err)
+			} else if err != nil {
 				klog.Infof("Failed to delete network %s: %v", network, err)
 			}
 		}
@@ -16,7 +16,18 @@ limitations under the License.
 
 package gke
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"google.golang.org/api/option"
+)
 
 func Test_getRegion(t *testing.T) {
 	tests := []struct {
@@ -43,3 +54,91 @@ func Test_getRegion(t *testing.T) {
 		})
 	}
 }
+
+func Test_deleteNetworkInUse(t *testing.T) {
+	const (
+		networkURL = "https://www.googleapis.com/compute/v1/projects/test-project/global/networks/dranetctl-net-1"
+		subnetURL  = "https://www.googleapis.com/compute/v1/projects/test-project/regions/us-central1/subnetworks/dranetctl-subnet-1"
+	)
+	tests := []struct {
+		name      string
+		instances string
+		wantErr   error
+	}{
+		{
+			name:      "instance attached to the subnet",
+			instances: `{"items":{"zones/us-central1-a":{"instances":[{"name":"node-1","networkInterfaces":[{"subnetwork":"https://compute.googleapis.com/compute/beta/projects/test-project/regions/us-central1/subnetworks/dranetctl-subnet-1"}]}]}}}`,
+			wantErr:   errNetworkInUse,
+		},
+		{
+			name:      "instance attached to the network",
+			instances: `{"items":{"zones/us-central1-b":{"instances":[{"name":"node-2","networkInterfaces":[{"network":"projects/test-project/global/networks/dranetctl-net-1"}]}]}}}`,
+			wantErr:   errNetworkInUse,
+		},
+		{
+			name:      "instances attached to other networks",
+			instances: `{"items":{"zones/us-central1-a":{"instances":[{"name":"node-3","networkInterfaces":[{"network":"projects/test-project/global/networks/default","subnetwork":"projects/test-project/regions/us-central1/subnetworks/default"}]}]},"zones/us-central1-b":{"warning":{"code":"NO_RESULTS_ON_PAGE"}}}}`,
+		},
+		{
+			name:      "no instances",
+			instances: `{"items":{}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var deletes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodDelete {
+					mu.Lock()
+					deletes = append(deletes, r.URL.Path)
+					mu.Unlock()
+					http.Error(w, "unexpected delete", http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/compute/v1/projects/test-project/global/networks/dranetctl-net-1":
+					fmt.Fprintf(w, `{"name":"dranetctl-net-1","selfLink":%q,"subnetworks":[%q]}`, networkURL, subnetURL)
+				case "/compute/v1/projects/test-project/aggregated/instances":
+					fmt.Fprint(w, tt.instances)
+				case "/compute/v1/projects/test-project/global/networks/dranetctl-net-1/getEffectiveFirewalls":
+					fmt.Fprint(w, `{"firewalls":[{"name":"dranetctl-fw-1"}]}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			ctx := context.Background()
+			opts := []option.ClientOption{option.WithEndpoint(server.URL), option.WithoutAuthentication()}
+			networksClient, err := compute.NewNetworksRESTClient(ctx, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer networksClient.Close()
+			instancesClient, err := compute.NewInstancesRESTClient(ctx, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer instancesClient.Close()
+
+			origNetworks, origInstances, origProject, origDryRun := NetworksClient, InstancesClient, projectID, dryRun
+			defer func() {
+				NetworksClient, InstancesClient, projectID, dryRun = origNetworks, origInstances, origProject, origDryRun
+			}()
+			NetworksClient, InstancesClient, projectID, dryRun = networksClient, instancesClient, "test-project", true
+
+			err = deleteNetwork(ctx, "dranetctl-net-1")
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("deleteNetwork() error = %v", err)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("deleteNetwork() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(deletes) > 0 {
+				t.Errorf("deleteNetwork() deleted resources %v", deletes)
+			}
+		})
+	}
+}
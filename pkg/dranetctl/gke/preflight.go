@@ -0,0 +1,178 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/dranet/pkg/cloudprovider/gce"
+)
+
+// preflightCheck is the result of one of the accelerator pod prerequisites.
+type preflightCheck struct {
+	name    string
+	passed  bool
+	details string
+}
+
+// acceleratorpodPreflightCmd represents the preflight subcommand for acceleratorpod
+var acceleratorpodPreflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check the prerequisites to create an accelerator pod",
+	Long: `Checks that an accelerator pod can be created with the machine type in the
+location before creating any resource: the machine type has GPUDirect support
+or additional network interfaces are requested, the RDMA network profile
+exists for the RDMA machine types and the project has quota for the networks
+and subnetworks to create. Nothing is created.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if location == "-" {
+			return fmt.Errorf("location for accelerator pod not specified")
+		}
+
+		checks := []preflightCheck{checkLocation(location)}
+		networks, subnetworks, check := checkMachineType(machineType, additionalNetworkInterfaces)
+		checks = append(checks, check)
+		if gce.NetworkProtocolMap[machineType] == gce.GPUDirectRDMA {
+			check := preflightCheck{name: "RDMA network profile"}
+			if networkProfile, err := findRDMANetworkProfile(ctx); err != nil {
+				check.details = fmt.Sprintf("no MRDMA network profile in %s: %v", location, err)
+			} else {
+				check.passed = true
+				check.details = networkProfile
+			}
+			checks = append(checks, check)
+		}
+		if networks > 0 || subnetworks > 0 {
+			quotas, err := projectQuotas(ctx)
+			if err != nil {
+				checks = append(checks, preflightCheck{name: "quota", details: err.Error()})
+			} else {
+				checks = append(checks,
+					checkQuota(quotas, computepb.Quota_NETWORKS.String(), networks),
+					checkQuota(quotas, computepb.Quota_SUBNETWORKS.String(), subnetworks),
+				)
+			}
+		}
+
+		if !printPreflightReport(cmd.OutOrStdout(), checks) {
+			return fmt.Errorf("accelerator pod preflight checks failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	acceleratorpodPreflightCmd.Flags().StringVar(&machineType, "machine-type", "", "The Google Compute Engine machine type for the nodes (required)")
+	acceleratorpodPreflightCmd.Flags().IntVar(&additionalNetworkInterfaces, "additional-network-interfaces", 0, "The number of additional network interfaces for each node (optional)")
+	_ = acceleratorpodPreflightCmd.MarkFlagRequired("machine-type")
+}
+
+// checkLocation checks the location is a zone, only zonal node pools are
+// created.
+func checkLocation(location string) preflightCheck {
+	check := preflightCheck{name: "location", details: location}
+	if len(strings.Split(location, "-")) == 3 {
+		check.passed = true
+	} else {
+		check.details = fmt.Sprintf("%s is not a zone, only zonal node pools are allowed", location)
+	}
+	return check
+}
+
+// checkMachineType checks dranet can be used with the machine type and
+// returns the number of networks and subnetworks the accelerator pod creates.
+func checkMachineType(machineType string, additionalNetworkInterfaces int) (networks, subnetworks int, check preflightCheck) {
+	check = preflightCheck{name: "machine type"}
+	protocol, ok := gce.NetworkProtocolMap[machineType]
+	switch {
+	case !ok && additionalNetworkInterfaces == 0:
+		check.details = fmt.Sprintf("%s has no GPUDirect support, --additional-network-interfaces is required", machineType)
+		return 0, 0, check
+	case !ok:
+		networks, subnetworks = additionalNetworkInterfaces, additionalNetworkInterfaces
+		check.details = fmt.Sprintf("%s with %d additional network interfaces", machineType, additionalNetworkInterfaces)
+	case protocol == gce.GPUDirectRDMA:
+		// all the subnetworks belong to a single RDMA network
+		networks, subnetworks = 1, gce.GPUDirectNetworkMap[protocol].NICs
+		check.details = fmt.Sprintf("%s uses %s with %d NICs", machineType, protocol, subnetworks)
+	default:
+		networks, subnetworks = gce.GPUDirectNetworkMap[protocol].NICs, gce.GPUDirectNetworkMap[protocol].NICs
+		check.details = fmt.Sprintf("%s uses %s with %d NICs", machineType, protocol, subnetworks)
+	}
+	check.passed = true
+	return networks, subnetworks, check
+}
+
+// projectQuotas returns the quotas of the project.
+func projectQuotas(ctx context.Context) ([]*computepb.Quota, error) {
+	client, err := compute.NewProjectsRESTClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can not create NewProjectsRESTClient client: %v", err)
+	}
+	defer client.Close()
+
+	project, err := client.Get(ctx, &computepb.GetProjectRequest{Project: projectID})
+	if err != nil {
+		return nil, fmt.Errorf("can not get project %s: %v", projectID, err)
+	}
+	return project.GetQuotas(), nil
+}
+
+// checkQuota checks the quota of the metric has room for the needed resources.
+func checkQuota(quotas []*computepb.Quota, metric string, needed int) preflightCheck {
+	check := preflightCheck{name: metric + " quota"}
+	for _, quota := range quotas {
+		if quota.GetMetric() != metric {
+			continue
+		}
+		available := quota.GetLimit() - quota.GetUsage()
+		check.passed = available >= float64(needed)
+		check.details = fmt.Sprintf("need %d, available %.0f (usage %.0f of %.0f)", needed, available, quota.GetUsage(), quota.GetLimit())
+		return check
+	}
+	// a missing quota has no limit
+	check.passed = true
+	check.details = fmt.Sprintf("need %d, no quota reported", needed)
+	return check
+}
+
+// printPreflightReport writes a table with the result of the checks and
+// returns true if all of them passed.
+func printPreflightReport(out io.Writer, checks []preflightCheck) bool {
+	passed := true
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAILS")
+	for _, check := range checks {
+		result := "PASS"
+		if !check.passed {
+			result = "FAIL"
+			passed = false
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.name, result, check.details)
+	}
+	_ = w.Flush()
+	return passed
+}
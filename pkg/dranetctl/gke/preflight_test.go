@@ -0,0 +1,118 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"k8s.io/utils/ptr"
+)
+
+func Test_checkMachineType(t *testing.T) {
+	tests := []struct {
+		name            string
+		machineType     string
+		additional      int
+		wantNetworks    int
+		wantSubnetworks int
+		wantPassed      bool
+	}{
+		{
+			name:            "tcpxo",
+			machineType:     "a3-megagpu-8g",
+			wantNetworks:    8,
+			wantSubnetworks: 8,
+			wantPassed:      true,
+		},
+		{
+			name:            "rdma uses a single network",
+			machineType:     "a4-highgpu-8g",
+			wantNetworks:    1,
+			wantSubnetworks: 8,
+			wantPassed:      true,
+		},
+		{
+			name:            "additional network interfaces",
+			machineType:     "n2-standard-8",
+			additional:      2,
+			wantNetworks:    2,
+			wantSubnetworks: 2,
+			wantPassed:      true,
+		},
+		{
+			name:        "no GPUDirect support",
+			machineType: "n2-standard-8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, subnetworks, check := checkMachineType(tt.machineType, tt.additional)
+			if networks != tt.wantNetworks || subnetworks != tt.wantSubnetworks {
+				t.Errorf("checkMachineType() = %d networks %d subnetworks, want %d and %d", networks, subnetworks, tt.wantNetworks, tt.wantSubnetworks)
+			}
+			if check.passed != tt.wantPassed {
+				t.Errorf("checkMachineType() passed = %v, want %v: %s", check.passed, tt.wantPassed, check.details)
+			}
+		})
+	}
+}
+
+func Test_checkQuota(t *testing.T) {
+	quotas := []*computepb.Quota{
+		{Metric: ptr.To("NETWORKS"), Limit: ptr.To(15.0), Usage: ptr.To(10.0)},
+		{Metric: ptr.To("SUBNETWORKS"), Limit: ptr.To(100.0), Usage: ptr.To(20.0)},
+	}
+	tests := []struct {
+		name       string
+		metric     string
+		needed     int
+		wantPassed bool
+	}{
+		{name: "enough quota", metric: "SUBNETWORKS", needed: 8, wantPassed: true},
+		{name: "exact quota", metric: "NETWORKS", needed: 5, wantPassed: true},
+		{name: "not enough quota", metric: "NETWORKS", needed: 8},
+		{name: "quota not reported", metric: "FIREWALLS", needed: 8, wantPassed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if check := checkQuota(quotas, tt.metric, tt.needed); check.passed != tt.wantPassed {
+				t.Errorf("checkQuota() passed = %v, want %v: %s", check.passed, tt.wantPassed, check.details)
+			}
+		})
+	}
+}
+
+func Test_printPreflightReport(t *testing.T) {
+	var out bytes.Buffer
+	if !printPreflightReport(&out, []preflightCheck{checkLocation("us-central1-a")}) {
+		t.Errorf("printPreflightReport() = false, want true:\n%s", out.String())
+	}
+
+	out.Reset()
+	checks := []preflightCheck{checkLocation("us-central1"), {name: "machine type", passed: true}}
+	if printPreflightReport(&out, checks) {
+		t.Errorf("printPreflightReport() = true, want false:\n%s", out.String())
+	}
+	for _, s := range []string{"CHECK", "location       FAIL", "machine type   PASS"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("printPreflightReport() output does not contain %q:\n%s", s, out.String())
+		}
+	}
+}
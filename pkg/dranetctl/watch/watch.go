@@ -0,0 +1,166 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	resourceapi "k8s.io/api/resource/v1"
+	"sigs.k8s.io/dranet/pkg/apis"
+	"sigs.k8s.io/dranet/pkg/inventory"
+)
+
+var (
+	exposeUplink      bool
+	excludeBondSlaves bool
+	moveIBInterfaces  bool
+	pollInterval      time.Duration
+)
+
+var WatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream the changes of the network devices discovered on the local host",
+	Long: `Runs the dranet device discovery on the local host and prints the devices
+added, removed or whose attributes changed, as they happen. The discovery is
+triggered by the same netlink link updates the driver uses, so it helps to debug
+why a device appears or disappears from the ResourceSlices.
+The devices are printed before the driver --filter expression is applied, no
+cluster or cloud credentials are needed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return watchDevices(cmd.Context(), cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	WatchCmd.Flags().BoolVar(&exposeUplink, "expose-uplink", false, "Include the interfaces carrying the default route and their children")
+	WatchCmd.Flags().BoolVar(&excludeBondSlaves, "exclude-bond-slaves", true, "Exclude the interfaces enslaved to a bond")
+	WatchCmd.Flags().BoolVar(&moveIBInterfaces, "move-ib-interfaces", true, "Associate the IPoIB interfaces with their PCI devices")
+	WatchCmd.Flags().DurationVar(&pollInterval, "poll-interval", time.Minute, "The maximum interval between two discoveries without netlink updates")
+}
+
+// watchDevices runs the inventory until the context is canceled and writes
+// the device changes between consecutive discoveries to out.
+func watchDevices(ctx context.Context, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	db := inventory.New(
+		inventory.WithMaxPollInterval(pollInterval),
+		inventory.WithMoveIBInterfaces(moveIBInterfaces),
+		inventory.WithExposeUplink(exposeUplink),
+		inventory.WithExcludeBondSlaves(excludeBondSlaves),
+	)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- db.Run(ctx)
+	}()
+
+	previous := map[string]resourceapi.Device{}
+	for devices := range db.GetResources(ctx) {
+		current := make(map[string]resourceapi.Device, len(devices))
+		for _, device := range devices {
+			current[device.Name] = device
+		}
+		now := time.Now().Format(time.TimeOnly)
+		for _, change := range diffDevices(previous, current) {
+			fmt.Fprintf(out, "%s %s\n", now, change)
+		}
+		previous = current
+	}
+	// The inventory closes the channel once it stops.
+	if err := <-errCh; err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// diffDevices returns the devices added, removed and the attributes changed
+// between two discoveries, sorted by device name.
+func diffDevices(previous, current map[string]resourceapi.Device) []string {
+	var changes []string
+	for _, name := range slices.Sorted(maps.Keys(previous)) {
+		if _, ok := current[name]; !ok {
+			changes = append(changes, fmt.Sprintf("REMOVED %s", name))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		device := current[name]
+		old, ok := previous[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("ADDED   %s %s", name, deviceSummary(device)))
+			continue
+		}
+		for _, key := range attributeNames(old.Attributes, device.Attributes) {
+			before, after := formatAttribute(old.Attributes, key), formatAttribute(device.Attributes, key)
+			if before != after {
+				changes = append(changes, fmt.Sprintf("CHANGED %s %s: %s -> %s", name, key, before, after))
+			}
+		}
+	}
+	return changes
+}
+
+// attributeNames returns the sorted names of the attributes of both sets.
+func attributeNames(a, b map[resourceapi.QualifiedName]resourceapi.DeviceAttribute) []resourceapi.QualifiedName {
+	names := make(map[resourceapi.QualifiedName]struct{}, len(a)+len(b))
+	for name := range a {
+		names[name] = struct{}{}
+	}
+	for name := range b {
+		names[name] = struct{}{}
+	}
+	return slices.Sorted(maps.Keys(names))
+}
+
+// deviceSummary returns the attributes identifying a device, e.g.
+// "ifName=eth1 pciAddress=0000:8e:00.0".
+func deviceSummary(device resourceapi.Device) string {
+	var fields []string
+	for _, key := range []resourceapi.QualifiedName{apis.AttrInterfaceName, apis.AttrPCIAddress, apis.AttrRDMADevice} {
+		if _, ok := device.Attributes[key]; ok {
+			fields = append(fields, fmt.Sprintf("%s=%s", strings.TrimPrefix(string(key), apis.AttrPrefix+"/"), formatAttribute(device.Attributes, key)))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// formatAttribute returns the value of an attribute, or "<none>" if it is not set.
+func formatAttribute(attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, name resourceapi.QualifiedName) string {
+	attr, ok := attributes[name]
+	if !ok {
+		return "<none>"
+	}
+	switch {
+	case attr.StringValue != nil:
+		return fmt.Sprintf("%q", *attr.StringValue)
+	case attr.IntValue != nil:
+		return fmt.Sprintf("%d", *attr.IntValue)
+	case attr.BoolValue != nil:
+		return fmt.Sprintf("%t", *attr.BoolValue)
+	case attr.VersionValue != nil:
+		return *attr.VersionValue
+	}
+	return "<none>"
+}
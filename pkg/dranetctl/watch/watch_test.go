@@ -0,0 +1,119 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watch
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestDiffDevices(t *testing.T) {
+	eth1 := resourceapi.Device{
+		Name: "pci-0000-8e-00-0",
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			apis.AttrInterfaceName: {StringValue: ptr.To("eth1")},
+			apis.AttrPCIAddress:    {StringValue: ptr.To("0000:8e:00.0")},
+			apis.AttrState:         {StringValue: ptr.To("down")},
+			apis.AttrMTU:           {IntValue: ptr.To(int64(1500))},
+		},
+	}
+	eth1Up := resourceapi.Device{
+		Name: "pci-0000-8e-00-0",
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			apis.AttrInterfaceName: {StringValue: ptr.To("eth1")},
+			apis.AttrPCIAddress:    {StringValue: ptr.To("0000:8e:00.0")},
+			apis.AttrState:         {StringValue: ptr.To("up")},
+			apis.AttrMTU:           {IntValue: ptr.To(int64(1500))},
+			apis.AttrIPv4:          {StringValue: ptr.To("10.0.0.2/24")},
+		},
+	}
+	dummy := resourceapi.Device{
+		Name: "dummy0",
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			apis.AttrInterfaceName: {StringValue: ptr.To("dummy0")},
+			apis.AttrVirtual:       {BoolValue: ptr.To(true)},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		previous []resourceapi.Device
+		current  []resourceapi.Device
+		want     []string
+	}{
+		{
+			name: "no devices",
+		},
+		{
+			name:    "initial discovery",
+			current: []resourceapi.Device{eth1, dummy},
+			want: []string{
+				`ADDED   dummy0 ifName="dummy0"`,
+				`ADDED   pci-0000-8e-00-0 ifName="eth1" pciAddress="0000:8e:00.0"`,
+			},
+		},
+		{
+			name:     "no changes",
+			previous: []resourceapi.Device{eth1, dummy},
+			current:  []resourceapi.Device{eth1, dummy},
+		},
+		{
+			name:     "device removed",
+			previous: []resourceapi.Device{eth1, dummy},
+			current:  []resourceapi.Device{eth1},
+			want:     []string{"REMOVED dummy0"},
+		},
+		{
+			name:     "attributes changed",
+			previous: []resourceapi.Device{eth1},
+			current:  []resourceapi.Device{eth1Up},
+			want: []string{
+				`CHANGED pci-0000-8e-00-0 dra.net/ipv4: <none> -> "10.0.0.2/24"`,
+				`CHANGED pci-0000-8e-00-0 dra.net/state: "down" -> "up"`,
+			},
+		},
+		{
+			name:     "attribute removed",
+			previous: []resourceapi.Device{eth1Up},
+			current:  []resourceapi.Device{eth1},
+			want: []string{
+				`CHANGED pci-0000-8e-00-0 dra.net/ipv4: "10.0.0.2/24" -> <none>`,
+				`CHANGED pci-0000-8e-00-0 dra.net/state: "up" -> "down"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffDevices(deviceMap(tt.previous), deviceMap(tt.current))
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("diffDevices() returned unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func deviceMap(devices []resourceapi.Device) map[string]resourceapi.Device {
+	m := make(map[string]resourceapi.Device, len(devices))
+	for _, device := range devices {
+		m[device.Name] = device
+	}
+	return m
+}
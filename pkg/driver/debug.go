@@ -0,0 +1,226 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// PodConfigDump is the configuration the driver applied to the devices of a
+// Pod and the live state of their interfaces, so operators can compare them
+// without entering the Pod.
+type PodConfigDump struct {
+	PodUID types.UID `json:"podUID"`
+	// NetNS is the path of the network namespace of the Pod, empty if the Pod
+	// sandbox was not seen by the NRI plugin yet.
+	NetNS           string                      `json:"netns,omitempty"`
+	LastNRIActivity *time.Time                  `json:"lastNRIActivity,omitempty"`
+	Devices         map[string]DeviceConfigDump `json:"devices"`
+}
+
+// DeviceConfigDump is the stored configuration of a device and the live state
+// of its interface in the Pod network namespace.
+type DeviceConfigDump struct {
+	Config DeviceConfig `json:"config"`
+	// Live is the state of the interface, nil if the device has no interface
+	// or it could not be read, the reason is in LiveError.
+	Live      *InterfaceState `json:"live,omitempty"`
+	LiveError string          `json:"liveError,omitempty"`
+}
+
+// InterfaceState is the live state of a network interface.
+type InterfaceState struct {
+	Name         string             `json:"name"`
+	MTU          int                `json:"mtu"`
+	HardwareAddr string             `json:"hardwareAddr,omitempty"`
+	OperState    string             `json:"operState"`
+	Addresses    []string           `json:"addresses,omitempty"`
+	Routes       []apis.RouteConfig `json:"routes,omitempty"`
+	Ethtool      map[string]bool    `json:"ethtoolFeatures,omitempty"`
+	EthtoolError string             `json:"ethtoolError,omitempty"`
+}
+
+// DumpPodConfig returns the configuration of the devices of the Pod and the
+// live state of their interfaces, false if the driver has no configuration
+// for the Pod.
+func (np *NetworkDriver) DumpPodConfig(podUID types.UID) (*PodConfigDump, bool) {
+	podConfig, ok := np.podConfigStore.GetPodConfig(podUID)
+	if !ok {
+		return nil, false
+	}
+	dump := &PodConfigDump{
+		PodUID:  podUID,
+		NetNS:   podConfig.NetNS,
+		Devices: make(map[string]DeviceConfigDump, len(podConfig.DeviceConfigs)),
+	}
+	if !podConfig.LastNRIActivity.IsZero() {
+		dump.LastNRIActivity = &podConfig.LastNRIActivity
+	}
+	for deviceName, config := range podConfig.DeviceConfigs {
+		device := DeviceConfigDump{Config: config}
+		ifName := config.NetworkInterfaceConfigInPod.Interface.Name
+		switch {
+		case ifName == "":
+			// e.g. IB-only RDMA or VFIO devices
+		case podConfig.NetNS == "":
+			device.LiveError = "the network namespace of the pod is not known yet"
+		default:
+			state, err := readInterfaceState(podConfig.NetNS, ifName)
+			if err != nil {
+				device.LiveError = err.Error()
+			}
+			device.Live = state
+		}
+		dump.Devices[deviceName] = device
+	}
+	return dump, true
+}
+
+// readInterfaceState reads the state of the interface in the network
+// namespace. The ethtool features are best effort, their error is reported in
+// the state.
+func readInterfaceState(containerNsPath string, ifName string) (*InterfaceState, error) {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer nhNs.Close()
+
+	link, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("link not found for interface %s: %w", ifName, err)
+	}
+	state := &InterfaceState{
+		Name:         ifName,
+		MTU:          link.Attrs().MTU,
+		HardwareAddr: link.Attrs().HardwareAddr.String(),
+		OperState:    link.Attrs().OperState.String(),
+	}
+
+	addresses, err := nhNs.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the addresses of interface %s: %w", ifName, err)
+	}
+	for _, address := range addresses {
+		state.Addresses = append(state.Addresses, address.IPNet.String())
+	}
+
+	routes, err := nhNs.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Table:     unix.RT_TABLE_UNSPEC,
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the routes of interface %s: %w", ifName, err)
+	}
+	for _, route := range routes {
+		// the local routes of the addresses are managed by the kernel
+		if route.Table == unix.RT_TABLE_LOCAL {
+			continue
+		}
+		state.Routes = append(state.Routes, routeState(route))
+	}
+
+	client, err := newEthtoolClient(int(containerNs))
+	if err != nil {
+		state.EthtoolError = err.Error()
+		return state, nil
+	}
+	defer client.Close()
+	features, err := client.GetFeatures(ifName)
+	if err != nil {
+		state.EthtoolError = err.Error()
+		return state, nil
+	}
+	state.Ethtool = features.active
+	return state, nil
+}
+
+// routeState returns the route in the format of the configuration.
+func routeState(route netlink.Route) apis.RouteConfig {
+	config := apis.RouteConfig{
+		Scope: uint8(route.Scope),
+		Table: route.Table,
+	}
+	if route.Dst != nil {
+		config.Destination = route.Dst.String()
+	}
+	if route.Gw != nil {
+		config.Gateway = route.Gw.String()
+	}
+	if route.Src != nil {
+		config.Source = route.Src.String()
+	}
+	return config
+}
+
+// ServePodConfig writes the dump of the Pod whose UID is the uid path value
+// of the request as JSON. The dump exposes the network configuration of the
+// Pods, so it is only served to the clients on the loopback, e.g. through
+// `kubectl port-forward` or from inside the driver Pod.
+func (np *NetworkDriver) ServePodConfig(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) {
+		http.Error(w, "the pod configuration is only served to loopback clients", http.StatusForbidden)
+		return
+	}
+	podUID := types.UID(r.PathValue("uid"))
+	if podUID == "" {
+		http.Error(w, "missing pod UID", http.StatusBadRequest)
+		return
+	}
+	dump, ok := np.DumpPodConfig(podUID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("pod %s has no network device configured by the driver", podUID), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dump); err != nil {
+		klog.Infof("failed to write the configuration of pod %s: %v", podUID, err)
+	}
+}
+
+// isLoopbackRequest returns true if the client of the request is on the
+// loopback.
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.Unmap().IsLoopback()
+}
@@ -0,0 +1,129 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestServePodConfig(t *testing.T) {
+	store := mustNewPodConfigStore()
+	podUID := types.UID("pod-uid")
+	netConfig := apis.NetworkConfig{
+		Interface: apis.InterfaceConfig{Name: "net1", Addresses: []string{"192.168.10.2/24"}, MTU: ptr.To[int32](9000)},
+		Routes:    []apis.RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.10.1"}},
+	}
+	if err := store.SetDeviceConfig(podUID, "eth1", DeviceConfig{
+		Claim:                       types.NamespacedName{Namespace: "default", Name: "claim-1"},
+		NetworkInterfaceConfigInPod: netConfig,
+		RequestedConfig:             netConfig,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDeviceConfig(podUID, "vfio0", DeviceConfig{
+		Claim:      types.NamespacedName{Namespace: "default", Name: "claim-2"},
+		VFIODevice: VFIOConfig{IOMMUGroup: "12"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	np := &NetworkDriver{podConfigStore: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pods/{uid}", np.ServePodConfig)
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		wantStatus int
+	}{
+		{name: "loopback client", path: "/debug/pods/pod-uid", remoteAddr: "127.0.0.1:41000", wantStatus: http.StatusOK},
+		{name: "ipv6 loopback client", path: "/debug/pods/pod-uid", remoteAddr: "[::1]:41000", wantStatus: http.StatusOK},
+		{name: "remote client", path: "/debug/pods/pod-uid", remoteAddr: "10.0.0.5:41000", wantStatus: http.StatusForbidden},
+		{name: "unknown pod", path: "/debug/pods/other", remoteAddr: "127.0.0.1:41000", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var dump PodConfigDump
+			if err := json.Unmarshal(rec.Body.Bytes(), &dump); err != nil {
+				t.Fatalf("failed to decode the dump: %v", err)
+			}
+			if dump.PodUID != podUID || len(dump.Devices) != 2 {
+				t.Fatalf("dump = %+v, want the 2 devices of pod %s", dump, podUID)
+			}
+			eth1 := dump.Devices["eth1"]
+			if diff := cmp.Diff(netConfig, eth1.Config.NetworkInterfaceConfigInPod); diff != "" {
+				t.Errorf("configuration of eth1 mismatch (-want +got):\n%s", diff)
+			}
+			// the sandbox was not seen, the live state can not be read
+			if eth1.Live != nil || eth1.LiveError == "" {
+				t.Errorf("eth1 live = %+v, error %q, want an error", eth1.Live, eth1.LiveError)
+			}
+			vfio := dump.Devices["vfio0"]
+			if vfio.Config.VFIODevice.IOMMUGroup != "12" || vfio.Live != nil || vfio.LiveError != "" {
+				t.Errorf("vfio0 = %+v, want its configuration without live state", vfio)
+			}
+		})
+	}
+}
+
+func TestInterfaceStateJSON(t *testing.T) {
+	state := &InterfaceState{
+		Name:         "net1",
+		MTU:          9000,
+		HardwareAddr: "02:00:00:00:00:01",
+		OperState:    "up",
+		Addresses:    []string{"192.168.10.2/24"},
+		Routes: []apis.RouteConfig{
+			routeState(netlink.Route{
+				Dst:   &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)},
+				Gw:    net.ParseIP("192.168.10.1"),
+				Table: 254,
+			}),
+		},
+		Ethtool: map[string]bool{"rx-gro": true},
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("failed to encode the state: %v", err)
+	}
+	want := `{"name":"net1","mtu":9000,"hardwareAddr":"02:00:00:00:00:01","operState":"up","addresses":["192.168.10.2/24"],` +
+		`"routes":[{"destination":"10.0.0.0/8","gateway":"192.168.10.1","table":254}],"ethtoolFeatures":{"rx-gro":true}}`
+	if string(data) != want {
+		t.Errorf("state JSON = %s, want %s", data, want)
+	}
+}
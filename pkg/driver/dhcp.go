@@ -19,50 +19,502 @@ package driver
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"sigs.k8s.io/dranet/pkg/apis"
 
+	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/insomniacslk/dhcp/rfc1035label"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 )
 
-func getDHCP(ctx context.Context, ifName string) (ip string, routes []apis.RouteConfig, err error) {
-	link, err := nlwrap.LinkByName(ifName)
-	if err != nil {
-		return "", nil, err
+const (
+	// Client FQDN option flags (RFC 4702 section 2.1).
+	// fqdnFlagServerUpdate asks the server to perform the A RR update.
+	fqdnFlagServerUpdate = 0x01
+	// fqdnFlagEncoding indicates the domain name is in canonical wire format.
+	fqdnFlagEncoding = 0x04
+
+	// dhcpRulePriority is the priority of the rule looking up the table of
+	// an interface configured with DHCP, before the main table rule (32766).
+	dhcpRulePriority = 30000
+)
+
+// dhcpModifiers returns the modifiers applied to both the DHCPDISCOVER and
+// DHCPREQUEST packets, derived from the interface configuration.
+func dhcpModifiers(ifCfg apis.InterfaceConfig) []dhcpv4.Modifier {
+	// The replies are broadcast unless unicast ones are requested, e.g. for
+	// relays misbehaving with broadcast. The raw socket of the client only
+	// matches the UDP port so unicast replies to the offered address are
+	// received too.
+	broadcast := ifCfg.DHCPBroadcast == nil || *ifCfg.DHCPBroadcast
+	modifiers := []dhcpv4.Modifier{
+		dhcpv4.WithBroadcast(broadcast),
+		// the domain name (15) is requested by default, the search list is
+		// needed too to write the resolver configuration of the Pod, and the
+		// static routes are installed when there are no classless routes
+		withRequestedOptionCodes([]int{
+			int(dhcpv4.OptionDNSDomainSearchList.Code()),
+			int(dhcpv4.OptionStaticRoutingTable.Code()),
+		}),
 	}
-	if link.Attrs().OperState != netlink.OperUp {
-		if err := netlink.LinkSetUp(link); err != nil {
-			return "", nil, fmt.Errorf("failed to set interface %s up: %v", ifName, err)
+	if ifCfg.DHCPHostname != nil && *ifCfg.DHCPHostname != "" {
+		modifiers = append(modifiers, dhcpHostnameModifiers(*ifCfg.DHCPHostname)...)
+	}
+	if len(ifCfg.DHCPRequestOptions) > 0 {
+		modifiers = append(modifiers, withRequestedOptionCodes(ifCfg.DHCPRequestOptions))
+	}
+	return modifiers
+}
+
+// withRequestedOptionCodes adds the option codes to the parameter request
+// list. Unlike dhcpv4.WithRequestedOptions it compares the numeric codes, so
+// the options already requested by default are not duplicated.
+func withRequestedOptionCodes(codes []int) dhcpv4.Modifier {
+	return func(d *dhcpv4.DHCPv4) {
+		requested := d.ParameterRequestList()
+		for _, code := range codes {
+			if !slices.ContainsFunc(requested, func(c dhcpv4.OptionCode) bool { return int(c.Code()) == code }) {
+				requested = append(requested, dhcpv4.GenericOptionCode(code))
+			}
 		}
+		d.UpdateOption(dhcpv4.OptParameterRequestList(requested...))
 	}
-	dhclient, err := nclient4.New(ifName)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to create DHCP client on interface %s  up: %v", ifName, err)
+}
+
+// dhcpRequestedOptions returns the raw values of the requested options
+// present in the DHCPACK, keyed by option code. The options the server did not
+// send are omitted.
+func dhcpRequestedOptions(ack *dhcpv4.DHCPv4, codes []int) map[int][]byte {
+	var options map[int][]byte
+	for _, code := range codes {
+		value := ack.Options.Get(dhcpv4.GenericOptionCode(code))
+		if value == nil {
+			continue
+		}
+		if options == nil {
+			options = map[int][]byte{}
+		}
+		options[code] = value
 	}
-	defer dhclient.Close()
+	return options
+}
 
-	lease, err := dhclient.Request(ctx)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to obtain DHCP lease on interface %s  up: %v", ifName, err)
+// dhcpHostnameModifiers advertises the client hostname so the DHCP server can
+// register it in DNS. The first label is always sent as the Host Name option
+// (12); a fully qualified name is additionally sent as the Client FQDN option
+// (81) with the S flag set so the server performs the DNS updates.
+func dhcpHostnameModifiers(hostname string) []dhcpv4.Modifier {
+	hostname = strings.TrimSuffix(hostname, ".")
+	shortName, _, isFQDN := strings.Cut(hostname, ".")
+	modifiers := []dhcpv4.Modifier{
+		dhcpv4.WithOption(dhcpv4.OptHostName(shortName)),
+	}
+	if isFQDN {
+		labels := &rfc1035label.Labels{Labels: []string{hostname}}
+		// Flags, RCODE1 and RCODE2 (both deprecated and sent as 0), Domain Name.
+		value := append([]byte{fqdnFlagServerUpdate | fqdnFlagEncoding, 0, 0}, labels.ToBytes()...)
+		modifiers = append(modifiers, dhcpv4.WithGeneric(dhcpv4.OptionFQDN, value))
+	}
+	return modifiers
+}
+
+// minIPv4MTU is the minimum MTU of an IPv4 link (RFC 791), the kernel
+// removes the IPv4 configuration of interfaces with a lower MTU.
+const minIPv4MTU = 68
+
+// checkDHCPv4Capable returns an error if DHCPv4 can not run on the link,
+// e.g. on IPv6-only interfaces, instead of sending malformed packets.
+func checkDHCPv4Capable(attrs *netlink.LinkAttrs) error {
+	if attrs.MTU > 0 && attrs.MTU < minIPv4MTU {
+		return fmt.Errorf("interface %s has no IPv4 capability: MTU %d is lower than the IPv4 minimum %d", attrs.Name, attrs.MTU, minIPv4MTU)
+	}
+	// The hardware addresses that do not fit the 16 bytes of the chaddr
+	// field, e.g. IPoIB, are sent in the client identifier instead.
+	if len(attrs.HardwareAddr) == 0 {
+		return fmt.Errorf("interface %s has no hardware address and can not be used for DHCPv4", attrs.Name)
+	}
+	return nil
+}
+
+// dhcpLeaseConfig returns the address, routes and router offered in the
+// DHCPACK. It rejects IP fields that are not IPv4 rather than converting them
+// to nil.
+func dhcpLeaseConfig(ack *dhcpv4.DHCPv4) (ip string, routes []apis.RouteConfig, router string, err error) {
+	yourIP := ack.YourIPAddr.To4()
+	if yourIP == nil || yourIP.IsUnspecified() {
+		return "", nil, "", fmt.Errorf("DHCP server offered an invalid IPv4 address %q", ack.YourIPAddr)
 	}
-	if lease.ACK == nil {
-		return "", nil, fmt.Errorf("failed to obtain DHCP lease on interface %s  up: %v", ifName, err)
+	mask := ack.SubnetMask()
+	if mask == nil {
+		return "", nil, "", fmt.Errorf("DHCP server offered an invalid IPv4 subnet mask %v", ack.Options.Get(dhcpv4.OptionSubnetMask))
 	}
 	ip = (&net.IPNet{
-		IP:   lease.ACK.YourIPAddr,
-		Mask: lease.ACK.SubnetMask(),
+		IP:   yourIP,
+		Mask: mask,
 	}).String()
 
-	// only support opt 121 (ignore 33)
-	for _, route := range lease.ACK.ClasslessStaticRoute() {
+	// RFC 3442: the client must ignore option 33 when option 121 is present.
+	offered := ack.ClasslessStaticRoute()
+	if !ack.Options.Has(dhcpv4.OptionClasslessStaticRoute) {
+		offered, err = dhcpStaticRoutes(ack)
+		if err != nil {
+			return "", nil, "", err
+		}
+	}
+	for _, route := range offered {
+		if route.Dest == nil || route.Dest.IP.To4() == nil {
+			return "", nil, "", fmt.Errorf("DHCP server offered a route with an invalid IPv4 destination %v", route.Dest)
+		}
+		if route.Router.To4() == nil {
+			return "", nil, "", fmt.Errorf("DHCP server offered a route to %s with an invalid IPv4 router %q", route.Dest, route.Router)
+		}
 		routeCfg := apis.RouteConfig{
 			Destination: route.Dest.String(),
 			Gateway:     route.Router.String(),
 		}
 		routes = append(routes, routeCfg)
 	}
-	return
+	// RFC 3442: the client must also ignore the routers of option 3 when
+	// option 121 is present, the default route is one of its routes.
+	if !ack.Options.Has(dhcpv4.OptionClasslessStaticRoute) && ack.Options.Has(dhcpv4.OptionRouter) {
+		routers := ack.Router()
+		if len(routers) == 0 || routers[0].To4() == nil || routers[0].IsUnspecified() {
+			return "", nil, "", fmt.Errorf("DHCP server offered an invalid IPv4 router %v", ack.Options.Get(dhcpv4.OptionRouter))
+		}
+		router = routers[0].String()
+	}
+	return ip, routes, router, nil
+}
+
+// dhcpRouteTable returns the routing table of the default route learned from
+// DHCP for the interface, the configured one or the table of the interface
+// derived from its name in the Pod.
+func dhcpRouteTable(ifCfg apis.InterfaceConfig) int {
+	if ifCfg.DHCPRouteTable != nil {
+		return *ifCfg.DHCPRouteTable
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ifCfg.Name))
+	return int(h.Sum32()%1000) + apis.DHCPTableOffset
+}
+
+// dhcpRoutingConfig returns the routes and rules of a DHCP lease with the
+// address ip. When the lease has a default route and the table is not the
+// main one, the routes of the lease are installed in the table, with the
+// route to the subnet of the address, and a rule looks the table up for the
+// packets sent from the address. The default route of the Pod is not replaced
+// by the gateway of a secondary interface, the routes to other destinations
+// are also kept in the main table. The router of the lease is only the
+// default route of the table of the interface, the main table does not get a
+// default route from it.
+func dhcpRoutingConfig(ip string, routes []apis.RouteConfig, router string, table int) ([]apis.RouteConfig, []apis.RuleConfig, error) {
+	if table != unix.RT_TABLE_MAIN && router != "" {
+		routes = append(slices.Clone(routes), apis.RouteConfig{
+			Destination: "0.0.0.0/0",
+			Gateway:     router,
+		})
+	}
+	if table == unix.RT_TABLE_MAIN || !slices.ContainsFunc(routes, func(route apis.RouteConfig) bool {
+		return route.Destination == "0.0.0.0/0"
+	}) {
+		return routes, nil, nil
+	}
+	prefix, err := netip.ParsePrefix(ip)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid DHCP address %q: %w", ip, err)
+	}
+
+	var mainRoutes, tableRoutes []apis.RouteConfig
+	if prefix.Bits() < 32 {
+		tableRoutes = append(tableRoutes, apis.RouteConfig{
+			Destination: prefix.Masked().String(),
+			Scope:       unix.RT_SCOPE_LINK,
+			Table:       table,
+		})
+	}
+	for _, route := range routes {
+		if route.Destination != "0.0.0.0/0" {
+			mainRoutes = append(mainRoutes, route)
+		}
+		route.Table = table
+		tableRoutes = append(tableRoutes, route)
+	}
+	rule := apis.RuleConfig{
+		Priority: dhcpRulePriority,
+		Source:   netip.PrefixFrom(prefix.Addr(), 32).String(),
+		Table:    table,
+	}
+	return append(mainRoutes, tableRoutes...), []apis.RuleConfig{rule}, nil
+}
+
+// dhcpStaticRoutes parses the Static Route option (33) of older DHCP servers.
+// It is a list of destination and router address pairs, the destinations are
+// classful so the mask is derived from the destination address (RFC 2132
+// section 5.8).
+func dhcpStaticRoutes(ack *dhcpv4.DHCPv4) ([]*dhcpv4.Route, error) {
+	value := ack.Options.Get(dhcpv4.OptionStaticRoutingTable)
+	if value == nil {
+		return nil, nil
+	}
+	if len(value)%8 != 0 {
+		return nil, fmt.Errorf("DHCP server offered a static route option with invalid length %d", len(value))
+	}
+	var routes []*dhcpv4.Route
+	for i := 0; i < len(value); i += 8 {
+		dest := net.IP(slices.Clone(value[i : i+4]))
+		// the default route is not a legal destination for option 33 and
+		// multicast or reserved destinations have no class
+		mask := dest.DefaultMask()
+		if dest.IsUnspecified() || mask == nil {
+			return nil, fmt.Errorf("DHCP server offered a static route with the illegal destination %s", dest)
+		}
+		routes = append(routes, &dhcpv4.Route{
+			Dest:   &net.IPNet{IP: dest, Mask: mask},
+			Router: net.IP(slices.Clone(value[i+4 : i+8])),
+		})
+	}
+	return routes, nil
+}
+
+// dhcpDomains returns the DNS domain name (option 15) and the domain search
+// list (option 119) offered in the DHCPACK, so they can be written into the
+// resolver configuration of the Pod.
+func dhcpDomains(ack *dhcpv4.DHCPv4) (domainName string, searchDomains []string, err error) {
+	domainName = strings.TrimSuffix(strings.TrimRight(ack.DomainName(), "\x00"), ".")
+	if value := ack.Options.Get(dhcpv4.OptionDNSDomainSearchList); value != nil {
+		searchDomains, err = parseDomainSearch(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("DHCP server offered an invalid domain search option: %w", err)
+		}
+	}
+	return domainName, searchDomains, nil
+}
+
+// parseDomainSearch decodes the Domain Search option (RFC 3397), a list of
+// domain names in DNS wire format. The names can be compressed with pointers to
+// a prior occurrence of a suffix (RFC 1035 section 4.1.4), the offsets are
+// relative to the start of the option data.
+func parseDomainSearch(data []byte) ([]string, error) {
+	var domains []string
+	for pos := 0; pos < len(data); {
+		domain, next, err := parseDomainName(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+		pos = next
+	}
+	return domains, nil
+}
+
+// parseDomainName decodes the domain name starting at start and returns the
+// position following it. A pointer must point before the labels already
+// decoded for the name, so a malformed option can not make it loop.
+func parseDomainName(data []byte, start int) (string, int, error) {
+	var labels []string
+	length := 0
+	// next is the position after the name, known on the first pointer or at
+	// the terminating zero length label
+	next := -1
+	// limit is the lowest position of the labels decoded for the name
+	limit := start
+	for pos := start; ; {
+		if pos >= len(data) {
+			return "", 0, fmt.Errorf("domain name at offset %d is not terminated", start)
+		}
+		labelLen := int(data[pos])
+		switch {
+		case labelLen == 0:
+			if len(labels) == 0 {
+				return "", 0, fmt.Errorf("empty domain name at offset %d", start)
+			}
+			if next < 0 {
+				next = pos + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case labelLen&0xc0 == 0xc0:
+			if pos+1 >= len(data) {
+				return "", 0, fmt.Errorf("truncated pointer at offset %d", pos)
+			}
+			offset := (labelLen&0x3f)<<8 | int(data[pos+1])
+			if offset >= limit {
+				return "", 0, fmt.Errorf("pointer at offset %d to offset %d does not point to a prior label", pos, offset)
+			}
+			if next < 0 {
+				next = pos + 2
+			}
+			pos, limit = offset, offset
+		case labelLen&0xc0 != 0:
+			return "", 0, fmt.Errorf("unsupported label type %#x at offset %d", labelLen&0xc0, pos)
+		default:
+			if pos+1+labelLen > len(data) {
+				return "", 0, fmt.Errorf("truncated label at offset %d", pos)
+			}
+			// the length of the name includes the length octets
+			length += 1 + labelLen
+			if length > 255 {
+				return "", 0, fmt.Errorf("domain name at offset %d is longer than 255 octets", start)
+			}
+			labels = append(labels, string(data[pos+1:pos+1+labelLen]))
+			pos += 1 + labelLen
+		}
+	}
+}
+
+// dhcpResult is the configuration of the interface obtained from a lease.
+type dhcpResult struct {
+	ip     string
+	routes []apis.RouteConfig
+	// router is the default gateway of option 3, when there are no
+	// classless static routes
+	router string
+	// options are the raw values of the requested options, keyed by code
+	options map[int][]byte
+	// domainName and searchDomains are the DNS domain and search list for
+	// the resolver of the Pod
+	domainName    string
+	searchDomains []string
+	// state is the lease kept renewed while the Pod runs
+	state *DHCPLease
+}
+
+// newDHCPResult returns the configuration of the interface obtained from the
+// DHCPACK of a client with the hardware address hwAddr.
+func newDHCPResult(ack *dhcpv4.DHCPv4, ifCfg apis.InterfaceConfig, hwAddr net.HardwareAddr) (*dhcpResult, error) {
+	ip, routes, router, err := dhcpLeaseConfig(ack)
+	if err != nil {
+		return nil, err
+	}
+	domainName, searchDomains, err := dhcpDomains(ack)
+	if err != nil {
+		return nil, err
+	}
+	return &dhcpResult{
+		ip:            ip,
+		routes:        routes,
+		router:        router,
+		options:       dhcpRequestedOptions(ack, ifCfg.DHCPRequestOptions),
+		domainName:    domainName,
+		searchDomains: searchDomains,
+		state:         newDHCPLease(ack, ip, hwAddr, time.Now()),
+	}, nil
+}
+
+// dhcpLeaseRouting returns the routes and rules of the lease on the
+// interface. The VRF table holds all the routes of the interface, the router
+// of the lease is not installed in it.
+func dhcpLeaseRouting(ifCfg apis.InterfaceConfig, lease *dhcpResult) ([]apis.RouteConfig, []apis.RuleConfig, error) {
+	if ifCfg.VRF != nil {
+		return lease.routes, nil, nil
+	}
+	return dhcpRoutingConfig(lease.ip, lease.routes, lease.router, dhcpRouteTable(ifCfg))
+}
+
+// getDHCP obtains a lease on the interface before it is moved to the Pod
+// namespace. The lease is renewed from the Pod namespace while the Pod runs,
+// see runDHCPRenewal.
+func getDHCP(ctx context.Context, ifName string, ifCfg apis.InterfaceConfig) (*dhcpResult, error) {
+	link, err := nlwrap.LinkByName(ifName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDHCPv4Capable(link.Attrs()); err != nil {
+		return nil, err
+	}
+	if link.Attrs().OperState != netlink.OperUp {
+		if err := netlink.LinkSetUp(link); err != nil {
+			return nil, fmt.Errorf("failed to set interface %s up: %v", ifName, err)
+		}
+	}
+	conn, err := newDHCPConn(ifName, link.Attrs().HardwareAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DHCP client on interface %s  up: %v", ifName, err)
+	}
+	dhclient := newDHCPClient(conn, link.Attrs().HardwareAddr, dhcpMaxMessageSize(link.Attrs().MTU))
+	defer dhclient.Close()
+
+	ack, err := dhcpRequestLease(ctx, dhclient, ifCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain DHCP lease on interface %s: %v", ifName, err)
+	}
+	return newDHCPResult(ack, ifCfg, link.Attrs().HardwareAddr)
+}
+
+// initRebootTimeout bounds the wait for the DHCPACK of the requested address,
+// a server that has no record of the client stays silent (RFC 2131 section
+// 4.3.2). The wait is also limited to half of the time left to the caller, so
+// the DHCPDISCOVER fallback can still run.
+const initRebootTimeout = 10 * time.Second
+
+// dhcpRequestLease obtains a lease and returns its DHCPACK. If the
+// configuration has a requested address, it is first confirmed from the
+// INIT-REBOOT state, and the full DHCPDISCOVER exchange is only used if the
+// server refuses it with a DHCPNAK, does not answer or acknowledges another
+// address.
+func dhcpRequestLease(ctx context.Context, client *dhcpClient, ifCfg apis.InterfaceConfig) (*dhcpv4.DHCPv4, error) {
+	modifiers := dhcpModifiers(ifCfg)
+	if ifCfg.DHCPRequestedIP != nil && *ifCfg.DHCPRequestedIP != "" {
+		requestedIP := net.ParseIP(*ifCfg.DHCPRequestedIP).To4()
+		if requestedIP == nil {
+			return nil, fmt.Errorf("invalid requested IPv4 address %q", *ifCfg.DHCPRequestedIP)
+		}
+		ack, err := dhcpInitReboot(ctx, client, requestedIP, modifiers)
+		if err == nil {
+			return ack, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		klog.Infof("DHCP server did not confirm the requested address %s, falling back to DHCPDISCOVER: %v", requestedIP, err)
+	}
+	return client.request(ctx, modifiers...)
+}
+
+// dhcpInitReboot asks the server to confirm the requested address and returns
+// its DHCPACK.
+func dhcpInitReboot(ctx context.Context, client *dhcpClient, requestedIP net.IP, modifiers []dhcpv4.Modifier) (*dhcpv4.DHCPv4, error) {
+	request, err := newInitRebootRequest(client.hwAddr, requestedIP, slices.Concat(modifiers, client.hwModifiers)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the DHCPREQUEST: %w", err)
+	}
+	timeout := initRebootTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline)/2)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	response, err := client.sendAndRead(ctx, request, nclient4.IsMessageType(dhcpv4.MessageTypeAck, dhcpv4.MessageTypeNak))
+	if err != nil {
+		return nil, err
+	}
+	if response.MessageType() == dhcpv4.MessageTypeNak {
+		return nil, &nclient4.ErrNak{Nak: response}
+	}
+	if !response.YourIPAddr.Equal(requestedIP) {
+		return nil, fmt.Errorf("server acknowledged %s instead of the requested address", response.YourIPAddr)
+	}
+	return response, nil
+}
+
+// newInitRebootRequest returns the DHCPREQUEST of a client in the INIT-REBOOT
+// state: the requested address is in option 50, without a server identifier
+// and with a zero client address (RFC 2131 section 4.3.2). It requests the
+// same options as a DHCPDISCOVER.
+func newInitRebootRequest(hwaddr net.HardwareAddr, requestedIP net.IP, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, error) {
+	return dhcpv4.New(dhcpv4.PrependModifiers(modifiers,
+		dhcpv4.WithHwAddr(hwaddr),
+		dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask, dhcpv4.OptionRouter, dhcpv4.OptionDomainName, dhcpv4.OptionDomainNameServer),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(requestedIP)),
+	)...)
 }
@@ -0,0 +1,375 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/insomniacslk/dhcp/iana"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// dhcpMinMessageSize is the minimum legal value of the maximum DHCP
+	// message size option (RFC 2132 section 9.10).
+	dhcpMinMessageSize = 576
+	// ipv4UDPHeaderLen is the size of the IPv4 and UDP headers without IP
+	// options, included in the maximum DHCP message size.
+	ipv4UDPHeaderLen = 28
+	// rawReceiveBufferSize fits the largest IPv4 packet, so the packets are
+	// never truncated by the raw socket.
+	rawReceiveBufferSize = math.MaxUint16
+
+	// dhcpTimeout is the wait for a reply before the message is sent again,
+	// doubled on each retry.
+	dhcpTimeout = 5 * time.Second
+	// dhcpRetries is the number of times a message is sent.
+	dhcpRetries = 3
+
+	// dhcpMaxHardwareAddrLen is the size of the client hardware address
+	// field (chaddr) of a DHCP message.
+	dhcpMaxHardwareAddrLen = 16
+)
+
+// errDHCPMessageTruncated is returned when a DHCP message is not received
+// complete, e.g. the server ignored the maximum message size and the reply
+// was fragmented.
+var errDHCPMessageTruncated = errors.New("DHCP message truncated")
+
+// dhcpMaxMessageSize returns the maximum DHCP message size advertised in
+// option 57 on an interface with that MTU, a larger message would be
+// fragmented and can not be reassembled from the raw socket.
+func dhcpMaxMessageSize(mtu int) uint16 {
+	return uint16(min(max(mtu, dhcpMinMessageSize), math.MaxUint16))
+}
+
+// dhcpClient obtains the DHCPv4 leases of the driver. Unlike nclient4.Client,
+// whose receive buffer is fixed to 1500 bytes, the replies are read with a
+// buffer of the maximum message size advertised to the servers, so the replies
+// with many options, e.g. classless routes, domain search list and DNS
+// servers, are not truncated on interfaces with a larger MTU.
+type dhcpClient struct {
+	conn           net.PacketConn
+	hwAddr         net.HardwareAddr
+	maxMessageSize uint16
+	// chaddr is the client hardware address field of the messages, empty if
+	// hwAddr does not fit it.
+	chaddr net.HardwareAddr
+	// hwModifiers are applied last to the messages sent, to identify a
+	// client whose hardware address does not fit chaddr.
+	hwModifiers []dhcpv4.Modifier
+
+	replies   chan *dhcpv4.DHCPv4
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// newDHCPClient returns a client sending and receiving the DHCP messages on
+// conn, which reads and writes UDP payloads.
+func newDHCPClient(conn net.PacketConn, hwAddr net.HardwareAddr, maxMessageSize uint16) *dhcpClient {
+	c := &dhcpClient{
+		conn:           conn,
+		hwAddr:         hwAddr,
+		maxMessageSize: maxMessageSize,
+		chaddr:         hwAddr,
+		replies:        make(chan *dhcpv4.DHCPv4, 10),
+		done:           make(chan struct{}),
+	}
+	if len(hwAddr) > dhcpMaxHardwareAddrLen {
+		c.chaddr = nil
+		c.hwModifiers = ipoibModifiers(hwAddr)
+	}
+	c.wg.Add(1)
+	go c.receiveLoop()
+	return c
+}
+
+// Close closes the connection and waits for the receive loop to exit.
+func (c *dhcpClient) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+		c.wg.Wait()
+	})
+	return err
+}
+
+// receiveBufferSize is the largest DHCP message the client accepts.
+func (c *dhcpClient) receiveBufferSize() int {
+	return int(c.maxMessageSize) - ipv4UDPHeaderLen
+}
+
+// receiveLoop delivers the replies to the hardware address of the client. The
+// truncated messages are discarded, they could miss some of the options.
+func (c *dhcpClient) receiveLoop() {
+	defer c.wg.Done()
+	// One more byte than the maximum message size to detect the overflows.
+	b := make([]byte, c.receiveBufferSize()+1)
+	for {
+		n, addr, err := c.conn.ReadFrom(b)
+		if errors.Is(err, errDHCPMessageTruncated) {
+			klog.Errorf("Discarding DHCP message from %v: %v, the server ignored the maximum message size of %d bytes", addr, err, c.maxMessageSize)
+			continue
+		}
+		if err != nil {
+			select {
+			case <-c.done:
+			default:
+				klog.Infof("error reading DHCP messages: %v", err)
+			}
+			return
+		}
+		if n > c.receiveBufferSize() {
+			klog.Errorf("Discarding DHCP message from %v: %v to the receive buffer of %d bytes, the server ignored the maximum message size of %d bytes", addr, errDHCPMessageTruncated, c.receiveBufferSize(), c.maxMessageSize)
+			continue
+		}
+		msg, err := dhcpv4.FromBytes(b[:n])
+		if err != nil || msg.OpCode != dhcpv4.OpcodeBootReply || !bytes.Equal(msg.ClientHWAddr, c.chaddr) {
+			continue
+		}
+		select {
+		case c.replies <- msg:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// sendAndRead broadcasts the message to the DHCP servers, with the maximum
+// message size option, and returns the first reply of the transaction
+// matching match. The message is sent again if there is no reply, the
+// timeout doubles on each retry.
+func (c *dhcpClient) sendAndRead(ctx context.Context, msg *dhcpv4.DHCPv4, match nclient4.Matcher) (*dhcpv4.DHCPv4, error) {
+	return c.sendAndReadTo(ctx, msg, nclient4.DefaultServers, match)
+}
+
+// sendAndReadTo is sendAndRead with the message sent to dst, e.g. unicast to
+// the server of a lease being renewed.
+func (c *dhcpClient) sendAndReadTo(ctx context.Context, msg *dhcpv4.DHCPv4, dst net.Addr, match nclient4.Matcher) (*dhcpv4.DHCPv4, error) {
+	msg.UpdateOption(dhcpv4.OptMaxMessageSize(c.maxMessageSize))
+	timeout := dhcpTimeout
+	for range dhcpRetries {
+		if _, err := c.conn.WriteTo(msg.ToBytes(), dst); err != nil {
+			return nil, fmt.Errorf("error writing DHCP %s: %w", msg.MessageType(), err)
+		}
+		timer := time.NewTimer(timeout)
+		reply, err := c.read(ctx, timer.C, msg.TransactionID, match)
+		timer.Stop()
+		if err != nil || reply != nil {
+			return reply, err
+		}
+		timeout *= 2
+	}
+	return nil, nclient4.ErrNoResponse
+}
+
+// read waits for a reply of the transaction matching match, it returns no
+// reply and no error when the timer expires.
+func (c *dhcpClient) read(ctx context.Context, expired <-chan time.Time, xid dhcpv4.TransactionID, match nclient4.Matcher) (*dhcpv4.DHCPv4, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.done:
+			return nil, nclient4.ErrNoResponse
+		case <-expired:
+			return nil, nil
+		case reply := <-c.replies:
+			if reply.TransactionID == xid && (match == nil || match(reply)) {
+				return reply, nil
+			}
+		}
+	}
+}
+
+// request completes the DHCPDISCOVER, DHCPOFFER, DHCPREQUEST, DHCPACK
+// exchange and returns the DHCPACK. The modifiers apply to the DHCPDISCOVER
+// and the DHCPREQUEST.
+func (c *dhcpClient) request(ctx context.Context, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, error) {
+	modifiers = slices.Concat(modifiers, c.hwModifiers)
+	discover, err := dhcpv4.NewDiscovery(c.hwAddr, modifiers...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the DHCPDISCOVER: %w", err)
+	}
+	offer, err := c.sendAndRead(ctx, discover, nclient4.IsMessageType(dhcpv4.MessageTypeOffer))
+	if err != nil {
+		return nil, fmt.Errorf("unable to receive an offer: %w", err)
+	}
+	request, err := dhcpv4.NewRequestFromOffer(offer, modifiers...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the DHCPREQUEST: %w", err)
+	}
+	response, err := c.sendAndRead(ctx, request, nclient4.IsAll(
+		nclient4.IsCorrectServer(offer.ServerIdentifier()),
+		nclient4.IsMessageType(dhcpv4.MessageTypeAck, dhcpv4.MessageTypeNak)))
+	if err != nil {
+		return nil, fmt.Errorf("got an error while processing the request: %w", err)
+	}
+	if response.MessageType() == dhcpv4.MessageTypeNak {
+		return nil, &nclient4.ErrNak{Offer: offer, Nak: response}
+	}
+	return response, nil
+}
+
+// ipoibModifiers returns the modifiers of the messages sent from an IPoIB
+// interface, whose 20 bytes hardware address does not fit chaddr (RFC 4390):
+// the hardware type is InfiniBand, chaddr is empty, the replies are broadcast
+// and the client is identified by the client identifier option.
+func ipoibModifiers(hwAddr net.HardwareAddr) []dhcpv4.Modifier {
+	return []dhcpv4.Modifier{
+		dhcpv4.WithHWType(iana.HWTypeInfiniband),
+		func(d *dhcpv4.DHCPv4) { d.ClientHWAddr = nil },
+		dhcpv4.WithBroadcast(true),
+		dhcpv4.WithOption(dhcpv4.OptClientIdentifier(ipoibClientIdentifier(hwAddr))),
+	}
+}
+
+// ipoibClientIdentifier returns the client identifier of an IPoIB interface
+// (RFC 4361): the type 255, an IAID and a DUID-LL with the port GUID, the last
+// 8 bytes of the hardware address. The IAID is the last 4 bytes of the GUID.
+func ipoibClientIdentifier(hwAddr net.HardwareAddr) []byte {
+	guid := hwAddr[len(hwAddr)-8:]
+	id := []byte{0xff}
+	id = append(id, guid[4:]...)
+	// DUID-LL (type 3) of the InfiniBand hardware type
+	id = binary.BigEndian.AppendUint16(id, 3)
+	id = binary.BigEndian.AppendUint16(id, uint16(iana.HWTypeInfiniband))
+	return append(id, guid...)
+}
+
+// newDHCPConn opens the connection of the DHCP client on the interface. The
+// raw socket of nclient4 sends the messages to the Ethernet broadcast address,
+// the interfaces whose hardware address does not fit chaddr, e.g. IPoIB, use
+// a UDP socket bound to the interface instead.
+func newDHCPConn(ifName string, hwAddr net.HardwareAddr) (net.PacketConn, error) {
+	if len(hwAddr) > dhcpMaxHardwareAddrLen {
+		return newDHCPUDPConn(ifName)
+	}
+	return newDHCPRawConn(ifName)
+}
+
+// newDHCPUDPConn opens a UDP socket on the DHCP client port bound to the
+// interface, receiving the broadcast replies of the servers.
+func newDHCPUDPConn(ifName string) (net.PacketConn, error) {
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); sockErr != nil {
+					return
+				}
+				if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1); sockErr != nil {
+					return
+				}
+				sockErr = unix.BindToDevice(int(fd), ifName)
+			})
+			return errors.Join(err, sockErr)
+		},
+	}
+	return lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", nclient4.ClientPort))
+}
+
+// dhcpRawConn reads the UDP payloads sent to the DHCP client port from the
+// raw socket of nclient4, with a buffer fitting any IPv4 packet. The messages
+// truncated by the network, fragmented or shorter than their UDP length, are
+// reported with errDHCPMessageTruncated instead of being parsed partially.
+type dhcpRawConn struct {
+	*nclient4.BroadcastRawUDPConn
+	buf []byte
+}
+
+// newDHCPRawConn opens the raw socket of the DHCP client on the interface.
+func newDHCPRawConn(ifName string) (*dhcpRawConn, error) {
+	conn, err := nclient4.NewRawUDPConn(ifName, nclient4.ClientPort)
+	if err != nil {
+		return nil, err
+	}
+	rawConn, ok := conn.(*nclient4.BroadcastRawUDPConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected raw connection type %T", conn)
+	}
+	return &dhcpRawConn{BroadcastRawUDPConn: rawConn, buf: make([]byte, rawReceiveBufferSize)}, nil
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom.
+func (c *dhcpRawConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, _, err := c.PacketConn.ReadFrom(c.buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload, src, ok, err := dhcpPayloadFromIPv4(c.buf[:n])
+		if err != nil {
+			return 0, src, err
+		}
+		if !ok {
+			continue
+		}
+		return copy(b, payload), src, nil
+	}
+}
+
+// dhcpPayloadFromIPv4 returns the UDP payload of the IPv4 packet and its
+// source if it is sent to the DHCP client port, ok is false for the other
+// packets. The first fragment of a fragmented message or a packet shorter than
+// its headers say returns errDHCPMessageTruncated.
+func dhcpPayloadFromIPv4(pkt []byte) (payload []byte, src *net.UDPAddr, ok bool, err error) {
+	if len(pkt) < 20 || pkt[0]>>4 != 4 {
+		return nil, nil, false, nil
+	}
+	headerLen := int(pkt[0]&0x0f) * 4
+	fragment := binary.BigEndian.Uint16(pkt[6:8])
+	// The next fragments have no UDP header, only the first one is checked.
+	if headerLen < 20 || pkt[9] != unix.IPPROTO_UDP || fragment&0x1fff != 0 || len(pkt) < headerLen+8 {
+		return nil, nil, false, nil
+	}
+	udp := pkt[headerLen:]
+	if int(binary.BigEndian.Uint16(udp[2:4])) != nclient4.ClientPort {
+		return nil, nil, false, nil
+	}
+	src = &net.UDPAddr{
+		IP:   net.IP(bytes.Clone(pkt[12:16])),
+		Port: int(binary.BigEndian.Uint16(udp[0:2])),
+	}
+	udpLen := int(binary.BigEndian.Uint16(udp[4:6]))
+	if fragment&0x2000 != 0 {
+		return nil, src, false, fmt.Errorf("%w: fragmented UDP message of %d bytes", errDHCPMessageTruncated, udpLen)
+	}
+	if udpLen < 8 {
+		return nil, nil, false, nil
+	}
+	if udpLen > len(udp) {
+		return nil, src, false, fmt.Errorf("%w: received %d of %d bytes", errDHCPMessageTruncated, len(udp), udpLen)
+	}
+	return udp[8:udpLen], src, true, nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/insomniacslk/dhcp/rfc1035label"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestDHCPMaxMessageSize(t *testing.T) {
+	for mtu, want := range map[int]uint16{0: 576, 1280: 1280, 1500: 1500, 9000: 9000, 70000: 65535} {
+		if got := dhcpMaxMessageSize(mtu); got != want {
+			t.Errorf("dhcpMaxMessageSize(%d) = %d, want %d", mtu, got, want)
+		}
+	}
+}
+
+// largeDHCPReply answers the DHCPDISCOVER and the DHCPREQUEST with many
+// classless routes, DNS servers and search domains, a message larger than
+// 1500 bytes.
+func largeDHCPReply(t *testing.T, request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+	serverIP := net.IPv4(192, 168, 10, 1)
+	messageType := dhcpv4.MessageTypeOffer
+	if request.MessageType() == dhcpv4.MessageTypeRequest {
+		messageType = dhcpv4.MessageTypeAck
+	}
+	var routes []*dhcpv4.Route
+	for i := range 200 {
+		routes = append(routes, &dhcpv4.Route{
+			Dest:   &net.IPNet{IP: net.IPv4(10, byte(i), 0, 0), Mask: net.CIDRMask(16, 32)},
+			Router: serverIP,
+		})
+	}
+	var dnsServers []net.IP
+	var searchDomains []string
+	for i := range 20 {
+		dnsServers = append(dnsServers, net.IPv4(192, 168, 20, byte(i)))
+		searchDomains = append(searchDomains, fmt.Sprintf("team%d.example.com", i))
+	}
+	reply, err := dhcpv4.NewReplyFromRequest(request,
+		dhcpv4.WithMessageType(messageType),
+		dhcpv4.WithServerIP(serverIP),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(serverIP)),
+		dhcpv4.WithYourIP(net.IPv4(192, 168, 10, 30)),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithOption(dhcpv4.OptClasslessStaticRoute(routes...)),
+		dhcpv4.WithDNS(dnsServers...),
+		dhcpv4.WithOption(dhcpv4.OptDomainSearch(&rfc1035label.Labels{Labels: searchDomains})),
+	)
+	if err != nil {
+		t.Errorf("failed to build %s: %v", messageType, err)
+		return nil
+	}
+	if size := len(reply.ToBytes()); size <= 1500 {
+		t.Errorf("%s of %d bytes, want a message larger than 1500 bytes", messageType, size)
+	}
+	return reply
+}
+
+func TestDHCPClientLargeOffer(t *testing.T) {
+	var mu sync.Mutex
+	var advertised []uint16
+	conn := newFakeDHCPConn(func(request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+		size, err := request.MaxMessageSize()
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			t.Errorf("%s without the maximum message size option: %v", request.MessageType(), err)
+		}
+		advertised = append(advertised, size)
+		return largeDHCPReply(t, request)
+	})
+	hwAddr, _ := net.ParseMAC("02:00:00:00:00:01")
+	client := newDHCPClient(conn, hwAddr, dhcpMaxMessageSize(9000))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ack, err := dhcpRequestLease(ctx, client, apis.InterfaceConfig{DHCP: ptr.To(true)})
+	if err != nil {
+		t.Fatalf("dhcpRequestLease() failed: %v", err)
+	}
+	ip, routes, _, err := dhcpLeaseConfig(ack)
+	if err != nil {
+		t.Fatalf("dhcpLeaseConfig() failed: %v", err)
+	}
+	if ip != "192.168.10.30/24" || len(routes) != 200 {
+		t.Errorf("lease = %s with %d routes, want 192.168.10.30/24 with 200 routes", ip, len(routes))
+	}
+	if _, searchDomains, err := dhcpDomains(ack); err != nil || len(searchDomains) != 20 {
+		t.Errorf("search domains = %v, %v, want 20 domains", searchDomains, err)
+	}
+	if dns := ack.DNS(); len(dns) != 20 {
+		t.Errorf("DNS servers = %v, want 20 servers", dns)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, size := range advertised {
+		if size != 9000 {
+			t.Errorf("advertised maximum message size = %d, want 9000", size)
+		}
+	}
+}
+
+func TestDHCPClientDiscardsOverflow(t *testing.T) {
+	conn := newFakeDHCPConn(func(request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+		return largeDHCPReply(t, request)
+	})
+	hwAddr, _ := net.ParseMAC("02:00:00:00:00:01")
+	// The server ignores the maximum message size, the reply does not fit the
+	// receive buffer.
+	client := newDHCPClient(conn, hwAddr, dhcpMaxMessageSize(1500))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := dhcpRequestLease(ctx, client, apis.InterfaceConfig{DHCP: ptr.To(true)}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("dhcpRequestLease() error = %v, want the truncated offer to be discarded", err)
+	}
+}
+
+func TestDHCPClientIPoIB(t *testing.T) {
+	hwAddr, err := net.ParseMAC("00:00:10:49:fe:80:00:00:00:00:00:00:f4:52:14:03:00:7b:cb:a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantClientID := []byte{0xff, 0x00, 0x7b, 0xcb, 0xa1, 0x00, 0x03, 0x00, 0x20, 0xf4, 0x52, 0x14, 0x03, 0x00, 0x7b, 0xcb, 0xa1}
+	conn := newFakeDHCPConn(func(request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+		if request.HWType != iana.HWTypeInfiniband || len(request.ClientHWAddr) != 0 || !request.IsBroadcast() {
+			t.Errorf("%s hardware type %s, chaddr %q and broadcast %v, want InfiniBand, an empty chaddr and broadcast", request.MessageType(), request.HWType, request.ClientHWAddr, request.IsBroadcast())
+		}
+		if clientID := request.Options.Get(dhcpv4.OptionClientIdentifier); !bytes.Equal(clientID, wantClientID) {
+			t.Errorf("%s client identifier = %x, want %x", request.MessageType(), clientID, wantClientID)
+		}
+		messageType := dhcpv4.MessageTypeOffer
+		if request.MessageType() == dhcpv4.MessageTypeRequest {
+			messageType = dhcpv4.MessageTypeAck
+		}
+		reply, err := dhcpv4.NewReplyFromRequest(request,
+			dhcpv4.WithMessageType(messageType),
+			dhcpv4.WithServerIP(net.IPv4(192, 168, 10, 1)),
+			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.IPv4(192, 168, 10, 1))),
+			dhcpv4.WithYourIP(net.IPv4(192, 168, 10, 30)),
+			dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		)
+		if err != nil {
+			t.Errorf("failed to build %s: %v", messageType, err)
+			return nil
+		}
+		return reply
+	})
+	client := newDHCPClient(conn, hwAddr, dhcpMaxMessageSize(2044))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ack, err := dhcpRequestLease(ctx, client, apis.InterfaceConfig{DHCP: ptr.To(true)})
+	if err != nil {
+		t.Fatalf("dhcpRequestLease() failed: %v", err)
+	}
+	if !ack.YourIPAddr.Equal(net.IPv4(192, 168, 10, 30)) {
+		t.Errorf("leased address = %s, want 192.168.10.30", ack.YourIPAddr)
+	}
+}
+
+// ipv4UDPPacket returns an IPv4 packet with the UDP payload sent to port, the
+// UDP length is set to udpLen if not zero.
+func ipv4UDPPacket(port uint16, fragment uint16, payload []byte, udpLen int) []byte {
+	if udpLen == 0 {
+		udpLen = 8 + len(payload)
+	}
+	pkt := make([]byte, 28, 28+len(payload))
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:4], uint16(28+len(payload)))
+	binary.BigEndian.PutUint16(pkt[6:8], fragment)
+	pkt[8] = 64
+	pkt[9] = 17
+	copy(pkt[12:16], net.IPv4(192, 168, 10, 1).To4())
+	copy(pkt[16:20], net.IPv4bcast.To4())
+	binary.BigEndian.PutUint16(pkt[20:22], 67)
+	binary.BigEndian.PutUint16(pkt[22:24], port)
+	binary.BigEndian.PutUint16(pkt[24:26], uint16(udpLen))
+	return append(pkt, payload...)
+}
+
+func TestDHCPPayloadFromIPv4(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xaa}, 300)
+	tests := []struct {
+		name          string
+		pkt           []byte
+		wantOk        bool
+		wantTruncated bool
+	}{
+		{
+			name:   "complete message",
+			pkt:    ipv4UDPPacket(68, 0, payload, 0),
+			wantOk: true,
+		},
+		{
+			name: "other port",
+			pkt:  ipv4UDPPacket(546, 0, payload, 0),
+		},
+		{
+			name:          "first fragment",
+			pkt:           ipv4UDPPacket(68, 0x2000, payload, 2000),
+			wantTruncated: true,
+		},
+		{
+			name: "next fragment",
+			pkt:  ipv4UDPPacket(68, 185, payload, 0),
+		},
+		{
+			name:          "shorter than the UDP length",
+			pkt:           ipv4UDPPacket(68, 0, payload, 2000),
+			wantTruncated: true,
+		},
+		{
+			name: "not IPv4",
+			pkt:  []byte{0x60, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, src, ok, err := dhcpPayloadFromIPv4(tt.pkt)
+			if errors.Is(err, errDHCPMessageTruncated) != tt.wantTruncated {
+				t.Fatalf("dhcpPayloadFromIPv4() error = %v, want truncated %v", err, tt.wantTruncated)
+			}
+			if ok != tt.wantOk {
+				t.Fatalf("dhcpPayloadFromIPv4() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && (!bytes.Equal(got, payload) || src.String() != "192.168.10.1:67") {
+				t.Errorf("dhcpPayloadFromIPv4() = %d bytes from %v, want %d bytes from 192.168.10.1:67", len(got), src, len(payload))
+			}
+		})
+	}
+}
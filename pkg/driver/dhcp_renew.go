@@ -0,0 +1,487 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/types"
+	resourceapply "k8s.io/client-go/applyconfigurations/resource/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// The DHCP leases of the interfaces moved to the Pods are renewed from the
+// Pod network namespace while the Pods run (RFC 2131 section 4.4.5). At T1 the
+// DHCPREQUEST is unicast to the server of the lease, if it does not answer by
+// T2 the request is broadcast to any server until the lease expires. The
+// server can acknowledge another address, the address, routes and rules of
+// the previous lease are then replaced on the interface and the new address
+// is published in the ResourceClaim status.
+
+// dhcpRenewalRetryInterval is the wait before a renewal that could not be
+// sent, e.g. the client socket could not be opened, is tried again.
+const dhcpRenewalRetryInterval = time.Minute
+
+// dhcpRenewal is the renewal goroutine of the lease of a device.
+type dhcpRenewal struct {
+	cancel context.CancelFunc
+}
+
+// newDHCPLease returns the lease of the address ip granted by the DHCPACK to
+// the client with the hardware address hwAddr.
+func newDHCPLease(ack *dhcpv4.DHCPv4, ip string, hwAddr net.HardwareAddr, obtained time.Time) *DHCPLease {
+	leaseTime := ack.IPAddressLeaseTime(0)
+	renewal := ack.IPAddressRenewalTime(leaseTime / 2)
+	rebinding := ack.IPAddressRebindingTime(leaseTime * 7 / 8)
+	// The times of the server are ignored if they are not in order, the
+	// defaults are 0.5 and 0.875 of the lease time.
+	if renewal <= 0 || renewal >= rebinding || rebinding >= leaseTime {
+		renewal, rebinding = leaseTime/2, leaseTime*7/8
+	}
+	lease := &DHCPLease{
+		Address:       ip,
+		HardwareAddr:  hwAddr.String(),
+		Obtained:      obtained,
+		LeaseTime:     leaseTime,
+		RenewalTime:   renewal,
+		RebindingTime: rebinding,
+	}
+	if server := ack.ServerIdentifier(); server != nil {
+		lease.ServerID = server.String()
+	}
+	return lease
+}
+
+// renewable returns false for the infinite leases and the leases without a
+// lease time, they are never renewed.
+func (l *DHCPLease) renewable() bool {
+	return l.LeaseTime > 0 && l.LeaseTime < dhcpv4.MaxLeaseTime
+}
+
+// renewAt returns T1, when the lease is renewed from its server.
+func (l *DHCPLease) renewAt() time.Time {
+	return l.Obtained.Add(l.RenewalTime)
+}
+
+// rebindAt returns T2, when the lease is renewed from any server.
+func (l *DHCPLease) rebindAt() time.Time {
+	return l.Obtained.Add(l.RebindingTime)
+}
+
+// expiresAt returns the end of the lease.
+func (l *DHCPLease) expiresAt() time.Time {
+	return l.Obtained.Add(l.LeaseTime)
+}
+
+// newRenewRequest returns the DHCPREQUEST of a client in the RENEWING or
+// REBINDING state: the leased address is in ciaddr, without requested address
+// and server identifier (RFC 2131 section 4.3.2). It requests the same options
+// as a DHCPDISCOVER.
+func newRenewRequest(hwaddr net.HardwareAddr, clientIP net.IP, modifiers ...dhcpv4.Modifier) (*dhcpv4.DHCPv4, error) {
+	return dhcpv4.New(dhcpv4.PrependModifiers(modifiers,
+		dhcpv4.WithHwAddr(hwaddr),
+		dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask, dhcpv4.OptionRouter, dhcpv4.OptionDomainName, dhcpv4.OptionDomainNameServer),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+		dhcpv4.WithClientIP(clientIP),
+	)...)
+}
+
+// dhcpRenew extends the lease and returns the DHCPACK, which may grant another
+// address. The DHCPREQUEST is unicast to the server of the lease until T2,
+// then broadcast to all the servers until the lease expires. A DHCPNAK is
+// returned as a nclient4.ErrNak, the lease must not be used anymore.
+func dhcpRenew(ctx context.Context, client *dhcpClient, lease *DHCPLease, modifiers []dhcpv4.Modifier) (*dhcpv4.DHCPv4, error) {
+	prefix, err := netip.ParsePrefix(lease.Address)
+	if err != nil || !prefix.Addr().Is4() {
+		return nil, fmt.Errorf("invalid DHCP lease address %q", lease.Address)
+	}
+	// The client has an address, the replies are unicast to it.
+	request, err := newRenewRequest(client.hwAddr, net.IP(prefix.Addr().AsSlice()), slices.Concat(modifiers, []dhcpv4.Modifier{dhcpv4.WithBroadcast(false)}, client.hwModifiers)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the DHCPREQUEST: %w", err)
+	}
+
+	if server := net.ParseIP(lease.ServerID).To4(); server != nil && time.Now().Before(lease.rebindAt()) {
+		renewCtx, cancel := context.WithDeadline(ctx, lease.rebindAt())
+		ack, err := dhcpRequestUntilAnswered(renewCtx, client, request, &net.UDPAddr{IP: server, Port: nclient4.ServerPort})
+		cancel()
+		var nak *nclient4.ErrNak
+		if err == nil || ctx.Err() != nil || errors.As(err, &nak) {
+			return ack, err
+		}
+		klog.Infof("DHCP server %s did not renew the lease of %s, rebinding: %v", server, lease.Address, err)
+	}
+
+	rebindCtx, cancel := context.WithDeadline(ctx, lease.expiresAt())
+	defer cancel()
+	ack, err := dhcpRequestUntilAnswered(rebindCtx, client, request, nclient4.DefaultServers)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("DHCP lease of %s expired without an answer of the servers: %w", lease.Address, err)
+	}
+	return ack, err
+}
+
+// dhcpRequestUntilAnswered sends the DHCPREQUEST to dst until a server
+// answers or the context is done, and returns the DHCPACK.
+func dhcpRequestUntilAnswered(ctx context.Context, client *dhcpClient, request *dhcpv4.DHCPv4, dst net.Addr) (*dhcpv4.DHCPv4, error) {
+	for {
+		response, err := client.sendAndReadTo(ctx, request, dst, nclient4.IsMessageType(dhcpv4.MessageTypeAck, dhcpv4.MessageTypeNak))
+		if errors.Is(err, nclient4.ErrNoResponse) && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if response.MessageType() == dhcpv4.MessageTypeNak {
+			return nil, &nclient4.ErrNak{Nak: response}
+		}
+		return response, nil
+	}
+}
+
+// newDHCPUDPConnAt opens the UDP socket of the DHCP client on the interface
+// of the namespace. The interface has the leased address, the servers answer
+// the renewals with unicast replies to it.
+func newDHCPUDPConnAt(containerNs netns.NsHandle, ifName string) (net.PacketConn, error) {
+	origns, err := netns.Get()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close() // nolint:errcheck
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := netns.Set(containerNs); err != nil {
+		return nil, fmt.Errorf("failed to join network namespace: %v", err)
+	}
+	defer netns.Set(origns) // nolint:errcheck
+	return newDHCPUDPConn(ifName)
+}
+
+// renewDHCPLeaseAt renews the lease of the device from the interface in the
+// namespace of the Pod.
+func renewDHCPLeaseAt(ctx context.Context, containerNsPath string, config DeviceConfig) (*dhcpv4.DHCPv4, error) {
+	ifName := config.NetworkInterfaceConfigInPod.Interface.Name
+	hwAddr, err := net.ParseMAC(config.DHCPLease.HardwareAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hardware address of the DHCP lease of %s: %w", ifName, err)
+	}
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return nil, fmt.Errorf("can not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	conn, err := newDHCPUDPConnAt(containerNs, ifName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DHCP client on interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	client := newDHCPClient(conn, hwAddr, dhcpMaxMessageSize(nsLink.Attrs().MTU))
+	defer client.Close()
+	return dhcpRenew(ctx, client, config.DHCPLease, dhcpModifiers(config.NetworkInterfaceConfigInPod.Interface))
+}
+
+// startDHCPRenewals starts the renewals of the DHCP leases of the devices of
+// the Pod.
+func (np *NetworkDriver) startDHCPRenewals(podUID types.UID) {
+	podConfig, ok := np.podConfigStore.GetPodConfig(podUID)
+	if !ok {
+		return
+	}
+	for deviceName, config := range podConfig.DeviceConfigs {
+		if config.DHCPLease != nil && config.DHCPLease.renewable() {
+			np.startDHCPRenewal(podUID, deviceName)
+		}
+	}
+}
+
+// startDHCPRenewal starts the renewal of the DHCP lease of the device of the
+// Pod, if it is not already running.
+func (np *NetworkDriver) startDHCPRenewal(podUID types.UID, deviceName string) {
+	key := string(podUID) + "/" + deviceName
+	np.dhcpRenewalsMu.Lock()
+	defer np.dhcpRenewalsMu.Unlock()
+	if _, ok := np.dhcpRenewals[key]; ok {
+		return
+	}
+	if np.dhcpRenewals == nil {
+		np.dhcpRenewals = map[string]*dhcpRenewal{}
+	}
+	// The renewals stop when the driver does.
+	ctx := np.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	renewal := &dhcpRenewal{cancel: cancel}
+	np.dhcpRenewals[key] = renewal
+	go func() {
+		defer func() {
+			np.dhcpRenewalsMu.Lock()
+			defer np.dhcpRenewalsMu.Unlock()
+			if np.dhcpRenewals[key] == renewal {
+				delete(np.dhcpRenewals, key)
+			}
+			cancel()
+		}()
+		np.runDHCPRenewal(ctx, podUID, deviceName)
+	}()
+}
+
+// stopDHCPRenewals stops the renewals of the DHCP leases of the devices of the
+// Pod.
+func (np *NetworkDriver) stopDHCPRenewals(podUID types.UID) {
+	np.dhcpRenewalsMu.Lock()
+	defer np.dhcpRenewalsMu.Unlock()
+	for key, renewal := range np.dhcpRenewals {
+		if strings.HasPrefix(key, string(podUID)+"/") {
+			renewal.cancel()
+			delete(np.dhcpRenewals, key)
+		}
+	}
+}
+
+// runDHCPRenewal renews the DHCP lease of the device at T1 until the context
+// is done, the interface leaves the Pod namespace or the lease is lost. A
+// lease refused by the server or expired is not requested again, the
+// interface keeps its address but it may be granted to another client.
+func (np *NetworkDriver) runDHCPRenewal(ctx context.Context, podUID types.UID, deviceName string) {
+	var retryAt time.Time
+	for {
+		config, ns, ok := np.runningDeviceConfig(podUID, deviceName)
+		if !ok || config.DHCPLease == nil || !config.DHCPLease.renewable() {
+			return
+		}
+		lease := config.DHCPLease
+		now := np.clock.Now()
+		if !now.Before(lease.expiresAt()) {
+			klog.Warningf("DHCP lease of %s of device %s of pod %s expired at %v", lease.Address, deviceName, podUID, lease.expiresAt())
+			return
+		}
+		if next := lease.renewAt(); now.Before(next) || now.Before(retryAt) {
+			if retryAt.After(next) {
+				next = retryAt
+			}
+			timer := np.clock.NewTimer(next.Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			continue
+		}
+
+		klog.V(2).Infof("Renewing the DHCP lease of %s of device %s of pod %s", lease.Address, deviceName, podUID)
+		ack, err := renewDHCPLeaseAt(ctx, ns, config)
+		if ctx.Err() != nil {
+			return
+		}
+		var nak *nclient4.ErrNak
+		if errors.As(err, &nak) {
+			klog.Warningf("DHCP server refused to renew the lease of %s of device %s of pod %s: %v", lease.Address, deviceName, podUID, err)
+			return
+		}
+		if err == nil {
+			err = np.updateDHCPLease(ctx, podUID, deviceName, ns, config, ack)
+		}
+		if err != nil {
+			klog.Infof("failed to renew the DHCP lease of %s of device %s of pod %s, retrying in %v: %v", lease.Address, deviceName, podUID, dhcpRenewalRetryInterval, err)
+			retryAt = np.clock.Now().Add(dhcpRenewalRetryInterval)
+		}
+	}
+}
+
+// updateDHCPLease applies the renewed lease of the DHCPACK to the interface
+// of the device and stores it. If the server granted another address, the
+// address is updated in the ResourceClaim status.
+func (np *NetworkDriver) updateDHCPLease(ctx context.Context, podUID types.UID, deviceName string, ns string, config DeviceConfig, ack *dhcpv4.DHCPv4) error {
+	ifCfg := config.NetworkInterfaceConfigInPod.Interface
+	hwAddr, err := net.ParseMAC(config.DHCPLease.HardwareAddr)
+	if err != nil {
+		return err
+	}
+	result, err := newDHCPResult(ack, ifCfg, hwAddr)
+	if err != nil {
+		return err
+	}
+	result.state.Routes, result.state.Rules, err = dhcpLeaseRouting(ifCfg, result)
+	if err != nil {
+		return err
+	}
+	updated, err := applyDHCPLease(ns, config, result.state)
+	if err != nil {
+		return err
+	}
+	if err := np.podConfigStore.SetDeviceConfig(podUID, deviceName, updated); err != nil {
+		return err
+	}
+	if updated.DHCPLease.Address == config.DHCPLease.Address {
+		klog.V(2).Infof("DHCP lease of %s of device %s of pod %s renewed until %v", updated.DHCPLease.Address, deviceName, podUID, updated.DHCPLease.expiresAt())
+		return nil
+	}
+
+	klog.Infof("DHCP server granted %s instead of %s to device %s of pod %s", updated.DHCPLease.Address, config.DHCPLease.Address, deviceName, podUID)
+	claim := types.NamespacedName{Name: config.Claim.Name, Namespace: config.Claim.Namespace}
+	status := resourceapply.ResourceClaimStatus().WithDevices(resourceapply.AllocatedDeviceStatus().
+		WithDevice(deviceName).
+		WithDriver(np.driverName).
+		WithPool(np.nodeName).
+		WithNetworkData(resourceapply.NetworkDeviceData().
+			WithInterfaceName(ifCfg.Name).
+			WithIPs(updated.NetworkInterfaceConfigInPod.Interface.Addresses...),
+		))
+	resourceClaimApply := resourceapply.ResourceClaim(claim.Name, claim.Namespace).WithStatus(status)
+	if err := np.applyClaimStatus(ctx, np.dhcpFieldManager(), claim, resourceClaimApply); err != nil {
+		klog.Infof("failed to update the addresses of device %s in the status of claim %s/%s : %v", deviceName, claim.Namespace, claim.Name, err)
+	}
+	return nil
+}
+
+// dhcpFieldManager returns the field manager of the addresses of the devices
+// updated by the DHCP renewals. It is different from the one of the
+// RunPodSandbox status so applying the addresses alone does not remove the
+// conditions of the device.
+func (np *NetworkDriver) dhcpFieldManager() string {
+	return np.driverName + "-dhcp"
+}
+
+// applyDHCPLease replaces the address, routes and rules of the previous lease
+// of the device on its interface in the namespace with the ones of lease, and
+// returns the configuration of the device with the new lease.
+func applyDHCPLease(containerNsPath string, config DeviceConfig, lease *DHCPLease) (DeviceConfig, error) {
+	previous := config.DHCPLease
+	ifName := config.NetworkInterfaceConfigInPod.Interface.Name
+	removedRoutes, addedRoutes := routesDelta(previous.Routes, lease.Routes)
+	removedRules, addedRules := rulesDelta(previous.Rules, lease.Rules)
+	vrfTable := 0
+	if vrf := config.NetworkInterfaceConfigInPod.Interface.VRF; vrf != nil && vrf.Table != nil {
+		vrfTable = int(*vrf.Table)
+	}
+
+	if lease.Address != previous.Address {
+		if err := replaceInterfaceAddress(containerNsPath, ifName, previous.Address, lease.Address); err != nil {
+			return config, err
+		}
+	}
+	if err := removeRulesConfig(containerNsPath, removedRules); err != nil {
+		return config, err
+	}
+	if err := removeRoutingConfig(containerNsPath, ifName, removedRoutes, vrfTable); err != nil {
+		return config, err
+	}
+	if _, err := applyRoutingConfig(containerNsPath, ifName, slices.Clone(addedRoutes), vrfTable); err != nil {
+		return config, err
+	}
+	if err := applyRulesConfig(containerNsPath, addedRules); err != nil {
+		return config, err
+	}
+
+	updated := config
+	addresses := slices.Clone(config.NetworkInterfaceConfigInPod.Interface.Addresses)
+	if i := slices.Index(addresses, previous.Address); i >= 0 {
+		addresses[i] = lease.Address
+	} else {
+		addresses = append(addresses, lease.Address)
+	}
+	updated.NetworkInterfaceConfigInPod.Interface.Addresses = addresses
+	routes := slices.DeleteFunc(slices.Clone(config.NetworkInterfaceConfigInPod.Routes), func(r apis.RouteConfig) bool {
+		return slices.ContainsFunc(removedRoutes, func(route apis.RouteConfig) bool { return reflect.DeepEqual(r, route) })
+	})
+	updated.NetworkInterfaceConfigInPod.Routes = append(routes, addedRoutes...)
+	rules := slices.DeleteFunc(slices.Clone(config.NetworkInterfaceConfigInPod.Rules), func(r apis.RuleConfig) bool {
+		return slices.ContainsFunc(removedRules, func(rule apis.RuleConfig) bool { return reflect.DeepEqual(r, rule) })
+	})
+	updated.NetworkInterfaceConfigInPod.Rules = append(rules, addedRules...)
+	updated.DHCPLease = lease
+	return updated, nil
+}
+
+// rulesDelta returns the rules of current that are not requested anymore and
+// the requested rules that are not in current.
+func rulesDelta(current, requested []apis.RuleConfig) (removed, added []apis.RuleConfig) {
+	for _, rule := range current {
+		if !slices.ContainsFunc(requested, func(r apis.RuleConfig) bool { return reflect.DeepEqual(r, rule) }) {
+			removed = append(removed, rule)
+		}
+	}
+	for _, rule := range requested {
+		if !slices.ContainsFunc(current, func(r apis.RuleConfig) bool { return reflect.DeepEqual(r, rule) }) {
+			added = append(added, rule)
+		}
+	}
+	return removed, added
+}
+
+// replaceInterfaceAddress adds the address to the interface in the namespace
+// and deletes the previous one.
+func replaceInterfaceAddress(containerNsPath string, ifName string, previous, address string) error {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return err
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("can not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	if _, err := addInterfaceAddresses(nhNs, nsLink, []string{address}, nil); err != nil {
+		return err
+	}
+	addr, err := netlink.ParseAddr(previous)
+	if err != nil {
+		return err
+	}
+	if err := nhNs.AddrDel(nsLink, addr); err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+		return fmt.Errorf("fail to delete address %s of interface %s on namespace %s: %w", previous, ifName, containerNsPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestNewDHCPLease(t *testing.T) {
+	obtained := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		options       []dhcpv4.Option
+		wantLease     time.Duration
+		wantRenewal   time.Duration
+		wantRebinding time.Duration
+		wantRenewable bool
+	}{
+		{
+			name:          "default renewal and rebinding times",
+			options:       []dhcpv4.Option{dhcpv4.OptIPAddressLeaseTime(time.Hour)},
+			wantLease:     time.Hour,
+			wantRenewal:   30 * time.Minute,
+			wantRebinding: 52*time.Minute + 30*time.Second,
+			wantRenewable: true,
+		},
+		{
+			name: "renewal and rebinding times of the server",
+			options: []dhcpv4.Option{
+				dhcpv4.OptIPAddressLeaseTime(time.Hour),
+				dhcpv4.OptRenewTimeValue(10 * time.Minute),
+				dhcpv4.OptRebindingTimeValue(20 * time.Minute),
+			},
+			wantLease:     time.Hour,
+			wantRenewal:   10 * time.Minute,
+			wantRebinding: 20 * time.Minute,
+			wantRenewable: true,
+		},
+		{
+			name: "rebinding time after the end of the lease",
+			options: []dhcpv4.Option{
+				dhcpv4.OptIPAddressLeaseTime(time.Hour),
+				dhcpv4.OptRenewTimeValue(10 * time.Minute),
+				dhcpv4.OptRebindingTimeValue(2 * time.Hour),
+			},
+			wantLease:     time.Hour,
+			wantRenewal:   30 * time.Minute,
+			wantRebinding: 52*time.Minute + 30*time.Second,
+			wantRenewable: true,
+		},
+		{
+			name:          "infinite lease",
+			options:       []dhcpv4.Option{dhcpv4.OptIPAddressLeaseTime(dhcpv4.MaxLeaseTime)},
+			wantLease:     dhcpv4.MaxLeaseTime,
+			wantRenewal:   dhcpv4.MaxLeaseTime / 2,
+			wantRebinding: dhcpv4.MaxLeaseTime * 7 / 8,
+		},
+		{
+			name: "no lease time",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, err := dhcpv4.New(dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+				dhcpv4.WithOption(dhcpv4.OptServerIdentifier(net.IPv4(192, 168, 10, 1))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, option := range tt.options {
+				ack.UpdateOption(option)
+			}
+			hwAddr := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+			lease := newDHCPLease(ack, "192.168.10.20/24", hwAddr, obtained)
+			if lease.LeaseTime != tt.wantLease || lease.RenewalTime != tt.wantRenewal || lease.RebindingTime != tt.wantRebinding {
+				t.Errorf("newDHCPLease() times = %v, %v, %v, want %v, %v, %v", lease.LeaseTime, lease.RenewalTime, lease.RebindingTime, tt.wantLease, tt.wantRenewal, tt.wantRebinding)
+			}
+			if lease.ServerID != "192.168.10.1" || lease.HardwareAddr != hwAddr.String() || !lease.Obtained.Equal(obtained) {
+				t.Errorf("newDHCPLease() = %+v, want the server, hardware address and time of the lease", lease)
+			}
+			if got := lease.renewable(); got != tt.wantRenewable {
+				t.Errorf("renewable() = %v, want %v", got, tt.wantRenewable)
+			}
+		})
+	}
+}
+
+func TestDHCPRenew(t *testing.T) {
+	serverIP := net.IPv4(192, 168, 10, 1)
+	leasedIP := net.IPv4(192, 168, 10, 20)
+	otherIP := net.IPv4(192, 168, 10, 30)
+	unicast := (&net.UDPAddr{IP: serverIP.To4(), Port: nclient4.ServerPort}).String()
+	broadcast := nclient4.DefaultServers.String()
+	reply := func(t *testing.T, request *dhcpv4.DHCPv4, messageType dhcpv4.MessageType, ip net.IP) *dhcpv4.DHCPv4 {
+		msg, err := dhcpv4.NewReplyFromRequest(request,
+			dhcpv4.WithMessageType(messageType),
+			dhcpv4.WithServerIP(serverIP),
+			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(serverIP)),
+			dhcpv4.WithYourIP(ip),
+			dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+			dhcpv4.WithLeaseTime(3600),
+		)
+		if err != nil {
+			t.Errorf("failed to build %s: %v", messageType, err)
+			return nil
+		}
+		return msg
+	}
+	// The leases start renewing now and rebind in 300ms, unless the test
+	// sets the time elapsed since they were obtained.
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		expiry   time.Duration
+		handler  func(t *testing.T, request *dhcpv4.DHCPv4, dst net.Addr) *dhcpv4.DHCPv4
+		wantIP   net.IP
+		wantNak  bool
+		wantErr  bool
+		wantSent []string
+	}{
+		{
+			name: "renewed by the server of the lease",
+			handler: func(t *testing.T, request *dhcpv4.DHCPv4, _ net.Addr) *dhcpv4.DHCPv4 {
+				return reply(t, request, dhcpv4.MessageTypeAck, request.ClientIPAddr)
+			},
+			wantIP:   leasedIP,
+			wantSent: []string{unicast},
+		},
+		{
+			name: "server of the lease down, rebound with another address",
+			handler: func(t *testing.T, request *dhcpv4.DHCPv4, dst net.Addr) *dhcpv4.DHCPv4 {
+				if dst.String() != broadcast {
+					return nil
+				}
+				return reply(t, request, dhcpv4.MessageTypeAck, otherIP)
+			},
+			wantIP:   otherIP,
+			wantSent: []string{unicast, broadcast},
+		},
+		{
+			name:    "rebinding after T2",
+			elapsed: time.Second,
+			handler: func(t *testing.T, request *dhcpv4.DHCPv4, _ net.Addr) *dhcpv4.DHCPv4 {
+				return reply(t, request, dhcpv4.MessageTypeAck, request.ClientIPAddr)
+			},
+			wantIP:   leasedIP,
+			wantSent: []string{broadcast},
+		},
+		{
+			name: "refused by the server",
+			handler: func(t *testing.T, request *dhcpv4.DHCPv4, _ net.Addr) *dhcpv4.DHCPv4 {
+				return reply(t, request, dhcpv4.MessageTypeNak, nil)
+			},
+			wantNak:  true,
+			wantErr:  true,
+			wantSent: []string{unicast},
+		},
+		{
+			name:     "expired without answer",
+			expiry:   600 * time.Millisecond,
+			handler:  func(*testing.T, *dhcpv4.DHCPv4, net.Addr) *dhcpv4.DHCPv4 { return nil },
+			wantErr:  true,
+			wantSent: []string{unicast, broadcast},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hwAddr := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+			conn := newFakeDHCPConnTo(func(request *dhcpv4.DHCPv4, dst net.Addr) *dhcpv4.DHCPv4 {
+				if request.MessageType() != dhcpv4.MessageTypeRequest || !request.ClientIPAddr.Equal(leasedIP) ||
+					request.Options.Has(dhcpv4.OptionRequestedIPAddress) || request.Options.Has(dhcpv4.OptionServerIdentifier) {
+					t.Errorf("unexpected renewal request %s", request.Summary())
+					return nil
+				}
+				return tt.handler(t, request, dst)
+			})
+			client := newDHCPClient(conn, hwAddr, dhcpMinMessageSize)
+			defer client.Close()
+
+			expiry := tt.expiry
+			if expiry == 0 {
+				expiry = time.Hour
+			}
+			obtained := time.Now().Add(-time.Second - tt.elapsed)
+			lease := &DHCPLease{
+				Address:       "192.168.10.20/24",
+				ServerID:      serverIP.String(),
+				HardwareAddr:  hwAddr.String(),
+				Obtained:      obtained,
+				RenewalTime:   time.Second,
+				RebindingTime: time.Second + 300*time.Millisecond,
+				LeaseTime:     time.Second + expiry,
+			}
+			ack, err := dhcpRenew(context.Background(), client, lease, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dhcpRenew() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var nak *nclient4.ErrNak
+			if errors.As(err, &nak) != tt.wantNak {
+				t.Errorf("dhcpRenew() error = %v, want DHCPNAK %v", err, tt.wantNak)
+			}
+			if err == nil && !ack.YourIPAddr.Equal(tt.wantIP) {
+				t.Errorf("dhcpRenew() acknowledged %v, want %v", ack.YourIPAddr, tt.wantIP)
+			}
+			sent := conn.sentTo()
+			var destinations []string
+			for _, dst := range sent {
+				if len(destinations) == 0 || destinations[len(destinations)-1] != dst {
+					destinations = append(destinations, dst)
+				}
+			}
+			if diff := cmp.Diff(tt.wantSent, destinations); diff != "" {
+				t.Errorf("destinations of the requests (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateDHCPLeaseAnotherAddress(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	if err := nhNs.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	// The interface of the running pod, configured with the first lease.
+	nsPath := path.Join("/run/netns", nsName)
+	const table = 1060
+	ifCfg := apis.InterfaceConfig{Name: ifaceName, DHCP: ptr.To(true), DHCPRouteTable: ptr.To(table), Addresses: []string{"192.168.60.10/24"}}
+	routes, rules, err := dhcpRoutingConfig("192.168.60.10/24", nil, "192.168.60.1", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsLink, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addInterfaceAddresses(nhNs, nsLink, ifCfg.Addresses, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyRoutingConfig(nsPath, ifaceName, routes, 0); err != nil {
+		t.Fatalf("applyRoutingConfig() failed: %v", err)
+	}
+	if err := applyRulesConfig(nsPath, rules); err != nil {
+		t.Fatalf("applyRulesConfig() failed: %v", err)
+	}
+
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+	kubeClient := fake.NewClientset(claim)
+	store, err := NewPodConfigStore(nil)
+	if err != nil {
+		t.Fatalf("NewPodConfigStore() failed: %v", err)
+	}
+	podUID := types.UID("pod1")
+	hwAddr := net.HardwareAddr{0x02, 0, 0, 0, 0x60, 0x10}
+	config := DeviceConfig{
+		Claim:                        types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+		NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: "eth1"}},
+		NetworkInterfaceConfigInPod: apis.NetworkConfig{
+			Interface: ifCfg,
+			Routes:    routes,
+			Rules:     rules,
+		},
+		DHCPLease: &DHCPLease{
+			Address:       "192.168.60.10/24",
+			ServerID:      "192.168.60.1",
+			HardwareAddr:  hwAddr.String(),
+			Obtained:      time.Now().Add(-30 * time.Minute),
+			LeaseTime:     time.Hour,
+			RenewalTime:   30 * time.Minute,
+			RebindingTime: 52 * time.Minute,
+			Routes:        routes,
+			Rules:         rules,
+		},
+	}
+	if err := store.SetDeviceConfig(podUID, "eth0", config); err != nil {
+		t.Fatalf("SetDeviceConfig() failed: %v", err)
+	}
+	store.SetPodNetNs(podUID, nsPath)
+	np := &NetworkDriver{
+		driverName:     "dra.net",
+		nodeName:       "node1",
+		kubeClient:     kubeClient,
+		podConfigStore: store,
+		clock:          testingclock.NewFakeClock(time.Now()),
+	}
+
+	// The server rebinding the lease grants an address of another subnet.
+	serverIP := net.IPv4(192, 168, 61, 1)
+	ack, err := dhcpv4.New(
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeAck),
+		dhcpv4.WithHwAddr(hwAddr),
+		dhcpv4.WithYourIP(net.IPv4(192, 168, 61, 20)),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithRouter(serverIP),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(serverIP)),
+		dhcpv4.WithLeaseTime(3600),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := np.updateDHCPLease(ctx, podUID, "eth0", nsPath, config, ack); err != nil {
+		t.Fatalf("updateDHCPLease() failed: %v", err)
+	}
+
+	addrs, err := nhNs.AddrList(nsLink, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotAddrs []string
+	for _, addr := range addrs {
+		gotAddrs = append(gotAddrs, addr.IPNet.String())
+	}
+	if diff := cmp.Diff([]string{"192.168.61.20/24"}, gotAddrs); diff != "" {
+		t.Errorf("interface addresses (-want +got):\n%s", diff)
+	}
+	tableRoutes, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotRoutes []string
+	for _, route := range tableRoutes {
+		gotRoutes = append(gotRoutes, fmt.Sprintf("%v via %v", route.Dst, route.Gw))
+	}
+	if diff := cmp.Diff([]string{"0.0.0.0/0 via 192.168.61.1", "192.168.61.0/24 via <nil>"}, gotRoutes); diff != "" {
+		t.Errorf("routes of table %d (-want +got):\n%s", table, diff)
+	}
+	nsRules, err := nhNs.RuleListFiltered(netlink.FAMILY_V4, &netlink.Rule{Table: table}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotRules []string
+	for _, rule := range nsRules {
+		gotRules = append(gotRules, rule.Src.String())
+	}
+	if diff := cmp.Diff([]string{"192.168.61.20/32"}, gotRules); diff != "" {
+		t.Errorf("sources of the rules of table %d (-want +got):\n%s", table, diff)
+	}
+
+	stored, ok := store.GetDeviceConfig(podUID, "eth0")
+	if !ok {
+		t.Fatal("device config not found after the update")
+	}
+	if diff := cmp.Diff([]string{"192.168.61.20/24"}, stored.NetworkInterfaceConfigInPod.Interface.Addresses); diff != "" {
+		t.Errorf("stored addresses (-want +got):\n%s", diff)
+	}
+	if stored.DHCPLease.Address != "192.168.61.20/24" || stored.DHCPLease.ServerID != "192.168.61.1" {
+		t.Errorf("stored lease = %+v, want the lease of 192.168.61.20/24 from 192.168.61.1", stored.DHCPLease)
+	}
+	if diff := cmp.Diff(stored.DHCPLease.Routes, stored.NetworkInterfaceConfigInPod.Routes); diff != "" {
+		t.Errorf("stored routes (-want +got):\n%s", diff)
+	}
+
+	got, err := kubeClient.ResourceV1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get claim: %v", err)
+	}
+	if len(got.Status.Devices) != 1 || got.Status.Devices[0].NetworkData == nil {
+		t.Fatalf("claim status devices = %+v, want the network data of the device", got.Status.Devices)
+	}
+	if diff := cmp.Diff([]string{"192.168.61.20/24"}, got.Status.Devices[0].NetworkData.IPs); diff != "" {
+		t.Errorf("claim status IPs (-want +got):\n%s", diff)
+	}
+
+	// The renewal waits for T1 of the new lease until the pod stops.
+	np.startDHCPRenewals(podUID)
+	np.dhcpRenewalsMu.Lock()
+	running := len(np.dhcpRenewals)
+	np.dhcpRenewalsMu.Unlock()
+	if running != 1 {
+		t.Errorf("running DHCP renewals = %d, want 1", running)
+	}
+	np.stopDHCPRenewals(podUID)
+	np.dhcpRenewalsMu.Lock()
+	running = len(np.dhcpRenewals)
+	np.dhcpRenewalsMu.Unlock()
+	if running != 0 {
+		t.Errorf("running DHCP renewals after the pod stopped = %d, want 0", running)
+	}
+}
@@ -0,0 +1,837 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// marshalDiscovery builds a DHCPDISCOVER with the modifiers derived from
+// ifCfg and round-trips it through the wire format.
+func marshalDiscovery(t *testing.T, ifCfg apis.InterfaceConfig) *dhcpv4.DHCPv4 {
+	t.Helper()
+	hwAddr, _ := net.ParseMAC("02:00:00:00:00:01")
+	pkt, err := dhcpv4.NewDiscovery(hwAddr, dhcpModifiers(ifCfg)...)
+	if err != nil {
+		t.Fatalf("failed to build DHCPDISCOVER: %v", err)
+	}
+	parsed, err := dhcpv4.FromBytes(pkt.ToBytes())
+	if err != nil {
+		t.Fatalf("failed to parse marshalled DHCPDISCOVER: %v", err)
+	}
+	return parsed
+}
+
+func TestDHCPHostnameOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		ifCfg        apis.InterfaceConfig
+		wantHostname []byte
+		wantFQDN     []byte
+	}{
+		{
+			name:  "no hostname",
+			ifCfg: apis.InterfaceConfig{DHCP: ptr.To(true)},
+		},
+		{
+			name:         "short hostname",
+			ifCfg:        apis.InterfaceConfig{DHCP: ptr.To(true), DHCPHostname: ptr.To("pod1")},
+			wantHostname: []byte("pod1"),
+		},
+		{
+			name:         "fully qualified hostname",
+			ifCfg:        apis.InterfaceConfig{DHCP: ptr.To(true), DHCPHostname: ptr.To("pod1.example.com")},
+			wantHostname: []byte("pod1"),
+			wantFQDN: []byte{
+				fqdnFlagServerUpdate | fqdnFlagEncoding, 0, 0,
+				4, 'p', 'o', 'd', '1',
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+				3, 'c', 'o', 'm',
+				0,
+			},
+		},
+		{
+			name:         "absolute hostname",
+			ifCfg:        apis.InterfaceConfig{DHCP: ptr.To(true), DHCPHostname: ptr.To("pod1.example.")},
+			wantHostname: []byte("pod1"),
+			wantFQDN: []byte{
+				fqdnFlagServerUpdate | fqdnFlagEncoding, 0, 0,
+				4, 'p', 'o', 'd', '1',
+				7, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+				0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt := marshalDiscovery(t, tt.ifCfg)
+			if got := pkt.Options.Get(dhcpv4.OptionHostName); !bytes.Equal(got, tt.wantHostname) {
+				t.Errorf("option 12 = %q, want %q", got, tt.wantHostname)
+			}
+			if got := pkt.Options.Get(dhcpv4.OptionFQDN); !bytes.Equal(got, tt.wantFQDN) {
+				t.Errorf("option 81 = %v, want %v", got, tt.wantFQDN)
+			}
+		})
+	}
+}
+
+func TestDHCPBroadcastFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		ifCfg     apis.InterfaceConfig
+		wantFlags uint16
+	}{
+		{
+			name:      "default broadcast",
+			ifCfg:     apis.InterfaceConfig{DHCP: ptr.To(true)},
+			wantFlags: 0x8000,
+		},
+		{
+			name:      "explicit broadcast",
+			ifCfg:     apis.InterfaceConfig{DHCP: ptr.To(true), DHCPBroadcast: ptr.To(true)},
+			wantFlags: 0x8000,
+		},
+		{
+			name:      "unicast",
+			ifCfg:     apis.InterfaceConfig{DHCP: ptr.To(true), DHCPBroadcast: ptr.To(false)},
+			wantFlags: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discover := marshalDiscovery(t, tt.ifCfg)
+			if discover.Flags != tt.wantFlags {
+				t.Errorf("DHCPDISCOVER flags = %#04x, want %#04x", discover.Flags, tt.wantFlags)
+			}
+
+			// the offer flags are copied to the request, the modifiers must win
+			offer, err := dhcpv4.NewReplyFromRequest(discover, dhcpv4.WithBroadcast(tt.wantFlags == 0))
+			if err != nil {
+				t.Fatalf("failed to build DHCPOFFER: %v", err)
+			}
+			request, err := dhcpv4.NewRequestFromOffer(offer, dhcpModifiers(tt.ifCfg)...)
+			if err != nil {
+				t.Fatalf("failed to build DHCPREQUEST: %v", err)
+			}
+			parsed, err := dhcpv4.FromBytes(request.ToBytes())
+			if err != nil {
+				t.Fatalf("failed to parse marshalled DHCPREQUEST: %v", err)
+			}
+			if parsed.Flags != tt.wantFlags {
+				t.Errorf("DHCPREQUEST flags = %#04x, want %#04x", parsed.Flags, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestCheckDHCPv4Capable(t *testing.T) {
+	ethAddr, _ := net.ParseMAC("02:00:00:00:00:01")
+	ibAddr := make(net.HardwareAddr, 20)
+	tests := []struct {
+		name      string
+		attrs     netlink.LinkAttrs
+		expectErr bool
+	}{
+		{
+			name:  "ethernet",
+			attrs: netlink.LinkAttrs{Name: "eth0", MTU: 1500, HardwareAddr: ethAddr},
+		},
+		{
+			name:      "mtu below the IPv4 minimum",
+			attrs:     netlink.LinkAttrs{Name: "eth0", MTU: 60, HardwareAddr: ethAddr},
+			expectErr: true,
+		},
+		{
+			name:      "no hardware address",
+			attrs:     netlink.LinkAttrs{Name: "tun0", MTU: 1500},
+			expectErr: true,
+		},
+		{
+			name:  "ipoib",
+			attrs: netlink.LinkAttrs{Name: "ib0", MTU: 2044, HardwareAddr: ibAddr},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDHCPv4Capable(&tt.attrs)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("checkDHCPv4Capable() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestDHCPLeaseConfig(t *testing.T) {
+	_, dest, _ := net.ParseCIDR("10.0.0.0/8")
+	tests := []struct {
+		name       string
+		modifiers  []dhcpv4.Modifier
+		wantIP     string
+		wantRoutes []apis.RouteConfig
+		wantRouter string
+		expectErr  bool
+	}{
+		{
+			name: "address, mask and routes",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+				dhcpv4.WithOption(dhcpv4.OptClasslessStaticRoute(&dhcpv4.Route{Dest: dest, Router: net.ParseIP("192.168.1.1")})),
+			},
+			wantIP:     "192.168.1.10/24",
+			wantRoutes: []apis.RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1"}},
+		},
+		{
+			name: "static routes without classless routes",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+				dhcpv4.WithGeneric(dhcpv4.OptionStaticRoutingTable, []byte{
+					10, 0, 0, 0, 192, 168, 1, 1,
+					172, 16, 0, 0, 192, 168, 1, 2,
+					192, 0, 2, 0, 192, 168, 1, 3,
+				}),
+			},
+			wantIP: "192.168.1.10/24",
+			wantRoutes: []apis.RouteConfig{
+				{Destination: "10.0.0.0/8", Gateway: "192.168.1.1"},
+				{Destination: "172.16.0.0/16", Gateway: "192.168.1.2"},
+				{Destination: "192.0.2.0/24", Gateway: "192.168.1.3"},
+			},
+		},
+		{
+			name: "classless routes take precedence over static routes",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+				dhcpv4.WithGeneric(dhcpv4.OptionStaticRoutingTable, []byte{172, 16, 0, 0, 192, 168, 1, 2}),
+				dhcpv4.WithOption(dhcpv4.OptClasslessStaticRoute(&dhcpv4.Route{Dest: dest, Router: net.ParseIP("192.168.1.1")})),
+			},
+			wantIP:     "192.168.1.10/24",
+			wantRoutes: []apis.RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1"}},
+		},
+		{
+			name: "router as the default route",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+				dhcpv4.WithRouter(net.ParseIP("192.168.1.1"), net.ParseIP("192.168.1.2")),
+			},
+			wantIP:     "192.168.1.10/24",
+			wantRouter: "192.168.1.1",
+		},
+		{
+			name: "router ignored with classless routes",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+				dhcpv4.WithRouter(net.ParseIP("192.168.1.254")),
+				dhcpv4.WithOption(dhcpv4.OptClasslessStaticRoute(&dhcpv4.Route{Dest: dest, Router: net.ParseIP("192.168.1.1")})),
+			},
+			wantIP:     "192.168.1.10/24",
+			wantRoutes: []apis.RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.1.1"}},
+		},
+		{
+			name: "malformed router",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithGeneric(dhcpv4.OptionRouter, []byte{192, 168}),
+			},
+			expectErr: true,
+		},
+		{
+			name: "static route with truncated pair",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithGeneric(dhcpv4.OptionStaticRoutingTable, []byte{10, 0, 0, 0, 192, 168}),
+			},
+			expectErr: true,
+		},
+		{
+			name: "static route to the default destination",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithGeneric(dhcpv4.OptionStaticRoutingTable, []byte{0, 0, 0, 0, 192, 168, 1, 1}),
+			},
+			expectErr: true,
+		},
+		{
+			name:      "missing mask",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithYourIP(net.ParseIP("10.1.2.3"))},
+			expectErr: true,
+		},
+		{
+			name:      "no address offered",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithNetmask(net.CIDRMask(24, 32))},
+			expectErr: true,
+		},
+		{
+			name: "malformed mask",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.ParseIP("192.168.1.10")),
+				dhcpv4.WithGeneric(dhcpv4.OptionSubnetMask, []byte{255, 255}),
+			},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, err := dhcpv4.New(tt.modifiers...)
+			if err != nil {
+				t.Fatalf("failed to build DHCPACK: %v", err)
+			}
+			ip, routes, router, err := dhcpLeaseConfig(ack)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("dhcpLeaseConfig() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if ip != tt.wantIP {
+				t.Errorf("dhcpLeaseConfig() ip = %q, want %q", ip, tt.wantIP)
+			}
+			if !reflect.DeepEqual(routes, tt.wantRoutes) {
+				t.Errorf("dhcpLeaseConfig() routes = %v, want %v", routes, tt.wantRoutes)
+			}
+			if router != tt.wantRouter {
+				t.Errorf("dhcpLeaseConfig() router = %q, want %q", router, tt.wantRouter)
+			}
+		})
+	}
+}
+
+func TestDHCPRoutingConfig(t *testing.T) {
+	defaultRoute := apis.RouteConfig{Destination: "0.0.0.0/0", Gateway: "192.168.1.1"}
+	staticRoute := apis.RouteConfig{Destination: "10.0.0.0/8", Gateway: "192.168.1.2"}
+	tests := []struct {
+		name       string
+		ip         string
+		routes     []apis.RouteConfig
+		router     string
+		table      int
+		wantRoutes []apis.RouteConfig
+		wantRules  []apis.RuleConfig
+	}{
+		{
+			name:   "default route in the table of the interface",
+			ip:     "192.168.1.10/24",
+			routes: []apis.RouteConfig{staticRoute, defaultRoute},
+			table:  2042,
+			wantRoutes: []apis.RouteConfig{
+				staticRoute,
+				{Destination: "192.168.1.0/24", Scope: unix.RT_SCOPE_LINK, Table: 2042},
+				{Destination: "10.0.0.0/8", Gateway: "192.168.1.2", Table: 2042},
+				{Destination: "0.0.0.0/0", Gateway: "192.168.1.1", Table: 2042},
+			},
+			wantRules: []apis.RuleConfig{{Priority: dhcpRulePriority, Source: "192.168.1.10/32", Table: 2042}},
+		},
+		{
+			name:   "host address without subnet route",
+			ip:     "10.0.5.8/32",
+			routes: []apis.RouteConfig{{Destination: "10.0.5.1/32", Scope: unix.RT_SCOPE_LINK}, {Destination: "0.0.0.0/0", Gateway: "10.0.5.1"}},
+			table:  100,
+			wantRoutes: []apis.RouteConfig{
+				{Destination: "10.0.5.1/32", Scope: unix.RT_SCOPE_LINK},
+				{Destination: "10.0.5.1/32", Scope: unix.RT_SCOPE_LINK, Table: 100},
+				{Destination: "0.0.0.0/0", Gateway: "10.0.5.1", Table: 100},
+			},
+			wantRules: []apis.RuleConfig{{Priority: dhcpRulePriority, Source: "10.0.5.8/32", Table: 100}},
+		},
+		{
+			name:       "main table",
+			ip:         "192.168.1.10/24",
+			routes:     []apis.RouteConfig{staticRoute, defaultRoute},
+			table:      unix.RT_TABLE_MAIN,
+			wantRoutes: []apis.RouteConfig{staticRoute, defaultRoute},
+		},
+		{
+			name:       "no default route",
+			ip:         "192.168.1.10/24",
+			routes:     []apis.RouteConfig{staticRoute},
+			table:      2042,
+			wantRoutes: []apis.RouteConfig{staticRoute},
+		},
+		{
+			name:   "router in the table of the interface",
+			ip:     "192.168.1.10/24",
+			router: "192.168.1.1",
+			table:  2042,
+			wantRoutes: []apis.RouteConfig{
+				{Destination: "192.168.1.0/24", Scope: unix.RT_SCOPE_LINK, Table: 2042},
+				{Destination: "0.0.0.0/0", Gateway: "192.168.1.1", Table: 2042},
+			},
+			wantRules: []apis.RuleConfig{{Priority: dhcpRulePriority, Source: "192.168.1.10/32", Table: 2042}},
+		},
+		{
+			name:       "router not installed in the main table",
+			ip:         "192.168.1.10/24",
+			routes:     []apis.RouteConfig{staticRoute},
+			router:     "192.168.1.1",
+			table:      unix.RT_TABLE_MAIN,
+			wantRoutes: []apis.RouteConfig{staticRoute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, rules, err := dhcpRoutingConfig(tt.ip, tt.routes, tt.router, tt.table)
+			if err != nil {
+				t.Fatalf("dhcpRoutingConfig() failed: %v", err)
+			}
+			if !reflect.DeepEqual(routes, tt.wantRoutes) {
+				t.Errorf("dhcpRoutingConfig() routes = %v, want %v", routes, tt.wantRoutes)
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("dhcpRoutingConfig() rules = %v, want %v", rules, tt.wantRules)
+			}
+			config := apis.NetworkConfig{Routes: routes, Rules: rules}
+			raw, err := json.Marshal(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, errs := apis.ValidateConfig(&runtime.RawExtension{Raw: raw}); len(errs) > 0 {
+				t.Errorf("routing configuration is invalid: %v", errs)
+			}
+		})
+	}
+}
+
+func TestDHCPRouteTable(t *testing.T) {
+	table := dhcpRouteTable(apis.InterfaceConfig{Name: "net1", DHCP: ptr.To(true)})
+	if table < apis.DHCPTableOffset || table >= apis.DHCPTableOffset+1000 {
+		t.Errorf("dhcpRouteTable() = %d, want a table in [%d, %d)", table, apis.DHCPTableOffset, apis.DHCPTableOffset+1000)
+	}
+	if other := dhcpRouteTable(apis.InterfaceConfig{Name: "net1"}); other != table {
+		t.Errorf("dhcpRouteTable() = %d and %d for the same interface name", table, other)
+	}
+	if got := dhcpRouteTable(apis.InterfaceConfig{Name: "net1", DHCPRouteTable: ptr.To(unix.RT_TABLE_MAIN)}); got != unix.RT_TABLE_MAIN {
+		t.Errorf("dhcpRouteTable() = %d, want the configured main table", got)
+	}
+}
+
+func TestDHCPRequestOptions(t *testing.T) {
+	defaultOptions := []dhcpv4.OptionCode{
+		dhcpv4.OptionSubnetMask,
+		dhcpv4.OptionRouter,
+		dhcpv4.OptionDomainName,
+		dhcpv4.OptionDomainNameServer,
+		dhcpv4.OptionDNSDomainSearchList,
+		dhcpv4.OptionStaticRoutingTable,
+	}
+	tests := []struct {
+		name  string
+		ifCfg apis.InterfaceConfig
+		want  []dhcpv4.OptionCode
+	}{
+		{
+			name:  "default options",
+			ifCfg: apis.InterfaceConfig{DHCP: ptr.To(true)},
+			want:  defaultOptions,
+		},
+		{
+			name:  "additional options",
+			ifCfg: apis.InterfaceConfig{DHCP: ptr.To(true), DHCPRequestOptions: []int{42, 121}},
+			want:  append(defaultOptions, dhcpv4.OptionNTPServers, dhcpv4.OptionClasslessStaticRoute),
+		},
+		{
+			name:  "option already requested by default",
+			ifCfg: apis.InterfaceConfig{DHCP: ptr.To(true), DHCPRequestOptions: []int{6, 42}},
+			want:  append(defaultOptions, dhcpv4.OptionNTPServers),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discover := marshalDiscovery(t, tt.ifCfg)
+			want := dhcpv4.OptionCodeList(tt.want)
+			if got := discover.ParameterRequestList(); !reflect.DeepEqual(optionCodes(got), optionCodes(want)) {
+				t.Errorf("DHCPDISCOVER parameter request list = %v, want %v", got, want)
+			}
+
+			offer, err := dhcpv4.NewReplyFromRequest(discover)
+			if err != nil {
+				t.Fatalf("failed to build DHCPOFFER: %v", err)
+			}
+			request, err := dhcpv4.NewRequestFromOffer(offer, dhcpModifiers(tt.ifCfg)...)
+			if err != nil {
+				t.Fatalf("failed to build DHCPREQUEST: %v", err)
+			}
+			parsed, err := dhcpv4.FromBytes(request.ToBytes())
+			if err != nil {
+				t.Fatalf("failed to parse marshalled DHCPREQUEST: %v", err)
+			}
+			if got := parsed.ParameterRequestList(); !reflect.DeepEqual(optionCodes(got), optionCodes(want)) {
+				t.Errorf("DHCPREQUEST parameter request list = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// optionCodes returns the sorted numeric codes of the options.
+func optionCodes(list dhcpv4.OptionCodeList) []uint8 {
+	var codes []uint8
+	for _, code := range list {
+		codes = append(codes, code.Code())
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+func TestDHCPDomains(t *testing.T) {
+	tests := []struct {
+		name              string
+		modifiers         []dhcpv4.Modifier
+		wantDomainName    string
+		wantSearchDomains []string
+		expectErr         bool
+	}{
+		{
+			name: "no domain options",
+		},
+		{
+			name:           "domain name",
+			modifiers:      []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDomainName, []byte("example.com.\x00"))},
+			wantDomainName: "example.com",
+		},
+		{
+			name: "single search domain",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x07example\x03com\x00"))},
+			wantSearchDomains: []string{"example.com"},
+		},
+		{
+			// RFC 3397 section 3 example
+			name: "compressed search domains",
+			modifiers: []dhcpv4.Modifier{
+				dhcpv4.WithGeneric(dhcpv4.OptionDomainName, []byte("apple.com")),
+				dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+					"\x03eng\x05apple\x03com\x00"+
+						"\x09marketing\xc0\x04")),
+			},
+			wantDomainName:    "apple.com",
+			wantSearchDomains: []string{"eng.apple.com", "marketing.apple.com"},
+		},
+		{
+			name: "pointer to a compressed name",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x07cluster\x05local\x00"+
+					"\x03svc\xc0\x00"+
+					"\x07default\xc0\x0f"+
+					"\xc0\x0f"))},
+			wantSearchDomains: []string{"cluster.local", "svc.cluster.local", "default.svc.cluster.local", "svc.cluster.local"},
+		},
+		{
+			name: "pointer loop",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x03foo\xc0\x00"))},
+			expectErr: true,
+		},
+		{
+			name: "forward pointer",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x03foo\xc0\x06\x03bar\x00"))},
+			expectErr: true,
+		},
+		{
+			name: "truncated label",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x07example\x03co"))},
+			expectErr: true,
+		},
+		{
+			name: "name not terminated",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x07example\x03com"))},
+			expectErr: true,
+		},
+		{
+			name: "truncated pointer",
+			modifiers: []dhcpv4.Modifier{dhcpv4.WithGeneric(dhcpv4.OptionDNSDomainSearchList, []byte(
+				"\x07example\x00\x03foo\xc0"))},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, err := dhcpv4.New(tt.modifiers...)
+			if err != nil {
+				t.Fatalf("failed to build DHCPACK: %v", err)
+			}
+			domainName, searchDomains, err := dhcpDomains(ack)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("dhcpDomains() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if domainName != tt.wantDomainName {
+				t.Errorf("dhcpDomains() domain name = %q, want %q", domainName, tt.wantDomainName)
+			}
+			if !slices.Equal(searchDomains, tt.wantSearchDomains) {
+				t.Errorf("dhcpDomains() search domains = %v, want %v", searchDomains, tt.wantSearchDomains)
+			}
+		})
+	}
+}
+
+func TestDHCPRequestedOptionValues(t *testing.T) {
+	ack, err := dhcpv4.New(
+		dhcpv4.WithOption(dhcpv4.OptNTPServers(net.IPv4(10, 0, 0, 1))),
+		dhcpv4.WithOption(dhcpv4.OptDomainName("example.com")),
+		dhcpv4.WithGeneric(dhcpv4.GenericOptionCode(224), []byte{0xca, 0xfe}),
+	)
+	if err != nil {
+		t.Fatalf("failed to build DHCPACK: %v", err)
+	}
+	ack, err = dhcpv4.FromBytes(ack.ToBytes())
+	if err != nil {
+		t.Fatalf("failed to parse marshalled DHCPACK: %v", err)
+	}
+
+	got := dhcpRequestedOptions(ack, []int{42, 224, 119})
+	want := map[int][]byte{
+		42:  {10, 0, 0, 1},
+		224: {0xca, 0xfe},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dhcpRequestedOptions() = %v, want %v", got, want)
+	}
+	if got := dhcpRequestedOptions(ack, nil); got != nil {
+		t.Errorf("dhcpRequestedOptions() without requested options = %v, want nil", got)
+	}
+}
+
+func TestInitRebootRequest(t *testing.T) {
+	hwAddr, _ := net.ParseMAC("02:00:00:00:00:01")
+	requestedIP := net.ParseIP("192.168.10.20").To4()
+	pkt, err := newInitRebootRequest(hwAddr, requestedIP, dhcpModifiers(apis.InterfaceConfig{DHCP: ptr.To(true)})...)
+	if err != nil {
+		t.Fatalf("failed to build DHCPREQUEST: %v", err)
+	}
+	request, err := dhcpv4.FromBytes(pkt.ToBytes())
+	if err != nil {
+		t.Fatalf("failed to parse marshalled DHCPREQUEST: %v", err)
+	}
+	if request.MessageType() != dhcpv4.MessageTypeRequest {
+		t.Errorf("message type = %s, want %s", request.MessageType(), dhcpv4.MessageTypeRequest)
+	}
+	if got := request.RequestedIPAddress(); !got.Equal(requestedIP) {
+		t.Errorf("requested IP address (option 50) = %s, want %s", got, requestedIP)
+	}
+	if request.Options.Has(dhcpv4.OptionServerIdentifier) {
+		t.Errorf("INIT-REBOOT DHCPREQUEST must not have a server identifier: %v", request.ServerIdentifier())
+	}
+	if !request.ClientIPAddr.IsUnspecified() {
+		t.Errorf("client IP address = %s, want 0.0.0.0", request.ClientIPAddr)
+	}
+	if !bytes.Equal(request.ClientHWAddr, hwAddr) {
+		t.Errorf("client hardware address = %s, want %s", request.ClientHWAddr, hwAddr)
+	}
+	if request.Flags != 0x8000 {
+		t.Errorf("flags = %#04x, want the broadcast flag by default", request.Flags)
+	}
+	for _, code := range []dhcpv4.OptionCode{dhcpv4.OptionSubnetMask, dhcpv4.OptionRouter, dhcpv4.OptionDNSDomainSearchList, dhcpv4.OptionStaticRoutingTable} {
+		if !request.IsOptionRequested(code) {
+			t.Errorf("option %s is not requested", code)
+		}
+	}
+}
+
+// fakeDHCPConn is the connection of a DHCP client to a fake server that
+// answers each packet with the reply of handler, if any.
+type fakeDHCPConn struct {
+	handler func(*dhcpv4.DHCPv4, net.Addr) *dhcpv4.DHCPv4
+	replies chan []byte
+	closed  chan struct{}
+	once    sync.Once
+
+	mu           sync.Mutex
+	received     []dhcpv4.MessageType
+	destinations []string
+}
+
+func newFakeDHCPConn(handler func(*dhcpv4.DHCPv4) *dhcpv4.DHCPv4) *fakeDHCPConn {
+	return newFakeDHCPConnTo(func(msg *dhcpv4.DHCPv4, _ net.Addr) *dhcpv4.DHCPv4 { return handler(msg) })
+}
+
+// newFakeDHCPConnTo returns a connection whose handler also gets the
+// destination of the packets, e.g. to answer only the broadcasts.
+func newFakeDHCPConnTo(handler func(*dhcpv4.DHCPv4, net.Addr) *dhcpv4.DHCPv4) *fakeDHCPConn {
+	return &fakeDHCPConn{
+		handler: handler,
+		replies: make(chan []byte, 10),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *fakeDHCPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case reply := <-c.replies:
+		return copy(b, reply), &net.UDPAddr{IP: net.IPv4(192, 168, 10, 1), Port: 67}, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *fakeDHCPConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	msg, err := dhcpv4.FromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.received = append(c.received, msg.MessageType())
+	c.destinations = append(c.destinations, dst.String())
+	c.mu.Unlock()
+	if reply := c.handler(msg, dst); reply != nil {
+		c.replies <- reply.ToBytes()
+	}
+	return len(b), nil
+}
+
+func (c *fakeDHCPConn) messages() []dhcpv4.MessageType {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.received)
+}
+
+// sentTo returns the destinations of the packets sent.
+func (c *fakeDHCPConn) sentTo() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.destinations)
+}
+
+func (c *fakeDHCPConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeDHCPConn) LocalAddr() net.Addr                { return &net.UDPAddr{IP: net.IPv4zero, Port: 68} }
+func (c *fakeDHCPConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *fakeDHCPConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *fakeDHCPConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+func TestDHCPRequestLease(t *testing.T) {
+	serverIP := net.IPv4(192, 168, 10, 1)
+	reservedIP := net.IPv4(192, 168, 10, 20)
+	offeredIP := net.IPv4(192, 168, 10, 30)
+	reply := func(t *testing.T, request *dhcpv4.DHCPv4, messageType dhcpv4.MessageType, ip net.IP) *dhcpv4.DHCPv4 {
+		msg, err := dhcpv4.NewReplyFromRequest(request,
+			dhcpv4.WithMessageType(messageType),
+			dhcpv4.WithServerIP(serverIP),
+			dhcpv4.WithOption(dhcpv4.OptServerIdentifier(serverIP)),
+			dhcpv4.WithYourIP(ip),
+			dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+			dhcpv4.WithRouter(serverIP),
+		)
+		if err != nil {
+			t.Errorf("failed to build %s: %v", messageType, err)
+			return nil
+		}
+		return msg
+	}
+	// initRebootReply is the answer of the server to the INIT-REBOOT request,
+	// the DHCPDISCOVER is always offered offeredIP.
+	tests := []struct {
+		name            string
+		requestedIP     *string
+		initRebootReply func(t *testing.T, request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4
+		wantIP          net.IP
+		wantMessages    []dhcpv4.MessageType
+	}{
+		{
+			name:         "no requested address",
+			wantIP:       offeredIP,
+			wantMessages: []dhcpv4.MessageType{dhcpv4.MessageTypeDiscover, dhcpv4.MessageTypeRequest},
+		},
+		{
+			name:        "requested address acknowledged",
+			requestedIP: ptr.To(reservedIP.String()),
+			initRebootReply: func(t *testing.T, request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+				return reply(t, request, dhcpv4.MessageTypeAck, request.RequestedIPAddress())
+			},
+			wantIP:       reservedIP,
+			wantMessages: []dhcpv4.MessageType{dhcpv4.MessageTypeRequest},
+		},
+		{
+			name:        "requested address refused",
+			requestedIP: ptr.To(reservedIP.String()),
+			initRebootReply: func(t *testing.T, request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+				return reply(t, request, dhcpv4.MessageTypeNak, net.IPv4zero)
+			},
+			wantIP:       offeredIP,
+			wantMessages: []dhcpv4.MessageType{dhcpv4.MessageTypeRequest, dhcpv4.MessageTypeDiscover, dhcpv4.MessageTypeRequest},
+		},
+		{
+			name:         "server without a record of the client",
+			requestedIP:  ptr.To(reservedIP.String()),
+			wantIP:       offeredIP,
+			wantMessages: []dhcpv4.MessageType{dhcpv4.MessageTypeRequest, dhcpv4.MessageTypeDiscover, dhcpv4.MessageTypeRequest},
+		},
+		{
+			name:        "another address acknowledged",
+			requestedIP: ptr.To(reservedIP.String()),
+			initRebootReply: func(t *testing.T, request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+				return reply(t, request, dhcpv4.MessageTypeAck, net.IPv4(192, 168, 10, 99))
+			},
+			wantIP:       offeredIP,
+			wantMessages: []dhcpv4.MessageType{dhcpv4.MessageTypeRequest, dhcpv4.MessageTypeDiscover, dhcpv4.MessageTypeRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newFakeDHCPConn(func(request *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+				switch {
+				case request.MessageType() == dhcpv4.MessageTypeDiscover:
+					return reply(t, request, dhcpv4.MessageTypeOffer, offeredIP)
+				case request.ServerIdentifier() != nil:
+					// SELECTING state, requesting the offered address.
+					return reply(t, request, dhcpv4.MessageTypeAck, request.RequestedIPAddress())
+				case tt.initRebootReply != nil:
+					return tt.initRebootReply(t, request)
+				}
+				return nil
+			})
+			hwAddr, _ := net.ParseMAC("02:00:00:00:00:01")
+			client := newDHCPClient(conn, hwAddr, dhcpMaxMessageSize(1500))
+			defer client.Close()
+
+			// A silent server uses half of the deadline of the caller, the
+			// DHCPDISCOVER exchange runs in the other half.
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			ack, err := dhcpRequestLease(ctx, client, apis.InterfaceConfig{DHCP: ptr.To(true), DHCPRequestedIP: tt.requestedIP})
+			if err != nil {
+				t.Fatalf("dhcpRequestLease() failed: %v", err)
+			}
+			if !ack.YourIPAddr.Equal(tt.wantIP) {
+				t.Errorf("leased address = %s, want %s", ack.YourIPAddr, tt.wantIP)
+			}
+			if got := conn.messages(); !slices.Equal(got, tt.wantMessages) {
+				t.Errorf("sent messages = %v, want %v", got, tt.wantMessages)
+			}
+		})
+	}
+}
@@ -20,8 +20,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/netip"
+	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"sigs.k8s.io/dranet/pkg/apis"
@@ -41,12 +45,55 @@ import (
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 )
 
 const (
 	rdmaCmPath = "/dev/infiniband/rdma_cm"
+	// vfioDevDir has the VFIO container device and a device per IOMMU group.
+	vfioDevDir = "/dev/vfio"
 )
 
+// Reasons of the Warning events recorded on a ResourceClaim when it fails to
+// be prepared, so users can tell the failures apart with
+// `kubectl describe resourceclaim`.
+const (
+	reasonClaimPrepareFailed        = "ClaimPrepareFailed"
+	reasonInvalidConfig             = "InvalidNetworkConfig"
+	reasonProfileFailed             = "ProfileResolutionFailed"
+	reasonDeviceNotFound            = "NetworkDeviceNotFound"
+	reasonInvalidMTU                = "InvalidMTU"
+	reasonIPAMFailed                = "IPAMAllocationFailed"
+	reasonDHCPFailed                = "DHCPFailed"
+	reasonAddressDiscoveryFailed    = "AddressDiscoveryFailed"
+	reasonEthtoolFailed             = "EthtoolFailed"
+	reasonEthtoolFeatureUnsupported = "EthtoolFeatureUnsupported"
+	reasonEthtoolFeatureDenied      = "EthtoolFeatureDenied"
+	reasonRouteDiscoveryFailed      = "RouteDiscoveryFailed"
+	reasonCheckpointFailed          = "CheckpointFailed"
+	reasonIRQAffinityFailed         = "IRQAffinityFailed"
+	reasonConfigUpdateFailed        = "ConfigUpdateFailed"
+)
+
+// reasonMTUMismatch is the reason of the Warning event recorded on a
+// ResourceClaim whose interface MTU differs from the MTU of its network. It is
+// not a failure, the claim is still prepared.
+const reasonMTUMismatch = "MTUMismatch"
+
+// reasonMTUExceedsParent is the reason of the Warning event recorded on a
+// ResourceClaim whose VLAN or tunnel interface MTU exceeds the MTU of its
+// parent minus the encapsulation overhead. The claim is still prepared.
+const reasonMTUExceedsParent = "MTUExceedsParent"
+
+// reasonEthtoolFeatureFixed is the reason of the Warning event recorded on a
+// ResourceClaim requesting ethtool features the device does not allow to
+// change, when they are skipped by the EthtoolFixedFeaturePolicySkip policy.
+const reasonEthtoolFeatureFixed = "EthtoolFeatureFixed"
+
+// reasonInterfaceNameCollision is the reason of the Warning event recorded on a
+// ResourceClaim whose interface name is likely to be already used in the Pod.
+const reasonInterfaceNameCollision = "InterfaceNameCollision"
+
 // DRA hooks exposes Network Devices to Kubernetes, the Network devices and its attributes are
 // obtained via the netdb to decouple the discovery of the interfaces with the execution.
 // The exposed devices can be allocated to one or mod pods via Claim, the Claim lifecycle is
@@ -56,14 +103,21 @@ const (
 
 func (np *NetworkDriver) PublishResources(ctx context.Context) {
 	klog.V(2).Infof("Publishing resources")
+	firstPublication := true
 	for {
 		select {
 		case devices := <-np.netdb.GetResources(ctx):
 			klog.V(3).Infof("Got %d devices from inventory: %s", len(devices), formatDeviceNames(devices, 15))
-			devices = filter.FilterDevices(np.celProgram, devices)
+			discovered := len(devices)
+			devices = filter.FilterDevices(np.celProgram, devices, np.filterErrorAction)
 			klog.V(3).Infof("After filtering, publishing %d devices in ResourceSlice(s): %s", len(devices), formatDeviceNames(devices, 15))
+			if firstPublication {
+				np.logFilteredDevices(discovered, len(devices))
+				firstPublication = false
+			}
 
 			np.publishResourcesPrometheusMetrics(devices)
+			np.publishFilterPrometheusMetrics(discovered, len(devices))
 
 			resources := resourceslice.DriverResources{
 				Pools: map[string]resourceslice.Pool{
@@ -94,6 +148,26 @@ func (np *NetworkDriver) publishResourcesPrometheusMetrics(devices []resourceapi
 	publishedDevicesTotal.WithLabelValues("total").Set(float64(len(devices)))
 }
 
+// publishFilterPrometheusMetrics records the number of devices discovered and
+// published after the filter.
+func (np *NetworkDriver) publishFilterPrometheusMetrics(discovered, published int) {
+	devicesFilteredTotal.WithLabelValues("discovered").Set(float64(discovered))
+	devicesFilteredTotal.WithLabelValues("published").Set(float64(published))
+}
+
+// logFilteredDevices logs how many devices the filter excluded, a filter that
+// hides all the devices is likely too broad.
+func (np *NetworkDriver) logFilteredDevices(discovered, published int) {
+	if np.celProgram == nil {
+		klog.Infof("Discovered %d devices, publishing all of them without a filter", discovered)
+		return
+	}
+	klog.Infof("Discovered %d devices, %d filtered out, publishing %d", discovered, discovered-published, published)
+	if discovered > 0 && published == 0 {
+		klog.Warningf("The filter excludes all the %d devices discovered, no device is published", discovered)
+	}
+}
+
 func (np *NetworkDriver) PrepareResourceClaims(ctx context.Context, claims []*resourceapi.ResourceClaim) (map[types.UID]kubeletplugin.PrepareResult, error) {
 	klog.V(2).Infof("PrepareResourceClaims is called: number of claims: %d", len(claims))
 	start := time.Now()
@@ -127,10 +201,23 @@ func (np *NetworkDriver) prepareResourceClaims(ctx context.Context, claims []*re
 	}
 	result := make(map[types.UID]kubeletplugin.PrepareResult)
 
+	// The claims are independent and may wait for network round trips, e.g.
+	// DHCP, so they are prepared concurrently to not exceed the kubelet timeout.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, max(np.maxPrepareConcurrency, 1))
 	for _, claim := range claims {
 		klog.V(2).Infof("NodePrepareResources: Claim Request %s/%s", claim.Namespace, claim.Name)
-		result[claim.UID] = np.prepareResourceClaim(ctx, claim)
+		workers <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-workers }()
+			claimResult := np.prepareResourceClaim(ctx, claim)
+			mu.Lock()
+			defer mu.Unlock()
+			result[claim.UID] = claimResult
+		})
 	}
+	wg.Wait()
 	return result, nil
 }
 
@@ -165,12 +252,14 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 	}
 	podUID := reserved.UID
 
+	// The netlink handle is not safe for concurrent use, each claim uses its own.
 	nlHandle, err := nlwrap.NewHandle()
 	if err != nil {
 		return kubeletplugin.PrepareResult{
 			Err: fmt.Errorf("error creating netlink handle %v", err),
 		}
 	}
+	defer nlHandle.Close()
 
 	rulesByTable, err := getRuleInfo(nlHandle)
 	if err != nil {
@@ -181,6 +270,7 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 
 	var errorList []error
 	charDevices := sets.New[string]()
+	rdmaOwners := map[string]string{}
 	for _, result := range claim.Status.Allocation.Devices.Results {
 		// A single ResourceClaim can have devices managed by distinct DRA
 		// drivers. One common use case for this is device topology alignment
@@ -193,35 +283,27 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 			continue
 		}
 		requestName := result.Request
-		userConf := &apis.NetworkConfig{}
-		for _, config := range claim.Status.Allocation.Devices.Config {
-			// Check there is a config associated to this device
-			if config.Opaque == nil ||
-				config.Opaque.Driver != np.driverName ||
-				len(config.Requests) > 0 && !slices.Contains(config.Requests, requestName) {
-				continue
-			}
-			// Check if there is a custom configuration
-			conf, errs := apis.ValidateConfig(&config.Opaque.Parameters)
-			if len(errs) > 0 {
-				errorList = append(errorList, errs...)
-				continue
-			}
-			// TODO: define a strategy for multiple configs
-			if conf != nil {
-				userConf = conf
-				break
-			}
-		}
+		userConf, errs := np.claimUserConfig(claim, requestName)
+		errorList = append(errorList, withReasons(reasonInvalidConfig, errs)...)
 
 		mergedConf, err := np.getDeviceNetworkConfig(result.Device, claim.UID, userConf)
 		if err != nil {
-			errorList = append(errorList, err)
+			errorList = append(errorList, withReason(reasonProfileFailed, err))
 			continue
 		}
 
 		netconf := *mergedConf
 
+		// The claim of a running pod is prepared again when the kubelet
+		// restarts, the changes of the configuration, e.g. of its profile,
+		// are applied to the interface in the pod.
+		if current, ns, ok := np.runningDeviceConfig(podUID, result.Device); ok {
+			if err := np.updateDeviceConfig(podUID, ns, result.Device, current, netconf); err != nil {
+				errorList = append(errorList, withReason(reasonConfigUpdateFailed, fmt.Errorf("failed to update the configuration of device %s of running pod %s: %w", result.Device, podUID, err)))
+			}
+			continue
+		}
+
 		klog.V(4).Infof("PrepareResourceClaim %s/%s final Configuration %#v", claim.Namespace, claim.Name, netconf)
 		deviceCfg := DeviceConfig{
 			Claim: types.NamespacedName{
@@ -229,6 +311,7 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 				Name:      claim.Name,
 			},
 			NetworkInterfaceConfigInPod: netconf,
+			RequestedConfig:             netconf,
 		}
 
 		// Store early to guarantee profile cleanup on subsequent failures within this loop.
@@ -236,7 +319,7 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 		// which will find this early config and release the allocated profile.
 		if netconf.Profile != "" {
 			if err := np.podConfigStore.SetDeviceConfig(podUID, result.Device, deviceCfg); err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to persist early device config for pod %s device %s: %v", podUID, result.Device, err))
+				errorList = append(errorList, withReason(reasonCheckpointFailed, fmt.Errorf("failed to persist early device config for pod %s device %s: %v", podUID, result.Device, err)))
 				// If we can't store it, we MUST release it immediately to prevent a leak.
 				if relErr := np.netdb.ReleaseProfileConfig(result.Device, claim.UID, &netconf); relErr != nil {
 					klog.Errorf("failed to rollback profile config for claim %v device %v: %v", claim.UID, result.Device, relErr)
@@ -245,6 +328,40 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 			}
 		}
 
+		// VFIO path: PCI device bound to vfio-pci, e.g. for DPDK, the Pod
+		// gets the VFIO char devices instead of a network interface.
+		if np.netdb.IsVFIODevice(result.Device) {
+			for _, config := range claim.Status.Allocation.Devices.Config {
+				if config.Opaque == nil ||
+					config.Opaque.Driver != np.driverName ||
+					len(config.Requests) > 0 && !slices.Contains(config.Requests, requestName) {
+					continue
+				}
+				if errs := apis.ValidateVFIOConfig(&config.Opaque.Parameters); len(errs) > 0 {
+					errorList = append(errorList, withReasons(reasonInvalidConfig, errs)...)
+				}
+			}
+			if len(errorList) > 0 {
+				continue
+			}
+			iommuGroup, err := np.netdb.GetIOMMUGroup(result.Device)
+			if err != nil {
+				errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to get IOMMU group for VFIO device %s: %v", result.Device, err)))
+				continue
+			}
+			vfioConfig, err := buildVFIOConfig(vfioDevDir, iommuGroup)
+			if err != nil {
+				errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to get VFIO devices for device %s: %v", result.Device, err)))
+				continue
+			}
+			deviceCfg.VFIODevice = vfioConfig
+			if err := np.podConfigStore.SetDeviceConfig(podUID, result.Device, deviceCfg); err != nil {
+				errorList = append(errorList, withReason(reasonCheckpointFailed, fmt.Errorf("failed to persist device config for pod %s device %s: %v", podUID, result.Device, err)))
+			}
+			klog.V(4).Infof("VFIO claim resources for pod %s : %#v", podUID, deviceCfg)
+			continue
+		}
+
 		// IB-only path: device has RDMA capability but no netdev interface.
 		if np.netdb.IsIBOnlyDevice(result.Device) {
 			// Reject any network-specific config fields for RDMA-only devices.
@@ -255,7 +372,7 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 					continue
 				}
 				if errs := apis.ValidateRDMAOnlyConfig(&config.Opaque.Parameters); len(errs) > 0 {
-					errorList = append(errorList, errs...)
+					errorList = append(errorList, withReasons(reasonInvalidConfig, errs)...)
 				}
 			}
 			if len(errorList) > 0 {
@@ -263,12 +380,25 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 			}
 			rdmaDevName, err := np.netdb.GetRDMADeviceName(result.Device)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to get RDMA device name for IB-only device %s: %v", result.Device, err))
+				errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to get RDMA device name for IB-only device %s: %v", result.Device, err)))
+				continue
+			}
+			linkDevs, err := claimRDMADevices(rdmaOwners, []string{rdmaDevName}, result.Device)
+			if err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+			if err := addRDMAExtraDevices(charDevices, netconf.RDMAExtraDevices); err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+			deviceCfg.RDMADevice = buildRDMAConfig(linkDevs, charDevices)
+			if err := setRDMADeviceMode(&deviceCfg.RDMADevice, netconf.RDMADeviceMode); err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
 				continue
 			}
-			deviceCfg.RDMADevice = buildRDMAConfig(rdmaDevName, charDevices)
 			if err := np.podConfigStore.SetDeviceConfig(podUID, result.Device, deviceCfg); err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to persist device config for pod %s device %s: %v", podUID, result.Device, err))
+				errorList = append(errorList, withReason(reasonCheckpointFailed, fmt.Errorf("failed to persist device config for pod %s device %s: %v", podUID, result.Device, err)))
 			}
 			klog.V(4).Infof("IB-only claim resources for pod %s : %#v", podUID, deviceCfg)
 			continue
@@ -276,16 +406,20 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 
 		ifName, err := np.netdb.GetNetInterfaceName(result.Device)
 		if err != nil {
-			errorList = append(errorList, fmt.Errorf("failed to get network interface name for device %s: %v", result.Device, err))
+			errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to get network interface name for device %s: %v", result.Device, err)))
 			continue
 		}
 		// Get Network configuration and merge it
 		link, err := nlHandle.LinkByName(ifName)
 		if err != nil {
-			errorList = append(errorList, fmt.Errorf("failed to get netlink to interface %s: %v", ifName, err))
+			errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to get netlink to interface %s: %v", ifName, err)))
 			continue
 		}
 		deviceCfg.NetworkInterfaceConfigInHost.Interface.Name = ifName
+		// Virtual devices have no PCI address.
+		if pciAddress, err := inventory.GetPCIAddress(ifName); err == nil {
+			deviceCfg.PCIAddress = pciAddress
+		}
 
 		if deviceCfg.NetworkInterfaceConfigInPod.Interface.Name == "" {
 			// If the interface name was not explicitly overridden, use the same
@@ -293,46 +427,136 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 			deviceCfg.NetworkInterfaceConfigInPod.Interface.Name = ifName
 		}
 
+		// Interface name templates are expanded with the PCI address of the device.
+		if name := deviceCfg.NetworkInterfaceConfigInPod.Interface.Name; apis.IsInterfaceNameTemplate(name) {
+			if deviceCfg.PCIAddress == "" {
+				errorList = append(errorList, withReason(reasonInvalidConfig, fmt.Errorf("interface name template %q requires a PCI device, interface %s has no PCI address", name, ifName)))
+				continue
+			}
+			expanded, err := apis.ExpandInterfaceNameTemplate(name, deviceCfg.PCIAddress)
+			if err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, fmt.Errorf("failed to expand interface name template for %s: %w", ifName, err)))
+				continue
+			}
+			deviceCfg.NetworkInterfaceConfigInPod.Interface.Name = expanded
+		}
+
+		// The generated hardware address is applied as a configured one when
+		// the interface is moved to the Pod.
+		if generate := deviceCfg.NetworkInterfaceConfigInPod.Interface.GenerateHardwareAddr; generate != nil && *generate {
+			hwAddr := generateHardwareAddr(podUID, result.Device)
+			if err := np.checkHardwareAddrUnique(nlHandle, hwAddr, ifName, podUID, result.Device); err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+			deviceCfg.NetworkInterfaceConfigInPod.Interface.HardwareAddr = ptr.To(hwAddr.String())
+		}
+
+		// The interfaces in the Pod namespace are only known when the device is
+		// attached, warn early about the names the CNI plugins usually take.
+		if name := deviceCfg.NetworkInterfaceConfigInPod.Interface.Name; apis.IsCommonPodInterfaceName(name) {
+			err := fmt.Errorf("interface %s is named %s in the Pod, a name commonly used by the Pod primary interface", ifName, name)
+			klog.Warningf("PrepareResourceClaim %s/%s: %v", claim.Namespace, claim.Name, err)
+			np.eventRecorder.Eventf(claim, v1.EventTypeWarning, reasonInterfaceNameCollision, "%v", err)
+		}
+
 		// For SR-IOV VFs, the requested MTU must not exceed the parent PF's MTU.
 		// Otherwise the claim is rejected so the Pod fails fast instead of being
 		// created with an illegal MTU configuration.
 		if deviceCfg.NetworkInterfaceConfigInPod.Interface.MTU != nil && inventory.IsSriovVf(ifName) {
 			pfName, err := inventory.GetPFInterfaceName(ifName)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to determine parent PF for SR-IOV VF %s: %v", ifName, err))
+				errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to determine parent PF for SR-IOV VF %s: %v", ifName, err)))
 				continue
 			}
 			pfLink, err := nlHandle.LinkByName(pfName)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to get netlink to parent PF %s of VF %s: %v", pfName, ifName, err))
+				errorList = append(errorList, withReason(reasonDeviceNotFound, fmt.Errorf("failed to get netlink to parent PF %s of VF %s: %v", pfName, ifName, err)))
 				continue
 			}
 			requestedMTU := int(*deviceCfg.NetworkInterfaceConfigInPod.Interface.MTU)
 			if err := validateVFMTU(ifName, pfName, requestedMTU, pfLink.Attrs().MTU); err != nil {
-				errorList = append(errorList, err)
+				errorList = append(errorList, withReason(reasonInvalidMTU, err))
 				continue
 			}
 		}
 
+		// The packets of a VLAN or tunnel interface are sent by its parent with
+		// the encapsulation headers. A requested MTU above the parent MTU minus
+		// the overhead is only surfaced to the user, without one the MTU is
+		// lowered to fit the parent. The VLAN tag has no overhead in the MTU.
+		if parentIndex, overhead := linkEncapsulation(link); parentIndex > 0 {
+			parent, err := nlHandle.LinkByIndex(parentIndex)
+			if err != nil {
+				klog.Infof("could not get the parent of interface %s to check its MTU: %v", ifName, err)
+			} else {
+				mtu, err := childMTU(ifName, parent.Attrs().Name, deviceCfg.NetworkInterfaceConfigInPod.Interface.MTU, link.Attrs().MTU, parent.Attrs().MTU, overhead)
+				if err != nil {
+					klog.Warningf("PrepareResourceClaim %s/%s: %v", claim.Namespace, claim.Name, err)
+					np.eventRecorder.Eventf(claim, v1.EventTypeWarning, reasonMTUExceedsParent, "%v", err)
+				} else if mtu != nil && deviceCfg.NetworkInterfaceConfigInPod.Interface.MTU == nil {
+					klog.Infof("Lowering the MTU of interface %s from %d to %d to fit its parent %s", ifName, link.Attrs().MTU, *mtu, parent.Attrs().Name)
+					deviceCfg.NetworkInterfaceConfigInPod.Interface.MTU = mtu
+				}
+			}
+		}
+
+		// The rates can not exceed the speed of the link, a link with an
+		// unknown speed, e.g. virtual or down, is not checked.
+		if rateLimit := deviceCfg.NetworkInterfaceConfigInPod.RateLimit; rateLimit != nil {
+			if speed, ok := inventory.GetLinkSpeed(ifName); ok {
+				if err := checkRateLimit(ifName, rateLimit, speed); err != nil {
+					errorList = append(errorList, withReason(reasonInvalidConfig, err))
+					continue
+				}
+			}
+		}
+
 		// If DHCP is requested, do a DHCP request to gather the network parameters (IPs and Routes)
 		// ... but we DO NOT apply them in the root namespace
 		if deviceCfg.NetworkInterfaceConfigInPod.Interface.DHCP != nil && *deviceCfg.NetworkInterfaceConfigInPod.Interface.DHCP {
 			klog.V(2).Infof("trying to get network configuration via DHCP")
 			contextCancel, cancel := context.WithTimeout(ctx, 5*time.Second)
 			defer cancel()
-			ip, routes, err := getDHCP(contextCancel, ifName)
+			lease, err := getDHCP(contextCancel, ifName, deviceCfg.NetworkInterfaceConfigInPod.Interface)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("fail to get configuration via DHCP for %s: %w", ifName, err))
+				errorList = append(errorList, withReason(reasonDHCPFailed, fmt.Errorf("fail to get configuration via DHCP for %s: %w", ifName, err)))
 			} else {
-				deviceCfg.NetworkInterfaceConfigInPod.Interface.Addresses = []string{ip}
+				deviceCfg.NetworkInterfaceConfigInPod.Interface.Addresses = []string{lease.ip}
+				routes, rules, err := dhcpLeaseRouting(deviceCfg.NetworkInterfaceConfigInPod.Interface, lease)
+				if err != nil {
+					errorList = append(errorList, withReason(reasonDHCPFailed, err))
+					continue
+				}
 				deviceCfg.NetworkInterfaceConfigInPod.Routes = append(deviceCfg.NetworkInterfaceConfigInPod.Routes, routes...)
+				deviceCfg.NetworkInterfaceConfigInPod.Rules = append(deviceCfg.NetworkInterfaceConfigInPod.Rules, rules...)
+				deviceCfg.DHCPOptions = lease.options
+				deviceCfg.DHCPDomainName = lease.domainName
+				deviceCfg.DHCPSearchDomains = lease.searchDomains
+				// The routes and rules of the lease are replaced if a
+				// renewal hands out another address.
+				lease.state.Routes, lease.state.Rules = routes, rules
+				deviceCfg.DHCPLease = lease.state
+				klog.V(2).Infof("DHCP lease on %s: address %s, domain %q, search %v, requested options %v", ifName, lease.ip, lease.domainName, lease.searchDomains, lease.options)
+			}
+		} else if poolName := deviceCfg.NetworkInterfaceConfigInPod.Interface.IPAMPool; poolName != nil {
+			address, err := np.allocateIPAMAddress(claim, result.Device, *poolName)
+			if err != nil {
+				errorList = append(errorList, withReason(reasonIPAMFailed, fmt.Errorf("fail to allocate address from IPAM pool %s for %s: %w", *poolName, ifName, err)))
+			} else {
+				deviceCfg.NetworkInterfaceConfigInPod.Interface.Addresses = []string{address}
 			}
 		} else if len(deviceCfg.NetworkInterfaceConfigInPod.Interface.Addresses) == 0 {
 			// If there is no custom addresses and no DHCP, then use the existing ones
 			// get the existing IP addresses
 			nlAddresses, err := nlHandle.AddrList(link, netlink.FAMILY_ALL)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("fail to get ip addresses for interface %s : %w", ifName, err))
+				errorList = append(errorList, withReason(reasonAddressDiscoveryFailed, fmt.Errorf("fail to get ip addresses for interface %s : %w", ifName, err)))
+			} else if preserveAll := deviceCfg.NetworkInterfaceConfigInPod.Interface.PreserveAllAddresses; preserveAll != nil && *preserveAll {
+				deviceCfg.PreservedAddresses = addressesToPreserve(nlAddresses)
+				for _, address := range deviceCfg.PreservedAddresses {
+					deviceCfg.NetworkInterfaceConfigInPod.Interface.Addresses = append(deviceCfg.NetworkInterfaceConfigInPod.Interface.Addresses, address.Address)
+				}
 			} else {
 				for _, address := range nlAddresses {
 					// Only move IP addresses with global scope because those are not host-specific, auto-configured,
@@ -350,40 +574,70 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 		if deviceCfg.NetworkInterfaceConfigInPod.Ethtool != nil {
 			client, err := newEthtoolClient(0)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("fail to create ethtool client %v", err))
+				errorList = append(errorList, withReason(reasonEthtoolFailed, fmt.Errorf("fail to create ethtool client %v", err)))
 				continue
 			}
 			defer client.Close()
 
 			ifFeatures, err := client.GetFeatures(ifName)
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("fail to get ethtool features %v", err))
+				errorList = append(errorList, withReason(reasonEthtoolFailed, fmt.Errorf("fail to get ethtool features %v", err)))
+				continue
+			}
+
+			if denied := deniedEthtoolFeatures(deviceCfg.NetworkInterfaceConfigInPod.Ethtool, np.deniedEthtoolFeatures, ifFeatures); len(denied) > 0 {
+				errorList = append(errorList, withReason(reasonEthtoolFeatureDenied, fmt.Errorf("ethtool features %v are not allowed to be changed on node %s", denied, np.nodeName)))
 				continue
 			}
 
 			// translate features to the actual kernel names
-			ethtoolFeatures := map[string]bool{}
-			for feature, value := range deviceCfg.NetworkInterfaceConfigInPod.Ethtool.Features {
-				aliases := ifFeatures.Get(feature)
-				if len(aliases) == 0 {
-					errorList = append(errorList, fmt.Errorf("feature %s not supported by interface", feature))
-					continue
+			resolved, errs := resolveEthtoolFeatures(deviceCfg.NetworkInterfaceConfigInPod.Ethtool, ifFeatures)
+			errorList = append(errorList, withReasons(reasonEthtoolFeatureUnsupported, errs)...)
+			if np.ethtoolFixedFeaturePolicy == EthtoolFixedFeaturePolicySkip {
+				var skipped []string
+				resolved, skipped = skipFixedEthtoolFeatures(resolved, ifFeatures)
+				if len(skipped) > 0 {
+					klog.Warningf("PrepareResourceClaim %s/%s: skipping the fixed ethtool features %v of interface %s", claim.Namespace, claim.Name, skipped, ifName)
+					np.eventRecorder.Eventf(claim, v1.EventTypeWarning, reasonEthtoolFeatureFixed, "ethtool features %v of interface %s can not be changed on node %s and are skipped", skipped, ifName, np.nodeName)
 				}
-				for _, alias := range aliases {
-					ethtoolFeatures[alias] = value
+			}
+			deviceCfg.NetworkInterfaceConfigInPod.Ethtool = resolved
+
+			if err := validateCoalesceQueues(client, ifName, resolved.Coalesce); err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+
+			// Some device level settings must be applied in the host namespace,
+			// e.g. the ones resetting the device queues, the rest is applied
+			// once the interface is in the Pod namespace. Nothing is applied if
+			// the claim already failed.
+			if beforeMove, _ := ethtoolConfigPhases(deviceCfg.NetworkInterfaceConfigInPod.Ethtool); beforeMove != nil && len(errorList) == 0 {
+				if err := applyEthtoolSettings(client, "host", ifName, beforeMove, nil); err != nil {
+					errorList = append(errorList, withReason(reasonEthtoolFailed, fmt.Errorf("fail to apply ethtool settings before moving %s: %w", ifName, err)))
+					continue
 				}
 			}
-			deviceCfg.NetworkInterfaceConfigInPod.Ethtool.Features = ethtoolFeatures
 		}
 
 		// Obtain the routes and rules associated with the interface.
-		routes, tables, err := getRouteInfo(nlHandle, ifName, link)
+		routes, tables, err := getRouteInfo(nlHandle, ifName, link, np.preserveIPv6LinkLocalRoute)
 		if err != nil {
-			errorList = append(errorList, err)
+			errorList = append(errorList, withReason(reasonRouteDiscoveryFailed, err))
 			continue
 		}
 		deviceCfg.NetworkInterfaceConfigInPod.Routes = append(deviceCfg.NetworkInterfaceConfigInPod.Routes, routes...)
 
+		// A mismatch with the MTU of the network is likely a misconfiguration,
+		// e.g. jumbo frames on a VPC with the default MTU, but it is only
+		// surfaced to the user since the network MTU may be outdated.
+		if networkMTU, ok := np.netdb.GetNetworkMTU(result.Device); ok {
+			if err := checkNetworkMTU(ifName, deviceCfg.NetworkInterfaceConfigInPod, networkMTU); err != nil {
+				klog.Warningf("PrepareResourceClaim %s/%s: %v", claim.Namespace, claim.Name, err)
+				np.eventRecorder.Eventf(claim, v1.EventTypeWarning, reasonMTUMismatch, "%v", err)
+			}
+		}
+
 		// If VRF is enabled, we do not need to copy the rules from the host
 		// because the VRF handles the routing table lookup.
 		if deviceCfg.NetworkInterfaceConfigInPod.Interface.VRF == nil {
@@ -417,25 +671,67 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 			deviceCfg.NetworkInterfaceConfigInPod.Neighbors = append(deviceCfg.NetworkInterfaceConfigInPod.Neighbors, neighCfg)
 		}
 
-		// Get RDMA configuration: link and char devices
-		if rdmaDev, err := inventory.GetRdmaDevice(ifName); err == nil && rdmaDev != "" {
-			klog.V(2).Infof("RunPodSandbox processing RDMA device: %s", rdmaDev)
-			deviceCfg.RDMADevice = buildRDMAConfig(rdmaDev, charDevices)
+		// Get RDMA configuration: link and char devices. With port
+		// aggregation the interface has several RDMA link devices.
+		getRdmaDevices := np.rdmaDevices
+		if getRdmaDevices == nil {
+			getRdmaDevices = inventory.GetRdmaDevices
+		}
+		rdmaDevs, err := getRdmaDevices(ifName)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to get the RDMA devices of interface %s: %w", ifName, err))
+			continue
+		}
+		if len(rdmaDevs) > 0 {
+			klog.V(2).Infof("RunPodSandbox processing RDMA devices: %v", rdmaDevs)
+			linkDevs, err := claimRDMADevices(rdmaOwners, rdmaDevs, result.Device)
+			if err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+			if err := addRDMAExtraDevices(charDevices, netconf.RDMAExtraDevices); err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+			deviceCfg.RDMADevice = buildRDMAConfig(linkDevs, charDevices)
+			if err := setRDMADeviceMode(&deviceCfg.RDMADevice, netconf.RDMADeviceMode); err != nil {
+				errorList = append(errorList, withReason(reasonInvalidConfig, err))
+				continue
+			}
+		} else if len(netconf.RDMAExtraDevices) > 0 {
+			errorList = append(errorList, withReason(reasonInvalidConfig, fmt.Errorf("rdmaExtraDevices requires an RDMA device, interface %s has none", ifName)))
+			continue
+		} else if netconf.RDMADeviceMode != nil {
+			errorList = append(errorList, withReason(reasonInvalidConfig, fmt.Errorf("rdmaDeviceMode requires an RDMA device, interface %s has none", ifName)))
+			continue
+		}
+
+		// The IRQ affinity is global, it can only be set from the host.
+		if irqAffinity := deviceCfg.NetworkInterfaceConfigInPod.Interface.NUMAIRQAffinity; irqAffinity != nil && *irqAffinity {
+			if deviceCfg.PCIAddress == "" {
+				errorList = append(errorList, withReason(reasonInvalidConfig, fmt.Errorf("numaIRQAffinity requires a PCI device, interface %s has no PCI address", ifName)))
+				continue
+			}
+			if err := applyNUMAIRQAffinity(deviceCfg.PCIAddress); err != nil {
+				errorList = append(errorList, withReason(reasonIRQAffinityFailed, fmt.Errorf("fail to set the NUMA IRQ affinity of interface %s: %w", ifName, err)))
+				continue
+			}
 		}
 
 		// Remove the pinned programs before the NRI hooks since it
 		// has to walk the entire bpf virtual filesystem and is slow
 		// TODO: check if there is some other way to do this
-		if deviceCfg.NetworkInterfaceConfigInPod.Interface.DisableEBPFPrograms != nil &&
-			*deviceCfg.NetworkInterfaceConfigInPod.Interface.DisableEBPFPrograms {
-			err := unpinBPFPrograms(ifName)
+		if programTypes := disabledEBPFProgramTypes(deviceCfg.NetworkInterfaceConfigInPod.Interface); programTypes.Len() > 0 {
+			ctxBPF, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := unpinBPFPrograms(ctxBPF, ifName, programTypes)
+			cancel()
 			if err != nil {
 				klog.Infof("error unpinning ebpf programs for %s : %v", ifName, err)
 			}
 		}
 
 		if err := np.podConfigStore.SetDeviceConfig(podUID, result.Device, deviceCfg); err != nil {
-			errorList = append(errorList, fmt.Errorf("failed to persist device config for pod %s device %s: %v", podUID, result.Device, err))
+			errorList = append(errorList, withReason(reasonCheckpointFailed, fmt.Errorf("failed to persist device config for pod %s device %s: %v", podUID, result.Device, err)))
 		}
 		klog.V(4).Infof("Claim Resources for pod %s : %#v", podUID, deviceCfg)
 	}
@@ -443,7 +739,7 @@ func (np *NetworkDriver) prepareResourceClaim(ctx context.Context, claim *resour
 	if len(errorList) > 0 {
 		joinedErr := errors.Join(errorList...)
 		klog.Infof("claim %s contain errors: %v", claim.UID, joinedErr)
-		np.eventRecorder.Eventf(claim, v1.EventTypeWarning, "ClaimPrepareFailed", "%v", joinedErr)
+		np.recordClaimPrepareEvents(claim, errorList)
 		return kubeletplugin.PrepareResult{
 			Err: fmt.Errorf("claim %s contain errors: %w", claim.UID, joinedErr),
 		}
@@ -511,6 +807,9 @@ func (np *NetworkDriver) unprepareResourceClaim(_ context.Context, claim kubelet
 		}
 	}
 
+	if np.ipam != nil {
+		np.ipam.Release(claim.NamespacedName)
+	}
 	np.podConfigStore.DeleteClaim(claim.NamespacedName)
 	return nil
 }
@@ -521,6 +820,58 @@ func (np *NetworkDriver) HandleError(ctx context.Context, err error, msg string)
 	runtime.HandleErrorWithContext(ctx, err, msg)
 }
 
+// claimPrepareError annotates an error hit while preparing a ResourceClaim
+// with the reason of the event reported for it.
+type claimPrepareError struct {
+	reason string
+	err    error
+}
+
+func (e *claimPrepareError) Error() string { return e.err.Error() }
+
+func (e *claimPrepareError) Unwrap() error { return e.err }
+
+// withReason annotates err with the event reason used to report it.
+func withReason(reason string, err error) error {
+	return &claimPrepareError{reason: reason, err: err}
+}
+
+// withReasons annotates every error in errs with the same event reason.
+func withReasons(reason string, errs []error) []error {
+	out := make([]error, 0, len(errs))
+	for _, err := range errs {
+		out = append(out, withReason(reason, err))
+	}
+	return out
+}
+
+// claimPrepareErrorReason returns the event reason of err, falling back to
+// the generic ClaimPrepareFailed reason for errors that were not annotated.
+func claimPrepareErrorReason(err error) string {
+	var prepareErr *claimPrepareError
+	if errors.As(err, &prepareErr) {
+		return prepareErr.reason
+	}
+	return reasonClaimPrepareFailed
+}
+
+// recordClaimPrepareEvents emits one Warning event on the claim per failure
+// reason, aggregating the errors that share the same reason.
+func (np *NetworkDriver) recordClaimPrepareEvents(claim *resourceapi.ResourceClaim, errorList []error) {
+	var reasons []string
+	errsByReason := map[string][]error{}
+	for _, err := range errorList {
+		reason := claimPrepareErrorReason(err)
+		if _, ok := errsByReason[reason]; !ok {
+			reasons = append(reasons, reason)
+		}
+		errsByReason[reason] = append(errsByReason[reason], err)
+	}
+	for _, reason := range reasons {
+		np.eventRecorder.Eventf(claim, v1.EventTypeWarning, reason, "%v", errors.Join(errsByReason[reason]...))
+	}
+}
+
 func formatDeviceNames(devices []resourceapi.Device, max int) string {
 	deviceNames := make([]string, len(devices))
 	for i := range devices {
@@ -534,13 +885,23 @@ func formatDeviceNames(devices []resourceapi.Device, max int) string {
 	return fmt.Sprintf("%s, and %d more", strings.Join(deviceNames[:max], ", "), len(deviceNames)-max)
 }
 
-// buildRDMAConfig populates an RDMAConfig for the given rdma device name.
+// buildRDMAConfig populates an RDMAConfig for the given rdma device names,
+// the first one is the link device and the others the aggregated ones. Without
+// names, the link devices are moved by another device of the claim.
 // It inserts the rdma_cm and per-device character device paths into charDevices,
 // then resolves each path to a LinuxDevice entry.
-func buildRDMAConfig(rdmaDevName string, charDevices sets.Set[string]) RDMAConfig {
-	cfg := RDMAConfig{LinkDev: rdmaDevName}
+func buildRDMAConfig(rdmaDevNames []string, charDevices sets.Set[string]) RDMAConfig {
+	var cfg RDMAConfig
+	if len(rdmaDevNames) > 0 {
+		cfg.LinkDev = rdmaDevNames[0]
+	}
+	if len(rdmaDevNames) > 1 {
+		cfg.ExtraLinkDevs = rdmaDevNames[1:]
+	}
 	charDevices.Insert(rdmaCmPath)
-	charDevices.Insert(rdmamap.GetRdmaCharDevices(rdmaDevName)...)
+	for _, rdmaDevName := range rdmaDevNames {
+		charDevices.Insert(rdmamap.GetRdmaCharDevices(rdmaDevName)...)
+	}
 	for _, devpath := range charDevices.UnsortedList() {
 		dev, err := GetDeviceInfo(devpath)
 		if err != nil {
@@ -552,6 +913,115 @@ func buildRDMAConfig(rdmaDevName string, charDevices sets.Set[string]) RDMAConfi
 	return cfg
 }
 
+// setRDMADeviceMode records the file mode of the RDMA character devices
+// requested by the user, the containers get the mode of the devices in the
+// host if it is nil.
+func setRDMADeviceMode(cfg *RDMAConfig, mode *string) error {
+	if mode == nil {
+		return nil
+	}
+	fileMode, err := apis.ParseRDMADeviceMode(*mode)
+	if err != nil {
+		return fmt.Errorf("invalid rdmaDeviceMode: %w", err)
+	}
+	cfg.DeviceMode = &fileMode
+	return nil
+}
+
+// buildVFIOConfig returns the VFIOConfig of a device in the IOMMU group, with
+// the VFIO container device and the group device found in devDir. Unlike the
+// RDMA char devices, both are required: the Pod can not use the device
+// without them.
+func buildVFIOConfig(devDir, iommuGroup string) (VFIOConfig, error) {
+	cfg := VFIOConfig{IOMMUGroup: iommuGroup}
+	for _, devpath := range []string{filepath.Join(devDir, "vfio"), filepath.Join(devDir, iommuGroup)} {
+		dev, err := GetDeviceInfo(devpath)
+		if err != nil {
+			return VFIOConfig{}, fmt.Errorf("failed to get the VFIO device of IOMMU group %s: %w", iommuGroup, err)
+		}
+		cfg.DevChars = append(cfg.DevChars, dev)
+	}
+	return cfg, nil
+}
+
+// claimRDMADevices records the claim device using the RDMA devices of its
+// interface and returns the ones the device has to move to the Pod. The netdev
+// and the IB-only device of the same hardware can be both in the claim, their
+// RDMA device is moved once, with the first of them. An RDMA device listed
+// twice, or shared only in part with another device, is an inconsistent
+// aggregation.
+func claimRDMADevices(owners map[string]string, rdmaDevNames []string, deviceName string) ([]string, error) {
+	if len(sets.New(rdmaDevNames...)) != len(rdmaDevNames) {
+		return nil, fmt.Errorf("device %s has duplicate RDMA devices %v", deviceName, rdmaDevNames)
+	}
+	var owner string
+	var claimed []string
+	for _, rdmaDevName := range rdmaDevNames {
+		if o, ok := owners[rdmaDevName]; ok && o != deviceName {
+			owner = o
+			claimed = append(claimed, rdmaDevName)
+		}
+	}
+	switch {
+	case len(claimed) == 0:
+	case len(claimed) == len(rdmaDevNames):
+		klog.V(2).Infof("RDMA devices %v of device %s are moved with device %s", rdmaDevNames, deviceName, owner)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("devices %s and %s refer to the same RDMA devices %v", owner, deviceName, claimed)
+	}
+	for _, rdmaDevName := range rdmaDevNames {
+		owners[rdmaDevName] = deviceName
+	}
+	return rdmaDevNames, nil
+}
+
+// addRDMAExtraDevices inserts the RDMA character devices requested by the
+// user into charDevices. Unlike the discovered devices, a requested device
+// that does not exist fails the claim instead of being skipped.
+func addRDMAExtraDevices(charDevices sets.Set[string], paths []string) error {
+	var errorList []error
+	for _, devpath := range paths {
+		if _, err := GetDeviceInfo(devpath); err != nil {
+			errorList = append(errorList, fmt.Errorf("invalid RDMA extra device: %w", err))
+			continue
+		}
+		charDevices.Insert(devpath)
+	}
+	return errors.Join(errorList...)
+}
+
+// checkNetworkMTU returns an error if the MTU configured for the interface
+// differs from the MTU of the network it is attached to and a route sends the
+// on-subnet traffic through it. The peers on the subnet use the network MTU,
+// so the larger packets are silently dropped instead of being fragmented.
+func checkNetworkMTU(ifName string, config apis.NetworkConfig, networkMTU int) error {
+	if config.Interface.MTU == nil || int(*config.Interface.MTU) == networkMTU {
+		return nil
+	}
+	var subnets []netip.Prefix
+	for _, address := range config.Interface.Addresses {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			continue
+		}
+		subnets = append(subnets, prefix.Masked())
+	}
+	for _, route := range config.Routes {
+		dst, err := netip.ParsePrefix(route.Destination)
+		if err != nil {
+			continue
+		}
+		for _, subnet := range subnets {
+			if subnet.Bits() <= dst.Bits() && subnet.Contains(dst.Addr()) {
+				return fmt.Errorf("interface %s MTU %d differs from the network MTU %d used by the on-subnet route to %s",
+					ifName, *config.Interface.MTU, networkMTU, route.Destination)
+			}
+		}
+	}
+	return nil
+}
+
 // validateVFMTU returns an error if the MTU requested for an SR-IOV VF exceeds
 // the parent PF's MTU, which is an illegal configuration. vfName and pfName are
 // only used to build a descriptive error message.
@@ -596,8 +1066,9 @@ func getRuleInfo(nlHandle nlwrap.Handle) (map[int][]apis.RuleConfig, error) {
 // getRouteInfo retrieves all routes associated with a given network interface.
 // It filters out routes that are not suitable for pod namespaces, such as
 // routes in the local table. It returns the list of suitable routes and a set
-// of the route table IDs to which they belong.
-func getRouteInfo(nlHandle nlwrap.Handle, ifName string, link netlink.Link) ([]apis.RouteConfig, sets.Set[int], error) {
+// of the route table IDs to which they belong. preserveIPv6LinkLocal keeps the
+// on-link fe80::/64 route of the interface.
+func getRouteInfo(nlHandle nlwrap.Handle, ifName string, link netlink.Link, preserveIPv6LinkLocal bool) ([]apis.RouteConfig, sets.Set[int], error) {
 	routes := []apis.RouteConfig{}
 	tables := sets.Set[int]{}
 	filter := &netlink.Route{
@@ -621,14 +1092,20 @@ func getRouteInfo(nlHandle nlwrap.Handle, ifName string, link netlink.Link) ([]a
 			klog.V(5).Infof("Skipping route %s for interface %s because it is in the local table", route.String(), ifName)
 			continue
 		}
-		// Discard IPv6 link-local routes, but allow IPv4 link-local.
+		// IPv4 link-local routes are kept, they are configured explicitly,
+		// e.g. to reach a metadata server, and nothing recreates them in the
+		// pod's network namespace. The IPv6 link-local routes are generated by
+		// the kernel, only the on-link fe80::/64 route of the interface is kept
+		// so the link-local neighbors, used by the RDMA fabrics and routing
+		// protocols, stay reachable even if the kernel does not recreate it.
 		if route.Dst.IP.To4() == nil {
 			if route.Dst.IP.IsLinkLocalUnicast() {
-				klog.V(5).Infof("Skipping IPv6 link-local route %s for interface %s", route.String(), ifName)
-				continue
-			}
-			// Discard IPv6 proto=kernel routes
-			if route.Protocol == unix.RTPROT_KERNEL {
+				if !preserveIPv6LinkLocal || !isIPv6LinkLocalPrefix(route.Dst) {
+					klog.V(5).Infof("Skipping IPv6 link-local route %s for interface %s", route.String(), ifName)
+					continue
+				}
+			} else if route.Protocol == unix.RTPROT_KERNEL {
+				// Discard IPv6 proto=kernel routes
 				klog.V(5).Infof("Skipping IPv6 proto=kernel route %s for interface %s", route.String(), ifName)
 				continue
 			}
@@ -652,6 +1129,39 @@ func getRouteInfo(nlHandle nlwrap.Handle, ifName string, link netlink.Link) ([]a
 	return routes, tables, nil
 }
 
+// isIPv6LinkLocalPrefix returns true if dst is the fe80::/64 prefix of the
+// IPv6 link-local addresses.
+func isIPv6LinkLocalPrefix(dst *net.IPNet) bool {
+	ones, bits := dst.Mask.Size()
+	return ones == 64 && bits == 128 && dst.IP.Equal(net.ParseIP("fe80::"))
+}
+
+// claimUserConfig returns the configuration of the claim for the request, or
+// an empty configuration if it has none, and the errors of the invalid
+// configurations of the driver.
+func (np *NetworkDriver) claimUserConfig(claim *resourceapi.ResourceClaim, requestName string) (*apis.NetworkConfig, []error) {
+	var errorList []error
+	for _, config := range claim.Status.Allocation.Devices.Config {
+		// Check there is a config associated to this device
+		if config.Opaque == nil ||
+			config.Opaque.Driver != np.driverName ||
+			len(config.Requests) > 0 && !slices.Contains(config.Requests, requestName) {
+			continue
+		}
+		// Check if there is a custom configuration
+		conf, errs := apis.ValidateConfig(&config.Opaque.Parameters)
+		if len(errs) > 0 {
+			errorList = append(errorList, errs...)
+			continue
+		}
+		// TODO: define a strategy for multiple configs
+		if conf != nil {
+			return conf, errorList
+		}
+	}
+	return &apis.NetworkConfig{}, errorList
+}
+
 // getDeviceNetworkConfig merges the user configuration with the cloud provider configuration and resolves the dynamic profile.
 // User configuration always takes precedence in case of conflicts.
 func (np *NetworkDriver) getDeviceNetworkConfig(device string, claimUID types.UID, userConf *apis.NetworkConfig) (*apis.NetworkConfig, error) {
@@ -19,20 +19,34 @@ package driver
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 	resourcev1 "k8s.io/api/resource/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
 	"sigs.k8s.io/dranet/pkg/apis"
 	"sigs.k8s.io/dranet/pkg/cloudprovider"
 	"sigs.k8s.io/dranet/pkg/cloudprovider/webhook"
@@ -150,9 +164,10 @@ func TestPrepareResourceClaimsMetrics(t *testing.T) {
 		draPluginRequestsLatencySeconds.Reset()
 
 		np := &NetworkDriver{
-			netdb:         newFakeInventoryDB(),
-			driverName:    "test.driver",
-			eventRecorder: record.NewFakeRecorder(100),
+			netdb:          newFakeInventoryDB(),
+			driverName:     "test.driver",
+			eventRecorder:  record.NewFakeRecorder(100),
+			podConfigStore: mustNewPodConfigStore(),
 		}
 
 		claims := []*resourcev1.ResourceClaim{
@@ -194,6 +209,82 @@ func TestPrepareResourceClaimsMetrics(t *testing.T) {
 	})
 }
 
+func TestPrepareResourceClaimsConcurrently(t *testing.T) {
+	const numClaims = 4
+	tests := []struct {
+		name           string
+		maxConcurrency int
+		wantMax        int32
+	}{
+		{name: "sequential", maxConcurrency: 1, wantMax: 1},
+		{name: "bounded", maxConcurrency: 2, wantMax: 2},
+		{name: "all claims", maxConcurrency: numClaims, wantMax: numClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			fakeDB := newFakeInventoryDB()
+			fakeDB.GetDeviceConfigFunc = func(deviceName string) (*apis.NetworkConfig, bool) {
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					observed := maxInFlight.Load()
+					if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+						break
+					}
+				}
+				// Hold the worker until the expected concurrency is reached.
+				_ = wait.PollUntilContextTimeout(context.Background(), time.Millisecond, time.Second, true, func(context.Context) (bool, error) {
+					return maxInFlight.Load() >= tt.wantMax, nil
+				})
+				return nil, false
+			}
+			np := &NetworkDriver{
+				netdb:                 fakeDB,
+				driverName:            "test.driver",
+				eventRecorder:         record.NewFakeRecorder(100),
+				maxPrepareConcurrency: tt.maxConcurrency,
+				podConfigStore:        mustNewPodConfigStore(),
+			}
+
+			var claims []*resourcev1.ResourceClaim
+			for i := range numClaims {
+				claims = append(claims, &resourcev1.ResourceClaim{
+					ObjectMeta: metav1.ObjectMeta{UID: types.UID(fmt.Sprintf("claim-uid-%d", i))},
+					Status: resourcev1.ResourceClaimStatus{
+						ReservedFor: []resourcev1.ResourceClaimConsumerReference{
+							{APIGroup: "", Resource: "pods", Name: "test-pod", UID: types.UID(fmt.Sprintf("pod-uid-%d", i))},
+						},
+						Allocation: &resourcev1.AllocationResult{
+							Devices: resourcev1.DeviceAllocationResult{
+								Results: []resourcev1.DeviceRequestAllocationResult{
+									{Driver: "test.driver", Device: "device-does-not-exist"},
+								},
+							},
+						},
+					},
+				})
+			}
+
+			res, err := np.prepareResourceClaims(context.Background(), claims)
+			if err != nil {
+				t.Fatalf("prepareResourceClaims failed: %v", err)
+			}
+			if len(res) != numClaims {
+				t.Errorf("prepareResourceClaims returned %d results, want %d", len(res), numClaims)
+			}
+			for _, claim := range claims {
+				if res[claim.UID].Err == nil {
+					t.Errorf("expected an error for %s, the device does not exist", claim.UID)
+				}
+			}
+			if got := maxInFlight.Load(); got != tt.wantMax {
+				t.Errorf("prepared %d claims concurrently, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
 func TestUnprepareResourceClaimsMetrics(t *testing.T) {
 	ctx := context.Background()
 
@@ -292,11 +383,43 @@ func TestClaimPrepareFailedEvent(t *testing.T) {
 
 	select {
 	case event := <-fakeRecorder.Events:
-		if !strings.Contains(event, "ClaimPrepareFailed") {
-			t.Errorf("expected ClaimPrepareFailed event, got: %s", event)
+		if !strings.Contains(event, reasonDeviceNotFound) {
+			t.Errorf("expected %s event, got: %s", reasonDeviceNotFound, event)
 		}
 	default:
-		t.Error("expected a ClaimPrepareFailed event to be emitted, but none was received")
+		t.Errorf("expected a %s event to be emitted, but none was received", reasonDeviceNotFound)
+	}
+}
+
+func TestRecordClaimPrepareEvents(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	np := &NetworkDriver{eventRecorder: fakeRecorder}
+	claim := &resourcev1.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Name: "my-claim", Namespace: "default"}}
+
+	np.recordClaimPrepareEvents(claim, []error{
+		withReason(reasonDHCPFailed, fmt.Errorf("no DHCP offer on eth1")),
+		withReason(reasonEthtoolFeatureUnsupported, fmt.Errorf("feature foo not supported by interface")),
+		fmt.Errorf("unexpected failure"),
+		withReason(reasonEthtoolFeatureUnsupported, fmt.Errorf("feature bar not supported by interface")),
+	})
+	close(fakeRecorder.Events)
+
+	var events []string
+	for event := range fakeRecorder.Events {
+		events = append(events, event)
+	}
+	want := []string{
+		"Warning DHCPFailed no DHCP offer on eth1",
+		"Warning EthtoolFeatureUnsupported feature foo not supported by interface\nfeature bar not supported by interface",
+		"Warning ClaimPrepareFailed unexpected failure",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d: %v", len(want), len(events), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d: expected %q, got %q", i, want[i], events[i])
+		}
 	}
 }
 
@@ -337,6 +460,71 @@ func TestPublishResourcesMetrics(t *testing.T) {
 	})
 }
 
+func TestPublishResourcesFilterMetrics(t *testing.T) {
+	env, err := cel.NewEnv(
+		ext.NativeTypes(reflect.ValueOf(resourcev1.DeviceAttribute{})),
+		cel.Variable("attributes", cel.MapType(cel.StringType, cel.ObjectType("v1.DeviceAttribute"))),
+	)
+	if err != nil {
+		t.Fatalf("error creating CEL environment: %v", err)
+	}
+	ast, issues := env.Compile(`attributes["dra.net/rdma"].BoolValue`)
+	if issues != nil && issues.Err() != nil {
+		t.Fatalf("type-check error: %s", issues.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("program construction error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	fakeDraPlugin := newFakePluginHelper()
+	fakeNetDB := newFakeInventoryDB()
+	np := &NetworkDriver{
+		draPlugin:  fakeDraPlugin,
+		netdb:      fakeNetDB,
+		nodeName:   "test-node",
+		celProgram: prg,
+	}
+	go np.PublishResources(ctx)
+
+	device := func(name string, rdma bool) resourcev1.Device {
+		return resourcev1.Device{Name: name, Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+			apis.AttrRDMA: {BoolValue: ptr.To(rdma)},
+		}}
+	}
+	for _, tc := range []struct {
+		name          string
+		devices       []resourcev1.Device
+		wantPublished float64
+	}{
+		{
+			name:          "some devices filtered out",
+			devices:       []resourcev1.Device{device("eth1", true), device("eth2", false), device("eth3", false)},
+			wantPublished: 1,
+		},
+		{
+			name:          "all devices filtered out",
+			devices:       []resourcev1.Device{device("eth2", false), device("eth3", false)},
+			wantPublished: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeNetDB.resources <- tc.devices
+			<-fakeDraPlugin.publishCalled
+
+			if got := testutil.ToFloat64(devicesFilteredTotal.WithLabelValues("discovered")); got != float64(len(tc.devices)) {
+				t.Errorf("discovered devices = %f, want %d", got, len(tc.devices))
+			}
+			if got := testutil.ToFloat64(devicesFilteredTotal.WithLabelValues("published")); got != tc.wantPublished {
+				t.Errorf("published devices = %f, want %f", got, tc.wantPublished)
+			}
+		})
+	}
+}
+
 func TestValidateVFMTU(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -374,6 +562,77 @@ func TestValidateVFMTU(t *testing.T) {
 	}
 }
 
+func TestCheckNetworkMTU(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     apis.NetworkConfig
+		networkMTU int
+		wantErr    bool
+	}{
+		{
+			name: "MTU not configured",
+			config: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{Addresses: []string{"192.168.1.2/24"}},
+				Routes:    []apis.RouteConfig{{Destination: "192.168.1.0/24", Scope: 253}},
+			},
+			networkMTU: 1460,
+		},
+		{
+			name: "MTU matches the network",
+			config: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{MTU: ptr.To[int32](8244), Addresses: []string{"192.168.1.2/24"}},
+				Routes:    []apis.RouteConfig{{Destination: "192.168.1.0/24", Scope: 253}},
+			},
+			networkMTU: 8244,
+		},
+		{
+			name: "jumbo MTU on a network with the default MTU",
+			config: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{MTU: ptr.To[int32](8896), Addresses: []string{"192.168.1.2/24"}},
+				Routes:    []apis.RouteConfig{{Destination: "192.168.1.0/24", Scope: 253}},
+			},
+			networkMTU: 1460,
+			wantErr:    true,
+		},
+		{
+			name: "host route on the subnet",
+			config: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{MTU: ptr.To[int32](8896), Addresses: []string{"2001:db8::2/64"}},
+				Routes:    []apis.RouteConfig{{Destination: "2001:db8::1/128"}},
+			},
+			networkMTU: 8244,
+			wantErr:    true,
+		},
+		{
+			name: "only off-subnet routes",
+			config: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{MTU: ptr.To[int32](8896), Addresses: []string{"192.168.1.2/24"}},
+				Routes: []apis.RouteConfig{
+					{Destination: "0.0.0.0/0", Gateway: "192.168.1.1"},
+					{Destination: "10.0.0.0/8", Gateway: "192.168.1.1"},
+				},
+			},
+			networkMTU: 1460,
+		},
+		{
+			name: "no routes",
+			config: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{MTU: ptr.To[int32](8896), Addresses: []string{"192.168.1.2/24"}},
+			},
+			networkMTU: 1460,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkNetworkMTU("eth1", tc.config, tc.networkMTU)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("checkNetworkMTU() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
 func TestDynamicProfiles(t *testing.T) {
 	ctx := context.Background()
 
@@ -853,3 +1112,262 @@ func TestGetDeviceNetworkConfigWithWebhook(t *testing.T) {
 		})
 	}
 }
+
+func Test_addRDMAExtraDevices(t *testing.T) {
+	regularFile := filepath.Join(t.TempDir(), "umad0")
+	if err := os.WriteFile(regularFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		paths   []string
+		want    sets.Set[string]
+		wantErr bool
+	}{
+		{
+			name: "no extra devices",
+			want: sets.New(rdmaCmPath),
+		},
+		{
+			name:  "character device",
+			paths: []string{"/dev/null"},
+			want:  sets.New(rdmaCmPath, "/dev/null"),
+		},
+		{
+			name:  "duplicated device",
+			paths: []string{"/dev/null", "/dev/null"},
+			want:  sets.New(rdmaCmPath, "/dev/null"),
+		},
+		{
+			name:    "missing device",
+			paths:   []string{"/dev/null", "/dev/infiniband/does-not-exist"},
+			want:    sets.New(rdmaCmPath, "/dev/null"),
+			wantErr: true,
+		},
+		{
+			name:    "not a device file",
+			paths:   []string{regularFile},
+			want:    sets.New(rdmaCmPath),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charDevices := sets.New(rdmaCmPath)
+			err := addRDMAExtraDevices(charDevices, tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addRDMAExtraDevices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !charDevices.Equal(tt.want) {
+				t.Errorf("addRDMAExtraDevices() char devices = %v, want %v", sets.List(charDevices), sets.List(tt.want))
+			}
+		})
+	}
+}
+
+func Test_claimRDMADevices(t *testing.T) {
+	owners := map[string]string{}
+	got, err := claimRDMADevices(owners, []string{"mlx5_0", "mlx5_1"}, "bond0")
+	if err != nil {
+		t.Fatalf("claimRDMADevices() unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"mlx5_0", "mlx5_1"}) {
+		t.Errorf("claimRDMADevices() link devices = %v, want [mlx5_0 mlx5_1]", got)
+	}
+	if owners["mlx5_0"] != "bond0" || owners["mlx5_1"] != "bond0" {
+		t.Errorf("claimRDMADevices() owners = %v, want both RDMA devices owned by bond0", owners)
+	}
+	// the same device can be processed again, e.g. on retries
+	if got, err := claimRDMADevices(owners, []string{"mlx5_0", "mlx5_1"}, "bond0"); err != nil || len(got) != 2 {
+		t.Errorf("claimRDMADevices() same device = %v, %v, want both link devices", got, err)
+	}
+	// the IB-only device of the same hardware is moved with the netdev
+	if got, err := claimRDMADevices(owners, []string{"mlx5_0"}, "pci-0000-8a-00-0"); err != nil || len(got) != 0 {
+		t.Errorf("claimRDMADevices() RDMA device of another device = %v, %v, want no link devices", got, err)
+	}
+	if _, err := claimRDMADevices(owners, []string{"mlx5_2", "mlx5_1"}, "eth3"); err == nil {
+		t.Errorf("claimRDMADevices() expected error for an RDMA device of another aggregation")
+	}
+	if _, err := claimRDMADevices(map[string]string{}, []string{"mlx5_0", "mlx5_0"}, "bond0"); err == nil {
+		t.Errorf("claimRDMADevices() expected error for a duplicate RDMA device")
+	}
+}
+
+func Test_buildRDMAConfigWithoutLinkDevices(t *testing.T) {
+	cfg := buildRDMAConfig(nil, sets.New[string]())
+	if len(cfg.LinkDevs()) != 0 {
+		t.Errorf("buildRDMAConfig() link devices = %v, want none", cfg.LinkDevs())
+	}
+}
+
+func TestPrepareResourceClaimAggregatedRDMA(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	// The claims are prepared with the netlink handle of the current network
+	// namespace, the interface is created in a test namespace.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	testNS, err := netns.New()
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer testNS.Close()
+	// Switch back to the original namespace
+	netns.Set(origns) // nolint:errcheck
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	la := netlink.NewLinkAttrs()
+	la.Name = "bond0"
+	if err := nhNs.LinkAdd(&netlink.Veth{LinkAttrs: la, PeerName: "bond0p"}); err != nil {
+		t.Fatalf("Failed to add veth link: %v", err)
+	}
+
+	claim := &resourcev1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{UID: "claim-uid-1", Namespace: "default", Name: "claim1"},
+		Status: resourcev1.ResourceClaimStatus{
+			ReservedFor: []resourcev1.ResourceClaimConsumerReference{
+				{APIGroup: "", Resource: "pods", Name: "test-pod", UID: "pod-uid-1"},
+			},
+			Allocation: &resourcev1.AllocationResult{
+				Devices: resourcev1.DeviceAllocationResult{
+					Results: []resourcev1.DeviceRequestAllocationResult{
+						{Driver: "test.driver", Device: "bond0", Request: "req-1"},
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name        string
+		rdmaDevices []string
+		rdmaErr     error
+		want        RDMAConfig
+		wantErr     string
+	}{
+		{
+			name: "no RDMA device",
+		},
+		{
+			name:        "single RDMA device",
+			rdmaDevices: []string{"mlx5_0"},
+			want:        RDMAConfig{LinkDev: "mlx5_0"},
+		},
+		{
+			name:        "aggregated RDMA devices",
+			rdmaDevices: []string{"mlx5_0", "mlx5_1"},
+			want:        RDMAConfig{LinkDev: "mlx5_0", ExtraLinkDevs: []string{"mlx5_1"}},
+		},
+		{
+			name:        "duplicate RDMA device",
+			rdmaDevices: []string{"mlx5_0", "mlx5_0"},
+			wantErr:     "duplicate RDMA devices",
+		},
+		{
+			name:    "inconsistent RDMA devices",
+			rdmaErr: fmt.Errorf("RDMA devices mlx5_0 and mlx5_1 of interface bond0 have different link layers"),
+			wantErr: "different link layers",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeDB := newFakeInventoryDB()
+			fakeDB.GetNetInterfaceNameFunc = func(deviceName string) (string, error) {
+				return deviceName, nil
+			}
+			np := &NetworkDriver{
+				netdb:          fakeDB,
+				driverName:     "test.driver",
+				eventRecorder:  record.NewFakeRecorder(100),
+				podConfigStore: mustNewPodConfigStore(),
+				rdmaDevices: func(ifName string) ([]string, error) {
+					if ifName != "bond0" {
+						return nil, fmt.Errorf("unexpected interface %s", ifName)
+					}
+					return tt.rdmaDevices, tt.rdmaErr
+				},
+			}
+
+			// the subtest runs on another thread
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			if err := netns.Set(testNS); err != nil {
+				t.Fatalf("failed to switch to the test namespace: %v", err)
+			}
+			res := np.prepareResourceClaim(context.Background(), claim)
+			if err := netns.Set(origns); err != nil {
+				t.Fatalf("failed to switch back to the original namespace: %v", err)
+			}
+			if tt.wantErr != "" {
+				if res.Err == nil || !strings.Contains(res.Err.Error(), tt.wantErr) {
+					t.Fatalf("prepareResourceClaim() error = %v, want %q", res.Err, tt.wantErr)
+				}
+				return
+			}
+			if res.Err != nil {
+				t.Fatalf("prepareResourceClaim() unexpected error: %v", res.Err)
+			}
+			podCfg, ok := np.podConfigStore.GetPodConfig("pod-uid-1")
+			if !ok {
+				t.Fatalf("Expected pod config to be stored")
+			}
+			got := podCfg.DeviceConfigs["bond0"].RDMADevice
+			// the char devices depend on the host
+			got.DevChars = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RDMA configuration = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(got.LinkDevs(), tt.rdmaDevices) {
+				t.Errorf("LinkDevs() = %v, want %v", got.LinkDevs(), tt.rdmaDevices)
+			}
+		})
+	}
+}
+
+func Test_buildVFIOConfig(t *testing.T) {
+	devDir := t.TempDir()
+	// The VFIO devices are faked with links to a character device.
+	for _, name := range []string{"vfio", "42"} {
+		if err := os.Symlink("/dev/null", filepath.Join(devDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(devDir, "43"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := buildVFIOConfig(devDir, "42")
+	if err != nil {
+		t.Fatalf("buildVFIOConfig() unexpected error: %v", err)
+	}
+	var paths []string
+	for _, dev := range cfg.DevChars {
+		if dev.Type != "c" {
+			t.Errorf("device %s type = %q, want c", dev.Path, dev.Type)
+		}
+		paths = append(paths, dev.Path)
+	}
+	if want := []string{filepath.Join(devDir, "vfio"), filepath.Join(devDir, "42")}; cfg.IOMMUGroup != "42" || !slices.Equal(paths, want) {
+		t.Errorf("buildVFIOConfig() = group %q with devices %v, want group 42 with devices %v", cfg.IOMMUGroup, paths, want)
+	}
+
+	// The group device is required.
+	if _, err := buildVFIOConfig(devDir, "44"); err == nil {
+		t.Errorf("buildVFIOConfig() without group device expected error")
+	}
+	if _, err := buildVFIOConfig(devDir, "43"); err == nil {
+		t.Errorf("buildVFIOConfig() with a group device not a device file expected error")
+	}
+}
@@ -0,0 +1,313 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	resourceapply "k8s.io/client-go/applyconfigurations/resource/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// The drift checks verify periodically that the interfaces of the running
+// Pods are still in their network namespace with the addresses and routes of
+// their configuration. Kernel events or external tooling can move or
+// reconfigure an interface and silently break the Pod network; the missing
+// addresses and routes are restored and the drift is reported in the
+// NetworkDrift condition of the device in the ResourceClaim status.
+
+const (
+	conditionNetworkDrift = "NetworkDrift"
+
+	reasonDriftInterfaceMissing = "InterfaceMissing"
+	reasonDriftRestored         = "ConfigurationRestored"
+	reasonDriftRestoreFailed    = "RestoreFailed"
+	reasonNoDrift               = "NoDrift"
+)
+
+// driftResult is the outcome of the drift check of a device, the reason is
+// empty if the interface matches its configuration.
+type driftResult struct {
+	reason  string
+	message string
+}
+
+// driftFieldManager returns the field manager of the NetworkDrift condition.
+// It is different from the one of the RunPodSandbox status so applying the
+// condition alone does not remove the other conditions and the network data
+// of the device.
+func (np *NetworkDriver) driftFieldManager() string {
+	return np.driverName + "-drift"
+}
+
+// runDriftChecks checks the drift of the interfaces of the running Pods every
+// interval until the context is done.
+func (np *NetworkDriver) runDriftChecks(ctx context.Context, interval time.Duration) {
+	klog.Infof("Checking the drift of the interfaces of the running pods every %v", interval)
+	ticker := np.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			np.checkDrift(ctx)
+		}
+	}
+}
+
+// checkDrift checks the interfaces of the Pods whose network namespace is
+// known, the devices without interface, e.g. IB-only RDMA devices, are not
+// checked. A drift is only acted upon when it is seen on two consecutive
+// checks, so the interfaces being attached to a Pod or updated are not
+// reported. The NetworkDrift condition is only applied when it changes.
+func (np *NetworkDriver) checkDrift(ctx context.Context) {
+	statusUpdates := map[types.NamespacedName]*resourceapply.ResourceClaimStatusApplyConfiguration{}
+	seen := map[string]driftResult{}
+	reported := map[string]driftResult{}
+	for _, podUID := range np.podConfigStore.ListPods() {
+		podConfig, ok := np.podConfigStore.GetPodConfig(podUID)
+		if !ok || podConfig.NetNS == "" {
+			continue
+		}
+		for _, deviceName := range slices.Sorted(maps.Keys(podConfig.DeviceConfigs)) {
+			config := podConfig.DeviceConfigs[deviceName]
+			if config.NetworkInterfaceConfigInPod.Interface.Name == "" {
+				continue
+			}
+			key := string(podUID) + "/" + deviceName
+			previous, wasReported := np.driftReported[key]
+			result, ok := checkDeviceDrift(podConfig.NetNS, config, np.driftSeen[key].reason != "")
+			if !ok {
+				continue
+			}
+			if result.reason != "" && np.driftSeen[key].reason == "" {
+				// first time seen, confirmed on the next check
+				seen[key] = result
+				if wasReported {
+					reported[key] = previous
+				}
+				continue
+			}
+			if result.reason == "" && !wasReported {
+				continue
+			}
+			if result.reason == "" {
+				result = driftResult{reason: reasonNoDrift, message: "interface matches its configuration"}
+			}
+			reported[key] = result
+			if wasReported && previous == result {
+				continue
+			}
+			if result.reason != reasonNoDrift {
+				klog.Warningf("Drift of device %s of pod %s: %s", deviceName, podUID, result.message)
+				networkDriftTotal.WithLabelValues(result.reason).Inc()
+			}
+			claim := types.NamespacedName{Name: config.Claim.Name, Namespace: config.Claim.Namespace}
+			if statusUpdates[claim] == nil {
+				statusUpdates[claim] = resourceapply.ResourceClaimStatus()
+			}
+			statusUpdates[claim].WithDevices(resourceapply.AllocatedDeviceStatus().
+				WithDevice(deviceName).
+				WithDriver(np.driverName).
+				WithPool(np.nodeName).
+				WithConditions(networkDriftCondition(result)))
+		}
+	}
+	np.driftSeen = seen
+	np.driftReported = reported
+
+	for claim, status := range statusUpdates {
+		resourceClaimApply := resourceapply.ResourceClaim(claim.Name, claim.Namespace).WithStatus(status)
+		if err := np.applyClaimStatus(ctx, np.driftFieldManager(), claim, resourceClaimApply); err != nil {
+			klog.Infof("failed to update the drift status of claim %s/%s : %v", claim.Namespace, claim.Name, err)
+		}
+	}
+}
+
+// networkDriftCondition returns the NetworkDrift condition of the result, true
+// if the interface drifted from its configuration.
+func networkDriftCondition(result driftResult) *metav1apply.ConditionApplyConfiguration {
+	status := metav1.ConditionTrue
+	if result.reason == reasonNoDrift {
+		status = metav1.ConditionFalse
+	}
+	return metav1apply.Condition().
+		WithType(conditionNetworkDrift).
+		WithStatus(status).
+		WithReason(result.reason).
+		WithMessage(result.message).
+		WithLastTransitionTime(metav1.Now())
+}
+
+// checkDeviceDrift verifies that the interface of the device is in the
+// network namespace with the addresses and routes of its configuration. The
+// missing addresses and routes are restored if restore is true. It returns
+// false if the namespace is gone, the Pod is being deleted.
+//
+// The default routes without metric are not checked, they are not added when
+// the Pod already has a default route.
+func checkDeviceDrift(containerNsPath string, config DeviceConfig, restore bool) (driftResult, bool) {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return driftResult{}, false
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		klog.Infof("could not get netlink handle of namespace %s: %v", containerNsPath, err)
+		return driftResult{}, false
+	}
+	defer nhNs.Close()
+
+	ifName := config.NetworkInterfaceConfigInPod.Interface.Name
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return driftResult{
+			reason:  reasonDriftInterfaceMissing,
+			message: fmt.Sprintf("interface %s not found in the pod network namespace: %v", ifName, err),
+		}, true
+	}
+
+	missingAddresses, err := missingInterfaceAddresses(nhNs, nsLink, config.NetworkInterfaceConfigInPod.Interface.Addresses)
+	if err != nil {
+		klog.Infof("could not check the addresses of interface %s on namespace %s: %v", ifName, containerNsPath, err)
+		return driftResult{}, false
+	}
+	vrfTable := 0
+	if vrf := config.NetworkInterfaceConfigInPod.Interface.VRF; vrf != nil && vrf.Table != nil {
+		vrfTable = int(*vrf.Table)
+	}
+	missingRoutes, err := missingInterfaceRoutes(nhNs, nsLink, config.NetworkInterfaceConfigInPod.Routes, vrfTable)
+	if err != nil {
+		klog.Infof("could not check the routes of interface %s on namespace %s: %v", ifName, containerNsPath, err)
+		return driftResult{}, false
+	}
+	if len(missingAddresses) == 0 && len(missingRoutes) == 0 {
+		return driftResult{}, true
+	}
+
+	var missing []string
+	if len(missingAddresses) > 0 {
+		missing = append(missing, "addresses "+strings.Join(missingAddresses, ", "))
+	}
+	if len(missingRoutes) > 0 {
+		var routes []string
+		for _, route := range missingRoutes {
+			routes = append(routes, route.Destination)
+		}
+		missing = append(missing, "routes to "+strings.Join(routes, ", "))
+	}
+	message := fmt.Sprintf("interface %s is missing %s", ifName, strings.Join(missing, " and "))
+	if !restore {
+		return driftResult{reason: reasonDriftRestoreFailed, message: message}, true
+	}
+
+	var errorList []error
+	for _, address := range missingAddresses {
+		addr, err := netlink.ParseAddr(address)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		if err := nhNs.AddrReplace(nsLink, addr); err != nil {
+			errorList = append(errorList, fmt.Errorf("fail to restore address %s: %w", address, err))
+		}
+	}
+	if len(missingRoutes) > 0 {
+		if _, err := applyRoutingConfig(containerNsPath, ifName, missingRoutes, vrfTable); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	if err := errors.Join(errorList...); err != nil {
+		return driftResult{reason: reasonDriftRestoreFailed, message: fmt.Sprintf("%s, failed to restore them: %v", message, err)}, true
+	}
+	return driftResult{reason: reasonDriftRestored, message: message + ", restored"}, true
+}
+
+// missingInterfaceAddresses returns the addresses, in CIDR notation, that the
+// interface does not have.
+func missingInterfaceAddresses(nhNs nlwrap.Handle, link netlink.Link, addresses []string) ([]string, error) {
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+	current, err := nhNs.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, address := range addresses {
+		ip, ipNet, err := net.ParseCIDR(address)
+		if err != nil {
+			continue
+		}
+		if !slices.ContainsFunc(current, func(addr netlink.Addr) bool {
+			return addr.IP.Equal(ip) && slices.Equal(addr.Mask, ipNet.Mask)
+		}) {
+			missing = append(missing, address)
+		}
+	}
+	return missing, nil
+}
+
+// missingInterfaceRoutes returns the routes of the configuration that the
+// interface does not have.
+func missingInterfaceRoutes(nhNs nlwrap.Handle, link netlink.Link, routes []apis.RouteConfig, vrfTable int) ([]apis.RouteConfig, error) {
+	var missing []apis.RouteConfig
+	for _, route := range routes {
+		_, dst, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			continue
+		}
+		if isDefaultDestination(dst) && route.Metric == nil {
+			continue
+		}
+		table := route.Table
+		if vrfTable > 0 {
+			table = vrfTable
+		}
+		filter := &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Table:     routeTable(table),
+			Dst:       dst,
+		}
+		current, err := nhNs.RouteListFiltered(routeFamily(dst), filter, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE|netlink.RT_FILTER_DST)
+		if err != nil {
+			return nil, err
+		}
+		if len(current) == 0 {
+			missing = append(missing, route)
+		}
+	}
+	return missing, nil
+}
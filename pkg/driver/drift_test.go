@@ -0,0 +1,197 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestCheckDrift(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	if err := nhNs.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	addr, err := netlink.ParseAddr("192.168.50.2/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nhNs.AddrAdd(link, addr); err != nil {
+		t.Fatalf("Failed to add address to %s: %v", ifaceName, err)
+	}
+
+	nsPath := path.Join("/run/netns", nsName)
+	routes := []apis.RouteConfig{{Destination: "10.10.0.0/16", Gateway: "192.168.50.1"}}
+	if _, err := applyRoutingConfig(nsPath, ifaceName, routes, 0); err != nil {
+		t.Fatalf("applyRoutingConfig() failed: %v", err)
+	}
+
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+	kubeClient := fake.NewClientset(claim)
+	store, err := NewPodConfigStore(nil)
+	if err != nil {
+		t.Fatalf("NewPodConfigStore() failed: %v", err)
+	}
+	podUID := types.UID("pod1")
+	config := DeviceConfig{
+		Claim: types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+		NetworkInterfaceConfigInPod: apis.NetworkConfig{
+			Interface: apis.InterfaceConfig{Name: ifaceName, Addresses: []string{"192.168.50.2/24"}},
+			Routes:    routes,
+		},
+	}
+	if err := store.SetDeviceConfig(podUID, "eth0", config); err != nil {
+		t.Fatalf("SetDeviceConfig() failed: %v", err)
+	}
+	store.SetPodNetNs(podUID, nsPath)
+	np := &NetworkDriver{driverName: "dra.net", nodeName: "node1", kubeClient: kubeClient, podConfigStore: store}
+
+	driftCondition := func() *metav1.Condition {
+		t.Helper()
+		got, err := kubeClient.ResourceV1().ResourceClaims(claim.Namespace).Get(context.Background(), claim.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get claim: %v", err)
+		}
+		for _, device := range got.Status.Devices {
+			for _, condition := range device.Conditions {
+				if condition.Type == conditionNetworkDrift {
+					return &condition
+				}
+			}
+		}
+		return nil
+	}
+	wantCondition := func(status metav1.ConditionStatus, reason string) {
+		t.Helper()
+		condition := driftCondition()
+		if condition == nil {
+			t.Fatalf("claim has no %s condition, want %s with reason %s", conditionNetworkDrift, status, reason)
+		}
+		if condition.Status != status || condition.Reason != reason {
+			t.Errorf("%s condition = %s with reason %s (%s), want %s with reason %s", conditionNetworkDrift, condition.Status, condition.Reason, condition.Message, status, reason)
+		}
+	}
+
+	ctx := context.Background()
+	np.checkDrift(ctx)
+	if condition := driftCondition(); condition != nil {
+		t.Fatalf("%s condition reported without drift: %+v", conditionNetworkDrift, condition)
+	}
+
+	// Remove the route and the address, as an external tool would do.
+	_, dst, _ := net.ParseCIDR("10.10.0.0/16")
+	if err := nhNs.RouteDel(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst}); err != nil {
+		t.Fatalf("Failed to delete route: %v", err)
+	}
+	if err := nhNs.AddrDel(link, addr); err != nil {
+		t.Fatalf("Failed to delete address: %v", err)
+	}
+
+	// The drift is only acted upon when seen on two consecutive checks.
+	np.checkDrift(ctx)
+	if condition := driftCondition(); condition != nil {
+		t.Fatalf("%s condition reported on the first check: %+v", conditionNetworkDrift, condition)
+	}
+	np.checkDrift(ctx)
+	wantCondition(metav1.ConditionTrue, reasonDriftRestored)
+
+	missingAddresses, err := missingInterfaceAddresses(nhNs, link, config.NetworkInterfaceConfigInPod.Interface.Addresses)
+	if err != nil || len(missingAddresses) != 0 {
+		t.Errorf("addresses not restored, missing %v: %v", missingAddresses, err)
+	}
+	missingRoutes, err := missingInterfaceRoutes(nhNs, link, routes, 0)
+	if err != nil || len(missingRoutes) != 0 {
+		t.Errorf("routes not restored, missing %v: %v", missingRoutes, err)
+	}
+
+	np.checkDrift(ctx)
+	wantCondition(metav1.ConditionFalse, reasonNoDrift)
+
+	if err := nhNs.LinkDel(link); err != nil {
+		t.Fatalf("Failed to delete link %s: %v", ifaceName, err)
+	}
+	np.checkDrift(ctx)
+	wantCondition(metav1.ConditionFalse, reasonNoDrift)
+	np.checkDrift(ctx)
+	wantCondition(metav1.ConditionTrue, reasonDriftInterfaceMissing)
+
+	// The pod is gone, the devices are no longer checked.
+	store.DeletePod(podUID)
+	np.checkDrift(ctx)
+	if len(np.driftSeen) != 0 || len(np.driftReported) != 0 {
+		t.Errorf("drift of deleted pod still tracked: seen %v, reported %v", np.driftSeen, np.driftReported)
+	}
+}
@@ -19,15 +19,22 @@ package driver
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/cel-go/cel"
-	"sigs.k8s.io/dranet/pkg/apis"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/dranet/pkg/apis"
+	"sigs.k8s.io/dranet/pkg/filter"
 	"sigs.k8s.io/dranet/pkg/inventory"
+	"sigs.k8s.io/dranet/pkg/ipam"
 
+	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 
@@ -50,10 +57,22 @@ const (
 )
 
 const (
-	// maxAttempts indicates the number of times the driver will try to recover itself before failing
-	maxAttempts = 5
+	// defaultMaxRestartAttempts indicates the number of times the driver will try to recover itself before failing
+	defaultMaxRestartAttempts = 5
+	// defaultMaxPrepareConcurrency is the default number of claims prepared concurrently
+	defaultMaxPrepareConcurrency = 4
 )
 
+// restartBackoff is the delay between the restarts of the driver components
+// that fail, it doubles on every restart up to one minute and starts over once
+// a component ran for longer than that.
+var restartBackoff = wait.Backoff{
+	Duration: 1 * time.Second,
+	Factor:   2,
+	Steps:    math.MaxInt32,
+	Cap:      1 * time.Minute,
+}
+
 // This interface is our internal contract for the behavior we need from a *kubeletplugin.Helper, created specifically so we can fake it in tests.
 type pluginHelper interface {
 	PublishResources(context.Context, resourceslice.DriverResources) error
@@ -68,10 +87,14 @@ type inventoryDB interface {
 	GetNetInterfaceName(string) (string, error)
 	IsIBOnlyDevice(deviceName string) bool
 	GetRDMADeviceName(deviceName string) (string, error)
+	IsVFIODevice(deviceName string) bool
+	GetIOMMUGroup(deviceName string) (string, error)
 	GetDeviceConfig(deviceName string) (*apis.NetworkConfig, bool)
+	GetNetworkMTU(deviceName string) (int, bool)
 	RequestRescan()
 	GetProfileConfig(deviceName string, claimUID types.UID, config *apis.NetworkConfig) (*apis.NetworkConfig, error)
 	ReleaseProfileConfig(deviceName string, claimUID types.UID, config *apis.NetworkConfig) error
+	SetInUsePCIAddressesFunc(f func() sets.Set[string])
 }
 
 // WithFilter
@@ -81,6 +104,94 @@ func WithFilter(filter cel.Program) Option {
 	}
 }
 
+// WithFilterErrorAction sets what happens to a device when the filter
+// expression fails to evaluate against it.
+func WithFilterErrorAction(action filter.ErrorAction) Option {
+	return func(o *NetworkDriver) {
+		o.filterErrorAction = action
+	}
+}
+
+// WithIPAM sets the allocator of the IPAM pools.
+func WithIPAM(allocator *ipam.Allocator) Option {
+	return func(o *NetworkDriver) {
+		o.ipam = allocator
+	}
+}
+
+// WithDeniedEthtoolFeatures sets the ethtool features that claims are not
+// allowed to change.
+func WithDeniedEthtoolFeatures(features []string) Option {
+	return func(o *NetworkDriver) {
+		o.deniedEthtoolFeatures = sets.New(features...)
+	}
+}
+
+// WithEthtoolFixedFeaturePolicy sets what happens to the claims requesting an
+// ethtool feature the device does not allow to change.
+func WithEthtoolFixedFeaturePolicy(policy EthtoolFixedFeaturePolicy) Option {
+	return func(o *NetworkDriver) {
+		o.ethtoolFixedFeaturePolicy = policy
+	}
+}
+
+// WithNRIPluginName sets the name the NRI plugin registers with, by default
+// the driver name.
+func WithNRIPluginName(name string) Option {
+	return func(o *NetworkDriver) {
+		o.nriPluginName = name
+	}
+}
+
+// WithNRIPluginIndex sets the two digits index of the NRI plugin, it defines
+// the order the runtime invokes the plugins and must be unique on the node.
+func WithNRIPluginIndex(idx string) Option {
+	return func(o *NetworkDriver) {
+		o.nriPluginIdx = idx
+	}
+}
+
+// WithMaxPrepareConcurrency sets the maximum number of claims prepared
+// concurrently.
+func WithMaxPrepareConcurrency(n int) Option {
+	return func(o *NetworkDriver) {
+		o.maxPrepareConcurrency = n
+	}
+}
+
+// WithPreserveIPv6LinkLocalRoute sets whether the on-link fe80::/64 route of
+// the interfaces is moved to the Pod with the other routes.
+func WithPreserveIPv6LinkLocalRoute(preserve bool) Option {
+	return func(o *NetworkDriver) {
+		o.preserveIPv6LinkLocalRoute = preserve
+	}
+}
+
+// WithLinkCarrierTimeout sets how long the interfaces moved to the Pods are
+// waited to have carrier before reporting the network ready, zero disables the
+// wait.
+func WithLinkCarrierTimeout(timeout time.Duration) Option {
+	return func(o *NetworkDriver) {
+		o.linkCarrierTimeout = timeout
+	}
+}
+
+// WithDriftCheckInterval sets how often the interfaces of the running Pods are
+// checked against their configuration, zero disables the checks.
+func WithDriftCheckInterval(interval time.Duration) Option {
+	return func(o *NetworkDriver) {
+		o.driftCheckInterval = interval
+	}
+}
+
+// WithMaxRestartAttempts sets the number of times the NRI plugin and the
+// inventory are run before the driver fails, zero restarts them forever.
+func WithMaxRestartAttempts(n int) Option {
+	return func(o *NetworkDriver) {
+		o.maxRestartAttempts = n
+	}
+}
+
 // WithInventory sets the inventory database for the driver.
 func WithInventory(db inventoryDB) Option {
 	return func(o *NetworkDriver) {
@@ -102,18 +213,57 @@ type NetworkDriver struct {
 	eventRecorder record.EventRecorder
 	nodeName      string
 	nriPlugin     stub.Stub
-	kubeClient    kubernetes.Interface
+	nriPluginName string
+	nriPluginIdx  string
+	nriSocketPath string
+	// nriConnected is true while the NRI plugin is registered to the runtime.
+	nriConnected atomic.Bool
+	kubeClient   kubernetes.Interface
 
 	// contains the host interfaces
-	netdb      inventoryDB
-	celProgram cel.Program
+	netdb             inventoryDB
+	celProgram        cel.Program
+	filterErrorAction filter.ErrorAction
+	ipam              *ipam.Allocator
+	// ethtool features the claims are not allowed to change
+	deniedEthtoolFeatures sets.Set[string]
+	// what happens to the claims requesting a fixed ethtool feature, the
+	// zero value behaves as EthtoolFixedFeaturePolicyError
+	ethtoolFixedFeaturePolicy EthtoolFixedFeaturePolicy
+	// maximum number of claims prepared concurrently
+	maxPrepareConcurrency int
+	// keep the fe80::/64 route of the interfaces moved to the pods
+	preserveIPv6LinkLocalRoute bool
+	// wait for the carrier of the interfaces moved to the pods, zero disables it
+	linkCarrierTimeout time.Duration
+	// number of runs of the NRI plugin and the inventory before failing, zero
+	// restarts them forever
+	maxRestartAttempts int
+	// interval of the drift checks of the pod interfaces, zero disables them
+	driftCheckInterval time.Duration
+	// drift seen on the last check and drift reported in the claim status,
+	// by pod UID and device, only used by the drift checks goroutine
+	driftSeen     map[string]driftResult
+	driftReported map[string]driftResult
+
+	// renewals of the DHCP leases of the devices, by pod UID and device
+	dhcpRenewalsMu sync.Mutex
+	dhcpRenewals   map[string]*dhcpRenewal
 
 	// Cache the rdma shared mode state
 	rdmaSharedMode bool
+	// attachRdma moves the RDMA link devices to the pods, defaults to
+	// attachRdmaIfExclusive, injectable for testing
+	attachRdma rdmaAttacher
+	// rdmaDevices returns the RDMA link devices of an interface, defaults to
+	// inventory.GetRdmaDevices, injectable for testing
+	rdmaDevices    func(ifName string) ([]string, error)
 	podConfigStore *PodConfigStore
 	dbPath         string // path for persistent bbolt database; empty means in-memory
 
 	clock clock.WithTicker // Injectable clock for testing
+	// ctx is canceled when the driver stops, it bounds the background tasks.
+	ctx context.Context
 }
 
 type Option func(*NetworkDriver)
@@ -135,17 +285,29 @@ func Start(ctx context.Context, driverName string, kubeClient kubernetes.Interfa
 	eventRecorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: driverName, Host: nodeName})
 
 	plugin := &NetworkDriver{
-		driverName:     driverName,
-		nodeName:       nodeName,
-		kubeClient:     kubeClient,
-		rdmaSharedMode: rdmaNetnsMode == apis.RdmaNetnsModeShared,
-		clock:          clock.RealClock{},
-		eventRecorder:  eventRecorder,
+		driverName:        driverName,
+		nodeName:          nodeName,
+		kubeClient:        kubeClient,
+		rdmaSharedMode:    rdmaNetnsMode == apis.RdmaNetnsModeShared,
+		clock:             clock.RealClock{},
+		eventRecorder:     eventRecorder,
+		filterErrorAction: filter.ErrorActionKeep,
+		nriPluginName:     driverName,
+		nriPluginIdx:      "00",
+		nriSocketPath:     api.DefaultSocketPath,
+
+		maxPrepareConcurrency:      defaultMaxPrepareConcurrency,
+		preserveIPv6LinkLocalRoute: true,
+		maxRestartAttempts:         defaultMaxRestartAttempts,
+		ctx:                        ctx,
 	}
 
 	for _, o := range opts {
 		o(plugin)
 	}
+	if err := validateNRIPluginIndex(plugin.nriPluginIdx); err != nil {
+		return nil, err
+	}
 
 	// Initialize the pod config store with optional bbolt checkpoint backend.
 	var checkpointer Checkpointer
@@ -164,6 +326,8 @@ func Start(ctx context.Context, driverName string, kubeClient kubernetes.Interfa
 		return nil, fmt.Errorf("failed to initialize pod config store: %v", err)
 	}
 	plugin.podConfigStore = store
+	plugin.reconcileIPAM()
+	plugin.reconcileChildInterfaces()
 
 	driverPluginPath := filepath.Join(kubeletPluginPath, driverName)
 	err = os.MkdirAll(driverPluginPath, 0750)
@@ -194,12 +358,14 @@ func Start(ctx context.Context, driverName string, kubeClient kubernetes.Interfa
 
 	// register the NRI plugin
 	nriOpts := []stub.Option{
-		stub.WithPluginName(driverName),
-		stub.WithPluginIdx("00"),
+		stub.WithPluginName(plugin.nriPluginName),
+		stub.WithPluginIdx(plugin.nriPluginIdx),
+		stub.WithSocketPath(plugin.nriSocketPath),
 		// https://github.com/containerd/nri/pull/173
 		// Otherwise it silently exits the program
 		stub.WithOnClose(func() {
-			klog.Infof("%s NRI plugin closed", driverName)
+			plugin.nriConnected.Store(false)
+			klog.Infof("%s NRI plugin closed", plugin.nriPluginName)
 		}),
 	}
 	stub, err := stub.New(plugin, nriOpts...)
@@ -209,47 +375,79 @@ func Start(ctx context.Context, driverName string, kubeClient kubernetes.Interfa
 	plugin.nriPlugin = stub
 
 	go func() {
-		for i := 0; i < maxAttempts; i++ {
-			err = plugin.nriPlugin.Run(ctx)
-			if err != nil {
-				klog.Infof("NRI plugin failed with error %v", err)
-			}
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				klog.Infof("Restarting NRI plugin %d out of %d", i, maxAttempts)
-			}
+		if err := runWithRestarts(ctx, "NRI plugin", plugin.nriPlugin.Run, plugin.maxRestartAttempts, restartBackoff, plugin.clock, sleepWithContext); err != nil {
+			klog.Fatal(err)
 		}
-		klog.Fatalf("NRI plugin failed for %d times to be restarted", maxAttempts)
 	}()
 
 	// register the host network interfaces
 	if plugin.netdb == nil {
 		plugin.netdb = inventory.New()
 	}
+	plugin.netdb.SetInUsePCIAddressesFunc(plugin.podConfigStore.PCIAddresses)
 	go func() {
-		for i := 0; i < maxAttempts; i++ {
-			err = plugin.netdb.Run(ctx)
-			if err != nil {
-				klog.Infof("Network Device DB failed with error %v", err)
-			}
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				klog.Infof("Restarting Network Device DB %d out of %d", i, maxAttempts)
-			}
+		if err := runWithRestarts(ctx, "Network Device DB", plugin.netdb.Run, plugin.maxRestartAttempts, restartBackoff, plugin.clock, sleepWithContext); err != nil {
+			klog.Fatal(err)
 		}
-		klog.Fatalf("Network Device DB failed for %d times to be restarted", maxAttempts)
 	}()
 
 	// publish available resources
 	go plugin.PublishResources(ctx)
 
+	if plugin.driftCheckInterval > 0 {
+		go plugin.runDriftChecks(ctx, plugin.driftCheckInterval)
+	}
+
 	return plugin, nil
 }
 
+// runWithRestarts runs the component until the context is done, restarting it
+// with exponential backoff every time it returns. A run that lasted longer than
+// the backoff cap was healthy, so the delay starts over from the initial one.
+// It returns an error once the component ran maxAttempts times, zero restarts
+// it forever.
+func runWithRestarts(ctx context.Context, name string, run func(context.Context) error, maxAttempts int, backoff wait.Backoff, clk clock.PassiveClock, sleep func(context.Context, time.Duration) bool) error {
+	initial := backoff
+	for i := 1; maxAttempts <= 0 || i <= maxAttempts; i++ {
+		started := clk.Now()
+		if err := run(ctx); err != nil {
+			klog.Infof("%s failed with error %v", name, err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if maxAttempts > 0 && i == maxAttempts {
+			break
+		}
+		if clk.Since(started) > initial.Cap {
+			backoff = initial
+		}
+		delay := backoff.Step()
+		if maxAttempts > 0 {
+			klog.Infof("Restarting %s in %v, attempt %d out of %d", name, delay, i, maxAttempts)
+		} else {
+			klog.Infof("Restarting %s in %v, attempt %d", name, delay, i)
+		}
+		if !sleep(ctx, delay) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s failed for %d times to be restarted", name, maxAttempts)
+}
+
+// sleepWithContext waits for the duration, it returns false if the context is
+// done first.
+func sleepWithContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
 // Stop handles the graceful termination of the Network Driver by coordinating
 // the shutdown of its DRA and NRI plugin components.
 //
@@ -357,3 +555,12 @@ func (np *NetworkDriver) Stop(ctxCancel context.CancelFunc) {
 
 	klog.Info("Driver stopped.")
 }
+
+// validateNRIPluginIndex checks the NRI plugin index is made of two digits,
+// as required by the runtime to order the plugins.
+func validateNRIPluginIndex(idx string) error {
+	if len(idx) != 2 || idx[0] < '0' || idx[0] > '9' || idx[1] < '0' || idx[1] > '9' {
+		return fmt.Errorf("invalid NRI plugin index %q, must be two digits", idx)
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package driver
 
 import (
 	"context"
+	"errors"
+	"math"
+	"slices"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -9,6 +12,8 @@ import (
 	"github.com/containerd/nri/pkg/stub"
 	resourcev1 "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
 	registerapi "k8s.io/kubelet/pkg/apis/pluginregistration/v1"
 	testingclock "k8s.io/utils/clock/testing"
@@ -51,6 +56,9 @@ type fakeInventoryDB struct {
 	GetDeviceConfigFunc func(deviceName string) (*apis.NetworkConfig, bool)
 	GetNetInterfaceNameFunc func(deviceName string) (string, error)
 	IsIBOnlyDeviceFunc      func(deviceName string) bool
+	IsVFIODeviceFunc        func(deviceName string) bool
+	GetIOMMUGroupFunc       func(deviceName string) (string, error)
+	GetNetworkMTUFunc       func(deviceName string) (int, bool)
 	GetProfileConfigFunc    func(deviceName string, claimUID types.UID, config *apis.NetworkConfig) (*apis.NetworkConfig, error)
 	ReleaseProfileConfigFunc func(deviceName string, claimUID types.UID, config *apis.NetworkConfig) error
 }
@@ -83,6 +91,20 @@ func (m *fakeInventoryDB) IsIBOnlyDevice(deviceName string) bool {
 
 func (m *fakeInventoryDB) GetRDMADeviceName(_ string) (string, error) { return "", nil }
 
+func (m *fakeInventoryDB) IsVFIODevice(deviceName string) bool {
+	if m.IsVFIODeviceFunc != nil {
+		return m.IsVFIODeviceFunc(deviceName)
+	}
+	return false
+}
+
+func (m *fakeInventoryDB) GetIOMMUGroup(deviceName string) (string, error) {
+	if m.GetIOMMUGroupFunc != nil {
+		return m.GetIOMMUGroupFunc(deviceName)
+	}
+	return "", nil
+}
+
 func (m *fakeInventoryDB) GetDeviceConfig(deviceName string) (*apis.NetworkConfig, bool) {
 	if m.GetDeviceConfigFunc != nil {
 		return m.GetDeviceConfigFunc(deviceName)
@@ -90,6 +112,13 @@ func (m *fakeInventoryDB) GetDeviceConfig(deviceName string) (*apis.NetworkConfi
 	return nil, false
 }
 
+func (m *fakeInventoryDB) GetNetworkMTU(deviceName string) (int, bool) {
+	if m.GetNetworkMTUFunc != nil {
+		return m.GetNetworkMTUFunc(deviceName)
+	}
+	return 0, false
+}
+
 func (m *fakeInventoryDB) RequestRescan() {
 	m.rescanCalls.Add(1)
 }
@@ -108,6 +137,8 @@ func (m *fakeInventoryDB) ReleaseProfileConfig(deviceName string, claimUID types
 	return nil
 }
 
+func (m *fakeInventoryDB) SetInUsePCIAddressesFunc(_ func() sets.Set[string]) {}
+
 // fakeNriStub is a mock implementation of the stub.Stub interface for testing.
 type fakeNriStub struct {
 	stub.Stub
@@ -200,3 +231,116 @@ func TestStop(t *testing.T) {
 		t.Errorf("nriPlugin.Stop() was not called")
 	}
 }
+
+func TestNRIPluginOptions(t *testing.T) {
+	np := &NetworkDriver{nriPluginName: "dra.net", nriPluginIdx: "00"}
+	for _, o := range []Option{WithNRIPluginName("dra.net-next"), WithNRIPluginIndex("05")} {
+		o(np)
+	}
+	if np.nriPluginName != "dra.net-next" {
+		t.Errorf("nriPluginName = %q, want %q", np.nriPluginName, "dra.net-next")
+	}
+	if np.nriPluginIdx != "05" {
+		t.Errorf("nriPluginIdx = %q, want %q", np.nriPluginIdx, "05")
+	}
+}
+
+func TestValidateNRIPluginIndex(t *testing.T) {
+	tests := []struct {
+		idx     string
+		wantErr bool
+	}{
+		{idx: "00"},
+		{idx: "10"},
+		{idx: "99"},
+		{idx: "", wantErr: true},
+		{idx: "5", wantErr: true},
+		{idx: "100", wantErr: true},
+		{idx: "a1", wantErr: true},
+		{idx: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.idx, func(t *testing.T) {
+			if err := validateNRIPluginIndex(tt.idx); (err != nil) != tt.wantErr {
+				t.Errorf("validateNRIPluginIndex(%q) error = %v, wantErr %v", tt.idx, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunWithRestarts(t *testing.T) {
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Steps: math.MaxInt32, Cap: 10 * time.Second}
+	tests := []struct {
+		name        string
+		maxAttempts int
+		// cancel the context after the run with this number, zero never
+		cancelAfter int
+		// how long the run with this number lasted, the others return at once
+		healthyRun int
+		wantRuns    int
+		wantDelays  []time.Duration
+		wantErr     bool
+	}{
+		{
+			name:        "attempts exhausted",
+			maxAttempts: 5,
+			wantRuns:    5,
+			wantDelays:  []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+			wantErr:     true,
+		},
+		{
+			name:        "context done",
+			maxAttempts: 5,
+			cancelAfter: 2,
+			wantRuns:    2,
+			wantDelays:  []time.Duration{1 * time.Second},
+		},
+		{
+			name:        "retry forever",
+			cancelAfter: 7,
+			wantRuns:    7,
+			wantDelays:  []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:        "backoff reset after a healthy run",
+			cancelAfter: 8,
+			healthyRun:  6,
+			wantRuns:    8,
+			wantDelays:  []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 1 * time.Second, 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			runs := 0
+			run := func(context.Context) error {
+				runs++
+				if runs == tt.healthyRun {
+					fakeClock.Step(time.Minute)
+				}
+				if runs == tt.cancelAfter {
+					cancel()
+				}
+				return errors.New("component failed")
+			}
+			var delays []time.Duration
+			sleep := func(_ context.Context, d time.Duration) bool {
+				delays = append(delays, d)
+				return true
+			}
+
+			err := runWithRestarts(ctx, "test", run, tt.maxAttempts, backoff, fakeClock, sleep)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runWithRestarts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("runs = %d, want %d", runs, tt.wantRuns)
+			}
+			if !slices.Equal(delays, tt.wantDelays) {
+				t.Errorf("delays = %v, want %v", delays, tt.wantDelays)
+			}
+		})
+	}
+}
@@ -17,22 +17,45 @@ limitations under the License.
 package driver
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
 )
 
-// unpinBPFPrograms runs in the host namespace to delete all the pinned bpf programs
-func unpinBPFPrograms(ifName string) error {
+const bpffsPath = "/sys/fs/bpf"
+
+// disabledEBPFProgramTypes returns the types of eBPF programs to detach from
+// the interface, all of them if DisableEBPFPrograms is set.
+func disabledEBPFProgramTypes(cfg apis.InterfaceConfig) sets.Set[string] {
+	if cfg.DisableEBPFPrograms != nil && *cfg.DisableEBPFPrograms {
+		return sets.New(apis.EBPFProgramTypeTC, apis.EBPFProgramTypeTCX, apis.EBPFProgramTypeXDP)
+	}
+	return sets.New(cfg.DisableEBPF...)
+}
+
+// unpinBPFPrograms runs in the host namespace to delete the pinned bpf links of
+// the given program types. Only the TCX, netkit and XDP programs are attached
+// with links, the classic TC filters are not pinned.
+// The walk stops when ctx is done, leaving the links not examined yet pinned.
+func unpinBPFPrograms(ctx context.Context, ifName string, programTypes sets.Set[string]) error {
+	if !programTypes.HasAny(apis.EBPFProgramTypeTCX, apis.EBPFProgramTypeXDP) {
+		return nil
+	}
 	device, err := nlwrap.LinkByName(ifName)
 	if err != nil {
 		return err
@@ -40,20 +63,36 @@ func unpinBPFPrograms(ifName string) error {
 	ifIndex := uint32(device.Attrs().Index)
 
 	klog.V(2).Infof("Attempting to unpin eBPF programs from interface %s", ifName)
-	return filepath.Walk("/sys/fs/bpf", func(pinPath string, info os.FileInfo, err error) error {
+	start := time.Now()
+	examined, err := unpinBPFProgramsFromPath(ctx, bpffsPath, ifIndex, programTypes)
+	klog.V(2).Infof("Examined %d pinned eBPF links for interface %s in %v", examined, ifName, time.Since(start))
+	return err
+}
+
+// unpinBPFProgramsFromPath walks the bpf filesystem mounted on root and unpins
+// the links of the given program types attached to ifIndex. It returns the
+// number of pinned files examined.
+func unpinBPFProgramsFromPath(ctx context.Context, root string, ifIndex uint32, programTypes sets.Set[string]) (int, error) {
+	examined := 0
+	err := filepath.WalkDir(root, func(pinPath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("walk of %s interrupted after examining %d links: %w", root, examined, ctxErr)
+		}
 
-		if info.IsDir() {
+		if d.IsDir() {
 			return nil
 		}
+		examined++
 
 		l, err := link.LoadPinnedLink(pinPath, &ebpf.LoadPinOptions{})
 		if err != nil {
 			klog.V(4).Infof("error getting link %s: %v", pinPath, err)
 			return nil
 		}
+		defer l.Close()
 
 		linkInfo, err := l.Info()
 		if err != nil {
@@ -62,18 +101,22 @@ func unpinBPFPrograms(ifName string) error {
 		}
 
 		var linkIfIndex uint32
+		var programType string
 		switch linkInfo.Type {
 		case link.TCXType:
+			programType = apis.EBPFProgramTypeTCX
 			extra := linkInfo.TCX()
 			if extra != nil {
 				linkIfIndex = extra.Ifindex
 			}
 		case link.NetkitType:
+			programType = apis.EBPFProgramTypeTCX
 			extra := linkInfo.Netkit()
 			if extra != nil {
 				linkIfIndex = extra.Ifindex
 			}
 		case link.XDPType:
+			programType = apis.EBPFProgramTypeXDP
 			extra := linkInfo.XDP()
 			if extra != nil {
 				linkIfIndex = extra.Ifindex
@@ -81,7 +124,7 @@ func unpinBPFPrograms(ifName string) error {
 		default:
 			return nil
 		}
-		if linkIfIndex != ifIndex {
+		if linkIfIndex != ifIndex || !programTypes.Has(programType) {
 			return nil
 		}
 		err = l.Unpin()
@@ -92,14 +135,15 @@ func unpinBPFPrograms(ifName string) error {
 		}
 		return nil
 	})
-
+	return examined, err
 }
 
-// detachEBPFPrograms detaches all eBPF programs (TC and TCX) from a given network interface.
-// It attempts to remove both classic TC filters and newer TCX programs.
+// detachEBPFPrograms detaches the eBPF programs of the given types (classic TC
+// filters, TCX programs and XDP programs) from a given network interface.
 // It runs inside the network namespace to avoid programs on the root namespace
 // to cause issues detaching the programs.
-func detachEBPFPrograms(containerNsPAth string, ifName string) error {
+// It stops when ctx is done, leaving the remaining programs attached.
+func detachEBPFPrograms(ctx context.Context, containerNsPAth string, ifName string, programTypes sets.Set[string]) error {
 	origns, err := netns.Get()
 	if err != nil {
 		return fmt.Errorf("unexpected error trying to get namespace: %v", err)
@@ -127,41 +171,65 @@ func detachEBPFPrograms(containerNsPAth string, ifName string) error {
 	}
 
 	// Detach TC filters (legacy)
-	klog.V(2).Infof("Attempting to detach TC filters from interface %s", device.Attrs().Name)
-	for _, parent := range []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS} {
-		filters, err := nlwrap.FilterList(device, parent)
-		if err != nil {
-			klog.V(4).Infof("Could not list TC filters for interface %s (parent %d): %v", device.Attrs().Name, parent, err)
-			continue
-		}
-		for _, f := range filters {
-			if bpfFilter, ok := f.(*netlink.BpfFilter); ok {
-				klog.V(4).Infof("Deleting TC filter %s from interface %s (parent %d)", bpfFilter.Name, device.Attrs().Name, parent)
-				if err := netlink.FilterDel(f); err != nil {
-					klog.V(2).Infof("failed to delete TC filter %s on %s: %v", bpfFilter.Name, device.Attrs().Name, err)
+	if programTypes.Has(apis.EBPFProgramTypeTC) {
+		klog.V(2).Infof("Attempting to detach TC filters from interface %s", device.Attrs().Name)
+		for _, parent := range []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS} {
+			filters, err := nlwrap.FilterList(device, parent)
+			if err != nil {
+				klog.V(4).Infof("Could not list TC filters for interface %s (parent %d): %v", device.Attrs().Name, parent, err)
+				continue
+			}
+			for _, f := range filters {
+				if err := ctx.Err(); err != nil {
+					return fmt.Errorf("detaching TC filters from %s interrupted: %w", ifName, err)
+				}
+				if bpfFilter, ok := f.(*netlink.BpfFilter); ok {
+					klog.V(4).Infof("Deleting TC filter %s from interface %s (parent %d)", bpfFilter.Name, device.Attrs().Name, parent)
+					if err := netlink.FilterDel(f); err != nil {
+						klog.V(2).Infof("failed to delete TC filter %s on %s: %v", bpfFilter.Name, device.Attrs().Name, err)
+					}
 				}
 			}
 		}
 	}
 
 	// Detach TCX programs
-	klog.V(2).Infof("Attempting to detach TCX programs from interface %s", device.Attrs().Name)
-	for _, attach := range []ebpf.AttachType{ebpf.AttachTCXIngress, ebpf.AttachTCXEgress} {
-		klog.V(2).Infof("Attempting to detach programs from attachment %s interface %s", attach.String(), device.Attrs().Name)
-		result, err := link.QueryPrograms(link.QueryOptions{
-			Target: int(device.Attrs().Index),
-			Attach: attach,
-		})
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		for _, p := range result.Programs {
-			klog.V(2).Infof("Attempting to detach program %d from interface %s", p.ID, device.Attrs().Name)
-			err = tryDetach(p.ID, device.Attrs().Index, attach)
+	if programTypes.Has(apis.EBPFProgramTypeTCX) {
+		klog.V(2).Infof("Attempting to detach TCX programs from interface %s", device.Attrs().Name)
+		for _, attach := range []ebpf.AttachType{ebpf.AttachTCXIngress, ebpf.AttachTCXEgress} {
+			klog.V(2).Infof("Attempting to detach programs from attachment %s interface %s", attach.String(), device.Attrs().Name)
+			result, err := link.QueryPrograms(link.QueryOptions{
+				Target: int(device.Attrs().Index),
+				Attach: attach,
+			})
 			if err != nil {
-				klog.V(2).Infof("Failed to detach program %d from interface %s", p.ID, device.Attrs().Name)
 				errs = append(errs, err)
+				continue
+			}
+			for _, p := range result.Programs {
+				if err := ctx.Err(); err != nil {
+					errs = append(errs, fmt.Errorf("detaching TCX programs from %s interrupted: %w", ifName, err))
+					return errors.Join(errs...)
+				}
+				klog.V(2).Infof("Attempting to detach program %d from interface %s", p.ID, device.Attrs().Name)
+				err = tryDetach(p.ID, device.Attrs().Index, attach)
+				if err != nil {
+					klog.V(2).Infof("Failed to detach program %d from interface %s", p.ID, device.Attrs().Name)
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+
+	// Detach the XDP program attached with netlink, the programs attached
+	// with links are detached when their pin is removed.
+	if programTypes.Has(apis.EBPFProgramTypeXDP) {
+		if xdp := device.Attrs().Xdp; xdp != nil && xdp.Attached {
+			klog.V(2).Infof("Attempting to detach XDP program %d from interface %s", xdp.ProgId, device.Attrs().Name)
+			for _, flags := range xdpDetachFlags(xdp.AttachMode) {
+				if err := netlink.LinkSetXdpFdWithFlags(device, -1, flags); err != nil {
+					errs = append(errs, fmt.Errorf("failed to detach XDP program %d from %s: %w", xdp.ProgId, ifName, err))
+				}
 			}
 		}
 	}
@@ -169,6 +237,22 @@ func detachEBPFPrograms(containerNsPAth string, ifName string) error {
 	return errors.Join(errs...)
 }
 
+// xdpDetachFlags returns the flags to detach the XDP programs of each of the
+// modes in the attach mode reported by the interface, a program can be
+// attached in the generic, native and offloaded modes at the same time.
+func xdpDetachFlags(attachMode uint32) []int {
+	switch attachMode {
+	case nl.XDP_ATTACHED_SKB:
+		return []int{unix.XDP_FLAGS_SKB_MODE}
+	case nl.XDP_ATTACHED_DRV:
+		return []int{unix.XDP_FLAGS_DRV_MODE}
+	case nl.XDP_ATTACHED_HW:
+		return []int{unix.XDP_FLAGS_HW_MODE}
+	default:
+		return []int{unix.XDP_FLAGS_SKB_MODE, unix.XDP_FLAGS_DRV_MODE, unix.XDP_FLAGS_HW_MODE}
+	}
+}
+
 func tryDetach(id ebpf.ProgramID, deviceIdx int, attach ebpf.AttachType) error {
 	prog, err := ebpf.NewProgramFromID(id)
 	if err != nil {
@@ -0,0 +1,250 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func Test_unpinBPFProgramsFromPath(t *testing.T) {
+	// Regular files stand in for the pinned objects, they fail to load as
+	// links and are skipped after being examined.
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", filepath.Join("cilium", "c"), filepath.Join("cilium", "tc", "d")} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantExamined int
+		wantErr      error
+	}{
+		{
+			name:         "complete walk",
+			ctx:          context.Background(),
+			wantExamined: 4,
+		},
+		{
+			name:         "canceled",
+			ctx:          canceled,
+			wantExamined: 0,
+			wantErr:      context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			examined, err := unpinBPFProgramsFromPath(tt.ctx, root, 1, sets.New(apis.EBPFProgramTypeTCX, apis.EBPFProgramTypeXDP))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("unpinBPFProgramsFromPath() error = %v, want %v", err, tt.wantErr)
+			}
+			if examined != tt.wantExamined {
+				t.Errorf("unpinBPFProgramsFromPath() examined %d links, want %d", examined, tt.wantExamined)
+			}
+		})
+	}
+}
+
+// Test_detachEBPFProgramsSelective attaches a program of each type to an
+// interface and checks that only the requested types are detached.
+func Test_detachEBPFProgramsSelective(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	tests := []struct {
+		name         string
+		programTypes sets.Set[string]
+	}{
+		{name: "tc", programTypes: sets.New(apis.EBPFProgramTypeTC)},
+		{name: "tcx", programTypes: sets.New(apis.EBPFProgramTypeTCX)},
+		{name: "xdp", programTypes: sets.New(apis.EBPFProgramTypeXDP)},
+		{name: "tc and xdp", programTypes: sets.New(apis.EBPFProgramTypeTC, apis.EBPFProgramTypeXDP)},
+		{name: "all", programTypes: disabledEBPFProgramTypes(apis.InterfaceConfig{DisableEBPFPrograms: ptr.To(true)})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			origns, err := netns.Get()
+			if err != nil {
+				t.Fatalf("unexpected error trying to get namespace: %v", err)
+			}
+			defer origns.Close()
+
+			rndString := make([]byte, 4)
+			if _, err := rand.Read(rndString); err != nil {
+				t.Errorf("fail to generate random name: %v", err)
+			}
+			nsName := fmt.Sprintf("ns%x", rndString)
+			testNS, err := netns.NewNamed(nsName)
+			if err != nil {
+				t.Fatalf("Failed to create network namespace: %v", err)
+			}
+			defer netns.DeleteNamed(nsName) // nolint:errcheck
+			defer testNS.Close()
+			// NewNamed switches to the new namespace, the programs are attached from it.
+			defer netns.Set(origns) // nolint:errcheck
+
+			ifaceName := "veth0"
+			la := netlink.NewLinkAttrs()
+			la.Name = ifaceName
+			if err := netlink.LinkAdd(&netlink.Veth{LinkAttrs: la, PeerName: "veth1"}); err != nil {
+				t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+			}
+			link0, err := netlink.LinkByName(ifaceName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tcProg := newTestProgram(t, ebpf.SchedCLS)
+			qdisc := &netlink.GenericQdisc{
+				QdiscAttrs: netlink.QdiscAttrs{LinkIndex: link0.Attrs().Index, Handle: netlink.MakeHandle(0xffff, 0), Parent: netlink.HANDLE_CLSACT},
+				QdiscType:  "clsact",
+			}
+			if err := netlink.QdiscAdd(qdisc); err != nil {
+				t.Fatalf("failed to add clsact qdisc: %v", err)
+			}
+			filter := &netlink.BpfFilter{
+				FilterAttrs:  netlink.FilterAttrs{LinkIndex: link0.Attrs().Index, Parent: netlink.HANDLE_MIN_INGRESS, Handle: 1, Protocol: unix.ETH_P_ALL},
+				Fd:           tcProg.FD(),
+				Name:         "test",
+				DirectAction: true,
+			}
+			if err := netlink.FilterAdd(filter); err != nil {
+				t.Fatalf("failed to add TC filter: %v", err)
+			}
+			tcxProg := newTestProgram(t, ebpf.SchedCLS)
+			if err := link.RawAttachProgram(link.RawAttachProgramOptions{Target: link0.Attrs().Index, Program: tcxProg, Attach: ebpf.AttachTCXIngress}); err != nil {
+				t.Fatalf("failed to attach TCX program: %v", err)
+			}
+			xdpProg := newTestProgram(t, ebpf.XDP)
+			if err := netlink.LinkSetXdpFdWithFlags(link0, xdpProg.FD(), unix.XDP_FLAGS_SKB_MODE); err != nil {
+				t.Fatalf("failed to attach XDP program: %v", err)
+			}
+
+			if err := detachEBPFPrograms(context.Background(), path.Join("/run/netns", nsName), ifaceName, tt.programTypes); err != nil {
+				t.Fatalf("detachEBPFPrograms() error = %v", err)
+			}
+
+			filters, err := netlink.FilterList(link0, netlink.HANDLE_MIN_INGRESS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(filters) > 0, !tt.programTypes.Has(apis.EBPFProgramTypeTC); got != want {
+				t.Errorf("TC filter attached = %v, want %v", got, want)
+			}
+			result, err := link.QueryPrograms(link.QueryOptions{Target: link0.Attrs().Index, Attach: ebpf.AttachTCXIngress})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(result.Programs) > 0, !tt.programTypes.Has(apis.EBPFProgramTypeTCX); got != want {
+				t.Errorf("TCX program attached = %v, want %v", got, want)
+			}
+			link0, err = netlink.LinkByName(ifaceName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xdpAttached := link0.Attrs().Xdp != nil && link0.Attrs().Xdp.Attached
+			if want := !tt.programTypes.Has(apis.EBPFProgramTypeXDP); xdpAttached != want {
+				t.Errorf("XDP program attached = %v, want %v", xdpAttached, want)
+			}
+		})
+	}
+}
+
+// newTestProgram loads a program of the given type that accepts all the packets.
+func newTestProgram(t *testing.T, programType ebpf.ProgramType) *ebpf.Program {
+	t.Helper()
+	ret := int32(0) // TC_ACT_OK
+	if programType == ebpf.XDP {
+		ret = 2 // XDP_PASS
+	}
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         programType,
+		License:      "Apache-2.0",
+		Instructions: asm.Instructions{asm.Mov.Imm(asm.R0, ret), asm.Return()},
+	})
+	if err != nil {
+		t.Fatalf("failed to load eBPF program: %v", err)
+	}
+	t.Cleanup(func() { prog.Close() })
+	return prog
+}
+
+func Test_disabledEBPFProgramTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  apis.InterfaceConfig
+		want sets.Set[string]
+	}{
+		{
+			name: "none",
+			want: sets.New[string](),
+		},
+		{
+			name: "all",
+			cfg:  apis.InterfaceConfig{DisableEBPFPrograms: ptr.To(true)},
+			want: sets.New(apis.EBPFProgramTypeTC, apis.EBPFProgramTypeTCX, apis.EBPFProgramTypeXDP),
+		},
+		{
+			name: "all overrides the types",
+			cfg:  apis.InterfaceConfig{DisableEBPFPrograms: ptr.To(true), DisableEBPF: []string{apis.EBPFProgramTypeXDP}},
+			want: sets.New(apis.EBPFProgramTypeTC, apis.EBPFProgramTypeTCX, apis.EBPFProgramTypeXDP),
+		},
+		{
+			name: "selected types",
+			cfg:  apis.InterfaceConfig{DisableEBPFPrograms: ptr.To(false), DisableEBPF: []string{apis.EBPFProgramTypeTC, apis.EBPFProgramTypeTCX}},
+			want: sets.New(apis.EBPFProgramTypeTC, apis.EBPFProgramTypeTCX),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := disabledEBPFProgramTypes(tt.cfg); !got.Equal(tt.want) {
+				t.Errorf("disabledEBPFProgramTypes() = %v, want %v", sets.List(got), sets.List(tt.want))
+			}
+		})
+	}
+}
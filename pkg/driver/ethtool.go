@@ -31,48 +31,11 @@ import (
 
 	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 )
 
-// off_flag_def
-// https://git.kernel.org/pub/scm/network/ethtool/ethtool.git/tree/common.c#n51
-// OffloadFlagDefinition is the Go equivalent of the C struct off_flag_def.
-// We keep this struct as the source of truth for building the map.
-type OffloadFlagDefinition struct {
-	ShortName     string
-	LongName      string
-	KernelPattern string
-}
-
-// offloadFlagDefs is the translated slice of legacy feature definitions.
-var offloadFlagDefs = []OffloadFlagDefinition{
-	{"rx", "rx-checksumming", "rx-checksum"},
-	{"tx", "tx-checksumming", "tx-checksum-*"},
-	{"sg", "scatter-gather", "tx-scatter-gather*"},
-	{"tso", "tcp-segmentation-offload", "tx-tcp*-segmentation"},
-	{"ufo", "udp-fragmentation-offload", "tx-udp-fragmentation"},
-	{"gso", "generic-segmentation-offload", "tx-generic-segmentation"},
-	{"gro", "generic-receive-offload", "rx-gro"},
-	{"lro", "large-receive-offload", "rx-lro"},
-	{"rxvlan", "rx-vlan-offload", "rx-vlan-hw-parse"},
-	{"txvlan", "tx-vlan-offload", "tx-vlan-hw-insert"},
-	{"ntuple", "ntuple-filters", "rx-ntuple-filter"},
-	{"rxhash", "receive-hashing", "rx-hashing"},
-}
-
-// It maps both short and long aliases to their corresponding match pattern.
-var legacyFeaturePatterns map[string]string
-
-// build the map
-func init() {
-	legacyFeaturePatterns = make(map[string]string)
-	for _, def := range offloadFlagDefs {
-		// Note: The pattern is a shell-style "glob", not a true regex.
-		legacyFeaturePatterns[def.ShortName] = def.KernelPattern
-		legacyFeaturePatterns[def.LongName] = def.KernelPattern
-	}
-}
-
 // https://docs.kernel.org/networking/ethtool-netlink.html#features-get
 // ETHTOOL_A_FEATURES_HW
 // ETHTOOL_A_FEATURES_WANTED
@@ -92,7 +55,7 @@ func (e ethtoolFeatures) Get(name string) []string {
 	}
 	// it can be an alias or multiple features
 	matchedFeatures := []string{}
-	pattern, ok := legacyFeaturePatterns[name]
+	pattern, ok := apis.EthtoolFeaturePattern(name)
 	if !ok {
 		return matchedFeatures
 	}
@@ -105,6 +68,129 @@ func (e ethtoolFeatures) Get(name string) []string {
 	return matchedFeatures
 }
 
+// deniedEthtoolFeatures returns the sorted names of the features in config
+// that resolve to the same kernel features as any of the denied features.
+// Both sides are resolved through the legacy aliases, so denying "rx" also
+// denies "rx-checksum" and the other way around.
+func deniedEthtoolFeatures(config *apis.EthtoolConfig, denied sets.Set[string], ifFeatures *ethtoolFeatures) []string {
+	if config == nil || denied.Len() == 0 {
+		return nil
+	}
+	deniedKernel := sets.New[string]()
+	for name := range denied {
+		deniedKernel.Insert(ifFeatures.Get(name)...)
+	}
+	requested := sets.New[string]()
+	for name := range config.Features {
+		requested.Insert(name)
+	}
+	for _, feature := range config.OrderedFeatures {
+		requested.Insert(feature.Name)
+	}
+	result := sets.New[string]()
+	for name := range requested {
+		if denied.Has(name) || deniedKernel.HasAny(ifFeatures.Get(name)...) {
+			result.Insert(name)
+		}
+	}
+	return sets.List(result)
+}
+
+// EthtoolFixedFeaturePolicy defines what happens to a claim requesting a value
+// of an ethtool feature that the device does not allow to change, shown as
+// [fixed] by `ethtool -k`.
+type EthtoolFixedFeaturePolicy string
+
+const (
+	// EthtoolFixedFeaturePolicyError fails the claim when the kernel refuses
+	// the feature. This is the default.
+	EthtoolFixedFeaturePolicyError EthtoolFixedFeaturePolicy = "error"
+	// EthtoolFixedFeaturePolicySkip does not apply the feature, a Warning
+	// event is recorded on the claim.
+	EthtoolFixedFeaturePolicySkip EthtoolFixedFeaturePolicy = "skip"
+)
+
+// ParseEthtoolFixedFeaturePolicy converts a string into an
+// EthtoolFixedFeaturePolicy.
+func ParseEthtoolFixedFeaturePolicy(s string) (EthtoolFixedFeaturePolicy, error) {
+	switch policy := EthtoolFixedFeaturePolicy(s); policy {
+	case EthtoolFixedFeaturePolicyError, EthtoolFixedFeaturePolicySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported ethtool fixed feature policy %q, must be one of %q or %q", s, EthtoolFixedFeaturePolicyError, EthtoolFixedFeaturePolicySkip)
+	}
+}
+
+// skipFixedEthtoolFeatures returns a copy of the configuration, with the
+// kernel names of the features, without the features the device does not allow
+// to change and whose requested value differs from the active one, and the
+// sorted names of the features removed. The fixed features already at the
+// requested value are kept, the kernel accepts them.
+func skipFixedEthtoolFeatures(config *apis.EthtoolConfig, ifFeatures *ethtoolFeatures) (*apis.EthtoolConfig, []string) {
+	if config == nil {
+		return nil, nil
+	}
+	skipped := sets.New[string]()
+	isSkipped := func(name string, value bool) bool {
+		fixed, _ := splitChangeableFeatures(map[string]bool{name: value}, ifFeatures)
+		if len(fixed) > 0 && ifFeatures.active[name] != value {
+			skipped.Insert(name)
+			return true
+		}
+		return false
+	}
+	result := *config
+	result.Features = nil
+	for name, value := range config.Features {
+		if isSkipped(name, value) {
+			continue
+		}
+		if result.Features == nil {
+			result.Features = map[string]bool{}
+		}
+		result.Features[name] = value
+	}
+	result.OrderedFeatures = nil
+	for _, feature := range config.OrderedFeatures {
+		if !isSkipped(feature.Name, feature.Enabled) {
+			result.OrderedFeatures = append(result.OrderedFeatures, feature)
+		}
+	}
+	return &result, sets.List(skipped)
+}
+
+// resolveEthtoolFeatures returns a copy of the configuration with its features
+// translated to the kernel names of the features of the interface, and an
+// error for each of the features the interface does not support.
+func resolveEthtoolFeatures(config *apis.EthtoolConfig, ifFeatures *ethtoolFeatures) (*apis.EthtoolConfig, []error) {
+	var errorList []error
+	resolved := *config
+	resolved.Features = map[string]bool{}
+	for feature, value := range config.Features {
+		aliases := ifFeatures.Get(feature)
+		if len(aliases) == 0 {
+			errorList = append(errorList, fmt.Errorf("feature %s not supported by interface", feature))
+			continue
+		}
+		for _, alias := range aliases {
+			resolved.Features[alias] = value
+		}
+	}
+
+	resolved.OrderedFeatures = nil
+	for _, feature := range config.OrderedFeatures {
+		aliases := ifFeatures.Get(feature.Name)
+		if len(aliases) == 0 {
+			errorList = append(errorList, fmt.Errorf("feature %s not supported by interface", feature.Name))
+			continue
+		}
+		for _, alias := range aliases {
+			resolved.OrderedFeatures = append(resolved.OrderedFeatures, apis.EthtoolFeature{Name: alias, Enabled: feature.Enabled})
+		}
+	}
+	return &resolved, errorList
+}
+
 // String provides a pretty-printed, sorted list of all feature maps.
 func (e ethtoolFeatures) String() string {
 	var output strings.Builder
@@ -148,6 +234,9 @@ func (e ethtoolFeatures) String() string {
 type ethtoolClient struct {
 	conn     *genetlink.Conn
 	familyID uint16
+	// netNS is the network namespace of the client, zero for the current
+	// one, the ioctls are sent from a socket in it.
+	netNS int
 }
 
 // newEthtoolClient handles the initial setup and validation.
@@ -173,6 +262,7 @@ func newEthtoolClient(netNS int) (*ethtoolClient, error) {
 	return &ethtoolClient{
 		conn:     c,
 		familyID: family.ID,
+		netNS:    netNS,
 	}, nil
 }
 
@@ -279,6 +369,16 @@ func (c *ethtoolClient) GetPrivateFlags(ifaceName string) (map[string]bool, erro
 	return allFlags, nil
 }
 
+// refusedFeaturesError is returned by SetFeatures when the kernel accepted the
+// request but left some of the features unchanged, with their requested value.
+type refusedFeaturesError struct {
+	features map[string]bool
+}
+
+func (e *refusedFeaturesError) Error() string {
+	return fmt.Sprintf("kernel refused the following features: %s", formatFeatures(e.features))
+}
+
 // SetFeatures sets the device features for a given interface.
 func (c *ethtoolClient) SetFeatures(ifaceName string, featuresToSet map[string]bool) error {
 	features, err := c.executeSet(
@@ -296,7 +396,7 @@ func (c *ethtoolClient) SetFeatures(ifaceName string, featuresToSet map[string]b
 	// ETHTOOL_A_FEATURES_WANTED reports the difference between client request and actual result: mask consists of bits which differ between requested features and result (dev->features after the operation)
 	// value consists of values of these bits in the request (i.e. negated values from resulting features)
 	if len(features.wanted) > 0 {
-		return fmt.Errorf("could not set the following features: %#v", features.wanted)
+		return &refusedFeaturesError{features: features.wanted}
 	}
 	// ETHTOOL_A_FEATURES_ACTIVE reports the difference between old and new dev->features: mask
 	// consists of bits which have changed, values are their values in new dev->features (after the operation).
@@ -404,6 +504,268 @@ func (c *ethtoolClient) executeSet(cmd uint8, headerAttributeType uint16, ifaceN
 	return ethFeatures, nil
 }
 
+// GetPauseParams retrieves the flow control parameters of the interface.
+func (c *ethtoolClient) GetPauseParams(ifaceName string) (*apis.PauseConfig, error) {
+	msgs, err := c.execute(
+		unix.ETHTOOL_MSG_PAUSE_GET,
+		unix.ETHTOOL_A_PAUSE_HEADER,
+		ifaceName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute PAUSE_GET command: %w", err)
+	}
+
+	pause := &apis.PauseConfig{}
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attribute decoder: %w", err)
+		}
+		for ad.Next() {
+			switch ad.Type() {
+			case unix.ETHTOOL_A_PAUSE_AUTONEG:
+				pause.Autoneg = ptr.To(ad.Uint8() != 0)
+			case unix.ETHTOOL_A_PAUSE_RX:
+				pause.RxPause = ptr.To(ad.Uint8() != 0)
+			case unix.ETHTOOL_A_PAUSE_TX:
+				pause.TxPause = ptr.To(ad.Uint8() != 0)
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, fmt.Errorf("pause attribute decoder error: %w", err)
+		}
+	}
+	return pause, nil
+}
+
+// SetPauseParams sets the flow control parameters of the interface, the
+// parameters not set keep their current value.
+func (c *ethtoolClient) SetPauseParams(ifaceName string, pause *apis.PauseConfig) error {
+	ae := netlink.NewAttributeEncoder()
+	ae.Nested(unix.ETHTOOL_A_PAUSE_HEADER, func(nae *netlink.AttributeEncoder) error {
+		nae.String(unix.ETHTOOL_A_HEADER_DEV_NAME, ifaceName)
+		return nil
+	})
+	for _, p := range []struct {
+		attr  uint16
+		value *bool
+	}{
+		{unix.ETHTOOL_A_PAUSE_AUTONEG, pause.Autoneg},
+		{unix.ETHTOOL_A_PAUSE_RX, pause.RxPause},
+		{unix.ETHTOOL_A_PAUSE_TX, pause.TxPause},
+	} {
+		if p.value == nil {
+			continue
+		}
+		var v uint8
+		if *p.value {
+			v = 1
+		}
+		ae.Uint8(p.attr, v)
+	}
+
+	reqData, err := ae.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes: %w", err)
+	}
+
+	req := genetlink.Message{
+		Header: genetlink.Header{Command: unix.ETHTOOL_MSG_PAUSE_SET, Version: unix.ETHTOOL_GENL_VERSION},
+		Data:   reqData,
+	}
+	if _, err := c.conn.Execute(req, c.familyID, netlink.Request|netlink.Acknowledge); err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			return fmt.Errorf("ethtool.pause %s is not supported by the driver of %s: %w", formatPause(pause), ifaceName, err)
+		}
+		return fmt.Errorf("failed to set ethtool.pause %s: %w", formatPause(pause), err)
+	}
+	return nil
+}
+
+// formatPause returns the pause parameters set, e.g. "[autoneg:off rx:on tx:on]".
+func formatPause(pause *apis.PauseConfig) string {
+	var params []string
+	for _, p := range []struct {
+		name  string
+		value *bool
+	}{{"autoneg", pause.Autoneg}, {"rx", pause.RxPause}, {"tx", pause.TxPause}} {
+		if p.value == nil {
+			continue
+		}
+		state := "off"
+		if *p.value {
+			state = "on"
+		}
+		params = append(params, p.name+":"+state)
+	}
+	return "[" + strings.Join(params, " ") + "]"
+}
+
+// Attributes of the ETHTOOL_MSG_FEC_GET and ETHTOOL_MSG_FEC_SET messages, not
+// defined in golang.org/x/sys/unix.
+// https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/tree/include/uapi/linux/ethtool_netlink.h
+const (
+	ethtoolAFECHeader = 1
+	ethtoolAFECModes  = 2
+	ethtoolAFECAuto   = 3
+	ethtoolAFECActive = 4
+)
+
+// fecLinkModes are the FEC modes of the configuration and the names and bits
+// of their ethtool link modes. LLRS can not be configured, it is only known to
+// report it.
+var fecLinkModes = []struct {
+	mode string
+	name string
+	bit  uint32
+}{
+	{apis.EthtoolFECNone, "None", unix.ETHTOOL_LINK_MODE_FEC_NONE_BIT},
+	{apis.EthtoolFECRS, "RS", unix.ETHTOOL_LINK_MODE_FEC_RS_BIT},
+	{apis.EthtoolFECBaseR, "BASER", unix.ETHTOOL_LINK_MODE_FEC_BASER_BIT},
+	{"llrs", "LLRS", unix.ETHTOOL_LINK_MODE_FEC_LLRS_BIT},
+}
+
+// fecParams are the FEC parameters of an interface, with the modes named as in
+// the configuration.
+type fecParams struct {
+	// auto is true if the driver picks the mode.
+	auto bool
+	// modes are the FEC modes the link may use.
+	modes []string
+	// active is the FEC mode in use, empty if there is none, e.g. the link is
+	// down.
+	active string
+}
+
+// GetFEC retrieves the forward error correction parameters of the interface.
+func (c *ethtoolClient) GetFEC(ifaceName string) (*fecParams, error) {
+	msgs, err := c.execute(
+		unix.ETHTOOL_MSG_FEC_GET,
+		ethtoolAFECHeader,
+		ifaceName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute FEC_GET command: %w", err)
+	}
+
+	fec := &fecParams{}
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attribute decoder: %w", err)
+		}
+		for ad.Next() {
+			switch ad.Type() {
+			case ethtoolAFECModes:
+				ad.Nested(func(nad *netlink.AttributeDecoder) error {
+					// The bitset has no mask, the listed link modes are the set ones.
+					linkModes, err := parseBitset(nad)
+					for name := range linkModes {
+						fec.modes = append(fec.modes, fecModeByName(name))
+					}
+					sort.Strings(fec.modes)
+					return err
+				})
+			case ethtoolAFECAuto:
+				fec.auto = ad.Uint8() != 0
+			case ethtoolAFECActive:
+				fec.active = fecModeByBit(ad.Uint32())
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, fmt.Errorf("fec attribute decoder error: %w", err)
+		}
+	}
+	return fec, nil
+}
+
+// SetFEC sets the forward error correction mode of the interface, one of the
+// modes of the configuration.
+func (c *ethtoolClient) SetFEC(ifaceName string, mode string) error {
+	var auto uint8
+	var linkModes []string
+	if mode == apis.EthtoolFECAuto {
+		auto = 1
+	} else {
+		name := fecLinkModeName(mode)
+		if name == "" {
+			return fmt.Errorf("unsupported ethtool.fec mode %q", mode)
+		}
+		linkModes = append(linkModes, name)
+	}
+
+	ae := netlink.NewAttributeEncoder()
+	ae.Nested(ethtoolAFECHeader, func(nae *netlink.AttributeEncoder) error {
+		nae.String(unix.ETHTOOL_A_HEADER_DEV_NAME, ifaceName)
+		return nil
+	})
+	// Without a mask the link modes replace the current ones.
+	ae.Nested(ethtoolAFECModes, func(nae *netlink.AttributeEncoder) error {
+		nae.Flag(unix.ETHTOOL_A_BITSET_NOMASK, true)
+		nae.Nested(unix.ETHTOOL_A_BITSET_BITS, func(nnae *netlink.AttributeEncoder) error {
+			for _, name := range linkModes {
+				nnae.Nested(unix.ETHTOOL_A_BITSET_BITS_BIT, func(bitEncoder *netlink.AttributeEncoder) error {
+					bitEncoder.String(unix.ETHTOOL_A_BITSET_BIT_NAME, name)
+					return nil
+				})
+			}
+			return nil
+		})
+		return nil
+	})
+	ae.Uint8(ethtoolAFECAuto, auto)
+
+	reqData, err := ae.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes: %w", err)
+	}
+
+	req := genetlink.Message{
+		Header: genetlink.Header{Command: unix.ETHTOOL_MSG_FEC_SET, Version: unix.ETHTOOL_GENL_VERSION},
+		Data:   reqData,
+	}
+	if _, err := c.conn.Execute(req, c.familyID, netlink.Request|netlink.Acknowledge); err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			return fmt.Errorf("ethtool.fec %s is not supported by the driver of %s: %w", mode, ifaceName, err)
+		}
+		return fmt.Errorf("failed to set ethtool.fec %s: %w", mode, err)
+	}
+	return nil
+}
+
+// fecLinkModeName returns the name of the ethtool link mode of a FEC mode of
+// the configuration, or an empty string if it is unknown.
+func fecLinkModeName(mode string) string {
+	for _, m := range fecLinkModes {
+		if m.mode == mode {
+			return m.name
+		}
+	}
+	return ""
+}
+
+// fecModeByName returns the FEC mode of the configuration of an ethtool link
+// mode name, the lowercase name if it is unknown.
+func fecModeByName(name string) string {
+	for _, m := range fecLinkModes {
+		if m.name == name {
+			return m.mode
+		}
+	}
+	return strings.ToLower(name)
+}
+
+// fecModeByBit returns the FEC mode of the configuration of an ethtool link
+// mode bit, or an empty string if it is unknown.
+func fecModeByBit(bit uint32) string {
+	for _, m := range fecLinkModes {
+		if m.bit == bit {
+			return m.mode
+		}
+	}
+	return ""
+}
+
 // 4. A single, generic execute method to avoid code duplication.
 // It builds and sends the request, returning the kernel's response.
 func (c *ethtoolClient) execute(cmd uint8, headerType uint16, ifaceName string) ([]genetlink.Message, error) {
@@ -476,15 +838,8 @@ func parseBit(ad *netlink.AttributeDecoder) (name string, active bool, err error
 // applyEthtoolConfig applies ethtool configurations (features, private flags) to an interface
 // within a specified network namespace.
 func applyEthtoolConfig(containerNsPath string, ifName string, config *apis.EthtoolConfig) error {
-	if config == nil {
-		klog.V(2).Infof("No ethtool configuration to apply for %s in ns %s", ifName, containerNsPath)
-		return nil
-	}
-
-	hasFeatures := len(config.Features) > 0
-	hasPrivateFlags := len(config.PrivateFlags) > 0
-	if !hasFeatures && !hasPrivateFlags {
-		klog.V(2).Infof("Ethtool configuration for %s in ns %s is empty (no features or private flags).", ifName, containerNsPath)
+	if isEmptyEthtoolConfig(config) {
+		klog.V(2).Infof("Ethtool configuration for %s in ns %s is empty (no features, private flags, pause parameters, FEC mode or coalescing).", ifName, containerNsPath)
 		return nil
 	}
 
@@ -500,21 +855,229 @@ func applyEthtoolConfig(containerNsPath string, ifName string, config *apis.Etht
 	}
 	defer client.Close()
 
+	return applyEthtoolSettings(client, containerNsPath, ifName, config, withLinkDownAt(targetNs, ifName))
+}
+
+// isEmptyEthtoolConfig returns true if the configuration has nothing to apply.
+func isEmptyEthtoolConfig(config *apis.EthtoolConfig) bool {
+	return config == nil ||
+		len(config.Features) == 0 && len(config.OrderedFeatures) == 0 && len(config.PrivateFlags) == 0 && config.Pause == nil && config.FEC == nil && config.Coalesce == nil
+}
+
+// applyEthtoolSettings applies the ethtool configuration to an interface in
+// the namespace of the client, ns only identifies the namespace in the logs.
+// withLinkDown runs a function with the interface down, it is only used for
+// the features and can be nil if the configuration has none.
+func applyEthtoolSettings(client *ethtoolClient, ns string, ifName string, config *apis.EthtoolConfig, withLinkDown func(apply func() error) error) error {
+	hasFeatures := len(config.Features) > 0 || len(config.OrderedFeatures) > 0
+	hasPrivateFlags := len(config.PrivateFlags) > 0
+	hasPause := config.Pause != nil
+	hasFEC := config.FEC != nil
+	hasCoalesce := config.Coalesce != nil
+
 	var errorList []error
 
 	if hasFeatures {
-		klog.V(2).Infof("Applying ethtool features for %s in ns %s: %v", ifName, containerNsPath, config.Features)
-		if err := client.SetFeatures(ifName, config.Features); err != nil {
-			errorList = append(errorList, fmt.Errorf("failed to set ethtool features for %s: %w", ifName, err))
+		if err := applyEthtoolFeatures(client, ns, ifName, config, withLinkDown); err != nil {
+			errorList = append(errorList, err)
 		}
 	}
 
 	if hasPrivateFlags {
-		klog.V(2).Infof("Applying ethtool private flags for %s in ns %s: %v", ifName, containerNsPath, config.PrivateFlags)
+		klog.V(2).Infof("Applying ethtool private flags for %s in ns %s: %v", ifName, ns, config.PrivateFlags)
 		if err := client.SetPrivateFlags(ifName, config.PrivateFlags); err != nil {
 			errorList = append(errorList, fmt.Errorf("failed to set ethtool private flags for %s: %w", ifName, err))
 		}
 	}
 
+	if hasPause {
+		klog.V(2).Infof("Applying ethtool pause parameters for %s in ns %s: %s", ifName, ns, formatPause(config.Pause))
+		if err := client.SetPauseParams(ifName, config.Pause); err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool pause parameters for %s: %w", ifName, err))
+		}
+	}
+
+	if hasFEC {
+		klog.V(2).Infof("Applying ethtool FEC mode for %s in ns %s: %s", ifName, ns, *config.FEC)
+		if err := client.SetFEC(ifName, *config.FEC); err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool FEC mode for %s: %w", ifName, err))
+		}
+	}
+
+	if hasCoalesce {
+		if err := applyCoalesceConfig(client, ns, ifName, config.Coalesce); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+
 	return errors.Join(errorList...)
 }
+
+// ethtoolFeaturesClient is the part of the ethtool client used to apply the
+// features.
+type ethtoolFeaturesClient interface {
+	GetFeatures(ifaceName string) (*ethtoolFeatures, error)
+	SetFeatures(ifaceName string, featuresToSet map[string]bool) error
+}
+
+// applyEthtoolFeatures applies the feature steps in order, and keeps going
+// after a failed step so all the refused features are reported. Some drivers
+// can only change a feature while the link is down and the kernel silently
+// keeps its value otherwise. The refused features that the device allows to
+// change are applied again with the link down when the configuration accepts
+// the link flap, or reported as such.
+func applyEthtoolFeatures(client ethtoolFeaturesClient, ns string, ifName string, config *apis.EthtoolConfig, withLinkDown func(apply func() error) error) error {
+	var errorList []error
+	var refusedSteps []map[string]bool
+	for i, step := range ethtoolFeatureSteps(config) {
+		klog.V(2).Infof("Applying ethtool features step %d for %s in ns %s: %v", i, ifName, ns, step)
+		err := client.SetFeatures(ifName, step)
+		var refused *refusedFeaturesError
+		if errors.As(err, &refused) {
+			refusedSteps = append(refusedSteps, refused.features)
+		} else if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool features %s for %s: %w", formatFeatures(step), ifName, err))
+		}
+	}
+	if len(refusedSteps) == 0 {
+		return errors.Join(errorList...)
+	}
+
+	ifFeatures, err := client.GetFeatures(ifName)
+	if err != nil {
+		for _, step := range refusedSteps {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool features %s for %s: %w", formatFeatures(step), ifName, &refusedFeaturesError{features: step}))
+		}
+		return errors.Join(append(errorList, err)...)
+	}
+	var linkDownSteps []map[string]bool
+	for _, step := range refusedSteps {
+		fixed, changeable := splitChangeableFeatures(step, ifFeatures)
+		if len(fixed) > 0 {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool features %s for %s: %w", formatFeatures(fixed), ifName, &refusedFeaturesError{features: fixed}))
+		}
+		if len(changeable) > 0 {
+			linkDownSteps = append(linkDownSteps, changeable)
+		}
+	}
+	if len(linkDownSteps) == 0 {
+		return errors.Join(errorList...)
+	}
+
+	if config.AllowLinkDown == nil || !*config.AllowLinkDown || withLinkDown == nil {
+		for _, step := range linkDownSteps {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool features %s for %s while the link is up, the device may only change them with the link down, set allowLinkDown to apply them with a link flap", formatFeatures(step), ifName))
+		}
+		return errors.Join(errorList...)
+	}
+	klog.Infof("Applying the refused ethtool features for %s in ns %s with the link down: %v", ifName, ns, linkDownSteps)
+	err = withLinkDown(func() error {
+		var stepErrors []error
+		for _, step := range linkDownSteps {
+			if err := client.SetFeatures(ifName, step); err != nil {
+				stepErrors = append(stepErrors, fmt.Errorf("failed to set ethtool features %s for %s with the link down: %w", formatFeatures(step), ifName, err))
+			}
+		}
+		return errors.Join(stepErrors...)
+	})
+	if err != nil {
+		errorList = append(errorList, err)
+	}
+	return errors.Join(errorList...)
+}
+
+// splitChangeableFeatures splits the features in the ones the device does not
+// allow to change and the ones it does, which may depend on the link state.
+func splitChangeableFeatures(features map[string]bool, ifFeatures *ethtoolFeatures) (fixed, changeable map[string]bool) {
+	fixed = map[string]bool{}
+	changeable = map[string]bool{}
+	for name, value := range features {
+		if ifFeatures.hardware[name] && !ifFeatures.nochange[name] {
+			changeable[name] = value
+		} else {
+			fixed[name] = value
+		}
+	}
+	return fixed, changeable
+}
+
+// ethtoolConfigPhases splits the ethtool configuration in the settings applied
+// in the host namespace, before the interface is moved, and the ones applied
+// once it is in the Pod namespace. Either of them is nil if it has nothing to
+// apply.
+func ethtoolConfigPhases(config *apis.EthtoolConfig) (beforeMove, inPod *apis.EthtoolConfig) {
+	if config == nil {
+		return nil, nil
+	}
+	beforeMove = &apis.EthtoolConfig{}
+	inPod = &apis.EthtoolConfig{
+		Features:        config.Features,
+		OrderedFeatures: config.OrderedFeatures,
+		PrivateFlags:    config.PrivateFlags,
+		Pause:           config.Pause,
+		FEC:             config.FEC,
+		Coalesce:        config.Coalesce,
+		AllowLinkDown:   config.AllowLinkDown,
+	}
+	for _, setting := range config.ApplyBeforeMove {
+		switch setting {
+		case apis.EthtoolSettingPrivateFlags:
+			beforeMove.PrivateFlags, inPod.PrivateFlags = config.PrivateFlags, nil
+		case apis.EthtoolSettingPause:
+			beforeMove.Pause, inPod.Pause = config.Pause, nil
+		}
+	}
+	if isEmptyEthtoolConfig(beforeMove) {
+		beforeMove = nil
+	}
+	if isEmptyEthtoolConfig(inPod) {
+		inPod = nil
+	}
+	return beforeMove, inPod
+}
+
+// ethtoolFeatureSteps splits the ethtool features into the batches sent to the
+// kernel, in order. The features of the map are applied disabling first and
+// enabling later, since a feature may only be enabled once a conflicting one
+// is off (e.g. rx-gro-hw with rx-lro). Each of the ordered features is applied
+// on its own afterwards, so the user can express any other dependency.
+func ethtoolFeatureSteps(config *apis.EthtoolConfig) []map[string]bool {
+	var steps []map[string]bool
+	disable := map[string]bool{}
+	enable := map[string]bool{}
+	for name, value := range config.Features {
+		if value {
+			enable[name] = true
+		} else {
+			disable[name] = false
+		}
+	}
+	if len(disable) > 0 {
+		steps = append(steps, disable)
+	}
+	if len(enable) > 0 {
+		steps = append(steps, enable)
+	}
+	for _, feature := range config.OrderedFeatures {
+		steps = append(steps, map[string]bool{feature.Name: feature.Enabled})
+	}
+	return steps
+}
+
+// formatFeatures returns the features in a stable, human readable form,
+// e.g. "[rx-gro:on rx-lro:off]".
+func formatFeatures(features map[string]bool) string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		state := "off"
+		if features[name] {
+			state = "on"
+		}
+		names[i] = name + ":" + state
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
@@ -0,0 +1,440 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// The coalescing of the queues is only available with the ETHTOOL_PERQUEUE
+// ioctl, the ethtool netlink messages configure the interface as a whole.
+// https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/tree/include/uapi/linux/ethtool.h
+const (
+	// ethtoolQueueMaskWords is the number of 32 bits words of the queue mask
+	// of struct ethtool_per_queue_op.
+	ethtoolQueueMaskWords = apis.MaxCoalesceQueues / 32
+	// ethtoolPerQueueHeaderLen is the length of struct ethtool_per_queue_op
+	// before the data of the queues: cmd, sub_command and queue_mask.
+	ethtoolPerQueueHeaderLen = 4 + 4 + 4*ethtoolQueueMaskWords
+)
+
+// ethtoolCoalesce is the Go equivalent of the C struct ethtool_coalesce.
+type ethtoolCoalesce struct {
+	Cmd                      uint32
+	RxCoalesceUsecs          uint32
+	RxMaxCoalescedFrames     uint32
+	RxCoalesceUsecsIRQ       uint32
+	RxMaxCoalescedFramesIRQ  uint32
+	TxCoalesceUsecs          uint32
+	TxMaxCoalescedFrames     uint32
+	TxCoalesceUsecsIRQ       uint32
+	TxMaxCoalescedFramesIRQ  uint32
+	StatsBlockCoalesceUsecs  uint32
+	UseAdaptiveRxCoalesce    uint32
+	UseAdaptiveTxCoalesce    uint32
+	PktRateLow               uint32
+	RxCoalesceUsecsLow       uint32
+	RxMaxCoalescedFramesLow  uint32
+	TxCoalesceUsecsLow       uint32
+	TxMaxCoalescedFramesLow  uint32
+	PktRateHigh              uint32
+	RxCoalesceUsecsHigh      uint32
+	RxMaxCoalescedFramesHigh uint32
+	TxCoalesceUsecsHigh      uint32
+	TxMaxCoalescedFramesHigh uint32
+	RateSampleInterval       uint32
+}
+
+// ethtoolCoalesceLen is the length of struct ethtool_coalesce.
+var ethtoolCoalesceLen = binary.Size(ethtoolCoalesce{})
+
+// ethtoolIfreq is the struct ifreq of the SIOCETHTOOL ioctl, with the pointer
+// to the ethtool command in the union.
+type ethtoolIfreq struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [24 - unsafe.Sizeof(uintptr(0))]byte
+}
+
+// SetCoalesce sets the interrupt coalescing parameters of the interface, the
+// parameters not set keep their current value.
+func (c *ethtoolClient) SetCoalesce(ifaceName string, params apis.CoalesceParams) error {
+	ae := netlink.NewAttributeEncoder()
+	ae.Nested(unix.ETHTOOL_A_COALESCE_HEADER, func(nae *netlink.AttributeEncoder) error {
+		nae.String(unix.ETHTOOL_A_HEADER_DEV_NAME, ifaceName)
+		return nil
+	})
+	for _, p := range []struct {
+		attr  uint16
+		value *uint32
+	}{
+		{unix.ETHTOOL_A_COALESCE_RX_USECS, params.RxUsecs},
+		{unix.ETHTOOL_A_COALESCE_RX_MAX_FRAMES, params.RxMaxFrames},
+		{unix.ETHTOOL_A_COALESCE_TX_USECS, params.TxUsecs},
+		{unix.ETHTOOL_A_COALESCE_TX_MAX_FRAMES, params.TxMaxFrames},
+	} {
+		if p.value != nil {
+			ae.Uint32(p.attr, *p.value)
+		}
+	}
+	for _, p := range []struct {
+		attr  uint16
+		value *bool
+	}{
+		{unix.ETHTOOL_A_COALESCE_USE_ADAPTIVE_RX, params.AdaptiveRx},
+		{unix.ETHTOOL_A_COALESCE_USE_ADAPTIVE_TX, params.AdaptiveTx},
+	} {
+		if p.value == nil {
+			continue
+		}
+		var v uint8
+		if *p.value {
+			v = 1
+		}
+		ae.Uint8(p.attr, v)
+	}
+
+	reqData, err := ae.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes: %w", err)
+	}
+
+	req := genetlink.Message{
+		Header: genetlink.Header{Command: unix.ETHTOOL_MSG_COALESCE_SET, Version: unix.ETHTOOL_GENL_VERSION},
+		Data:   reqData,
+	}
+	if _, err := c.conn.Execute(req, c.familyID, netlink.Request|netlink.Acknowledge); err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			return fmt.Errorf("ethtool.coalesce %s is not supported by the driver of %s: %w", formatCoalesce(params), ifaceName, err)
+		}
+		return fmt.Errorf("failed to set ethtool.coalesce %s: %w", formatCoalesce(params), err)
+	}
+	return nil
+}
+
+// GetQueueCount returns the number of queues of the interface, the combined
+// channels and the larger of the receive and transmit only channels.
+func (c *ethtoolClient) GetQueueCount(ifaceName string) (int, error) {
+	msgs, err := c.execute(
+		unix.ETHTOOL_MSG_CHANNELS_GET,
+		unix.ETHTOOL_A_CHANNELS_HEADER,
+		ifaceName,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute CHANNELS_GET command: %w", err)
+	}
+
+	var rx, tx, combined uint32
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create attribute decoder: %w", err)
+		}
+		for ad.Next() {
+			switch ad.Type() {
+			case unix.ETHTOOL_A_CHANNELS_RX_COUNT:
+				rx = ad.Uint32()
+			case unix.ETHTOOL_A_CHANNELS_TX_COUNT:
+				tx = ad.Uint32()
+			case unix.ETHTOOL_A_CHANNELS_COMBINED_COUNT:
+				combined = ad.Uint32()
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return 0, fmt.Errorf("channels attribute decoder error: %w", err)
+		}
+	}
+	return int(combined + max(rx, tx)), nil
+}
+
+// SetQueueCoalesce sets the interrupt coalescing parameters of the queues of
+// the interface. The current parameters of the queues are read first, so the
+// parameters not set keep their value.
+func (c *ethtoolClient) SetQueueCoalesce(ifaceName string, perQueue []apis.QueueCoalesce) error {
+	// The kernel reads and writes the data of the queues in the order of the
+	// bits of the mask.
+	perQueue = slices.SortedFunc(slices.Values(perQueue), func(a, b apis.QueueCoalesce) int {
+		return cmp.Compare(a.Queue, b.Queue)
+	})
+	queues := make([]uint32, 0, len(perQueue))
+	for _, q := range perQueue {
+		queues = append(queues, q.Queue)
+	}
+
+	current, err := c.perQueueCoalesce(ifaceName, unix.ETHTOOL_GCOALESCE, queues, nil)
+	if err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			return fmt.Errorf("ethtool.coalesce.perQueue is not supported by the driver of %s: %w", ifaceName, err)
+		}
+		return fmt.Errorf("failed to get the coalescing of the queues %v: %w", queues, err)
+	}
+	for i, q := range perQueue {
+		mergeCoalesceParams(&current[i], q.CoalesceParams)
+	}
+	if _, err := c.perQueueCoalesce(ifaceName, unix.ETHTOOL_SCOALESCE, queues, current); err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			return fmt.Errorf("ethtool.coalesce.perQueue is not supported by the driver of %s: %w", ifaceName, err)
+		}
+		return fmt.Errorf("failed to set the coalescing of the queues %v: %w", queues, err)
+	}
+	return nil
+}
+
+// perQueueCoalesce sends an ETHTOOL_PERQUEUE ioctl with the coalescing sub
+// command for the queues, in ascending order, from a socket in the namespace
+// of the client. It returns the data of the queues written by the kernel.
+func (c *ethtoolClient) perQueueCoalesce(ifaceName string, subCommand uint32, queues []uint32, coalesce []ethtoolCoalesce) ([]ethtoolCoalesce, error) {
+	buf, err := encodePerQueueCoalesce(subCommand, queues, coalesce)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := ioctlSocketAt(c.netNS)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd) // nolint:errcheck
+
+	ifr := ethtoolIfreq{data: unsafe.Pointer(&buf[0])}
+	copy(ifr.name[:unix.IFNAMSIZ-1], ifaceName)
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return nil, errno
+	}
+	runtime.KeepAlive(buf)
+	return decodePerQueueCoalesce(buf, len(queues))
+}
+
+// ioctlSocketAt returns a socket created in the network namespace netNS, or
+// in the current one if it is zero, for the ioctls on its interfaces. The
+// socket stays in the namespace after the thread switches back.
+func ioctlSocketAt(netNS int) (int, error) {
+	if netNS == 0 {
+		return unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		return -1, fmt.Errorf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close() // nolint:errcheck
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := netns.Set(netns.NsHandle(netNS)); err != nil {
+		return -1, fmt.Errorf("failed to join network namespace: %w", err)
+	}
+	defer netns.Set(origns) // nolint:errcheck
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create socket: %w", err)
+	}
+	return fd, nil
+}
+
+// encodePerQueueCoalesce returns the struct ethtool_per_queue_op of the
+// coalescing sub command for the queues, followed by the struct
+// ethtool_coalesce of each queue. The queues must be sorted and unique, the
+// data of the queues is zeroed if coalesce is nil, e.g. to read them.
+func encodePerQueueCoalesce(subCommand uint32, queues []uint32, coalesce []ethtoolCoalesce) ([]byte, error) {
+	if len(queues) == 0 {
+		return nil, fmt.Errorf("no queues")
+	}
+	if coalesce != nil && len(coalesce) != len(queues) {
+		return nil, fmt.Errorf("got the coalescing of %d queues, want %d", len(coalesce), len(queues))
+	}
+	buf := make([]byte, ethtoolPerQueueHeaderLen+len(queues)*ethtoolCoalesceLen)
+	binary.NativeEndian.PutUint32(buf[0:], unix.ETHTOOL_PERQUEUE)
+	binary.NativeEndian.PutUint32(buf[4:], subCommand)
+	for i, queue := range queues {
+		if queue >= apis.MaxCoalesceQueues {
+			return nil, fmt.Errorf("queue %d must be lower than %d", queue, apis.MaxCoalesceQueues)
+		}
+		if i > 0 && queue <= queues[i-1] {
+			return nil, fmt.Errorf("queues %v are not sorted and unique", queues)
+		}
+		offset := 8 + 4*int(queue/32)
+		word := binary.NativeEndian.Uint32(buf[offset:])
+		binary.NativeEndian.PutUint32(buf[offset:], word|1<<(queue%32))
+
+		entry := ethtoolCoalesce{Cmd: subCommand}
+		if coalesce != nil {
+			entry = coalesce[i]
+			entry.Cmd = subCommand
+		}
+		if _, err := binary.Encode(buf[ethtoolPerQueueHeaderLen+i*ethtoolCoalesceLen:], binary.NativeEndian, entry); err != nil {
+			return nil, fmt.Errorf("failed to encode the coalescing of queue %d: %w", queue, err)
+		}
+	}
+	return buf, nil
+}
+
+// decodePerQueueCoalesce returns the struct ethtool_coalesce of the n queues
+// following the struct ethtool_per_queue_op.
+func decodePerQueueCoalesce(buf []byte, n int) ([]ethtoolCoalesce, error) {
+	if len(buf) < ethtoolPerQueueHeaderLen+n*ethtoolCoalesceLen {
+		return nil, fmt.Errorf("short buffer of %d bytes for %d queues", len(buf), n)
+	}
+	coalesce := make([]ethtoolCoalesce, n)
+	for i := range coalesce {
+		if _, err := binary.Decode(buf[ethtoolPerQueueHeaderLen+i*ethtoolCoalesceLen:], binary.NativeEndian, &coalesce[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode the coalescing of the queue %d: %w", i, err)
+		}
+	}
+	return coalesce, nil
+}
+
+// mergeCoalesceParams sets the parameters of the configuration in the struct
+// ethtool_coalesce of a queue.
+func mergeCoalesceParams(coalesce *ethtoolCoalesce, params apis.CoalesceParams) {
+	for _, p := range []struct {
+		field *uint32
+		value *uint32
+	}{
+		{&coalesce.RxCoalesceUsecs, params.RxUsecs},
+		{&coalesce.RxMaxCoalescedFrames, params.RxMaxFrames},
+		{&coalesce.TxCoalesceUsecs, params.TxUsecs},
+		{&coalesce.TxMaxCoalescedFrames, params.TxMaxFrames},
+	} {
+		if p.value != nil {
+			*p.field = *p.value
+		}
+	}
+	for _, p := range []struct {
+		field *uint32
+		value *bool
+	}{
+		{&coalesce.UseAdaptiveRxCoalesce, params.AdaptiveRx},
+		{&coalesce.UseAdaptiveTxCoalesce, params.AdaptiveTx},
+	} {
+		if p.value == nil {
+			continue
+		}
+		*p.field = 0
+		if *p.value {
+			*p.field = 1
+		}
+	}
+}
+
+// checkCoalesceQueues returns an error for each queue of the configuration
+// that the interface with queueCount queues does not have.
+func checkCoalesceQueues(ifName string, perQueue []apis.QueueCoalesce, queueCount int) []error {
+	var errorList []error
+	for _, q := range perQueue {
+		if int(q.Queue) >= queueCount {
+			errorList = append(errorList, fmt.Errorf("ethtool.coalesce.perQueue: queue %d does not exist, interface %s has %d queues", q.Queue, ifName, queueCount))
+		}
+	}
+	return errorList
+}
+
+// validateCoalesceQueues checks that the queues of the coalescing exist on the
+// interface. It is skipped if the driver does not report its channels.
+func validateCoalesceQueues(client *ethtoolClient, ifName string, config *apis.CoalesceConfig) error {
+	if config == nil || len(config.PerQueue) == 0 {
+		return nil
+	}
+	queueCount, err := client.GetQueueCount(ifName)
+	if err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			klog.V(2).Infof("Can not validate the ethtool coalescing queues of %s, the driver does not report its channels", ifName)
+			return nil
+		}
+		return fmt.Errorf("failed to get the queues of %s: %w", ifName, err)
+	}
+	return errors.Join(checkCoalesceQueues(ifName, config.PerQueue, queueCount)...)
+}
+
+// applyCoalesceConfig applies the interrupt coalescing of the interface and
+// then of its queues. The settings the driver does not support are skipped
+// with a warning, the coalescing is a tuning that does not prevent the
+// interface from working.
+func applyCoalesceConfig(client *ethtoolClient, ns string, ifName string, config *apis.CoalesceConfig) error {
+	var errorList []error
+	if !config.CoalesceParams.IsEmpty() {
+		klog.V(2).Infof("Applying ethtool coalescing for %s in ns %s: %s", ifName, ns, formatCoalesce(config.CoalesceParams))
+		if err := client.SetCoalesce(ifName, config.CoalesceParams); errors.Is(err, unix.EOPNOTSUPP) {
+			klog.Warningf("Skipping the ethtool coalescing of %s in ns %s: %v", ifName, ns, err)
+		} else if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool coalescing for %s: %w", ifName, err))
+		}
+	}
+
+	if len(config.PerQueue) > 0 {
+		if err := validateCoalesceQueues(client, ifName, config); err != nil {
+			return errors.Join(append(errorList, err)...)
+		}
+		klog.V(2).Infof("Applying ethtool coalescing for %d queues of %s in ns %s", len(config.PerQueue), ifName, ns)
+		if err := client.SetQueueCoalesce(ifName, config.PerQueue); errors.Is(err, unix.EOPNOTSUPP) {
+			klog.Warningf("Skipping the ethtool coalescing of the queues of %s in ns %s: %v", ifName, ns, err)
+		} else if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to set ethtool coalescing of the queues for %s: %w", ifName, err))
+		}
+	}
+	return errors.Join(errorList...)
+}
+
+// formatCoalesce returns the coalescing parameters set, e.g.
+// "[rx-usecs:50 adaptive-rx:off]".
+func formatCoalesce(params apis.CoalesceParams) string {
+	var out []string
+	for _, p := range []struct {
+		name  string
+		value *uint32
+	}{
+		{"rx-usecs", params.RxUsecs},
+		{"rx-frames", params.RxMaxFrames},
+		{"tx-usecs", params.TxUsecs},
+		{"tx-frames", params.TxMaxFrames},
+	} {
+		if p.value != nil {
+			out = append(out, fmt.Sprintf("%s:%d", p.name, *p.value))
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *bool
+	}{
+		{"adaptive-rx", params.AdaptiveRx},
+		{"adaptive-tx", params.AdaptiveTx},
+	} {
+		if p.value == nil {
+			continue
+		}
+		state := "off"
+		if *p.value {
+			state = "on"
+		}
+		out = append(out, p.name+":"+state)
+	}
+	return "[" + strings.Join(out, " ") + "]"
+}
@@ -0,0 +1,245 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func Test_encodePerQueueCoalesce(t *testing.T) {
+	if ethtoolCoalesceLen != 92 {
+		t.Fatalf("struct ethtool_coalesce length = %d, want 92", ethtoolCoalesceLen)
+	}
+	if ethtoolPerQueueHeaderLen != 520 {
+		t.Fatalf("struct ethtool_per_queue_op length = %d, want 520", ethtoolPerQueueHeaderLen)
+	}
+
+	queues := []uint32{0, 5, 33, 4095}
+	coalesce := []ethtoolCoalesce{
+		{RxCoalesceUsecs: 1},
+		{RxCoalesceUsecs: 2, UseAdaptiveRxCoalesce: 1},
+		{TxMaxCoalescedFrames: 3},
+		{RateSampleInterval: 4},
+	}
+	buf, err := encodePerQueueCoalesce(unix.ETHTOOL_SCOALESCE, queues, coalesce)
+	if err != nil {
+		t.Fatalf("encodePerQueueCoalesce() failed: %v", err)
+	}
+	if len(buf) != 520+4*92 {
+		t.Fatalf("encodePerQueueCoalesce() length = %d, want %d", len(buf), 520+4*92)
+	}
+	if cmd := binary.NativeEndian.Uint32(buf[0:]); cmd != unix.ETHTOOL_PERQUEUE {
+		t.Errorf("cmd = %#x, want ETHTOOL_PERQUEUE", cmd)
+	}
+	if subCommand := binary.NativeEndian.Uint32(buf[4:]); subCommand != unix.ETHTOOL_SCOALESCE {
+		t.Errorf("sub_command = %#x, want ETHTOOL_SCOALESCE", subCommand)
+	}
+	wantMask := map[int]uint32{0: 1<<0 | 1<<5, 1: 1 << 1, 127: 1 << 31}
+	for word := range ethtoolQueueMaskWords {
+		if got := binary.NativeEndian.Uint32(buf[8+4*word:]); got != wantMask[word] {
+			t.Errorf("queue_mask[%d] = %#x, want %#x", word, got, wantMask[word])
+		}
+	}
+	// The data of the queues follows the header in the order of the mask,
+	// with the sub command.
+	for i, field := range []struct {
+		offset int
+		want   uint32
+	}{
+		{offset: 4, want: 1},
+		{offset: 4, want: 2},
+		{offset: 24, want: 3},
+		{offset: 88, want: 4},
+	} {
+		entry := buf[520+i*92:]
+		if cmd := binary.NativeEndian.Uint32(entry); cmd != unix.ETHTOOL_SCOALESCE {
+			t.Errorf("queue %d cmd = %#x, want ETHTOOL_SCOALESCE", queues[i], cmd)
+		}
+		if got := binary.NativeEndian.Uint32(entry[field.offset:]); got != field.want {
+			t.Errorf("queue %d field at offset %d = %d, want %d", queues[i], field.offset, got, field.want)
+		}
+	}
+	if got := binary.NativeEndian.Uint32(buf[520+92+40:]); got != 1 {
+		t.Errorf("queue 5 use_adaptive_rx_coalesce = %d, want 1", got)
+	}
+
+	decoded, err := decodePerQueueCoalesce(buf, len(queues))
+	if err != nil {
+		t.Fatalf("decodePerQueueCoalesce() failed: %v", err)
+	}
+	for i := range coalesce {
+		want := coalesce[i]
+		want.Cmd = unix.ETHTOOL_SCOALESCE
+		if decoded[i] != want {
+			t.Errorf("decoded queue %d = %+v, want %+v", queues[i], decoded[i], want)
+		}
+	}
+}
+
+func Test_encodePerQueueCoalesceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		queues   []uint32
+		coalesce []ethtoolCoalesce
+	}{
+		{name: "no queues"},
+		{name: "unsorted", queues: []uint32{2, 1}},
+		{name: "duplicate", queues: []uint32{1, 1}},
+		{name: "out of range", queues: []uint32{apis.MaxCoalesceQueues}},
+		{name: "data mismatch", queues: []uint32{1, 2}, coalesce: []ethtoolCoalesce{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := encodePerQueueCoalesce(unix.ETHTOOL_GCOALESCE, tt.queues, tt.coalesce); err == nil {
+				t.Errorf("encodePerQueueCoalesce() succeeded, want error")
+			}
+		})
+	}
+	if _, err := decodePerQueueCoalesce(make([]byte, ethtoolPerQueueHeaderLen+ethtoolCoalesceLen), 2); err == nil {
+		t.Errorf("decodePerQueueCoalesce() of a short buffer succeeded, want error")
+	}
+}
+
+func Test_mergeCoalesceParams(t *testing.T) {
+	current := ethtoolCoalesce{
+		RxCoalesceUsecs:       10,
+		RxMaxCoalescedFrames:  20,
+		TxCoalesceUsecs:       30,
+		UseAdaptiveRxCoalesce: 1,
+		UseAdaptiveTxCoalesce: 1,
+	}
+	mergeCoalesceParams(&current, apis.CoalesceParams{
+		RxUsecs:     ptr.To[uint32](0),
+		TxMaxFrames: ptr.To[uint32](64),
+		AdaptiveRx:  ptr.To(false),
+	})
+	want := ethtoolCoalesce{
+		RxMaxCoalescedFrames:  20,
+		TxCoalesceUsecs:       30,
+		TxMaxCoalescedFrames:  64,
+		UseAdaptiveTxCoalesce: 1,
+	}
+	if current != want {
+		t.Errorf("mergeCoalesceParams() = %+v, want %+v", current, want)
+	}
+}
+
+func Test_checkCoalesceQueues(t *testing.T) {
+	perQueue := []apis.QueueCoalesce{{Queue: 0}, {Queue: 3}, {Queue: 8}}
+	if errs := checkCoalesceQueues("eth1", perQueue, 9); len(errs) != 0 {
+		t.Errorf("checkCoalesceQueues() with 9 queues = %v, want no errors", errs)
+	}
+	errs := checkCoalesceQueues("eth1", perQueue, 4)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "queue 8") {
+		t.Errorf("checkCoalesceQueues() with 4 queues = %v, want an error for queue 8", errs)
+	}
+}
+
+func Test_formatCoalesce(t *testing.T) {
+	got := formatCoalesce(apis.CoalesceParams{RxUsecs: ptr.To[uint32](50), TxMaxFrames: ptr.To[uint32](16), AdaptiveRx: ptr.To(false)})
+	if want := "[rx-usecs:50 tx-frames:16 adaptive-rx:off]"; got != want {
+		t.Errorf("formatCoalesce() = %q, want %q", got, want)
+	}
+}
+
+func Test_applyEthtoolCoalesceConfig(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	// veth does not implement the coalescing, the configuration is skipped
+	// instead of failing the Pod.
+	nsPath := path.Join("/run/netns", nsName)
+	config := &apis.EthtoolConfig{Coalesce: &apis.CoalesceConfig{
+		CoalesceParams: apis.CoalesceParams{RxUsecs: ptr.To[uint32](8)},
+		PerQueue:       []apis.QueueCoalesce{{Queue: 0, CoalesceParams: apis.CoalesceParams{RxUsecs: ptr.To[uint32](0)}}},
+	}}
+	if err := applyEthtoolConfig(nsPath, ifaceName, config); err != nil {
+		t.Fatalf("applyEthtoolConfig failed: %v", err)
+	}
+
+	client, err := newEthtoolClient(int(testNS))
+	if err != nil {
+		t.Fatalf("failed to create ethtool client in namespace %s: %v", nsName, err)
+	}
+	defer client.Close()
+	queueCount, err := client.GetQueueCount(ifaceName)
+	if err != nil {
+		t.Skipf("getting the channels not supported by %s: %v", ifaceName, err)
+	}
+	config.Coalesce.PerQueue = []apis.QueueCoalesce{{Queue: uint32(queueCount), CoalesceParams: apis.CoalesceParams{RxUsecs: ptr.To[uint32](0)}}}
+	err = applyEthtoolConfig(nsPath, ifaceName, config)
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("applyEthtoolConfig() with queue %d of %d = %v, want an error for the missing queue", queueCount, queueCount, err)
+	}
+}
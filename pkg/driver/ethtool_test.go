@@ -18,16 +18,21 @@ package driver
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 	"sigs.k8s.io/dranet/pkg/apis"
 )
@@ -230,6 +235,578 @@ func Test_applyEthtoolConfig(t *testing.T) {
 	}
 }
 
+func Test_ethtoolFeatureSteps(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *apis.EthtoolConfig
+		want   []map[string]bool
+	}{
+		{
+			name:   "empty",
+			config: &apis.EthtoolConfig{},
+		},
+		{
+			name:   "enable only",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-gro": true, "tx-tcp-segmentation": true}},
+			want:   []map[string]bool{{"rx-gro": true, "tx-tcp-segmentation": true}},
+		},
+		{
+			name:   "dependency pair in map is disabled first",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-gro-hw": true, "rx-lro": false}},
+			want:   []map[string]bool{{"rx-lro": false}, {"rx-gro-hw": true}},
+		},
+		{
+			name: "ordered features keep their order after the map",
+			config: &apis.EthtoolConfig{
+				Features: map[string]bool{"highdma": true},
+				OrderedFeatures: []apis.EthtoolFeature{
+					{Name: "rx-gro", Enabled: true},
+					{Name: "rx-lro", Enabled: false},
+				},
+			},
+			want: []map[string]bool{{"highdma": true}, {"rx-gro": true}, {"rx-lro": false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ethtoolFeatureSteps(tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ethtoolFeatureSteps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeFeaturesClient emulates a device that refuses to change the features
+// in linkDown while the link is up and the features in fixed at all.
+type fakeFeaturesClient struct {
+	linkUp   bool
+	linkDown sets.Set[string]
+	fixed    sets.Set[string]
+	calls    []string
+}
+
+func (c *fakeFeaturesClient) GetFeatures(_ string) (*ethtoolFeatures, error) {
+	features := &ethtoolFeatures{hardware: map[string]bool{}, nochange: map[string]bool{}}
+	for name := range c.linkDown {
+		features.hardware[name] = true
+	}
+	for name := range c.fixed {
+		features.hardware[name] = false
+		features.nochange[name] = true
+	}
+	return features, nil
+}
+
+func (c *fakeFeaturesClient) SetFeatures(_ string, featuresToSet map[string]bool) error {
+	c.calls = append(c.calls, "set "+formatFeatures(featuresToSet))
+	refused := map[string]bool{}
+	for name, value := range featuresToSet {
+		if c.fixed.Has(name) || c.linkUp && c.linkDown.Has(name) {
+			refused[name] = value
+		}
+	}
+	if len(refused) > 0 {
+		return &refusedFeaturesError{features: refused}
+	}
+	return nil
+}
+
+func (c *fakeFeaturesClient) withLinkDown(apply func() error) error {
+	c.calls = append(c.calls, "down")
+	c.linkUp = false
+	err := apply()
+	c.calls = append(c.calls, "up")
+	c.linkUp = true
+	return err
+}
+
+func Test_applyEthtoolFeatures(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *apis.EthtoolConfig
+		linkDown  []string
+		fixed     []string
+		wantCalls []string
+		wantErr   string
+	}{
+		{
+			name:      "applied with the link up",
+			config:    &apis.EthtoolConfig{Features: map[string]bool{"rx-gro": true}, AllowLinkDown: ptr.To(true)},
+			wantCalls: []string{"set [rx-gro:on]"},
+		},
+		{
+			name: "refused features applied with the link down",
+			config: &apis.EthtoolConfig{
+				Features:        map[string]bool{"rx-gro": true, "rx-fcs": true},
+				OrderedFeatures: []apis.EthtoolFeature{{Name: "rx-all", Enabled: true}},
+				AllowLinkDown:   ptr.To(true),
+			},
+			linkDown: []string{"rx-fcs", "rx-all"},
+			wantCalls: []string{
+				"set [rx-fcs:on rx-gro:on]",
+				"set [rx-all:on]",
+				"down",
+				"set [rx-fcs:on]",
+				"set [rx-all:on]",
+				"up",
+			},
+		},
+		{
+			name:      "link down not allowed",
+			config:    &apis.EthtoolConfig{Features: map[string]bool{"rx-fcs": true}},
+			linkDown:  []string{"rx-fcs"},
+			wantCalls: []string{"set [rx-fcs:on]"},
+			wantErr:   "set allowLinkDown",
+		},
+		{
+			name:      "fixed features are not applied with the link down",
+			config:    &apis.EthtoolConfig{Features: map[string]bool{"vlan-challenged": true}, AllowLinkDown: ptr.To(true)},
+			fixed:     []string{"vlan-challenged"},
+			wantCalls: []string{"set [vlan-challenged:on]"},
+			wantErr:   "kernel refused the following features: [vlan-challenged:on]",
+		},
+		{
+			name:      "only the changeable features are applied with the link down",
+			config:    &apis.EthtoolConfig{Features: map[string]bool{"vlan-challenged": true, "rx-fcs": true}, AllowLinkDown: ptr.To(true)},
+			linkDown:  []string{"rx-fcs"},
+			fixed:     []string{"vlan-challenged"},
+			wantCalls: []string{"set [rx-fcs:on vlan-challenged:on]", "down", "set [rx-fcs:on]", "up"},
+			wantErr:   "kernel refused the following features: [vlan-challenged:on]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeFeaturesClient{linkUp: true, linkDown: sets.New(tt.linkDown...), fixed: sets.New(tt.fixed...)}
+			err := applyEthtoolFeatures(client, "test", "eth0", tt.config, client.withLinkDown)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("applyEthtoolFeatures() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("applyEthtoolFeatures() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(client.calls, tt.wantCalls) {
+				t.Errorf("applyEthtoolFeatures() calls = %q, want %q", client.calls, tt.wantCalls)
+			}
+			if !client.linkUp {
+				t.Errorf("applyEthtoolFeatures() left the link down")
+			}
+		})
+	}
+}
+
+func Test_ethtoolConfigPhases(t *testing.T) {
+	features := map[string]bool{"rx-gro": true}
+	privateFlags := map[string]bool{"rx_cqe_compress": true}
+	pause := &apis.PauseConfig{RxPause: ptr.To(true), TxPause: ptr.To(true)}
+	coalesce := &apis.CoalesceConfig{PerQueue: []apis.QueueCoalesce{{Queue: 1, CoalesceParams: apis.CoalesceParams{RxUsecs: ptr.To[uint32](8)}}}}
+	tests := []struct {
+		name           string
+		config         *apis.EthtoolConfig
+		wantBeforeMove *apis.EthtoolConfig
+		wantInPod      *apis.EthtoolConfig
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:      "everything in the pod namespace",
+			config:    &apis.EthtoolConfig{Features: features, PrivateFlags: privateFlags, Pause: pause, FEC: ptr.To(apis.EthtoolFECRS)},
+			wantInPod: &apis.EthtoolConfig{Features: features, PrivateFlags: privateFlags, Pause: pause, FEC: ptr.To(apis.EthtoolFECRS)},
+		},
+		{
+			name: "private flags before the move",
+			config: &apis.EthtoolConfig{
+				Features:        features,
+				PrivateFlags:    privateFlags,
+				Pause:           pause,
+				ApplyBeforeMove: []string{apis.EthtoolSettingPrivateFlags},
+			},
+			wantBeforeMove: &apis.EthtoolConfig{PrivateFlags: privateFlags},
+			wantInPod:      &apis.EthtoolConfig{Features: features, Pause: pause},
+		},
+		{
+			name: "all the device settings before the move",
+			config: &apis.EthtoolConfig{
+				PrivateFlags:    privateFlags,
+				Pause:           pause,
+				ApplyBeforeMove: []string{apis.EthtoolSettingPause, apis.EthtoolSettingPrivateFlags},
+			},
+			wantBeforeMove: &apis.EthtoolConfig{PrivateFlags: privateFlags, Pause: pause},
+		},
+		{
+			name: "coalescing in the pod namespace",
+			config: &apis.EthtoolConfig{
+				PrivateFlags:    privateFlags,
+				Coalesce:        coalesce,
+				ApplyBeforeMove: []string{apis.EthtoolSettingPrivateFlags},
+			},
+			wantBeforeMove: &apis.EthtoolConfig{PrivateFlags: privateFlags},
+			wantInPod:      &apis.EthtoolConfig{Coalesce: coalesce},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			beforeMove, inPod := ethtoolConfigPhases(tt.config)
+			if !reflect.DeepEqual(beforeMove, tt.wantBeforeMove) {
+				t.Errorf("ethtoolConfigPhases() before move = %+v, want %+v", beforeMove, tt.wantBeforeMove)
+			}
+			if !reflect.DeepEqual(inPod, tt.wantInPod) {
+				t.Errorf("ethtoolConfigPhases() in pod = %+v, want %+v", inPod, tt.wantInPod)
+			}
+		})
+	}
+}
+
+func Test_deniedEthtoolFeatures(t *testing.T) {
+	ifFeatures := &ethtoolFeatures{hardware: map[string]bool{
+		"rx-checksum":            true,
+		"tx-checksum-ipv4":       true,
+		"tx-checksum-ip-generic": true,
+		"rx-gro":                 true,
+		"rx-lro":                 false,
+	}}
+	tests := []struct {
+		name   string
+		config *apis.EthtoolConfig
+		denied []string
+		want   []string
+	}{
+		{
+			name:   "nothing denied",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-checksum": false}},
+		},
+		{
+			name:   "allowed feature",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-gro": true}},
+			denied: []string{"rx", "tx"},
+		},
+		{
+			name:   "kernel name denied by alias",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-checksum": false, "rx-gro": true}},
+			denied: []string{"rx"},
+			want:   []string{"rx-checksum"},
+		},
+		{
+			name:   "alias denied by kernel name",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"tx-checksumming": false}},
+			denied: []string{"tx-checksum-ipv4"},
+			want:   []string{"tx-checksumming"},
+		},
+		{
+			name: "ordered features",
+			config: &apis.EthtoolConfig{
+				Features:        map[string]bool{"tx": false},
+				OrderedFeatures: []apis.EthtoolFeature{{Name: "lro", Enabled: false}, {Name: "gro", Enabled: true}},
+			},
+			denied: []string{"tx", "rx-lro"},
+			want:   []string{"lro", "tx"},
+		},
+		{
+			name:   "feature not supported by the interface",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-hashing": true}},
+			denied: []string{"rx-hashing"},
+			want:   []string{"rx-hashing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deniedEthtoolFeatures(tt.config, sets.New(tt.denied...), ifFeatures)
+			if !reflect.DeepEqual(got, tt.want) && (len(got) != 0 || len(tt.want) != 0) {
+				t.Errorf("deniedEthtoolFeatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEthtoolFixedFeaturePolicy(t *testing.T) {
+	for _, s := range []string{"error", "skip"} {
+		if got, err := ParseEthtoolFixedFeaturePolicy(s); err != nil || string(got) != s {
+			t.Errorf("ParseEthtoolFixedFeaturePolicy(%q) = %q, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "ignore", "Skip"} {
+		if _, err := ParseEthtoolFixedFeaturePolicy(s); err == nil {
+			t.Errorf("ParseEthtoolFixedFeaturePolicy(%q) expected error", s)
+		}
+	}
+}
+
+func Test_skipFixedEthtoolFeatures(t *testing.T) {
+	ifFeatures := &ethtoolFeatures{
+		hardware: map[string]bool{"rx-gro": true, "rx-fcs": true, "tx-checksum-ipv4": false},
+		active:   map[string]bool{"rx-gro": true, "vlan-challenged": true, "tx-checksum-ipv4": true},
+		nochange: map[string]bool{"rx-fcs": true, "vlan-challenged": true},
+	}
+	tests := []struct {
+		name        string
+		config      *apis.EthtoolConfig
+		want        *apis.EthtoolConfig
+		wantSkipped []string
+	}{
+		{
+			name:   "no fixed feature",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"rx-gro": false}},
+			want:   &apis.EthtoolConfig{Features: map[string]bool{"rx-gro": false}},
+		},
+		{
+			name:   "fixed feature already at the requested value",
+			config: &apis.EthtoolConfig{Features: map[string]bool{"vlan-challenged": true}},
+			want:   &apis.EthtoolConfig{Features: map[string]bool{"vlan-challenged": true}},
+		},
+		{
+			name: "fixed features skipped",
+			config: &apis.EthtoolConfig{
+				Features:        map[string]bool{"rx-gro": false, "rx-fcs": true, "tx-checksum-ipv4": false},
+				OrderedFeatures: []apis.EthtoolFeature{{Name: "vlan-challenged", Enabled: false}, {Name: "rx-gro", Enabled: true}},
+				AllowLinkDown:   ptr.To(true),
+			},
+			want: &apis.EthtoolConfig{
+				Features:        map[string]bool{"rx-gro": false},
+				OrderedFeatures: []apis.EthtoolFeature{{Name: "rx-gro", Enabled: true}},
+				AllowLinkDown:   ptr.To(true),
+			},
+			wantSkipped: []string{"rx-fcs", "tx-checksum-ipv4", "vlan-challenged"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped := skipFixedEthtoolFeatures(tt.config, ifFeatures)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("skipFixedEthtoolFeatures() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) && (len(skipped) != 0 || len(tt.wantSkipped) != 0) {
+				t.Errorf("skipFixedEthtoolFeatures() skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func Test_ethtoolFixedFeaturePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    EthtoolFixedFeaturePolicy
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:      "error",
+			policy:    EthtoolFixedFeaturePolicyError,
+			wantCalls: []string{"set [rx-gro:on vlan-challenged:on]"},
+			wantErr:   true,
+		},
+		{
+			name:      "skip",
+			policy:    EthtoolFixedFeaturePolicySkip,
+			wantCalls: []string{"set [rx-gro:on]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeFeaturesClient{linkUp: true, fixed: sets.New("vlan-challenged")}
+			ifFeatures, _ := client.GetFeatures("eth0")
+			ifFeatures.hardware["rx-gro"] = true
+			config := &apis.EthtoolConfig{Features: map[string]bool{"rx-gro": true, "vlan-challenged": true}}
+			if tt.policy == EthtoolFixedFeaturePolicySkip {
+				config, _ = skipFixedEthtoolFeatures(config, ifFeatures)
+			}
+			err := applyEthtoolFeatures(client, "test", "eth0", config, client.withLinkDown)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applyEthtoolFeatures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(client.calls, tt.wantCalls) {
+				t.Errorf("applyEthtoolFeatures() calls = %q, want %q", client.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_formatFeatures(t *testing.T) {
+	got := formatFeatures(map[string]bool{"rx-lro": false, "rx-gro": true})
+	if want := "[rx-gro:on rx-lro:off]"; got != want {
+		t.Errorf("formatFeatures() = %q, want %q", got, want)
+	}
+}
+
+func Test_formatPause(t *testing.T) {
+	got := formatPause(&apis.PauseConfig{RxPause: ptr.To(true), TxPause: ptr.To(false)})
+	if want := "[rx:on tx:off]"; got != want {
+		t.Errorf("formatPause() = %q, want %q", got, want)
+	}
+}
+
+func Test_applyEthtoolPauseConfig(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	// veth supports the pause parameters on recent kernels, other virtual
+	// devices do not implement them at all.
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	client, err := newEthtoolClient(int(testNS))
+	if err != nil {
+		t.Fatalf("failed to create ethtool client in namespace %s: %v", nsName, err)
+	}
+	defer client.Close()
+
+	if _, err := client.GetPauseParams(ifaceName); errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skipf("pause parameters not supported by %s: %v", ifaceName, err)
+	} else if err != nil {
+		t.Fatalf("can not get pause parameters: %v", err)
+	}
+
+	pause := &apis.PauseConfig{Autoneg: ptr.To(false), RxPause: ptr.To(true), TxPause: ptr.To(true)}
+	err = applyEthtoolConfig(path.Join("/run/netns", nsName), ifaceName, &apis.EthtoolConfig{Pause: pause})
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		if !strings.Contains(err.Error(), "ethtool.pause") {
+			t.Errorf("unsupported error does not report the field: %v", err)
+		}
+		t.Skipf("setting pause parameters not supported by %s: %v", ifaceName, err)
+	} else if err != nil {
+		t.Fatalf("applyEthtoolConfig failed: %v", err)
+	}
+
+	got, err := client.GetPauseParams(ifaceName)
+	if err != nil {
+		t.Fatalf("can not get pause parameters: %v", err)
+	}
+	if !reflect.DeepEqual(got, pause) {
+		t.Errorf("pause parameters = %s, want %s", formatPause(got), formatPause(pause))
+	}
+}
+
+func Test_fecLinkModes(t *testing.T) {
+	for _, mode := range []string{apis.EthtoolFECNone, apis.EthtoolFECBaseR, apis.EthtoolFECRS} {
+		name := fecLinkModeName(mode)
+		if name == "" {
+			t.Errorf("fecLinkModeName(%q) has no link mode", mode)
+		}
+		if got := fecModeByName(name); got != mode {
+			t.Errorf("fecModeByName(%q) = %q, want %q", name, got, mode)
+		}
+	}
+	if got := fecLinkModeName(apis.EthtoolFECAuto); got != "" {
+		t.Errorf("fecLinkModeName(%q) = %q, auto is not a link mode", apis.EthtoolFECAuto, got)
+	}
+	if got := fecModeByBit(unix.ETHTOOL_LINK_MODE_FEC_RS_BIT); got != apis.EthtoolFECRS {
+		t.Errorf("fecModeByBit(RS) = %q, want %q", got, apis.EthtoolFECRS)
+	}
+	if got := fecModeByBit(unix.ETHTOOL_LINK_MODE_1000baseT_Full_BIT); got != "" {
+		t.Errorf("fecModeByBit(1000baseT_Full) = %q, want no FEC mode", got)
+	}
+}
+
+func Test_applyEthtoolFECConfig(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	// Virtual devices do not implement FEC, the test only runs the whole
+	// path on a device that does.
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	client, err := newEthtoolClient(int(testNS))
+	if err != nil {
+		t.Fatalf("failed to create ethtool client in namespace %s: %v", nsName, err)
+	}
+	defer client.Close()
+
+	err = applyEthtoolConfig(path.Join("/run/netns", nsName), ifaceName, &apis.EthtoolConfig{FEC: ptr.To(apis.EthtoolFECRS)})
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		if !strings.Contains(err.Error(), "ethtool.fec") {
+			t.Errorf("unsupported error does not report the field: %v", err)
+		}
+		t.Skipf("setting the FEC mode not supported by %s: %v", ifaceName, err)
+	} else if err != nil {
+		t.Fatalf("applyEthtoolConfig failed: %v", err)
+	}
+
+	got, err := client.GetFEC(ifaceName)
+	if err != nil {
+		t.Fatalf("can not get the FEC parameters: %v", err)
+	}
+	if got.auto || !reflect.DeepEqual(got.modes, []string{apis.EthtoolFECRS}) {
+		t.Errorf("FEC parameters = %+v, want modes [%s] without auto", got, apis.EthtoolFECRS)
+	}
+}
+
 func ParseEthtoolFeatures(output string) map[string]bool {
 	features := make(map[string]bool)
 	lines := strings.Split(output, "\n")
@@ -0,0 +1,48 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// nriSocketTimeout bounds the connection attempt of the NRI socket check.
+const nriSocketTimeout = time.Second
+
+// CheckNRIHealth returns an error if the NRI plugin is disconnected from the
+// runtime and the NRI socket does not accept connections, e.g. the runtime is
+// gone or NRI was disabled. The socket is only dialed while the plugin is
+// disconnected: the runtime handles each connection as a plugin that fails to
+// register, and the established connection already proves it is reachable.
+func (np *NetworkDriver) CheckNRIHealth() error {
+	if np.nriConnected.Load() {
+		return nil
+	}
+	return checkUnixSocket(np.nriSocketPath, nriSocketTimeout)
+}
+
+// checkUnixSocket returns an error if the unix socket does not accept a
+// connection within the timeout.
+func checkUnixSocket(path string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return fmt.Errorf("NRI socket %s is not connectable: %w", path, err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,63 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckNRIHealth(t *testing.T) {
+	// The unix socket paths are limited to 108 bytes, t.TempDir() may be longer.
+	dir, err := os.MkdirTemp("", "nri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "nri.sock")
+
+	np := &NetworkDriver{nriSocketPath: socketPath}
+	if err := np.CheckNRIHealth(); err == nil {
+		t.Errorf("CheckNRIHealth() without NRI socket succeeded, want error")
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socketPath, err)
+	}
+	if err := np.CheckNRIHealth(); err != nil {
+		t.Errorf("CheckNRIHealth() with a listening NRI socket: %v", err)
+	}
+
+	// The runtime is gone, the stale socket file is left behind.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("socket file %s removed: %v", socketPath, err)
+	}
+	if err := np.CheckNRIHealth(); err == nil {
+		t.Errorf("CheckNRIHealth() with a stale NRI socket succeeded, want error")
+	}
+
+	// The socket is not checked while the plugin is connected.
+	np.nriConnected.Store(true)
+	if err := np.CheckNRIHealth(); err != nil {
+		t.Errorf("CheckNRIHealth() with the NRI plugin connected: %v", err)
+	}
+}
@@ -19,7 +19,10 @@ package driver
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"slices"
+	"strings"
 
 	"sigs.k8s.io/dranet/pkg/apis"
 
@@ -28,29 +31,189 @@ import (
 	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
 	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/inventory"
 
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/klog/v2"
 )
 
-func nsAttachNetdev(hostIfName string, containerNsPAth string, interfaceConfig apis.InterfaceConfig) (*resourceapi.NetworkDeviceData, error) {
-	hostDev, err := nlwrap.LinkByName(hostIfName)
+// errDeviceGone is returned when the network interface of a claimed device no
+// longer exists on the host, e.g. a hotplugged NIC was removed or a VF was
+// rebound between the DRA prepare and the NRI RunPodSandbox hooks.
+var errDeviceGone = errors.New("network device no longer exists")
+
+// resolveHostInterface returns the current name of the host interface. If the
+// interface is not found it is looked up by the PCI address recorded when the
+// claim was prepared, in case it was renamed, otherwise errDeviceGone is
+// returned. Other errors are left for nsAttachNetdev to report.
+func resolveHostInterface(ifName string, pciAddress string) (string, error) {
+	_, err := nlwrap.LinkByName(ifName)
+	if err == nil || !isLinkNotFound(err) {
+		return ifName, nil
+	}
+	if pciAddress != "" {
+		newName, pciErr := inventory.GetNetInterfaceNameForPCI(pciAddress)
+		if pciErr == nil {
+			klog.Infof("interface %s not found, using interface %s of PCI device %s", ifName, newName, pciAddress)
+			return newName, nil
+		}
+		return "", fmt.Errorf("%w: interface %s and PCI device %s not found: %v", errDeviceGone, ifName, pciAddress, pciErr)
+	}
+	return "", fmt.Errorf("%w: interface %s not found: %v", errDeviceGone, ifName, err)
+}
+
+// isLinkNotFound returns true if the netlink error means the link does not exist.
+func isLinkNotFound(err error) bool {
+	var notFound netlink.LinkNotFoundError
+	return errors.As(err, &notFound) || errors.Is(err, unix.ENODEV)
+}
+
+// getHostInterfaceState returns the settings of the host interface to restore
+// when it is returned to the host. The ethtool features are best effort, some
+// devices do not support them.
+func getHostInterfaceState(ifName string) (*HostInterfaceState, error) {
+	link, err := nlwrap.LinkByName(ifName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get link for interface %s: %w", hostIfName, err)
+		return nil, fmt.Errorf("failed to get link for interface %s: %w", ifName, err)
+	}
+	state := &HostInterfaceState{MTU: link.Attrs().MTU}
+	if hwAddr := link.Attrs().HardwareAddr; len(hwAddr) > 0 {
+		state.HardwareAddr = hwAddr.String()
 	}
 
-	// Devices can be renamed only when down
-	if err = netlink.LinkSetDown(hostDev); err != nil {
-		return nil, fmt.Errorf("failed to set %q down: %w", hostIfName, err)
+	client, err := newEthtoolClient(0)
+	if err != nil {
+		klog.Infof("failed to create ethtool client to get the features of %s: %v", ifName, err)
+		return state, nil
+	}
+	defer client.Close()
+	ifFeatures, err := client.GetFeatures(ifName)
+	if err != nil {
+		klog.Infof("failed to get the ethtool features of %s: %v", ifName, err)
+		return state, nil
+	}
+	state.EthtoolFeatures = changeableFeatures(ifFeatures)
+	return state, nil
+}
+
+// changeableFeatures returns the active value of the features the device
+// allows to change.
+func changeableFeatures(ifFeatures *ethtoolFeatures) map[string]bool {
+	features := map[string]bool{}
+	for name, changeable := range ifFeatures.hardware {
+		if changeable && !ifFeatures.nochange[name] {
+			features[name] = ifFeatures.active[name]
+		}
+	}
+	return features
+}
+
+// restoreHostInterfaceState sets the MTU, the hardware address and the ethtool
+// features of the host interface back to the values of the state, only the
+// ones that differ are changed.
+func restoreHostInterfaceState(ifName string, state *HostInterfaceState) error {
+	link, err := nlwrap.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get link for interface %s: %w", ifName, err)
+	}
+	var errorList []error
+	if state.MTU > 0 && link.Attrs().MTU != state.MTU {
+		klog.V(2).Infof("restoring MTU of %s from %d to %d", ifName, link.Attrs().MTU, state.MTU)
+		if err := netlink.LinkSetMTU(link, state.MTU); err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to restore MTU %d of %s: %w", state.MTU, ifName, err))
+		}
+	}
+	if state.HardwareAddr != "" && link.Attrs().HardwareAddr.String() != state.HardwareAddr {
+		hwAddr, err := net.ParseMAC(state.HardwareAddr)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("invalid hardware address %s of %s: %w", state.HardwareAddr, ifName, err))
+		} else {
+			klog.V(2).Infof("restoring hardware address of %s from %s to %s", ifName, link.Attrs().HardwareAddr, state.HardwareAddr)
+			if err := netlink.LinkSetHardwareAddr(link, hwAddr); err != nil {
+				errorList = append(errorList, fmt.Errorf("failed to restore hardware address %s of %s: %w", state.HardwareAddr, ifName, err))
+			}
+		}
+	}
+	if len(state.EthtoolFeatures) > 0 {
+		if err := restoreEthtoolFeatures(ifName, state.EthtoolFeatures); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	return errors.Join(errorList...)
+}
+
+// restoreEthtoolFeatures sets the changeable features of the interface that
+// differ from the given values.
+func restoreEthtoolFeatures(ifName string, features map[string]bool) error {
+	client, err := newEthtoolClient(0)
+	if err != nil {
+		return fmt.Errorf("failed to create ethtool client: %w", err)
+	}
+	defer client.Close()
+	ifFeatures, err := client.GetFeatures(ifName)
+	if err != nil {
+		return fmt.Errorf("failed to get the ethtool features of %s: %w", ifName, err)
+	}
+	current := changeableFeatures(ifFeatures)
+	changed := map[string]bool{}
+	for name, value := range features {
+		if currentValue, ok := current[name]; ok && currentValue != value {
+			changed[name] = value
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	klog.V(2).Infof("restoring ethtool features of %s: %s", ifName, formatFeatures(changed))
+	if err := client.SetFeatures(ifName, changed); err != nil {
+		return fmt.Errorf("failed to restore the ethtool features of %s: %w", ifName, err)
+	}
+	return nil
+}
+
+// nsAttachNetdev moves the interface to the container namespace and applies
+// the interface configuration. The kernel may clamp or ignore the offload
+// sizes requested, the differences with the values read back from the link
+// are returned so they can be reported without failing the attachment.
+// The addresses in preservedAddresses are configured with their original
+// scope, flags and broadcast address.
+func nsAttachNetdev(hostIfName string, containerNsPAth string, interfaceConfig apis.InterfaceConfig, preservedAddresses []AddressConfig) (*resourceapi.NetworkDeviceData, []string, error) {
+	hostDev, err := nlwrap.LinkByName(hostIfName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get link for interface %s: %w", hostIfName, err)
 	}
 
 	containerNs, err := netns.GetFromPath(containerNsPAth)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get container network namespace %s: %w", containerNsPAth, err)
+		return nil, nil, fmt.Errorf("failed to get container network namespace %s: %w", containerNsPAth, err)
 	}
 	defer containerNs.Close()
 
+	// to avoid golang problem with goroutines we create the socket in the
+	// namespace and use it directly
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get netlink handle in container namespace %s: %w", containerNsPAth, err)
+	}
+	defer nhNs.Close()
+
 	attrs := hostDev.Attrs()
+	ifName := attrs.Name
+	if interfaceConfig.Name != "" {
+		ifName = interfaceConfig.Name
+	}
+
+	// The kernel fails to move the interface with EEXIST if the name is already
+	// used in the namespace, e.g. by the interface created by the CNI plugin.
+	// Check it before the host device is modified.
+	if _, err := nhNs.LinkByName(ifName); err == nil {
+		return nil, nil, fmt.Errorf("interface name %s is already in use on namespace %s, choose a different name for interface %s", ifName, containerNsPAth, hostIfName)
+	}
+
+	// Devices can be renamed only when down
+	if err = netlink.LinkSetDown(hostDev); err != nil {
+		return nil, nil, fmt.Errorf("failed to set %q down: %w", hostIfName, err)
+	}
 
 	// copy from netlink.LinkModify(dev) using only the parts needed
 	flags := unix.NLM_F_REQUEST | unix.NLM_F_ACK
@@ -58,7 +221,7 @@ func nsAttachNetdev(hostIfName string, containerNsPAth string, interfaceConfig a
 	// Get a netlink socket in current namespace
 	s, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
 	if err != nil {
-		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+		return nil, nil, fmt.Errorf("could not get network namespace handle: %w", err)
 	}
 	defer s.Close()
 
@@ -70,10 +233,6 @@ func nsAttachNetdev(hostIfName string, containerNsPAth string, interfaceConfig a
 	msg.Index = int32(attrs.Index)
 	req.AddData(msg)
 
-	ifName := attrs.Name
-	if interfaceConfig.Name != "" {
-		ifName = interfaceConfig.Name
-	}
 	nameData := nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(ifName))
 	req.AddData(nameData)
 
@@ -115,26 +274,24 @@ func nsAttachNetdev(hostIfName string, containerNsPAth string, interfaceConfig a
 		req.AddData(groV4Attr)
 	}
 
+	if interfaceConfig.GSOMaxSegments != nil {
+		gsoMaxSegs := uint32(*interfaceConfig.GSOMaxSegments)
+		gsoSegsAttr := nl.NewRtAttr(unix.IFLA_GSO_MAX_SEGS, nl.Uint32Attr(gsoMaxSegs))
+		req.AddData(gsoSegsAttr)
+	}
+
 	val := nl.Uint32Attr(uint32(containerNs))
 	attr := nl.NewRtAttr(unix.IFLA_NET_NS_FD, val)
 	req.AddData(attr)
 
 	_, err = req.Execute(unix.NETLINK_ROUTE, 0)
 	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
-		return nil, fmt.Errorf("failed to move interface %s to container namespace %s: %w", hostIfName, containerNsPAth, err)
-	}
-
-	// to avoid golang problem with goroutines we create the socket in the
-	// namespace and use it directly
-	nhNs, err := nlwrap.NewHandleAt(containerNs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get netlink handle in container namespace %s: %w", containerNsPAth, err)
+		return nil, nil, fmt.Errorf("failed to move interface %s to container namespace %s: %w", hostIfName, containerNsPAth, err)
 	}
-	defer nhNs.Close()
 
 	nsLink, err := nhNs.LinkByName(ifName)
 	if err != nil {
-		return nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPAth, err)
+		return nil, nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPAth, err)
 	}
 
 	networkData := &resourceapi.NetworkDeviceData{
@@ -142,28 +299,144 @@ func nsAttachNetdev(hostIfName string, containerNsPAth string, interfaceConfig a
 		HardwareAddress: string(nsLink.Attrs().HardwareAddr.String()),
 	}
 
-	for _, address := range interfaceConfig.Addresses {
+	networkData.IPs, err = addInterfaceAddresses(nhNs, nsLink, interfaceConfig.Addresses, withAddressBroadcasts(preservedAddresses, interfaceConfig.Broadcasts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up addresses on namespace %s: %w", containerNsPAth, err)
+	}
+
+	err = nhNs.LinkSetUp(nsLink)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up interface %s on namespace %s: %w", nsLink.Attrs().Name, containerNsPAth, err)
+	}
+
+	offloadMismatches := offloadSizeMismatches(interfaceConfig, nsLink.Attrs())
+	if len(offloadMismatches) > 0 {
+		klog.Warningf("interface %s on namespace %s offload sizes differ from requested: %s", ifName, containerNsPAth, strings.Join(offloadMismatches, ", "))
+	}
+
+	return networkData, offloadMismatches, nil
+}
+
+// addInterfaceAddresses assigns the addresses to the link, keeping the scope,
+// flags and broadcast address of the preserved ones, and returns the addresses
+// assigned. The IPv4 addresses without a broadcast address get the one of
+// their subnet. The addresses already present are accepted, so the
+// configuration can be applied again when RunPodSandbox is retried.
+func addInterfaceAddresses(nhNs nlwrap.Handle, link netlink.Link, addresses []string, preservedAddresses []AddressConfig) ([]string, error) {
+	preserved := make(map[string]AddressConfig, len(preservedAddresses))
+	for _, address := range preservedAddresses {
+		preserved[address.Address] = address
+	}
+	var assigned []string
+	for _, address := range addresses {
 		ip, ipnet, err := net.ParseCIDR(address)
 		if err != nil {
 			klog.Infof("failed to parse address %s : %v", address, err)
 			continue // this should not happen since it has been already validated
 		}
-		err = nhNs.AddrAdd(nsLink, &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: ipnet.Mask}})
-		if err != nil {
-			return nil, fmt.Errorf("failed to set up address %s on namespace %s: %w", address, containerNsPAth, err)
+		nlAddr := &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: ipnet.Mask}}
+		if p, ok := preserved[address]; ok {
+			nlAddr.Scope = p.Scope
+			nlAddr.Flags = p.Flags
+			if p.Broadcast != "" {
+				nlAddr.Broadcast = net.ParseIP(p.Broadcast).To4()
+			}
 		}
-		networkData.IPs = append(networkData.IPs, address)
+		err = nhNs.AddrAdd(link, nlAddr)
+		if err != nil && !errors.Is(err, unix.EEXIST) {
+			return nil, fmt.Errorf("failed to set up address %s: %w", address, err)
+		}
+		assigned = append(assigned, address)
 	}
+	return assigned, nil
+}
 
-	err = nhNs.LinkSetUp(nsLink)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set up interface %s on namespace %s: %w", nsLink.Attrs().Name, containerNsPAth, err)
+// preservableAddrFlags are the address flags that can be set from userspace,
+// the others (e.g. secondary, tentative, deprecated) are owned by the kernel.
+const preservableAddrFlags = unix.IFA_F_NODAD | unix.IFA_F_OPTIMISTIC | unix.IFA_F_HOMEADDRESS |
+	unix.IFA_F_MANAGETEMPADDR | unix.IFA_F_NOPREFIXROUTE | unix.IFA_F_MCAUTOJOIN | unix.IFA_F_STABLE_PRIVACY
+
+// addressesToPreserve returns all the non-loopback addresses with their scope,
+// the flags that can be set again on the pod's network namespace and their
+// broadcast address if it is not the one of the subnet. The order is kept so
+// primary addresses are added before the secondary ones.
+func addressesToPreserve(addresses []netlink.Addr) []AddressConfig {
+	var result []AddressConfig
+	for _, address := range addresses {
+		if address.IPNet == nil || address.IP.IsLoopback() {
+			continue
+		}
+		config := AddressConfig{
+			Address: address.IPNet.String(),
+			Scope:   address.Scope,
+			Flags:   address.Flags & preservableAddrFlags,
+		}
+		if address.Broadcast != nil && !address.Broadcast.Equal(subnetBroadcast(address.IPNet)) {
+			config.Broadcast = address.Broadcast.String()
+		}
+		result = append(result, config)
+	}
+	return result
+}
+
+// subnetBroadcast returns the broadcast address of an IPv4 subnet, nil for
+// IPv6 subnets.
+func subnetBroadcast(ipnet *net.IPNet) net.IP {
+	ip := ipnet.IP.To4()
+	if ip == nil || len(ipnet.Mask) != net.IPv4len {
+		return nil
 	}
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^ipnet.Mask[i]
+	}
+	return broadcast
+}
+
+// withAddressBroadcasts returns the preserved addresses with the broadcast
+// addresses of the interface configuration, the scope and flags of a
+// preserved address are kept when its broadcast address is configured.
+func withAddressBroadcasts(preservedAddresses []AddressConfig, broadcasts map[string]string) []AddressConfig {
+	result := slices.Clone(preservedAddresses)
+	for i := range result {
+		if broadcast, ok := broadcasts[result[i].Address]; ok {
+			result[i].Broadcast = broadcast
+		}
+	}
+	for _, address := range slices.Sorted(maps.Keys(broadcasts)) {
+		if !slices.ContainsFunc(preservedAddresses, func(preserved AddressConfig) bool { return preserved.Address == address }) {
+			result = append(result, AddressConfig{Address: address, Broadcast: broadcasts[address]})
+		}
+	}
+	return result
+}
 
-	return networkData, nil
+// offloadSizeMismatches compares the requested GSO/GRO sizes and GSO segments
+// with the effective values of the link and describes each one that differs.
+func offloadSizeMismatches(interfaceConfig apis.InterfaceConfig, attrs *netlink.LinkAttrs) []string {
+	var mismatches []string
+	compare := func(name string, requested *int32, effective uint32) {
+		if requested == nil || uint32(*requested) == effective {
+			return
+		}
+		mismatches = append(mismatches, fmt.Sprintf("%s requested %d effective %d", name, *requested, effective))
+	}
+	compare("gsoMaxSize", interfaceConfig.GSOMaxSize, attrs.GSOMaxSize)
+	compare("groMaxSize", interfaceConfig.GROMaxSize, attrs.GROMaxSize)
+	compare("gsoIPv4MaxSize", interfaceConfig.GSOIPv4MaxSize, attrs.GSOIPv4MaxSize)
+	compare("groIPv4MaxSize", interfaceConfig.GROIPv4MaxSize, attrs.GROIPv4MaxSize)
+	compare("gsoMaxSegments", interfaceConfig.GSOMaxSegments, attrs.GSOMaxSegs)
+	return mismatches
 }
 
-func nsDetachNetdev(containerNsPAth string, devName string, outName string) error {
+// nsDetachNetdev returns the interface devName of the container namespace to
+// the root namespace with the name outName, the original name of the interface
+// in the host stored in the PodConfig. The interface keeps its current name if
+// outName is empty. The alias of the interface belongs to the users, e.g. to
+// reserve it for the host, and is never used to restore the name. If hostState
+// is not nil the settings it holds are restored before the interface is set up,
+// a failure to restore them is logged without failing the detachment.
+func nsDetachNetdev(containerNsPAth string, devName string, outName string, hostState *HostInterfaceState) error {
 	containerNs, err := netns.GetFromPath(containerNsPAth)
 	if err != nil {
 		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPAth, devName, err)
@@ -190,10 +463,6 @@ func nsDetachNetdev(containerNsPAth string, devName string, outName string) erro
 	}
 
 	attrs := nsLink.Attrs()
-	// restore the original name if it was renamed
-	if nsLink.Attrs().Alias != "" {
-		attrs.Name = nsLink.Attrs().Alias
-	}
 
 	rootNs, err := netns.Get()
 	if err != nil {
@@ -232,6 +501,12 @@ func nsDetachNetdev(containerNsPAth string, devName string, outName string) erro
 		return fmt.Errorf("failed to move interface %s to root namespace: %w", devName, err)
 	}
 
+	if hostState != nil {
+		if err := restoreHostInterfaceState(ifName, hostState); err != nil {
+			klog.Infof("failed to restore the host settings of interface %s: %v", ifName, err)
+		}
+	}
+
 	// Set up the interface in case host network workloads depend on it
 	hostDev, err := nlwrap.LinkByName(ifName)
 	if err != nil {
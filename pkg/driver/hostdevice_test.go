@@ -19,15 +19,19 @@ package driver
 import (
 	"crypto/rand"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 	"sigs.k8s.io/dranet/pkg/apis"
@@ -104,9 +108,10 @@ func Test_nhNetdev(t *testing.T) {
 		GROMaxSize:     ptr.To[int32](1025),
 		GSOIPv4MaxSize: ptr.To[int32](1026),
 		GROIPv4MaxSize: ptr.To[int32](1027),
+		GSOMaxSegments: ptr.To[int32](32),
 	}
 
-	deviceData, err := nsAttachNetdev(ifaceName, path.Join("/run/netns", nsName), config)
+	deviceData, _, err := nsAttachNetdev(ifaceName, path.Join("/run/netns", nsName), config, nil)
 	if err != nil {
 		t.Fatalf("fail to attach netdev to namespace: %v", err)
 	}
@@ -135,6 +140,9 @@ func Test_nhNetdev(t *testing.T) {
 		if !strings.Contains(outputStr, fmt.Sprintf("gro_max_size %d", *config.GROMaxSize)) {
 			t.Errorf("GROMaxSize not changed %s", outputStr)
 		}
+		if !strings.Contains(outputStr, fmt.Sprintf("gso_max_segs %d", *config.GSOMaxSegments)) {
+			t.Errorf("GSOMaxSegments not changed %s", outputStr)
+		}
 		// require iproute 6.3.0+
 		// TODO: validate the ip version to check it
 		// https://github.com/iproute2/iproute2/commit/1dafe448c7a2f2be5dfddd8da250980708a48c41
@@ -173,9 +181,448 @@ func Test_nhNetdev(t *testing.T) {
 		}
 	}()
 
-	err = nsDetachNetdev(path.Join("/run/netns", nsName), config.Name, ifaceName)
+	err = nsDetachNetdev(path.Join("/run/netns", nsName), config.Name, ifaceName, nil)
+	if err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+
+}
+
+func Test_nsAttachNetdevNameCollision(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	// The interface already present in the Pod, e.g. created by the CNI plugin.
+	la := netlink.NewLinkAttrs()
+	la.Name = "dranet0"
+	if err := nhNs.LinkAdd(&netlink.Veth{LinkAttrs: la, PeerName: "dranet0-peer"}); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", la.Name, nsName, err)
+	}
+
+	ifaceName := fmt.Sprintf("veth%x", rndString)
+	la = netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  ifaceName + "p",
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s: %v", ifaceName, err)
+	}
+	t.Cleanup(func() {
+		link, err := nlwrap.LinkByName(ifaceName)
+		if err == nil {
+			_ = netlink.LinkDel(link)
+		}
+	})
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up veth link %s: %v", ifaceName, err)
+	}
+
+	_, _, err = nsAttachNetdev(ifaceName, path.Join("/run/netns", nsName), apis.InterfaceConfig{Name: "dranet0"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatalf("nsAttachNetdev() error = %v, want interface name already in use", err)
+	}
+
+	// The host interface must be left untouched.
+	hostLink, err := nlwrap.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("interface %s is not in the host namespace anymore: %v", ifaceName, err)
+	}
+	if hostLink.Attrs().Flags&net.FlagUp == 0 {
+		t.Errorf("interface %s was set down", ifaceName)
+	}
+}
+
+func Test_nsAttachNetdevBroadcast(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	ifaceName := fmt.Sprintf("veth%x", rndString)
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  ifaceName + "p",
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s: %v", ifaceName, err)
+	}
+	t.Cleanup(func() {
+		link, err := nlwrap.LinkByName(ifaceName + "p")
+		if err == nil {
+			_ = netlink.LinkDel(link)
+		}
+	})
+
+	interfaceConfig := apis.InterfaceConfig{
+		Name:       "dranet0",
+		Addresses:  []string{"192.168.70.10/24", "192.168.71.10/24"},
+		Broadcasts: map[string]string{"192.168.70.10/24": "192.168.70.127"},
+	}
+	if _, _, err := nsAttachNetdev(ifaceName, path.Join("/run/netns", nsName), interfaceConfig, nil); err != nil {
+		t.Fatalf("nsAttachNetdev() failed: %v", err)
+	}
+
+	out, err := exec.Command("ip", "netns", "exec", nsName, "ip", "-4", "addr", "show", "dev", "dranet0").CombinedOutput()
+	if err != nil {
+		t.Fatalf("ip addr show failed: %v, output: %s", err, out)
+	}
+	for _, want := range []string{
+		"inet 192.168.70.10/24 brd 192.168.70.127",
+		// the broadcast address of the subnet by default
+		"inet 192.168.71.10/24 brd 192.168.71.255",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("ip addr show = %s, want it to contain %q", out, want)
+		}
+	}
+}
+
+func Test_nsDetachNetdevUserAlias(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	nsPath := path.Join("/run/netns", nsName)
+
+	ifaceName := fmt.Sprintf("veth%x", rndString)
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  ifaceName + "p",
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s: %v", ifaceName, err)
+	}
+	t.Cleanup(func() {
+		for _, name := range []string{ifaceName, "dranet0"} {
+			if link, err := nlwrap.LinkByName(name); err == nil {
+				_ = netlink.LinkDel(link)
+			}
+		}
+	})
+	// The alias set by the user travels with the interface.
+	userAlias := "storage-uplink"
+	if err := netlink.LinkSetAlias(link, userAlias); err != nil {
+		t.Fatalf("Failed to set the alias of %s: %v", ifaceName, err)
+	}
+
+	// The interface is renamed in the Pod and restored with the original name
+	// stored in the PodConfig, not with its alias.
+	if _, _, err := nsAttachNetdev(ifaceName, nsPath, apis.InterfaceConfig{Name: "dranet0"}, nil); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+	if err := nsDetachNetdev(nsPath, "dranet0", ifaceName, nil); err != nil {
+		t.Fatalf("fail to detach netdev from namespace: %v", err)
+	}
+	hostLink, err := nlwrap.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("interface %s is not restored with its original name: %v", ifaceName, err)
+	}
+	if alias := hostLink.Attrs().Alias; alias != userAlias {
+		t.Errorf("alias of interface %s = %q, want %q", ifaceName, alias, userAlias)
+	}
+	if _, err := nlwrap.LinkByName(userAlias); err == nil {
+		t.Errorf("interface renamed to its alias %s", userAlias)
+	}
+
+	// Without the original name, the interface keeps the name it had in the Pod.
+	if _, _, err := nsAttachNetdev(ifaceName, nsPath, apis.InterfaceConfig{Name: "dranet0"}, nil); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+	if err := nsDetachNetdev(nsPath, "dranet0", "", nil); err != nil {
+		t.Fatalf("fail to detach netdev from namespace: %v", err)
+	}
+	if _, err := nlwrap.LinkByName("dranet0"); err != nil {
+		t.Errorf("interface dranet0 is not restored with its current name: %v", err)
+	}
+}
+
+func Test_nsDetachNetdevRestoresHostState(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	nsPath := path.Join("/run/netns", nsName)
+
+	ifaceName := fmt.Sprintf("veth%x", rndString)
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	la.MTU = 1500
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  ifaceName + "p",
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s: %v", ifaceName, err)
+	}
+	t.Cleanup(func() {
+		for _, name := range []string{ifaceName, "dranet0"} {
+			if link, err := nlwrap.LinkByName(name); err == nil {
+				_ = netlink.LinkDel(link)
+			}
+		}
+	})
+
+	hostState, err := getHostInterfaceState(ifaceName)
 	if err != nil {
+		t.Fatalf("getHostInterfaceState() failed: %v", err)
+	}
+	if hostState.MTU != 1500 {
+		t.Fatalf("host state MTU = %d, want 1500", hostState.MTU)
+	}
+
+	if hostState.HardwareAddr == "" {
+		t.Fatalf("host state has no hardware address")
+	}
+
+	// The driver applies the MTU and the hardware address of the claim and
+	// the pod changes the MTU again.
+	if _, _, err := nsAttachNetdev(ifaceName, nsPath, apis.InterfaceConfig{Name: "dranet0", MTU: ptr.To[int32](4000), HardwareAddr: ptr.To("02:00:00:00:00:aa")}, nil); err != nil {
 		t.Fatalf("fail to attach netdev to namespace: %v", err)
 	}
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	nsLink, err := nhNs.LinkByName("dranet0")
+	if err != nil {
+		t.Fatalf("interface dranet0 not found in ns %s: %v", nsName, err)
+	}
+	if err := nhNs.LinkSetMTU(nsLink, 9000); err != nil {
+		t.Fatalf("fail to set the MTU of dranet0 in ns %s: %v", nsName, err)
+	}
+	// Flip one of the changeable features, if the kernel reports them.
+	var feature string
+	for name := range hostState.EthtoolFeatures {
+		feature = name
+		break
+	}
+	if feature != "" {
+		client, err := newEthtoolClient(int(testNS))
+		if err != nil {
+			t.Fatalf("failed to create ethtool client in ns %s: %v", nsName, err)
+		}
+		defer client.Close()
+		if err := client.SetFeatures("dranet0", map[string]bool{feature: !hostState.EthtoolFeatures[feature]}); err != nil {
+			t.Logf("feature %s of dranet0 not changed: %v", feature, err)
+			feature = ""
+		}
+	}
 
+	if err := nsDetachNetdev(nsPath, "dranet0", ifaceName, hostState); err != nil {
+		t.Fatalf("fail to detach netdev from namespace: %v", err)
+	}
+	hostLink, err := nlwrap.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("interface %s is not restored in the host: %v", ifaceName, err)
+	}
+	if mtu := hostLink.Attrs().MTU; mtu != 1500 {
+		t.Errorf("host MTU of %s = %d, want 1500", ifaceName, mtu)
+	}
+	if hwAddr := hostLink.Attrs().HardwareAddr.String(); hwAddr != hostState.HardwareAddr {
+		t.Errorf("host hardware address of %s = %s, want %s", ifaceName, hwAddr, hostState.HardwareAddr)
+	}
+	if hostLink.Attrs().Flags&net.FlagUp == 0 {
+		t.Errorf("interface %s is not up", ifaceName)
+	}
+	if feature != "" {
+		restored, err := getHostInterfaceState(ifaceName)
+		if err != nil {
+			t.Fatalf("getHostInterfaceState() failed: %v", err)
+		}
+		if got, want := restored.EthtoolFeatures[feature], hostState.EthtoolFeatures[feature]; got != want {
+			t.Errorf("feature %s of %s = %v, want %v", feature, ifaceName, got, want)
+		}
+	}
+}
+
+func Test_offloadSizeMismatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		config apis.InterfaceConfig
+		attrs  netlink.LinkAttrs
+		want   []string
+	}{
+		{
+			name:   "nothing requested",
+			config: apis.InterfaceConfig{},
+			attrs:  netlink.LinkAttrs{GSOMaxSize: 65536, GROMaxSize: 65536},
+		},
+		{
+			name: "all applied",
+			config: apis.InterfaceConfig{
+				GSOMaxSize:     ptr.To[int32](196608),
+				GROMaxSize:     ptr.To[int32](196608),
+				GSOIPv4MaxSize: ptr.To[int32](196608),
+				GROIPv4MaxSize: ptr.To[int32](196608),
+				GSOMaxSegments: ptr.To[int32](128),
+			},
+			attrs: netlink.LinkAttrs{GSOMaxSize: 196608, GROMaxSize: 196608, GSOIPv4MaxSize: 196608, GROIPv4MaxSize: 196608, GSOMaxSegs: 128},
+		},
+		{
+			name: "kernel clamped gso and ignored gro ipv4",
+			config: apis.InterfaceConfig{
+				GSOMaxSize:     ptr.To[int32](196608),
+				GROMaxSize:     ptr.To[int32](65536),
+				GROIPv4MaxSize: ptr.To[int32](196608),
+				GSOMaxSegments: ptr.To[int32](128),
+			},
+			attrs: netlink.LinkAttrs{GSOMaxSize: 65536, GROMaxSize: 65536, GSOIPv4MaxSize: 65536, GROIPv4MaxSize: 65536, GSOMaxSegs: 64},
+			want: []string{
+				"gsoMaxSize requested 196608 effective 65536",
+				"groIPv4MaxSize requested 196608 effective 65536",
+				"gsoMaxSegments requested 128 effective 64",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := offloadSizeMismatches(tt.config, &tt.attrs)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("offloadSizeMismatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addressesToPreserve(t *testing.T) {
+	mustParseAddr := func(cidr string, scope int, flags int) netlink.Addr {
+		addr, err := netlink.ParseAddr(cidr)
+		if err != nil {
+			t.Fatalf("failed to parse address %s: %v", cidr, err)
+		}
+		addr.Scope = scope
+		addr.Flags = flags
+		return *addr
+	}
+
+	addresses := []netlink.Addr{
+		mustParseAddr("127.0.0.1/8", unix.RT_SCOPE_HOST, unix.IFA_F_PERMANENT),
+		mustParseAddr("10.0.0.2/24", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_PERMANENT),
+		mustParseAddr("10.0.0.3/24", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_PERMANENT|unix.IFA_F_SECONDARY),
+		mustParseAddr("169.254.1.1/16", unix.RT_SCOPE_LINK, unix.IFA_F_PERMANENT|unix.IFA_F_NOPREFIXROUTE),
+		mustParseAddr("2001:db8::2/64", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_PERMANENT|unix.IFA_F_NODAD),
+		mustParseAddr("fe80::1/64", unix.RT_SCOPE_LINK, unix.IFA_F_PERMANENT|unix.IFA_F_TENTATIVE),
+		mustParseAddr("::1/128", unix.RT_SCOPE_HOST, unix.IFA_F_PERMANENT),
+	}
+	// the broadcast address is only kept if it is not the one of the subnet
+	defaultBroadcast := mustParseAddr("10.1.0.2/24", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_PERMANENT)
+	defaultBroadcast.Broadcast = net.IPv4(10, 1, 0, 255).To4()
+	customBroadcast := mustParseAddr("10.2.0.2/24", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_PERMANENT)
+	customBroadcast.Broadcast = net.IPv4(10, 2, 0, 127).To4()
+	addresses = slices.Insert(addresses, 3, defaultBroadcast, customBroadcast)
+	want := []AddressConfig{
+		{Address: "10.0.0.2/24", Scope: unix.RT_SCOPE_UNIVERSE},
+		{Address: "10.0.0.3/24", Scope: unix.RT_SCOPE_UNIVERSE},
+		{Address: "10.1.0.2/24", Scope: unix.RT_SCOPE_UNIVERSE},
+		{Address: "10.2.0.2/24", Scope: unix.RT_SCOPE_UNIVERSE, Broadcast: "10.2.0.127"},
+		{Address: "169.254.1.1/16", Scope: unix.RT_SCOPE_LINK, Flags: unix.IFA_F_NOPREFIXROUTE},
+		{Address: "2001:db8::2/64", Scope: unix.RT_SCOPE_UNIVERSE, Flags: unix.IFA_F_NODAD},
+		{Address: "fe80::1/64", Scope: unix.RT_SCOPE_LINK},
+	}
+	if got := addressesToPreserve(addresses); !reflect.DeepEqual(got, want) {
+		t.Errorf("addressesToPreserve() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_withAddressBroadcasts(t *testing.T) {
+	preserved := []AddressConfig{
+		{Address: "10.0.0.2/24", Scope: unix.RT_SCOPE_UNIVERSE, Broadcast: "10.0.0.127"},
+		{Address: "169.254.1.1/16", Scope: unix.RT_SCOPE_LINK, Flags: unix.IFA_F_NOPREFIXROUTE},
+	}
+	broadcasts := map[string]string{
+		"169.254.1.1/16": "169.254.255.254",
+		"10.1.0.2/24":    "10.1.0.127",
+	}
+	want := []AddressConfig{
+		{Address: "10.0.0.2/24", Scope: unix.RT_SCOPE_UNIVERSE, Broadcast: "10.0.0.127"},
+		{Address: "169.254.1.1/16", Scope: unix.RT_SCOPE_LINK, Flags: unix.IFA_F_NOPREFIXROUTE, Broadcast: "169.254.255.254"},
+		{Address: "10.1.0.2/24", Broadcast: "10.1.0.127"},
+	}
+	if got := withAddressBroadcasts(preserved, broadcasts); !reflect.DeepEqual(got, want) {
+		t.Errorf("withAddressBroadcasts() = %+v, want %+v", got, want)
+	}
+	if preserved[1].Broadcast != "" {
+		t.Errorf("withAddressBroadcasts() modified the preserved addresses: %+v", preserved)
+	}
 }
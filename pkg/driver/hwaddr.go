@@ -0,0 +1,65 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+)
+
+const (
+	// macLocallyAdministered is the bit of the first octet of a MAC address
+	// set for the addresses not assigned by a manufacturer.
+	macLocallyAdministered = 0x02
+	// macMulticast is the bit of the first octet of a MAC address set for
+	// the group addresses.
+	macMulticast = 0x01
+)
+
+// generateHardwareAddr returns a locally administered unicast MAC address
+// derived from the Pod UID and the device name, the same Pod and device always
+// get the same address.
+func generateHardwareAddr(podUID types.UID, deviceName string) net.HardwareAddr {
+	sum := sha256.Sum256([]byte(string(podUID) + "/" + deviceName))
+	hwAddr := net.HardwareAddr(sum[:6])
+	hwAddr[0] = hwAddr[0]&^macMulticast | macLocallyAdministered
+	return hwAddr
+}
+
+// checkHardwareAddrUnique returns an error if the hardware address is used by
+// a link of the host other than ifName, or is configured for a device of a
+// Pod other than deviceName of podUID.
+func (np *NetworkDriver) checkHardwareAddrUnique(nlHandle nlwrap.Handle, hwAddr net.HardwareAddr, ifName string, podUID types.UID, deviceName string) error {
+	links, err := nlHandle.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list the links to check the hardware address %s: %w", hwAddr, err)
+	}
+	for _, link := range links {
+		if link.Attrs().Name != ifName && bytes.Equal(link.Attrs().HardwareAddr, hwAddr) {
+			return fmt.Errorf("hardware address %s of interface %s is already used by interface %s", hwAddr, ifName, link.Attrs().Name)
+		}
+	}
+	if owner, ok := np.podConfigStore.HardwareAddrOwner(hwAddr, podUID, deviceName); ok {
+		return fmt.Errorf("hardware address %s of interface %s is already used by device %s", hwAddr, ifName, owner)
+	}
+	return nil
+}
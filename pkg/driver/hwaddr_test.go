@@ -0,0 +1,103 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func Test_generateHardwareAddr(t *testing.T) {
+	seen := map[string]string{}
+	for i := range 100 {
+		podUID := types.UID(fmt.Sprintf("8f2c7a4e-0000-4000-8000-%012d", i))
+		for _, device := range []string{"eth1", "eth2"} {
+			hwAddr := generateHardwareAddr(podUID, device)
+			if len(hwAddr) != 6 {
+				t.Fatalf("generateHardwareAddr(%s, %s) = %s, want 6 octets", podUID, device, hwAddr)
+			}
+			if hwAddr[0]&macLocallyAdministered == 0 {
+				t.Errorf("generateHardwareAddr(%s, %s) = %s, want the locally administered bit set", podUID, device, hwAddr)
+			}
+			if hwAddr[0]&macMulticast != 0 {
+				t.Errorf("generateHardwareAddr(%s, %s) = %s, want a unicast address", podUID, device, hwAddr)
+			}
+			if again := generateHardwareAddr(podUID, device); again.String() != hwAddr.String() {
+				t.Errorf("generateHardwareAddr(%s, %s) = %s then %s, want the same address", podUID, device, hwAddr, again)
+			}
+			key := string(podUID) + "/" + device
+			if other, ok := seen[hwAddr.String()]; ok {
+				t.Errorf("generateHardwareAddr(%s) = %s, same address as %s", key, hwAddr, other)
+			}
+			seen[hwAddr.String()] = key
+		}
+	}
+}
+
+func Test_checkHardwareAddrUnique(t *testing.T) {
+	nlHandle, err := nlwrap.NewHandle()
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nlHandle.Close()
+
+	podUID := types.UID("pod-a")
+	hwAddr := generateHardwareAddr(podUID, "eth1")
+	np := &NetworkDriver{podConfigStore: mustNewPodConfigStore()}
+	deviceConfig := DeviceConfig{
+		NetworkInterfaceConfigInPod: apis.NetworkConfig{
+			Interface: apis.InterfaceConfig{Name: "eth1", HardwareAddr: ptr.To(strings.ToUpper(hwAddr.String()))},
+		},
+	}
+	if err := np.podConfigStore.SetDeviceConfig(podUID, "eth1", deviceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	// the device is prepared again for the same Pod
+	if err := np.checkHardwareAddrUnique(nlHandle, hwAddr, "eth1", podUID, "eth1"); err != nil {
+		t.Errorf("checkHardwareAddrUnique() for the same device = %v, want no error", err)
+	}
+	err = np.checkHardwareAddrUnique(nlHandle, hwAddr, "eth2", "pod-b", "eth2")
+	if err == nil || !strings.Contains(err.Error(), "eth1 of pod pod-a") {
+		t.Errorf("checkHardwareAddrUnique() for another Pod = %v, want an error for device eth1 of pod pod-a", err)
+	}
+
+	// the loopback has an all zeros address
+	links, err := nlHandle.LinkList()
+	if err != nil {
+		t.Fatalf("fail to list the links: %v", err)
+	}
+	for _, link := range links {
+		if link.Attrs().Name != "lo" {
+			continue
+		}
+		err := np.checkHardwareAddrUnique(nlHandle, link.Attrs().HardwareAddr, "eth2", "pod-b", "eth2")
+		if err == nil || !strings.Contains(err.Error(), "interface lo") {
+			t.Errorf("checkHardwareAddrUnique() with the address of lo = %v, want an error for interface lo", err)
+		}
+	}
+	if err := np.checkHardwareAddrUnique(nlHandle, net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}, "eth2", "pod-b", "eth2"); err != nil {
+		t.Errorf("checkHardwareAddrUnique() with an unused address = %v, want no error", err)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net/netip"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/dranet/pkg/ipam"
+)
+
+// allocateIPAMAddress returns the address of the device of the claim from the
+// IPAM pool. If the claim status already reports an address of the pool for
+// the device, the claim was prepared before a restart of the driver and the
+// same address is kept instead of allocating a new one.
+func (np *NetworkDriver) allocateIPAMAddress(claim *resourceapi.ResourceClaim, device string, poolName string) (string, error) {
+	if np.ipam == nil {
+		return "", fmt.Errorf("IPAM pool %q requested but no IPAM pools are configured", poolName)
+	}
+	owner := ipam.Owner{
+		Claim:  types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+		Device: device,
+	}
+	for _, status := range claim.Status.Devices {
+		if status.Driver != np.driverName || status.Device != device || status.NetworkData == nil {
+			continue
+		}
+		for _, ip := range status.NetworkData.IPs {
+			prefix, err := netip.ParsePrefix(ip)
+			if err != nil {
+				continue
+			}
+			if err := np.ipam.Reserve(poolName, owner, prefix.Addr()); err != nil {
+				klog.V(4).Infof("not reusing address %s of claim %s/%s status: %v", ip, claim.Namespace, claim.Name, err)
+				continue
+			}
+			klog.V(2).Infof("reusing address %s of IPAM pool %s from claim %s/%s status", ip, poolName, claim.Namespace, claim.Name)
+		}
+	}
+	prefix, err := np.ipam.Allocate(poolName, owner)
+	if err != nil {
+		return "", err
+	}
+	return prefix.String(), nil
+}
+
+// reconcileIPAM reserves the addresses of the IPAM pools already assigned to
+// the devices in the pod config store, so they are not allocated twice after
+// the driver restarts.
+func (np *NetworkDriver) reconcileIPAM() {
+	if np.ipam == nil {
+		return
+	}
+	for _, podUID := range np.podConfigStore.ListPods() {
+		podCfg, ok := np.podConfigStore.GetPodConfig(podUID)
+		if !ok {
+			continue
+		}
+		for deviceName, devCfg := range podCfg.DeviceConfigs {
+			poolName := devCfg.NetworkInterfaceConfigInPod.Interface.IPAMPool
+			if poolName == nil {
+				continue
+			}
+			owner := ipam.Owner{Claim: devCfg.Claim, Device: deviceName}
+			for _, address := range devCfg.NetworkInterfaceConfigInPod.Interface.Addresses {
+				prefix, err := netip.ParsePrefix(address)
+				if err != nil {
+					continue
+				}
+				if err := np.ipam.Reserve(*poolName, owner, prefix.Addr()); err != nil {
+					klog.Errorf("failed to reconcile address %s of IPAM pool %s for claim %s device %s: %v", address, *poolName, devCfg.Claim, deviceName, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/pkg/apis"
+	"sigs.k8s.io/dranet/pkg/ipam"
+)
+
+func newTestIPAM(t *testing.T, pools string) *ipam.Allocator {
+	t.Helper()
+	prefixes, err := ipam.ParsePools(pools)
+	if err != nil {
+		t.Fatalf("failed to parse pools %q: %v", pools, err)
+	}
+	return ipam.NewAllocator(prefixes)
+}
+
+func TestAllocateIPAMAddress(t *testing.T) {
+	claim := func(name string, statusIPs ...string) *resourceapi.ResourceClaim {
+		c := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"}}
+		if len(statusIPs) > 0 {
+			c.Status.Devices = []resourceapi.AllocatedDeviceStatus{{
+				Driver:      "dra.net",
+				Device:      "eth1",
+				NetworkData: &resourceapi.NetworkDeviceData{IPs: statusIPs},
+			}}
+		}
+		return c
+	}
+
+	t.Run("no ipam configured", func(t *testing.T) {
+		np := &NetworkDriver{driverName: "dra.net"}
+		if _, err := np.allocateIPAMAddress(claim("a"), "eth1", "storage"); err == nil {
+			t.Errorf("allocateIPAMAddress() expected to fail without IPAM pools")
+		}
+	})
+
+	t.Run("allocates and keeps the address from the claim status", func(t *testing.T) {
+		np := &NetworkDriver{driverName: "dra.net", ipam: newTestIPAM(t, "storage=10.0.0.0/24")}
+		// claim b was prepared before a restart and got the .5 address
+		got, err := np.allocateIPAMAddress(claim("b", "10.0.0.5/24", "fd00::5/64"), "eth1", "storage")
+		if err != nil {
+			t.Fatalf("allocateIPAMAddress() failed: %v", err)
+		}
+		if got != "10.0.0.5/24" {
+			t.Errorf("allocateIPAMAddress() = %s, want 10.0.0.5/24", got)
+		}
+		got, err = np.allocateIPAMAddress(claim("a"), "eth1", "storage")
+		if err != nil {
+			t.Fatalf("allocateIPAMAddress() failed: %v", err)
+		}
+		if got != "10.0.0.1/24" {
+			t.Errorf("allocateIPAMAddress() = %s, want 10.0.0.1/24", got)
+		}
+		// claim c reports an address already taken by claim a, it gets a new one
+		got, err = np.allocateIPAMAddress(claim("c", "10.0.0.1/24"), "eth1", "storage")
+		if err != nil {
+			t.Fatalf("allocateIPAMAddress() failed: %v", err)
+		}
+		if got != "10.0.0.2/24" {
+			t.Errorf("allocateIPAMAddress() = %s, want 10.0.0.2/24", got)
+		}
+	})
+}
+
+func TestReconcileIPAM(t *testing.T) {
+	np := &NetworkDriver{
+		driverName:     "dra.net",
+		podConfigStore: mustNewPodConfigStore(),
+		ipam:           newTestIPAM(t, "storage=10.0.0.0/30"),
+	}
+	claimName := types.NamespacedName{Namespace: "ns", Name: "existing"}
+	err := np.podConfigStore.SetDeviceConfig("pod-uid-1", "eth1", DeviceConfig{
+		Claim: claimName,
+		NetworkInterfaceConfigInPod: apis.NetworkConfig{
+			Interface: apis.InterfaceConfig{
+				IPAMPool:  ptr.To("storage"),
+				Addresses: []string{"10.0.0.1/30"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetDeviceConfig() failed: %v", err)
+	}
+
+	np.reconcileIPAM()
+
+	owner := ipam.Owner{Claim: types.NamespacedName{Namespace: "ns", Name: "new"}, Device: "eth1"}
+	got, err := np.ipam.Allocate("storage", owner)
+	if err != nil {
+		t.Fatalf("Allocate() failed: %v", err)
+	}
+	if want := netip.MustParsePrefix("10.0.0.2/30"); got != want {
+		t.Errorf("Allocate() = %s, want %s", got, want)
+	}
+
+	// Unpreparing the existing claim frees its address.
+	_, err = np.unprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{NamespacedName: claimName, UID: "claim-uid"}})
+	if err != nil {
+		t.Fatalf("unprepareResourceClaims() failed: %v", err)
+	}
+	owner.Claim.Name = "other"
+	got, err = np.ipam.Allocate("storage", owner)
+	if err != nil {
+		t.Fatalf("Allocate() after unprepare failed: %v", err)
+	}
+	if want := netip.MustParsePrefix("10.0.0.1/30"); got != want {
+		t.Errorf("Allocate() after unprepare = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Each PCI device has its NUMA node in <address>/numa_node (-1 if the
+	// platform does not report it) and one entry per MSI/MSI-X vector in
+	// <address>/msi_irqs named after the IRQ number.
+	// https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-bus-pci
+	sysbusPCIPath = "/sys/bus/pci/devices"
+	// The CPUs of each NUMA node are in node<N>/cpulist.
+	// https://www.kernel.org/doc/Documentation/ABI/stable/sysfs-devices-node
+	sysNodePath = "/sys/devices/system/node"
+	// The CPUs an IRQ can be delivered to are in <irq>/smp_affinity_list.
+	// https://www.kernel.org/doc/html/latest/core-api/irq/irq-affinity.html
+	procIRQPath = "/proc/irq"
+)
+
+// numaNodeCPUList returns the NUMA node of the PCI device and the list of its
+// CPUs in the kernel cpulist format, e.g. "0-15,32-47".
+func numaNodeCPUList(pciPath, nodePath, pciAddress string) (int, string, error) {
+	data, err := os.ReadFile(filepath.Join(pciPath, pciAddress, "numa_node"))
+	if err != nil {
+		return -1, "", fmt.Errorf("failed to get the NUMA node of PCI device %s: %w", pciAddress, err)
+	}
+	node, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1, "", fmt.Errorf("invalid NUMA node %q for PCI device %s: %w", strings.TrimSpace(string(data)), pciAddress, err)
+	}
+	if node < 0 {
+		return -1, "", fmt.Errorf("PCI device %s is not attached to a NUMA node", pciAddress)
+	}
+	data, err = os.ReadFile(filepath.Join(nodePath, fmt.Sprintf("node%d", node), "cpulist"))
+	if err != nil {
+		return -1, "", fmt.Errorf("NUMA node %d of PCI device %s not found: %w", node, pciAddress, err)
+	}
+	cpuList := strings.TrimSpace(string(data))
+	if cpuList == "" {
+		return -1, "", fmt.Errorf("NUMA node %d of PCI device %s has no CPUs", node, pciAddress)
+	}
+	return node, cpuList, nil
+}
+
+// deviceMSIIRQs returns the sorted IRQ numbers of the MSI/MSI-X vectors of the
+// PCI device.
+func deviceMSIIRQs(pciPath, pciAddress string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(pciPath, pciAddress, "msi_irqs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the MSI IRQs of PCI device %s: %w", pciAddress, err)
+	}
+	var irqs []int
+	for _, entry := range entries {
+		irq, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		irqs = append(irqs, irq)
+	}
+	if len(irqs) == 0 {
+		return nil, fmt.Errorf("PCI device %s has no MSI IRQs", pciAddress)
+	}
+	slices.Sort(irqs)
+	return irqs, nil
+}
+
+// setIRQAffinity writes the CPU list to the affinity of each IRQ. The IRQs
+// whose affinity is managed by the kernel reject the change with EIO and are
+// skipped, so a driver spreading its queues over all the CPUs is left as is.
+func setIRQAffinity(irqPath string, irqs []int, cpuList string) (int, error) {
+	var errorList []error
+	updated := 0
+	for _, irq := range irqs {
+		err := os.WriteFile(filepath.Join(irqPath, strconv.Itoa(irq), "smp_affinity_list"), []byte(cpuList), 0644)
+		if errors.Is(err, syscall.EIO) {
+			klog.V(4).Infof("skipping kernel managed IRQ %d affinity", irq)
+			continue
+		}
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to set IRQ %d affinity to CPUs %s: %w", irq, cpuList, err))
+			continue
+		}
+		updated++
+	}
+	return updated, errors.Join(errorList...)
+}
+
+// applyNUMAIRQAffinity pins the MSI/MSI-X vectors of the PCI device to the
+// CPUs of its NUMA node. The IRQ affinity is global, it is set from the host
+// and kept when the device is released.
+func applyNUMAIRQAffinity(pciAddress string) error {
+	node, cpuList, err := numaNodeCPUList(sysbusPCIPath, sysNodePath, pciAddress)
+	if err != nil {
+		return err
+	}
+	irqs, err := deviceMSIIRQs(sysbusPCIPath, pciAddress)
+	if err != nil {
+		return err
+	}
+	updated, err := setIRQAffinity(procIRQPath, irqs, cpuList)
+	klog.V(2).Infof("set the affinity of %d/%d IRQs of PCI device %s to NUMA node %d CPUs %s", updated, len(irqs), pciAddress, node, cpuList)
+	return err
+}
@@ -0,0 +1,156 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_numaNodeCPUList(t *testing.T) {
+	const pciAddress = "0000:8e:00.0"
+	tests := []struct {
+		name        string
+		numaNode    string
+		nodes       map[string]string
+		wantNode    int
+		wantCPUList string
+		wantErr     bool
+	}{
+		{
+			name:        "node 1",
+			numaNode:    "1\n",
+			nodes:       map[string]string{"node0": "0-15,32-47\n", "node1": "16-31,48-63\n"},
+			wantNode:    1,
+			wantCPUList: "16-31,48-63",
+		},
+		{
+			name:     "no NUMA node reported",
+			numaNode: "-1\n",
+			nodes:    map[string]string{"node0": "0-15\n"},
+			wantErr:  true,
+		},
+		{
+			name:     "node does not exist",
+			numaNode: "2\n",
+			nodes:    map[string]string{"node0": "0-15\n"},
+			wantErr:  true,
+		},
+		{
+			name:     "node without CPUs",
+			numaNode: "1\n",
+			nodes:    map[string]string{"node0": "0-15\n", "node1": "\n"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid NUMA node",
+			numaNode: "foo\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pciPath := t.TempDir()
+			nodePath := t.TempDir()
+			writeTestFile(t, filepath.Join(pciPath, pciAddress, "numa_node"), tt.numaNode)
+			for node, cpuList := range tt.nodes {
+				writeTestFile(t, filepath.Join(nodePath, node, "cpulist"), cpuList)
+			}
+			node, cpuList, err := numaNodeCPUList(pciPath, nodePath, pciAddress)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("numaNodeCPUList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if node != tt.wantNode || cpuList != tt.wantCPUList {
+				t.Errorf("numaNodeCPUList() = %d, %q, want %d, %q", node, cpuList, tt.wantNode, tt.wantCPUList)
+			}
+		})
+	}
+}
+
+func Test_deviceMSIIRQs(t *testing.T) {
+	const pciAddress = "0000:8e:00.0"
+	pciPath := t.TempDir()
+	for _, irq := range []string{"130", "16", "129"} {
+		writeTestFile(t, filepath.Join(pciPath, pciAddress, "msi_irqs", irq), "msix\n")
+	}
+	got, err := deviceMSIIRQs(pciPath, pciAddress)
+	if err != nil {
+		t.Fatalf("deviceMSIIRQs() error = %v", err)
+	}
+	if want := []int{16, 129, 130}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deviceMSIIRQs() = %v, want %v", got, want)
+	}
+
+	if err := os.MkdirAll(filepath.Join(pciPath, "0000:8f:00.0", "msi_irqs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deviceMSIIRQs(pciPath, "0000:8f:00.0"); err == nil {
+		t.Errorf("deviceMSIIRQs() without MSI IRQs succeeded, want error")
+	}
+	if _, err := deviceMSIIRQs(pciPath, "0000:90:00.0"); err == nil {
+		t.Errorf("deviceMSIIRQs() of a missing device succeeded, want error")
+	}
+}
+
+func Test_setIRQAffinity(t *testing.T) {
+	irqPath := t.TempDir()
+	for _, irq := range []int{129, 130} {
+		writeTestFile(t, filepath.Join(irqPath, strconv.Itoa(irq), "smp_affinity_list"), "0-63\n")
+	}
+
+	updated, err := setIRQAffinity(irqPath, []int{129, 130}, "16-31")
+	if err != nil {
+		t.Fatalf("setIRQAffinity() error = %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("setIRQAffinity() updated %d IRQs, want 2", updated)
+	}
+	for _, irq := range []int{129, 130} {
+		data, err := os.ReadFile(filepath.Join(irqPath, strconv.Itoa(irq), "smp_affinity_list"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "16-31" {
+			t.Errorf("IRQ %d affinity = %q, want %q", irq, data, "16-31")
+		}
+	}
+
+	// The IRQ 131 does not exist.
+	updated, err = setIRQAffinity(irqPath, []int{129, 131}, "0-15")
+	if err == nil {
+		t.Errorf("setIRQAffinity() of a missing IRQ succeeded, want error")
+	}
+	if updated != 1 {
+		t.Errorf("setIRQAffinity() updated %d IRQs, want 1", updated)
+	}
+}
@@ -35,6 +35,7 @@ const (
 	methodStopPodSandbox          = "StopPodSandbox"
 	methodRemovePodSandbox        = "RemovePodSandbox"
 	methodCreateContainer         = "CreateContainer"
+	methodPostUpdateContainer     = "PostUpdateContainer"
 )
 
 var registerMetricsOnce sync.Once
@@ -46,7 +47,10 @@ func registerMetrics() {
 		prometheus.MustRegister(nriPluginRequestsTotal)
 		prometheus.MustRegister(nriPluginRequestsLatencySeconds)
 		prometheus.MustRegister(publishedDevicesTotal)
+		prometheus.MustRegister(devicesFilteredTotal)
 		prometheus.MustRegister(lastPublishedTime)
+		prometheus.MustRegister(claimStatusUpdateFailuresTotal)
+		prometheus.MustRegister(networkDriftTotal)
 	})
 }
 
@@ -81,10 +85,28 @@ var (
 		Name:      "published_devices_total",
 		Help:      "Total number of published devices.",
 	}, []string{"feature"})
+	devicesFilteredTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dranet",
+		Subsystem: "driver",
+		Name:      "devices_filtered_total",
+		Help:      "Number of devices discovered and published after the filter, the difference is the number of devices filtered out.",
+	}, []string{"state"})
 	lastPublishedTime = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "dranet",
 		Subsystem: "driver",
 		Name:      "last_published_time_seconds",
 		Help:      "The timestamp of the last successful resource publication.",
 	})
+	claimStatusUpdateFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "dranet",
+		Subsystem: "driver",
+		Name:      "claim_status_update_failures_total",
+		Help:      "Total number of ResourceClaim status updates that failed after all the retries.",
+	})
+	networkDriftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dranet",
+		Subsystem: "driver",
+		Name:      "network_drift_total",
+		Help:      "Total number of pod interfaces found drifted from their configuration.",
+	}, []string{"reason"})
 )
@@ -0,0 +1,112 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/utils/ptr"
+)
+
+// The link-layer overhead in bytes of the encapsulations, the headers the
+// parent interface adds to the packets of a tunnel interface. The tunnels are
+// counted with an IPv4 outer header and without their optional fields, e.g.
+// the GRE keys.
+const (
+	// vxlanOverhead is the outer IPv4, UDP and VXLAN headers and the inner
+	// Ethernet header.
+	vxlanOverhead = 20 + 8 + 8 + 14
+	// greOverhead is the outer IPv4 and GRE headers.
+	greOverhead = 20 + 4
+	// gretapOverhead is the GRE overhead and the inner Ethernet header.
+	gretapOverhead = greOverhead + 14
+	// ipipOverhead is the outer IPv4 header of the IPIP and SIT tunnels.
+	ipipOverhead = 20
+	// ip6tnlOverhead is the outer IPv6 header.
+	ip6tnlOverhead = 40
+	// ipv6OuterOverhead is the difference between an outer IPv6 and IPv4
+	// header.
+	ipv6OuterOverhead = 40 - 20
+)
+
+// outerIPv6Overhead returns the additional overhead of an outer IPv6 header
+// if the tunnel endpoint is an IPv6 address.
+func outerIPv6Overhead(ip net.IP) int {
+	if ip != nil && ip.To4() == nil {
+		return ipv6OuterOverhead
+	}
+	return 0
+}
+
+// linkEncapsulation returns the index of the parent interface of a VLAN or
+// tunnel interface and the overhead of its encapsulation. The parent index is
+// zero if the interface has no encapsulation or its parent is not fixed, e.g.
+// a tunnel whose packets are routed.
+func linkEncapsulation(link netlink.Link) (parentIndex int, overhead int) {
+	switch l := link.(type) {
+	case *netlink.Vlan:
+		// The 802.1Q tag is not counted in the MTU, a VLAN interface has the
+		// MTU of its parent by default.
+		return l.ParentIndex, 0
+	case *netlink.Vxlan:
+		remote := l.Group
+		if remote == nil {
+			remote = l.SrcAddr
+		}
+		return l.VtepDevIndex, vxlanOverhead + outerIPv6Overhead(remote)
+	case *netlink.Gretap:
+		return int(l.Link), gretapOverhead + outerIPv6Overhead(l.Remote)
+	case *netlink.Gretun:
+		return int(l.Link), greOverhead + outerIPv6Overhead(l.Remote)
+	case *netlink.Iptun:
+		return int(l.Link), ipipOverhead
+	case *netlink.Sittun:
+		return int(l.Link), ipipOverhead
+	case *netlink.Ip6tnl:
+		return int(l.Link), ip6tnlOverhead
+	}
+	return 0, 0
+}
+
+// maxChildMTU returns the largest MTU of an interface whose packets are sent
+// by a parent with that MTU after adding overhead bytes of headers.
+func maxChildMTU(parentMTU, overhead int) int {
+	return parentMTU - overhead
+}
+
+// childMTU returns the MTU of a VLAN or tunnel interface ifName, whose
+// current MTU is currentMTU, on top of parentName. A requested MTU is kept,
+// but an error is returned if it exceeds the parent MTU minus the overhead,
+// the larger packets would be dropped or fragmented by the parent. Without a
+// requested MTU, the MTU is derived from the parent, lowered to the maximum if
+// the current one exceeds it; nil keeps the current MTU.
+func childMTU(ifName, parentName string, requested *int32, currentMTU, parentMTU, overhead int) (*int32, error) {
+	maxMTU := maxChildMTU(parentMTU, overhead)
+	if requested != nil {
+		if int(*requested) > maxMTU {
+			return requested, fmt.Errorf("requested MTU %d for interface %s exceeds the MTU %d of its parent %s minus the %d bytes of encapsulation overhead, the maximum is %d",
+				*requested, ifName, parentMTU, parentName, overhead, maxMTU)
+		}
+		return requested, nil
+	}
+	if currentMTU > maxMTU && maxMTU > 0 {
+		return ptr.To(int32(maxMTU)), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/utils/ptr"
+)
+
+func Test_linkEncapsulation(t *testing.T) {
+	tests := []struct {
+		name            string
+		link            netlink.Link
+		wantParentIndex int
+		wantOverhead    int
+	}{
+		{
+			name:            "vlan",
+			link:            &netlink.Vlan{LinkAttrs: netlink.LinkAttrs{ParentIndex: 2}, VlanId: 100},
+			wantParentIndex: 2,
+		},
+		{
+			name:            "vxlan over ipv4",
+			link:            &netlink.Vxlan{VtepDevIndex: 3, Group: net.ParseIP("239.1.1.1")},
+			wantParentIndex: 3,
+			wantOverhead:    50,
+		},
+		{
+			name:            "vxlan over ipv6",
+			link:            &netlink.Vxlan{VtepDevIndex: 3, SrcAddr: net.ParseIP("2001:db8::1")},
+			wantParentIndex: 3,
+			wantOverhead:    70,
+		},
+		{
+			name:         "vxlan without device",
+			link:         &netlink.Vxlan{Group: net.ParseIP("239.1.1.1")},
+			wantOverhead: 50,
+		},
+		{
+			name:            "gretap",
+			link:            &netlink.Gretap{Link: 4, Remote: net.ParseIP("192.168.1.2")},
+			wantParentIndex: 4,
+			wantOverhead:    38,
+		},
+		{
+			name:            "gre over ipv6",
+			link:            &netlink.Gretun{Link: 4, Remote: net.ParseIP("2001:db8::2")},
+			wantParentIndex: 4,
+			wantOverhead:    44,
+		},
+		{
+			name:            "ipip",
+			link:            &netlink.Iptun{Link: 5},
+			wantParentIndex: 5,
+			wantOverhead:    20,
+		},
+		{
+			name:            "sit",
+			link:            &netlink.Sittun{Link: 5},
+			wantParentIndex: 5,
+			wantOverhead:    20,
+		},
+		{
+			name:            "ip6tnl",
+			link:            &netlink.Ip6tnl{Link: 5},
+			wantParentIndex: 5,
+			wantOverhead:    40,
+		},
+		{
+			name: "macvlan",
+			link: &netlink.Macvlan{LinkAttrs: netlink.LinkAttrs{ParentIndex: 2}},
+		},
+		{
+			name: "physical",
+			link: &netlink.Device{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parentIndex, overhead := linkEncapsulation(tt.link)
+			if parentIndex != tt.wantParentIndex || overhead != tt.wantOverhead {
+				t.Errorf("linkEncapsulation() = %d, %d, want %d, %d", parentIndex, overhead, tt.wantParentIndex, tt.wantOverhead)
+			}
+		})
+	}
+}
+
+func Test_maxChildMTU(t *testing.T) {
+	tests := []struct {
+		parentMTU int
+		overhead  int
+		want      int
+	}{
+		{parentMTU: 1500, want: 1500},
+		{parentMTU: 9000, overhead: vxlanOverhead, want: 8950},
+		{parentMTU: 1500, overhead: vxlanOverhead, want: 1450},
+		{parentMTU: 1500, overhead: vxlanOverhead + ipv6OuterOverhead, want: 1430},
+		{parentMTU: 1500, overhead: greOverhead, want: 1476},
+		{parentMTU: 1500, overhead: gretapOverhead, want: 1462},
+		{parentMTU: 1500, overhead: ipipOverhead, want: 1480},
+		{parentMTU: 1500, overhead: ip6tnlOverhead, want: 1460},
+	}
+	for _, tt := range tests {
+		if got := maxChildMTU(tt.parentMTU, tt.overhead); got != tt.want {
+			t.Errorf("maxChildMTU(%d, %d) = %d, want %d", tt.parentMTU, tt.overhead, got, tt.want)
+		}
+	}
+}
+
+func Test_childMTU(t *testing.T) {
+	tests := []struct {
+		name       string
+		requested  *int32
+		currentMTU int
+		parentMTU  int
+		overhead   int
+		want       *int32
+		wantErr    bool
+	}{
+		{
+			name:       "requested within the parent",
+			requested:  ptr.To[int32](1450),
+			currentMTU: 1500,
+			parentMTU:  1500,
+			overhead:   vxlanOverhead,
+			want:       ptr.To[int32](1450),
+		},
+		{
+			name:       "requested exceeds the parent minus the overhead",
+			requested:  ptr.To[int32](1500),
+			currentMTU: 1500,
+			parentMTU:  1500,
+			overhead:   vxlanOverhead,
+			want:       ptr.To[int32](1500),
+			wantErr:    true,
+		},
+		{
+			name:       "vlan with the parent MTU",
+			currentMTU: 1500,
+			parentMTU:  1500,
+		},
+		{
+			name:       "vlan requested exceeds the parent",
+			requested:  ptr.To[int32](9000),
+			currentMTU: 1500,
+			parentMTU:  1500,
+			want:       ptr.To[int32](9000),
+			wantErr:    true,
+		},
+		{
+			name:       "derived from the parent",
+			currentMTU: 1500,
+			parentMTU:  1500,
+			overhead:   vxlanOverhead,
+			want:       ptr.To[int32](1450),
+		},
+		{
+			name:       "current fits the parent",
+			currentMTU: 1400,
+			parentMTU:  1500,
+			overhead:   vxlanOverhead,
+		},
+		{
+			name:       "jumbo parent",
+			currentMTU: 9000,
+			parentMTU:  9000,
+			overhead:   greOverhead,
+			want:       ptr.To[int32](8976),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := childMTU("eth1.100", "eth1", tt.requested, tt.currentMTU, tt.parentMTU, tt.overhead)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("childMTU() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("childMTU() = %v, want %v", ptr.Deref(got, 0), ptr.Deref(tt.want, 0))
+			}
+		})
+	}
+}
@@ -17,27 +17,45 @@ limitations under the License.
 package driver
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"runtime"
 	"slices"
 	"syscall"
+	"time"
 
 	"sigs.k8s.io/dranet/internal/nlwrap"
 	"sigs.k8s.io/dranet/pkg/apis"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/component-helpers/node/util/sysctl"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 )
 
-func applyRoutingConfig(containerNsPAth string, ifName string, routeConfig []apis.RouteConfig, vrfTable int) error {
+// sourceAddressTimeout bounds the wait for the Duplicate Address Detection of
+// an IPv6 address used as a route source.
+var sourceAddressTimeout = 5 * time.Second
+
+// routeProtocolDranet is the routing protocol identifier of the routes added
+// by dranet, unless the route sets its own. Adding `200 dranet` to
+// /etc/iproute2/rt_protos makes `ip route show proto dranet` work.
+const routeProtocolDranet = 200
+
+// applyRoutingConfig adds the routes of the interface in the namespace. It
+// returns the default routes skipped because the table already has a default
+// route through another interface.
+func applyRoutingConfig(containerNsPAth string, ifName string, routeConfig []apis.RouteConfig, vrfTable int) ([]string, error) {
 	containerNs, err := netns.GetFromPath(containerNsPAth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer containerNs.Close()
 
@@ -45,15 +63,16 @@ func applyRoutingConfig(containerNsPAth string, ifName string, routeConfig []api
 	// namespace and use it directly
 	nhNs, err := nlwrap.NewHandleAt(containerNs)
 	if err != nil {
-		return fmt.Errorf("can not get netlink handle: %v", err)
+		return nil, fmt.Errorf("can not get netlink handle: %v", err)
 	}
 	defer nhNs.Close()
 
 	nsLink, err := nhNs.LinkByName(ifName)
 	if err != nil {
-		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPAth, err)
+		return nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPAth, err)
 	}
 
+	var skipped []string
 	errorList := []error{}
 	// Sort routes to process link-local routes before universe routes.
 	// This is important because universe routes might depend on link-local ones.
@@ -81,6 +100,10 @@ func applyRoutingConfig(containerNsPAth string, ifName string, routeConfig []api
 			LinkIndex: nsLink.Attrs().Index,
 			Scope:     netlink.Scope(route.Scope),
 			Table:     table,
+			Protocol:  routeProtocolDranet,
+		}
+		if route.Protocol != nil {
+			r.Protocol = netlink.RouteProtocol(*route.Protocol)
 		}
 
 		_, dst, err := net.ParseCIDR(route.Destination)
@@ -89,18 +112,234 @@ func applyRoutingConfig(containerNsPAth string, ifName string, routeConfig []api
 			continue
 		}
 		r.Dst = dst
-		r.Gw = net.ParseIP(route.Gateway)
+		r.Family = routeFamily(dst)
+		r.Gw, err = routeGateway(route.Gateway, dst)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("fail to add route to %s for interface %s on namespace %s: %w", route.Destination, ifName, containerNsPAth, err))
+			continue
+		}
+		if route.Metric != nil {
+			r.Priority = *route.Metric
+		} else if isDefaultDestination(dst) {
+			// The default routes of several interfaces clobber each other,
+			// without a metric to tell them apart keep the existing one.
+			existing, err := nhNs.RouteListFiltered(routeFamily(dst), &netlink.Route{Table: routeTable(table)}, netlink.RT_FILTER_TABLE)
+			if err != nil {
+				errorList = append(errorList, fmt.Errorf("fail to list the routes of table %d on namespace %s: %w", routeTable(table), containerNsPAth, err))
+				continue
+			}
+			if other := otherDefaultRoute(existing, nsLink.Attrs().Index); other != nil {
+				klog.Warningf("skipping default route %s for interface %s on namespace %s, the table already has the default route %s", r.String(), ifName, containerNsPAth, other.String())
+				skipped = append(skipped, fmt.Sprintf("%s via %s", route.Destination, route.Gateway))
+				continue
+			}
+		}
 		if route.Source != "" {
 			r.Src = net.ParseIP(route.Source)
+			// The kernel rejects an IPv6 source address while it is tentative.
+			if r.Src.To4() == nil {
+				if err := waitForSourceAddress(nhNs, nsLink, r.Src); err != nil {
+					errorList = append(errorList, fmt.Errorf("fail to add route %s for interface %s on namespace %s: %w", r.String(), ifName, containerNsPAth, err))
+					continue
+				}
+			}
+		}
+		if route.AdvMSS != nil {
+			r.AdvMSS = *route.AdvMSS
 		}
+		if route.InitCwnd != nil {
+			r.InitCwnd = *route.InitCwnd
+		}
+		if route.InitRwnd != nil {
+			r.InitRwnd = *route.InitRwnd
+		}
+		// The route already exists if RunPodSandbox is retried.
 		if err := nhNs.RouteAdd(&r); err != nil && !errors.Is(err, syscall.EEXIST) {
 			errorList = append(errorList, fmt.Errorf("fail to add route %s for interface %s on namespace %s: %w", r.String(), ifName, containerNsPAth, err))
 		}
 
 	}
+	return skipped, errors.Join(errorList...)
+}
+
+// removeRoutingConfig deletes the routes of the interface added by
+// applyRoutingConfig from the namespace. The routes already gone are ignored.
+func removeRoutingConfig(containerNsPath string, ifName string, routeConfig []apis.RouteConfig, vrfTable int) error {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return err
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("can not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	errorList := []error{}
+	for _, route := range routeConfig {
+		table := route.Table
+		if vrfTable > 0 {
+			table = vrfTable
+		}
+		// The kernel only deletes the routes of the same scope.
+		r := netlink.Route{
+			LinkIndex: nsLink.Attrs().Index,
+			Scope:     netlink.Scope(route.Scope),
+			Table:     table,
+			Gw:        net.ParseIP(route.Gateway),
+		}
+		_, dst, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		r.Dst = dst
+		if route.Metric != nil {
+			r.Priority = *route.Metric
+		}
+		if err := nhNs.RouteDel(&r); err != nil && !errors.Is(err, syscall.ESRCH) {
+			errorList = append(errorList, fmt.Errorf("fail to delete route %s for interface %s on namespace %s: %w", r.String(), ifName, containerNsPath, err))
+		}
+	}
 	return errors.Join(errorList...)
 }
 
+// isDefaultDestination returns true for the 0.0.0.0/0 and ::/0 destinations.
+func isDefaultDestination(dst *net.IPNet) bool {
+	if dst == nil {
+		return true
+	}
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+// routeFamily returns the netlink family of the route destination.
+func routeFamily(dst *net.IPNet) int {
+	if dst.IP.To4() != nil {
+		return netlink.FAMILY_V4
+	}
+	return netlink.FAMILY_V6
+}
+
+// routeGateway returns the gateway of a route to dst, nil if there is none,
+// in the address length of the family of the destination. The routes
+// installed from the host or a DHCP lease are not validated like the ones of
+// the claims, an IPv4 gateway for an IPv6 destination, or the opposite, is
+// reported here instead of as an obscure netlink error.
+func routeGateway(gateway string, dst *net.IPNet) (net.IP, error) {
+	if gateway == "" {
+		return nil, nil
+	}
+	gw := net.ParseIP(gateway)
+	if gw == nil {
+		return nil, fmt.Errorf("invalid gateway %q", gateway)
+	}
+	if routeFamily(dst) == netlink.FAMILY_V4 {
+		if gw4 := gw.To4(); gw4 != nil {
+			return gw4, nil
+		}
+	} else if gw.To4() == nil {
+		return gw, nil
+	}
+	return nil, fmt.Errorf("IP family of gateway %s does not match the destination %s", gateway, dst)
+}
+
+// routeTable returns the table the kernel uses for a route of the table, the
+// unspecified table is the main table.
+func routeTable(table int) int {
+	if table == unix.RT_TABLE_UNSPEC {
+		return unix.RT_TABLE_MAIN
+	}
+	return table
+}
+
+// otherDefaultRoute returns the first default route of the routes that goes
+// through a link other than linkIndex, or nil if there is none. A default
+// route of the same link is not a conflict, it exists when RunPodSandbox is
+// retried.
+func otherDefaultRoute(routes []netlink.Route, linkIndex int) *netlink.Route {
+	for i := range routes {
+		if isDefaultDestination(routes[i].Dst) && routes[i].LinkIndex != linkIndex {
+			return &routes[i]
+		}
+	}
+	return nil
+}
+
+// waitForSourceAddress waits until the IPv6 address src assigned to link
+// completes the Duplicate Address Detection and can be used as a route source.
+func waitForSourceAddress(nhNs nlwrap.Handle, link netlink.Link, src net.IP) error {
+	var lastErr error
+	err := wait.PollUntilContextTimeout(context.Background(), 100*time.Millisecond, sourceAddressTimeout, true, func(context.Context) (bool, error) {
+		addrs, err := nhNs.AddrList(link, netlink.FAMILY_V6)
+		if err != nil {
+			return false, err
+		}
+		for _, addr := range addrs {
+			if !addr.IP.Equal(src) {
+				continue
+			}
+			if addr.Flags&syscall.IFA_F_DADFAILED != 0 {
+				return false, fmt.Errorf("source address %s failed the duplicate address detection", src)
+			}
+			if addr.Flags&syscall.IFA_F_TENTATIVE != 0 {
+				lastErr = fmt.Errorf("source address %s is still tentative", src)
+				return false, nil
+			}
+			return true, nil
+		}
+		return false, fmt.Errorf("source address %s is not assigned to the interface", src)
+	})
+	if err != nil && lastErr != nil && wait.Interrupted(err) {
+		return lastErr
+	}
+	return err
+}
+
+// waitForCarrier waits up to timeout until the interface in the namespace has
+// carrier, so the Pod does not start with a link that can not pass traffic.
+// The interfaces that do not report their operational state are considered up
+// if the lower layer is up.
+func waitForCarrier(containerNsPath string, ifName string, timeout time.Duration) error {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	var lastErr error
+	err = wait.PollUntilContextTimeout(context.Background(), 100*time.Millisecond, timeout, true, func(context.Context) (bool, error) {
+		link, err := nhNs.LinkByName(ifName)
+		if err != nil {
+			return false, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+		}
+		attrs := link.Attrs()
+		if attrs.OperState == netlink.OperUp ||
+			(attrs.OperState == netlink.OperUnknown && attrs.RawFlags&unix.IFF_LOWER_UP != 0) {
+			return true, nil
+		}
+		lastErr = fmt.Errorf("interface %s has no carrier after %v, operational state %s", ifName, timeout, attrs.OperState)
+		return false, nil
+	})
+	if err != nil && lastErr != nil && wait.Interrupted(err) {
+		return lastErr
+	}
+	return err
+}
+
 func applyNeighborConfig(containerNsPAth string, ifName string, neighConfig []apis.NeighborConfig) error {
 	containerNs, err := netns.GetFromPath(containerNsPAth)
 	if err != nil {
@@ -159,34 +398,197 @@ func applyRulesConfig(containerNsPath string, rulesConfig []apis.RuleConfig) err
 
 	errorList := []error{}
 	for _, ruleCfg := range rulesConfig {
-		rule := netlink.NewRule()
-		rule.Priority = ruleCfg.Priority
-		rule.Table = ruleCfg.Table
-
-		if ruleCfg.Source != "" {
-			_, src, err := net.ParseCIDR(ruleCfg.Source)
-			if err != nil {
-				errorList = append(errorList, err)
-				continue
-			}
-			rule.Src = src
+		rule, families, err := netlinkRule(ruleCfg)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
 		}
-		if ruleCfg.Destination != "" {
-			_, dst, err := net.ParseCIDR(ruleCfg.Destination)
-			if err != nil {
-				errorList = append(errorList, err)
-				continue
+		for _, family := range families {
+			rule.Family = family
+			if err := nsHandle.RuleAdd(rule); err != nil && !errors.Is(err, syscall.EEXIST) {
+				errorList = append(errorList, fmt.Errorf("failed to add rule %s on namespace %s: %w", rule.String(), containerNsPath, err))
 			}
-			rule.Dst = dst
 		}
+	}
+	return errors.Join(errorList...)
+}
+
+// removeRulesConfig deletes the rules added by applyRulesConfig from the
+// namespace. The rules already gone are ignored.
+func removeRulesConfig(containerNsPath string, rulesConfig []apis.RuleConfig) error {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return err
+	}
+	defer containerNs.Close()
+
+	nsHandle, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get netlink handle: %v", err)
+	}
+	defer nsHandle.Close()
 
-		if err := nsHandle.RuleAdd(rule); err != nil && !errors.Is(err, syscall.EEXIST) {
-			errorList = append(errorList, fmt.Errorf("failed to add rule %s on namespace %s: %w", rule.String(), containerNsPath, err))
+	errorList := []error{}
+	for _, ruleCfg := range rulesConfig {
+		rule, families, err := netlinkRule(ruleCfg)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		for _, family := range families {
+			rule.Family = family
+			if err := nsHandle.RuleDel(rule); err != nil && !errors.Is(err, syscall.ENOENT) {
+				errorList = append(errorList, fmt.Errorf("failed to delete rule %s on namespace %s: %w", rule.String(), containerNsPath, err))
+			}
 		}
 	}
 	return errors.Join(errorList...)
 }
 
+// netlinkRule returns the rule of the configuration and the address families
+// it is added for.
+func netlinkRule(ruleCfg apis.RuleConfig) (*netlink.Rule, []int, error) {
+	rule := netlink.NewRule()
+	rule.Priority = ruleCfg.Priority
+	rule.Table = ruleCfg.Table
+
+	if ruleCfg.Source != "" {
+		_, src, err := net.ParseCIDR(ruleCfg.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		rule.Src = src
+	}
+	if ruleCfg.Destination != "" {
+		_, dst, err := net.ParseCIDR(ruleCfg.Destination)
+		if err != nil {
+			return nil, nil, err
+		}
+		rule.Dst = dst
+	}
+	if ruleCfg.FWMark != nil {
+		// netlink omits a zero mark without a mask, the rule would match
+		// all the packets.
+		rule.Mark = *ruleCfg.FWMark
+		rule.Mask = ptr.To(ptr.Deref(ruleCfg.FWMask, math.MaxUint32))
+	}
+
+	// A firewall mark is not bound to an address family, the rule is
+	// added for IPv4 and IPv6 unless its addresses select one.
+	families := []int{netlink.FAMILY_ALL}
+	if ruleCfg.FWMark != nil && rule.Src == nil && rule.Dst == nil {
+		families = []int{netlink.FAMILY_V4, netlink.FAMILY_V6}
+	}
+	return rule, families, nil
+}
+
+// withLinkDownAt returns a function that runs apply with the interface of the
+// namespace down and brings it back up afterwards. The kernel flushes the IPv6
+// addresses of the interface when it goes down, so the addresses are restored
+// once it is up. The routes are configured after the ethtool settings.
+func withLinkDownAt(targetNs netns.NsHandle, ifName string) func(apply func() error) error {
+	return func(apply func() error) error {
+		nhNs, err := nlwrap.NewHandleAt(targetNs)
+		if err != nil {
+			return fmt.Errorf("could not get network namespace handle: %w", err)
+		}
+		defer nhNs.Close()
+
+		link, err := nhNs.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("link not found for interface %s: %w", ifName, err)
+		}
+		if link.Attrs().Flags&net.FlagUp == 0 {
+			return apply()
+		}
+		addresses, err := nhNs.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("failed to list the addresses of interface %s: %w", ifName, err)
+		}
+		if err := nhNs.LinkSetDown(link); err != nil {
+			return fmt.Errorf("failed to set interface %s down: %w", ifName, err)
+		}
+		applyErr := apply()
+		if err := nhNs.LinkSetUp(link); err != nil {
+			return errors.Join(applyErr, fmt.Errorf("failed to set interface %s up: %w", ifName, err))
+		}
+		for _, address := range addresses {
+			if err := nhNs.AddrAdd(link, &address); err != nil && !errors.Is(err, syscall.EEXIST) {
+				applyErr = errors.Join(applyErr, fmt.Errorf("failed to restore address %s on interface %s: %w", address.IPNet, ifName, err))
+			}
+		}
+		return applyErr
+	}
+}
+
+// applyMTUConfig sets the MTU of the interface in the pod network namespace.
+func applyMTUConfig(containerNsPath string, ifName string, mtu int) error {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	if err := nhNs.LinkSetMTU(nsLink, mtu); err != nil {
+		return fmt.Errorf("failed to set MTU %d for interface %s on namespace %s: %w", mtu, ifName, containerNsPath, err)
+	}
+	return nil
+}
+
+// applyQdiscConfig replaces the root qdisc of the interface in the pod
+// network namespace, the equivalent of `tc qdisc replace dev <dev> root <type>`.
+func applyQdiscConfig(containerNsPath string, ifName string, qdiscConfig *apis.QdiscConfig) error {
+	if qdiscConfig == nil {
+		return nil
+	}
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	attrs := netlink.QdiscAttrs{
+		LinkIndex: nsLink.Attrs().Index,
+		Handle:    netlink.MakeHandle(1, 0),
+		Parent:    netlink.HANDLE_ROOT,
+	}
+	var qdisc netlink.Qdisc
+	switch qdiscConfig.Type {
+	case apis.QdiscTypeFQ:
+		qdisc = netlink.NewFq(attrs)
+	case apis.QdiscTypeMQ, apis.QdiscTypePfifoFast:
+		// no options, only the kind is sent to the kernel
+		qdisc = &netlink.GenericQdisc{QdiscAttrs: attrs, QdiscType: qdiscConfig.Type}
+	default:
+		return fmt.Errorf("unsupported qdisc %q", qdiscConfig.Type)
+	}
+	if err := nhNs.QdiscReplace(qdisc); err != nil {
+		return fmt.Errorf("failed to set root qdisc %s for interface %s on namespace %s: %w", qdiscConfig.Type, ifName, containerNsPath, err)
+	}
+	return nil
+}
+
 // applyInterfaceForwarding enables IPv4 and IPv6 forwarding for a specific interface.
 // It uses the Kubernetes sysctl helper while locked into the pod's network namespace.
 func applyInterfaceForwarding(containerNsPath string, ifName string, enable bool) error {
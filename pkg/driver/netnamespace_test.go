@@ -17,9 +17,822 @@ limitations under the License.
 package driver
 
 import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
 )
 
 func Test_applyRoutingConfig(t *testing.T) {
-	// TODO: see hostdevice_test.go and ethtool_test.go
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	for _, name := range []string{ifaceName, link.PeerName} {
+		l, err := nhNs.LinkByName(name)
+		if err != nil {
+			t.Fatalf("Failed to get veth link %s in ns %s: %v", name, nsName, err)
+		}
+		if err := nhNs.LinkSetUp(l); err != nil {
+			t.Fatalf("Failed to set up veth link %s in ns %s: %v", name, nsName, err)
+		}
+	}
+	addr, err := netlink.ParseAddr("192.168.50.2/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nhNs.AddrAdd(link, addr); err != nil {
+		t.Fatalf("Failed to add address to %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	routes := []apis.RouteConfig{
+		{Destination: "10.50.0.0/16", Gateway: "192.168.50.1", AdvMSS: ptr.To(1400), InitCwnd: ptr.To(20), InitRwnd: ptr.To(30)},
+		{Destination: "10.60.0.0/16", Gateway: "192.168.50.1"},
+		{Destination: "10.70.0.0/16", Gateway: "192.168.50.1", Protocol: ptr.To(unix.RTPROT_STATIC)},
+	}
+	_, err = applyRoutingConfig(path.Join("/run/netns", nsName), ifaceName, routes, 0)
+	if err != nil {
+		t.Fatalf("applyRoutingConfig failed: %v", err)
+	}
+
+	// check against ip route show
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := netns.Set(testNS); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origns) // nolint:errcheck
+	for dst, want := range map[string]string{
+		"10.50.0.0/16": "10.50.0.0/16 via 192.168.50.1 proto 200 advmss 1400 initcwnd 20 initrwnd 30",
+		"10.60.0.0/16": "10.60.0.0/16 via 192.168.50.1 proto 200",
+		"10.70.0.0/16": "10.70.0.0/16 via 192.168.50.1 proto static",
+	} {
+		output, err := exec.Command("ip", "route", "show", dst, "dev", ifaceName).CombinedOutput()
+		if err != nil {
+			t.Fatalf("not able to use ip from namespace: %v", err)
+		}
+		got := strings.Join(strings.Fields(string(output)), " ")
+		if got != want {
+			t.Errorf("ip route show %s = %q, want %q", dst, got, want)
+		}
+	}
+}
+
+// Test_applyConfigTwice checks that the addresses and routes can be applied
+// again, as it happens when RunPodSandbox is retried.
+func Test_applyConfigTwice(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	for _, name := range []string{ifaceName, link.PeerName} {
+		l, err := nhNs.LinkByName(name)
+		if err != nil {
+			t.Fatalf("Failed to get veth link %s in ns %s: %v", name, nsName, err)
+		}
+		if err := nhNs.LinkSetUp(l); err != nil {
+			t.Fatalf("Failed to set up veth link %s in ns %s: %v", name, nsName, err)
+		}
+	}
+	nsLink, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := []string{"192.168.50.2/24", "192.168.51.2/24"}
+	routes := []apis.RouteConfig{
+		{Destination: "10.50.0.0/16", Gateway: "192.168.50.1"},
+		{Destination: "10.60.0.0/16", Gateway: "192.168.51.1", Table: 100},
+	}
+	for i := range 2 {
+		got, err := addInterfaceAddresses(nhNs, nsLink, addresses, nil)
+		if err != nil {
+			t.Fatalf("addInterfaceAddresses() attempt %d failed: %v", i+1, err)
+		}
+		if !slices.Equal(got, addresses) {
+			t.Errorf("addInterfaceAddresses() attempt %d = %v, want %v", i+1, got, addresses)
+		}
+		if _, err := applyRoutingConfig(path.Join("/run/netns", nsName), ifaceName, routes, 0); err != nil {
+			t.Fatalf("applyRoutingConfig() attempt %d failed: %v", i+1, err)
+		}
+	}
+
+	addrs, err := nhNs.AddrList(nsLink, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != len(addresses) {
+		t.Errorf("got %d addresses, want %d: %v", len(addrs), len(addresses), addrs)
+	}
+	for _, table := range []int{unix.RT_TABLE_MAIN, 100} {
+		got, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{LinkIndex: nsLink.Attrs().Index, Table: table, Protocol: routeProtocolDranet}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Errorf("got %d routes on table %d, want 1: %v", len(got), table, got)
+		}
+	}
+}
+
+// Test_applyRoutingConfigMultipleDefaults checks that the default route of an
+// interface does not replace the default route of another interface, unless
+// a metric is set to tell them apart.
+func Test_applyRoutingConfigMultipleDefaults(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	for i, ifaceName := range []string{"veth0", "veth2"} {
+		la := netlink.NewLinkAttrs()
+		la.Name = ifaceName
+		link := &netlink.Veth{
+			LinkAttrs: la,
+			PeerName:  fmt.Sprintf("veth%d", 2*i+1),
+		}
+		if err := nhNs.LinkAdd(link); err != nil {
+			t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+		}
+		for _, name := range []string{ifaceName, link.PeerName} {
+			l, err := nhNs.LinkByName(name)
+			if err != nil {
+				t.Fatalf("Failed to get veth link %s in ns %s: %v", name, nsName, err)
+			}
+			if err := nhNs.LinkSetUp(l); err != nil {
+				t.Fatalf("Failed to set up veth link %s in ns %s: %v", name, nsName, err)
+			}
+		}
+		addr, err := netlink.ParseAddr(fmt.Sprintf("192.168.%d.2/24", 50+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nhNs.AddrAdd(link, addr); err != nil {
+			t.Fatalf("Failed to add address to %s in ns %s: %v", ifaceName, nsName, err)
+		}
+	}
+
+	nsPath := path.Join("/run/netns", nsName)
+	skipped, err := applyRoutingConfig(nsPath, "veth0", []apis.RouteConfig{{Destination: "0.0.0.0/0", Gateway: "192.168.50.1"}}, 0)
+	if err != nil || len(skipped) > 0 {
+		t.Fatalf("applyRoutingConfig() veth0 = %v, %v, want no skipped routes", skipped, err)
+	}
+	// retrying on the same interface is not a conflict
+	skipped, err = applyRoutingConfig(nsPath, "veth0", []apis.RouteConfig{{Destination: "0.0.0.0/0", Gateway: "192.168.50.1"}}, 0)
+	if err != nil || len(skipped) > 0 {
+		t.Fatalf("applyRoutingConfig() veth0 retry = %v, %v, want no skipped routes", skipped, err)
+	}
+	skipped, err = applyRoutingConfig(nsPath, "veth2", []apis.RouteConfig{
+		{Destination: "0.0.0.0/0", Gateway: "192.168.51.1"},
+		{Destination: "10.51.0.0/16", Gateway: "192.168.51.1"},
+	}, 0)
+	if err != nil {
+		t.Fatalf("applyRoutingConfig() veth2 failed: %v", err)
+	}
+	if want := []string{"0.0.0.0/0 via 192.168.51.1"}; !slices.Equal(skipped, want) {
+		t.Errorf("applyRoutingConfig() veth2 skipped = %v, want %v", skipped, want)
+	}
+	// a metric tells the default routes apart
+	skipped, err = applyRoutingConfig(nsPath, "veth2", []apis.RouteConfig{{Destination: "0.0.0.0/0", Gateway: "192.168.51.1", Metric: ptr.To(100)}}, 0)
+	if err != nil || len(skipped) > 0 {
+		t.Fatalf("applyRoutingConfig() veth2 with metric = %v, %v, want no skipped routes", skipped, err)
+	}
+
+	routes, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defaults []string
+	for _, route := range routes {
+		if isDefaultDestination(route.Dst) {
+			defaults = append(defaults, fmt.Sprintf("%s metric %d", route.Gw, route.Priority))
+		}
+	}
+	slices.Sort(defaults)
+	if want := []string{"192.168.50.1 metric 0", "192.168.51.1 metric 100"}; !slices.Equal(defaults, want) {
+		t.Errorf("default routes = %v, want %v", defaults, want)
+	}
+}
+
+func Test_otherDefaultRoute(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	tests := []struct {
+		name   string
+		routes []netlink.Route
+		want   int
+	}{
+		{
+			name: "no routes",
+			want: -1,
+		},
+		{
+			name:   "no default route",
+			routes: []netlink.Route{{LinkIndex: 2, Dst: subnet}},
+			want:   -1,
+		},
+		{
+			name:   "default route of the same link",
+			routes: []netlink.Route{{LinkIndex: 3, Dst: defaultV4}},
+			want:   -1,
+		},
+		{
+			name:   "default route of another link",
+			routes: []netlink.Route{{LinkIndex: 2, Dst: subnet}, {LinkIndex: 2, Dst: defaultV4}},
+			want:   1,
+		},
+		{
+			name:   "default route without destination",
+			routes: []netlink.Route{{LinkIndex: 2}},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := otherDefaultRoute(tt.routes, 3)
+			switch {
+			case tt.want < 0 && got != nil:
+				t.Errorf("otherDefaultRoute() = %v, want nil", got)
+			case tt.want >= 0 && got != &tt.routes[tt.want]:
+				t.Errorf("otherDefaultRoute() = %v, want %v", got, tt.routes[tt.want])
+			}
+		})
+	}
+}
+
+func Test_routeGateway(t *testing.T) {
+	_, subnetV4, _ := net.ParseCIDR("10.0.0.0/8")
+	_, subnetV6, _ := net.ParseCIDR("2001:db8::/64")
+	tests := []struct {
+		name    string
+		gateway string
+		dst     *net.IPNet
+		want    net.IP
+		wantErr bool
+	}{
+		{name: "no gateway", dst: subnetV4},
+		{name: "IPv4 gateway", gateway: "192.168.1.1", dst: subnetV4, want: net.IPv4(192, 168, 1, 1).To4()},
+		{name: "IPv6 gateway", gateway: "fe80::1", dst: subnetV6, want: net.ParseIP("fe80::1")},
+		{name: "IPv4 gateway for an IPv6 destination", gateway: "192.168.1.1", dst: subnetV6, wantErr: true},
+		{name: "IPv6 gateway for an IPv4 destination", gateway: "fd00::1", dst: subnetV4, wantErr: true},
+		{name: "invalid gateway", gateway: "not-an-ip", dst: subnetV4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routeGateway(tt.gateway, tt.dst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("routeGateway() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || len(got) != len(tt.want) {
+				t.Errorf("routeGateway() = %v (%d bytes), want %v (%d bytes)", got, len(got), tt.want, len(tt.want))
+			}
+		})
+	}
+}
+
+func Test_applyRoutingConfigSource(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	for _, name := range []string{ifaceName, link.PeerName} {
+		l, err := nhNs.LinkByName(name)
+		if err != nil {
+			t.Fatalf("Failed to get veth link %s in ns %s: %v", name, nsName, err)
+		}
+		if err := nhNs.LinkSetUp(l); err != nil {
+			t.Fatalf("Failed to set up veth link %s in ns %s: %v", name, nsName, err)
+		}
+	}
+	// The IPv6 address is tentative until the Duplicate Address Detection
+	// completes, the route using it as source must wait for it.
+	for _, cidr := range []string{"192.168.51.2/24", "192.168.51.3/24", "fd00:51::2/64"} {
+		addr, err := netlink.ParseAddr(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nhNs.AddrAdd(link, addr); err != nil {
+			t.Fatalf("Failed to add address %s to %s in ns %s: %v", cidr, ifaceName, nsName, err)
+		}
+	}
+
+	routes := []apis.RouteConfig{
+		{Destination: "10.51.0.0/16", Gateway: "192.168.51.1", Source: "192.168.51.3"},
+		{Destination: "2001:db8:51::/64", Gateway: "fd00:51::1", Source: "fd00:51::2"},
+	}
+	_, err = applyRoutingConfig(path.Join("/run/netns", nsName), ifaceName, routes, 0)
+	if err != nil {
+		t.Fatalf("applyRoutingConfig failed: %v", err)
+	}
+
+	// A source address not assigned to the interface is rejected.
+	_, err = applyRoutingConfig(path.Join("/run/netns", nsName), ifaceName, []apis.RouteConfig{
+		{Destination: "2001:db8:52::/64", Gateway: "fd00:51::1", Source: "fd00:51::99"},
+	}, 0)
+	if err == nil {
+		t.Errorf("applyRoutingConfig with an unassigned source address succeeded, want error")
+	}
+
+	// check against ip route show
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := netns.Set(testNS); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origns) // nolint:errcheck
+	for dst, want := range map[string]string{
+		"10.51.0.0/16":     "10.51.0.0/16 via 192.168.51.1 proto 200 src 192.168.51.3",
+		"2001:db8:51::/64": "2001:db8:51::/64 via fd00:51::1 proto 200 src fd00:51::2 metric 1024 pref medium",
+	} {
+		// ip does not infer the family of the destination prefix.
+		family := "-4"
+		if strings.Contains(dst, ":") {
+			family = "-6"
+		}
+		output, err := exec.Command("ip", family, "route", "show", dst, "dev", ifaceName).CombinedOutput()
+		if err != nil {
+			t.Fatalf("not able to use ip from namespace: %v", err)
+		}
+		got := strings.Join(strings.Fields(string(output)), " ")
+		if got != want {
+			t.Errorf("ip route show %s = %q, want %q", dst, got, want)
+		}
+	}
+}
+
+func Test_applyRulesConfig(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	rules := []apis.RuleConfig{
+		{Priority: 100, FWMark: ptr.To[uint32](0x1), Table: 100},
+		{Priority: 101, FWMark: ptr.To[uint32](0x200), FWMask: ptr.To[uint32](0xff00), Table: 101},
+		{Priority: 102, Source: "192.168.50.0/24", Table: 102},
+		{Priority: 103, FWMark: ptr.To[uint32](0), FWMask: ptr.To[uint32](0xff), Table: 103},
+	}
+	err = applyRulesConfig(path.Join("/run/netns", nsName), rules)
+	if err != nil {
+		t.Fatalf("applyRulesConfig failed: %v", err)
+	}
+
+	// check against ip rule show
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := netns.Set(testNS); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origns) // nolint:errcheck
+	for pref, want := range map[string]string{
+		"100": "100: from all fwmark 0x1 lookup 100",
+		"101": "101: from all fwmark 0x200/0xff00 lookup 101",
+		"102": "102: from 192.168.50.0/24 lookup 102",
+		"103": "103: from all fwmark 0/0xff lookup 103",
+	} {
+		output, err := exec.Command("ip", "rule", "show", "pref", pref).CombinedOutput()
+		if err != nil {
+			t.Fatalf("not able to use ip from namespace: %v", err)
+		}
+		got := strings.Join(strings.Fields(string(output)), " ")
+		if got != want {
+			t.Errorf("ip rule show pref %s = %q, want %q", pref, got, want)
+		}
+	}
+	// The rules with only a firewall mark are added for IPv6 too.
+	for pref, want := range map[string]string{
+		"100": "100: from all fwmark 0x1 lookup 100",
+		"102": "",
+	} {
+		output, err := exec.Command("ip", "-6", "rule", "show", "pref", pref).CombinedOutput()
+		if err != nil {
+			t.Fatalf("not able to use ip from namespace: %v", err)
+		}
+		got := strings.Join(strings.Fields(string(output)), " ")
+		if got != want {
+			t.Errorf("ip -6 rule show pref %s = %q, want %q", pref, got, want)
+		}
+	}
+}
+
+func Test_getRouteInfoLinkLocal(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	if err := nhNs.LinkAdd(&netlink.Veth{LinkAttrs: la, PeerName: "veth1"}); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	link, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("Failed to get veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	for _, address := range []string{"169.254.10.2/16", "2001:db8::2/64"} {
+		addr, err := netlink.ParseAddr(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr.Flags = unix.IFA_F_NODAD
+		if err := nhNs.AddrAdd(link, addr); err != nil {
+			t.Fatalf("Failed to add address %s to %s in ns %s: %v", address, ifaceName, nsName, err)
+		}
+	}
+	for _, name := range []string{ifaceName, "veth1"} {
+		l, err := nhNs.LinkByName(name)
+		if err != nil {
+			t.Fatalf("Failed to get veth link %s in ns %s: %v", name, nsName, err)
+		}
+		if err := nhNs.LinkSetUp(l); err != nil {
+			t.Fatalf("Failed to set up veth link %s in ns %s: %v", name, nsName, err)
+		}
+	}
+	for _, dst := range []string{"169.254.169.254/32", "fe80::1/128"} {
+		_, ipNet, err := net.ParseCIDR(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nhNs.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: ipNet, Scope: netlink.SCOPE_LINK}); err != nil {
+			t.Fatalf("Failed to add route %s to %s in ns %s: %v", dst, ifaceName, nsName, err)
+		}
+	}
+
+	routeDestinations := func(preserveIPv6LinkLocal bool) sets.Set[string] {
+		routes, _, err := getRouteInfo(nhNs, ifaceName, link, preserveIPv6LinkLocal)
+		if err != nil {
+			t.Fatalf("getRouteInfo failed: %v", err)
+		}
+		destinations := sets.New[string]()
+		for _, route := range routes {
+			destinations.Insert(route.Destination)
+		}
+		return destinations
+	}
+	// The kernel adds the fe80::/64 route with the link-local address once the link has carrier.
+	err = wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return routeDestinations(true).Has("fe80::/64"), nil
+	})
+	if err != nil {
+		t.Fatalf("IPv6 link-local route of %s not found: %v", ifaceName, err)
+	}
+
+	tests := []struct {
+		name                  string
+		preserveIPv6LinkLocal bool
+		want                  sets.Set[string]
+	}{
+		{
+			name:                  "preserve the IPv6 link-local route",
+			preserveIPv6LinkLocal: true,
+			want:                  sets.New("169.254.0.0/16", "169.254.169.254/32", "fe80::/64"),
+		},
+		{
+			name: "discard the IPv6 link-local route",
+			want: sets.New("169.254.0.0/16", "169.254.169.254/32"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The kernel routes of the global IPv6 address and the other
+			// IPv6 link-local routes are never kept.
+			if got := routeDestinations(tt.preserveIPv6LinkLocal); !got.Equal(tt.want) {
+				t.Errorf("getRouteInfo() destinations = %v, want %v", sets.List(got), sets.List(tt.want))
+			}
+		})
+	}
+}
+
+func Test_applyQdiscConfig(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	// Create a dummy interface in the test namespace
+	ifaceName := "testdummy-0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Dummy{
+		LinkAttrs: la,
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add dummy link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	if err := nhNs.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up dummy link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	for _, qdiscType := range []string{apis.QdiscTypeFQ, apis.QdiscTypePfifoFast} {
+		t.Run(qdiscType, func(t *testing.T) {
+			err := applyQdiscConfig(path.Join("/run/netns", nsName), ifaceName, &apis.QdiscConfig{Type: qdiscType})
+			if err != nil {
+				t.Fatalf("applyQdiscConfig failed: %v", err)
+			}
+
+			// check against tc qdisc show
+			func() {
+				runtime.LockOSThread()
+				defer runtime.UnlockOSThread()
+				err := netns.Set(testNS)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer netns.Set(origns) // nolint:errcheck
+				output, err := exec.Command("tc", "qdisc", "show", "dev", ifaceName, "root").CombinedOutput()
+				if err != nil {
+					t.Fatalf("not able to use tc from namespace: %v", err)
+				}
+				if !strings.Contains(string(output), "qdisc "+qdiscType+" 1: root") {
+					t.Errorf("root qdisc %s not configured: %s", qdiscType, output)
+				}
+			}()
+		})
+	}
+
+	// mq requires a multiqueue device
+	err = applyQdiscConfig(path.Join("/run/netns", nsName), ifaceName, &apis.QdiscConfig{Type: apis.QdiscTypeMQ})
+	if err == nil {
+		t.Errorf("applyQdiscConfig expected to fail for mq on a single queue device")
+	}
+}
+
+func Test_waitForCarrier(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+	// the namespace is created in the current thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	// the carrier of a veth is up when both ends are up
+	la := netlink.NewLinkAttrs()
+	la.Name = "veth0"
+	link := &netlink.Veth{LinkAttrs: la, PeerName: "veth1"}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link in ns %s: %v", nsName, err)
+	}
+	if err := nhNs.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up veth link in ns %s: %v", nsName, err)
+	}
+	peer, err := nhNs.LinkByName(link.PeerName)
+	if err != nil {
+		t.Fatalf("Failed to get veth peer in ns %s: %v", nsName, err)
+	}
+	nsPath := path.Join("/run/netns", nsName)
+
+	err = waitForCarrier(nsPath, "veth0", 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no carrier") {
+		t.Fatalf("waitForCarrier() with the peer down = %v, want no carrier error", err)
+	}
+
+	if err := nhNs.LinkSetUp(peer); err != nil {
+		t.Fatalf("Failed to set up veth peer in ns %s: %v", nsName, err)
+	}
+	if err := waitForCarrier(nsPath, "veth0", 5*time.Second); err != nil {
+		t.Fatalf("waitForCarrier() with the peer up failed: %v", err)
+	}
+
+	if err := waitForCarrier(nsPath, "veth9", 300*time.Millisecond); err == nil {
+		t.Fatalf("waitForCarrier() for a missing interface succeeded, want error")
+	}
 }
@@ -18,14 +18,22 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/containerd/nri/pkg/api"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
 	resourceapply "k8s.io/client-go/applyconfigurations/resource/v1"
 	"k8s.io/klog/v2"
@@ -42,6 +50,8 @@ import (
 func (np *NetworkDriver) Synchronize(_ context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
 	klog.Infof("Synchronized state with the runtime (%d pods, %d containers)...",
 		len(pods), len(containers))
+	// The runtime synchronizes the plugin once it is registered.
+	np.nriConnected.Store(true)
 
 	// livePodNetNs map tracks live pods by UID and their network namespace paths.
 	livePodNetNs := make(map[types.UID]string)
@@ -51,11 +61,23 @@ func (np *NetworkDriver) Synchronize(_ context.Context, pods []*api.PodSandbox,
 		livePodNetNs[types.UID(pod.Uid)] = getNetworkNamespace(pod)
 	}
 
-	// Process stored pods: update NetNS for live pods.
+	// Process stored pods: update NetNS for live pods. The pods the runtime
+	// does not know about are kept, they may have been prepared before their
+	// sandbox is created, and are removed with their IPAM and profile
+	// allocations when kubelet unprepares their claims. The sandboxes that
+	// went away while the plugin was disconnected lose their NetNS so they are
+	// no longer checked for drift.
 	for _, storedUID := range np.podConfigStore.ListPods() {
-		if ns, isLive := livePodNetNs[storedUID]; isLive {
-			np.podConfigStore.SetPodNetNs(storedUID, ns)
+		ns, isLive := livePodNetNs[storedUID]
+		if !isLive {
+			if podConfig, ok := np.podConfigStore.GetPodConfig(storedUID); ok && podConfig.NetNS != "" {
+				klog.Infof("Synchronize pod UID %s is not present in the runtime anymore, waiting for its claims to be unprepared", storedUID)
+				np.podConfigStore.SetPodNetNs(storedUID, "")
+			}
+			continue
 		}
+		np.podConfigStore.SetPodNetNs(storedUID, ns)
+		np.startDHCPRenewals(storedUID)
 	}
 
 	return nil, nil
@@ -91,24 +113,38 @@ func (np *NetworkDriver) CreateContainer(ctx context.Context, pod *api.PodSandbo
 }
 
 func (np *NetworkDriver) createContainer(_ context.Context, _ *api.PodSandbox, _ *api.Container, podConfig PodConfig) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
-	// Containers only care about the RDMA char devices.
+	// Containers only care about the RDMA and VFIO char devices.
 	devPaths := set.Set[string]{}
 	adjust := &api.ContainerAdjustment{}
 
-	for _, config := range podConfig.DeviceConfigs {
-		for _, dev := range config.RDMADevice.DevChars {
+	// In a stable order, the first device using a path sets its mode.
+	for _, deviceName := range slices.Sorted(maps.Keys(podConfig.DeviceConfigs)) {
+		config := podConfig.DeviceConfigs[deviceName]
+		rdmaDevChars := slices.Clone(config.RDMADevice.DevChars)
+		if mode := config.RDMADevice.DeviceMode; mode != nil {
+			for i := range rdmaDevChars {
+				rdmaDevChars[i].FileMode = *mode
+			}
+		}
+		for _, dev := range slices.Concat(rdmaDevChars, config.VFIODevice.DevChars) {
 			// do not insert the same path multiple times
 			if devPaths.Has(dev.Path) {
 				continue
 			}
 			devPaths.Insert(dev.Path)
-			// TODO check the file permissions and uid and gid fields
-			adjust.AddDevice(&api.LinuxDevice{
+			// TODO check the uid and gid fields
+			device := &api.LinuxDevice{
 				Path:  dev.Path,
 				Type:  dev.Type,
 				Major: dev.Major,
 				Minor: dev.Minor,
-			})
+			}
+			// the configurations persisted by older versions have no mode,
+			// the runtime default is used
+			if dev.FileMode != 0 {
+				device.FileMode = api.FileMode(dev.FileMode)
+			}
+			adjust.AddDevice(device)
 		}
 	}
 
@@ -150,8 +186,21 @@ func (np *NetworkDriver) runPodSandbox(_ context.Context, pod *api.PodSandbox, p
 
 	// Track all the status updates needed for the resource claims of the pod.
 	statusUpdates := map[types.NamespacedName]*resourceapply.ResourceClaimStatusApplyConfiguration{}
-	// Process the configurations of the ResourceClaim
-	for deviceName, config := range podConfig.DeviceConfigs {
+	// Track the devices already attached of each claim, the configuration of a
+	// claim is all or nothing so they are returned to the host if any other
+	// device of the claim fails.
+	attached := map[types.NamespacedName]map[string]DeviceConfig{}
+	rollback := func(claim types.NamespacedName) {
+		if len(attached[claim]) == 0 {
+			return
+		}
+		klog.Infof("RunPodSandbox rolling back %d devices of claim %s for pod %s/%s", len(attached[claim]), claim, pod.Namespace, pod.Name)
+		np.detachDevices(ns, attached[claim])
+	}
+	// Process the configurations of the ResourceClaim, in a stable order so
+	// the failures and the rollbacks are reproducible.
+	for _, deviceName := range slices.Sorted(maps.Keys(podConfig.DeviceConfigs)) {
+		config := podConfig.DeviceConfigs[deviceName]
 		klog.V(4).Infof("RunPodSandbox processing device: %s with config: %#v", deviceName, config)
 		resourceClaim := types.NamespacedName{Name: config.Claim.Name, Namespace: config.Claim.Namespace}
 		resourceClaimStatus := statusUpdates[resourceClaim]
@@ -167,23 +216,52 @@ func (np *NetworkDriver) runPodSandbox(_ context.Context, pod *api.PodSandbox, p
 			WithPool(np.nodeName)
 
 		ifName := config.NetworkInterfaceConfigInHost.Interface.Name
+		if attached[resourceClaim] == nil {
+			attached[resourceClaim] = map[string]DeviceConfig{}
+		}
 
 		// Block 1: netdev operations — only when a network interface is present.
 		if ifName != "" {
-			if err := attachNetdevToNS(pod, ns, deviceName, config, resourceClaimStatusDevice); err != nil {
-				np.eventRecorder.Eventf(podObjectRef(pod), v1.EventTypeWarning, "NetworkDeviceAttachFailed",
+			if err := attachNetdevToNS(pod, ns, deviceName, &config, np.linkCarrierTimeout, resourceClaimStatusDevice); err != nil {
+				reason := "NetworkDeviceAttachFailed"
+				if errors.Is(err, errDeviceGone) {
+					reason = "NetworkDeviceGone"
+					// Report in the claim status that the device is gone so it can be reallocated.
+					resourceClaimStatus.WithDevices(resourceClaimStatusDevice)
+					np.updateClaimStatuses(statusUpdates)
+				} else {
+					// The interface may have been moved before the failure.
+					attached[resourceClaim][deviceName] = config
+				}
+				np.eventRecorder.Eventf(podObjectRef(pod), v1.EventTypeWarning, reason,
 					"failed to attach network device %s to pod %s/%s: %v", deviceName, pod.GetNamespace(), pod.GetName(), err)
+				rollback(resourceClaim)
 				return err
 			}
+			// Persist the host state captured by the attachment so the
+			// interface is restored when the Pod stops.
+			if err := np.podConfigStore.SetDeviceConfig(types.UID(pod.GetUid()), deviceName, config); err != nil {
+				klog.Infof("RunPodSandbox failed to store the host state of device %s for pod %s/%s: %v", deviceName, pod.Namespace, pod.Name, err)
+			}
 		}
+		attached[resourceClaim][deviceName] = config
 
 		// Block 2: RDMA link device — independent of whether a netdev exists.
 		// For IB-only devices (no netdev) this is the only operation here;
-		// for RoCE (netdev + RDMA) it runs after the netdev block above.
-		if !np.rdmaSharedMode && config.RDMADevice.LinkDev != "" {
-			if err := attachRdmaToNS(config.RDMADevice.LinkDev, ns, resourceClaimStatusDevice); err != nil {
+		// for RoCE (netdev + RDMA) it must run after the netdev block above:
+		// the RoCE GIDs are derived from the MAC address of the netdev, so
+		// the hardware address override is applied before the RDMA link is
+		// moved and can be used.
+		attachRdma := np.attachRdma
+		if attachRdma == nil {
+			attachRdma = np.attachRdmaIfExclusive
+		}
+		// An interface aggregating several RDMA devices needs all of them.
+		for _, linkDev := range config.RDMADevice.LinkDevs() {
+			if err := attachRdma(linkDev, ns, resourceClaimStatusDevice); err != nil {
 				np.eventRecorder.Eventf(podObjectRef(pod), v1.EventTypeWarning, "RDMADeviceAttachFailed",
-					"failed to attach RDMA device %s to pod %s/%s: %v", config.RDMADevice.LinkDev, pod.GetNamespace(), pod.GetName(), err)
+					"failed to attach RDMA device %s to pod %s/%s: %v", linkDev, pod.GetNamespace(), pod.GetName(), err)
+				rollback(resourceClaim)
 				return err
 			}
 		}
@@ -191,8 +269,9 @@ func (np *NetworkDriver) runPodSandbox(_ context.Context, pod *api.PodSandbox, p
 		// Block 3: Status conditions for IB-only devices (no netdev).
 		// In exclusive RDMA mode the RDMA link was moved above; in shared mode
 		// char-device injection (createContainer) is sufficient. Either way the
-		// device is ready, so emit the condition unconditionally.
-		if ifName == "" && config.RDMADevice.LinkDev != "" {
+		// device is ready, so emit the condition unconditionally. The RDMA link
+		// of an IB-only device claimed with its netdev is moved with the netdev.
+		if ifName == "" && (config.RDMADevice.LinkDev != "" || len(config.RDMADevice.DevChars) > 0) {
 			resourceClaimStatusDevice.WithConditions(
 				metav1apply.Condition().
 					WithType("Ready").
@@ -202,29 +281,103 @@ func (np *NetworkDriver) runPodSandbox(_ context.Context, pod *api.PodSandbox, p
 			)
 		}
 
+		// Block 4: Status conditions for VFIO devices, the VFIO char devices
+		// are injected into the containers by createContainer.
+		if config.VFIODevice.IOMMUGroup != "" {
+			resourceClaimStatusDevice.WithConditions(
+				metav1apply.Condition().
+					WithType("Ready").
+					WithReason("VFIODeviceReady").
+					WithStatus(metav1.ConditionTrue).
+					WithLastTransitionTime(metav1.Now()),
+			)
+		}
+
 		resourceClaimStatus.WithDevices(resourceClaimStatusDevice)
 	}
-	// do not block the handler to update the status
+	np.updateClaimStatuses(statusUpdates)
+	np.startDHCPRenewals(types.UID(pod.GetUid()))
+	return nil
+}
+
+// claimStatusBackoff bounds the retries of a resource claim status update.
+var claimStatusBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// updateClaimStatuses applies the status of the resource claims in the
+// background to not block the handler. Nothing is applied without an API
+// client.
+func (np *NetworkDriver) updateClaimStatuses(statusUpdates map[types.NamespacedName]*resourceapply.ResourceClaimStatusApplyConfiguration) {
+	if np.kubeClient == nil {
+		return
+	}
+	// The retries stop when the driver does.
+	ctx := np.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	for claim, status := range statusUpdates {
 		resourceClaimApply := resourceapply.ResourceClaim(claim.Name, claim.Namespace).WithStatus(status)
 		go func() {
-			ctxStatus, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-			defer cancel()
-			_, err := np.kubeClient.ResourceV1().ResourceClaims(claim.Namespace).ApplyStatus(ctxStatus,
-				resourceClaimApply,
-				metav1.ApplyOptions{FieldManager: np.driverName, Force: true},
-			)
-			if err != nil {
+			if err := np.applyClaimStatus(ctx, np.driverName, claim, resourceClaimApply); err != nil {
 				klog.Infof("failed to update status for claim %s/%s : %v", claim.Namespace, claim.Name, err)
 			} else {
 				klog.V(4).Infof("updated status for claim %s/%s", claim.Namespace, claim.Name)
 			}
 		}()
 	}
+}
 
+// applyClaimStatus applies the status of a resource claim as fieldManager,
+// retrying with backoff on transient errors, so the claim gets its conditions
+// even if the API server is briefly unavailable. It gives up if the claim no
+// longer exists or the context is canceled.
+func (np *NetworkDriver) applyClaimStatus(ctx context.Context, fieldManager string, claim types.NamespacedName, resourceClaimApply *resourceapply.ResourceClaimApplyConfiguration) error {
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, claimStatusBackoff, func(ctx context.Context) (bool, error) {
+		ctxStatus, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		_, lastErr = np.kubeClient.ResourceV1().ResourceClaims(claim.Namespace).ApplyStatus(ctxStatus,
+			resourceClaimApply,
+			metav1.ApplyOptions{FieldManager: fieldManager, Force: true},
+		)
+		if lastErr == nil {
+			return true, nil
+		}
+		if apierrors.IsNotFound(lastErr) {
+			return false, lastErr
+		}
+		klog.V(4).Infof("retrying status update for claim %s/%s : %v", claim.Namespace, claim.Name, lastErr)
+		return false, nil
+	})
+	if err != nil {
+		claimStatusUpdateFailuresTotal.Inc()
+		if lastErr != nil && !errors.Is(err, lastErr) {
+			return fmt.Errorf("%w: %w", err, lastErr)
+		}
+		return err
+	}
 	return nil
 }
 
+// rdmaAttacher moves the RDMA link device into the pod network namespace and
+// records its status conditions on resourceClaimStatusDevice.
+type rdmaAttacher func(linkDev, ns string, resourceClaimStatusDevice *resourceapply.AllocatedDeviceStatusApplyConfiguration) error
+
+// attachRdmaIfExclusive moves the RDMA link device into the pod network
+// namespace if it is not visible from it already, e.g. shared between the
+// namespaces.
+func (np *NetworkDriver) attachRdmaIfExclusive(linkDev, ns string, resourceClaimStatusDevice *resourceapply.AllocatedDeviceStatusApplyConfiguration) error {
+	if !np.shouldMoveRdmaLink(linkDev, ns) {
+		return nil
+	}
+	return attachRdmaToNS(linkDev, ns, resourceClaimStatusDevice)
+}
+
 // attachRdmaToNS moves the RDMA link device into the pod network namespace and
 // records the RDMALinkReady status condition on resourceClaimStatusDevice.
 func attachRdmaToNS(linkDev, ns string, resourceClaimStatusDevice *resourceapply.AllocatedDeviceStatusApplyConfiguration) error {
@@ -246,45 +399,95 @@ func attachRdmaToNS(linkDev, ns string, resourceClaimStatusDevice *resourceapply
 // attachNetdevToNS moves the host network interface into the pod network namespace,
 // applies all associated configuration (ethtool, eBPF, routes, rules, neighbors),
 // and records the resulting status conditions on resourceClaimStatusDevice.
-func attachNetdevToNS(pod *api.PodSandbox, ns, deviceName string, config DeviceConfig, resourceClaimStatusDevice *resourceapply.AllocatedDeviceStatusApplyConfiguration) error {
-	ifName := config.NetworkInterfaceConfigInHost.Interface.Name
+// If carrierTimeout is not zero, the network is reported ready only once the
+// interface has carrier. The state of the interface in the host is captured in
+// config.HostState before it is moved, if it was not captured already.
+func attachNetdevToNS(pod *api.PodSandbox, ns, deviceName string, config *DeviceConfig, carrierTimeout time.Duration, resourceClaimStatusDevice *resourceapply.AllocatedDeviceStatusApplyConfiguration) error {
+	ifName, err := resolveHostInterface(config.NetworkInterfaceConfigInHost.Interface.Name, config.PCIAddress)
+	if err != nil {
+		klog.Infof("RunPodSandbox network device %s for pod %s/%s: %v", deviceName, pod.Namespace, pod.Name, err)
+		resourceClaimStatusDevice.WithConditions(
+			metav1apply.Condition().
+				WithType("Ready").
+				WithReason("NetworkDeviceGone").
+				WithMessage(err.Error()).
+				WithStatus(metav1.ConditionFalse).
+				WithLastTransitionTime(metav1.Now()),
+		)
+		return err
+	}
 	klog.V(2).Infof("RunPodSandbox processing Network device: %s", ifName)
+	// The state is captured only once, an interface already attached has the
+	// settings applied for the Pod.
+	if config.HostState == nil {
+		hostState, err := getHostInterfaceState(ifName)
+		if err != nil {
+			klog.Infof("RunPodSandbox error getting the host state of device %s: %v", deviceName, err)
+			return fmt.Errorf("error getting the host state of network device %s: %w", deviceName, err)
+		}
+		config.HostState = hostState
+	}
 	// TODO config options to rename the device and pass parameters
 	// use https://github.com/opencontainers/runtime-spec/pull/1271
-	networkData, err := nsAttachNetdev(ifName, ns, config.NetworkInterfaceConfigInPod.Interface)
+	networkData, offloadMismatches, err := nsAttachNetdev(ifName, ns, config.NetworkInterfaceConfigInPod.Interface, config.PreservedAddresses)
 	if err != nil {
 		klog.Infof("RunPodSandbox error moving device %s to namespace %s: %v", deviceName, ns, err)
 		return fmt.Errorf("error moving network device %s to namespace %s: %v", deviceName, ns, err)
 	}
 
 	resourceClaimStatusDevice.WithConditions(
-		metav1apply.Condition().
-			WithType("Ready").
-			WithReason("NetworkDeviceReady").
-			WithStatus(metav1.ConditionTrue).
-			WithLastTransitionTime(metav1.Now()),
+		networkDeviceReadyCondition(ifName, config.PCIAddress),
 	).WithNetworkData(resourceapply.NetworkDeviceData().
 		WithInterfaceName(networkData.InterfaceName).
 		WithHardwareAddress(networkData.HardwareAddress).
 		WithIPs(networkData.IPs...),
 	) // End of WithNetworkData
 
+	if len(config.DHCPOptions) > 0 {
+		data, err := deviceStatusData(config)
+		if err != nil {
+			klog.Infof("RunPodSandbox error encoding the DHCP options of device %s: %v", deviceName, err)
+		} else {
+			resourceClaimStatusDevice.WithData(*data)
+		}
+	}
+
 	// The interface name inside the container's namespace.
 	ifNameInNs := networkData.InterfaceName
 
-	// Apply Ethtool configurations
-	if config.NetworkInterfaceConfigInPod.Ethtool != nil {
-		err = applyEthtoolConfig(ns, ifNameInNs, config.NetworkInterfaceConfigInPod.Ethtool)
+	// Apply Ethtool configurations, except the settings already applied in
+	// the host namespace when the claim was prepared.
+	if _, ethtoolConfig := ethtoolConfigPhases(config.NetworkInterfaceConfigInPod.Ethtool); ethtoolConfig != nil {
+		err = applyEthtoolConfig(ns, ifNameInNs, ethtoolConfig)
 		if err != nil {
 			klog.Infof("RunPodSandbox error applying ethtool config for %s in ns %s: %v", ifNameInNs, ns, err)
 			return fmt.Errorf("error applying ethtool config for %s in ns %s: %v", ifNameInNs, ns, err)
 		}
 	}
 
+	// Configure the root qdisc
+	if config.NetworkInterfaceConfigInPod.Qdisc != nil {
+		err = applyQdiscConfig(ns, ifNameInNs, config.NetworkInterfaceConfigInPod.Qdisc)
+		if err != nil {
+			klog.Infof("RunPodSandbox error applying qdisc config for %s in ns %s: %v", ifNameInNs, ns, err)
+			return fmt.Errorf("error applying qdisc config for %s in ns %s: %v", ifNameInNs, ns, err)
+		}
+	}
+
+	// Limit the bandwidth of the interface
+	if config.NetworkInterfaceConfigInPod.RateLimit != nil {
+		err = applyRateLimitConfig(ns, ifNameInNs, config.NetworkInterfaceConfigInPod.RateLimit)
+		if err != nil {
+			klog.Infof("RunPodSandbox error applying rate limit config for %s in ns %s: %v", ifNameInNs, ns, err)
+			return fmt.Errorf("error applying rate limit config for %s in ns %s: %v", ifNameInNs, ns, err)
+		}
+	}
+
 	// Check if the ebpf programs should be disabled
-	if config.NetworkInterfaceConfigInPod.Interface.DisableEBPFPrograms != nil &&
-		*config.NetworkInterfaceConfigInPod.Interface.DisableEBPFPrograms {
-		err := detachEBPFPrograms(ns, ifNameInNs)
+	if programTypes := disabledEBPFProgramTypes(config.NetworkInterfaceConfigInPod.Interface); programTypes.Len() > 0 {
+		ctxBPF, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := detachEBPFPrograms(ctxBPF, ns, ifNameInNs, programTypes)
+		cancel()
 		if err != nil {
 			klog.Infof("error disabling ebpf programs for %s in ns %s: %v", ifNameInNs, ns, err)
 			return fmt.Errorf("error disabling ebpf programs for %s in ns %s: %v", ifNameInNs, ns, err)
@@ -300,7 +503,7 @@ func attachNetdevToNS(pod *api.PodSandbox, ns, deviceName string, config DeviceC
 	}
 
 	// Configure routes
-	err = applyRoutingConfig(ns, ifNameInNs, config.NetworkInterfaceConfigInPod.Routes, vrfTable)
+	skippedDefaultRoutes, err := applyRoutingConfig(ns, ifNameInNs, config.NetworkInterfaceConfigInPod.Routes, vrfTable)
 	if err != nil {
 		klog.Infof("RunPodSandbox error configuring device %s namespace %s routing: %v", deviceName, ns, err)
 		return fmt.Errorf("error configuring device %s routes on namespace %s: %v", deviceName, ns, err)
@@ -323,16 +526,78 @@ func attachNetdevToNS(pod *api.PodSandbox, ns, deviceName string, config DeviceC
 		return fmt.Errorf("failed to apply neighbor configuration for interface %s in namespace %s: %w", ifNameInNs, ns, err)
 	}
 
-	resourceClaimStatusDevice.WithConditions(
-		metav1apply.Condition().
-			WithType("NetworkReady").
-			WithStatus(metav1.ConditionTrue).
-			WithReason("NetworkReady").
-			WithLastTransitionTime(metav1.Now()),
-	)
+	networkReady := metav1apply.Condition().
+		WithType("NetworkReady").
+		WithStatus(metav1.ConditionTrue).
+		WithReason("NetworkReady").
+		WithLastTransitionTime(metav1.Now())
+	// The kernel does not fail when the offload sizes are not supported,
+	// report them so users can tell if Big TCP was not enabled.
+	if len(offloadMismatches) > 0 {
+		networkReady.WithMessage("offload sizes differ from requested: " + strings.Join(offloadMismatches, ", "))
+	}
+	// A link without carrier does not fail the Pod, the cable may be plugged
+	// later, but the network is not reported ready.
+	if carrierTimeout > 0 {
+		if err := waitForCarrier(ns, ifNameInNs, carrierTimeout); err != nil {
+			klog.Infof("RunPodSandbox interface %s for pod %s/%s is not healthy: %v", ifNameInNs, pod.Namespace, pod.Name, err)
+			networkReady.
+				WithStatus(metav1.ConditionFalse).
+				WithReason("LinkCarrierTimeout").
+				WithMessage(err.Error())
+		}
+	}
+	resourceClaimStatusDevice.WithConditions(networkReady)
+	// The Pod still works through the existing default route, warn the users
+	// so they can set a metric if they want the interface default route too.
+	if len(skippedDefaultRoutes) > 0 {
+		resourceClaimStatusDevice.WithConditions(
+			metav1apply.Condition().
+				WithType("DefaultRouteSkipped").
+				WithReason("DefaultRouteExists").
+				WithMessage("default routes without metric not added, the Pod already has a default route: " + strings.Join(skippedDefaultRoutes, ", ")).
+				WithStatus(metav1.ConditionTrue).
+				WithLastTransitionTime(metav1.Now()),
+		)
+	}
 	return nil
 }
 
+// deviceStatus is the driver specific data of the device in the
+// ResourceClaim status.
+type deviceStatus struct {
+	// DHCPOptions are the raw values, base64 encoded and keyed by option
+	// code, of the options of dhcpRequestOptions returned by the DHCP server.
+	DHCPOptions map[int][]byte `json:"dhcpOptions,omitempty"`
+}
+
+// deviceStatusData returns the data of the device in the ResourceClaim
+// status.
+func deviceStatusData(config *DeviceConfig) (*runtime.RawExtension, error) {
+	raw, err := json.Marshal(deviceStatus{DHCPOptions: config.DHCPOptions})
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.RawExtension{Raw: raw}, nil
+}
+
+// networkDeviceReadyCondition returns the Ready condition of a network device
+// attached to the pod. The interface can be renamed inside the pod, so the
+// message records the name of the interface in the host and its PCI address,
+// if any, to map it back to the physical device.
+func networkDeviceReadyCondition(hostIfName, pciAddress string) *metav1apply.ConditionApplyConfiguration {
+	message := "host interface " + hostIfName
+	if pciAddress != "" {
+		message += ", PCI address " + pciAddress
+	}
+	return metav1apply.Condition().
+		WithType("Ready").
+		WithReason("NetworkDeviceReady").
+		WithMessage(message).
+		WithStatus(metav1.ConditionTrue).
+		WithLastTransitionTime(metav1.Now())
+}
+
 // StopPodSandbox tries to move back the devices to the rootnamespace but does not fail
 // to avoid disrupting the pod shutdown. The kernel will do the cleanup once the namespace
 // is deleted.
@@ -360,6 +625,7 @@ func (np *NetworkDriver) StopPodSandbox(ctx context.Context, pod *api.PodSandbox
 }
 
 func (np *NetworkDriver) stopPodSandbox(_ context.Context, pod *api.PodSandbox, podConfig PodConfig) error {
+	np.stopDHCPRenewals(types.UID(pod.GetUid()))
 	// get the pod network namespace
 	ns := getNetworkNamespace(pod)
 	if ns == "" {
@@ -372,17 +638,27 @@ func (np *NetworkDriver) stopPodSandbox(_ context.Context, pod *api.PodSandbox,
 		}
 		ns = podConfig.NetNS
 	}
+	np.detachDevices(ns, podConfig.DeviceConfigs)
+	return nil
+}
+
+// detachDevices returns the devices in the network namespace ns to the host,
+// the child interfaces created by the driver are deleted instead.
+func (np *NetworkDriver) detachDevices(ns string, deviceConfigs map[string]DeviceConfig) {
 	needsRescan := false
-	for deviceName, config := range podConfig.DeviceConfigs {
+	for deviceName, config := range deviceConfigs {
 		// Move the RDMA device back to the host namespace BEFORE the netdev.
 		// nsDetachNetdev calls LinkSetUp on the VF in the host namespace, which
 		// triggers a NEWLINK event causing the inventory to rescan. If the RDMA
 		// device is still in the pod namespace at that point it will not be
 		// detected, so it must be returned first.
 		rdmaDetached := false
-		if !np.rdmaSharedMode && config.RDMADevice.LinkDev != "" {
-			if err := nsDetachRdmadev(ns, config.RDMADevice.LinkDev); err != nil {
-				klog.Errorf("fail to return rdma device %s : %v", deviceName, err)
+		for _, linkDev := range config.RDMADevice.LinkDevs() {
+			if !np.shouldReturnRdmaLink(linkDev, ns) {
+				continue
+			}
+			if err := nsDetachRdmadev(ns, linkDev); err != nil {
+				klog.Errorf("fail to return rdma device %s of %s : %v", linkDev, deviceName, err)
 			} else {
 				rdmaDetached = true
 			}
@@ -390,8 +666,18 @@ func (np *NetworkDriver) stopPodSandbox(_ context.Context, pod *api.PodSandbox,
 
 		netdevDetached := false
 		ifName := config.NetworkInterfaceConfigInPod.Interface.Name
-		if ifName != "" {
-			if err := nsDetachNetdev(ns, ifName, config.NetworkInterfaceConfigInHost.Interface.Name); err != nil {
+		if ifName != "" && config.ChildInterface {
+			// The shared parent never left the host, only the child is deleted.
+			if err := nsDeleteChildNetdev(ns, ifName); err != nil {
+				klog.Errorf("fail to delete child network device %s : %v", deviceName, err)
+			}
+		} else if ifName != "" {
+			if config.NetworkInterfaceConfigInPod.RateLimit != nil {
+				if err := removeRateLimitConfig(ns, ifName); err != nil {
+					klog.Errorf("fail to remove rate limits of network device %s : %v", deviceName, err)
+				}
+			}
+			if err := nsDetachNetdev(ns, ifName, config.NetworkInterfaceConfigInHost.Interface.Name, config.HostState); err != nil {
 				klog.Errorf("fail to return network device %s : %v", deviceName, err)
 			} else {
 				netdevDetached = true
@@ -405,7 +691,6 @@ func (np *NetworkDriver) stopPodSandbox(_ context.Context, pod *api.PodSandbox,
 	if needsRescan {
 		np.netdb.RequestRescan()
 	}
-	return nil
 }
 
 // needsRescanAfterDetach reports whether the inventory needs an explicit
@@ -18,14 +18,35 @@ package driver
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	goruntime "runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	resourceapi "k8s.io/api/resource/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	resourceapply "k8s.io/client-go/applyconfigurations/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
 	"sigs.k8s.io/dranet/pkg/apis"
 	"sigs.k8s.io/dranet/pkg/inventory"
 )
@@ -68,6 +89,123 @@ func TestCreateContainerNoDuplicateDevices(t *testing.T) {
 	}
 }
 
+func TestCreateContainerVFIODevices(t *testing.T) {
+	np := &NetworkDriver{
+		podConfigStore: mustNewPodConfigStore(),
+	}
+
+	podUID := types.UID("test-pod")
+	pod := &api.PodSandbox{
+		Uid:       string(podUID),
+		Name:      "test-pod",
+		Namespace: "test-ns",
+	}
+	ctr := &api.Container{
+		Name: "test-container",
+	}
+
+	// Two devices in different IOMMU groups share the VFIO container device.
+	vfioContainer := LinuxDevice{Path: "/dev/vfio/vfio", Type: "c", Major: 10, Minor: 196}
+	np.podConfigStore.SetDeviceConfig(podUID, "pci-0000-3b-00-1", DeviceConfig{
+		VFIODevice: VFIOConfig{
+			IOMMUGroup: "42",
+			DevChars:   []LinuxDevice{vfioContainer, {Path: "/dev/vfio/42", Type: "c", Major: 511, Minor: 0}},
+		},
+	})
+	np.podConfigStore.SetDeviceConfig(podUID, "pci-0000-3b-00-2", DeviceConfig{
+		VFIODevice: VFIOConfig{
+			IOMMUGroup: "43",
+			DevChars:   []LinuxDevice{vfioContainer, {Path: "/dev/vfio/43", Type: "c", Major: 511, Minor: 1}},
+		},
+	})
+
+	adjust, _, err := np.CreateContainer(context.Background(), pod, ctr)
+	if err != nil {
+		t.Fatalf("CreateContainer failed: %v", err)
+	}
+
+	var got []string
+	for _, dev := range adjust.Linux.Devices {
+		got = append(got, dev.Path)
+	}
+	slices.Sort(got)
+	if want := []string{"/dev/vfio/42", "/dev/vfio/43", "/dev/vfio/vfio"}; !slices.Equal(got, want) {
+		t.Errorf("CreateContainer devices = %v, want %v", got, want)
+	}
+}
+
+func TestCreateContainerRDMADeviceMode(t *testing.T) {
+	np := &NetworkDriver{
+		podConfigStore: mustNewPodConfigStore(),
+	}
+
+	podUID := types.UID("test-pod")
+	pod := &api.PodSandbox{
+		Uid:       string(podUID),
+		Name:      "test-pod",
+		Namespace: "test-ns",
+	}
+	ctr := &api.Container{
+		Name: "test-container",
+	}
+
+	rdmaCm := LinuxDevice{Path: "/dev/infiniband/rdma_cm", Type: "c", Major: 10, Minor: 58, FileMode: 0o666}
+	np.podConfigStore.SetDeviceConfig(podUID, "eth1", DeviceConfig{ //nolint:errcheck
+		RDMADevice: RDMAConfig{
+			LinkDev:    "mlx5_0",
+			DevChars:   []LinuxDevice{rdmaCm, {Path: "/dev/infiniband/uverbs0", Type: "c", Major: 231, Minor: 192, FileMode: 0o600}},
+			DeviceMode: ptr.To[uint32](0o660),
+		},
+	})
+	// the mode of the devices in the host
+	np.podConfigStore.SetDeviceConfig(podUID, "eth2", DeviceConfig{ //nolint:errcheck
+		RDMADevice: RDMAConfig{
+			LinkDev:  "mlx5_1",
+			DevChars: []LinuxDevice{rdmaCm, {Path: "/dev/infiniband/uverbs1", Type: "c", Major: 231, Minor: 193, FileMode: 0o600}},
+		},
+	})
+	// persisted by an older version, without mode
+	np.podConfigStore.SetDeviceConfig(podUID, "eth3", DeviceConfig{ //nolint:errcheck
+		RDMADevice: RDMAConfig{
+			LinkDev:  "mlx5_2",
+			DevChars: []LinuxDevice{{Path: "/dev/infiniband/uverbs2", Type: "c", Major: 231, Minor: 194}},
+		},
+	})
+
+	adjust, _, err := np.CreateContainer(context.Background(), pod, ctr)
+	if err != nil {
+		t.Fatalf("CreateContainer failed: %v", err)
+	}
+
+	got := map[string]*api.OptionalFileMode{}
+	for _, dev := range adjust.Linux.Devices {
+		got[dev.Path] = dev.FileMode
+	}
+	want := map[string]*api.OptionalFileMode{
+		// the device of eth1 comes first
+		"/dev/infiniband/rdma_cm": api.FileMode(uint32(0o660)),
+		"/dev/infiniband/uverbs0": api.FileMode(uint32(0o660)),
+		"/dev/infiniband/uverbs1": api.FileMode(uint32(0o600)),
+		"/dev/infiniband/uverbs2": nil,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("CreateContainer devices = %v, want %v", got, want)
+	}
+	for path, mode := range want {
+		if got[path].Get() == nil && mode.Get() == nil {
+			continue
+		}
+		if got[path].Get() == nil || mode.Get() == nil || *got[path].Get() != *mode.Get() {
+			t.Errorf("CreateContainer device %s mode = %v, want %v", path, got[path], mode)
+		}
+	}
+	// the stored configuration keeps the mode of the devices in the host
+	podConfig, _ := np.podConfigStore.GetPodConfig(podUID)
+	if mode := podConfig.DeviceConfigs["eth1"].RDMADevice.DevChars[1].FileMode; mode != 0o600 {
+		t.Errorf("stored mode of uverbs0 = %#o, want 0600", mode)
+	}
+}
+
 func TestCreateContainerUsesPersistedConfigAfterRestart(t *testing.T) {
 	dbPath := filepath.Join(t.TempDir(), "pod_configs.db")
 	podUID := types.UID("test-pod")
@@ -189,6 +327,496 @@ func TestRunPodSandboxUsesPersistedConfigAfterRestart(t *testing.T) {
 	}
 }
 
+func TestRunPodSandboxDeviceGone(t *testing.T) {
+	podUID := types.UID("test-pod-device-gone")
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+	store := mustNewPodConfigStore()
+	err := store.SetDeviceConfig(podUID, "eth0", DeviceConfig{
+		Claim: types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+		NetworkInterfaceConfigInHost: apis.NetworkConfig{
+			Interface: apis.InterfaceConfig{Name: "gone0"},
+		},
+		// A PCI address that does not exist so the interface can not be found again.
+		PCIAddress: "ffff:ff:1f.7",
+	})
+	if err != nil {
+		t.Fatalf("SetDeviceConfig() error: %v", err)
+	}
+
+	kubeClient := fake.NewClientset(claim)
+	recorder := record.NewFakeRecorder(100)
+	np := &NetworkDriver{
+		driverName:     "dra.net",
+		nodeName:       "node1",
+		podConfigStore: store,
+		netdb:          inventory.New(),
+		eventRecorder:  recorder,
+		kubeClient:     kubeClient,
+	}
+	pod := &api.PodSandbox{
+		Uid:       string(podUID),
+		Name:      "test-pod",
+		Namespace: "ns",
+		Linux: &api.LinuxPodSandbox{
+			Namespaces: []*api.LinuxNamespace{
+				{Type: "network", Path: "/var/run/netns/test"},
+			},
+		},
+	}
+
+	err = np.RunPodSandbox(context.Background(), pod)
+	if !errors.Is(err, errDeviceGone) {
+		t.Fatalf("RunPodSandbox() error = %v, want %v", err, errDeviceGone)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NetworkDeviceGone") {
+		t.Errorf("expected a NetworkDeviceGone event, got %q", event)
+	}
+
+	// The status is updated in the background.
+	err = wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, wait.ForeverTestTimeout, true, func(ctx context.Context) (bool, error) {
+		got, err := kubeClient.ResourceV1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, device := range got.Status.Devices {
+			for _, condition := range device.Conditions {
+				if condition.Reason == "NetworkDeviceGone" && condition.Status == metav1.ConditionFalse {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Errorf("claim status does not report the device is gone: %v", err)
+	}
+}
+
+func TestApplyClaimStatusRetries(t *testing.T) {
+	backoff := claimStatusBackoff
+	claimStatusBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+	t.Cleanup(func() { claimStatusBackoff = backoff })
+
+	tests := []struct {
+		name      string
+		failures  int
+		failErr   error
+		cancelCtx bool
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "succeeds at the first attempt",
+			wantCalls: 1,
+		},
+		{
+			name:      "succeeds after transient errors",
+			failures:  2,
+			failErr:   apierrors.NewServiceUnavailable("etcd leader changed"),
+			wantCalls: 3,
+		},
+		{
+			name:      "gives up after all the retries",
+			failures:  10,
+			failErr:   apierrors.NewTimeoutError("request timed out", 1),
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name:      "does not retry a deleted claim",
+			failures:  10,
+			failErr:   apierrors.NewNotFound(resourceapi.Resource("resourceclaims"), "claim1"),
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "stops when the context is canceled",
+			failures:  10,
+			failErr:   apierrors.NewServiceUnavailable("etcd leader changed"),
+			cancelCtx: true,
+			wantErr:   true,
+			wantCalls: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+			kubeClient := fake.NewClientset(claim)
+			calls := 0
+			kubeClient.PrependReactor("patch", "resourceclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				calls++
+				if calls <= tt.failures {
+					return true, nil, tt.failErr
+				}
+				return false, nil, nil
+			})
+			np := &NetworkDriver{driverName: "dra.net", kubeClient: kubeClient}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelCtx {
+				cancel()
+			}
+			failuresBefore := testutil.ToFloat64(claimStatusUpdateFailuresTotal)
+			status := resourceapply.ResourceClaimStatus().WithDevices(
+				resourceapply.AllocatedDeviceStatus().
+					WithDriver("dra.net").WithPool("node1").WithDevice("eth0").
+					WithConditions(metav1apply.Condition().
+						WithType("Ready").
+						WithReason("NetworkDeviceReady").
+						WithStatus(metav1.ConditionTrue).
+						WithLastTransitionTime(metav1.Now())),
+			)
+			err := np.applyClaimStatus(ctx, np.driverName, types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+				resourceapply.ResourceClaim(claim.Name, claim.Namespace).WithStatus(status))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyClaimStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("applyClaimStatus() made %d calls, want %d", calls, tt.wantCalls)
+			}
+			wantFailures := 0.0
+			if tt.wantErr {
+				wantFailures = 1
+			}
+			if got := testutil.ToFloat64(claimStatusUpdateFailuresTotal) - failuresBefore; got != wantFailures {
+				t.Errorf("claimStatusUpdateFailuresTotal increased by %v, want %v", got, wantFailures)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := kubeClient.ResourceV1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get claim: %v", err)
+			}
+			if len(got.Status.Devices) != 1 || len(got.Status.Devices[0].Conditions) != 1 {
+				t.Errorf("claim status was not applied: %+v", got.Status)
+			}
+		})
+	}
+}
+
+func TestNetworkDeviceReadyConditionStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		hostIfName  string
+		pciAddress  string
+		wantMessage string
+	}{
+		{
+			name:        "pci device",
+			hostIfName:  "eth3",
+			pciAddress:  "0000:3b:00.0",
+			wantMessage: "host interface eth3, PCI address 0000:3b:00.0",
+		},
+		{
+			name:        "virtual device",
+			hostIfName:  "veth0",
+			wantMessage: "host interface veth0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+			kubeClient := fake.NewClientset(claim)
+			np := &NetworkDriver{driverName: "dra.net", kubeClient: kubeClient}
+
+			status := resourceapply.ResourceClaimStatus().WithDevices(
+				resourceapply.AllocatedDeviceStatus().
+					WithDriver("dra.net").WithPool("node1").WithDevice("eth0").
+					WithConditions(networkDeviceReadyCondition(tt.hostIfName, tt.pciAddress)).
+					WithNetworkData(resourceapply.NetworkDeviceData().WithInterfaceName("net1")),
+			)
+			err := np.applyClaimStatus(context.Background(), np.driverName, types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+				resourceapply.ResourceClaim(claim.Name, claim.Namespace).WithStatus(status))
+			if err != nil {
+				t.Fatalf("applyClaimStatus() error = %v", err)
+			}
+			got, err := kubeClient.ResourceV1().ResourceClaims(claim.Namespace).Get(context.Background(), claim.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get claim: %v", err)
+			}
+			if len(got.Status.Devices) != 1 || len(got.Status.Devices[0].Conditions) != 1 {
+				t.Fatalf("claim status was not applied: %+v", got.Status)
+			}
+			device := got.Status.Devices[0]
+			condition := device.Conditions[0]
+			if condition.Type != "Ready" || condition.Reason != "NetworkDeviceReady" || condition.Status != metav1.ConditionTrue {
+				t.Errorf("unexpected condition: %+v", condition)
+			}
+			if condition.Message != tt.wantMessage {
+				t.Errorf("condition message = %q, want %q", condition.Message, tt.wantMessage)
+			}
+			if device.NetworkData == nil || device.NetworkData.InterfaceName != "net1" {
+				t.Errorf("unexpected network data: %+v", device.NetworkData)
+			}
+		})
+	}
+}
+
+func TestRunPodSandboxRollbackOnPartialFailure(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	// Two host interfaces of the same claim, the second one fails to be
+	// configured because its gateway is not reachable.
+	okName := fmt.Sprintf("rba%x", rndString)
+	failName := fmt.Sprintf("rbb%x", rndString)
+	for i, name := range []string{okName, failName} {
+		la := netlink.NewLinkAttrs()
+		la.Name = name
+		veth := &netlink.Veth{LinkAttrs: la, PeerName: fmt.Sprintf("rbp%d%x", i, rndString)}
+		if err := netlink.LinkAdd(veth); err != nil {
+			t.Fatalf("Failed to add veth link %s: %v", name, err)
+		}
+		defer netlink.LinkDel(veth) // nolint:errcheck
+	}
+
+	podUID := types.UID("test-pod-rollback")
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+	store := mustNewPodConfigStore()
+	for deviceName, config := range map[string]DeviceConfig{
+		"a-dev": {
+			NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: okName}},
+			NetworkInterfaceConfigInPod:  apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: okName}},
+		},
+		"b-dev": {
+			NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: failName}},
+			NetworkInterfaceConfigInPod: apis.NetworkConfig{
+				Interface: apis.InterfaceConfig{Name: failName},
+				Routes:    []apis.RouteConfig{{Destination: "10.0.0.0/8", Gateway: "192.168.99.1"}},
+			},
+		},
+	} {
+		config.Claim = types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name}
+		if err := store.SetDeviceConfig(podUID, deviceName, config); err != nil {
+			t.Fatalf("SetDeviceConfig() error: %v", err)
+		}
+	}
+
+	np := &NetworkDriver{
+		driverName:     "dra.net",
+		nodeName:       "node1",
+		podConfigStore: store,
+		netdb:          inventory.New(),
+		eventRecorder:  record.NewFakeRecorder(100),
+		kubeClient:     fake.NewClientset(claim),
+	}
+	pod := &api.PodSandbox{
+		Uid:       string(podUID),
+		Name:      "test-pod",
+		Namespace: "ns",
+		Linux: &api.LinuxPodSandbox{
+			Namespaces: []*api.LinuxNamespace{
+				{Type: "network", Path: filepath.Join("/run/netns", nsName)},
+			},
+		},
+	}
+
+	if err := np.RunPodSandbox(context.Background(), pod); err == nil {
+		t.Fatalf("RunPodSandbox() expected to fail")
+	}
+
+	// Both interfaces of the claim are back in the host namespace.
+	for _, name := range []string{okName, failName} {
+		if _, err := nlwrap.LinkByName(name); err != nil {
+			t.Errorf("interface %s not returned to the host namespace: %v", name, err)
+		}
+	}
+}
+
+// TestRunPodSandboxHardwareAddrBeforeRDMA checks the MAC address of a RoCE
+// netdev is set before its RDMA link device is moved to the pod, the GIDs are
+// derived from it.
+func TestRunPodSandboxHardwareAddrBeforeRDMA(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+	// the namespace is created in the current thread
+	goruntime.LockOSThread()
+	defer goruntime.UnlockOSThread()
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	ifName := fmt.Sprintf("mac%x", rndString)
+	la := netlink.NewLinkAttrs()
+	la.Name = ifName
+	veth := &netlink.Veth{LinkAttrs: la, PeerName: fmt.Sprintf("macp%x", rndString)}
+	if err := netlink.LinkAdd(veth); err != nil {
+		t.Fatalf("Failed to add veth link %s: %v", ifName, err)
+	}
+	defer netlink.LinkDel(veth) // nolint:errcheck
+
+	hardwareAddr := "02:00:00:aa:bb:cc"
+	podUID := types.UID("test-pod-roce")
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+	store := mustNewPodConfigStore()
+	err = store.SetDeviceConfig(podUID, "roce-dev", DeviceConfig{
+		Claim:                        types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+		NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: ifName}},
+		NetworkInterfaceConfigInPod: apis.NetworkConfig{
+			Interface: apis.InterfaceConfig{Name: ifName, HardwareAddr: &hardwareAddr},
+		},
+		RDMADevice: RDMAConfig{LinkDev: "mlx5_0"},
+	})
+	if err != nil {
+		t.Fatalf("SetDeviceConfig() error: %v", err)
+	}
+
+	// Record the MAC address of the netdev in the pod when the RDMA link
+	// device is moved.
+	var rdmaMoves []string
+	np := &NetworkDriver{
+		driverName:     "dra.net",
+		nodeName:       "node1",
+		podConfigStore: store,
+		netdb:          inventory.New(),
+		eventRecorder:  record.NewFakeRecorder(100),
+		kubeClient:     fake.NewClientset(claim),
+		attachRdma: func(linkDev, ns string, _ *resourceapply.AllocatedDeviceStatusApplyConfiguration) error {
+			nhNs, err := nlwrap.NewHandleAt(testNS)
+			if err != nil {
+				return err
+			}
+			defer nhNs.Close()
+			link, err := nhNs.LinkByName(ifName)
+			if err != nil {
+				return fmt.Errorf("netdev %s not in the pod when moving RDMA device %s: %w", ifName, linkDev, err)
+			}
+			rdmaMoves = append(rdmaMoves, linkDev+" "+link.Attrs().HardwareAddr.String())
+			return nil
+		},
+	}
+	pod := &api.PodSandbox{
+		Uid:       string(podUID),
+		Name:      "test-pod",
+		Namespace: "ns",
+		Linux: &api.LinuxPodSandbox{
+			Namespaces: []*api.LinuxNamespace{
+				{Type: "network", Path: filepath.Join("/run/netns", nsName)},
+			},
+		},
+	}
+
+	if err := np.RunPodSandbox(context.Background(), pod); err != nil {
+		t.Fatalf("RunPodSandbox() failed: %v", err)
+	}
+	want := []string{"mlx5_0 " + hardwareAddr}
+	if !slices.Equal(rdmaMoves, want) {
+		t.Errorf("RDMA link moves = %v, want %v", rdmaMoves, want)
+	}
+}
+
+func TestRunPodSandboxAggregatedRDMA(t *testing.T) {
+	tests := []struct {
+		name      string
+		failOn    string
+		wantMoves []string
+		wantErr   bool
+	}{
+		{
+			name:      "all the RDMA devices are moved",
+			wantMoves: []string{"mlx5_0", "mlx5_1", "mlx5_2"},
+		},
+		{
+			name:      "failure on an aggregated RDMA device",
+			failOn:    "mlx5_1",
+			wantMoves: []string{"mlx5_0", "mlx5_1"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podUID := types.UID("test-pod-rdma-bond")
+			claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "claim1"}}
+			store := mustNewPodConfigStore()
+			// IB-only device, there is no netdev to move
+			err := store.SetDeviceConfig(podUID, "rdma-bond", DeviceConfig{
+				Claim:      types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+				RDMADevice: RDMAConfig{LinkDev: "mlx5_0", ExtraLinkDevs: []string{"mlx5_1", "mlx5_2"}},
+			})
+			if err != nil {
+				t.Fatalf("SetDeviceConfig() error: %v", err)
+			}
+
+			var rdmaMoves []string
+			np := &NetworkDriver{
+				driverName:     "dra.net",
+				nodeName:       "node1",
+				podConfigStore: store,
+				netdb:          inventory.New(),
+				eventRecorder:  record.NewFakeRecorder(100),
+				kubeClient:     fake.NewClientset(claim),
+				// the rollback does not try to return the RDMA devices
+				rdmaSharedMode: true,
+				attachRdma: func(linkDev, ns string, _ *resourceapply.AllocatedDeviceStatusApplyConfiguration) error {
+					rdmaMoves = append(rdmaMoves, linkDev)
+					if linkDev == tt.failOn {
+						return fmt.Errorf("failed to move %s", linkDev)
+					}
+					return nil
+				},
+			}
+			pod := &api.PodSandbox{
+				Uid:       string(podUID),
+				Name:      "test-pod",
+				Namespace: "ns",
+				Linux: &api.LinuxPodSandbox{
+					Namespaces: []*api.LinuxNamespace{
+						{Type: "network", Path: "/var/run/netns/test-pod"},
+					},
+				},
+			}
+
+			err = np.RunPodSandbox(context.Background(), pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunPodSandbox() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(rdmaMoves, tt.wantMoves) {
+				t.Errorf("RDMA link moves = %v, want %v", rdmaMoves, tt.wantMoves)
+			}
+		})
+	}
+}
 
 func TestSynchronizeStoresNetNSOnlyForConfiguredPods(t *testing.T) {
 	store := mustNewPodConfigStore()
@@ -672,3 +1300,75 @@ func TestRemovePodSandboxMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestSynchronizeStalePods(t *testing.T) {
+	store := mustNewPodConfigStore()
+	claim := types.NamespacedName{Namespace: "default", Name: "stopped-claim"}
+	for podUID, config := range map[types.UID]DeviceConfig{
+		"live-pod":     {},
+		"prepared-pod": {},
+		"stopped-pod":  {Claim: claim},
+	} {
+		if err := store.SetDeviceConfig(podUID, "eth0", config); err != nil {
+			t.Fatalf("SetDeviceConfig(%s) error: %v", podUID, err)
+		}
+	}
+	// The sandbox of stopped-pod ran before the plugin was disconnected.
+	store.SetPodNetNs("stopped-pod", "/var/run/netns/stopped")
+
+	np := &NetworkDriver{
+		podConfigStore: store,
+		netdb:          inventory.New(),
+	}
+
+	pods := []*api.PodSandbox{
+		{
+			Uid:       "live-pod",
+			Name:      "live",
+			Namespace: "default",
+			Linux: &api.LinuxPodSandbox{
+				Namespaces: []*api.LinuxNamespace{
+					{Type: "network", Path: "/var/run/netns/live"},
+				},
+			},
+		},
+	}
+
+	if _, err := np.Synchronize(context.Background(), pods, nil); err != nil {
+		t.Fatalf("Synchronize() error: %v", err)
+	}
+
+	if podConfig, found := store.GetPodConfig("live-pod"); !found || podConfig.NetNS != "/var/run/netns/live" {
+		t.Errorf("live-pod config = %+v, found %v, want its network namespace", podConfig, found)
+	}
+	// The claims are prepared before the sandbox is created.
+	if _, found := store.GetPodConfig("prepared-pod"); !found {
+		t.Error("prepared-pod should keep its config")
+	}
+	podConfig, found := store.GetPodConfig("stopped-pod")
+	if !found {
+		t.Fatal("stopped-pod config should be kept until its claim is unprepared")
+	}
+	if podConfig.NetNS != "" {
+		t.Errorf("stopped-pod NetNS = %q, want it cleared", podConfig.NetNS)
+	}
+
+	if err := np.unprepareResourceClaim(context.Background(), kubeletplugin.NamespacedObject{NamespacedName: claim}); err != nil {
+		t.Fatalf("unprepareResourceClaim() error: %v", err)
+	}
+	if _, found := store.GetPodConfig("stopped-pod"); found {
+		t.Error("stopped-pod config should be removed once its claim is unprepared")
+	}
+}
+
+func TestDeviceStatusData(t *testing.T) {
+	config := &DeviceConfig{DHCPOptions: map[int][]byte{42: {192, 168, 10, 1}, 100: []byte("UTC")}}
+	data, err := deviceStatusData(config)
+	if err != nil {
+		t.Fatalf("deviceStatusData() failed: %v", err)
+	}
+	want := `{"dhcpOptions":{"100":"VVRD","42":"wKgKAQ=="}}`
+	if string(data.Raw) != want {
+		t.Errorf("deviceStatusData() = %s, want %s", data.Raw, want)
+	}
+}
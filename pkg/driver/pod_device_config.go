@@ -17,10 +17,14 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
+	"fmt"
+	"net"
 	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/dranet/pkg/apis"
 )
@@ -57,9 +61,105 @@ type DeviceConfig struct {
 	// Pod's namespace.
 	NetworkInterfaceConfigInPod apis.NetworkConfig `json:"networkInterfaceConfigInPod"`
 
+	// RequestedConfig is the configuration of the claim for this device,
+	// before the addresses and routes found in the host are added to it. A
+	// configuration update of the claim of a running Pod is compared with it
+	// to find the settings that changed. It is empty for the devices
+	// checkpointed by the versions of the driver that did not store it.
+	RequestedConfig apis.NetworkConfig `json:"requestedConfig"`
+
 	// RDMADevice holds RDMA-specific configurations if the network device
 	// has associated RDMA capabilities.
 	RDMADevice RDMAConfig `json:"rdmaDevice,omitempty"`
+
+	// VFIODevice holds the VFIO configuration of a PCI device bound to
+	// vfio-pci, which has no network interface.
+	VFIODevice VFIOConfig `json:"vfioDevice,omitempty"`
+
+	// PCIAddress is the PCI address of the network interface at the time the
+	// claim was prepared, used to find the interface if it was renamed before
+	// it is moved to the pod's network namespace.
+	PCIAddress string `json:"pciAddress,omitempty"`
+
+	// PreservedAddresses are the addresses of the network interface in the
+	// host namespace that are moved with their scope and flags to the pod's
+	// network namespace when preserveAllAddresses is set.
+	PreservedAddresses []AddressConfig `json:"preservedAddresses,omitempty"`
+
+	// ChildInterface is true when the interface in the pod is a child
+	// interface, e.g. a macvlan, created by the driver on top of the shared
+	// device of NetworkInterfaceConfigInHost. It is deleted when the pod stops
+	// instead of being moved back to the host.
+	ChildInterface bool `json:"childInterface,omitempty"`
+
+	// DHCPOptions are the raw values, keyed by option code, of the options
+	// of dhcpRequestOptions returned by the DHCP server in the lease,
+	// published in the data of the device in the ResourceClaim status.
+	DHCPOptions map[int][]byte `json:"dhcpOptions,omitempty"`
+
+	// DHCPDomainName and DHCPSearchDomains are the DNS domain name (option
+	// 15) and domain search list (option 119) of the DHCP lease, for the
+	// resolver configuration of the pod.
+	DHCPDomainName    string   `json:"dhcpDomainName,omitempty"`
+	DHCPSearchDomains []string `json:"dhcpSearchDomains,omitempty"`
+
+	// DHCPLease is the DHCP lease of the interface, renewed from the pod's
+	// network namespace while the pod runs.
+	DHCPLease *DHCPLease `json:"dhcpLease,omitempty"`
+
+	// HostState is the state of the network interface in the host namespace
+	// captured before it is moved to the pod's network namespace, restored
+	// when the interface is returned to the host.
+	HostState *HostInterfaceState `json:"hostState,omitempty"`
+}
+
+// HostInterfaceState holds the settings of a network interface in the host
+// namespace that the driver or the pod may change while it is attached.
+type HostInterfaceState struct {
+	MTU int `json:"mtu,omitempty"`
+	// HardwareAddr is the MAC address, changed by the hardwareAddr of the
+	// configuration or by the Pod.
+	HardwareAddr string `json:"hardwareAddr,omitempty"`
+	// EthtoolFeatures are the changeable ethtool features and their values.
+	EthtoolFeatures map[string]bool `json:"ethtoolFeatures,omitempty"`
+}
+
+// DHCPLease is a DHCPv4 lease and the routing configuration derived from it.
+type DHCPLease struct {
+	// Address is the leased address in CIDR notation.
+	Address string `json:"address"`
+	// ServerID is the server identifier (option 54) of the server that
+	// granted the lease, the renewals are unicast to it.
+	ServerID string `json:"serverID,omitempty"`
+	// HardwareAddr identifies the client to the server, it is the hardware
+	// address of the interface when the lease was obtained, before it is
+	// changed by the hardwareAddr of the configuration.
+	HardwareAddr string `json:"hardwareAddr"`
+	// Obtained is the time the DHCPACK was received, the lease times start
+	// from it.
+	Obtained time.Time `json:"obtained"`
+	// LeaseTime is the duration of the lease (option 51), RenewalTime (T1,
+	// option 58) and RebindingTime (T2, option 59) are when the lease is
+	// renewed from its server and from any server.
+	LeaseTime     time.Duration `json:"leaseTime"`
+	RenewalTime   time.Duration `json:"renewalTime"`
+	RebindingTime time.Duration `json:"rebindingTime"`
+	// Routes and Rules are the routing configuration of the interface
+	// derived from the lease.
+	Routes []apis.RouteConfig `json:"routes,omitempty"`
+	Rules  []apis.RuleConfig  `json:"rules,omitempty"`
+}
+
+// AddressConfig is an address of a network interface with its scope, flags
+// and broadcast address, as reported by netlink.
+type AddressConfig struct {
+	// Address in CIDR notation.
+	Address string `json:"address"`
+	Scope   int    `json:"scope,omitempty"`
+	Flags   int    `json:"flags,omitempty"`
+	// Broadcast is the IPv4 broadcast address, empty for the broadcast
+	// address of the subnet.
+	Broadcast string `json:"broadcast,omitempty"`
 }
 
 // RDMAConfig contains parameters for setting up an RDMA device associated
@@ -70,10 +170,38 @@ type RDMAConfig struct {
 	// associated. For IB-only devices there is no associated network interface.
 	LinkDev string `json:"linkDev,omitempty"`
 
+	// ExtraLinkDevs are the other RDMA link devices of the network interface
+	// when it aggregates the ports of several RDMA devices, e.g. a RoCE bond.
+	// They are moved to the Pod with LinkDev.
+	ExtraLinkDevs []string `json:"extraLinkDevs,omitempty"`
+
 	// DevChars is a list of user-space RDMA character
 	// devices (e.g., "/dev/infiniband/uverbs0", "/dev/infiniband/rdma_cm")
 	// that should be made available to the Pod.
 	DevChars []LinuxDevice `json:"devChars,omitempty"`
+
+	// DeviceMode overrides the file mode of DevChars in the containers, it is
+	// set from the rdmaDeviceMode of the claim configuration.
+	DeviceMode *uint32 `json:"deviceMode,omitempty"`
+}
+
+// LinkDevs returns all the RDMA link devices, LinkDev first.
+func (c RDMAConfig) LinkDevs() []string {
+	if c.LinkDev == "" {
+		return nil
+	}
+	return append([]string{c.LinkDev}, c.ExtraLinkDevs...)
+}
+
+// VFIOConfig contains the character devices giving a Pod access to a PCI
+// device bound to vfio-pci, e.g. for DPDK.
+type VFIOConfig struct {
+	// IOMMUGroup is the IOMMU group of the PCI device.
+	IOMMUGroup string `json:"iommuGroup,omitempty"`
+
+	// DevChars are the VFIO container device "/dev/vfio/vfio" and the group
+	// device "/dev/vfio/<group>" that should be made available to the Pod.
+	DevChars []LinuxDevice `json:"devChars,omitempty"`
 }
 
 type LinuxDevice struct {
@@ -244,6 +372,44 @@ func (s *PodConfigStore) ListPods() []types.UID {
 	return uids
 }
 
+// PCIAddresses returns the PCI addresses of all the devices allocated to pods.
+func (s *PodConfigStore) PCIAddresses() sets.Set[string] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addresses := sets.New[string]()
+	for _, podConfig := range s.configs {
+		for _, config := range podConfig.DeviceConfigs {
+			if config.PCIAddress != "" {
+				addresses.Insert(config.PCIAddress)
+			}
+		}
+	}
+	return addresses
+}
+
+// HardwareAddrOwner returns the Pod UID and the name of the device, other than
+// deviceName of podUID, whose interface is configured in the Pod with the
+// hardware address.
+func (s *PodConfigStore) HardwareAddrOwner(hwAddr net.HardwareAddr, podUID types.UID, deviceName string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for uid, podConfig := range s.configs {
+		for name, config := range podConfig.DeviceConfigs {
+			if uid == podUID && name == deviceName {
+				continue
+			}
+			configured := config.NetworkInterfaceConfigInPod.Interface.HardwareAddr
+			if configured == nil {
+				continue
+			}
+			if addr, err := net.ParseMAC(*configured); err == nil && bytes.Equal(addr, hwAddr) {
+				return fmt.Sprintf("%s of pod %s", name, uid), true
+			}
+		}
+	}
+	return "", false
+}
+
 // GetPodConfig retrieves all configurations for a given Pod UID.
 // It is indexed by the Pod's UID.
 func (s *PodConfigStore) GetPodConfig(podUID types.UID) (PodConfig, bool) {
@@ -164,6 +164,11 @@ func TestPodConfigStore_Persistence(t *testing.T) {
 				{Path: "/dev/infiniband/uverbs0", Type: "c", Major: 231, Minor: 0},
 			},
 		},
+		PCIAddress: "0000:8c:00.0",
+		PreservedAddresses: []AddressConfig{
+			{Address: "192.168.1.10/24", Scope: 0, Flags: 0x80},
+			{Address: "fe80::1/64", Scope: 253},
+		},
 	}
 
 	// Write data via PodConfigStore and close.
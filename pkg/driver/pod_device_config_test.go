@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/dranet/pkg/apis"
 )
 
@@ -407,3 +408,23 @@ func TestPodConfigStore_NoDuplicateDevices(t *testing.T) {
 		t.Errorf("Device %s not found in pod configs", deviceName2)
 	}
 }
+
+func TestPodConfigStore_PCIAddresses(t *testing.T) {
+	store := mustNewPodConfigStore()
+	store.SetDeviceConfig("pod-1", "dev-1", DeviceConfig{PCIAddress: "0000:3b:02.0"}) //nolint:errcheck
+	store.SetDeviceConfig("pod-1", "dev-2", DeviceConfig{PCIAddress: "0000:3b:02.1"}) //nolint:errcheck
+	store.SetDeviceConfig("pod-2", "dev-3", DeviceConfig{PCIAddress: "0000:5e:02.0"}) //nolint:errcheck
+	// Virtual devices have no PCI address.
+	store.SetDeviceConfig("pod-2", "dummy0", DeviceConfig{}) //nolint:errcheck
+
+	want := sets.New("0000:3b:02.0", "0000:3b:02.1", "0000:5e:02.0")
+	if got := store.PCIAddresses(); !got.Equal(want) {
+		t.Errorf("PCIAddresses() = %v, want %v", sets.List(got), sets.List(want))
+	}
+
+	store.DeletePod("pod-1")
+	want = sets.New("0000:5e:02.0")
+	if got := store.PCIAddresses(); !got.Equal(want) {
+		t.Errorf("PCIAddresses() after DeletePod = %v, want %v", sets.List(got), sets.List(want))
+	}
+}
@@ -0,0 +1,311 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netns"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// The settings of a claim that can be updated while its Pod runs are the MTU
+// of the interface, the ethtool settings and the routes. The rest, e.g. the
+// name or the hardware address of the interface, is only applied when the
+// device is attached to the Pod.
+//
+// The configuration of the devices of a running Pod is resolved again, from its
+// claims, the cloud provider and the profiles, when one of the containers of
+// the Pod is updated, e.g. resized in place, and when the kubelet prepares the
+// claims again after a restart. The changes of the updatable settings are then
+// applied to the interfaces in the Pod.
+
+// PostUpdateContainer applies the changes of the configuration of the devices
+// of the Pod once one of its containers was updated. The update of the
+// container already happened, the errors are reported as events of the claims.
+func (np *NetworkDriver) PostUpdateContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) error {
+	klog.V(2).Infof("PostUpdateContainer Pod %s/%s UID %s Container %s", pod.Namespace, pod.Name, pod.Uid, ctr.Name)
+	start := time.Now()
+	status := statusNoop
+	defer func() {
+		nriPluginRequestsTotal.WithLabelValues(methodPostUpdateContainer, status).Inc()
+		nriPluginRequestsLatencySeconds.WithLabelValues(methodPostUpdateContainer, status).Observe(time.Since(start).Seconds())
+	}()
+	podConfig, ok := np.podConfigStore.GetPodConfig(types.UID(pod.GetUid()))
+	if !ok || podConfig.NetNS == "" {
+		return nil
+	}
+	if np.updateRunningDevices(ctx, types.UID(pod.GetUid()), podConfig) {
+		status = statusSuccess
+	} else {
+		status = statusFailed
+	}
+	return nil
+}
+
+// updateRunningDevices resolves again the configuration of the devices of the
+// running Pod from their claims and applies the changes. It returns false if
+// the configuration of a device could not be resolved or updated.
+func (np *NetworkDriver) updateRunningDevices(ctx context.Context, podUID types.UID, podConfig PodConfig) bool {
+	devicesByClaim := map[types.NamespacedName][]string{}
+	for deviceName, config := range podConfig.DeviceConfigs {
+		if config.Claim.Name == "" {
+			continue
+		}
+		devicesByClaim[config.Claim] = append(devicesByClaim[config.Claim], deviceName)
+	}
+	succeeded := true
+	for claimName, devices := range devicesByClaim {
+		claim, err := np.kubeClient.ResourceV1().ResourceClaims(claimName.Namespace).Get(ctx, claimName.Name, metav1.GetOptions{})
+		if err != nil {
+			klog.Infof("failed to get claim %s of running pod %s: %v", claimName, podUID, err)
+			succeeded = false
+			continue
+		}
+		if claim.Status.Allocation == nil {
+			continue
+		}
+		var errorList []error
+		for _, result := range claim.Status.Allocation.Devices.Results {
+			if result.Driver != np.driverName || !slices.Contains(devices, result.Device) {
+				continue
+			}
+			current, ns, ok := np.runningDeviceConfig(podUID, result.Device)
+			if !ok {
+				continue
+			}
+			userConf, errs := np.claimUserConfig(claim, result.Request)
+			if len(errs) > 0 {
+				errorList = append(errorList, errs...)
+				continue
+			}
+			requested, err := np.getDeviceNetworkConfig(result.Device, claim.UID, userConf)
+			if err != nil {
+				errorList = append(errorList, err)
+				continue
+			}
+			if err := np.updateDeviceConfig(podUID, ns, result.Device, current, *requested); err != nil {
+				errorList = append(errorList, fmt.Errorf("failed to update the configuration of device %s of running pod %s: %w", result.Device, podUID, err))
+			}
+		}
+		if err := errors.Join(errorList...); err != nil {
+			klog.Infof("failed to update the devices of claim %s of running pod %s: %v", claimName, podUID, err)
+			np.eventRecorder.Eventf(claim, v1.EventTypeWarning, reasonConfigUpdateFailed, "%v", err)
+			succeeded = false
+		}
+	}
+	return succeeded
+}
+
+// runningDeviceConfig returns the stored configuration of the device and the
+// network namespace of the Pod if the network interface of the device is
+// already in the namespace of the running Pod.
+func (np *NetworkDriver) runningDeviceConfig(podUID types.UID, deviceName string) (DeviceConfig, string, bool) {
+	podConfig, ok := np.podConfigStore.GetPodConfig(podUID)
+	if !ok || podConfig.NetNS == "" {
+		return DeviceConfig{}, "", false
+	}
+	config, ok := podConfig.DeviceConfigs[deviceName]
+	if !ok || config.NetworkInterfaceConfigInHost.Interface.Name == "" {
+		return DeviceConfig{}, "", false
+	}
+	if !linkExistsAt(podConfig.NetNS, config.NetworkInterfaceConfigInPod.Interface.Name) {
+		return DeviceConfig{}, "", false
+	}
+	return config, podConfig.NetNS, true
+}
+
+// linkExistsAt returns true if the namespace has an interface with that name.
+func linkExistsAt(containerNsPath string, ifName string) bool {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return false
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return false
+	}
+	defer nhNs.Close()
+
+	_, err = nhNs.LinkByName(ifName)
+	return err == nil
+}
+
+// checkConfigUpdate returns an error if the requested configuration changes
+// other settings than the ones that can be updated on a running Pod.
+func checkConfigUpdate(current, requested apis.NetworkConfig) error {
+	var errorList []error
+	if current.Interface.Name != requested.Interface.Name {
+		errorList = append(errorList, fmt.Errorf("the interface name can not be changed from %q to %q on a running pod", current.Interface.Name, requested.Interface.Name))
+	}
+	if !ptr.Equal(current.Interface.HardwareAddr, requested.Interface.HardwareAddr) {
+		errorList = append(errorList, fmt.Errorf("the hardware address can not be changed on a running pod"))
+	}
+	current.Interface.Name, requested.Interface.Name = "", ""
+	current.Interface.HardwareAddr, requested.Interface.HardwareAddr = nil, nil
+	current.Interface.MTU, requested.Interface.MTU = nil, nil
+	current.Ethtool, requested.Ethtool = nil, nil
+	current.Routes, requested.Routes = nil, nil
+	if len(errorList) == 0 && !equality.Semantic.DeepEqual(current, requested) {
+		errorList = append(errorList, fmt.Errorf("only the mtu, the ethtool settings and the routes can be changed on a running pod"))
+	}
+	return errors.Join(errorList...)
+}
+
+// routesDelta returns the routes of current that are not requested anymore
+// and the requested routes that are not in current.
+func routesDelta(current, requested []apis.RouteConfig) (removed, added []apis.RouteConfig) {
+	for _, route := range current {
+		if !slices.ContainsFunc(requested, func(r apis.RouteConfig) bool { return reflect.DeepEqual(r, route) }) {
+			removed = append(removed, route)
+		}
+	}
+	for _, route := range requested {
+		if !slices.ContainsFunc(current, func(r apis.RouteConfig) bool { return reflect.DeepEqual(r, route) }) {
+			added = append(added, route)
+		}
+	}
+	return removed, added
+}
+
+// previousRequestedConfig returns the configuration of the claim the device
+// was prepared with. The devices checkpointed before it was stored have an
+// empty RequestedConfig, their configuration in the Pod is used instead, but as
+// it also has the settings found in the host, the settings that can not be
+// updated are assumed unchanged and the requested routes are only added.
+func previousRequestedConfig(current DeviceConfig, requested apis.NetworkConfig) apis.NetworkConfig {
+	if !equality.Semantic.DeepEqual(current.RequestedConfig, apis.NetworkConfig{}) {
+		return current.RequestedConfig
+	}
+	previous := requested
+	previous.Interface.MTU = current.NetworkInterfaceConfigInPod.Interface.MTU
+	previous.Ethtool = current.NetworkInterfaceConfigInPod.Ethtool
+	previous.Routes = slices.DeleteFunc(slices.Clone(requested.Routes), func(r apis.RouteConfig) bool {
+		return !slices.ContainsFunc(current.NetworkInterfaceConfigInPod.Routes, func(route apis.RouteConfig) bool { return reflect.DeepEqual(r, route) })
+	})
+	return previous
+}
+
+// updateDeviceConfig applies to the interface of a running Pod the changes of
+// the updatable settings of the requested configuration and stores the
+// updated configuration. A setting removed from the configuration, e.g. the
+// MTU, keeps its current value on the interface.
+func (np *NetworkDriver) updateDeviceConfig(podUID types.UID, ns string, deviceName string, current DeviceConfig, requested apis.NetworkConfig) error {
+	previous := previousRequestedConfig(current, requested)
+	if err := checkConfigUpdate(previous, requested); err != nil {
+		return err
+	}
+	ifName := current.NetworkInterfaceConfigInPod.Interface.Name
+	updated := current
+	updated.RequestedConfig = requested
+
+	if mtu := requested.Interface.MTU; mtu != nil && !ptr.Equal(mtu, previous.Interface.MTU) {
+		klog.V(2).Infof("Updating the MTU of interface %s in ns %s to %d", ifName, ns, *mtu)
+		if err := applyMTUConfig(ns, ifName, int(*mtu)); err != nil {
+			return err
+		}
+		updated.NetworkInterfaceConfigInPod.Interface.MTU = mtu
+	}
+
+	if ethtoolConfig := requested.Ethtool; ethtoolConfig != nil && !equality.Semantic.DeepEqual(ethtoolConfig, previous.Ethtool) {
+		klog.V(2).Infof("Updating the ethtool configuration of interface %s in ns %s", ifName, ns)
+		resolved, err := np.applyEthtoolConfigUpdate(ns, ifName, ethtoolConfig)
+		if err != nil {
+			return err
+		}
+		updated.NetworkInterfaceConfigInPod.Ethtool = resolved
+	}
+
+	removed, added := routesDelta(previous.Routes, requested.Routes)
+	if len(removed) > 0 || len(added) > 0 {
+		klog.V(2).Infof("Updating the routes of interface %s in ns %s: removing %d, adding %d", ifName, ns, len(removed), len(added))
+		vrfTable := 0
+		if vrf := current.NetworkInterfaceConfigInPod.Interface.VRF; vrf != nil && vrf.Table != nil {
+			vrfTable = int(*vrf.Table)
+		}
+		// The routes are removed first, a route can be updated in place.
+		if err := removeRoutingConfig(ns, ifName, removed, vrfTable); err != nil {
+			return err
+		}
+		if _, err := applyRoutingConfig(ns, ifName, slices.Clone(added), vrfTable); err != nil {
+			return err
+		}
+		routes := slices.DeleteFunc(slices.Clone(current.NetworkInterfaceConfigInPod.Routes), func(r apis.RouteConfig) bool {
+			return slices.ContainsFunc(removed, func(route apis.RouteConfig) bool { return reflect.DeepEqual(r, route) })
+		})
+		updated.NetworkInterfaceConfigInPod.Routes = append(routes, added...)
+	}
+
+	return np.podConfigStore.SetDeviceConfig(podUID, deviceName, updated)
+}
+
+// applyEthtoolConfigUpdate applies the ethtool configuration to the interface
+// in the Pod namespace and returns it with the features resolved to their
+// kernel names. The features denied on the node are rejected, and the fixed
+// ones skipped by the policy, as they are when the claim is prepared.
+func (np *NetworkDriver) applyEthtoolConfigUpdate(containerNsPath string, ifName string, config *apis.EthtoolConfig) (*apis.EthtoolConfig, error) {
+	targetNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer targetNs.Close()
+
+	client, err := newEthtoolClient(int(targetNs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ethtool client in namespace %s: %w", containerNsPath, err)
+	}
+	defer client.Close()
+
+	ifFeatures, err := client.GetFeatures(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("fail to get ethtool features %v", err)
+	}
+	if denied := deniedEthtoolFeatures(config, np.deniedEthtoolFeatures, ifFeatures); len(denied) > 0 {
+		return nil, fmt.Errorf("ethtool features %v are not allowed to be changed on node %s", denied, np.nodeName)
+	}
+	resolved, errs := resolveEthtoolFeatures(config, ifFeatures)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if np.ethtoolFixedFeaturePolicy == EthtoolFixedFeaturePolicySkip {
+		var skipped []string
+		resolved, skipped = skipFixedEthtoolFeatures(resolved, ifFeatures)
+		if len(skipped) > 0 {
+			klog.Warningf("skipping the fixed ethtool features %v of interface %s in %s", skipped, ifName, containerNsPath)
+		}
+	}
+	if err := applyEthtoolSettings(client, containerNsPath, ifName, resolved, withLinkDownAt(targetNs, ifName)); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
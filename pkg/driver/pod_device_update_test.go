@@ -0,0 +1,409 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/google/go-cmp/cmp"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestCheckConfigUpdate(t *testing.T) {
+	current := apis.NetworkConfig{
+		Interface: apis.InterfaceConfig{
+			Name:      "net1",
+			MTU:       ptr.To[int32](1500),
+			Addresses: []string{"10.0.0.2/24"},
+		},
+		Routes: []apis.RouteConfig{{Destination: "10.1.0.0/16", Gateway: "10.0.0.1"}},
+	}
+	tests := []struct {
+		name    string
+		update  func(*apis.NetworkConfig)
+		wantErr bool
+	}{
+		{
+			name:   "no change",
+			update: func(*apis.NetworkConfig) {},
+		},
+		{
+			name: "mtu, ethtool and routes",
+			update: func(c *apis.NetworkConfig) {
+				c.Interface.MTU = ptr.To[int32](9000)
+				c.Ethtool = &apis.EthtoolConfig{Features: map[string]bool{"tso": false}}
+				c.Routes = []apis.RouteConfig{{Destination: "10.2.0.0/16", Gateway: "10.0.0.1"}}
+			},
+		},
+		{
+			name:    "interface name",
+			update:  func(c *apis.NetworkConfig) { c.Interface.Name = "net2" },
+			wantErr: true,
+		},
+		{
+			name:    "hardware address",
+			update:  func(c *apis.NetworkConfig) { c.Interface.HardwareAddr = ptr.To("02:00:00:00:00:01") },
+			wantErr: true,
+		},
+		{
+			name:    "addresses",
+			update:  func(c *apis.NetworkConfig) { c.Interface.Addresses = []string{"10.0.0.3/24"} },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested := current
+			requested.Interface.Addresses = []string{"10.0.0.2/24"}
+			tt.update(&requested)
+			err := checkConfigUpdate(current, requested)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkConfigUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoutesDelta(t *testing.T) {
+	kept := apis.RouteConfig{Destination: "10.1.0.0/16", Gateway: "10.0.0.1"}
+	old := apis.RouteConfig{Destination: "10.2.0.0/16", Gateway: "10.0.0.1"}
+	changed := apis.RouteConfig{Destination: "10.3.0.0/16", Gateway: "10.0.0.1"}
+	changedMetric := apis.RouteConfig{Destination: "10.3.0.0/16", Gateway: "10.0.0.1", Metric: ptr.To(100)}
+	added := apis.RouteConfig{Destination: "10.4.0.0/16", Gateway: "10.0.0.1"}
+
+	gotRemoved, gotAdded := routesDelta(
+		[]apis.RouteConfig{kept, old, changed},
+		[]apis.RouteConfig{kept, changedMetric, added},
+	)
+	if diff := cmp.Diff([]apis.RouteConfig{old, changed}, gotRemoved); diff != "" {
+		t.Errorf("routesDelta() removed routes (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]apis.RouteConfig{changedMetric, added}, gotAdded); diff != "" {
+		t.Errorf("routesDelta() added routes (-want +got):\n%s", diff)
+	}
+}
+
+func TestPreviousRequestedConfig(t *testing.T) {
+	hostRoute := apis.RouteConfig{Destination: "10.1.0.0/16", Gateway: "10.0.0.1"}
+	route := apis.RouteConfig{Destination: "10.2.0.0/16", Gateway: "10.0.0.1"}
+	newRoute := apis.RouteConfig{Destination: "10.3.0.0/16", Gateway: "10.0.0.1"}
+	inPod := apis.NetworkConfig{
+		Interface: apis.InterfaceConfig{Name: "eth1", MTU: ptr.To[int32](1500), Addresses: []string{"10.0.0.2/24"}},
+		Routes:    []apis.RouteConfig{hostRoute, route},
+	}
+	requested := apis.NetworkConfig{
+		Interface: apis.InterfaceConfig{MTU: ptr.To[int32](9000)},
+		Routes:    []apis.RouteConfig{route, newRoute},
+	}
+
+	t.Run("stored", func(t *testing.T) {
+		stored := apis.NetworkConfig{Interface: apis.InterfaceConfig{MTU: ptr.To[int32](1400)}}
+		got := previousRequestedConfig(DeviceConfig{NetworkInterfaceConfigInPod: inPod, RequestedConfig: stored}, requested)
+		if diff := cmp.Diff(stored, got); diff != "" {
+			t.Errorf("previousRequestedConfig() (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("checkpointed without the requested configuration", func(t *testing.T) {
+		got := previousRequestedConfig(DeviceConfig{NetworkInterfaceConfigInPod: inPod}, requested)
+		if err := checkConfigUpdate(got, requested); err != nil {
+			t.Errorf("checkConfigUpdate() = %v, want nil", err)
+		}
+		if got.Interface.MTU == nil || *got.Interface.MTU != 1500 {
+			t.Errorf("previousRequestedConfig() MTU = %v, want 1500", got.Interface.MTU)
+		}
+		removed, added := routesDelta(got.Routes, requested.Routes)
+		if len(removed) != 0 {
+			t.Errorf("routesDelta() removed %v, want none", removed)
+		}
+		if diff := cmp.Diff([]apis.RouteConfig{newRoute}, added); diff != "" {
+			t.Errorf("routesDelta() added routes (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestUpdateDeviceConfigLiveMTU(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	// The interface of the running pod, already configured when the device
+	// was attached.
+	ifaceName := "net1"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	la.MTU = 1500
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	if err := nhNs.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	addr, err := netlink.ParseAddr("192.168.52.2/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nhNs.AddrAdd(link, addr); err != nil {
+		t.Fatalf("Failed to add address to %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	nsPath := path.Join("/run/netns", nsName)
+	oldRoute := apis.RouteConfig{Destination: "10.52.0.0/16", Gateway: "192.168.52.1"}
+	newRoute := apis.RouteConfig{Destination: "10.53.0.0/16", Gateway: "192.168.52.1"}
+	if _, err := applyRoutingConfig(nsPath, ifaceName, []apis.RouteConfig{oldRoute}, 0); err != nil {
+		t.Fatalf("applyRoutingConfig() failed: %v", err)
+	}
+
+	requested := apis.NetworkConfig{
+		Interface: apis.InterfaceConfig{Name: ifaceName, MTU: ptr.To[int32](1500)},
+		Routes:    []apis.RouteConfig{oldRoute},
+	}
+	inPod := requested
+	inPod.Interface.Addresses = []string{"192.168.52.2/24"}
+	current := DeviceConfig{
+		Claim:                        types.NamespacedName{Namespace: "default", Name: "claim"},
+		NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: "eth1"}},
+		NetworkInterfaceConfigInPod:  inPod,
+		RequestedConfig:              requested,
+	}
+	podUID := types.UID("pod-uid")
+	np := &NetworkDriver{podConfigStore: mustNewPodConfigStore()}
+	if err := np.podConfigStore.SetDeviceConfig(podUID, "dev1", current); err != nil {
+		t.Fatal(err)
+	}
+	np.podConfigStore.SetPodNetNs(podUID, nsPath)
+
+	got, ns, ok := np.runningDeviceConfig(podUID, "dev1")
+	if !ok || ns != nsPath {
+		t.Fatalf("runningDeviceConfig() = %v, %v, want the device running in %s", ns, ok, nsPath)
+	}
+
+	update := requested
+	update.Interface.MTU = ptr.To[int32](9000)
+	update.Routes = []apis.RouteConfig{newRoute}
+	if err := np.updateDeviceConfig(podUID, ns, "dev1", got, update); err != nil {
+		t.Fatalf("updateDeviceConfig() failed: %v", err)
+	}
+
+	nsLink, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtu := nsLink.Attrs().MTU; mtu != 9000 {
+		t.Errorf("interface MTU = %d, want 9000", mtu)
+	}
+	routes, err := nhNs.RouteList(nsLink, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var destinations []string
+	for _, route := range routes {
+		if route.Protocol == routeProtocolDranet {
+			destinations = append(destinations, route.Dst.String())
+		}
+	}
+	if diff := cmp.Diff([]string{newRoute.Destination}, destinations); diff != "" {
+		t.Errorf("routes of the interface (-want +got):\n%s", diff)
+	}
+	// The address is not part of the update and is kept.
+	addrs, err := nhNs.AddrList(nsLink, netlink.FAMILY_V4)
+	if err != nil || len(addrs) != 1 || !addrs[0].IP.Equal(net.ParseIP("192.168.52.2")) {
+		t.Errorf("interface addresses = %v, %v, want 192.168.52.2", addrs, err)
+	}
+
+	stored, ok := np.podConfigStore.GetDeviceConfig(podUID, "dev1")
+	if !ok {
+		t.Fatal("device config not found after the update")
+	}
+	if diff := cmp.Diff(update, stored.RequestedConfig); diff != "" {
+		t.Errorf("stored requested config (-want +got):\n%s", diff)
+	}
+	wantInPod := update
+	wantInPod.Interface.Addresses = []string{"192.168.52.2/24"}
+	if diff := cmp.Diff(wantInPod, stored.NetworkInterfaceConfigInPod); diff != "" {
+		t.Errorf("stored config in pod (-want +got):\n%s", diff)
+	}
+
+	// The name of the interface can not be changed on a running pod.
+	rename := update
+	rename.Interface.Name = "net2"
+	if err := np.updateDeviceConfig(podUID, ns, "dev1", stored, rename); err == nil {
+		t.Errorf("updateDeviceConfig() renaming the interface succeeded, want error")
+	}
+}
+
+func TestPostUpdateContainerLiveMTU(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "net1"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	la.MTU = 1500
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	// The claim of the running pod was updated from an MTU of 1500 to 9000.
+	claim := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim", UID: "claim-uid"},
+		Status: resourceapi.ResourceClaimStatus{
+			Allocation: &resourceapi.AllocationResult{
+				Devices: resourceapi.DeviceAllocationResult{
+					Results: []resourceapi.DeviceRequestAllocationResult{{Driver: "test.driver", Request: "req", Device: "dev1"}},
+					Config: []resourceapi.DeviceAllocationConfiguration{{
+						Source: resourceapi.AllocationConfigSourceClaim,
+						DeviceConfiguration: resourceapi.DeviceConfiguration{
+							Opaque: &resourceapi.OpaqueDeviceConfiguration{
+								Driver:     "test.driver",
+								Parameters: k8sruntime.RawExtension{Raw: []byte(`{"interface":{"name":"net1","mtu":9000}}`)},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+	requested := apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: ifaceName, MTU: ptr.To[int32](1500)}}
+	current := DeviceConfig{
+		Claim:                        types.NamespacedName{Namespace: "default", Name: "claim"},
+		NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: "eth1"}},
+		NetworkInterfaceConfigInPod:  requested,
+		RequestedConfig:              requested,
+	}
+	podUID := types.UID("pod-uid")
+	np := &NetworkDriver{
+		driverName:     "test.driver",
+		kubeClient:     fake.NewClientset(claim),
+		netdb:          newFakeInventoryDB(),
+		eventRecorder:  record.NewFakeRecorder(10),
+		podConfigStore: mustNewPodConfigStore(),
+	}
+	if err := np.podConfigStore.SetDeviceConfig(podUID, "dev1", current); err != nil {
+		t.Fatal(err)
+	}
+	np.podConfigStore.SetPodNetNs(podUID, path.Join("/run/netns", nsName))
+
+	pod := &api.PodSandbox{Uid: string(podUID), Namespace: "default", Name: "pod"}
+	if err := np.PostUpdateContainer(context.Background(), pod, &api.Container{Name: "app"}); err != nil {
+		t.Fatalf("PostUpdateContainer() failed: %v", err)
+	}
+
+	nsLink, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtu := nsLink.Attrs().MTU; mtu != 9000 {
+		t.Errorf("interface MTU = %d, want 9000", mtu)
+	}
+	stored, ok := np.podConfigStore.GetDeviceConfig(podUID, "dev1")
+	if !ok {
+		t.Fatal("device config not found after the update")
+	}
+	if mtu := stored.NetworkInterfaceConfigInPod.Interface.MTU; mtu == nil || *mtu != 9000 {
+		t.Errorf("stored MTU = %v, want 9000", mtu)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+const (
+	// rateLimitBurstTime is the time the traffic can exceed the rate, the
+	// burst of the token bucket is the rate over that time.
+	rateLimitBurstTime = 10 * time.Millisecond
+	// rateLimitMinBurst is the minimum burst in bytes, large enough for the
+	// GSO packets of 64KiB.
+	rateLimitMinBurst = 256 * 1024
+	// rateLimitLatency is the maximum time a packet waits in the token bucket
+	// filter queue before being dropped.
+	rateLimitLatency = 50 * time.Millisecond
+	// rateLimitPoliceMTU is the size of the largest packet the police action
+	// lets through, the GSO packets are policed before being segmented.
+	rateLimitPoliceMTU = math.MaxUint16
+	// rateLimitFilterPriority is the priority of the ingress filter policing
+	// the received traffic.
+	rateLimitFilterPriority = 1
+)
+
+// checkRateLimit returns an error if a rate of the configuration exceeds the
+// link speed of the interface in Mb/s.
+func checkRateLimit(ifName string, config *apis.RateLimitConfig, speedMbps int64) error {
+	if config == nil || speedMbps <= 0 {
+		return nil
+	}
+	speed := uint64(speedMbps) * 1_000_000
+	var errorList []error
+	if config.RX != nil && *config.RX > speed {
+		errorList = append(errorList, fmt.Errorf("rx rate limit %d exceeds the link speed %d bits per second of interface %s", *config.RX, speed, ifName))
+	}
+	if config.TX != nil && *config.TX > speed {
+		errorList = append(errorList, fmt.Errorf("tx rate limit %d exceeds the link speed %d bits per second of interface %s", *config.TX, speed, ifName))
+	}
+	return errors.Join(errorList...)
+}
+
+// rateLimitBurst returns the burst in bytes of a rate in bytes per second.
+func rateLimitBurst(rate uint64) uint32 {
+	burst := rate * uint64(rateLimitBurstTime) / uint64(time.Second)
+	return uint32(min(max(burst, rateLimitMinBurst), math.MaxUint32))
+}
+
+// newRateLimitTbf returns the token bucket filter root qdisc shaping the
+// transmitted traffic to rate bytes per second, the equivalent of
+// `tc qdisc replace dev <dev> root handle 1: tbf rate <rate> burst <burst> latency 50ms`.
+func newRateLimitTbf(linkIndex int, rate uint64) *netlink.Tbf {
+	burst := rateLimitBurst(rate)
+	limit := rate*uint64(rateLimitLatency)/uint64(time.Second) + uint64(burst)
+	return &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: linkIndex,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   rate,
+		Buffer: netlink.Xmittime(rate, burst),
+		Limit:  uint32(min(limit, math.MaxUint32)),
+	}
+}
+
+// newRateLimitPolice returns the ingress filter dropping the received traffic
+// above rate bytes per second, the equivalent of
+// `tc filter replace dev <dev> ingress prio 1 handle 1 matchall action police rate <rate> burst <burst> drop`.
+func newRateLimitPolice(linkIndex int, rate uint64) *netlink.MatchAll {
+	police := netlink.NewPoliceAction()
+	police.Rate = uint32(rate)
+	police.Burst = rateLimitBurst(rate)
+	police.Mtu = rateLimitPoliceMTU
+	police.ExceedAction = netlink.TC_POLICE_SHOT
+	return &netlink.MatchAll{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: linkIndex,
+			Parent:    netlink.HANDLE_MIN_INGRESS,
+			Priority:  rateLimitFilterPriority,
+			Handle:    1,
+			Protocol:  unix.ETH_P_ALL,
+		},
+		Actions: []netlink.Action{police},
+	}
+}
+
+// applyRateLimitConfig limits the bandwidth of the interface in the pod
+// network namespace. The transmitted traffic is shaped by a token bucket
+// filter root qdisc, the received traffic above the rate is dropped by a
+// police action on the clsact ingress hook of the interface.
+func applyRateLimitConfig(containerNsPath string, ifName string, config *apis.RateLimitConfig) error {
+	if config == nil {
+		return nil
+	}
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	linkIndex := nsLink.Attrs().Index
+
+	if config.TX != nil {
+		if err := nhNs.QdiscReplace(newRateLimitTbf(linkIndex, *config.TX/8)); err != nil {
+			return fmt.Errorf("failed to set tx rate limit for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+		}
+	}
+
+	if config.RX != nil {
+		clsact := &netlink.Clsact{
+			QdiscAttrs: netlink.QdiscAttrs{
+				LinkIndex: linkIndex,
+				Handle:    netlink.MakeHandle(0xffff, 0),
+				Parent:    netlink.HANDLE_CLSACT,
+			},
+		}
+		if err := nhNs.QdiscReplace(clsact); err != nil {
+			return fmt.Errorf("failed to add clsact qdisc for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+		}
+		if err := nhNs.FilterReplace(newRateLimitPolice(linkIndex, *config.RX/8)); err != nil {
+			return fmt.Errorf("failed to set rx rate limit for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+		}
+	}
+	return nil
+}
+
+// removeRateLimitConfig removes the rate limits of the interface in the pod
+// network namespace before it is returned to the host, so they do not apply
+// to the traffic of the host or of the next pod. The clsact qdisc is kept,
+// other programs may be attached to it.
+func removeRateLimitConfig(containerNsPath string, ifName string) error {
+	containerNs, err := netns.GetFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	var errorList []error
+	qdiscs, err := nhNs.QdiscList(nsLink)
+	if err != nil {
+		errorList = append(errorList, fmt.Errorf("failed to list qdiscs of interface %s on namespace %s: %w", ifName, containerNsPath, err))
+	}
+	for _, qdisc := range qdiscs {
+		if _, ok := qdisc.(*netlink.Tbf); !ok || qdisc.Attrs().Parent != netlink.HANDLE_ROOT {
+			continue
+		}
+		if err := nhNs.QdiscDel(qdisc); err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to delete tx rate limit of interface %s on namespace %s: %w", ifName, containerNsPath, err))
+		}
+	}
+
+	filters, err := nhNs.FilterList(nsLink, netlink.HANDLE_MIN_INGRESS)
+	if err != nil {
+		errorList = append(errorList, fmt.Errorf("failed to list ingress filters of interface %s on namespace %s: %w", ifName, containerNsPath, err))
+	}
+	for _, filter := range filters {
+		if _, ok := filter.(*netlink.MatchAll); !ok || filter.Attrs().Priority != rateLimitFilterPriority {
+			continue
+		}
+		if err := nhNs.FilterDel(filter); err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to delete rx rate limit of interface %s on namespace %s: %w", ifName, containerNsPath, err))
+		}
+	}
+	return errors.Join(errorList...)
+}
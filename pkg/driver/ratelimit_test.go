@@ -0,0 +1,185 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestCheckRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *apis.RateLimitConfig
+		speedMbps int64
+		wantErr   bool
+	}{
+		{
+			name:      "within the link speed",
+			cfg:       &apis.RateLimitConfig{RX: ptr.To[uint64](10_000_000_000), TX: ptr.To[uint64](25_000_000_000)},
+			speedMbps: 25000,
+		},
+		{
+			name:      "rx above the link speed",
+			cfg:       &apis.RateLimitConfig{RX: ptr.To[uint64](25_000_000_001)},
+			speedMbps: 25000,
+			wantErr:   true,
+		},
+		{
+			name:      "tx above the link speed",
+			cfg:       &apis.RateLimitConfig{TX: ptr.To[uint64](100_000_000_000)},
+			speedMbps: 25000,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown link speed",
+			cfg:       &apis.RateLimitConfig{TX: ptr.To[uint64](100_000_000_000)},
+			speedMbps: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRateLimit("eth1", tt.cfg, tt.speedMbps)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkRateLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyRateLimitConfig(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+	if _, err := exec.LookPath("tc"); err != nil {
+		t.Skip("Test requires the tc command.")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+
+	// Switch back to the original namespace
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	ifaceName := "veth0"
+	la := netlink.NewLinkAttrs()
+	la.Name = ifaceName
+	link := &netlink.Veth{
+		LinkAttrs: la,
+		PeerName:  "veth1",
+	}
+	if err := nhNs.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+	if err := nhNs.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up veth link %s in ns %s: %v", ifaceName, nsName, err)
+	}
+
+	tcShow := func(args ...string) string {
+		t.Helper()
+		if err := netns.Set(testNS); err != nil {
+			t.Fatalf("Failed to switch to namespace %s: %v", nsName, err)
+		}
+		defer netns.Set(origns) // nolint:errcheck
+		out, err := exec.Command("tc", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("tc %v failed: %v, output: %s", args, err, out)
+		}
+		return string(out)
+	}
+
+	nsPath := path.Join("/run/netns", nsName)
+	config := &apis.RateLimitConfig{TX: ptr.To[uint64](200_000_000)}
+	// Applying the configuration twice, e.g. on a retry, is not an error.
+	for range 2 {
+		if err := applyRateLimitConfig(nsPath, ifaceName, config); err != nil {
+			t.Fatalf("applyRateLimitConfig() failed: %v", err)
+		}
+	}
+	qdiscs := tcShow("qdisc", "show", "dev", ifaceName)
+	for _, want := range []string{"tbf 1: root", "rate 200Mbit"} {
+		if !strings.Contains(qdiscs, want) {
+			t.Errorf("tc qdisc show does not contain %q:\n%s", want, qdiscs)
+		}
+	}
+
+	config.RX = ptr.To[uint64](100_000_000)
+	rxErr := applyRateLimitConfig(nsPath, ifaceName, config)
+	if errors.Is(rxErr, unix.ENOENT) {
+		t.Log("The kernel does not support the matchall classifier or the police action, skipping the rx rate limit")
+	} else if rxErr != nil {
+		t.Fatalf("applyRateLimitConfig() failed: %v", rxErr)
+	} else {
+		filters := tcShow("filter", "show", "dev", ifaceName, "ingress")
+		for _, want := range []string{"matchall", "police", "rate 100Mbit", "drop"} {
+			if !strings.Contains(filters, want) {
+				t.Errorf("tc filter show ingress does not contain %q:\n%s", want, filters)
+			}
+		}
+	}
+
+	if err := removeRateLimitConfig(nsPath, ifaceName); err != nil {
+		t.Fatalf("removeRateLimitConfig() failed: %v", err)
+	}
+	if qdiscs := tcShow("qdisc", "show", "dev", ifaceName); strings.Contains(qdiscs, "tbf") {
+		t.Errorf("tc qdisc show contains the tbf qdisc after the removal:\n%s", qdiscs)
+	}
+	if rxErr == nil {
+		if filters := tcShow("filter", "show", "dev", ifaceName, "ingress"); strings.Contains(filters, "police") {
+			t.Errorf("tc filter show ingress contains the police action after the removal:\n%s", filters)
+		}
+	}
+}
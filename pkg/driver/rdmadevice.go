@@ -24,6 +24,7 @@ import (
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 )
 
@@ -84,6 +85,98 @@ func nsDetachRdmadev(containerNsPAth string, ifName string) error {
 
 }
 
+// rdmaLinkVisibility is where an RDMA link device is visible from. In shared
+// mode a link is visible from all the network namespaces, in exclusive mode
+// only from the namespace it was assigned to.
+type rdmaLinkVisibility struct {
+	inHost bool
+	inPod  bool
+	// podErr is the error of querying the RDMA links of the pod namespace.
+	podErr error
+}
+
+// getRdmaLinkVisibility looks up the RDMA link device from the host and from
+// the pod network namespace ns.
+func getRdmaLinkVisibility(linkDev, ns string) rdmaLinkVisibility {
+	var visibility rdmaLinkVisibility
+	if _, err := nlwrap.RdmaLinkByName(linkDev); err == nil {
+		visibility.inHost = true
+	}
+	podNs, err := netns.GetFromPath(ns)
+	if err != nil {
+		visibility.podErr = err
+		return visibility
+	}
+	defer podNs.Close()
+	nhNs, err := nlwrap.NewHandleAt(podNs, unix.NETLINK_RDMA)
+	if err != nil {
+		visibility.podErr = err
+		return visibility
+	}
+	defer nhNs.Close()
+	if _, err := nhNs.RdmaLinkByName(linkDev); err == nil {
+		visibility.inPod = true
+	}
+	return visibility
+}
+
+// rdmaLinkMoveDecision decides whether an RDMA link device has to be moved
+// into the pod network namespace and returns the reason of the decision. A
+// link already visible from the pod is shared, or was moved already, so on a
+// node mixing shared and exclusive devices only the exclusive ones move.
+// cachedShared is the RDMA netns mode observed at startup, used when the pod
+// namespace can not be queried.
+func rdmaLinkMoveDecision(visibility rdmaLinkVisibility, cachedShared bool) (bool, string) {
+	switch {
+	case visibility.podErr != nil && cachedShared:
+		return false, fmt.Sprintf("failed to query the RDMA links of the pod namespace (%v), using the shared mode observed at startup", visibility.podErr)
+	case visibility.podErr != nil:
+		return true, fmt.Sprintf("failed to query the RDMA links of the pod namespace (%v), using the exclusive mode observed at startup", visibility.podErr)
+	case visibility.inPod:
+		return false, "the link is already visible from the pod namespace"
+	case !visibility.inHost:
+		// Try anyway so the failure is reported by the attach.
+		return true, "the link is not visible from the pod namespace nor from the host namespace"
+	default:
+		return true, "the link is only visible from the host namespace"
+	}
+}
+
+// rdmaLinkReturnDecision decides whether an RDMA link device has to be moved
+// back from the pod network namespace to the host and returns the reason of
+// the decision. Only the links visible from the pod and not from the host
+// were moved, the shared ones are left alone.
+func rdmaLinkReturnDecision(visibility rdmaLinkVisibility, cachedShared bool) (bool, string) {
+	switch {
+	case visibility.podErr != nil && cachedShared:
+		return false, fmt.Sprintf("failed to query the RDMA links of the pod namespace (%v), using the shared mode observed at startup", visibility.podErr)
+	case visibility.podErr != nil:
+		return true, fmt.Sprintf("failed to query the RDMA links of the pod namespace (%v), using the exclusive mode observed at startup", visibility.podErr)
+	case !visibility.inPod:
+		return false, "the link is not in the pod namespace"
+	case visibility.inHost:
+		return false, "the link is visible from the host namespace"
+	default:
+		return true, "the link is only visible from the pod namespace"
+	}
+}
+
+// shouldMoveRdmaLink looks up the RDMA link device from the host and the pod
+// namespace ns, and logs the decision of moving it to the pod.
+func (np *NetworkDriver) shouldMoveRdmaLink(linkDev, ns string) bool {
+	move, reason := rdmaLinkMoveDecision(getRdmaLinkVisibility(linkDev, ns), np.rdmaSharedMode)
+	klog.V(2).Infof("RDMA device %s move to pod namespace: %t, %s", linkDev, move, reason)
+	return move
+}
+
+// shouldReturnRdmaLink looks up the RDMA link device from the host and the
+// pod namespace ns, and logs the decision of moving it back to the host.
+func (np *NetworkDriver) shouldReturnRdmaLink(linkDev, ns string) bool {
+	move, reason := rdmaLinkReturnDecision(getRdmaLinkVisibility(linkDev, ns), np.rdmaSharedMode)
+	klog.V(2).Infof("RDMA device %s return to host namespace: %t, %s", linkDev, move, reason)
+	return move
+}
+
 // GetDeviceInfo retrieves device type, major, and minor numbers for a given path.
 // It returns an error if the path does not exist or if it's not a device file.
 func GetDeviceInfo(path string) (LinuxDevice, error) {
@@ -116,9 +209,10 @@ func GetDeviceInfo(path string) (LinuxDevice, error) {
 	minorVal := unix.Minor(statT.Rdev)
 
 	return LinuxDevice{
-		Path:  path,
-		Type:  deviceType,
-		Major: int64(majorVal),
-		Minor: int64(minorVal),
+		Path:     path,
+		Type:     deviceType,
+		Major:    int64(majorVal),
+		Minor:    int64(minorVal),
+		FileMode: uint32(fileInfo.Mode().Perm()),
 	}, nil
 }
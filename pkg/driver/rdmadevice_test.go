@@ -0,0 +1,110 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRdmaLinkMoveDecision(t *testing.T) {
+	errQuery := errors.New("netlink error")
+	tests := []struct {
+		name         string
+		visibility   rdmaLinkVisibility
+		cachedShared bool
+		wantMove     bool
+		wantReturn   bool
+	}{
+		{
+			name:       "exclusive link in the host namespace",
+			visibility: rdmaLinkVisibility{inHost: true},
+			wantMove:   true,
+		},
+		{
+			name:       "shared link visible from all the namespaces",
+			visibility: rdmaLinkVisibility{inHost: true, inPod: true},
+		},
+		{
+			name:         "shared link although exclusive mode at startup",
+			visibility:   rdmaLinkVisibility{inHost: true, inPod: true},
+			cachedShared: false,
+		},
+		{
+			name:         "exclusive link although shared mode at startup",
+			visibility:   rdmaLinkVisibility{inHost: true},
+			cachedShared: true,
+			wantMove:     true,
+		},
+		{
+			name:       "exclusive link moved to the pod",
+			visibility: rdmaLinkVisibility{inPod: true},
+			wantReturn: true,
+		},
+		{
+			name:       "link not found is attempted to report the error",
+			visibility: rdmaLinkVisibility{},
+			wantMove:   true,
+		},
+		{
+			name:         "pod namespace query fails, shared at startup",
+			visibility:   rdmaLinkVisibility{inHost: true, podErr: errQuery},
+			cachedShared: true,
+		},
+		{
+			name:       "pod namespace query fails, exclusive at startup",
+			visibility: rdmaLinkVisibility{inHost: true, podErr: errQuery},
+			wantMove:   true,
+			wantReturn: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			move, reason := rdmaLinkMoveDecision(tt.visibility, tt.cachedShared)
+			if move != tt.wantMove {
+				t.Errorf("rdmaLinkMoveDecision() = %v (%s), want %v", move, reason, tt.wantMove)
+			}
+			if reason == "" {
+				t.Errorf("rdmaLinkMoveDecision() returned an empty reason")
+			}
+			back, reason := rdmaLinkReturnDecision(tt.visibility, tt.cachedShared)
+			if back != tt.wantReturn {
+				t.Errorf("rdmaLinkReturnDecision() = %v (%s), want %v", back, reason, tt.wantReturn)
+			}
+			if reason == "" {
+				t.Errorf("rdmaLinkReturnDecision() returned an empty reason")
+			}
+		})
+	}
+}
+
+// TestRdmaLinkMoveDecisionMixedNode checks that on a node with a shared and
+// an exclusive RDMA device only the exclusive one is moved to the pod.
+func TestRdmaLinkMoveDecisionMixedNode(t *testing.T) {
+	links := map[string]rdmaLinkVisibility{
+		"mlx5_0": {inHost: true, inPod: true},
+		"mlx5_1": {inHost: true},
+	}
+	want := map[string]bool{"mlx5_0": false, "mlx5_1": true}
+	for _, cachedShared := range []bool{false, true} {
+		for linkDev, visibility := range links {
+			if move, reason := rdmaLinkMoveDecision(visibility, cachedShared); move != want[linkDev] {
+				t.Errorf("rdmaLinkMoveDecision(%s) with shared mode %v at startup = %v (%s), want %v", linkDev, cachedShared, move, reason, want[linkDev])
+			}
+		}
+	}
+}
@@ -17,20 +17,22 @@ limitations under the License.
 package driver
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 )
 
-func addMacVlan(containerNsPAth string, devName string, mode netlink.MacvlanMode) error {
-	containerNs, err := netns.GetFromPath(containerNsPAth)
-	if err != nil {
-		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPAth, devName, err)
-	}
-	defer containerNs.Close()
+// childInterfaceAlias is the alias of the child interfaces created by the
+// driver on top of a shared device. The children are created in the host
+// namespace and moved to the pod, the ones still in the host namespace were
+// left behind by a restart of the driver and are deleted on startup.
+const childInterfaceAlias = "dranet-child"
 
+func addMacVlan(containerNsPAth string, devName string, mode netlink.MacvlanMode) error {
 	parentLink, err := nlwrap.LinkByName(devName)
 	if err != nil {
 		return fmt.Errorf("could not find parent interface %s : %w", devName, err)
@@ -40,25 +42,14 @@ func addMacVlan(containerNsPAth string, devName string, mode netlink.MacvlanMode
 		LinkAttrs: netlink.LinkAttrs{
 			Name:        "macvlan-" + devName,
 			ParentIndex: parentLink.Attrs().Index,
-			NetNsID:     int(containerNs),
 		},
 		Mode: mode,
 	}
-	if err := netlink.LinkAdd(macvlan); err != nil {
-		// If a user creates a macvlan and ipvlan on same parent, only one slave iface can be active at a time.
-		return fmt.Errorf("failed to create the %s macvlan interface: %v", macvlan.Name, err)
-	}
-
-	return nil
+	// If a user creates a macvlan and ipvlan on same parent, only one slave iface can be active at a time.
+	return addChildInterface(containerNsPAth, macvlan)
 }
 
 func addIPVlan(containerNsPAth string, devName string, mode netlink.IPVlanMode) error {
-	containerNs, err := netns.GetFromPath(containerNsPAth)
-	if err != nil {
-		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPAth, devName, err)
-	}
-	defer containerNs.Close()
-
 	parentLink, err := nlwrap.LinkByName(devName)
 	if err != nil {
 		return fmt.Errorf("could not find parent interface %s : %w", devName, err)
@@ -68,15 +59,99 @@ func addIPVlan(containerNsPAth string, devName string, mode netlink.IPVlanMode)
 		LinkAttrs: netlink.LinkAttrs{
 			Name:        "ipvlan-" + devName,
 			ParentIndex: parentLink.Attrs().Index,
-			NetNsID:     int(containerNs),
 		},
 		Mode: mode,
 	}
+	// If a user creates a macvlan and ipvlan on same parent, only one slave iface can be active at a time.
+	return addChildInterface(containerNsPAth, ipvlan)
+}
 
-	if err := netlink.LinkAdd(ipvlan); err != nil {
-		// If a user creates a macvlan and ipvlan on same parent, only one slave iface can be active at a time.
-		return fmt.Errorf("failed to create the %s ipvlan interface: %v", ipvlan.Name, err)
+// addChildInterface creates the child interface link in the host namespace,
+// marked with childInterfaceAlias, and moves it to the container namespace.
+func addChildInterface(containerNsPAth string, link netlink.Link) error {
+	name := link.Attrs().Name
+	containerNs, err := netns.GetFromPath(containerNsPAth)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPAth, name, err)
 	}
+	defer containerNs.Close()
 
+	if err := netlink.LinkAdd(link); err != nil {
+		return fmt.Errorf("failed to create the %s %s interface: %v", name, link.Type(), err)
+	}
+	// The kernel ignores the alias when the link is created.
+	err = netlink.LinkSetAlias(link, childInterfaceAlias)
+	if err == nil {
+		err = netlink.LinkSetNsFd(link, int(containerNs))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to move the %s interface to namespace %s: %w", name, containerNsPAth, err)
+		if errDel := netlink.LinkDel(link); errDel != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete the %s interface: %w", name, errDel))
+		}
+		return err
+	}
 	return nil
 }
+
+// nsDeleteChildNetdev deletes the child interface devName created by the
+// driver in the container namespace, the shared parent stays in the host.
+func nsDeleteChildNetdev(containerNsPAth string, devName string) error {
+	containerNs, err := netns.GetFromPath(containerNsPAth)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPAth, devName, err)
+	}
+	defer containerNs.Close()
+
+	nhNs, err := nlwrap.NewHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer nhNs.Close()
+
+	nsLink, err := nhNs.LinkByName(devName)
+	if err != nil {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", devName, containerNsPAth, err)
+	}
+	if err := nhNs.LinkDel(nsLink); err != nil {
+		return fmt.Errorf("failed to delete the %s interface on namespace %s: %w", devName, containerNsPAth, err)
+	}
+	return nil
+}
+
+// deleteOrphanChildInterfaces deletes the child interfaces created by the
+// driver that are still in the namespace of the handle, the driver stopped
+// before moving them to the pod.
+func deleteOrphanChildInterfaces(nh nlwrap.Handle) error {
+	links, err := nh.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list the interfaces: %w", err)
+	}
+	var errorList []error
+	for _, link := range links {
+		if link.Attrs().Alias != childInterfaceAlias {
+			continue
+		}
+		klog.Infof("deleting orphan child interface %s", link.Attrs().Name)
+		if err := nh.LinkDel(link); err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to delete the %s interface: %w", link.Attrs().Name, err))
+		}
+	}
+	return errors.Join(errorList...)
+}
+
+// reconcileChildInterfaces deletes the child interfaces left in the host
+// namespace when the driver stopped between creating them and moving them to
+// the pod. The children already in a pod are deleted by the kernel with its
+// namespace if the driver misses the StopPodSandbox hook.
+func (np *NetworkDriver) reconcileChildInterfaces() {
+	nh, err := nlwrap.NewHandle()
+	if err != nil {
+		klog.Errorf("failed to reconcile the child interfaces, could not get netlink handle: %v", err)
+		return
+	}
+	defer nh.Close()
+	if err := deleteOrphanChildInterfaces(nh); err != nil {
+		klog.Errorf("failed to reconcile the child interfaces: %v", err)
+	}
+}
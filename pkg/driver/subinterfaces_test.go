@@ -0,0 +1,194 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"sigs.k8s.io/dranet/internal/nlwrap"
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func Test_detachDevicesChildInterface(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+	// the namespace is created in the current thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	rndString := make([]byte, 3)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	netns.Set(origns)
+	nsPath := path.Join("/run/netns", nsName)
+
+	// a physical device moved to the pod and a shared parent with a child
+	// interface created in the pod
+	physicalName := fmt.Sprintf("d%x", rndString)
+	parentName := fmt.Sprintf("p%x", rndString)
+	for _, name := range []string{physicalName, parentName} {
+		la := netlink.NewLinkAttrs()
+		la.Name = name
+		if err := netlink.LinkAdd(&netlink.Veth{LinkAttrs: la, PeerName: name + "p"}); err != nil {
+			t.Fatalf("Failed to add veth link %s: %v", name, err)
+		}
+		defer netlink.LinkDel(&netlink.Veth{LinkAttrs: la}) // nolint:errcheck
+	}
+	physical, err := nlwrap.LinkByName(physicalName)
+	if err != nil {
+		t.Fatalf("Failed to get link %s: %v", physicalName, err)
+	}
+	if err := netlink.LinkSetNsFd(physical, int(testNS)); err != nil {
+		t.Fatalf("Failed to move link %s to ns %s: %v", physicalName, nsName, err)
+	}
+	if err := addMacVlan(nsPath, parentName, netlink.MACVLAN_MODE_BRIDGE); err != nil {
+		t.Fatalf("addMacVlan() failed: %v", err)
+	}
+	childName := "macvlan-" + parentName
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	if _, err := nhNs.LinkByName(childName); err != nil {
+		t.Fatalf("child interface %s not created in ns %s: %v", childName, nsName, err)
+	}
+
+	netdb := newFakeInventoryDB()
+	np := &NetworkDriver{netdb: netdb}
+	np.detachDevices(nsPath, map[string]DeviceConfig{
+		physicalName: {
+			NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: physicalName}},
+			NetworkInterfaceConfigInPod:  apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: physicalName}},
+		},
+		parentName: {
+			NetworkInterfaceConfigInHost: apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: parentName}},
+			NetworkInterfaceConfigInPod:  apis.NetworkConfig{Interface: apis.InterfaceConfig{Name: childName}},
+			ChildInterface:               true,
+		},
+	})
+
+	if _, err := nlwrap.LinkByName(physicalName); err != nil {
+		t.Errorf("physical interface %s not moved back to the host: %v", physicalName, err)
+	}
+	if _, err := nhNs.LinkByName(childName); err == nil {
+		t.Errorf("child interface %s not deleted from ns %s", childName, nsName)
+	}
+	if _, err := nlwrap.LinkByName(childName); err == nil {
+		t.Errorf("child interface %s moved to the host, want deleted", childName)
+	}
+	if _, err := nlwrap.LinkByName(parentName); err != nil {
+		t.Errorf("shared parent %s not in the host: %v", parentName, err)
+	}
+	if got := netdb.rescanCalls.Load(); got != 0 {
+		t.Errorf("inventory rescans = %d, want 0", got)
+	}
+}
+
+func Test_deleteOrphanChildInterfaces(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+	// the namespace is created in the current thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	rndString := make([]byte, 4)
+	_, err := rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	defer netns.DeleteNamed(nsName)
+	defer testNS.Close()
+	netns.Set(origns)
+
+	nhNs, err := nlwrap.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	la := netlink.NewLinkAttrs()
+	la.Name = "veth0"
+	parent := &netlink.Veth{LinkAttrs: la, PeerName: "veth1"}
+	if err := nhNs.LinkAdd(parent); err != nil {
+		t.Fatalf("Failed to add veth link in ns %s: %v", nsName, err)
+	}
+	for name, alias := range map[string]string{
+		"orphan": childInterfaceAlias,
+		"user":   "",
+	} {
+		child := &netlink.Macvlan{
+			LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: parent.Attrs().Index},
+			Mode:      netlink.MACVLAN_MODE_BRIDGE,
+		}
+		if err := nhNs.LinkAdd(child); err != nil {
+			t.Fatalf("Failed to add macvlan %s in ns %s: %v", name, nsName, err)
+		}
+		if alias == "" {
+			continue
+		}
+		if err := nhNs.LinkSetAlias(child, alias); err != nil {
+			t.Fatalf("Failed to set alias of macvlan %s in ns %s: %v", name, nsName, err)
+		}
+	}
+
+	if err := deleteOrphanChildInterfaces(nhNs); err != nil {
+		t.Fatalf("deleteOrphanChildInterfaces() failed: %v", err)
+	}
+	if _, err := nhNs.LinkByName("orphan"); err == nil {
+		t.Errorf("orphan child interface not deleted")
+	}
+	for _, name := range []string{"user", "veth0", "veth1"} {
+		if _, err := nhNs.LinkByName(name); err != nil {
+			t.Errorf("interface %s deleted, want only the orphan children deleted: %v", name, err)
+		}
+	}
+}
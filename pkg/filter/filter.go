@@ -17,6 +17,8 @@ limitations under the License.
 package filter
 
 import (
+	"fmt"
+
 	"github.com/google/cel-go/cel"
 	celtypes "github.com/google/cel-go/common/types"
 
@@ -24,7 +26,34 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func FilterDevices(celProgram cel.Program, devices []resourcev1.Device) []resourcev1.Device {
+// ErrorAction defines what happens to a device when the filter expression
+// fails to evaluate against its attributes, e.g. because the expression
+// accesses an attribute the device does not have without guarding it with an
+// `in` check.
+type ErrorAction string
+
+const (
+	// ErrorActionKeep publishes the device, so a filter that can not be
+	// evaluated never hides devices. This is the default.
+	ErrorActionKeep ErrorAction = "keep"
+	// ErrorActionDrop does not publish the device.
+	ErrorActionDrop ErrorAction = "drop"
+)
+
+// ParseErrorAction converts a string into an ErrorAction.
+func ParseErrorAction(s string) (ErrorAction, error) {
+	switch action := ErrorAction(s); action {
+	case ErrorActionKeep, ErrorActionDrop:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unsupported filter error action %q, must be one of %q or %q", s, ErrorActionKeep, ErrorActionDrop)
+	}
+}
+
+// FilterDevices returns the devices for which the CEL program evaluates to
+// true. Devices for which the evaluation fails are kept or dropped according
+// to errorAction; the zero value behaves as ErrorActionKeep.
+func FilterDevices(celProgram cel.Program, devices []resourcev1.Device, errorAction ErrorAction) []resourcev1.Device {
 	if celProgram == nil {
 		return devices
 	}
@@ -33,7 +62,11 @@ func FilterDevices(celProgram cel.Program, devices []resourcev1.Device) []resour
 	for _, dev := range devices {
 		out, _, err := celProgram.Eval(map[string]interface{}{"attributes": dev.Attributes})
 		if err != nil {
-			klog.Infof("prg.Eval() failed: %v", err)
+			if errorAction == ErrorActionDrop {
+				klog.Infof("prg.Eval() failed for device %s, dropping it: %v", dev.Name, err)
+				continue
+			}
+			klog.Infof("prg.Eval() failed for device %s, keeping it: %v", dev.Name, err)
 			filteredDevices = append(filteredDevices, dev)
 			continue
 		}
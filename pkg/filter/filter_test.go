@@ -30,6 +30,7 @@ func Test_filterDevices(t *testing.T) {
 	tests := []struct {
 		name           string
 		celProgram     cel.Program
+		errorAction    ErrorAction
 		devices        []resourcev1.Device
 		expectedLength int
 	}{
@@ -224,11 +225,73 @@ func Test_filterDevices(t *testing.T) {
 			},
 			expectedLength: 2, // dev_missing_key (due to error) and dev_key_present_eval_true
 		},
+		{
+			name:        "eval error - no such key with drop action",
+			celProgram:  mustCompileCEL(t, `attributes["dra.net/type"].StringValue != "veth"`),
+			errorAction: ErrorActionDrop,
+			devices: []resourcev1.Device{
+				{
+					Name: "dev_missing_key",
+					Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+						"some_other_key": {StringValue: ptr.To("value")},
+					},
+				},
+				{
+					Name: "dev_key_present_eval_true",
+					Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+						resourcev1.QualifiedName("dra.net/type"): {StringValue: ptr.To("eth0")},
+					},
+				},
+			},
+			expectedLength: 1, // only dev_key_present_eval_true
+		},
+		{
+			name:        "guarded expression with missing key",
+			celProgram:  mustCompileCEL(t, `!("dra.net/type" in attributes) || attributes["dra.net/type"].StringValue != "veth"`),
+			errorAction: ErrorActionDrop,
+			devices: []resourcev1.Device{
+				{
+					Name: "dev_missing_key", // kept by the expression itself, no eval error
+					Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+						"some_other_key": {StringValue: ptr.To("value")},
+					},
+				},
+				{
+					Name: "dev_veth",
+					Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+						resourcev1.QualifiedName("dra.net/type"): {StringValue: ptr.To("veth")},
+					},
+				},
+			},
+			expectedLength: 1,
+		},
+		{
+			// has() only accepts a field selection, a key of the attributes
+			// map is tested with the in operator.
+			name:        "devices with an IPv4 address",
+			celProgram:  mustCompileCEL(t, `"dra.net/ipv4" in attributes`),
+			errorAction: ErrorActionDrop,
+			devices: []resourcev1.Device{
+				{
+					Name: "dev_unconfigured",
+					Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+						resourcev1.QualifiedName("dra.net/ipv6"): {StringValue: ptr.To("2001:db8::1/64")},
+					},
+				},
+				{
+					Name: "dev_uplink",
+					Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+						resourcev1.QualifiedName("dra.net/ipv4"): {StringValue: ptr.To("10.0.0.1/24")},
+					},
+				},
+			},
+			expectedLength: 1,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			devices := FilterDevices(tt.celProgram, tt.devices)
+			devices := FilterDevices(tt.celProgram, tt.devices, tt.errorAction)
 			if len(devices) != tt.expectedLength {
 				t.Errorf("filterDevices() length = %v, want %v", len(devices), tt.expectedLength)
 			}
@@ -236,6 +299,30 @@ func Test_filterDevices(t *testing.T) {
 	}
 }
 
+func TestParseErrorAction(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      ErrorAction
+		expectErr bool
+	}{
+		{input: "keep", want: ErrorActionKeep},
+		{input: "drop", want: ErrorActionDrop},
+		{input: "", expectErr: true},
+		{input: "Drop", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseErrorAction(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseErrorAction(%q) error = %v, expectErr %v", tt.input, err, tt.expectErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseErrorAction(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
 func mustCompileCEL(t *testing.T, expression string) cel.Program {
 	t.Helper()
 	env, err := cel.NewEnv(
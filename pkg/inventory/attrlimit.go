@@ -0,0 +1,94 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// optionalAttributes are the attributes dropped, in this order, from the
+// devices exceeding the number of attributes and capacities the API server
+// accepts per device. The custom attributes are dropped before them. The
+// attributes identifying the device, used by the driver or by the cloud
+// providers are never dropped.
+var optionalAttributes = []resourceapi.QualifiedName{
+	apis.AttrCarrierChanges,
+	apis.AttrNumRxQueues,
+	apis.AttrNumTxQueues,
+	apis.AttrModuleVendor,
+	apis.AttrModuleType,
+	apis.AttrTCFilterNames,
+	apis.AttrTCXProgramNames,
+	apis.AttrOUI,
+	apis.AttrAlias,
+	apis.AttrHostManaged,
+	apis.AttrMaxMTU,
+	apis.AttrSRIOVFreeVfs,
+	apis.AttrRDMALinkLayer,
+	apis.AttrPCIDeviceShared,
+	apis.AttrPort,
+	apis.AttrEncapsulation,
+}
+
+// limitDeviceAttributes drops the optional attributes of the devices with more
+// attributes and capacities than
+// resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice, the API server
+// rejects the whole ResourceSlice otherwise. The attributes of the devices are
+// copied before being modified.
+func limitDeviceAttributes(devices []resourceapi.Device) []resourceapi.Device {
+	for i := range devices {
+		device := &devices[i]
+		excess := len(device.Attributes) + len(device.Capacity) - resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice
+		if excess <= 0 {
+			continue
+		}
+		var candidates []resourceapi.QualifiedName
+		for _, name := range slices.Sorted(maps.Keys(device.Attributes)) {
+			if strings.HasPrefix(string(name), apis.AttrCustomPrefix+"/") {
+				candidates = append(candidates, name)
+			}
+		}
+		candidates = append(candidates, optionalAttributes...)
+
+		attributes := maps.Clone(device.Attributes)
+		var dropped []string
+		for _, name := range candidates {
+			if excess <= 0 {
+				break
+			}
+			if _, ok := attributes[name]; !ok {
+				continue
+			}
+			delete(attributes, name)
+			dropped = append(dropped, string(name))
+			excess--
+		}
+		device.Attributes = attributes
+		klog.Warningf("Device %s has more than %d attributes and capacities, not publishing the attributes %v", device.Name, resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice, dropped)
+		if excess > 0 {
+			klog.Errorf("Device %s still has %d attributes and capacities more than the %d allowed, the ResourceSlice will be rejected", device.Name, excess, resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice)
+		}
+	}
+	return devices
+}
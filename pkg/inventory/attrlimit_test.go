@@ -0,0 +1,77 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func Test_limitDeviceAttributes(t *testing.T) {
+	attribute := resourceapi.DeviceAttribute{StringValue: ptr.To("value")}
+	attributes := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}
+	// attributes never dropped
+	for i := range 29 {
+		attributes[resourceapi.QualifiedName(fmt.Sprintf("gce.dra.net/attr%d", i))] = attribute
+	}
+	attributes[apis.AttrInterfaceName] = attribute
+	attributes[apis.AttrCarrierChanges] = attribute
+	attributes[apis.AttrNumRxQueues] = attribute
+	attributes[apis.AttrNumTxQueues] = attribute
+	attributes[apis.AttrAlias] = attribute
+	for i := range 2 {
+		attributes[resourceapi.QualifiedName(fmt.Sprintf("%s/custom%d", apis.AttrCustomPrefix, i))] = attribute
+	}
+	// 36 attributes, 4 over the limit
+	small := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{apis.AttrInterfaceName: attribute, apis.AttrAlias: attribute}
+	devices := []resourceapi.Device{
+		{Name: "big", Attributes: attributes},
+		{Name: "small", Attributes: small},
+	}
+
+	got := limitDeviceAttributes(devices)
+	if n := len(got[0].Attributes); n != resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice {
+		t.Errorf("limitDeviceAttributes() kept %d attributes, want %d", n, resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice)
+	}
+	for i := range 2 {
+		if _, ok := got[0].Attributes[resourceapi.QualifiedName(fmt.Sprintf("%s/custom%d", apis.AttrCustomPrefix, i))]; ok {
+			t.Errorf("limitDeviceAttributes() kept the custom attribute %d, the custom attributes are dropped first", i)
+		}
+	}
+	for _, name := range []resourceapi.QualifiedName{apis.AttrInterfaceName, apis.AttrNumTxQueues, apis.AttrAlias} {
+		if _, ok := got[0].Attributes[name]; !ok {
+			t.Errorf("limitDeviceAttributes() dropped %s", name)
+		}
+	}
+	for _, name := range []resourceapi.QualifiedName{apis.AttrCarrierChanges, apis.AttrNumRxQueues} {
+		if _, ok := got[0].Attributes[name]; ok {
+			t.Errorf("limitDeviceAttributes() kept %s", name)
+		}
+	}
+	// the attributes are copied
+	if len(attributes) != 36 {
+		t.Errorf("limitDeviceAttributes() modified the attributes of the device, %d attributes left", len(attributes))
+	}
+	if len(got[1].Attributes) != 2 {
+		t.Errorf("limitDeviceAttributes() = %v for a device under the limit, want it unchanged", got[1].Attributes)
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/dynamic-resource-allocation/deviceattribute"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 )
@@ -63,17 +64,69 @@ var (
 	// nonNetdevDrivers is the set of well-known kernel drivers that bind
 	// to PCI network devices without creating a kernel netdev or RDMA link
 	// (userspace I/O and passthrough drivers). See
-	// isAllocatableNetworkDevice for why this list is used.
+	// isAllocatableNetworkDevice for why this list is used. The devices
+	// bound to vfio-pci are published as PCI devices instead, see
+	// addVFIOAttributes.
 	nonNetdevDrivers = sets.New("vfio-pci", "uio_pci_generic", "igb_uio", "pci-stub")
 )
 
 type DB struct {
+	// instance is the cloud instance, it is set by loadCloudInstance once
+	// the properties are available and read with cloudInstance().
 	instance cloudprovider.CloudInstance
-	profProv cloudprovider.ProfileProvider
-	// TODO: it is not common but may happen in edge cases that the default
-	// gateway changes revisit once we have more evidence this can be a
-	// potential problem or break some use cases.
+	// loadCloudInstance gathers the cloud instance properties in the
+	// background of Run, the devices are published without the cloud
+	// attributes until it returns. It may be nil.
+	loadCloudInstance func(context.Context) (cloudprovider.CloudInstance, error)
+	profProv          cloudprovider.ProfileProvider
+	// cloudProfileProvider resolves the profiles with the cloud instance
+	// when there is no profile provider, once its properties are loaded.
+	cloudProfileProvider bool
+	// gwInterfaces are the uplink interfaces, and their children, excluded
+	// from the inventory. They are re-evaluated on every scan since the
+	// default gateway may change.
 	gwInterfaces sets.Set[string]
+	// excludedUplinkInterfaces returns the current uplink interfaces; it is
+	// a field so tests can fake the routing state.
+	excludedUplinkInterfaces func() sets.Set[string]
+	// exposeUplink disables the exclusion of the uplink interfaces, e.g. on
+	// single-NIC development nodes.
+	exposeUplink bool
+	// excludeBondSlaves removes the interfaces enslaved to a bond from the
+	// inventory, claiming them would disrupt the bond.
+	excludeBondSlaves bool
+	// publishVFIODevices publishes the PCI network devices bound to vfio-pci,
+	// they may be managed by another component, e.g. KubeVirt or the SR-IOV
+	// device plugin.
+	publishVFIODevices bool
+	// normalizedInterfacePrefix is the prefix of the device names of the
+	// interfaces whose name is not a valid DNS-1123 label.
+	normalizedInterfacePrefix string
+	// inUsePCIAddresses returns the PCI addresses of the devices allocated to
+	// pods, used to count the SR-IOV VFs still free. It may be nil.
+	inUsePCIAddresses func() sets.Set[string]
+	// publishLinkUpOnly removes from the inventory the interfaces whose
+	// operational state is not up, the ones seen up in the last
+	// linkDownGracePeriod are kept so briefly flapping links are not dropped.
+	publishLinkUpOnly   bool
+	linkDownGracePeriod time.Duration
+	// linkLastUp is the last time the interfaces, keyed by device name, were
+	// seen up.
+	linkLastUp map[string]time.Time
+	clock      clock.Clock
+	// reservedDevicesFile lists the interface names and PCI addresses of the
+	// devices reserved for the host, never published. It is read on every
+	// scan into reservedDevices.
+	reservedDevicesFile string
+	reservedDevices     sets.Set[string]
+	// customSysfsAttributes are the names of the custom attributes of the
+	// interfaces and the paths of the sysfs files, relative to the directory
+	// of the interface, they are read from.
+	customSysfsAttributes map[string]string
+	// scannedPCIDevices are all the devices of the last PCI scan, keyed by
+	// PCI address, so the RDMA devices of other PCI classes than network
+	// controllers, e.g. InfiniBand HCAs, can be described too.
+	scannedPCIDevices map[string]*ghw.PCIDevice
 
 	mu sync.RWMutex
 	// deviceStore is an in-memory cache of the available devices on the node.
@@ -84,6 +137,9 @@ type DB struct {
 	// deviceConfigStore caches cloud-provider network configuration per device.
 	// This helps us avoid repeatedly querying the provider APIs. Keyed by device name.
 	deviceConfigStore map[string]*apis.NetworkConfig
+	// networkMTUStore caches the MTU of the network each device is attached
+	// to, when the cloud provider metadata exposes it. Keyed by device name.
+	networkMTUStore map[string]int
 
 	rateLimiter     *rate.Limiter
 	maxPollInterval time.Duration
@@ -119,28 +175,125 @@ func WithMoveIBInterfaces(move bool) Option {
 	}
 }
 
+// WithExposeUplink publishes the interfaces carrying the default route, and
+// their children, instead of excluding them from the inventory.
+func WithExposeUplink(expose bool) Option {
+	return func(db *DB) {
+		db.exposeUplink = expose
+	}
+}
+
+// WithExcludeBondSlaves removes the interfaces enslaved to a bond, and their
+// PCI devices, from the inventory.
+func WithExcludeBondSlaves(exclude bool) Option {
+	return func(db *DB) {
+		db.excludeBondSlaves = exclude
+	}
+}
+
+// WithPublishVFIODevices publishes the PCI network devices bound to vfio-pci,
+// which have no netdev, as devices of kind "pci".
+func WithPublishVFIODevices(publish bool) Option {
+	return func(db *DB) {
+		db.publishVFIODevices = publish
+	}
+}
+
+// WithNormalizedInterfacePrefix sets the prefix of the device names of the
+// interfaces whose name is not a valid DNS-1123 label. It must be validated
+// with names.ValidateNormalizedInterfacePrefix.
+func WithNormalizedInterfacePrefix(prefix string) Option {
+	return func(db *DB) {
+		db.normalizedInterfacePrefix = prefix
+	}
+}
+
+// WithPublishLinkUpOnly sets whether only the interfaces that are up, or
+// went down less than gracePeriod ago, are published.
+func WithPublishLinkUpOnly(linkUpOnly bool, gracePeriod time.Duration) Option {
+	return func(db *DB) {
+		db.publishLinkUpOnly = linkUpOnly
+		db.linkDownGracePeriod = gracePeriod
+	}
+}
+
+// WithReservedDevicesFile sets the file listing the interface names and PCI
+// addresses of the devices reserved for the host, which are not published.
+func WithReservedDevicesFile(path string) Option {
+	return func(db *DB) {
+		db.reservedDevicesFile = path
+	}
+}
+
+// WithCustomSysfsAttributes sets the custom attributes of the interfaces, the
+// attribute names and the paths of the sysfs files they are read from,
+// relative to the directory of the interface. They must be parsed with
+// ParseCustomSysfsAttributes.
+func WithCustomSysfsAttributes(attributes map[string]string) Option {
+	return func(db *DB) {
+		db.customSysfsAttributes = attributes
+	}
+}
+
 func WithCloudInstance(instance cloudprovider.CloudInstance) Option {
 	return func(db *DB) {
 		db.instance = instance
 	}
 }
 
+// WithCloudInstanceLoader sets the function gathering the cloud instance
+// properties. It runs in the background so the metadata server, which can be
+// slow to answer on the first boot of a VM, does not delay the publication of
+// the devices; they are rescanned to add the cloud attributes once it returns.
+func WithCloudInstanceLoader(load func(context.Context) (cloudprovider.CloudInstance, error)) Option {
+	return func(db *DB) {
+		db.loadCloudInstance = load
+	}
+}
+
 func WithProfileProvider(profProv cloudprovider.ProfileProvider) Option {
 	return func(db *DB) {
 		db.profProv = profProv
 	}
 }
 
+// WithCloudProfileProvider resolves the profiles with the cloud instance, if
+// it is a profile provider. The cloud instance loaded in the background
+// resolves them once its properties are available.
+func WithCloudProfileProvider(enabled bool) Option {
+	return func(db *DB) {
+		db.cloudProfileProvider = enabled
+	}
+}
+
+// SetInUsePCIAddressesFunc sets the function returning the PCI addresses of
+// the devices allocated to pods. It must be called before Run.
+func (db *DB) SetInUsePCIAddressesFunc(f func() sets.Set[string]) {
+	db.inUsePCIAddresses = f
+}
+
 func New(opts ...Option) *DB {
 	db := &DB{
 
 		deviceStore:       map[string]resourceapi.Device{},
 		deviceConfigStore: map[string]*apis.NetworkConfig{},
+		networkMTUStore:   map[string]int{},
 		rateLimiter:       rate.NewLimiter(rate.Every(defaultMinPollInterval), defaultPollBurst),
 		notifications:     make(chan []resourceapi.Device),
 		rescanCh:          make(chan struct{}, 1),
 		maxPollInterval:   defaultMaxPollInterval,
 		moveIBInterfaces:  true,
+		excludeBondSlaves: true,
+
+		normalizedInterfacePrefix: names.NormalizedInterfacePrefix,
+
+		gwInterfaces:             sets.New[string](),
+		excludedUplinkInterfaces: getExcludedUplinkInterfaces,
+
+		linkLastUp: map[string]time.Time{},
+		clock:      clock.RealClock{},
+
+		reservedDevices: sets.New[string](),
 	}
 	for _, o := range opts {
 		o(db)
@@ -160,8 +313,13 @@ func (db *DB) Run(ctx context.Context) error {
 		klog.Error(err, "error subscribing to netlink interfaces, only syncing periodically", "interval", db.maxPollInterval.String())
 	}
 
-	db.gwInterfaces = getExcludedUplinkInterfaces()
-	klog.V(2).Infof("Excluded uplink interfaces and children: %v", db.gwInterfaces.UnsortedList())
+	if db.exposeUplink {
+		klog.Warningf("Uplink interfaces are not excluded from the inventory, moving them into a pod can break the node connectivity")
+	}
+
+	if db.loadCloudInstance != nil {
+		go db.runCloudInstanceLoader(ctx)
+	}
 
 	for {
 		err := db.rateLimiter.Wait(ctx)
@@ -193,21 +351,39 @@ func (db *DB) Run(ctx context.Context) error {
 
 // scan discovers the available devices on the node.
 // It discovers PCI, network, and RDMA devices, adds cloud attributes,
-// filters out default interfaces, and updates the device store.
+// filters out default interfaces, updates the device store and limits the
+// number of attributes of the devices published.
 func (db *DB) scan() []resourceapi.Device {
+	db.refreshUplinkInterfaces()
+	db.refreshReservedDevices()
+
 	devices := db.discoverPCIDevices()
 	devices = db.discoverNetworkInterfaces(devices)
 	devices = db.discoverRDMADevices(devices)
 	devices = db.addCloudAttributes(devices)
+	devices = db.addSRIOVFreeVFsAttribute(devices)
+	linkUp := db.refreshLinkLastUp(devices)
 
 	// Remove default interface.
 	filteredDevices := []resourceapi.Device{}
 	for _, device := range devices {
+		if db.isReservedDevice(device) {
+			klog.V(4).Infof("Ignoring device %s from discovery since it is reserved for the host", device.Name)
+			continue
+		}
 		ifName := device.Attributes[apis.AttrInterfaceName].StringValue
 		if ifName != nil && db.gwInterfaces.Has(string(*ifName)) {
 			klog.V(4).Infof("Ignoring interface %s from discovery since it is an uplink interface or a child of one", *ifName)
 			continue
 		}
+		if bond := device.Attributes[apis.AttrBondMaster].StringValue; bond != nil && db.excludeBondSlaves {
+			klog.V(4).Infof("Ignoring interface %s from discovery since it is enslaved to bond %s", *ifName, *bond)
+			continue
+		}
+		if db.publishLinkUpOnly && !linkUp.Has(device.Name) {
+			klog.V(4).Infof("Ignoring interface %s from discovery since its link is not up", *ifName)
+			continue
+		}
 		filteredDevices = append(filteredDevices, device)
 	}
 
@@ -217,13 +393,93 @@ func (db *DB) scan() []resourceapi.Device {
 
 	klog.V(4).Infof("Found %d devices", len(filteredDevices))
 	db.updateDeviceStore(filteredDevices)
-	return filteredDevices
+	// The device store keeps all the attributes, only the published devices
+	// are limited.
+	return limitDeviceAttributes(filteredDevices)
+}
+
+// refreshUplinkInterfaces re-evaluates the uplink interfaces excluded from
+// the inventory, logging when they change. The previous interfaces are kept
+// if none is found.
+func (db *DB) refreshUplinkInterfaces() {
+	if db.exposeUplink {
+		db.gwInterfaces = sets.New[string]()
+		return
+	}
+	gwInterfaces := db.excludedUplinkInterfaces()
+	// The lookup returns no interface when the routes can not be listed or
+	// the default route is transiently missing, e.g. while DHCP renews it,
+	// publishing the uplink would let it be moved into a Pod.
+	if gwInterfaces.Len() == 0 && db.gwInterfaces.Len() > 0 {
+		klog.V(2).Infof("No default gateway interface found, keeping the excluded uplink interfaces %v", sets.List(db.gwInterfaces))
+		return
+	}
+	if !gwInterfaces.Equal(db.gwInterfaces) {
+		klog.V(2).Infof("Excluded uplink interfaces and children changed from %v to %v", sets.List(db.gwInterfaces), sets.List(gwInterfaces))
+	}
+	db.gwInterfaces = gwInterfaces
+}
+
+// refreshLinkLastUp records the interfaces whose operational state is up and
+// returns the names of the devices whose link is up or was up less than
+// linkDownGracePeriod ago. The devices without interface, e.g. IB-only RDMA
+// devices, and the interfaces whose driver does not report the operational
+// state are considered up.
+func (db *DB) refreshLinkLastUp(devices []resourceapi.Device) sets.Set[string] {
+	now := db.clock.Now()
+	linkUp := sets.New[string]()
+	linkLastUp := make(map[string]time.Time, len(devices))
+	for _, device := range devices {
+		state := device.Attributes[apis.AttrState].StringValue
+		if state == nil || *state == netlink.LinkOperState(netlink.OperUp).String() || *state == netlink.LinkOperState(netlink.OperUnknown).String() {
+			linkLastUp[device.Name] = now
+			linkUp.Insert(device.Name)
+			continue
+		}
+		lastUp, ok := db.linkLastUp[device.Name]
+		if !ok {
+			// never seen up, e.g. a NIC not cabled yet
+			continue
+		}
+		linkLastUp[device.Name] = lastUp
+		if now.Sub(lastUp) < db.linkDownGracePeriod {
+			linkUp.Insert(device.Name)
+		}
+	}
+	db.linkLastUp = linkLastUp
+	return linkUp
 }
 
 func (db *DB) GetResources(ctx context.Context) <-chan []resourceapi.Device {
 	return db.notifications
 }
 
+// runCloudInstanceLoader gathers the cloud instance properties and requests a
+// rescan to add the cloud attributes to the devices already published.
+func (db *DB) runCloudInstanceLoader(ctx context.Context) {
+	instance, err := db.loadCloudInstance(ctx)
+	if err != nil {
+		klog.Infof("failed to get the cloud instance properties, publishing the devices without cloud attributes: %v", err)
+		return
+	}
+	if instance == nil {
+		return
+	}
+	klog.Infof("Cloud instance properties available, rescanning the devices to add the cloud attributes")
+	db.mu.Lock()
+	db.instance = instance
+	db.mu.Unlock()
+	db.RequestRescan()
+}
+
+// cloudInstance returns the cloud instance, nil if there is none or its
+// properties are not available yet.
+func (db *DB) cloudInstance() cloudprovider.CloudInstance {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.instance
+}
+
 // RequestRescan queues a non-blocking rescan of the inventory. If a rescan is
 // already pending the call is a no-op. This is used when RDMA devices may have
 // returned to the host namespace via kernel namespace cleanup rather than an
@@ -243,48 +499,93 @@ func (db *DB) discoverPCIDevices() []resourceapi.Device {
 	)
 	if err != nil {
 		klog.Errorf("Could not get PCI devices: %v", err)
+		db.scannedPCIDevices = nil
 		return devices
 	}
 
+	db.scannedPCIDevices = make(map[string]*ghw.PCIDevice, len(pci.Devices))
+	for _, pciDev := range pci.Devices {
+		db.scannedPCIDevices[pciDev.Address] = pciDev
+	}
+	vfioDevices := sets.New[string]()
+	if db.publishVFIODevices {
+		vfioDevices = vfioPCIAddressesFromSysfs(sysbusPCIVFIODriverPath)
+	}
 	for _, pciDev := range pci.Devices {
 		if !isNetworkDevice(pciDev) {
 			continue
 		}
-		if !isAllocatableNetworkDevice(pciDev) {
+		if !isAllocatableNetworkDevice(pciDev) && !vfioDevices.Has(pciDev.Address) {
 			klog.Warningf("PCI network device %s is bound to driver %q which does not provide a netdev; not publishing it", pciDev.Address, pciDev.Driver)
 			continue
 		}
-		device := resourceapi.Device{
-			Name:       names.NormalizePCIAddress(pciDev.Address),
-			Attributes: make(map[resourceapi.QualifiedName]resourceapi.DeviceAttribute),
-			Capacity:   make(map[resourceapi.QualifiedName]resourceapi.DeviceCapacity),
-		}
-		device.Attributes[apis.AttrPCIAddress] = resourceapi.DeviceAttribute{StringValue: &pciDev.Address}
-		if pciDev.Vendor != nil {
-			device.Attributes[apis.AttrPCIVendor] = resourceapi.DeviceAttribute{StringValue: &pciDev.Vendor.Name}
-		}
-		if pciDev.Product != nil {
-			device.Attributes[apis.AttrPCIDevice] = resourceapi.DeviceAttribute{StringValue: &pciDev.Product.Name}
-		}
-		if pciDev.Subsystem != nil {
-			device.Attributes[apis.AttrPCISubsystem] = resourceapi.DeviceAttribute{StringValue: &pciDev.Subsystem.ID}
-		}
-
+		device := newPCIDevice(sysbusPCIPath, pciDev.Address)
+		addPCIAttributes(&device, pciDev)
 		if pciDev.Node != nil {
 			device.Attributes[apis.AttrNUMANode] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(pciDev.Node.ID))}
 		}
-
-		pcieRootAttr, err := deviceattribute.GetPCIeRootAttributeByPCIBusID(pciDev.Address)
-		if err != nil {
-			klog.Infof("Could not get pci root attribute: %v", err)
-		} else {
-			device.Attributes[pcieRootAttr.Name] = pcieRootAttr.Value
+		if vfioDevices.Has(pciDev.Address) && !addVFIOAttributes(&device, sysbusPCIPath, sysKernelIOMMUGroupsPath, pciDev.Address) {
+			continue
 		}
 		devices = append(devices, device)
 	}
 	return devices
 }
 
+// addVFIOAttributes publishes a PCI device bound to vfio-pci, e.g. for DPDK,
+// as a device of kind "pci" with its IOMMU group, the VFIO group device given
+// to the pods claiming it. It returns false if the IOMMU group can not be
+// read, the device can not be used by a pod without it, or if the group has
+// other devices: the group device gives access to all of them, so they could
+// not be allocated to different pods.
+func addVFIOAttributes(device *resourceapi.Device, pciPath string, iommuGroupsPath string, address string) bool {
+	group, ok := iommuGroupFromSysfs(pciPath, address)
+	if !ok {
+		klog.Warningf("PCI network device %s is bound to vfio-pci without an IOMMU group; not publishing it", address)
+		return false
+	}
+	if size, ok := iommuGroupSizeFromSysfs(iommuGroupsPath, group); !ok || size != 1 {
+		klog.Warningf("PCI network device %s is bound to vfio-pci in IOMMU group %s which does not have it as its only device; not publishing it", address, group)
+		return false
+	}
+	device.Attributes[apis.AttrKind] = resourceapi.DeviceAttribute{StringValue: ptr.To(kindPCI)}
+	device.Attributes[apis.AttrIOMMUGroup] = resourceapi.DeviceAttribute{StringValue: &group}
+	return true
+}
+
+// newPCIDevice returns the device of a PCI function with the attributes that
+// only depend on its address. Each of them is best effort, the device is
+// published without the ones that can not be read.
+func newPCIDevice(pciPath string, address string) resourceapi.Device {
+	device := resourceapi.Device{
+		Name:       names.NormalizePCIAddress(address),
+		Attributes: make(map[resourceapi.QualifiedName]resourceapi.DeviceAttribute),
+		Capacity:   make(map[resourceapi.QualifiedName]resourceapi.DeviceCapacity),
+	}
+	device.Attributes[apis.AttrPCIAddress] = resourceapi.DeviceAttribute{StringValue: &address}
+	device.Attributes[apis.AttrBusType] = resourceapi.DeviceAttribute{StringValue: ptr.To(busTypePCI)}
+	addPCIPortAttributes(&device, pciPath, address)
+
+	pcieRootAttr, err := deviceattribute.GetPCIeRootAttributeByPCIBusID(address)
+	if err != nil {
+		klog.Infof("Could not get pci root attribute: %v", err)
+	} else {
+		device.Attributes[pcieRootAttr.Name] = pcieRootAttr.Value
+	}
+	return device
+}
+
+// pciDeviceFromSysfs returns the device of a PCI function missing from the PCI
+// scan, e.g. because the scan failed, with the attributes that can be read
+// from sysfs. The vendor and device attributes of the scan are missing.
+func pciDeviceFromSysfs(pciPath string, address string) resourceapi.Device {
+	device := newPCIDevice(pciPath, address)
+	if node, ok := numaNodeFromSysfs(pciPath, address); ok {
+		device.Attributes[apis.AttrNUMANode] = resourceapi.DeviceAttribute{IntValue: &node}
+	}
+	return device
+}
+
 // discoveryNetworkInterfaces updates the devices based on information retried
 // from network interfaces. For each network interface, the two possible
 // outcomes are:
@@ -305,6 +606,8 @@ func (db *DB) discoverNetworkInterfaces(pciDevices []resourceapi.Device) []resou
 		pciDeviceMap[pciDevices[i].Name] = &pciDevices[i]
 	}
 
+	// PCI devices of the interfaces missing from the PCI scan.
+	var unscannedPCIDevices []*resourceapi.Device
 	otherDevices := []resourceapi.Device{}
 
 	for _, link := range links {
@@ -332,7 +635,13 @@ func (db *DB) discoverNetworkInterfaces(pciDevices []resourceapi.Device) []resou
 			continue
 		}
 
-		pciAddr, err := pciAddressForNetInterface(ifName)
+		busType := busTypeFromSysfs(sysnetPath, ifName)
+		var pciAddr *pciAddress
+		if isPCIBacked(busType) {
+			pciAddr, err = pciAddressForNetInterface(ifName)
+		} else {
+			err = fmt.Errorf("interface %s is not a PCI device (bus %q)", ifName, busType)
+		}
 		if err == nil {
 			// It's a PCI device.
 
@@ -340,15 +649,32 @@ func (db *DB) discoverNetworkInterfaces(pciDevices []resourceapi.Device) []resou
 			var exists bool
 			device, exists := pciDeviceMap[normalizedAddress]
 			if !exists {
-				// We don't expect this to happen.
-				klog.Errorf("Network interface %s has PCI address %q, but it was not found in initial PCI scan.", ifName, pciAddr)
-				continue
+				// We don't expect this to happen unless the PCI scan failed,
+				// publish the interface with the attributes that can be read
+				// instead of dropping the NIC.
+				klog.Warningf("Network interface %s has PCI address %q, but it was not found in initial PCI scan; publishing it without the PCI scan attributes", ifName, pciAddr)
+				unscanned := pciDeviceFromSysfs(sysbusPCIPath, pciAddr.String())
+				device = &unscanned
+				pciDeviceMap[normalizedAddress] = device
+				unscannedPCIDevices = append(unscannedPCIDevices, device)
 			}
 			addLinkAttributes(device, link)
+			addCustomSysfsAttributes(device, sysnetPath, ifName, db.customSysfsAttributes)
+			device.Attributes[apis.AttrBusType] = resourceapi.DeviceAttribute{StringValue: &busType}
+			// Only the physical NICs have a transceiver module.
+			if !isSriovVf(ifName, sysnetPath) {
+				if info, err := getModuleInfo(ifName); err == nil {
+					addModuleAttributes(device, info)
+				} else {
+					klog.V(4).Infof("No transceiver module found for interface %s: %v", ifName, err)
+				}
+			}
 		} else {
 			// Not a PCI device.
 
-			if !isVirtual(ifName, sysnetPath) {
+			if busType == busTypePlatform || busType == busTypeUSB {
+				klog.V(4).Infof("Network interface %s is a %s device", ifName, busType)
+			} else if !isVirtual(ifName, sysnetPath) {
 				// If we failed to identify the PCI address of the network
 				// interface and the network interface is also not a virtual
 				// device, use a best-effort strategy where the network
@@ -356,14 +682,21 @@ func (db *DB) discoverNetworkInterfaces(pciDevices []resourceapi.Device) []resou
 				klog.Warningf("PCI address not found for non-virtual interface %s, proceeding as if it were virtual. Error: %v", ifName, err)
 			}
 			newDevice := &resourceapi.Device{
-				Name:       names.NormalizeInterfaceName(ifName),
+				Name:       names.NormalizeInterfaceNameWithPrefix(ifName, db.normalizedInterfacePrefix),
 				Attributes: make(map[resourceapi.QualifiedName]resourceapi.DeviceAttribute),
 			}
 			addLinkAttributes(newDevice, link)
+			addCustomSysfsAttributes(newDevice, sysnetPath, ifName, db.customSysfsAttributes)
+			if busType != "" {
+				newDevice.Attributes[apis.AttrBusType] = resourceapi.DeviceAttribute{StringValue: &busType}
+			}
 			otherDevices = append(otherDevices, *newDevice)
 		}
 	}
 
+	for _, device := range unscannedPCIDevices {
+		pciDevices = append(pciDevices, *device)
+	}
 	return append(pciDevices, otherDevices...)
 }
 
@@ -398,62 +731,68 @@ func buildIPList(ips []string, maxBytes int) (string, int) {
 	return builder.String(), kept
 }
 
+// addCarrierChangesAttribute adds the number of carrier changes of the
+// interface, a link that keeps flapping has a marginal cable or transceiver.
+func addCarrierChangesAttribute(device *resourceapi.Device, basePath, ifName string) {
+	if changes, ok := carrierChangesFromSysfs(basePath, ifName); ok {
+		device.Attributes[apis.AttrCarrierChanges] = resourceapi.DeviceAttribute{IntValue: &changes}
+	}
+}
+
+// addQueueAttributes adds the number of receive and transmit queues of the
+// interface, so workloads pinning threads to queues can select multi-queue NICs.
+func addQueueAttributes(device *resourceapi.Device, basePath, ifName string) {
+	rx, tx, ok := queuesFromSysfs(basePath, ifName)
+	if !ok {
+		return
+	}
+	device.Attributes[apis.AttrNumRxQueues] = resourceapi.DeviceAttribute{IntValue: &rx}
+	device.Attributes[apis.AttrNumTxQueues] = resourceapi.DeviceAttribute{IntValue: &tx}
+}
+
+// addCustomSysfsAttributes adds the custom attributes of the interface in the
+// custom.dra.net domain, the content of the sysfs files configured by the
+// operator. The files that can not be read, e.g. not provided by the driver of
+// the interface, and the values too long for an attribute are skipped.
+func addCustomSysfsAttributes(device *resourceapi.Device, basePath, ifName string, attributes map[string]string) {
+	for name, relPath := range attributes {
+		value, err := customAttributeFromSysfs(basePath, ifName, relPath)
+		if err != nil {
+			klog.V(4).Infof("Could not read custom attribute %s of interface %s: %v", name, ifName, err)
+			continue
+		}
+		if len(value) > resourceapi.DeviceAttributeMaxValueLength {
+			klog.V(2).Infof("Custom attribute %s of interface %s is longer than %d bytes, not publishing it", name, ifName, resourceapi.DeviceAttributeMaxValueLength)
+			continue
+		}
+		device.Attributes[resourceapi.QualifiedName(apis.AttrCustomPrefix+"/"+name)] = resourceapi.DeviceAttribute{StringValue: &value}
+	}
+}
+
 func addLinkAttributes(device *resourceapi.Device, link netlink.Link) {
 	ifName := link.Attrs().Name
 	device.Attributes[apis.AttrInterfaceName] = resourceapi.DeviceAttribute{StringValue: &ifName}
 	device.Attributes[apis.AttrMac] = resourceapi.DeviceAttribute{StringValue: ptr.To(link.Attrs().HardwareAddr.String())}
+	if oui := ouiFromHardwareAddr(link.Attrs().HardwareAddr); oui != "" {
+		device.Attributes[apis.AttrOUI] = resourceapi.DeviceAttribute{StringValue: &oui}
+	}
 	device.Attributes[apis.AttrMTU] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(link.Attrs().MTU))}
+	if maxMTU, ok := getLinkMaxMTU(link.Attrs().Index); ok {
+		device.Attributes[apis.AttrMaxMTU] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(maxMTU))}
+	}
 	device.Attributes[apis.AttrEncapsulation] = resourceapi.DeviceAttribute{StringValue: ptr.To(link.Attrs().EncapType)}
 	device.Attributes[apis.AttrAlias] = resourceapi.DeviceAttribute{StringValue: ptr.To(link.Attrs().Alias)}
 	device.Attributes[apis.AttrState] = resourceapi.DeviceAttribute{StringValue: ptr.To(link.Attrs().OperState.String())}
 	device.Attributes[apis.AttrType] = resourceapi.DeviceAttribute{StringValue: ptr.To(link.Type())}
+	if bond := bondMasterFromSysfs(sysnetPath, ifName); bond != "" {
+		device.Attributes[apis.AttrBondMaster] = resourceapi.DeviceAttribute{StringValue: &bond}
+	}
+	addCarrierChangesAttribute(device, sysnetPath, ifName)
+	addQueueAttributes(device, sysnetPath, ifName)
+	addHostManagedAttribute(device, networkdLinksPath, networkManagerDevicesPath, link.Attrs().Index)
 
-	v4 := sets.Set[string]{}
-	v6 := sets.Set[string]{}
-	if ips, err := nlwrap.AddrList(link, netlink.FAMILY_ALL); err == nil && len(ips) > 0 {
-		for _, address := range ips {
-			if !address.IP.IsGlobalUnicast() {
-				continue
-			}
-
-			if address.IP.To4() == nil && address.IP.To16() != nil {
-				v6.Insert(address.IPNet.String())
-			} else if address.IP.To4() != nil {
-				v4.Insert(address.IPNet.String())
-			}
-		}
-		// DRA enforces a per-attribute string limit (see
-		// resourceapi.DeviceAttributeMaxValueLength). Interfaces like the
-		// kube-proxy IPVS dummy (kube-ipvs0) accumulate every cluster
-		// ServiceIP and would overflow this limit, causing the whole slice to
-		// be rejected. Build the attribute incrementally and stop once the
-		// next address would push us past the cap. Until List-typed device
-		// attributes land (kubernetes/enhancements#5491) this prefix is the
-		// best we can publish; sort first so the truncation is deterministic.
-		if v4.Len() > 0 {
-			ips := v4.UnsortedList()
-			sort.Strings(ips)
-			joined, kept := buildIPList(ips, resourceapi.DeviceAttributeMaxValueLength)
-			if joined != "" {
-				device.Attributes[apis.AttrIPv4] = resourceapi.DeviceAttribute{StringValue: ptr.To(joined)}
-			}
-			if kept < len(ips) {
-				klog.V(4).Infof("Truncated %s attribute on %s: kept %d of %d addresses to stay within DRA's %d-byte limit",
-					apis.AttrIPv4, ifName, kept, len(ips), resourceapi.DeviceAttributeMaxValueLength)
-			}
-		}
-		if v6.Len() > 0 {
-			ips := v6.UnsortedList()
-			sort.Strings(ips)
-			joined, kept := buildIPList(ips, resourceapi.DeviceAttributeMaxValueLength)
-			if joined != "" {
-				device.Attributes[apis.AttrIPv6] = resourceapi.DeviceAttribute{StringValue: ptr.To(joined)}
-			}
-			if kept < len(ips) {
-				klog.V(4).Infof("Truncated %s attribute on %s: kept %d of %d addresses to stay within DRA's %d-byte limit",
-					apis.AttrIPv6, ifName, kept, len(ips), resourceapi.DeviceAttributeMaxValueLength)
-			}
-		}
+	if addresses, err := nlwrap.AddrList(link, netlink.FAMILY_ALL); err == nil {
+		addIPAttributes(device, ifName, addresses)
 	}
 
 	isEbpf := false
@@ -489,6 +828,59 @@ func addLinkAttributes(device *resourceapi.Device, link netlink.Link) {
 	}
 }
 
+// addIPAttributes publishes the global unicast addresses of the interface in
+// the AttrIPv4 and AttrIPv6 attributes. An attribute is absent, rather than
+// an empty string, when the interface has no address of its family, so the
+// selectors can use `has(device.attributes["dra.net"].ipv4)` to only match the
+// configured interfaces.
+func addIPAttributes(device *resourceapi.Device, ifName string, addresses []netlink.Addr) {
+	v4 := sets.Set[string]{}
+	v6 := sets.Set[string]{}
+	for _, address := range addresses {
+		if !address.IP.IsGlobalUnicast() {
+			continue
+		}
+
+		if address.IP.To4() == nil && address.IP.To16() != nil {
+			v6.Insert(address.IPNet.String())
+		} else if address.IP.To4() != nil {
+			v4.Insert(address.IPNet.String())
+		}
+	}
+	// DRA enforces a per-attribute string limit (see
+	// resourceapi.DeviceAttributeMaxValueLength). Interfaces like the
+	// kube-proxy IPVS dummy (kube-ipvs0) accumulate every cluster
+	// ServiceIP and would overflow this limit, causing the whole slice to
+	// be rejected. Build the attribute incrementally and stop once the
+	// next address would push us past the cap. Until List-typed device
+	// attributes land (kubernetes/enhancements#5491) this prefix is the
+	// best we can publish; sort first so the truncation is deterministic.
+	if v4.Len() > 0 {
+		ips := v4.UnsortedList()
+		sort.Strings(ips)
+		joined, kept := buildIPList(ips, resourceapi.DeviceAttributeMaxValueLength)
+		if joined != "" {
+			device.Attributes[apis.AttrIPv4] = resourceapi.DeviceAttribute{StringValue: ptr.To(joined)}
+		}
+		if kept < len(ips) {
+			klog.V(4).Infof("Truncated %s attribute on %s: kept %d of %d addresses to stay within DRA's %d-byte limit",
+				apis.AttrIPv4, ifName, kept, len(ips), resourceapi.DeviceAttributeMaxValueLength)
+		}
+	}
+	if v6.Len() > 0 {
+		ips := v6.UnsortedList()
+		sort.Strings(ips)
+		joined, kept := buildIPList(ips, resourceapi.DeviceAttributeMaxValueLength)
+		if joined != "" {
+			device.Attributes[apis.AttrIPv6] = resourceapi.DeviceAttribute{StringValue: ptr.To(joined)}
+		}
+		if kept < len(ips) {
+			klog.V(4).Infof("Truncated %s attribute on %s: kept %d of %d addresses to stay within DRA's %d-byte limit",
+				apis.AttrIPv6, ifName, kept, len(ips), resourceapi.DeviceAttributeMaxValueLength)
+		}
+	}
+}
+
 func (db *DB) discoverRDMADevices(devices []resourceapi.Device) []resourceapi.Device {
 	for i := range devices {
 		isRDMA := false
@@ -503,6 +895,13 @@ func (db *DB) discoverRDMADevices(devices []resourceapi.Device) []resourceapi.De
 			if !isRDMA {
 				isRDMA = isRdmaDeviceInSysfs(*ifName)
 			}
+			if isRDMA {
+				if rdmaDevName, err := GetRdmaDevice(*ifName); err == nil {
+					addRDMALinkLayerAttribute(&devices[i], rdmaDevName)
+					addRDMAPCIAttributes(&devices[i], sysInfinibandPath, rdmaDevName, db.scannedPCIDevices)
+					addRDMAPairAttributes(&devices[i], rdmaDevName, *ifName)
+				}
+			}
 		} else if pciAddr := devices[i].Attributes[apis.AttrPCIAddress].StringValue; pciAddr != nil && *pciAddr != "" {
 			rdmaDevices := rdmamap.GetRdmaDevicesForPcidev(*pciAddr)
 			isRDMA = len(rdmaDevices) != 0
@@ -510,6 +909,13 @@ func (db *DB) discoverRDMADevices(devices []resourceapi.Device) []resourceapi.De
 				// IB-only device: has RDMA capability but no netdev interface.
 				rdmaDevName := rdmaDevices[0]
 				devices[i].Attributes[apis.AttrRDMADevice] = resourceapi.DeviceAttribute{StringValue: &rdmaDevName}
+				addRDMALinkLayerAttribute(&devices[i], rdmaDevName)
+				addRDMAPCIAttributes(&devices[i], sysInfinibandPath, rdmaDevName, db.scannedPCIDevices)
+				// The netdev of an IB-only device, e.g. the IPoIB interface
+				// when IB interfaces are not moved, stays in the host.
+				if netDevName, err := GetNetInterfaceNameForPCI(*pciAddr); err == nil {
+					addRDMAPairAttributes(&devices[i], rdmaDevName, netDevName)
+				}
 			}
 		}
 		devices[i].Attributes[apis.AttrRDMA] = resourceapi.DeviceAttribute{BoolValue: &isRDMA}
@@ -517,10 +923,76 @@ func (db *DB) discoverRDMADevices(devices []resourceapi.Device) []resourceapi.De
 	return devices
 }
 
+// addRDMALinkLayerAttribute publishes the link layers of the ports of the
+// RDMA device so RoCE NICs can be told apart from InfiniBand HCAs.
+func addRDMALinkLayerAttribute(device *resourceapi.Device, rdmaDevName string) {
+	linkLayers, err := rdmaLinkLayersFromSysfs(sysInfinibandPath, rdmaDevName)
+	if err != nil {
+		klog.V(4).Infof("Failed to get the link layer of RDMA device %s: %v", rdmaDevName, err)
+		return
+	}
+	device.Attributes[apis.AttrRDMALinkLayer] = resourceapi.DeviceAttribute{StringValue: ptr.To(strings.Join(linkLayers, ","))}
+}
+
+// addRDMAPCIAttributes publishes the PCI vendor and device names of the HCA of
+// the RDMA device when the device does not have them yet, e.g. when the HCA is
+// not a network controller or its netdev was missing from the PCI scan. The
+// RDMA devices without a PCI parent, e.g. Soft-RoCE, are left as they are.
+func addRDMAPCIAttributes(device *resourceapi.Device, basePath, rdmaDevName string, pciDevices map[string]*ghw.PCIDevice) {
+	if _, ok := device.Attributes[apis.AttrPCIVendor]; ok {
+		return
+	}
+	pciAddr, err := pciAddressForRdmaDevice(basePath, rdmaDevName)
+	if err != nil {
+		klog.V(4).Infof("Failed to get the PCI device of RDMA device %s: %v", rdmaDevName, err)
+		return
+	}
+	pciDev, ok := pciDevices[strings.ToLower(pciAddr.String())]
+	if !ok {
+		klog.V(4).Infof("PCI device %s of RDMA device %s was not found in the PCI scan", pciAddr, rdmaDevName)
+		return
+	}
+	addPCIAttributes(device, pciDev)
+}
+
+// addRDMAPairAttributes links the netdev and the RDMA device of the same
+// hardware. The netdevs are published with the name of their RDMA device, the
+// IB-only devices, which already have it, with the name of their netdev.
+func addRDMAPairAttributes(device *resourceapi.Device, rdmaDevName, netDevName string) {
+	if rdmaDevName == "" || netDevName == "" {
+		return
+	}
+	device.Attributes[apis.AttrRDMADevice] = resourceapi.DeviceAttribute{StringValue: ptr.To(rdmaDevName)}
+	if ifName := device.Attributes[apis.AttrInterfaceName].StringValue; ifName == nil || *ifName == "" {
+		device.Attributes[apis.AttrNetDevName] = resourceapi.DeviceAttribute{StringValue: ptr.To(netDevName)}
+	}
+}
+
+// addSRIOVFreeVFsAttribute publishes on the SR-IOV physical functions the
+// number of their VFs not allocated to any pod.
+func (db *DB) addSRIOVFreeVFsAttribute(devices []resourceapi.Device) []resourceapi.Device {
+	inUse := sets.New[string]()
+	if db.inUsePCIAddresses != nil {
+		inUse = db.inUsePCIAddresses()
+	}
+	for _, device := range devices {
+		vfs := device.Attributes[apis.AttrSRIOVVfs].IntValue
+		ifName := device.Attributes[apis.AttrInterfaceName].StringValue
+		if vfs == nil || ifName == nil {
+			continue
+		}
+		vfAddresses := sriovVFPCIAddressesFromSysfs(sysnetPath, *ifName)
+		free := sriovFreeVFs(*vfs, vfAddresses, inUse)
+		device.Attributes[apis.AttrSRIOVFreeVfs] = resourceapi.DeviceAttribute{IntValue: &free}
+	}
+	return devices
+}
+
 func (db *DB) addCloudAttributes(devices []resourceapi.Device) []resourceapi.Device {
+	instance := db.cloudInstance()
 	for i := range devices {
 		device := &devices[i]
-		maps.Copy(device.Attributes, db.getProviderAttributes(device, db.instance))
+		maps.Copy(device.Attributes, db.getProviderAttributes(device, instance))
 	}
 	return devices
 }
@@ -552,12 +1024,14 @@ func (db *DB) getProviderAttributes(device *resourceapi.Device, instance cloudpr
 func (db *DB) updateDeviceStore(devices []resourceapi.Device) {
 	deviceStore := map[string]resourceapi.Device{}
 	deviceConfigStore := map[string]*apis.NetworkConfig{}
+	networkMTUStore := map[string]int{}
 
+	instance := db.cloudInstance()
 	for _, device := range devices {
 		deviceStore[device.Name] = device
 
 		// Cache the configuration if the provider returns one.
-		if db.instance != nil {
+		if instance != nil {
 			id := cloudprovider.DeviceIdentifiers{
 				Name: device.Name,
 			}
@@ -568,15 +1042,21 @@ func (db *DB) updateDeviceStore(devices []resourceapi.Device) {
 				id.PCIAddress = *pciAttr.StringValue
 			}
 
-			if conf := db.instance.GetDeviceConfig(id); conf != nil {
+			if conf := instance.GetDeviceConfig(id); conf != nil {
 				deviceConfigStore[device.Name] = conf
 			}
+			if mtuProvider, ok := instance.(cloudprovider.NetworkMTUProvider); ok {
+				if mtu, ok := mtuProvider.GetNetworkMTU(id); ok {
+					networkMTUStore[device.Name] = mtu
+				}
+			}
 		}
 	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	db.deviceStore = deviceStore
 	db.deviceConfigStore = deviceConfigStore
+	db.networkMTUStore = networkMTUStore
 }
 
 func (db *DB) GetDevice(deviceName string) (resourceapi.Device, bool) {
@@ -587,6 +1067,11 @@ func (db *DB) GetDevice(deviceName string) (resourceapi.Device, bool) {
 }
 
 func (db *DB) getProfileProvider() cloudprovider.ProfileProvider {
+	if db.profProv == nil && db.cloudProfileProvider {
+		if p, ok := db.cloudInstance().(cloudprovider.ProfileProvider); ok {
+			return p
+		}
+	}
 	return db.profProv
 }
 
@@ -650,6 +1135,15 @@ func (db *DB) GetDeviceConfig(deviceName string) (*apis.NetworkConfig, bool) {
 	return conf, exists
 }
 
+// GetNetworkMTU returns the MTU of the network the device is attached to, as
+// reported by the cloud provider metadata, if known.
+func (db *DB) GetNetworkMTU(deviceName string) (int, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	mtu, exists := db.networkMTUStore[deviceName]
+	return mtu, exists
+}
+
 // GetNetInterfaceName returns the network interface name for a given device. It
 // first attempts to retrieve the name from the local device store. If the
 // device is not found, it triggers a rescan of the system's devices and retries
@@ -710,6 +1204,69 @@ func (db *DB) GetRDMADeviceName(deviceName string) (string, error) {
 	return *attr.StringValue, nil
 }
 
+// IsVFIODevice returns true if the device is a PCI device bound to vfio-pci,
+// published with the kind "pci", which has no netdev interface.
+func (db *DB) IsVFIODevice(deviceName string) bool {
+	device, exists := db.GetDevice(deviceName)
+	if !exists {
+		return false
+	}
+	kind := device.Attributes[apis.AttrKind].StringValue
+	return kind != nil && *kind == kindPCI
+}
+
+// GetIOMMUGroup returns the IOMMU group of a device bound to vfio-pci, the
+// name of its VFIO group device in /dev/vfio. It returns an error if the
+// device is not found or has no IOMMU group recorded.
+func (db *DB) GetIOMMUGroup(deviceName string) (string, error) {
+	device, exists := db.GetDevice(deviceName)
+	if !exists {
+		return "", fmt.Errorf("device %s not found in store", deviceName)
+	}
+	attr, ok := device.Attributes[apis.AttrIOMMUGroup]
+	if !ok || attr.StringValue == nil {
+		return "", fmt.Errorf("device %s has no IOMMU group in local store", deviceName)
+	}
+	return *attr.StringValue, nil
+}
+
+// addPCIAttributes adds the vendor, device and subsystem of the PCI device.
+// The names are resolved independently: a subsystem missing from the PCI
+// database does not prevent publishing the vendor and device names. A zero
+// subsystem, reported by sysfs when the device does not implement it, is not
+// published.
+func addPCIAttributes(device *resourceapi.Device, pciDev *ghw.PCIDevice) {
+	if pciDev.Vendor != nil {
+		device.Attributes[apis.AttrPCIVendor] = resourceapi.DeviceAttribute{StringValue: &pciDev.Vendor.Name}
+	}
+	if pciDev.Product != nil {
+		device.Attributes[apis.AttrPCIDevice] = resourceapi.DeviceAttribute{StringValue: &pciDev.Product.Name}
+	}
+	if pciDev.Subsystem != nil && !isZeroPCISubsystem(pciDev.Subsystem.VendorID, pciDev.Subsystem.ID) {
+		device.Attributes[apis.AttrPCISubsystem] = resourceapi.DeviceAttribute{StringValue: &pciDev.Subsystem.ID}
+	}
+}
+
+// addPCIPortAttributes adds the attributes identifying the ports of a
+// multi-port card: the PCI device shared by the ports and the port index.
+func addPCIPortAttributes(device *resourceapi.Device, pciPath string, address string) {
+	shared, port, ok := pciPortFromSysfs(pciPath, address)
+	if !ok {
+		return
+	}
+	device.Attributes[apis.AttrPCIDeviceShared] = resourceapi.DeviceAttribute{StringValue: &shared}
+	device.Attributes[apis.AttrPort] = resourceapi.DeviceAttribute{IntValue: &port}
+}
+
+// isZeroPCISubsystem returns true if the subsystem vendor and device IDs are
+// both missing or zero.
+func isZeroPCISubsystem(vendorID, deviceID string) bool {
+	isZero := func(id string) bool {
+		return strings.Trim(id, "0") == ""
+	}
+	return isZero(vendorID) && isZero(deviceID)
+}
+
 // isNetworkDevice checks the class is 0x2, defined for all types of network controllers
 // https://pcisig.com/sites/default/files/files/PCI_Code-ID_r_1_11__v24_Jan_2019.pdf
 func isNetworkDevice(dev *ghw.PCIDevice) bool {
@@ -17,22 +17,33 @@ limitations under the License.
 package inventory
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jaypipes/ghw"
+	"github.com/jaypipes/pcidb"
 	"github.com/vishvananda/netlink"
 	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dracel "k8s.io/dynamic-resource-allocation/cel"
+	clocktesting "k8s.io/utils/clock/testing"
 	"k8s.io/utils/ptr"
 
 	"sigs.k8s.io/dranet/pkg/apis"
 	"sigs.k8s.io/dranet/pkg/cloudprovider"
 	"sigs.k8s.io/dranet/pkg/cloudprovider/gce"
+	"sigs.k8s.io/dranet/pkg/names"
 
 	userns "sigs.k8s.io/dranet/internal/testutils"
 )
@@ -62,6 +73,418 @@ func TestIsAllocatableNetworkDevice(t *testing.T) {
 	}
 }
 
+func TestAddPCIAttributes(t *testing.T) {
+	cases := []struct {
+		name   string
+		pciDev *ghw.PCIDevice
+		want   map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			name: "vendor, device and subsystem",
+			pciDev: &ghw.PCIDevice{
+				Vendor:    &pcidb.Vendor{ID: "15b3", Name: "Mellanox Technologies"},
+				Product:   &pcidb.Product{ID: "101d", Name: "MT2892 Family [ConnectX-6 Dx]"},
+				Subsystem: &pcidb.Product{VendorID: "15b3", ID: "0016", Name: "ConnectX-6 Dx EN adapter card"},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIVendor:    {StringValue: ptr.To("Mellanox Technologies")},
+				apis.AttrPCIDevice:    {StringValue: ptr.To("MT2892 Family [ConnectX-6 Dx]")},
+				apis.AttrPCISubsystem: {StringValue: ptr.To("0016")},
+			},
+		},
+		{
+			name: "subsystem not in the PCI database",
+			pciDev: &ghw.PCIDevice{
+				Vendor:    &pcidb.Vendor{ID: "1ae0", Name: "Google, Inc."},
+				Product:   &pcidb.Product{ID: "0042", Name: "Compute Engine Virtual Ethernet [gVNIC]"},
+				Subsystem: &pcidb.Product{VendorID: "1ae0", ID: "0058", Name: "unknown"},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIVendor:    {StringValue: ptr.To("Google, Inc.")},
+				apis.AttrPCIDevice:    {StringValue: ptr.To("Compute Engine Virtual Ethernet [gVNIC]")},
+				apis.AttrPCISubsystem: {StringValue: ptr.To("0058")},
+			},
+		},
+		{
+			name: "zero subsystem",
+			pciDev: &ghw.PCIDevice{
+				Vendor:    &pcidb.Vendor{ID: "1af4", Name: "Red Hat, Inc."},
+				Product:   &pcidb.Product{ID: "1000", Name: "Virtio network device"},
+				Subsystem: &pcidb.Product{VendorID: "0000", ID: "0000", Name: "unknown"},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIVendor: {StringValue: ptr.To("Red Hat, Inc.")},
+				apis.AttrPCIDevice: {StringValue: ptr.To("Virtio network device")},
+			},
+		},
+		{
+			name: "product not in the PCI database",
+			pciDev: &ghw.PCIDevice{
+				Vendor:  &pcidb.Vendor{ID: "8086", Name: "Intel Corporation"},
+				Product: &pcidb.Product{ID: "ffff", Name: "unknown"},
+			},
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIVendor: {StringValue: ptr.To("Intel Corporation")},
+				apis.AttrPCIDevice: {StringValue: ptr.To("unknown")},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			addPCIAttributes(&device, tc.pciDev)
+			if diff := cmp.Diff(tc.want, device.Attributes); diff != "" {
+				t.Errorf("addPCIAttributes() unexpected attributes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddPCIPortAttributes(t *testing.T) {
+	pciPath := t.TempDir()
+	for _, address := range []string{"0000:8e:00.0", "0000:8e:00.1", "0000:8f:00.0", "0000:8e:00.2"} {
+		if err := os.MkdirAll(filepath.Join(pciPath, address), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 0000:8e:00.2 is a VF of the first port.
+	if err := os.Symlink(filepath.Join(pciPath, "0000:8e:00.0"), filepath.Join(pciPath, "0000:8e:00.2", "physfn")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		address string
+		want    map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			address: "0000:8e:00.0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIDeviceShared: {StringValue: ptr.To("0000:8e:00")},
+				apis.AttrPort:            {IntValue: ptr.To[int64](0)},
+			},
+		},
+		{
+			address: "0000:8e:00.1",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIDeviceShared: {StringValue: ptr.To("0000:8e:00")},
+				apis.AttrPort:            {IntValue: ptr.To[int64](1)},
+			},
+		},
+		{
+			address: "0000:8f:00.0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIDeviceShared: {StringValue: ptr.To("0000:8f:00")},
+				apis.AttrPort:            {IntValue: ptr.To[int64](0)},
+			},
+		},
+		{
+			address: "0000:8e:00.2",
+			want:    map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{},
+		},
+		{
+			address: "invalid",
+			want:    map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.address, func(t *testing.T) {
+			device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			addPCIPortAttributes(&device, pciPath, tc.address)
+			if diff := cmp.Diff(tc.want, device.Attributes); diff != "" {
+				t.Errorf("addPCIPortAttributes() unexpected attributes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestPCIDeviceFromSysfs checks that a PCI function missing from the PCI scan
+// is published with the attributes that can be read, even if some can not.
+func TestPCIDeviceFromSysfs(t *testing.T) {
+	pciPath := t.TempDir()
+	for address, numaNode := range map[string]string{
+		"0000:8e:00.0": "1\n",
+		"0000:8e:00.1": "-1\n",
+		"0000:8f:00.0": "garbage",
+		"0000:90:00.0": "",
+	} {
+		if err := os.MkdirAll(filepath.Join(pciPath, address), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if numaNode == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(pciPath, address, "numa_node"), []byte(numaNode), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		address  string
+		wantNUMA *int64
+		wantPort int64
+	}{
+		{name: "all the attributes", address: "0000:8e:00.0", wantNUMA: ptr.To[int64](1), wantPort: 0},
+		{name: "NUMA node not reported", address: "0000:8e:00.1", wantPort: 1},
+		{name: "NUMA node unreadable", address: "0000:8f:00.0", wantPort: 0},
+		{name: "NUMA node missing", address: "0000:90:00.0", wantPort: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := pciDeviceFromSysfs(pciPath, tc.address)
+			if want := names.NormalizePCIAddress(tc.address); device.Name != want {
+				t.Errorf("device name = %q, want %q", device.Name, want)
+			}
+			if got := device.Attributes[apis.AttrPCIAddress].StringValue; got == nil || *got != tc.address {
+				t.Errorf("%s = %v, want %q", apis.AttrPCIAddress, got, tc.address)
+			}
+			if got := device.Attributes[apis.AttrBusType].StringValue; got == nil || *got != busTypePCI {
+				t.Errorf("%s = %v, want %q", apis.AttrBusType, got, busTypePCI)
+			}
+			if got := device.Attributes[apis.AttrPort].IntValue; got == nil || *got != tc.wantPort {
+				t.Errorf("%s = %v, want %d", apis.AttrPort, got, tc.wantPort)
+			}
+			if diff := cmp.Diff(tc.wantNUMA, device.Attributes[apis.AttrNUMANode].IntValue); diff != "" {
+				t.Errorf("%s unexpected value (-want +got):\n%s", apis.AttrNUMANode, diff)
+			}
+		})
+	}
+}
+
+func TestAddVFIOAttributes(t *testing.T) {
+	pciPath := t.TempDir()
+	iommuGroupsPath := t.TempDir()
+	// 0000:3b:00.1 is alone in group 42, 0000:3c:00.0 and 0000:3c:00.1 share
+	// group 43 and 0000:3b:00.2 has no group.
+	groups := map[string]string{"0000:3b:00.1": "42", "0000:3c:00.0": "43", "0000:3c:00.1": "43"}
+	for _, address := range []string{"0000:3b:00.1", "0000:3b:00.2", "0000:3c:00.0", "0000:3c:00.1"} {
+		if err := os.MkdirAll(filepath.Join(pciPath, address), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		group, ok := groups[address]
+		if !ok {
+			continue
+		}
+		if err := os.Symlink(filepath.Join("..", "..", "..", "kernel", "iommu_groups", group), filepath.Join(pciPath, address, "iommu_group")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(iommuGroupsPath, group, "devices", address), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	device := newPCIDevice(pciPath, "0000:3b:00.1")
+	if !addVFIOAttributes(&device, pciPath, iommuGroupsPath, "0000:3b:00.1") {
+		t.Fatalf("addVFIOAttributes() = false, want true")
+	}
+	if got := device.Attributes[apis.AttrKind].StringValue; got == nil || *got != kindPCI {
+		t.Errorf("%s = %v, want %q", apis.AttrKind, got, kindPCI)
+	}
+	if got := device.Attributes[apis.AttrIOMMUGroup].StringValue; got == nil || *got != "42" {
+		t.Errorf("%s = %v, want 42", apis.AttrIOMMUGroup, got)
+	}
+
+	db := New()
+	db.updateDeviceStore([]resourceapi.Device{device})
+	if !db.IsVFIODevice(device.Name) {
+		t.Errorf("IsVFIODevice(%s) = false, want true", device.Name)
+	}
+	if group, err := db.GetIOMMUGroup(device.Name); err != nil || group != "42" {
+		t.Errorf("GetIOMMUGroup(%s) = %q, %v, want 42", device.Name, group, err)
+	}
+	if db.IsVFIODevice("missing") {
+		t.Errorf("IsVFIODevice(missing) = true, want false")
+	}
+
+	// Without IOMMU group the device can not be used by a pod.
+	device = newPCIDevice(pciPath, "0000:3b:00.2")
+	if addVFIOAttributes(&device, pciPath, iommuGroupsPath, "0000:3b:00.2") {
+		t.Errorf("addVFIOAttributes() without IOMMU group = true, want false")
+	}
+
+	// The group device gives access to all the devices of the group.
+	device = newPCIDevice(pciPath, "0000:3c:00.0")
+	if addVFIOAttributes(&device, pciPath, iommuGroupsPath, "0000:3c:00.0") {
+		t.Errorf("addVFIOAttributes() with an IOMMU group of two devices = true, want false")
+	}
+}
+
+func TestAddCarrierChangesAttribute(t *testing.T) {
+	basePath := t.TempDir()
+	for ifName, changes := range map[string]string{"eth0": "12\n", "eth1": "invalid\n", "eth2": "-1\n"} {
+		if err := os.MkdirAll(filepath.Join(basePath, ifName), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(basePath, ifName, "carrier_changes"), []byte(changes), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(basePath, "eth3"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ifName string
+		want   map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			ifName: "eth0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrCarrierChanges: {IntValue: ptr.To[int64](12)},
+			},
+		},
+		{ifName: "eth1", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+		{ifName: "eth2", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+		// unreadable counter
+		{ifName: "eth3", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+		{ifName: "missing", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ifName, func(t *testing.T) {
+			device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			addCarrierChangesAttribute(&device, basePath, tc.ifName)
+			if diff := cmp.Diff(tc.want, device.Attributes); diff != "" {
+				t.Errorf("addCarrierChangesAttribute() unexpected attributes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddCustomSysfsAttributes(t *testing.T) {
+	basePath := t.TempDir()
+	deviceDir := filepath.Join(basePath, "eth1", "device")
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"label":   "Onboard LAN 1\n",
+		"serial":  strings.Repeat("x", resourceapi.DeviceAttributeMaxValueLength+1),
+		"version": "",
+	} {
+		if err := os.WriteFile(filepath.Join(deviceDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attributes, err := ParseCustomSysfsAttributes("label=device/label,serial=device/serial,version=device/version,slot=device/slot")
+	if err != nil {
+		t.Fatalf("ParseCustomSysfsAttributes() failed: %v", err)
+	}
+
+	device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	addCustomSysfsAttributes(&device, basePath, "eth1", attributes)
+	want := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+		"custom.dra.net/label":   {StringValue: ptr.To("Onboard LAN 1")},
+		"custom.dra.net/version": {StringValue: ptr.To("")},
+	}
+	if diff := cmp.Diff(want, device.Attributes); diff != "" {
+		t.Errorf("addCustomSysfsAttributes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddQueueAttributes(t *testing.T) {
+	basePath := t.TempDir()
+	for ifName, queues := range map[string][]string{
+		"eth0": {"rx-0", "rx-1", "rx-2", "rx-3", "tx-0", "tx-1"},
+		"eth1": {"rx-0", "tx-0"},
+		"eth2": {},
+	} {
+		if err := os.MkdirAll(filepath.Join(basePath, ifName, "queues"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, queue := range queues {
+			if err := os.MkdirAll(filepath.Join(basePath, ifName, "queues", queue), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(basePath, "eth3"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ifName string
+		want   map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			ifName: "eth0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrNumRxQueues: {IntValue: ptr.To[int64](4)},
+				apis.AttrNumTxQueues: {IntValue: ptr.To[int64](2)},
+			},
+		},
+		{
+			ifName: "eth1",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrNumRxQueues: {IntValue: ptr.To[int64](1)},
+				apis.AttrNumTxQueues: {IntValue: ptr.To[int64](1)},
+			},
+		},
+		{
+			ifName: "eth2",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrNumRxQueues: {IntValue: ptr.To[int64](0)},
+				apis.AttrNumTxQueues: {IntValue: ptr.To[int64](0)},
+			},
+		},
+		// no queues directory
+		{ifName: "eth3", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+		{ifName: "missing", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ifName, func(t *testing.T) {
+			device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			addQueueAttributes(&device, basePath, tc.ifName)
+			if diff := cmp.Diff(tc.want, device.Attributes); diff != "" {
+				t.Errorf("addQueueAttributes() unexpected attributes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddRDMAPairAttributes(t *testing.T) {
+	cases := []struct {
+		name        string
+		ifName      string
+		rdmaDevName string
+		netDevName  string
+		want        map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			name:        "netdev with RDMA device",
+			ifName:      "eth2",
+			rdmaDevName: "mlx5_1",
+			netDevName:  "eth2",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrInterfaceName: {StringValue: ptr.To("eth2")},
+				apis.AttrRDMADevice:    {StringValue: ptr.To("mlx5_1")},
+			},
+		},
+		{
+			name:        "IB-only device with netdev",
+			rdmaDevName: "mlx5_1",
+			netDevName:  "ib0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrRDMADevice: {StringValue: ptr.To("mlx5_1")},
+				apis.AttrNetDevName: {StringValue: ptr.To("ib0")},
+			},
+		},
+		{name: "no RDMA device", netDevName: "eth2", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+		{name: "no netdev", rdmaDevName: "mlx5_1", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			if tc.ifName != "" {
+				device.Attributes[apis.AttrInterfaceName] = resourceapi.DeviceAttribute{StringValue: ptr.To(tc.ifName)}
+			}
+			addRDMAPairAttributes(&device, tc.rdmaDevName, tc.netDevName)
+			if diff := cmp.Diff(tc.want, device.Attributes); diff != "" {
+				t.Errorf("addRDMAPairAttributes() unexpected attributes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 // TestAddLinkAttributesIPLengthCap covers the per-attribute string-value
 // limit on AttrIPv4 / AttrIPv6 (see resourceapi.DeviceAttributeMaxValueLength).
 // The kube-proxy IPVS dummy interface (kube-ipvs0) accumulates every cluster
@@ -386,6 +809,108 @@ func testAddLinkAttributesIPBoundaryLength_Namespaced(t *testing.T) {
 	}
 }
 
+// TestAddIPAttributes checks that the address attributes are absent, not
+// empty, on the interfaces without addresses, so they can be filtered with
+// has() in the CEL selectors the scheduler evaluates.
+func TestAddIPAttributes(t *testing.T) {
+	addr := func(cidr string) netlink.Addr {
+		t.Helper()
+		address, err := netlink.ParseAddr(cidr)
+		if err != nil {
+			t.Fatalf("ParseAddr(%q): %v", cidr, err)
+		}
+		return *address
+	}
+	hasIPv4, err := compileSelector(`has(device.attributes["dra.net"].ipv4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasIPv6, err := compileSelector(`has(device.attributes["dra.net"].ipv6)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		addresses []netlink.Addr
+		wantIPv4  string
+		wantIPv6  string
+	}{
+		{
+			name: "no addresses",
+		},
+		{
+			name:      "link-local addresses only",
+			addresses: []netlink.Addr{addr("169.254.10.1/16"), addr("fe80::1/64")},
+		},
+		{
+			name:      "IPv4 address",
+			addresses: []netlink.Addr{addr("fe80::1/64"), addr("10.0.0.1/24")},
+			wantIPv4:  "10.0.0.1/24",
+		},
+		{
+			name:      "IPv6 address",
+			addresses: []netlink.Addr{addr("2001:db8::1/64")},
+			wantIPv6:  "2001:db8::1/64",
+		},
+		{
+			name:      "dual stack",
+			addresses: []netlink.Addr{addr("10.0.0.2/24"), addr("10.0.0.1/24"), addr("2001:db8::1/64")},
+			wantIPv4:  "10.0.0.1/24,10.0.0.2/24",
+			wantIPv6:  "2001:db8::1/64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &resourceapi.Device{
+				Name:       "eth1",
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{},
+			}
+			addIPAttributes(device, "eth1", tt.addresses)
+
+			for _, attr := range []struct {
+				name     resourceapi.QualifiedName
+				want     string
+				selector celSelector
+			}{
+				{name: apis.AttrIPv4, want: tt.wantIPv4, selector: hasIPv4},
+				{name: apis.AttrIPv6, want: tt.wantIPv6, selector: hasIPv6},
+			} {
+				got, ok := device.Attributes[attr.name]
+				if attr.want == "" && ok {
+					t.Errorf("attribute %s = %+v, want it absent", attr.name, got)
+				}
+				if attr.want != "" && (!ok || got.StringValue == nil || *got.StringValue != attr.want) {
+					t.Errorf("attribute %s = %+v, want %q", attr.name, got, attr.want)
+				}
+				matches, err := attr.selector(t.Context(), device)
+				if err != nil {
+					t.Fatalf("failed to evaluate the selector of %s: %v", attr.name, err)
+				}
+				if matches != (attr.want != "") {
+					t.Errorf("has() of %s = %v, want %v", attr.name, matches, attr.want != "")
+				}
+			}
+		})
+	}
+}
+
+// celSelector evaluates a device selector of a ResourceClaim.
+type celSelector func(ctx context.Context, device *resourceapi.Device) (bool, error)
+
+// compileSelector compiles the expression with the CEL environment of the
+// scheduler, the attributes of the devices are in the dra.net domain.
+func compileSelector(expression string) (celSelector, error) {
+	result := dracel.GetCompiler(dracel.Features{}).CompileCELExpression(expression, dracel.Options{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to compile %q: %v", expression, result.Error)
+	}
+	return func(ctx context.Context, device *resourceapi.Device) (bool, error) {
+		matches, _, err := result.DeviceMatches(ctx, dracel.Device{Driver: apis.AttrPrefix, Attributes: device.Attributes})
+		return matches, err
+	}, nil
+}
+
 // TestBuildIPList exercises the truncation helper directly, away from netns
 // plumbing, so the byte-arithmetic boundaries are easy to read and the test
 // runs on any platform (not just linux).
@@ -565,3 +1090,238 @@ func TestGetProviderAttributes(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCloudInstanceLoader(t *testing.T) {
+	release := make(chan struct{})
+	instance := &mockCloudInstance{
+		deviceAttributes: map[string]map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			"00:11:22:33:44:55": {
+				gce.AttrGCENetworkName: {StringValue: ptr.To("test-network")},
+			},
+		},
+	}
+	db := New(WithCloudInstanceLoader(func(ctx context.Context) (cloudprovider.CloudInstance, error) {
+		select {
+		case <-release:
+			return instance, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.runCloudInstanceLoader(ctx)
+
+	newDevices := func() []resourceapi.Device {
+		return []resourceapi.Device{{
+			Name: "eth1",
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrMac: {StringValue: ptr.To("00:11:22:33:44:55")},
+			},
+		}}
+	}
+
+	// The devices are published while the metadata is not available yet.
+	devices := db.addCloudAttributes(newDevices())
+	if _, ok := devices[0].Attributes[gce.AttrGCENetworkName]; ok {
+		t.Errorf("device has cloud attributes before the cloud instance properties are available")
+	}
+
+	close(release)
+	select {
+	case <-db.rescanCh:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("no rescan requested once the cloud instance properties are available")
+	}
+	devices = db.addCloudAttributes(newDevices())
+	if got := devices[0].Attributes[gce.AttrGCENetworkName].StringValue; got == nil || *got != "test-network" {
+		t.Errorf("device network name = %v, want test-network once the cloud instance properties are available", got)
+	}
+}
+
+// mockProfileCloudInstance is a cloud instance resolving the profiles.
+type mockProfileCloudInstance struct {
+	mockCloudInstance
+}
+
+func (m *mockProfileCloudInstance) GetProfileConfig(_ cloudprovider.DeviceIdentifiers, _ types.UID, config *apis.NetworkConfig) (*apis.NetworkConfig, error) {
+	return config, nil
+}
+
+func (m *mockProfileCloudInstance) ReleaseProfileConfig(_ cloudprovider.DeviceIdentifiers, _ types.UID, _ *apis.NetworkConfig) error {
+	return nil
+}
+
+func TestGetProfileProviderFromLoadedCloudInstance(t *testing.T) {
+	db := New(WithCloudProfileProvider(true))
+	if p := db.getProfileProvider(); p != nil {
+		t.Errorf("getProfileProvider() = %v before the cloud instance is loaded, want nil", p)
+	}
+	instance := &mockProfileCloudInstance{}
+	db.instance = instance
+	if p := db.getProfileProvider(); p != instance {
+		t.Errorf("getProfileProvider() = %v once the cloud instance is loaded, want the cloud instance", p)
+	}
+
+	db = New(WithCloudInstance(instance))
+	if p := db.getProfileProvider(); p != nil {
+		t.Errorf("getProfileProvider() = %v without the cloud profile provider, want nil", p)
+	}
+}
+
+func TestUpdateDeviceStoreNetworkMTU(t *testing.T) {
+	instance := &gce.GCEInstance{}
+	if err := json.Unmarshal([]byte(`[{"mac":"42:01:c0:a8:01:02","mtu":8244,"network":"projects/12345/networks/dra-net-1"}]`), &instance.Interfaces); err != nil {
+		t.Fatalf("failed to parse metadata: %v", err)
+	}
+	db := New(WithCloudInstance(instance))
+	db.updateDeviceStore([]resourceapi.Device{
+		{
+			Name: "gpu0rdma0",
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrMac: {StringValue: ptr.To("42:01:c0:a8:01:02")},
+			},
+		},
+		{
+			Name: "eth0",
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrMac: {StringValue: ptr.To("42:01:0a:80:00:46")},
+			},
+		},
+	})
+
+	if mtu, ok := db.GetNetworkMTU("gpu0rdma0"); !ok || mtu != 8244 {
+		t.Errorf("GetNetworkMTU(gpu0rdma0) = %d, %v; want 8244, true", mtu, ok)
+	}
+	if mtu, ok := db.GetNetworkMTU("eth0"); ok {
+		t.Errorf("GetNetworkMTU(eth0) = %d, want no MTU for a device without metadata", mtu)
+	}
+}
+
+func TestRefreshUplinkInterfaces(t *testing.T) {
+	tests := []struct {
+		name         string
+		exposeUplink bool
+		uplinks      []sets.Set[string]
+		want         []sets.Set[string]
+	}{
+		{
+			name:    "default gateway moves to another interface",
+			uplinks: []sets.Set[string]{sets.New("eth0"), sets.New("eth0"), sets.New("eth1", "bond0")},
+			want:    []sets.Set[string]{sets.New("eth0"), sets.New("eth0"), sets.New("eth1", "bond0")},
+		},
+		{
+			name:    "default gateway transiently missing",
+			uplinks: []sets.Set[string]{sets.New("eth0"), sets.New[string](), sets.New("eth1")},
+			want:    []sets.Set[string]{sets.New("eth0"), sets.New("eth0"), sets.New("eth1")},
+		},
+		{
+			name:    "no default gateway",
+			uplinks: []sets.Set[string]{sets.New[string](), sets.New[string]()},
+			want:    []sets.Set[string]{sets.New[string](), sets.New[string]()},
+		},
+		{
+			name:         "expose uplink",
+			exposeUplink: true,
+			uplinks:      []sets.Set[string]{sets.New("eth0"), sets.New("eth1")},
+			want:         []sets.Set[string]{sets.New[string](), sets.New[string]()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			db := New(WithExposeUplink(tt.exposeUplink))
+			db.excludedUplinkInterfaces = func() sets.Set[string] {
+				uplinks := tt.uplinks[calls]
+				calls++
+				return uplinks
+			}
+			for i, want := range tt.want {
+				db.refreshUplinkInterfaces()
+				if !db.gwInterfaces.Equal(want) {
+					t.Errorf("refresh %d: gwInterfaces = %v, want %v", i, sets.List(db.gwInterfaces), sets.List(want))
+				}
+			}
+			if tt.exposeUplink && calls != 0 {
+				t.Errorf("uplink interfaces evaluated %d times with exposeUplink", calls)
+			}
+		})
+	}
+}
+
+func TestRefreshLinkLastUp(t *testing.T) {
+	linkDevice := func(name, state string) resourceapi.Device {
+		return resourceapi.Device{
+			Name: name,
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrState: {StringValue: ptr.To(state)},
+			},
+		}
+	}
+	type scan struct {
+		elapsed time.Duration
+		devices []resourceapi.Device
+		want    sets.Set[string]
+	}
+	tests := []struct {
+		name  string
+		scans []scan
+	}{
+		{
+			name: "links up and not reporting the state are published",
+			scans: []scan{
+				{
+					devices: []resourceapi.Device{linkDevice("eth1", "up"), linkDevice("eth2", "unknown"), {Name: "mlx5_0"}},
+					want:    sets.New("eth1", "eth2", "mlx5_0"),
+				},
+			},
+		},
+		{
+			name: "link never up is not published until it comes up",
+			scans: []scan{
+				{devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New[string]()},
+				{elapsed: time.Minute, devices: []resourceapi.Device{linkDevice("eth1", "lowerlayerdown")}, want: sets.New[string]()},
+				{elapsed: time.Minute, devices: []resourceapi.Device{linkDevice("eth1", "up")}, want: sets.New("eth1")},
+			},
+		},
+		{
+			name: "flapping link is kept during the grace period",
+			scans: []scan{
+				{devices: []resourceapi.Device{linkDevice("eth1", "up")}, want: sets.New("eth1")},
+				{elapsed: 10 * time.Second, devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New("eth1")},
+				{elapsed: 10 * time.Second, devices: []resourceapi.Device{linkDevice("eth1", "up")}, want: sets.New("eth1")},
+				{elapsed: 25 * time.Second, devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New("eth1")},
+			},
+		},
+		{
+			name: "link down longer than the grace period is dropped",
+			scans: []scan{
+				{devices: []resourceapi.Device{linkDevice("eth1", "up")}, want: sets.New("eth1")},
+				{elapsed: 10 * time.Second, devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New("eth1")},
+				{elapsed: 20 * time.Second, devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New[string]()},
+				{elapsed: time.Minute, devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New[string]()},
+			},
+		},
+		{
+			name: "removed link is forgotten",
+			scans: []scan{
+				{devices: []resourceapi.Device{linkDevice("eth1", "up")}, want: sets.New("eth1")},
+				{elapsed: time.Second, want: sets.New[string]()},
+				{elapsed: time.Second, devices: []resourceapi.Device{linkDevice("eth1", "down")}, want: sets.New[string]()},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClock := clocktesting.NewFakeClock(time.Now())
+			db := New(WithPublishLinkUpOnly(true, 30*time.Second))
+			db.clock = fakeClock
+			for i, s := range tt.scans {
+				fakeClock.Step(s.elapsed)
+				if got := db.refreshLinkLastUp(s.devices); !got.Equal(s.want) {
+					t.Errorf("scan %d: link up devices = %v, want %v", i, sets.List(got), sets.List(s.want))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// The network managers of the host keep the state of the links they know in
+// runtime files named after the interface index. There is no kernel interface
+// telling which program configures a link, these files are the only hint and
+// they must be mounted in the driver container.
+const (
+	// networkdLinksPath contains the state of the links of systemd-networkd.
+	// $ cat /run/systemd/netif/links/2
+	// ADMIN_STATE=configured
+	// OPER_STATE=routable
+	networkdLinksPath = "/run/systemd/netif/links"
+	// networkManagerDevicesPath contains the state of the devices of
+	// NetworkManager.
+	// $ cat /run/NetworkManager/devices/2
+	// [device]
+	// managed=true
+	networkManagerDevicesPath = "/run/NetworkManager/devices"
+)
+
+// networkdManagesLink returns true if systemd-networkd configures the link,
+// a .network file matched it. The links without matching file are in the
+// unmanaged state, and the links being set up by udev in the pending or
+// initialized states are not considered managed yet.
+func networkdManagesLink(linksPath string, ifIndex int) bool {
+	data, err := os.ReadFile(filepath.Join(linksPath, strconv.Itoa(ifIndex)))
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || key != "ADMIN_STATE" {
+			continue
+		}
+		switch value {
+		case "configuring", "configured", "failed":
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// networkManagerManagesLink returns true if NetworkManager manages the device,
+// the managed key of the [device] section of its state file is true.
+func networkManagerManagesLink(devicesPath string, ifIndex int) bool {
+	data, err := os.ReadFile(filepath.Join(devicesPath, strconv.Itoa(ifIndex)))
+	if err != nil {
+		return false
+	}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == "[device]" && strings.TrimSpace(key) == "managed" {
+			return strings.TrimSpace(value) == "true"
+		}
+	}
+	return false
+}
+
+// hostManagedFromState returns true if a network manager of the host manages
+// the link, or false for ok if no state directory has state files, e.g. they
+// are not mounted in the driver container, and the management is unknown. The
+// runtime creates the missing host paths of the mounts as empty directories,
+// a manager running on the host has at least the state of the loopback.
+func hostManagedFromState(linksPath, devicesPath string, ifIndex int) (managed bool, ok bool) {
+	for _, dir := range []string{linksPath, devicesPath} {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			ok = true
+		}
+	}
+	if !ok {
+		return false, false
+	}
+	return networkdManagesLink(linksPath, ifIndex) || networkManagerManagesLink(devicesPath, ifIndex), true
+}
+
+// addHostManagedAttribute adds whether the interface is managed by the network
+// manager of the host, claiming such interface results in the manager fighting
+// the driver to reconfigure it. The attribute is not published when the
+// management can not be detected.
+func addHostManagedAttribute(device *resourceapi.Device, linksPath, devicesPath string, ifIndex int) {
+	if managed, ok := hostManagedFromState(linksPath, devicesPath, ifIndex); ok {
+		device.Attributes[apis.AttrHostManaged] = resourceapi.DeviceAttribute{BoolValue: &managed}
+	}
+}
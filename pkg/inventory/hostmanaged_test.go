@@ -0,0 +1,156 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func writeStateFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetworkdManagesLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		want  bool
+	}{
+		{
+			name:  "configured",
+			state: "# This is private data. Do not parse.\nADMIN_STATE=configured\nOPER_STATE=routable\nNETWORK_FILE=/etc/systemd/network/10-eth1.network\n",
+			want:  true,
+		},
+		{
+			name:  "configuring",
+			state: "ADMIN_STATE=configuring\nOPER_STATE=carrier\n",
+			want:  true,
+		},
+		{
+			name:  "failed",
+			state: "ADMIN_STATE=failed\n",
+			want:  true,
+		},
+		{
+			name:  "unmanaged",
+			state: "ADMIN_STATE=unmanaged\nOPER_STATE=off\n",
+		},
+		{
+			name:  "pending",
+			state: "ADMIN_STATE=pending\n",
+		},
+		{
+			name:  "no admin state",
+			state: "OPER_STATE=routable\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeStateFile(t, dir, "3", tt.state)
+			if got := networkdManagesLink(dir, 3); got != tt.want {
+				t.Errorf("networkdManagesLink() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if networkdManagesLink(t.TempDir(), 3) {
+		t.Errorf("networkdManagesLink() = true for a link without state file")
+	}
+}
+
+func TestNetworkManagerManagesLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		want  bool
+	}{
+		{
+			name:  "managed",
+			state: "[device]\nmanaged=true\nperm-hw-addr-fake=02:00:00:00:00:01\nconnection-uuid=5fb06bd0-0bb0-7ffb-45f1-d6edd65f3e03\n",
+			want:  true,
+		},
+		{
+			name:  "unmanaged",
+			state: "[device]\nmanaged=false\n",
+		},
+		{
+			name:  "managed key of another section",
+			state: "[other]\nmanaged=true\n[device]\nperm-hw-addr-fake=02:00:00:00:00:01\n",
+		},
+		{
+			name:  "empty",
+			state: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeStateFile(t, dir, "3", tt.state)
+			if got := networkManagerManagesLink(dir, 3); got != tt.want {
+				t.Errorf("networkManagerManagesLink() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHostManagedAttribute(t *testing.T) {
+	tmp := t.TempDir()
+	linksPath := filepath.Join(tmp, "systemd", "netif", "links")
+	devicesPath := filepath.Join(tmp, "NetworkManager", "devices")
+
+	device := &resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	addHostManagedAttribute(device, linksPath, devicesPath, 2)
+	if _, ok := device.Attributes[apis.AttrHostManaged]; ok {
+		t.Errorf("%s published without state directories", apis.AttrHostManaged)
+	}
+
+	// The runtime creates the host paths of the mounts missing on the host.
+	for _, dir := range []string{linksPath, devicesPath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	addHostManagedAttribute(device, linksPath, devicesPath, 2)
+	if _, ok := device.Attributes[apis.AttrHostManaged]; ok {
+		t.Errorf("%s published with empty state directories", apis.AttrHostManaged)
+	}
+
+	writeStateFile(t, linksPath, "2", "ADMIN_STATE=configured\n")
+	writeStateFile(t, linksPath, "3", "ADMIN_STATE=unmanaged\n")
+	writeStateFile(t, devicesPath, "4", "[device]\nmanaged=true\n")
+	for ifIndex, want := range map[int]bool{2: true, 3: false, 4: true, 5: false} {
+		device := &resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+		addHostManagedAttribute(device, linksPath, devicesPath, ifIndex)
+		attr, ok := device.Attributes[apis.AttrHostManaged]
+		if !ok || attr.BoolValue == nil || *attr.BoolValue != want {
+			t.Errorf("interface %d: %s = %v, want %v", ifIndex, apis.AttrHostManaged, attr.BoolValue, want)
+		}
+	}
+}
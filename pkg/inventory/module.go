@@ -0,0 +1,195 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// The attributes of the ETHTOOL_MSG_MODULE_EEPROM_GET request and reply,
+// not defined by x/sys/unix.
+const (
+	ethtoolAModuleEEPROMHeader     = 1
+	ethtoolAModuleEEPROMOffset     = 2
+	ethtoolAModuleEEPROMLength     = 3
+	ethtoolAModuleEEPROMPage       = 4
+	ethtoolAModuleEEPROMBank       = 5
+	ethtoolAModuleEEPROMI2CAddress = 6
+	ethtoolAModuleEEPROMData       = 7
+)
+
+const (
+	// moduleI2CAddress is the I2C address of the EEPROM of the modules, the
+	// A0h page of SFP modules.
+	moduleI2CAddress = 0x50
+	// moduleVendorNameLength is the length of the vendor name, padded with
+	// spaces, in all the memory maps.
+	moduleVendorNameLength = 16
+)
+
+// moduleLayout is where a memory map stores the vendor name.
+type moduleLayout struct {
+	// moduleType is the name of the form factor of the module.
+	moduleType   string
+	vendorPage   uint8
+	vendorOffset uint32
+}
+
+// moduleLayouts maps the SFF-8024 identifiers, the first byte of the EEPROM,
+// to the form factor of the module and the location of its vendor name:
+// SFF-8472 for SFP, SFF-8636 for QSFP and CMIS for the newer modules.
+var moduleLayouts = map[byte]moduleLayout{
+	0x03: {moduleType: "SFP", vendorOffset: 20},
+	0x0c: {moduleType: "QSFP", vendorOffset: 148},
+	0x0d: {moduleType: "QSFP+", vendorOffset: 148},
+	0x11: {moduleType: "QSFP28", vendorOffset: 148},
+	0x18: {moduleType: "QSFP-DD", vendorOffset: 129},
+	0x19: {moduleType: "OSFP", vendorOffset: 129},
+	0x1b: {moduleType: "DSFP", vendorOffset: 129},
+	0x1e: {moduleType: "QSFP+", vendorOffset: 129},
+	0x1f: {moduleType: "SFP-DD", vendorOffset: 129},
+	0x20: {moduleType: "SFP+", vendorOffset: 129},
+}
+
+// moduleInfo is the transceiver module plugged in a network interface.
+type moduleInfo struct {
+	moduleType string
+	// vendor is empty if it can not be read or is not printable.
+	vendor string
+}
+
+// moduleEEPROMReader reads length bytes at offset of a page of the EEPROM of
+// a module.
+type moduleEEPROMReader func(page uint8, offset, length uint32) ([]byte, error)
+
+// readModuleInfo identifies the module from its EEPROM. It fails if there is
+// no module, its EEPROM can not be read or its identifier is not known.
+func readModuleInfo(read moduleEEPROMReader) (*moduleInfo, error) {
+	identifier, err := read(0, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(identifier) == 0 {
+		return nil, errors.New("empty module EEPROM")
+	}
+	layout, ok := moduleLayouts[identifier[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown module identifier %#02x", identifier[0])
+	}
+	info := &moduleInfo{moduleType: layout.moduleType}
+	vendor, err := read(layout.vendorPage, layout.vendorOffset, moduleVendorNameLength)
+	if err != nil {
+		klog.V(4).Infof("could not read the vendor of the %s module: %v", layout.moduleType, err)
+		return info, nil
+	}
+	info.vendor = moduleVendorName(vendor)
+	return info, nil
+}
+
+// moduleVendorName returns the vendor name without its padding, or an empty
+// string if it is not printable ASCII, e.g. a blank EEPROM.
+func moduleVendorName(data []byte) string {
+	name := strings.TrimRight(string(data), " \x00")
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] > 0x7e {
+			return ""
+		}
+	}
+	return strings.TrimSpace(name)
+}
+
+// getModuleInfo reads the EEPROM of the module plugged in the interface with
+// ETHTOOL_MSG_MODULE_EEPROM_GET. Devices without a module, e.g. virtual
+// devices and VFs, or whose driver can not read it, return an error.
+func getModuleInfo(ifName string) (*moduleInfo, error) {
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial generic netlink: %w", err)
+	}
+	defer conn.Close()
+	family, err := conn.GetFamily(unix.ETHTOOL_GENL_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the %s family: %w", unix.ETHTOOL_GENL_NAME, err)
+	}
+	read := func(page uint8, offset, length uint32) ([]byte, error) {
+		ae := netlink.NewAttributeEncoder()
+		ae.Nested(ethtoolAModuleEEPROMHeader, func(nae *netlink.AttributeEncoder) error {
+			nae.String(unix.ETHTOOL_A_HEADER_DEV_NAME, ifName)
+			return nil
+		})
+		ae.Uint32(ethtoolAModuleEEPROMOffset, offset)
+		ae.Uint32(ethtoolAModuleEEPROMLength, length)
+		ae.Uint8(ethtoolAModuleEEPROMPage, page)
+		ae.Uint8(ethtoolAModuleEEPROMBank, 0)
+		ae.Uint8(ethtoolAModuleEEPROMI2CAddress, moduleI2CAddress)
+		data, err := ae.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attributes: %w", err)
+		}
+		msgs, err := conn.Execute(genetlink.Message{
+			Header: genetlink.Header{
+				Command: unix.ETHTOOL_MSG_MODULE_EEPROM_GET,
+				Version: unix.ETHTOOL_GENL_VERSION,
+			},
+			Data: data,
+		}, family.ID, netlink.Request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the module EEPROM of %s: %w", ifName, err)
+		}
+		for _, msg := range msgs {
+			ad, err := netlink.NewAttributeDecoder(msg.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create attribute decoder: %w", err)
+			}
+			for ad.Next() {
+				if ad.Type() == ethtoolAModuleEEPROMData {
+					return ad.Bytes(), nil
+				}
+			}
+			if err := ad.Err(); err != nil {
+				return nil, fmt.Errorf("module EEPROM attribute decoder error: %w", err)
+			}
+		}
+		return nil, fmt.Errorf("no module EEPROM data for %s", ifName)
+	}
+	return readModuleInfo(read)
+}
+
+// addModuleAttributes adds the type and the vendor of the transceiver module
+// of the interface. The attributes are absent if there is no module or it can
+// not be identified, the vendor alone if it can not be read.
+func addModuleAttributes(device *resourceapi.Device, info *moduleInfo) {
+	if info == nil {
+		return
+	}
+	moduleType := info.moduleType
+	device.Attributes[apis.AttrModuleType] = resourceapi.DeviceAttribute{StringValue: &moduleType}
+	if info.vendor != "" {
+		vendor := info.vendor
+		device.Attributes[apis.AttrModuleVendor] = resourceapi.DeviceAttribute{StringValue: &vendor}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// syntheticEEPROM returns a reader of the page 0 of a module EEPROM with the
+// identifier and the vendor name at offset.
+func syntheticEEPROM(identifier byte, vendor string, offset int) moduleEEPROMReader {
+	page := make([]byte, 256)
+	page[0] = identifier
+	copy(page[offset:offset+moduleVendorNameLength], fmt.Sprintf("%-16s", vendor))
+	return func(pageNum uint8, off, length uint32) ([]byte, error) {
+		if pageNum != 0 {
+			return nil, fmt.Errorf("page %d not supported", pageNum)
+		}
+		// the kernel does not allow to cross the 128 bytes boundary
+		if off < 128 && off+length > 128 {
+			return nil, fmt.Errorf("read of %d bytes at offset %d crosses the lower page", length, off)
+		}
+		return page[off : off+length], nil
+	}
+}
+
+func Test_readModuleInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		read    moduleEEPROMReader
+		want    *moduleInfo
+		wantErr bool
+	}{
+		{
+			name: "SFP",
+			read: syntheticEEPROM(0x03, "FINISAR CORP.", 20),
+			want: &moduleInfo{moduleType: "SFP", vendor: "FINISAR CORP."},
+		},
+		{
+			name: "QSFP28",
+			read: syntheticEEPROM(0x11, "Mellanox", 148),
+			want: &moduleInfo{moduleType: "QSFP28", vendor: "Mellanox"},
+		},
+		{
+			name: "QSFP-DD",
+			read: syntheticEEPROM(0x18, "INNOLIGHT", 129),
+			want: &moduleInfo{moduleType: "QSFP-DD", vendor: "INNOLIGHT"},
+		},
+		{
+			name: "blank vendor",
+			read: syntheticEEPROM(0x0d, "", 148),
+			want: &moduleInfo{moduleType: "QSFP+"},
+		},
+		{
+			name: "unprintable vendor",
+			read: syntheticEEPROM(0x03, "\xff\xff\xff\xff", 20),
+			want: &moduleInfo{moduleType: "SFP"},
+		},
+		{
+			name: "vendor not readable",
+			read: func(page uint8, offset, length uint32) ([]byte, error) {
+				if offset == 0 {
+					return []byte{0x19}, nil
+				}
+				return nil, errors.New("input/output error")
+			},
+			want: &moduleInfo{moduleType: "OSFP"},
+		},
+		{
+			name:    "unknown identifier",
+			read:    syntheticEEPROM(0x00, "", 20),
+			wantErr: true,
+		},
+		{
+			name: "unsupported device",
+			read: func(page uint8, offset, length uint32) ([]byte, error) {
+				return nil, errors.New("operation not supported")
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty EEPROM",
+			read: func(page uint8, offset, length uint32) ([]byte, error) {
+				return nil, nil
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readModuleInfo(tt.read)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readModuleInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("readModuleInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addModuleAttributes(t *testing.T) {
+	device := &resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	addModuleAttributes(device, nil)
+	if len(device.Attributes) != 0 {
+		t.Errorf("addModuleAttributes() without module = %v, want no attributes", device.Attributes)
+	}
+
+	addModuleAttributes(device, &moduleInfo{moduleType: "SFP"})
+	if got := device.Attributes[apis.AttrModuleType].StringValue; got == nil || *got != "SFP" {
+		t.Errorf("module type = %v, want SFP", got)
+	}
+	if _, ok := device.Attributes[apis.AttrModuleVendor]; ok {
+		t.Errorf("module vendor published for a module without vendor")
+	}
+
+	addModuleAttributes(device, &moduleInfo{moduleType: "QSFP28", vendor: "Mellanox"})
+	if got := device.Attributes[apis.AttrModuleVendor].StringValue; got == nil || *got != "Mellanox" {
+		t.Errorf("module vendor = %v, want Mellanox", got)
+	}
+}
+
+func Test_getModuleInfoUnsupported(t *testing.T) {
+	// the loopback has no module
+	if info, err := getModuleInfo("lo"); err == nil {
+		t.Errorf("getModuleInfo(lo) = %+v, want an error", info)
+	}
+}
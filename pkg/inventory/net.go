@@ -17,11 +17,15 @@ limitations under the License.
 package inventory
 
 import (
+	"encoding/binary"
+	"fmt"
 	"math"
+	"net"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"golang.org/x/sys/unix"
 	"sigs.k8s.io/dranet/internal/nlwrap"
 
@@ -215,3 +219,54 @@ func getTcxFilters(device netlink.Link) ([]string, bool) {
 	}
 	return programNames.UnsortedList(), isTcxEBPF
 }
+
+// ouiFromHardwareAddr returns the Organizationally Unique Identifier of an
+// Ethernet MAC address, its first three octets (e.g. "b8:ce:f6"), so devices
+// can be filtered by vendor. Locally administered and multicast addresses,
+// like the random ones of virtual interfaces, have no OUI.
+func ouiFromHardwareAddr(mac net.HardwareAddr) string {
+	if len(mac) != 6 || mac[0]&0x03 != 0 {
+		return ""
+	}
+	return fmt.Sprintf("%02x:%02x:%02x", mac[0], mac[1], mac[2])
+}
+
+// getLinkMaxMTU returns the largest MTU supported by the link, reported by the
+// kernel in the IFLA_MAX_MTU attribute, which the netlink library does not
+// parse. It returns false if the driver does not report one.
+func getLinkMaxMTU(index int) (int, bool) {
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWLINK)
+	if err != nil || len(msgs) == 0 {
+		klog.V(4).Infof("failed to get link %d: %v", index, err)
+		return 0, false
+	}
+	return maxMTUFromLinkMessage(msgs[0])
+}
+
+// maxMTUFromLinkMessage returns the IFLA_MAX_MTU attribute of a RTM_NEWLINK
+// message. A zero value means the device has no upper limit, so it is
+// considered not reported.
+func maxMTUFromLinkMessage(msg []byte) (int, bool) {
+	if len(msg) < unix.SizeofIfInfomsg {
+		return 0, false
+	}
+	attrs, err := nl.ParseRouteAttr(msg[unix.SizeofIfInfomsg:])
+	if err != nil {
+		return 0, false
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type != unix.IFLA_MAX_MTU || len(attr.Value) < 4 {
+			continue
+		}
+		maxMTU := binary.NativeEndian.Uint32(attr.Value[:4])
+		if maxMTU == 0 {
+			return 0, false
+		}
+		return int(maxMTU), true
+	}
+	return 0, false
+}
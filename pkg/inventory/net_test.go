@@ -23,6 +23,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/util/sets"
 
@@ -522,3 +523,77 @@ func addChildBond(t *testing.T, name string, masterIndex int) netlink.Link {
 	}
 	return link
 }
+
+func TestOUIFromHardwareAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		mac  string
+		want string
+	}{
+		{name: "mellanox", mac: "b8:ce:f6:12:34:56", want: "b8:ce:f6"},
+		{name: "intel upper case", mac: "3C:FD:FE:AB:CD:EF", want: "3c:fd:fe"},
+		{name: "gce virtual nic", mac: "42:01:0a:80:00:46"},
+		{name: "locally administered", mac: "9a:41:2e:4f:86:16"},
+		{name: "multicast", mac: "01:00:5e:00:00:01"},
+		{name: "infiniband", mac: "00:00:10:29:fe:80:00:00:00:00:00:00:0c:42:a1:03:00:9b:4c:2e"},
+		{name: "no address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mac net.HardwareAddr
+			if tt.mac != "" {
+				var err error
+				mac, err = net.ParseMAC(tt.mac)
+				if err != nil {
+					t.Fatalf("failed to parse MAC %q: %v", tt.mac, err)
+				}
+			}
+			if got := ouiFromHardwareAddr(mac); got != tt.want {
+				t.Errorf("ouiFromHardwareAddr(%q) = %q, want %q", tt.mac, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxMTUFromLinkMessage(t *testing.T) {
+	linkMessage := func(attrs ...*nl.RtAttr) []byte {
+		msg := nl.NewIfInfomsg(unix.AF_UNSPEC).Serialize()
+		for _, attr := range attrs {
+			msg = append(msg, attr.Serialize()...)
+		}
+		return msg
+	}
+	tests := []struct {
+		name   string
+		msg    []byte
+		want   int
+		wantOk bool
+	}{
+		{
+			name:   "max MTU reported",
+			msg:    linkMessage(nl.NewRtAttr(unix.IFLA_MTU, nl.Uint32Attr(1500)), nl.NewRtAttr(unix.IFLA_MAX_MTU, nl.Uint32Attr(9216))),
+			want:   9216,
+			wantOk: true,
+		},
+		{
+			name: "max MTU not reported",
+			msg:  linkMessage(nl.NewRtAttr(unix.IFLA_MTU, nl.Uint32Attr(1500))),
+		},
+		{
+			name: "no upper limit",
+			msg:  linkMessage(nl.NewRtAttr(unix.IFLA_MAX_MTU, nl.Uint32Attr(0))),
+		},
+		{
+			name: "truncated message",
+			msg:  []byte{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := maxMTUFromLinkMessage(tt.msg)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("maxMTUFromLinkMessage() = %d, %t, want %d, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
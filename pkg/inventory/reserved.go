@@ -0,0 +1,103 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+// reservedAliasPrefix is the prefix of the alias of the interfaces reserved
+// for the host, e.g. `ip link set dev eth2 alias dranet-reserved:storage`.
+const reservedAliasPrefix = "dranet-reserved"
+
+// readReservedDevices parses the file of the devices reserved for the host,
+// one interface name or PCI address per line. The text after a # is a
+// comment. The PCI addresses are returned in their full lowercase form, e.g.
+// "0000:8e:00.0", so they can be written without the domain.
+func readReservedDevices(path string) (sets.Set[string], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reserved := sets.New[string]()
+	for _, line := range strings.Split(string(data), "\n") {
+		entry, _, _ := strings.Cut(line, "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		reserved.Insert(normalizeReservedEntry(entry))
+	}
+	return reserved, nil
+}
+
+// normalizeReservedEntry returns the PCI addresses in their full lowercase
+// form, and the interface names as they are.
+func normalizeReservedEntry(entry string) string {
+	addr, err := parsePCIAddress(entry)
+	if err != nil {
+		return entry
+	}
+	if addr.domain == "" {
+		addr.domain = "0000"
+	}
+	return strings.ToLower(addr.String())
+}
+
+// refreshReservedDevices reads the file of the reserved devices again, so its
+// changes apply on the next scan. A missing file reserves nothing, the
+// previous reservations are kept if the file can not be read.
+func (db *DB) refreshReservedDevices() {
+	if db.reservedDevicesFile == "" {
+		return
+	}
+	reserved, err := readReservedDevices(db.reservedDevicesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		reserved = sets.New[string]()
+	} else if err != nil {
+		klog.Errorf("Could not read the reserved devices file %s, keeping the previous reservations: %v", db.reservedDevicesFile, err)
+		return
+	}
+	if !reserved.Equal(db.reservedDevices) {
+		klog.V(2).Infof("Reserved devices changed from %v to %v", sets.List(db.reservedDevices), sets.List(reserved))
+	}
+	db.reservedDevices = reserved
+}
+
+// isReservedDevice returns true if the device is reserved for the host, by the
+// alias of its interface or by its interface name or PCI address in the file
+// of the reserved devices.
+func (db *DB) isReservedDevice(device resourceapi.Device) bool {
+	if alias := device.Attributes[apis.AttrAlias].StringValue; alias != nil && strings.HasPrefix(*alias, reservedAliasPrefix) {
+		return true
+	}
+	if ifName := device.Attributes[apis.AttrInterfaceName].StringValue; ifName != nil && db.reservedDevices.Has(*ifName) {
+		return true
+	}
+	if pciAddr := device.Attributes[apis.AttrPCIAddress].StringValue; pciAddr != nil && db.reservedDevices.Has(normalizeReservedEntry(*pciAddr)) {
+		return true
+	}
+	return false
+}
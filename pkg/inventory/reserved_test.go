@@ -0,0 +1,139 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/dranet/pkg/apis"
+)
+
+func TestReadReservedDevices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reserved")
+	content := `# storage NIC
+0000:8E:00.0
+  8f:00.1   # no domain
+
+eth3
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readReservedDevices(path)
+	if err != nil {
+		t.Fatalf("readReservedDevices() failed: %v", err)
+	}
+	want := sets.New("0000:8e:00.0", "0000:8f:00.1", "eth3")
+	if !got.Equal(want) {
+		t.Errorf("readReservedDevices() = %v, want %v", sets.List(got), sets.List(want))
+	}
+}
+
+func TestIsReservedDevice(t *testing.T) {
+	db := New()
+	db.reservedDevices = sets.New("0000:8e:00.0", "eth3")
+
+	tests := []struct {
+		name       string
+		attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+		want       bool
+	}{
+		{
+			name: "not reserved",
+			attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrInterfaceName: {StringValue: ptr.To("eth1")},
+				apis.AttrPCIAddress:    {StringValue: ptr.To("0000:8f:00.0")},
+				apis.AttrAlias:         {StringValue: ptr.To("uplink")},
+			},
+		},
+		{
+			name: "reserved by alias",
+			attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrInterfaceName: {StringValue: ptr.To("eth1")},
+				apis.AttrAlias:         {StringValue: ptr.To("dranet-reserved:storage")},
+			},
+			want: true,
+		},
+		{
+			name: "reserved by interface name",
+			attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrInterfaceName: {StringValue: ptr.To("eth3")},
+			},
+			want: true,
+		},
+		{
+			name: "reserved by PCI address after a rename",
+			attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrInterfaceName: {StringValue: ptr.To("storage0")},
+				apis.AttrPCIAddress:    {StringValue: ptr.To("0000:8e:00.0")},
+			},
+			want: true,
+		},
+		{
+			name: "IB-only device reserved by PCI address",
+			attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				apis.AttrPCIAddress: {StringValue: ptr.To("0000:8E:00.0")},
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.isReservedDevice(resourceapi.Device{Name: "dev", Attributes: tt.attributes}); got != tt.want {
+				t.Errorf("isReservedDevice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshReservedDevices(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reserved")
+	db := New(WithReservedDevicesFile(path))
+
+	// A missing file reserves nothing.
+	db.refreshReservedDevices()
+	if db.reservedDevices.Len() != 0 {
+		t.Errorf("reserved devices = %v, want none for a missing file", sets.List(db.reservedDevices))
+	}
+
+	if err := os.WriteFile(path, []byte("eth3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db.refreshReservedDevices()
+	if want := sets.New("eth3"); !db.reservedDevices.Equal(want) {
+		t.Errorf("reserved devices = %v, want %v", sets.List(db.reservedDevices), sets.List(want))
+	}
+
+	// The previous reservations are kept if the file can not be read.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db.refreshReservedDevices()
+	if want := sets.New("eth3"); !db.reservedDevices.Equal(want) {
+		t.Errorf("reserved devices = %v, want the previous %v", sets.List(db.reservedDevices), sets.List(want))
+	}
+}
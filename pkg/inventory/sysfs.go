@@ -22,10 +22,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/Mellanox/rdmamap"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
@@ -39,12 +42,58 @@ const (
 	// links refers to entries in the /sys/devices directory.
 	// https://man7.org/linux/man-pages/man5/sysfs.5.html
 	sysdevPath = "/sys/devices"
+	// Each RDMA device has a directory with its ports, the link layer of each
+	// port is in ports/<port>/link_layer.
+	// https://www.kernel.org/doc/Documentation/ABI/stable/sysfs-class-infiniband
+	sysInfinibandPath = "/sys/class/infiniband"
+	// The PCI devices directory contains the network interfaces of each device
+	// in <address>/net/<ifname>.
+	sysbusPCIPath = "/sys/bus/pci/devices"
+	// The PCI devices bound to the vfio-pci driver, e.g. for DPDK, are the
+	// entries of the driver directory named by their address.
+	sysbusPCIVFIODriverPath = "/sys/bus/pci/drivers/vfio-pci"
+	// Each IOMMU group has a directory with the links to its PCI devices in
+	// <group>/devices.
+	// https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-kernel-iommu_groups
+	sysKernelIOMMUGroupsPath = "/sys/kernel/iommu_groups"
 )
 
 // pciAddressRegex is used to identify a PCI address within a string.
 // It matches patterns like "0000:00:04.0" or "00:04.0".
 var pciAddressRegex = regexp.MustCompile(`^(?:([0-9a-fA-F]{4}):)?([0-9a-fA-F]{2}):([0-9a-fA-F]{2})\.([0-9a-fA-F])$`)
 
+// cIdentifierRegex matches the C identifiers, the attribute names allowed
+// after the domain of a device attribute.
+var cIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseCustomSysfsAttributes parses a comma separated list of
+// attrName=sysfsRelativePath pairs, e.g. "label=device/label". The paths are
+// relative to the directory of the interface in /sys/class/net and can not
+// leave it.
+func ParseCustomSysfsAttributes(s string) (map[string]string, error) {
+	attributes := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return attributes, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		name, relPath, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid attribute %q, must be in the form attrName=sysfsRelativePath", entry)
+		}
+		if !cIdentifierRegex.MatchString(name) || len(name) > resourceapi.DeviceMaxIDLength {
+			return nil, fmt.Errorf("invalid attribute name %q, must be a C identifier of at most %d characters", name, resourceapi.DeviceMaxIDLength)
+		}
+		if _, ok := attributes[name]; ok {
+			return nil, fmt.Errorf("duplicate attribute %q", name)
+		}
+		if !filepath.IsLocal(relPath) || slices.Contains(strings.Split(relPath, "/"), "..") {
+			return nil, fmt.Errorf("invalid path %q of attribute %q, must be relative to the interface directory without '..'", relPath, name)
+		}
+		attributes[name] = relPath
+	}
+	return attributes, nil
+}
+
 func realpath(ifName string, syspath string) string {
 	linkPath := filepath.Join(syspath, ifName)
 	dst, err := os.Readlink(linkPath)
@@ -61,6 +110,128 @@ func realpath(ifName string, syspath string) string {
 	return dstAbs
 }
 
+// Bus types of the devices backing the network interfaces, the name of the
+// sysfs bus the device is attached to.
+const (
+	busTypePCI      = "pci"
+	busTypeVirtio   = "virtio"
+	busTypePlatform = "platform"
+	busTypeUSB      = "usb"
+)
+
+// kindPCI is the kind of the PCI devices published without a netdev, bound
+// to vfio-pci for userspace drivers.
+const kindPCI = "pci"
+
+// busTypeFromSysfs returns the bus of the device backing the network
+// interface, read from the subsystem link of the device, e.g.
+// $ readlink /sys/class/net/eth0/device/subsystem
+// ../../../../bus/virtio
+// Virtual interfaces have no backing device and return an empty string.
+func busTypeFromSysfs(basePath, ifName string) string {
+	subsystem, err := os.Readlink(filepath.Join(basePath, ifName, "device", "subsystem"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(subsystem)
+}
+
+// isPCIBacked returns false for the devices on busType that are not PCI
+// functions, the PCI devices found in the sysfs path of USB or platform
+// devices are their host controllers. Virtio devices are backed by their
+// virtio-pci parent, if any.
+func isPCIBacked(busType string) bool {
+	return busType != busTypeUSB && busType != busTypePlatform
+}
+
+// bondMasterFromSysfs returns the bond the interface is enslaved to, or an
+// empty string if it has no master or the master is not a bond, e.g. a bridge.
+// $ readlink /sys/class/net/eth1/master
+// ../bond0
+func bondMasterFromSysfs(basePath, ifName string) string {
+	master, err := os.Readlink(filepath.Join(basePath, ifName, "master"))
+	if err != nil {
+		return ""
+	}
+	masterName := filepath.Base(master)
+	if info, err := os.Stat(filepath.Join(basePath, masterName, "bonding")); err != nil || !info.IsDir() {
+		return ""
+	}
+	return masterName
+}
+
+// carrierChangesFromSysfs returns the number of times the carrier of the
+// interface changed, up or down, since the device was created, or false if it
+// can not be read, e.g. the interface was removed.
+// $ cat /sys/class/net/eth1/carrier_changes
+// 4
+func carrierChangesFromSysfs(basePath, ifName string) (int64, bool) {
+	data, err := os.ReadFile(filepath.Join(basePath, ifName, "carrier_changes"))
+	if err != nil {
+		return 0, false
+	}
+	changes, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || changes < 0 {
+		return 0, false
+	}
+	return changes, true
+}
+
+// customAttributeFromSysfs returns the content of the file at relPath in the
+// directory of the interface, without the surrounding whitespace.
+// $ cat /sys/class/net/eth1/device/label
+// Onboard LAN 1
+func customAttributeFromSysfs(basePath, ifName, relPath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(basePath, ifName, relPath))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// linkSpeedFromSysfs returns the link speed of the interface in Mb/s, or false
+// if it is unknown, e.g. the link is down or the driver does not report it.
+// $ cat /sys/class/net/eth1/speed
+// 100000
+func linkSpeedFromSysfs(basePath, ifName string) (int64, bool) {
+	data, err := os.ReadFile(filepath.Join(basePath, ifName, "speed"))
+	if err != nil {
+		return 0, false
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || speed <= 0 {
+		return 0, false
+	}
+	return speed, true
+}
+
+// GetLinkSpeed returns the link speed of the network interface in Mb/s, or
+// false if it is unknown.
+func GetLinkSpeed(ifName string) (int64, bool) {
+	return linkSpeedFromSysfs(sysnetPath, ifName)
+}
+
+// queuesFromSysfs returns the number of receive and transmit queues of the
+// interface, or false if the queues directory can not be read.
+// $ ls /sys/class/net/eth1/queues
+// rx-0  rx-1  tx-0  tx-1
+func queuesFromSysfs(basePath, ifName string) (int64, int64, bool) {
+	entries, err := os.ReadDir(filepath.Join(basePath, ifName, "queues"))
+	if err != nil {
+		return 0, 0, false
+	}
+	var rx, tx int64
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry.Name(), "rx-"):
+			rx++
+		case strings.HasPrefix(entry.Name(), "tx-"):
+			tx++
+		}
+	}
+	return rx, tx, true
+}
+
 // $ realpath /sys/class/net/cilium_host
 // /sys/devices/virtual/net/cilium_host
 func isVirtual(name string, syspath string) bool {
@@ -117,6 +288,39 @@ func IsSriovVf(name string) bool {
 	return isSriovVf(name, sysnetPath)
 }
 
+// sriovVFPCIAddressesFromSysfs returns the PCI addresses of the VFs of the
+// physical function, read from the virtfnN links of the device, e.g.
+// $ readlink /sys/class/net/eth0/device/virtfn0
+// ../0000:3b:02.0
+func sriovVFPCIAddressesFromSysfs(basePath, pfName string) []string {
+	links, err := filepath.Glob(filepath.Join(basePath, pfName, "device", "virtfn*"))
+	if err != nil {
+		return nil
+	}
+	addresses := make([]string, 0, len(links))
+	for _, link := range links {
+		dst, err := os.Readlink(link)
+		if err != nil {
+			klog.V(4).Infof("error reading VF link %s: %v", link, err)
+			continue
+		}
+		addresses = append(addresses, filepath.Base(dst))
+	}
+	return addresses
+}
+
+// sriovFreeVFs returns the number of VFs out of numVFs whose PCI address is not
+// in use by a pod.
+func sriovFreeVFs(numVFs int64, vfAddresses []string, inUse sets.Set[string]) int64 {
+	free := numVFs
+	for _, address := range vfAddresses {
+		if inUse.Has(address) {
+			free--
+		}
+	}
+	return max(free, 0)
+}
+
 // getPFInterfaceNameFromSysfs returns the name of the Physical Function (PF) network
 // interface for a given SR-IOV Virtual Function (VF) interface, using basePath as the
 // root of the sysfs net directory (e.g. /sys/class/net). It returns an error if the
@@ -206,6 +410,100 @@ func isRdmaDeviceInSysfs(ifName string) bool {
 	return true
 }
 
+// rdmaLinkLayersFromSysfs returns the sorted set of link layers of the ports
+// of the RDMA device, reading <basePath>/<rdmaDev>/ports/*/link_layer.
+// Multi-port devices may have ports with different link layers.
+func rdmaLinkLayersFromSysfs(basePath, rdmaDev string) ([]string, error) {
+	portsDir := filepath.Join(basePath, rdmaDev, "ports")
+	entries, err := os.ReadDir(portsDir)
+	if err != nil {
+		return nil, fmt.Errorf("no ports for RDMA device %s: %w", rdmaDev, err)
+	}
+	linkLayers := sets.New[string]()
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(portsDir, entry.Name(), "link_layer"))
+		if err != nil {
+			klog.V(4).Infof("Failed to read link layer of RDMA device %s port %s: %v", rdmaDev, entry.Name(), err)
+			continue
+		}
+		if linkLayer := strings.TrimSpace(string(data)); linkLayer != "" {
+			linkLayers.Insert(linkLayer)
+		}
+	}
+	if linkLayers.Len() == 0 {
+		return nil, fmt.Errorf("no link layer found for RDMA device %s", rdmaDev)
+	}
+	return sets.List(linkLayers), nil
+}
+
+// GetRdmaDevices returns the RDMA devices of a network interface, the device
+// returned by GetRdmaDevice first, or nil if the interface has none. With port
+// aggregation, e.g. a bond of RoCE ports, one interface maps to several RDMA
+// devices. It returns an error if the devices are not consistent.
+func GetRdmaDevices(ifName string) ([]string, error) {
+	rdmaDev, err := GetRdmaDevice(ifName)
+	if err != nil {
+		return nil, nil
+	}
+	return rdmaDevicesForNetdevFromSysfs(sysInfinibandPath, ifName, rdmaDev)
+}
+
+// rdmaDevicesForNetdevFromSysfs returns primary followed by the other RDMA
+// devices in basePath that have ifName in the GID table of one of their ports,
+// <basePath>/<rdmaDev>/ports/<port>/gid_attrs/ndevs/<index>. The aggregated
+// devices must have the same link layers as primary, the interface can not
+// mix InfiniBand and Ethernet ports.
+func rdmaDevicesForNetdevFromSysfs(basePath, ifName, primary string) ([]string, error) {
+	rdmaDevs := []string{primary}
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		klog.V(4).Infof("Failed to list the RDMA devices in %s: %v", basePath, err)
+		return rdmaDevs, nil
+	}
+	for _, entry := range entries {
+		if entry.Name() != primary && rdmaDeviceHasNetdev(basePath, entry.Name(), ifName) {
+			rdmaDevs = append(rdmaDevs, entry.Name())
+		}
+	}
+	if len(rdmaDevs) == 1 {
+		return rdmaDevs, nil
+	}
+
+	linkLayers, err := rdmaLinkLayersFromSysfs(basePath, primary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the RDMA devices %v of interface %s: %w", rdmaDevs, ifName, err)
+	}
+	for _, rdmaDev := range rdmaDevs[1:] {
+		devLinkLayers, err := rdmaLinkLayersFromSysfs(basePath, rdmaDev)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the RDMA devices %v of interface %s: %w", rdmaDevs, ifName, err)
+		}
+		if !slices.Equal(devLinkLayers, linkLayers) {
+			return nil, fmt.Errorf("RDMA devices %s and %s of interface %s have different link layers %v and %v",
+				primary, rdmaDev, ifName, linkLayers, devLinkLayers)
+		}
+	}
+	klog.V(4).Infof("Interface %s aggregates the RDMA devices %v", ifName, rdmaDevs)
+	return rdmaDevs, nil
+}
+
+// rdmaDeviceHasNetdev returns true if a GID of a port of the RDMA device in
+// basePath is associated to the network interface.
+func rdmaDeviceHasNetdev(basePath, rdmaDev, ifName string) bool {
+	ndevs, err := filepath.Glob(filepath.Join(basePath, rdmaDev, "ports", "*", "gid_attrs", "ndevs", "*"))
+	if err != nil {
+		return false
+	}
+	for _, ndev := range ndevs {
+		// reading the entries of the unused GIDs fails
+		data, err := os.ReadFile(ndev)
+		if err == nil && strings.TrimSpace(string(data)) == ifName {
+			return true
+		}
+	}
+	return false
+}
+
 // pciAddress BDF Notation
 // [domain:]bus:device.function
 // https://wiki.xenproject.org/wiki/Bus:Device.Function_(BDF)_Notation
@@ -263,6 +561,84 @@ func parsePCIAddress(s string) (*pciAddress, error) {
 	return address, nil
 }
 
+// numaNodeFromSysfs returns the NUMA node of the PCI device, or false if it
+// can not be read or the platform does not report it (-1).
+func numaNodeFromSysfs(pciPath string, address string) (int64, bool) {
+	data, err := os.ReadFile(filepath.Join(pciPath, address, "numa_node"))
+	if err != nil {
+		return 0, false
+	}
+	node, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || node < 0 {
+		return 0, false
+	}
+	return node, true
+}
+
+// vfioPCIAddressesFromSysfs returns the addresses of the PCI devices bound to
+// the vfio-pci driver, the links of the driver directory named by a PCI
+// address, e.g.
+// $ readlink /sys/bus/pci/drivers/vfio-pci/0000:3b:00.1
+// ../../../../devices/pci0000:3a/0000:3a:00.0/0000:3b:00.1
+func vfioPCIAddressesFromSysfs(driverPath string) sets.Set[string] {
+	addresses := sets.New[string]()
+	entries, err := os.ReadDir(driverPath)
+	if err != nil {
+		// the driver is not loaded
+		return addresses
+	}
+	for _, entry := range entries {
+		if pciAddressRegex.MatchString(entry.Name()) {
+			addresses.Insert(entry.Name())
+		}
+	}
+	return addresses
+}
+
+// iommuGroupFromSysfs returns the IOMMU group of the PCI device, the name of
+// the group its iommu_group link points to, e.g.
+// $ readlink /sys/bus/pci/devices/0000:3b:00.1/iommu_group
+// ../../../../kernel/iommu_groups/42
+func iommuGroupFromSysfs(pciPath string, address string) (string, bool) {
+	dst, err := os.Readlink(filepath.Join(pciPath, address, "iommu_group"))
+	if err != nil {
+		return "", false
+	}
+	return filepath.Base(dst), true
+}
+
+// iommuGroupSizeFromSysfs returns the number of PCI devices of the IOMMU
+// group, the entries of its devices directory.
+func iommuGroupSizeFromSysfs(iommuGroupsPath string, group string) (int, bool) {
+	entries, err := os.ReadDir(filepath.Join(iommuGroupsPath, group, "devices"))
+	if err != nil {
+		return 0, false
+	}
+	return len(entries), true
+}
+
+// pciPortFromSysfs returns the PCI device of the function, its address
+// without the function (e.g. "0000:8e:00"), and the function number. The ports
+// of a multi-port card are the functions of the same PCI device. It returns
+// false for the SR-IOV VFs, their function number is not a port of the card.
+func pciPortFromSysfs(pciPath string, address string) (string, int64, bool) {
+	addr, err := parsePCIAddress(address)
+	if err != nil {
+		return "", 0, false
+	}
+	if info, err := os.Lstat(filepath.Join(pciPath, address, "physfn")); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", 0, false
+	}
+	port, err := strconv.ParseInt(addr.function, 16, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	if addr.domain == "" {
+		return fmt.Sprintf("%s:%s", addr.bus, addr.device), port, true
+	}
+	return fmt.Sprintf("%s:%s:%s", addr.domain, addr.bus, addr.device), port, true
+}
+
 // pciAddressFromPath takes a full sysfs path and traverses it upwards to find
 // the first component that contains a valid PCI address.
 func pciAddressFromPath(path string) (*pciAddress, error) {
@@ -293,3 +669,43 @@ func pciAddressForNetInterface(ifName string) (*pciAddress, error) {
 	}
 	return address, nil
 }
+
+// pciAddressForRdmaDevice finds the PCI address of the HCA of an RDMA device
+// from its sysfs path, which typically looks like:
+// /sys/devices/pci0000:8c/0000:8c:00.0/0000:8e:00.0/infiniband/mlx5_0
+func pciAddressForRdmaDevice(basePath, rdmaDevName string) (*pciAddress, error) {
+	address, err := pciAddressFromPath(realpath(rdmaDevName, basePath))
+	if err != nil {
+		return nil, fmt.Errorf("could not find PCI address for RDMA device %q: %w", rdmaDevName, err)
+	}
+	return address, nil
+}
+
+// GetPCIAddress returns the PCI address of the network interface, it can be
+// used to find the interface again if it is renamed, e.g. after a VF rebind.
+func GetPCIAddress(ifName string) (string, error) {
+	address, err := pciAddressForNetInterface(ifName)
+	if err != nil {
+		return "", err
+	}
+	return address.String(), nil
+}
+
+// GetNetInterfaceNameForPCI returns the name of the network interface of the
+// PCI device.
+func GetNetInterfaceNameForPCI(pciAddress string) (string, error) {
+	return getNetInterfaceNameForPCIFromSysfs(sysbusPCIPath, pciAddress)
+}
+
+// getNetInterfaceNameForPCIFromSysfs returns the first entry of the
+// <basePath>/<pciAddress>/net directory.
+func getNetInterfaceNameForPCIFromSysfs(basePath, pciAddress string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(basePath, pciAddress, "net"))
+	if err != nil {
+		return "", fmt.Errorf("no network interface for PCI device %s: %w", pciAddress, err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no network interface found for PCI device %s", pciAddress)
+	}
+	return entries[0].Name(), nil
+}
@@ -17,12 +17,14 @@ limitations under the License.
 package inventory
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 func TestParsePCIAddress(t *testing.T) {
@@ -114,6 +116,11 @@ func TestPCIAddressFromPath(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:    "platform device",
+			input:   "/sys/devices/platform/soc/fe300000.ethernet/net/eth0",
+			wantErr: true,
+		},
 		{
 			name:    "no pci address in path",
 			input:   "/sys/devices/virtual/net/lo",
@@ -190,6 +197,290 @@ func TestIsSriovVf(t *testing.T) {
 	})
 }
 
+func TestBusTypeFromSysfs(t *testing.T) {
+	basePath := t.TempDir()
+	// createInterface mimics /sys/class/net/<ifName>/device/subsystem pointing
+	// to the bus of the device, an empty bus creates a virtual interface.
+	createInterface := func(t *testing.T, ifName, bus string) {
+		t.Helper()
+		if bus == "" {
+			if err := os.MkdirAll(filepath.Join(basePath, ifName), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		deviceDir := filepath.Join(basePath, ifName, "device")
+		if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join("..", "..", "..", "..", "bus", bus), filepath.Join(deviceDir, "subsystem")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		bus           string
+		want          string
+		wantPCIBacked bool
+	}{
+		{name: "pci", bus: "pci", want: busTypePCI, wantPCIBacked: true},
+		{name: "virtio", bus: "virtio", want: busTypeVirtio, wantPCIBacked: true},
+		{name: "platform", bus: "platform", want: busTypePlatform, wantPCIBacked: false},
+		{name: "usb", bus: "usb", want: busTypeUSB, wantPCIBacked: false},
+		{name: "virtual", bus: "", want: "", wantPCIBacked: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			createInterface(t, tc.name, tc.bus)
+			got := busTypeFromSysfs(basePath, tc.name)
+			if got != tc.want {
+				t.Errorf("busTypeFromSysfs() = %q, want %q", got, tc.want)
+			}
+			if pciBacked := isPCIBacked(got); pciBacked != tc.wantPCIBacked {
+				t.Errorf("isPCIBacked(%q) = %t, want %t", got, pciBacked, tc.wantPCIBacked)
+			}
+		})
+	}
+}
+
+func TestBondMasterFromSysfs(t *testing.T) {
+	basePath := t.TempDir()
+	for _, dir := range []string{"bond0/bonding", "br0/bridge", "eth0", "eth1", "eth2"} {
+		if err := os.MkdirAll(filepath.Join(basePath, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ifName, master := range map[string]string{"eth0": "bond0", "eth1": "br0"} {
+		if err := os.Symlink(filepath.Join("..", master), filepath.Join(basePath, ifName, "master")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		ifName string
+		want   string
+	}{
+		{ifName: "eth0", want: "bond0"},
+		// bridge ports are not bond slaves
+		{ifName: "eth1", want: ""},
+		// no master
+		{ifName: "eth2", want: ""},
+		{ifName: "bond0", want: ""},
+		{ifName: "missing", want: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ifName, func(t *testing.T) {
+			if got := bondMasterFromSysfs(basePath, tc.ifName); got != tc.want {
+				t.Errorf("bondMasterFromSysfs(%q) = %q, want %q", tc.ifName, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLinkSpeedFromSysfs(t *testing.T) {
+	basePath := t.TempDir()
+	for ifName, speed := range map[string]string{"eth0": "100000\n", "eth1": "-1\n", "eth2": "unknown\n"} {
+		if err := os.MkdirAll(filepath.Join(basePath, ifName), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(basePath, ifName, "speed"), []byte(speed), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		ifName string
+		want   int64
+		wantOk bool
+	}{
+		{ifName: "eth0", want: 100000, wantOk: true},
+		// link down
+		{ifName: "eth1"},
+		{ifName: "eth2"},
+		{ifName: "missing"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ifName, func(t *testing.T) {
+			got, ok := linkSpeedFromSysfs(basePath, tc.ifName)
+			if got != tc.want || ok != tc.wantOk {
+				t.Errorf("linkSpeedFromSysfs(%q) = %d, %v, want %d, %v", tc.ifName, got, ok, tc.want, tc.wantOk)
+			}
+		})
+	}
+}
+
+func TestSriovVFPCIAddressesFromSysfs(t *testing.T) {
+	basePath := t.TempDir()
+	deviceDir := filepath.Join(basePath, "eth0", "device")
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i, vf := range []string{"0000:3b:02.0", "0000:3b:02.1"} {
+		if err := os.Symlink(filepath.Join("..", vf), filepath.Join(deviceDir, fmt.Sprintf("virtfn%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := sriovVFPCIAddressesFromSysfs(basePath, "eth0")
+	if diff := cmp.Diff([]string{"0000:3b:02.0", "0000:3b:02.1"}, got); diff != "" {
+		t.Errorf("sriovVFPCIAddressesFromSysfs() mismatch (-want +got):\n%s", diff)
+	}
+	if got := sriovVFPCIAddressesFromSysfs(basePath, "eth1"); len(got) != 0 {
+		t.Errorf("sriovVFPCIAddressesFromSysfs() for an interface without VFs = %v, want none", got)
+	}
+}
+
+func TestParseCustomSysfsAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: map[string]string{}},
+		{
+			name:  "several attributes",
+			input: "label=device/label, firmware=device/firmware_version",
+			want:  map[string]string{"label": "device/label", "firmware": "device/firmware_version"},
+		},
+		{name: "missing path", input: "label", wantErr: true},
+		{name: "missing name", input: "=device/label", wantErr: true},
+		{name: "name not a C identifier", input: "device-label=device/label", wantErr: true},
+		{name: "name too long", input: strings.Repeat("a", 33) + "=device/label", wantErr: true},
+		{name: "duplicate name", input: "label=device/label,label=ifalias", wantErr: true},
+		{name: "empty path", input: "label=", wantErr: true},
+		{name: "absolute path", input: "label=/etc/hostname", wantErr: true},
+		{name: "parent directory", input: "label=../eth1/ifalias", wantErr: true},
+		{name: "parent directory inside the path", input: "label=device/../ifalias", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCustomSysfsAttributes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCustomSysfsAttributes(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseCustomSysfsAttributes(%q) mismatch (-want +got):\n%s", tt.input, diff)
+			}
+		})
+	}
+}
+
+func TestVFIOPCIAddressesFromSysfs(t *testing.T) {
+	driverPath := t.TempDir()
+	for _, address := range []string{"0000:3b:00.1", "0000:3b:02.0"} {
+		if err := os.Symlink(filepath.Join("..", "..", "..", "..", "devices", "pci0000:3a", address), filepath.Join(driverPath, address)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The driver directory has attribute files and the module link too.
+	for _, name := range []string{"bind", "unbind", "new_id", "module"} {
+		if err := os.WriteFile(filepath.Join(driverPath, name), nil, 0o200); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := vfioPCIAddressesFromSysfs(driverPath)
+	if diff := cmp.Diff([]string{"0000:3b:00.1", "0000:3b:02.0"}, sets.List(got)); diff != "" {
+		t.Errorf("vfioPCIAddressesFromSysfs() mismatch (-want +got):\n%s", diff)
+	}
+	// vfio-pci not loaded
+	if got := vfioPCIAddressesFromSysfs(filepath.Join(driverPath, "missing")); got.Len() != 0 {
+		t.Errorf("vfioPCIAddressesFromSysfs() without the driver = %v, want none", sets.List(got))
+	}
+}
+
+func TestIOMMUGroupFromSysfs(t *testing.T) {
+	pciPath := t.TempDir()
+	for _, address := range []string{"0000:3b:00.1", "0000:3b:00.2"} {
+		if err := os.MkdirAll(filepath.Join(pciPath, address), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join("..", "..", "..", "kernel", "iommu_groups", "42"), filepath.Join(pciPath, "0000:3b:00.1", "iommu_group")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := iommuGroupFromSysfs(pciPath, "0000:3b:00.1"); !ok || got != "42" {
+		t.Errorf("iommuGroupFromSysfs() = %q, %v, want 42", got, ok)
+	}
+	// IOMMU disabled
+	if got, ok := iommuGroupFromSysfs(pciPath, "0000:3b:00.2"); ok {
+		t.Errorf("iommuGroupFromSysfs() = %q, want no IOMMU group", got)
+	}
+}
+
+func TestIOMMUGroupSizeFromSysfs(t *testing.T) {
+	iommuGroupsPath := t.TempDir()
+	for _, address := range []string{"0000:3b:00.0", "0000:3b:00.1"} {
+		if err := os.MkdirAll(filepath.Join(iommuGroupsPath, "42", "devices", address), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, ok := iommuGroupSizeFromSysfs(iommuGroupsPath, "42"); !ok || got != 2 {
+		t.Errorf("iommuGroupSizeFromSysfs() = %d, %v, want 2", got, ok)
+	}
+	if got, ok := iommuGroupSizeFromSysfs(iommuGroupsPath, "43"); ok {
+		t.Errorf("iommuGroupSizeFromSysfs() = %d, want no IOMMU group", got)
+	}
+}
+
+func TestSriovFreeVFs(t *testing.T) {
+	vfs := []string{"0000:3b:02.0", "0000:3b:02.1", "0000:3b:02.2", "0000:3b:02.3"}
+	testCases := []struct {
+		name        string
+		numVFs      int64
+		vfAddresses []string
+		inUse       sets.Set[string]
+		want        int64
+	}{
+		{
+			name:        "no VFs in use",
+			numVFs:      4,
+			vfAddresses: vfs,
+			inUse:       sets.New[string](),
+			want:        4,
+		},
+		{
+			name:        "some VFs in use",
+			numVFs:      4,
+			vfAddresses: vfs,
+			inUse:       sets.New("0000:3b:02.1", "0000:3b:02.3"),
+			want:        2,
+		},
+		{
+			name:        "devices of other PFs in use",
+			numVFs:      4,
+			vfAddresses: vfs,
+			inUse:       sets.New("0000:3b:02.1", "0000:5e:00.0", "0000:5e:02.0"),
+			want:        3,
+		},
+		{
+			name:        "all VFs in use",
+			numVFs:      4,
+			vfAddresses: vfs,
+			inUse:       sets.New(vfs...),
+			want:        0,
+		},
+		{
+			name:        "VF links not readable",
+			numVFs:      4,
+			vfAddresses: nil,
+			inUse:       sets.New("0000:3b:02.1"),
+			want:        4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sriovFreeVFs(tc.numVFs, tc.vfAddresses, tc.inUse); got != tc.want {
+				t.Errorf("sriovFreeVFs() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestGetPFInterfaceNameFromSysfs(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -416,3 +707,192 @@ func TestGetRdmaDeviceFromSysfs(t *testing.T) {
 		})
 	}
 }
+
+func TestRdmaLinkLayersFromSysfs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rdmaDev string
+		ports   map[string]string // port -> link_layer contents
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "infiniband HCA",
+			rdmaDev: "mlx5_0",
+			ports:   map[string]string{"1": "InfiniBand\n"},
+			want:    []string{"InfiniBand"},
+		},
+		{
+			name:    "RoCE NIC",
+			rdmaDev: "mlx5_1",
+			ports:   map[string]string{"1": "Ethernet\n"},
+			want:    []string{"Ethernet"},
+		},
+		{
+			name:    "multi-port with mixed link layers",
+			rdmaDev: "mlx4_0",
+			ports:   map[string]string{"1": "InfiniBand\n", "2": "Ethernet\n", "3": "Ethernet\n"},
+			want:    []string{"Ethernet", "InfiniBand"},
+		},
+		{
+			name:    "port without link layer",
+			rdmaDev: "mlx5_2",
+			ports:   map[string]string{"1": ""},
+			wantErr: true,
+		},
+		{
+			name:    "device without ports",
+			rdmaDev: "mlx5_3",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Mock /sys/class/infiniband/<dev>/ports/<port>/link_layer
+			tmpDir := t.TempDir()
+			for port, linkLayer := range tc.ports {
+				portDir := filepath.Join(tmpDir, tc.rdmaDev, "ports", port)
+				if err := os.MkdirAll(portDir, 0755); err != nil {
+					t.Fatalf("failed to create mock sysfs dir: %v", err)
+				}
+				if linkLayer == "" {
+					continue
+				}
+				if err := os.WriteFile(filepath.Join(portDir, "link_layer"), []byte(linkLayer), 0644); err != nil {
+					t.Fatalf("failed to create mock link_layer file: %v", err)
+				}
+			}
+
+			got, err := rdmaLinkLayersFromSysfs(tmpDir, tc.rdmaDev)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("rdmaLinkLayersFromSysfs() expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rdmaLinkLayersFromSysfs() unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("rdmaLinkLayersFromSysfs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRdmaDevicesForNetdevFromSysfs(t *testing.T) {
+	type rdmaPort struct {
+		linkLayer string
+		ndevs     []string // netdev of the GID entries
+	}
+	testCases := []struct {
+		name    string
+		ifName  string
+		devices map[string]map[string]rdmaPort // rdma device -> port number -> port
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "single RDMA device",
+			ifName: "eth1",
+			devices: map[string]map[string]rdmaPort{
+				"mlx5_0": {"1": {linkLayer: "Ethernet", ndevs: []string{"eth1", "eth1"}}},
+				"mlx5_1": {"1": {linkLayer: "Ethernet", ndevs: []string{"eth2"}}},
+			},
+			want: []string{"mlx5_0"},
+		},
+		{
+			name:   "aggregated RDMA devices",
+			ifName: "bond0",
+			devices: map[string]map[string]rdmaPort{
+				"mlx5_0": {"1": {linkLayer: "Ethernet", ndevs: []string{"bond0"}}},
+				"mlx5_1": {"1": {linkLayer: "Ethernet", ndevs: []string{"eth3", "bond0"}}},
+				"mlx5_2": {"1": {linkLayer: "Ethernet", ndevs: []string{"eth4"}}},
+				"mlx5_3": {"1": {linkLayer: "Ethernet"}, "2": {linkLayer: "Ethernet", ndevs: []string{"bond0"}}},
+			},
+			want: []string{"mlx5_0", "mlx5_1", "mlx5_3"},
+		},
+		{
+			name:   "aggregated RDMA devices with different link layers",
+			ifName: "bond0",
+			devices: map[string]map[string]rdmaPort{
+				"mlx5_0": {"1": {linkLayer: "Ethernet", ndevs: []string{"bond0"}}},
+				"mlx5_1": {"1": {linkLayer: "InfiniBand", ndevs: []string{"bond0"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name:   "aggregated RDMA device without link layer",
+			ifName: "bond0",
+			devices: map[string]map[string]rdmaPort{
+				"mlx5_0": {"1": {linkLayer: "Ethernet", ndevs: []string{"bond0"}}},
+				"mlx5_1": {"1": {ndevs: []string{"bond0"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Mock /sys/class/infiniband/<dev>/ports/<port>/{link_layer,gid_attrs/ndevs/<index>}
+			tmpDir := t.TempDir()
+			for rdmaDev, ports := range tc.devices {
+				for port, cfg := range ports {
+					ndevsDir := filepath.Join(tmpDir, rdmaDev, "ports", port, "gid_attrs", "ndevs")
+					if err := os.MkdirAll(ndevsDir, 0755); err != nil {
+						t.Fatalf("failed to create mock sysfs dir: %v", err)
+					}
+					if cfg.linkLayer != "" {
+						if err := os.WriteFile(filepath.Join(tmpDir, rdmaDev, "ports", port, "link_layer"), []byte(cfg.linkLayer+"\n"), 0644); err != nil {
+							t.Fatalf("failed to create mock link_layer file: %v", err)
+						}
+					}
+					for i, ndev := range cfg.ndevs {
+						if err := os.WriteFile(filepath.Join(ndevsDir, fmt.Sprint(i)), []byte(ndev+"\n"), 0644); err != nil {
+							t.Fatalf("failed to create mock ndevs file: %v", err)
+						}
+					}
+				}
+			}
+
+			got, err := rdmaDevicesForNetdevFromSysfs(tmpDir, tc.ifName, "mlx5_0")
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("rdmaDevicesForNetdevFromSysfs() expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rdmaDevicesForNetdevFromSysfs() unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("rdmaDevicesForNetdevFromSysfs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetNetInterfaceNameForPCIFromSysfs(t *testing.T) {
+	baseDir := t.TempDir()
+	// Mock /sys/bus/pci/devices/<address>/net/<ifname>
+	if err := os.MkdirAll(filepath.Join(baseDir, "0000:8e:02.1", "net", "eth5"), 0755); err != nil {
+		t.Fatalf("failed to create mock sysfs dir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(baseDir, "0000:8e:02.2", "net"), 0755); err != nil {
+		t.Fatalf("failed to create mock sysfs dir: %v", err)
+	}
+
+	got, err := getNetInterfaceNameForPCIFromSysfs(baseDir, "0000:8e:02.1")
+	if err != nil || got != "eth5" {
+		t.Errorf("getNetInterfaceNameForPCIFromSysfs() = %q, %v, want eth5", got, err)
+	}
+	// device without network interface, e.g. unbound from the network driver
+	if got, err := getNetInterfaceNameForPCIFromSysfs(baseDir, "0000:8e:02.2"); err == nil {
+		t.Errorf("getNetInterfaceNameForPCIFromSysfs() = %q, expected error", got)
+	}
+	// device removed
+	if got, err := getNetInterfaceNameForPCIFromSysfs(baseDir, "0000:8e:02.3"); err == nil {
+		t.Errorf("getNetInterfaceNameForPCIFromSysfs() = %q, expected error", got)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipam allocates the addresses of the network interfaces from CIDR
+// pools configured per node.
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Owner identifies the device of a claim an address is allocated to.
+type Owner struct {
+	Claim  types.NamespacedName
+	Device string
+}
+
+type pool struct {
+	prefix    netip.Prefix
+	allocated map[netip.Addr]Owner
+	owners    map[Owner]netip.Addr
+	// next is the lowest address never handed out, the addresses below it
+	// are allocated, reserved or free. It is invalid once the whole prefix
+	// was handed out.
+	next netip.Addr
+	// free are the released addresses below next, in ascending order.
+	free []netip.Addr
+}
+
+// Allocator tracks the addresses allocated from each pool. Allocations are
+// kept in memory only, after a restart they have to be reconciled with
+// Reserve from the existing claims.
+type Allocator struct {
+	mu    sync.Mutex
+	pools map[string]*pool
+}
+
+// NewAllocator returns an Allocator for the given pools, keyed by name.
+func NewAllocator(pools map[string]netip.Prefix) *Allocator {
+	a := &Allocator{pools: map[string]*pool{}}
+	for name, prefix := range pools {
+		a.pools[name] = &pool{
+			prefix:    prefix.Masked(),
+			allocated: map[netip.Addr]Owner{},
+			owners:    map[Owner]netip.Addr{},
+			next:      prefix.Masked().Addr(),
+		}
+	}
+	return a
+}
+
+// ParsePools parses a comma separated list of name=CIDR pools,
+// e.g. "storage=10.10.0.0/24,rdma=fd00:10::/64".
+func ParsePools(s string) (map[string]netip.Prefix, error) {
+	pools := map[string]netip.Prefix{}
+	if strings.TrimSpace(s) == "" {
+		return pools, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		name, cidr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid pool %q, must be in the form name=CIDR", entry)
+		}
+		if _, ok := pools[name]; ok {
+			return nil, fmt.Errorf("duplicate pool %q", name)
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR for pool %q: %w", name, err)
+		}
+		pools[name] = prefix
+	}
+	return pools, nil
+}
+
+// Pools returns the names of the configured pools.
+func (a *Allocator) Pools() []string {
+	names := make([]string, 0, len(a.pools))
+	for name := range a.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Allocate returns the lowest free address of the pool for the owner, with
+// the prefix length of the pool. Allocating again for the same owner returns
+// the same address. The allocated addresses are not scanned, so it takes the
+// same time in a large IPv6 pool and an exhausted pool fails right away.
+func (a *Allocator) Allocate(poolName string, owner Owner) (netip.Prefix, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.pools[poolName]
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("unknown IPAM pool %q", poolName)
+	}
+	if addr, ok := p.owners[owner]; ok {
+		return netip.PrefixFrom(addr, p.prefix.Bits()), nil
+	}
+	addr, ok := p.nextFree()
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("IPAM pool %q (%s) is exhausted", poolName, p.prefix)
+	}
+	p.allocated[addr] = owner
+	p.owners[owner] = addr
+	return netip.PrefixFrom(addr, p.prefix.Bits()), nil
+}
+
+// Reserve records an address already in use by the owner, e.g. one found
+// in the status of the claim after a restart.
+func (a *Allocator) Reserve(poolName string, owner Owner, addr netip.Addr) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.pools[poolName]
+	if !ok {
+		return fmt.Errorf("unknown IPAM pool %q", poolName)
+	}
+	addr = addr.Unmap()
+	if !p.prefix.Contains(addr) || p.isReserved(addr) {
+		return fmt.Errorf("address %s is not assignable from IPAM pool %q (%s)", addr, poolName, p.prefix)
+	}
+	if current, ok := p.allocated[addr]; ok && current != owner {
+		return fmt.Errorf("address %s of IPAM pool %q is already allocated to claim %s device %s", addr, poolName, current.Claim, current.Device)
+	}
+	if current, ok := p.owners[owner]; ok && current != addr {
+		return fmt.Errorf("claim %s device %s already has the address %s of IPAM pool %q", owner.Claim, owner.Device, current, poolName)
+	}
+	if i, ok := slices.BinarySearchFunc(p.free, addr, netip.Addr.Compare); ok {
+		p.free = slices.Delete(p.free, i, i+1)
+	}
+	p.allocated[addr] = owner
+	p.owners[owner] = addr
+	return nil
+}
+
+// Release frees all the addresses allocated to the devices of the claim.
+func (a *Allocator) Release(claim types.NamespacedName) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range a.pools {
+		for owner, addr := range p.owners {
+			if owner.Claim == claim {
+				delete(p.owners, owner)
+				delete(p.allocated, addr)
+				p.release(addr)
+			}
+		}
+	}
+}
+
+// nextFree takes the lowest free address of the pool, the released ones
+// first and then the next address never handed out. Only the addresses
+// reserved above next are skipped.
+func (p *pool) nextFree() (netip.Addr, bool) {
+	if len(p.free) > 0 {
+		addr := p.free[0]
+		p.free = p.free[1:]
+		return addr, true
+	}
+	for p.next.IsValid() && p.prefix.Contains(p.next) {
+		addr := p.next
+		p.next = addr.Next()
+		if p.isReserved(addr) {
+			continue
+		}
+		if _, ok := p.allocated[addr]; ok {
+			continue
+		}
+		return addr, true
+	}
+	return netip.Addr{}, false
+}
+
+// release makes a freed address available to nextFree, the addresses from
+// next on are found without being recorded.
+func (p *pool) release(addr netip.Addr) {
+	if p.next.IsValid() && p.prefix.Contains(p.next) && !addr.Less(p.next) {
+		return
+	}
+	if i, ok := slices.BinarySearchFunc(p.free, addr, netip.Addr.Compare); !ok {
+		p.free = slices.Insert(p.free, i, addr)
+	}
+}
+
+// isReserved returns true for the addresses that can not be assigned to an
+// interface: the network address and, for IPv4, the broadcast address. Point
+// to point prefixes (/31, /127) and host prefixes have no reserved addresses.
+func (p *pool) isReserved(addr netip.Addr) bool {
+	if p.prefix.Addr().BitLen()-p.prefix.Bits() < 2 {
+		return false
+	}
+	if addr == p.prefix.Addr() {
+		return true
+	}
+	return addr.Is4() && addr == lastAddr(p.prefix)
+}
+
+// lastAddr returns the last address of the prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := range b {
+		hostBits := min(max(prefix.Addr().BitLen()-prefix.Bits()-(len(b)-1-i)*8, 0), 8)
+		b[i] |= byte(1<<hostBits - 1)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
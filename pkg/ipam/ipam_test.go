@@ -0,0 +1,268 @@
+/*
+Copyright The Kubernetes Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func owner(claim, device string) Owner {
+	return Owner{Claim: types.NamespacedName{Namespace: "default", Name: claim}, Device: device}
+}
+
+func TestParsePools(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      map[string]netip.Prefix
+		expectErr bool
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  map[string]netip.Prefix{},
+		},
+		{
+			name:  "ipv4 and ipv6 pools",
+			input: "storage=10.10.0.0/24, rdma=fd00:10::/64",
+			want: map[string]netip.Prefix{
+				"storage": netip.MustParsePrefix("10.10.0.0/24"),
+				"rdma":    netip.MustParsePrefix("fd00:10::/64"),
+			},
+		},
+		{
+			name:      "missing name",
+			input:     "=10.10.0.0/24",
+			expectErr: true,
+		},
+		{
+			name:      "missing cidr",
+			input:     "storage",
+			expectErr: true,
+		},
+		{
+			name:      "invalid cidr",
+			input:     "storage=10.10.0.0/33",
+			expectErr: true,
+		},
+		{
+			name:      "duplicate pool",
+			input:     "storage=10.10.0.0/24,storage=10.20.0.0/24",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePools(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParsePools(%q) error = %v, expectErr %v", tt.input, err, tt.expectErr)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.Comparer(func(a, b netip.Prefix) bool { return a == b })); diff != "" {
+				t.Errorf("ParsePools(%q) mismatch (-want +got):\n%s", tt.input, diff)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		owners []Owner
+		want   []string
+		// exhausted is true if the allocation after the last owner must fail.
+		exhausted bool
+	}{
+		{
+			name:      "ipv4 skips network and broadcast addresses",
+			prefix:    "192.168.1.0/30",
+			owners:    []Owner{owner("a", "eth1"), owner("b", "eth1")},
+			want:      []string{"192.168.1.1/30", "192.168.1.2/30"},
+			exhausted: true,
+		},
+		{
+			name:      "ipv4 point to point",
+			prefix:    "192.168.1.0/31",
+			owners:    []Owner{owner("a", "eth1"), owner("b", "eth1")},
+			want:      []string{"192.168.1.0/31", "192.168.1.1/31"},
+			exhausted: true,
+		},
+		{
+			name:   "ipv4 pool not aligned to the prefix",
+			prefix: "10.0.0.77/29",
+			owners: []Owner{owner("a", "eth1")},
+			want:   []string{"10.0.0.73/29"},
+		},
+		{
+			name:      "ipv6 skips the subnet router anycast address",
+			prefix:    "fd00::/126",
+			owners:    []Owner{owner("a", "eth1"), owner("a", "eth2"), owner("b", "eth1")},
+			want:      []string{"fd00::1/126", "fd00::2/126", "fd00::3/126"},
+			exhausted: true,
+		},
+		{
+			name:   "same owner gets the same address",
+			prefix: "10.0.0.0/24",
+			owners: []Owner{owner("a", "eth1"), owner("a", "eth1")},
+			want:   []string{"10.0.0.1/24", "10.0.0.1/24"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAllocator(map[string]netip.Prefix{"pool": netip.MustParsePrefix(tt.prefix)})
+			for i, o := range tt.owners {
+				got, err := a.Allocate("pool", o)
+				if err != nil {
+					t.Fatalf("Allocate(%v) failed: %v", o, err)
+				}
+				if got.String() != tt.want[i] {
+					t.Errorf("Allocate(%v) = %s, want %s", o, got, tt.want[i])
+				}
+			}
+			_, err := a.Allocate("pool", owner("other", "eth1"))
+			if (err != nil) != tt.exhausted {
+				t.Errorf("Allocate() after the last owner error = %v, exhausted %v", err, tt.exhausted)
+			}
+		})
+	}
+}
+
+func TestAllocateLargePool(t *testing.T) {
+	// A /112 has 65535 assignable addresses, each allocation must not scan
+	// the ones already allocated for the pool to be exhausted quickly.
+	a := NewAllocator(map[string]netip.Prefix{"pool": netip.MustParsePrefix("fd00::/112")})
+	// An address reserved ahead of the allocations is skipped.
+	if err := a.Reserve("pool", owner("reserved", "eth1"), netip.MustParseAddr("fd00::10")); err != nil {
+		t.Fatalf("Reserve() failed: %v", err)
+	}
+	for i := range 65534 {
+		if _, err := a.Allocate("pool", owner(fmt.Sprintf("claim%d", i), "eth1")); err != nil {
+			t.Fatalf("Allocate() %d failed: %v", i, err)
+		}
+	}
+	if _, err := a.Allocate("pool", owner("other", "eth1")); err == nil {
+		t.Fatalf("Allocate() from an exhausted pool expected to fail")
+	}
+
+	// The released addresses are allocated again, the lowest first.
+	a.Release(owner("claim100", "").Claim)
+	a.Release(owner("reserved", "").Claim)
+	for i, want := range []string{"fd00::10/112", "fd00::66/112"} {
+		got, err := a.Allocate("pool", owner(fmt.Sprintf("new%d", i), "eth1"))
+		if err != nil {
+			t.Fatalf("Allocate() after Release failed: %v", err)
+		}
+		if got.String() != want {
+			t.Errorf("Allocate() after Release = %s, want %s", got, want)
+		}
+	}
+	if _, err := a.Allocate("pool", owner("another", "eth1")); err == nil {
+		t.Errorf("Allocate() from an exhausted pool expected to fail")
+	}
+}
+
+func TestAllocateUnknownPool(t *testing.T) {
+	a := NewAllocator(map[string]netip.Prefix{"pool": netip.MustParsePrefix("10.0.0.0/24")})
+	if _, err := a.Allocate("missing", owner("a", "eth1")); err == nil {
+		t.Errorf("Allocate() from an unknown pool expected to fail")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	a := NewAllocator(map[string]netip.Prefix{
+		"v4": netip.MustParsePrefix("10.0.0.0/30"),
+		"v6": netip.MustParsePrefix("fd00::/64"),
+	})
+	for _, o := range []Owner{owner("a", "eth1"), owner("b", "eth1")} {
+		if _, err := a.Allocate("v4", o); err != nil {
+			t.Fatalf("Allocate(%v) failed: %v", o, err)
+		}
+	}
+	if _, err := a.Allocate("v6", owner("a", "eth2")); err != nil {
+		t.Fatalf("Allocate() failed: %v", err)
+	}
+
+	a.Release(owner("a", "").Claim)
+
+	// the address of claim a is free again in both pools
+	got, err := a.Allocate("v4", owner("c", "eth1"))
+	if err != nil {
+		t.Fatalf("Allocate() after Release failed: %v", err)
+	}
+	if got.String() != "10.0.0.1/30" {
+		t.Errorf("Allocate() after Release = %s, want 10.0.0.1/30", got)
+	}
+	got, err = a.Allocate("v6", owner("c", "eth2"))
+	if err != nil {
+		t.Fatalf("Allocate() after Release failed: %v", err)
+	}
+	if got.String() != "fd00::1/64" {
+		t.Errorf("Allocate() after Release = %s, want fd00::1/64", got)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	a := NewAllocator(map[string]netip.Prefix{"pool": netip.MustParsePrefix("10.0.0.0/24")})
+
+	// Reconcile the address of an existing claim, e.g. after a restart.
+	if err := a.Reserve("pool", owner("a", "eth1"), netip.MustParseAddr("10.0.0.1")); err != nil {
+		t.Fatalf("Reserve() failed: %v", err)
+	}
+	// Reserving it again for the same owner is a no-op.
+	if err := a.Reserve("pool", owner("a", "eth1"), netip.MustParseAddr("10.0.0.1")); err != nil {
+		t.Fatalf("Reserve() for the same owner failed: %v", err)
+	}
+	// New allocations do not get the reserved address.
+	got, err := a.Allocate("pool", owner("b", "eth1"))
+	if err != nil {
+		t.Fatalf("Allocate() failed: %v", err)
+	}
+	if got.String() != "10.0.0.2/24" {
+		t.Errorf("Allocate() = %s, want 10.0.0.2/24", got)
+	}
+	// The owner of a reserved address gets it back.
+	got, err = a.Allocate("pool", owner("a", "eth1"))
+	if err != nil {
+		t.Fatalf("Allocate() failed: %v", err)
+	}
+	if got.String() != "10.0.0.1/24" {
+		t.Errorf("Allocate() = %s, want 10.0.0.1/24", got)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		owner Owner
+		addr  string
+	}{
+		{name: "allocated to another owner", owner: owner("c", "eth1"), addr: "10.0.0.2"},
+		{name: "owner has another address", owner: owner("a", "eth1"), addr: "10.0.0.10"},
+		{name: "outside of the pool", owner: owner("c", "eth1"), addr: "10.0.1.1"},
+		{name: "network address", owner: owner("c", "eth1"), addr: "10.0.0.0"},
+		{name: "broadcast address", owner: owner("c", "eth1"), addr: "10.0.0.255"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := a.Reserve("pool", tc.owner, netip.MustParseAddr(tc.addr)); err == nil {
+				t.Errorf("Reserve(%v, %s) expected to fail", tc.owner, tc.addr)
+			}
+		})
+	}
+}
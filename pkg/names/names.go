@@ -18,6 +18,7 @@ package names
 
 import (
 	"encoding/base32"
+	"fmt"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/validation"
@@ -30,17 +31,48 @@ const (
 	NormalizedInterfacePrefix = "net"
 	// NormalizedPCIPrefix is the prefix used when normalizing a PCI Address.
 	NormalizedPCIPrefix = "pci"
+
+	// maxInterfaceNameLength is the maximum length of a Linux interface name
+	// (IFNAMSIZ without the terminating null byte).
+	maxInterfaceNameLength = 15
 )
 
+var interfaceNameEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// maxNormalizedInterfacePrefixLength is the maximum length of the prefix of the
+// normalized interface names, so the prefix, the separator and the base32
+// encoding of the longest interface name fit in a DNS-1123 label (63).
+var maxNormalizedInterfacePrefixLength = validation.DNS1123LabelMaxLength - 1 - interfaceNameEncoding.EncodedLen(maxInterfaceNameLength)
+
+// ValidateNormalizedInterfacePrefix checks that prefix can be used to
+// normalize the interface names: the normalized names must be valid DNS-1123
+// labels for any interface name.
+func ValidateNormalizedInterfacePrefix(prefix string) error {
+	if errs := validation.IsDNS1123Label(prefix); len(errs) > 0 {
+		return fmt.Errorf("invalid prefix %q: %s", prefix, strings.Join(errs, ", "))
+	}
+	if len(prefix) > maxNormalizedInterfacePrefixLength {
+		return fmt.Errorf("invalid prefix %q: must be no more than %d characters", prefix, maxNormalizedInterfacePrefixLength)
+	}
+	return nil
+}
+
 // NormalizeInterfaceName determines the appropriate name for an interface in
 // Kubernetes. If the original interface name (ifName) is already a valid
 // DNS-1123 label, it's returned as is. Otherwise, it's encoded using Base32,
-// prefixed with NormalizedPrefix, and returned.
+// prefixed with NormalizedInterfacePrefix, and returned.
 //
 // Linux interface names (often limited by IFNAMSIZ, typically 16) plus the
 // base32 encoding and the normalized prefix (11) are within the DNS-1123 label,
 // which has a maximum length of 63.
 func NormalizeInterfaceName(ifName string) string {
+	return NormalizeInterfaceNameWithPrefix(ifName, NormalizedInterfacePrefix)
+}
+
+// NormalizeInterfaceNameWithPrefix is NormalizeInterfaceName with a custom
+// prefix for the normalized names, validated with
+// ValidateNormalizedInterfacePrefix.
+func NormalizeInterfaceNameWithPrefix(ifName, prefix string) string {
 	if ifName == "" {
 		return ""
 	}
@@ -49,12 +81,45 @@ func NormalizeInterfaceName(ifName string) string {
 	}
 
 	klog.V(4).Infof("Interface name '%s' is not DNS-1123 compliant, normalizing.", ifName)
-	encodedPayload := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(ifName))
-	normalizedName := NormalizedInterfacePrefix + "-" + strings.ToLower(encodedPayload)
+	encodedPayload := interfaceNameEncoding.EncodeToString([]byte(ifName))
+	normalizedName := prefix + "-" + strings.ToLower(encodedPayload)
 
 	return normalizedName
 }
 
+// OriginalInterfaceName returns the interface name of a device name returned
+// by NormalizeInterfaceNameWithPrefix, whatever the prefix used. The base32
+// alphabet has no "-", so the payload follows the last one. Device names that
+// do not decode to an interface name that needed the normalization are
+// returned as is.
+func OriginalInterfaceName(deviceName string) string {
+	i := strings.LastIndex(deviceName, "-")
+	if i < 0 {
+		return deviceName
+	}
+	payload := deviceName[i+1:]
+	decoded, err := interfaceNameEncoding.DecodeString(strings.ToUpper(payload))
+	if err != nil || !isNormalizedInterfaceName(string(decoded)) ||
+		strings.ToLower(interfaceNameEncoding.EncodeToString(decoded)) != payload {
+		return deviceName
+	}
+	return string(decoded)
+}
+
+// isNormalizedInterfaceName returns true if ifName is a valid Linux interface
+// name that is not a DNS-1123 label, the names NormalizeInterfaceName encodes.
+func isNormalizedInterfaceName(ifName string) bool {
+	if ifName == "" || len(ifName) > maxInterfaceNameLength || len(validation.IsDNS1123Label(ifName)) == 0 {
+		return false
+	}
+	for _, c := range []byte(ifName) {
+		if c <= ' ' || c >= 0x7f || c == '/' {
+			return false
+		}
+	}
+	return true
+}
+
 // NormalizePCIAddress takes a PCI address and converts it into a DNS-1123
 // acceptable format.
 func NormalizePCIAddress(pciAddress string) string {
@@ -19,6 +19,8 @@ package names
 import (
 	"strings"
 	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 func TestNormalizeInterfaceName(t *testing.T) {
@@ -79,6 +81,128 @@ func TestNormalizeInterfaceName(t *testing.T) {
 	}
 }
 
+func TestNormalizeInterfaceNameWithPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		ifName string
+		prefix string
+		want   string
+	}{
+		{
+			name:   "already compliant",
+			ifName: "eth0",
+			prefix: "nic",
+			want:   "eth0",
+		},
+		{
+			name:   "custom prefix",
+			ifName: "eth:0",
+			prefix: "nic",
+			want:   "nic-mv2gqorq",
+		},
+		{
+			name:   "custom prefix with hyphen",
+			ifName: "ETH0",
+			prefix: "team-a-nic",
+			want:   "team-a-nic-ivkeqma",
+		},
+		{
+			name:   "default prefix",
+			ifName: "eth_int",
+			prefix: NormalizedInterfacePrefix,
+			want:   NormalizeInterfaceName("eth_int"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeInterfaceNameWithPrefix(tt.ifName, tt.prefix)
+			if got != tt.want {
+				t.Errorf("NormalizeInterfaceNameWithPrefix(%q, %q) = %q, want %q", tt.ifName, tt.prefix, got, tt.want)
+			}
+			if original := OriginalInterfaceName(got); original != tt.ifName {
+				t.Errorf("OriginalInterfaceName(%q) = %q, want %q", got, original, tt.ifName)
+			}
+		})
+	}
+}
+
+func TestValidateNormalizedInterfacePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		wantErr bool
+	}{
+		{name: "default", prefix: NormalizedInterfacePrefix},
+		{name: "with hyphen", prefix: "team-a-nic"},
+		{name: "max length", prefix: strings.Repeat("a", maxNormalizedInterfacePrefixLength)},
+		{name: "too long", prefix: strings.Repeat("a", maxNormalizedInterfacePrefixLength+1), wantErr: true},
+		{name: "empty", prefix: "", wantErr: true},
+		{name: "uppercase", prefix: "NIC", wantErr: true},
+		{name: "trailing hyphen", prefix: "nic-", wantErr: true},
+		{name: "underscore", prefix: "n_ic", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNormalizedInterfacePrefix(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateNormalizedInterfacePrefix(%q) error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// The longest interface names must be valid device names.
+			got := NormalizeInterfaceNameWithPrefix(strings.Repeat("_", maxInterfaceNameLength), tt.prefix)
+			if errs := validation.IsDNS1123Label(got); len(errs) > 0 {
+				t.Errorf("NormalizeInterfaceNameWithPrefix() = %q is not a DNS-1123 label: %v", got, errs)
+			}
+		})
+	}
+}
+
+func TestOriginalInterfaceName(t *testing.T) {
+	tests := []struct {
+		name       string
+		deviceName string
+		want       string
+	}{
+		{
+			name:       "not normalized",
+			deviceName: "eth0",
+			want:       "eth0",
+		},
+		{
+			name:       "not normalized with hyphen",
+			deviceName: "my-device-1",
+			want:       "my-device-1",
+		},
+		{
+			name:       "payload decodes to a compliant name",
+			deviceName: "nic-mv2gqma",
+			want:       "nic-mv2gqma",
+		},
+		{
+			name:       "default prefix",
+			deviceName: NormalizedInterfacePrefix + "-mv2gqorq",
+			want:       "eth:0",
+		},
+		{
+			name:       "custom prefix",
+			deviceName: "team-a-nic-mv2gqx3jnz2a",
+			want:       "eth_int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OriginalInterfaceName(tt.deviceName); got != tt.want {
+				t.Errorf("OriginalInterfaceName(%q) = %q, want %q", tt.deviceName, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNormalizePCIAddress(t *testing.T) {
 	testCases := []struct {
 		name       string